@@ -53,7 +53,7 @@ func (b *BlockChain) maybeAcceptBlock(block *btcutil.Block, flags BehaviorFlags)
 	// expensive connection logic.  It also has some other nice properties
 	// such as making blocks that never become part of the main chain or
 	// blocks that fail to connect available for further analysis.
-	err = b.db.Update(func(dbTx database.Tx) error {
+	err = b.DB().Update(func(dbTx database.Tx) error {
 		return dbStoreBlock(dbTx, block)
 	})
 	if err != nil {
@@ -5,9 +5,11 @@
 package blockchain
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/wire"
 )
 
@@ -60,3 +62,56 @@ func BenchmarkUtxoFetchSlices(b *testing.B) {
 		}
 	}
 }
+
+// benchmarkBlockPrefetcher reads the blocks in the test chain in order using a
+// block prefetcher with the given depth while simulating work on each block.
+func benchmarkBlockPrefetcher(b *testing.B, depth int) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		b.Fatalf("Error loading file: %v", err)
+	}
+	chain, teardownFunc, err := chainSetup(fmt.Sprintf("prefetch%d", depth),
+		&chaincfg.MainNetParams)
+	if err != nil {
+		b.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.TstSetCoinbaseMaturity(1)
+	for i := 1; i < len(blocks); i++ {
+		if _, _, err := chain.ProcessBlock(blocks[i], BFNone); err != nil {
+			b.Fatalf("ProcessBlock fail on block %v: %v", i, err)
+		}
+	}
+	bestHeight := chain.BestSnapshot().Height
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		prefetcher := chain.NewBlockPrefetcher(0, bestHeight, depth)
+		for {
+			block, err := prefetcher.Next()
+			if err != nil {
+				b.Fatalf("Next: unexpected error: %v", err)
+			}
+			if block == nil {
+				break
+			}
+
+			// Simulate processing the block.
+			for _, tx := range block.Transactions() {
+				tx.MsgTx().TxHash()
+			}
+		}
+		prefetcher.Stop()
+	}
+}
+
+// BenchmarkBlockPrefetcherDisabled benchmarks reading blocks without
+// prefetching.
+func BenchmarkBlockPrefetcherDisabled(b *testing.B) {
+	benchmarkBlockPrefetcher(b, 0)
+}
+
+// BenchmarkBlockPrefetcher benchmarks reading blocks with prefetching.
+func BenchmarkBlockPrefetcher(b *testing.B) {
+	benchmarkBlockPrefetcher(b, 4)
+}
@@ -225,7 +225,8 @@ func (node *blockNode) CalcPastMedianTime() time.Time {
 type blockIndex struct {
 	// The following fields are set when the instance is created and can't
 	// be changed afterwards, so there is no need to protect them with a
-	// separate mutex.
+	// separate mutex.  The only exception is the database, which may be
+	// replaced via SwapDB while holding both the chain and index locks.
 	db          database.DB
 	chainParams *chaincfg.Params
 
@@ -7,6 +7,7 @@ package blockchain
 
 import (
 	"container/list"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -25,6 +26,12 @@ const (
 	maxOrphanBlocks = 100
 )
 
+// ErrChainNotInitialized is returned by New when the database has not been
+// initialized with the genesis block and automatic initialization is disabled
+// by Config.NoGenesisInit.  See InitChain.
+var ErrChainNotInitialized = errors.New("chain database is not initialized " +
+	"with the genesis block")
+
 // BlockLocator is used to help locate a specific block.  The algorithm for
 // building the block locator is to add the hashes in reverse order until
 // the genesis block is reached.  In order to keep the list of locator hashes
@@ -93,15 +100,21 @@ func newBestState(node *blockNode, blockSize, blockWeight, numTxns,
 type BlockChain struct {
 	// The following fields are set when the instance is created and can't
 	// be changed afterwards, so there is no need to protect them with a
-	// separate mutex.
+	// separate mutex.  The database is the only exception since it may be
+	// replaced via SwapDB, so it is protected by dbLock and must be
+	// accessed through DB.
 	checkpoints         []chaincfg.Checkpoint
 	checkpointsByHeight map[int32]*chaincfg.Checkpoint
+	dbLock              sync.RWMutex
 	db                  database.DB
 	chainParams         *chaincfg.Params
 	timeSource          MedianTimeSource
 	sigCache            *txscript.SigCache
 	indexManager        IndexManager
 	hashCache           *txscript.HashCache
+	scriptWorkers       int
+	noGenesisInit       bool
+	ruleToggles         []RuleToggle
 
 	// The following fields are calculated based upon the provided chain
 	// parameters.  They are also set when the instance is created and
@@ -129,10 +142,22 @@ type BlockChain struct {
 
 	// These fields are related to handling of orphan blocks.  They are
 	// protected by a combination of the chain lock and the orphan lock.
-	orphanLock   sync.RWMutex
-	orphans      map[chainhash.Hash]*orphanBlock
-	prevOrphans  map[chainhash.Hash][]*orphanBlock
-	oldestOrphan *orphanBlock
+	orphanLock      sync.RWMutex
+	orphans         map[chainhash.Hash]*orphanBlock
+	prevOrphans     map[chainhash.Hash][]*orphanBlock
+	oldestOrphan    *orphanBlock
+	orphansResolved uint64
+	orphansExpired  uint64
+
+	// These fields are related to tracking recently accepted side chain
+	// blocks by their headers.  The maximum is set when the instance is
+	// created and the rest are protected by the side chain lock.
+	maxSideChainBlocks int
+	sideChainLock      sync.RWMutex
+	sideChainHeaders   map[chainhash.Hash]wire.BlockHeader
+	sideChainOrder     []chainhash.Hash
+	sideChainAccepted  uint64
+	sideChainEvicted   uint64
 
 	// These fields are related to checkpoint handling.  They are protected
 	// by the chain lock.
@@ -242,13 +267,96 @@ func (b *BlockChain) GetOrphanRoot(hash *chainhash.Hash) *chainhash.Hash {
 	return orphanRoot
 }
 
+// OrphanMissingAncestors returns the hashes of the ancestors of the provided
+// orphan block that prevent it from being connected to the chain.  They are
+// ordered starting with the parent of the orphan, followed by any further
+// ancestors that are themselves orphans, and end with the hash of the block
+// that has not been received at all.  Nil is returned when the provided hash
+// is not a known orphan.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) OrphanMissingAncestors(hash *chainhash.Hash) []chainhash.Hash {
+	// Protect concurrent access.  Using a read lock only so multiple
+	// readers can query without blocking each other.
+	b.orphanLock.RLock()
+	defer b.orphanLock.RUnlock()
+
+	orphan, exists := b.orphans[*hash]
+	if !exists {
+		return nil
+	}
+
+	// Keep looping while the parent of each orphaned block is known and
+	// is an orphan itself.  The final parent is the missing block.
+	var ancestors []chainhash.Hash
+	for exists {
+		prevHash := orphan.block.MsgBlock().Header.PrevBlock
+		ancestors = append(ancestors, prevHash)
+		orphan, exists = b.orphans[prevHash]
+	}
+
+	return ancestors
+}
+
+// OrphanStats houses statistics about how the orphan blocks received by the
+// chain were resolved.
+type OrphanStats struct {
+	// Orphans is the number of orphan blocks currently held.
+	Orphans int
+
+	// Resolved is the total number of orphan blocks removed from the orphan
+	// pool because their parent became available.
+	Resolved uint64
+
+	// Expired is the total number of orphan blocks removed from the orphan
+	// pool without their parent becoming available, either because they
+	// expired or to make room for newer orphans.
+	Expired uint64
+}
+
+// ResolutionRate returns the fraction of the orphan blocks removed from the
+// orphan pool that were resolved, in the range [0, 1].  A rate well below one
+// hints that peers are sending orphans which never connect rather than blocks
+// that merely arrived out of order.  It returns one when no orphans have been
+// removed yet.
+func (s OrphanStats) ResolutionRate() float64 {
+	total := s.Resolved + s.Expired
+	if total == 0 {
+		return 1
+	}
+	return float64(s.Resolved) / float64(total)
+}
+
+// OrphanStats returns statistics about how the orphan blocks received by the
+// chain were resolved.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) OrphanStats() OrphanStats {
+	b.orphanLock.RLock()
+	defer b.orphanLock.RUnlock()
+
+	return OrphanStats{
+		Orphans:  len(b.orphans),
+		Resolved: b.orphansResolved,
+		Expired:  b.orphansExpired,
+	}
+}
+
 // removeOrphanBlock removes the passed orphan block from the orphan pool and
-// previous orphan index.
-func (b *BlockChain) removeOrphanBlock(orphan *orphanBlock) {
+// previous orphan index.  The resolved flag indicates whether the orphan is
+// being removed because its parent became available and is used to track the
+// orphan resolution statistics.
+func (b *BlockChain) removeOrphanBlock(orphan *orphanBlock, resolved bool) {
 	// Protect concurrent access.
 	b.orphanLock.Lock()
 	defer b.orphanLock.Unlock()
 
+	if resolved {
+		b.orphansResolved++
+	} else {
+		b.orphansExpired++
+	}
+
 	// Remove the orphan block from the orphan pool.
 	orphanHash := orphan.block.Hash()
 	delete(b.orphans, *orphanHash)
@@ -287,7 +395,7 @@ func (b *BlockChain) addOrphanBlock(block *btcutil.Block) {
 	// Remove expired orphan blocks.
 	for _, oBlock := range b.orphans {
 		if time.Now().After(oBlock.expiration) {
-			b.removeOrphanBlock(oBlock)
+			b.removeOrphanBlock(oBlock, false)
 			continue
 		}
 
@@ -301,7 +409,7 @@ func (b *BlockChain) addOrphanBlock(block *btcutil.Block) {
 	// Limit orphan blocks to prevent memory exhaustion.
 	if len(b.orphans)+1 > maxOrphanBlocks {
 		// Remove the oldest orphan to make room for the new one.
-		b.removeOrphanBlock(b.oldestOrphan)
+		b.removeOrphanBlock(b.oldestOrphan, false)
 		b.oldestOrphan = nil
 	}
 
@@ -598,46 +706,16 @@ func (b *BlockChain) connectBlock(node *blockNode, block *btcutil.Block,
 		curTotalTxns+numTxns, node.CalcPastMedianTime())
 
 	// Atomically insert info into the database.
-	err = b.db.Update(func(dbTx database.Tx) error {
-		// Update best block state.
-		err := dbPutBestState(dbTx, state, node.workSum)
-		if err != nil {
-			return err
-		}
-
-		// Add the block hash and height to the block index which tracks
-		// the main chain.
-		err = dbPutBlockIndex(dbTx, block.Hash(), node.height)
-		if err != nil {
-			return err
-		}
-
+	err = b.DB().Update(func(dbTx database.Tx) error {
 		// Update the utxo set using the state of the utxo view.  This
 		// entails removing all of the utxos spent and adding the new
 		// ones created by the block.
-		err = dbPutUtxoView(dbTx, view)
+		err := dbPutUtxoView(dbTx, view)
 		if err != nil {
 			return err
 		}
 
-		// Update the transaction spend journal by adding a record for
-		// the block that contains all txos spent by it.
-		err = dbPutSpendJournalEntry(dbTx, block.Hash(), stxos)
-		if err != nil {
-			return err
-		}
-
-		// Allow the index manager to call each of the currently active
-		// optional indexes with the block being connected so they can
-		// update themselves accordingly.
-		if b.indexManager != nil {
-			err := b.indexManager.ConnectBlock(dbTx, block, stxos)
-			if err != nil {
-				return err
-			}
-		}
-
-		return nil
+		return b.dbConnectBlock(dbTx, node, block, state, stxos)
 	})
 	if err != nil {
 		return err
@@ -683,7 +761,7 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *btcutil.Block, view
 	// Load the previous block since some details for it are needed below.
 	prevNode := node.parent
 	var prevBlock *btcutil.Block
-	err := b.db.View(func(dbTx database.Tx) error {
+	err := b.DB().View(func(dbTx database.Tx) error {
 		var err error
 		prevBlock, err = dbFetchBlockByNode(dbTx, prevNode)
 		return err
@@ -710,24 +788,11 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *btcutil.Block, view
 	state := newBestState(prevNode, blockSize, blockWeight, numTxns,
 		newTotalTxns, prevNode.CalcPastMedianTime())
 
-	err = b.db.Update(func(dbTx database.Tx) error {
-		// Update best block state.
-		err := dbPutBestState(dbTx, state, node.workSum)
-		if err != nil {
-			return err
-		}
-
-		// Remove the block hash and height from the block index which
-		// tracks the main chain.
-		err = dbRemoveBlockIndex(dbTx, block.Hash(), node.height)
-		if err != nil {
-			return err
-		}
-
+	err = b.DB().Update(func(dbTx database.Tx) error {
 		// Update the utxo set using the state of the utxo view.  This
 		// entails restoring all of the utxos spent and removing the new
 		// ones created by the block.
-		err = dbPutUtxoView(dbTx, view)
+		err := dbPutUtxoView(dbTx, view)
 		if err != nil {
 			return err
 		}
@@ -739,24 +804,7 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *btcutil.Block, view
 			return err
 		}
 
-		// Update the transaction spend journal by removing the record
-		// that contains all txos spent by the block.
-		err = dbRemoveSpendJournalEntry(dbTx, block.Hash())
-		if err != nil {
-			return err
-		}
-
-		// Allow the index manager to call each of the currently active
-		// optional indexes with the block being disconnected so they
-		// can update themselves accordingly.
-		if b.indexManager != nil {
-			err := b.indexManager.DisconnectBlock(dbTx, block, stxos)
-			if err != nil {
-				return err
-			}
-		}
-
-		return nil
+		return b.dbDisconnectBlock(dbTx, node, block, state, stxos)
 	})
 	if err != nil {
 		return err
@@ -788,6 +836,87 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *btcutil.Block, view
 	return nil
 }
 
+// dbConnectBlock updates the best state, the block index which tracks the main
+// chain, the spend journal, and any optional indexes for the passed block being
+// connected to the end of the main chain.  The utxo set is not updated since
+// the caller may be connecting several blocks against the same utxo view.
+func (b *BlockChain) dbConnectBlock(dbTx database.Tx, node *blockNode,
+	block *btcutil.Block, state *BestState, stxos []SpentTxOut) error {
+
+	// Update best block state.
+	err := dbPutBestState(dbTx, state, node.workSum)
+	if err != nil {
+		return err
+	}
+
+	// Add the block hash and height to the block index which tracks the
+	// main chain.
+	err = dbPutBlockIndex(dbTx, block.Hash(), node.height)
+	if err != nil {
+		return err
+	}
+
+	// Update the transaction spend journal by adding a record for the
+	// block that contains all txos spent by it.
+	err = dbPutSpendJournalEntry(dbTx, block.Hash(), stxos)
+	if err != nil {
+		return err
+	}
+
+	// Allow the index manager to call each of the currently active
+	// optional indexes with the block being connected so they can update
+	// themselves accordingly.
+	if b.indexManager != nil {
+		err := b.indexManager.ConnectBlock(dbTx, block, stxos)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dbDisconnectBlock updates the best state, the block index which tracks the
+// main chain, the spend journal, and any optional indexes for the passed block
+// being disconnected from the end of the main chain.  The passed stxos are the
+// spend journal entry for the block.  The utxo set is not updated since the
+// caller may be disconnecting several blocks against the same utxo view.
+func (b *BlockChain) dbDisconnectBlock(dbTx database.Tx, node *blockNode,
+	block *btcutil.Block, state *BestState, stxos []SpentTxOut) error {
+
+	// Update best block state.
+	err := dbPutBestState(dbTx, state, node.workSum)
+	if err != nil {
+		return err
+	}
+
+	// Remove the block hash and height from the block index which tracks
+	// the main chain.
+	err = dbRemoveBlockIndex(dbTx, block.Hash(), node.height)
+	if err != nil {
+		return err
+	}
+
+	// Update the transaction spend journal by removing the record that
+	// contains all txos spent by the block.
+	err = dbRemoveSpendJournalEntry(dbTx, block.Hash())
+	if err != nil {
+		return err
+	}
+
+	// Allow the index manager to call each of the currently active
+	// optional indexes with the block being disconnected so they can
+	// update themselves accordingly.
+	if b.indexManager != nil {
+		err := b.indexManager.DisconnectBlock(dbTx, block, stxos)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // countSpentOutputs returns the number of utxos the passed block spends.
 func countSpentOutputs(block *btcutil.Block) int {
 	// Exclude the coinbase transaction since it can't spend anything.
@@ -860,7 +989,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 	for e := detachNodes.Front(); e != nil; e = e.Next() {
 		n := e.Value.(*blockNode)
 		var block *btcutil.Block
-		err := b.db.View(func(dbTx database.Tx) error {
+		err := b.DB().View(func(dbTx database.Tx) error {
 			var err error
 			block, err = dbFetchBlockByNode(dbTx, n)
 			return err
@@ -876,7 +1005,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err = view.fetchInputUtxos(b.db, block)
+		err = view.fetchInputUtxos(b.DB(), block)
 		if err != nil {
 			return err
 		}
@@ -884,7 +1013,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		// Load all of the spent txos for the block from the spend
 		// journal.
 		var stxos []SpentTxOut
-		err = b.db.View(func(dbTx database.Tx) error {
+		err = b.DB().View(func(dbTx database.Tx) error {
 			stxos, err = dbFetchSpendJournalEntry(dbTx, block)
 			return err
 		})
@@ -896,7 +1025,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		detachBlocks = append(detachBlocks, block)
 		detachSpentTxOuts = append(detachSpentTxOuts, stxos)
 
-		err = view.disconnectTransactions(b.db, block, stxos)
+		err = view.disconnectTransactions(b.DB(), block, stxos)
 		if err != nil {
 			return err
 		}
@@ -927,7 +1056,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		n := e.Value.(*blockNode)
 
 		var block *btcutil.Block
-		err := b.db.View(func(dbTx database.Tx) error {
+		err := b.DB().View(func(dbTx database.Tx) error {
 			var err error
 			block, err = dbFetchBlockByNode(dbTx, n)
 			return err
@@ -943,7 +1072,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		// checkConnectBlock gets skipped, we still need to update the UTXO
 		// view.
 		if b.index.NodeStatus(n).KnownValid() {
-			err = view.fetchInputUtxos(b.db, block)
+			err = view.fetchInputUtxos(b.DB(), block)
 			if err != nil {
 				return err
 			}
@@ -964,7 +1093,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		// In the case the block is determined to be invalid due to a
 		// rule violation, mark it as invalid and mark all of its
 		// descendants as having an invalid ancestor.
-		err = b.checkConnectBlock(n, block, view, nil)
+		err = b.checkConnectBlock(n, block, view, nil, BFNone)
 		if err != nil {
 			if _, ok := err.(RuleError); ok {
 				b.index.SetStatusFlags(n, statusValidateFailed)
@@ -980,6 +1109,24 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		newBest = n
 	}
 
+	// No warnings about unknown rules until the chain is current.
+	if b.isCurrent() {
+		// Warn if any unknown new rules are either about to activate or
+		// have already been activated.
+		for e := attachNodes.Front(); e != nil; e = e.Next() {
+			n := e.Value.(*blockNode)
+			if err := b.warnUnknownRuleActivations(n); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Write any block status changes to DB before updating best state.
+	err := b.index.flushToDB()
+	if err != nil {
+		return err
+	}
+
 	// Reset the view for the actual connection code below.  This is
 	// required because the view was previously modified when checking if
 	// the reorg would be successful and the connection code requires the
@@ -988,61 +1135,133 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 	view = NewUtxoViewpoint()
 	view.SetBestHash(&b.bestChain.Tip().hash)
 
-	// Disconnect blocks from the main chain.
-	for i, e := 0, detachNodes.Front(); e != nil; i, e = i+1, e.Next() {
-		n := e.Value.(*blockNode)
-		block := detachBlocks[i]
+	// Disconnect and connect all of the blocks within a single database
+	// transaction so the reorganize is applied atomically with a single
+	// write to disk.  Should any of the updates fail, the transaction is
+	// rolled back, which leaves both the database and the chain state in
+	// memory on the old best chain.
+	//
+	// The utxo view accumulates the changes made by every block and is
+	// only written once all of them have been applied since the utxos
+	// changed by earlier blocks are not visible in the database until the
+	// transaction is committed.
+	//
+	// All reads go through the open transaction since opening another one
+	// while it is held would deadlock behind a pending database close.
+	b.stateLock.RLock()
+	totalTxns := b.stateSnapshot.TotalTxns
+	b.stateLock.RUnlock()
+	var state *BestState
+	err = b.DB().Update(func(dbTx database.Tx) error {
+		// Disconnect blocks from the main chain.
+		for i, e := 0, detachNodes.Front(); e != nil; i, e = i+1, e.Next() {
+			n := e.Value.(*blockNode)
+			block := detachBlocks[i]
+
+			// Load all of the utxos referenced by the block that
+			// aren't already in the view.
+			err := view.fetchInputUtxosTx(dbTx, block)
+			if err != nil {
+				return err
+			}
 
-		// Load all of the utxos referenced by the block that aren't
-		// already in the view.
-		err := view.fetchInputUtxos(b.db, block)
-		if err != nil {
-			return err
-		}
+			// Update the view to unspend all of the spent txos and
+			// remove the utxos created by the block.
+			err = view.disconnectTransactionsTx(dbTx, block,
+				detachSpentTxOuts[i])
+			if err != nil {
+				return err
+			}
 
-		// Update the view to unspend all of the spent txos and remove
-		// the utxos created by the block.
-		err = view.disconnectTransactions(b.db, block,
-			detachSpentTxOuts[i])
-		if err != nil {
-			return err
+			// Generate the best state for the previous block, which
+			// becomes the end of the main chain.
+			prevBlock, err := dbFetchBlockByNode(dbTx, n.parent)
+			if err != nil {
+				return err
+			}
+			totalTxns -= uint64(len(block.MsgBlock().Transactions))
+			state = newBestState(n.parent,
+				uint64(prevBlock.MsgBlock().SerializeSize()),
+				uint64(GetBlockWeight(prevBlock)),
+				uint64(len(prevBlock.MsgBlock().Transactions)),
+				totalTxns, n.parent.CalcPastMedianTime())
+
+			err = b.dbDisconnectBlock(dbTx, n, block, state,
+				detachSpentTxOuts[i])
+			if err != nil {
+				return err
+			}
 		}
 
-		// Update the database and chain state.
-		err = b.disconnectBlock(n, block, view)
-		if err != nil {
-			return err
+		// Connect the new best chain blocks.
+		for i, e := 0, attachNodes.Front(); e != nil; i, e = i+1, e.Next() {
+			n := e.Value.(*blockNode)
+			block := attachBlocks[i]
+
+			// Load all of the utxos referenced by the block that
+			// aren't already in the view.
+			err := view.fetchInputUtxosTx(dbTx, block)
+			if err != nil {
+				return err
+			}
+
+			// Update the view to mark all utxos referenced by the
+			// block as spent and add all transactions being created
+			// by this block to it.  Also, provide an stxo slice so
+			// the spent txout details are generated.
+			stxos := make([]SpentTxOut, 0, countSpentOutputs(block))
+			err = view.connectTransactions(block, &stxos)
+			if err != nil {
+				return err
+			}
+
+			numTxns := uint64(len(block.MsgBlock().Transactions))
+			totalTxns += numTxns
+			state = newBestState(n,
+				uint64(block.MsgBlock().SerializeSize()),
+				uint64(GetBlockWeight(block)), numTxns, totalTxns,
+				n.CalcPastMedianTime())
+
+			err = b.dbConnectBlock(dbTx, n, block, state, stxos)
+			if err != nil {
+				return err
+			}
 		}
+
+		// Update the utxo set using the combined state of the utxo view.
+		return dbPutUtxoView(dbTx, view)
+	})
+	if err != nil {
+		return err
 	}
 
-	// Connect the new best chain blocks.
-	for i, e := 0, attachNodes.Front(); e != nil; i, e = i+1, e.Next() {
-		n := e.Value.(*blockNode)
-		block := attachBlocks[i]
+	// Prune fully spent entries and mark all entries in the view unmodified
+	// now that the modifications have been committed to the database.
+	view.commit()
 
-		// Load all of the utxos referenced by the block that aren't
-		// already in the view.
-		err := view.fetchInputUtxos(b.db, block)
-		if err != nil {
-			return err
-		}
+	// The new best node is now the end of the best chain.
+	b.bestChain.SetTip(newBest)
 
-		// Update the view to mark all utxos referenced by the block
-		// as spent and add all transactions being created by this block
-		// to it.  Also, provide an stxo slice so the spent txout
-		// details are generated.
-		stxos := make([]SpentTxOut, 0, countSpentOutputs(block))
-		err = view.connectTransactions(block, &stxos)
-		if err != nil {
-			return err
-		}
+	// Update the state for the best block.  Notice how this replaces the
+	// entire struct instead of updating the existing one.  This effectively
+	// allows the old version to act as a snapshot which callers can use
+	// freely without needing to hold a lock for the duration.  See the
+	// comments on the state variable for more details.
+	b.stateLock.Lock()
+	b.stateSnapshot = state
+	b.stateLock.Unlock()
 
-		// Update the database and chain state.
-		err = b.connectBlock(n, block, view, stxos)
-		if err != nil {
-			return err
-		}
+	// Notify the caller that the blocks were disconnected from and
+	// connected to the main chain.  The caller would typically want to
+	// react with actions such as updating wallets.
+	b.chainLock.Unlock()
+	for _, block := range detachBlocks {
+		b.sendNotification(NTBlockDisconnected, block)
 	}
+	for _, block := range attachBlocks {
+		b.sendNotification(NTBlockConnected, block)
+	}
+	b.chainLock.Lock()
 
 	// Log the point where the chain forked and old and new best chain
 	// heads.
@@ -1070,10 +1289,14 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 // The flags modify the behavior of this function as follows:
 //   - BFFastAdd: Avoids several expensive transaction validation operations.
 //     This is useful when using checkpoints.
+//   - BFNoScriptCheck: The transaction scripts are not executed when the
+//     block extends the main chain.  The block is not marked as valid, so
+//     its scripts are verified should it be reconnected by a reorganize.
 //
 // This function MUST be called with the chain state lock held (for writes).
 func (b *BlockChain) connectBestChain(node *blockNode, block *btcutil.Block, flags BehaviorFlags) (bool, error) {
 	fastAdd := flags&BFFastAdd == BFFastAdd
+	noScriptCheck := flags&BFNoScriptCheck == BFNoScriptCheck
 
 	flushIndexState := func() {
 		// Intentionally ignore errors writing updated node status to DB. If
@@ -1100,9 +1323,12 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *btcutil.Block, fla
 		view.SetBestHash(parentHash)
 		stxos := make([]SpentTxOut, 0, countSpentOutputs(block))
 		if !fastAdd {
-			err := b.checkConnectBlock(node, block, view, &stxos)
+			err := b.checkConnectBlock(node, block, view, &stxos,
+				flags)
 			if err == nil {
-				b.index.SetStatusFlags(node, statusValid)
+				if !noScriptCheck {
+					b.index.SetStatusFlags(node, statusValid)
+				}
 			} else if _, ok := err.(RuleError); ok {
 				b.index.SetStatusFlags(node, statusValidateFailed)
 			} else {
@@ -1121,7 +1347,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *btcutil.Block, fla
 		// utxos, spend them, and add the new utxos being created by
 		// this block.
 		if fastAdd {
-			err := view.fetchInputUtxos(b.db, block)
+			err := view.fetchInputUtxos(b.DB(), block)
 			if err != nil {
 				return false, err
 			}
@@ -1150,8 +1376,10 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *btcutil.Block, fla
 
 		// If this is fast add, or this block node isn't yet marked as
 		// valid, then we'll update its status and flush the state to
-		// disk again.
-		if fastAdd || !b.index.NodeStatus(node).KnownValid() {
+		// disk again unless its scripts were skipped.
+		if !noScriptCheck && (fastAdd ||
+			!b.index.NodeStatus(node).KnownValid()) {
+
 			b.index.SetStatusFlags(node, statusValid)
 			flushIndexState()
 		}
@@ -1177,6 +1405,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *btcutil.Block, fla
 				"which forks the chain at height %d/block %v",
 				node.hash, fork.height, fork.hash)
 		}
+		b.addSideChainBlock(block)
 
 		return false, nil
 	}
@@ -1193,6 +1422,11 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *btcutil.Block, fla
 	// Reorganize the chain.
 	log.Infof("REORGANIZE: Block %v is causing a reorganize.", node.hash)
 	err := b.reorganizeChain(detachNodes, attachNodes)
+	if err == nil {
+		for e := attachNodes.Front(); e != nil; e = e.Next() {
+			b.removeSideChainBlock(&e.Value.(*blockNode).hash)
+		}
+	}
 
 	// Either getReorganizeNodes or reorganizeChain could have made unsaved
 	// changes to the block index, so flush regardless of whether there was an
@@ -1701,6 +1935,57 @@ type Config struct {
 	// This field can be nil if the caller is not interested in using a
 	// signature cache.
 	HashCache *txscript.HashCache
+
+	// MaxSideChainBlocks is the maximum number of recently accepted blocks
+	// that do not extend the best chain to track so alternate chains can
+	// be relayed.  Only the headers of the blocks are kept in memory since
+	// the blocks themselves are always stored in the database.  The oldest
+	// side chain block is no longer retained when the maximum is exceeded.
+	//
+	// The zero value retains no side chain blocks.
+	MaxSideChainBlocks int
+
+	// ScriptWorkers is the maximum number of goroutines used to validate
+	// the scripts of the transaction inputs in a block in parallel.
+	//
+	// The zero value uses three goroutines per processor core.
+	ScriptWorkers int
+
+	// NoGenesisInit disables initializing a database that has not been
+	// initialized yet with the genesis block.  New returns
+	// ErrChainNotInitialized for such databases instead, which allows the
+	// database to be initialized externally, such as by restoring a
+	// snapshot, or explicitly with InitChain.
+	NoGenesisInit bool
+
+	// RuleToggles specifies additional consensus rules to enforce for the
+	// blocks at or after their activation heights, which allows tests to
+	// exercise fork activations deterministically.  They are only
+	// permitted on the regression and simulation test networks.
+	RuleToggles []RuleToggle
+}
+
+// InitChain initializes the passed database with the genesis block of the
+// passed network when it has not been initialized yet.  Databases that are
+// already initialized are left unchanged.  It is intended for initializing
+// databases explicitly when automatic initialization is disabled by
+// Config.NoGenesisInit.
+func InitChain(db database.DB, params *chaincfg.Params) error {
+	var initialized bool
+	err := db.View(func(dbTx database.Tx) error {
+		initialized = dbTx.Metadata().Get(chainStateKeyName) != nil
+		return nil
+	})
+	if err != nil || initialized {
+		return err
+	}
+
+	_, err = New(&Config{
+		DB:          db,
+		ChainParams: params,
+		TimeSource:  NewMedianTime(),
+	})
+	return err
 }
 
 // New returns a BlockChain instance using the provided configuration details.
@@ -1735,6 +2020,11 @@ func New(config *Config) (*BlockChain, error) {
 	}
 
 	params := config.ChainParams
+	if len(config.RuleToggles) > 0 && !allowsRuleToggles(params) {
+		return nil, AssertError("blockchain.New rule toggles are " +
+			"not permitted on " + params.Name)
+	}
+
 	targetTimespan := int64(params.TargetTimespan / time.Second)
 	targetTimePerBlock := int64(params.TargetTimePerBlock / time.Second)
 	adjustmentFactor := params.RetargetAdjustmentFactor
@@ -1751,9 +2041,14 @@ func New(config *Config) (*BlockChain, error) {
 		blocksPerRetarget:   int32(targetTimespan / targetTimePerBlock),
 		index:               newBlockIndex(config.DB, params),
 		hashCache:           config.HashCache,
+		scriptWorkers:       config.ScriptWorkers,
+		noGenesisInit:       config.NoGenesisInit,
+		ruleToggles:         config.RuleToggles,
 		bestChain:           newChainView(nil),
 		orphans:             make(map[chainhash.Hash]*orphanBlock),
 		prevOrphans:         make(map[chainhash.Hash][]*orphanBlock),
+		maxSideChainBlocks:  config.MaxSideChainBlocks,
+		sideChainHeaders:    make(map[chainhash.Hash]wire.BlockHeader),
 		warningCaches:       newThresholdCaches(vbNumBits),
 		deploymentCaches:    newThresholdCaches(chaincfg.DefinedDeployments),
 	}
@@ -5,6 +5,10 @@
 package blockchain
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -12,6 +16,8 @@ import (
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 )
 
@@ -111,6 +117,63 @@ func TestHaveBlock(t *testing.T) {
 	}
 }
 
+// TestOrphanMissingAncestors ensures the ancestors preventing an orphan from
+// connecting are reported.
+func TestOrphanMissingAncestors(t *testing.T) {
+	// Load up blocks such that there is a chain.
+	// (genesis block) -> 1 -> 2 -> 3 -> 4
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v\n", err)
+	}
+
+	// Create a new database and chain instance to run tests against.
+	chain, teardownFunc, err := chainSetup("orphanmissingancestors",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Process blocks 3 and 4 without their ancestors so they become
+	// orphans with block 2 missing.
+	for _, block := range blocks[3:5] {
+		_, isOrphan, err := chain.ProcessBlock(block, BFNone)
+		if err != nil {
+			t.Fatalf("Unable to process block: %v", err)
+		}
+		if !isOrphan {
+			t.Fatalf("ProcessBlock indicated block %v is not an "+
+				"orphan when it should be", block.Hash())
+		}
+	}
+
+	tests := []struct {
+		name string
+		hash *chainhash.Hash
+		want []chainhash.Hash
+	}{{
+		name: "orphan with missing parent",
+		hash: blocks[3].Hash(),
+		want: []chainhash.Hash{*blocks[2].Hash()},
+	}, {
+		name: "orphan with orphan parent",
+		hash: blocks[4].Hash(),
+		want: []chainhash.Hash{*blocks[3].Hash(), *blocks[2].Hash()},
+	}, {
+		name: "block that is not an orphan",
+		hash: chaincfg.MainNetParams.GenesisHash,
+		want: nil,
+	}}
+	for _, test := range tests {
+		got := chain.OrphanMissingAncestors(test.hash)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got,
+				test.want)
+		}
+	}
+}
+
 // TestCalcSequenceLock tests the LockTimeToSequence function, and the
 // CalcSequenceLock method of a Chain instance. The tests exercise several
 // combinations of inputs to the CalcSequenceLock function in order to ensure
@@ -964,3 +1027,592 @@ func TestIntervalBlockHashes(t *testing.T) {
 		}
 	}
 }
+
+// TestSwapDB ensures the database backing a chain instance can only be swapped
+// for one with a matching best chain state.
+func TestSwapDB(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("swapdb",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// newChainDB returns a database initialized with the chain state for
+	// the genesis block of the passed network.
+	newChainDB := func(params *chaincfg.Params) database.DB {
+		dbPath := filepath.Join(t.TempDir(), "ffldb")
+		db, err := database.Create(testDbType, dbPath, params.Net)
+		if err != nil {
+			t.Fatalf("Failed to create db: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		paramsCopy := *params
+		_, err = New(&Config{
+			DB:          db,
+			ChainParams: &paramsCopy,
+			TimeSource:  NewMedianTime(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to create chain instance: %v", err)
+		}
+		return db
+	}
+
+	// A database for a different network has a different genesis block
+	// and therefore a mismatched tip.
+	otherDB := newChainDB(&chaincfg.SimNetParams)
+	if err := chain.SwapDB(otherDB); err == nil {
+		t.Fatal("SwapDB: expected error for mismatched database")
+	}
+	if chain.db == otherDB || chain.index.db == otherDB {
+		t.Fatal("SwapDB: database switched despite mismatched tip")
+	}
+
+	// Indexes keep their own reference to the database, so the swap must
+	// be refused while they are enabled.
+	sameDB := newChainDB(&chaincfg.RegressionNetParams)
+	chain.indexManager = &failingIndexManager{}
+	if err := chain.SwapDB(sameDB); err == nil {
+		t.Fatal("SwapDB: expected error with indexes enabled")
+	}
+	chain.indexManager = nil
+
+	if err := chain.SwapDB(sameDB); err != nil {
+		t.Fatalf("SwapDB: unexpected error: %v", err)
+	}
+	if chain.DB() != sameDB || chain.index.db != sameDB {
+		t.Fatal("SwapDB: database was not switched")
+	}
+
+	// Ensure the chain is still able to load blocks from the new database.
+	genesisHash := chaincfg.RegressionNetParams.GenesisHash
+	block, err := chain.BlockByHeight(0)
+	if err != nil {
+		t.Fatalf("BlockByHeight: unexpected error: %v", err)
+	}
+	if !block.Hash().IsEqual(genesisHash) {
+		t.Fatalf("BlockByHeight: got hash %v, want %v", block.Hash(),
+			genesisHash)
+	}
+}
+
+// newReorgTestBlock returns a block with a unique coinbase for the passed fork
+// and any passed transactions that extends the passed parent block at the
+// passed height.  The proof of work is solved against the regression test
+// network difficulty.
+func newReorgTestBlock(t *testing.T, parent *btcutil.Block, height int32,
+	fork int64, txs ...*wire.MsgTx) *btcutil.Block {
+
+	t.Helper()
+
+	coinbaseScript, err := txscript.NewScriptBuilder().
+		AddInt64(int64(height)).AddInt64(fork).Script()
+	if err != nil {
+		t.Fatalf("Unable to build coinbase script: %v", err)
+	}
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex),
+		SignatureScript: coinbaseScript,
+		Sequence:        wire.MaxTxInSequenceNum,
+	})
+	coinbase.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_TRUE}))
+
+	params := &chaincfg.RegressionNetParams
+	header := parent.MsgBlock().Header
+	msgBlock := wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:   1,
+			PrevBlock: *parent.Hash(),
+			Timestamp: header.Timestamp.Add(time.Minute),
+			Bits:      params.PowLimitBits,
+		},
+		Transactions: append([]*wire.MsgTx{coinbase}, txs...),
+	}
+	merkles := BuildMerkleTreeStore(btcutil.NewBlock(&msgBlock).Transactions(),
+		false)
+	msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+	for {
+		hash := msgBlock.Header.BlockHash()
+		if HashToBig(&hash).Cmp(params.PowLimit) <= 0 {
+			break
+		}
+		msgBlock.Header.Nonce++
+	}
+	return btcutil.NewBlock(&msgBlock)
+}
+
+// failingIndexManager is an IndexManager that fails to connect a single block.
+type failingIndexManager struct {
+	failHash chainhash.Hash
+}
+
+func (m *failingIndexManager) Init(*BlockChain, <-chan struct{}) error {
+	return nil
+}
+
+func (m *failingIndexManager) ConnectBlock(dbTx database.Tx,
+	block *btcutil.Block, stxos []SpentTxOut) error {
+
+	if *block.Hash() == m.failHash {
+		return errors.New("injected index failure")
+	}
+	return nil
+}
+
+func (m *failingIndexManager) DisconnectBlock(database.Tx, *btcutil.Block,
+	[]SpentTxOut) error {
+
+	return nil
+}
+
+// TestReorganizeAtomically ensures a multi-block reorganize is applied as a
+// single batch and that it is rolled back entirely when any block fails to
+// be applied.
+func TestReorganizeAtomically(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("reorgatomic",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	var connected, disconnected []chainhash.Hash
+	chain.Subscribe(func(n *Notification) {
+		switch n.Type {
+		case NTBlockConnected:
+			connected = append(connected, *n.Data.(*btcutil.Block).Hash())
+		case NTBlockDisconnected:
+			disconnected = append(disconnected,
+				*n.Data.(*btcutil.Block).Hash())
+		}
+	})
+
+	// newFork returns a chain of the passed number of blocks extending the
+	// genesis block.
+	genesis := btcutil.NewBlock(chaincfg.RegressionNetParams.GenesisBlock)
+	newFork := func(fork int64, numBlocks int) []*btcutil.Block {
+		blocks := make([]*btcutil.Block, 0, numBlocks)
+		parent := genesis
+		for i := 0; i < numBlocks; i++ {
+			block := newReorgTestBlock(t, parent, int32(i+1), fork)
+			blocks = append(blocks, block)
+			parent = block
+		}
+		return blocks
+	}
+	processBlocks := func(blocks []*btcutil.Block) {
+		for _, block := range blocks {
+			_, _, err := chain.ProcessBlock(block, BFNone)
+			if err != nil {
+				t.Fatalf("ProcessBlock %v: unexpected error: %v",
+					block.Hash(), err)
+			}
+		}
+	}
+	hashes := func(blocks []*btcutil.Block) []chainhash.Hash {
+		hashes := make([]chainhash.Hash, 0, len(blocks))
+		for _, block := range blocks {
+			hashes = append(hashes, *block.Hash())
+		}
+		return hashes
+	}
+
+	// assertMainChain ensures the passed blocks form the main chain and
+	// the utxo set only contains the outputs of their coinbases.
+	assertMainChain := func(main, side []*btcutil.Block) {
+		t.Helper()
+
+		tip := main[len(main)-1]
+		best := chain.BestSnapshot()
+		if best.Hash != *tip.Hash() || best.Height != int32(len(main)) {
+			t.Fatalf("best chain tip %v (height %d), want %v "+
+				"(height %d)", best.Hash, best.Height, tip.Hash(),
+				len(main))
+		}
+		for _, block := range main {
+			if !chain.MainChainHasBlock(block.Hash()) {
+				t.Fatalf("block %v not in main chain", block.Hash())
+			}
+			outpoint := wire.OutPoint{Hash: *block.Transactions()[0].Hash()}
+			entry, err := chain.FetchUtxoEntry(outpoint)
+			if err != nil || entry == nil || entry.IsSpent() {
+				t.Fatalf("utxo %v missing from main chain", outpoint)
+			}
+		}
+		for _, block := range side {
+			if chain.MainChainHasBlock(block.Hash()) {
+				t.Fatalf("block %v in main chain", block.Hash())
+			}
+			outpoint := wire.OutPoint{Hash: *block.Transactions()[0].Hash()}
+			entry, err := chain.FetchUtxoEntry(outpoint)
+			if err != nil || (entry != nil && !entry.IsSpent()) {
+				t.Fatalf("utxo %v from side chain is unspent", outpoint)
+			}
+		}
+	}
+
+	// Build a main chain of two blocks and a side chain of three blocks.
+	// The final side chain block causes a reorganize that disconnects two
+	// blocks and connects three.
+	forkA := newFork(1, 2)
+	forkB := newFork(2, 3)
+	processBlocks(forkA)
+	processBlocks(forkB[:2])
+	assertMainChain(forkA, forkB[:2])
+
+	connected, disconnected = nil, nil
+	processBlocks(forkB[2:])
+	assertMainChain(forkB, forkA)
+	want := []chainhash.Hash{*forkA[1].Hash(), *forkA[0].Hash()}
+	if !reflect.DeepEqual(disconnected, want) {
+		t.Fatalf("disconnected blocks %v, want %v", disconnected, want)
+	}
+	if want := hashes(forkB); !reflect.DeepEqual(connected, want) {
+		t.Fatalf("connected blocks %v, want %v", connected, want)
+	}
+
+	// Make the final block of a longer side chain fail to be applied and
+	// ensure the entire reorganize to it is rolled back.
+	forkC := newFork(3, 4)
+	chain.indexManager = &failingIndexManager{failHash: *forkC[3].Hash()}
+	processBlocks(forkC[:3])
+	connected, disconnected = nil, nil
+	if _, _, err := chain.ProcessBlock(forkC[3], BFNone); err == nil {
+		t.Fatal("ProcessBlock: reorganize with failing block succeeded")
+	}
+	assertMainChain(forkB, forkC)
+	if len(connected) != 0 || len(disconnected) != 0 {
+		t.Fatalf("got notifications for %d connected and %d "+
+			"disconnected blocks for failed reorganize",
+			len(connected), len(disconnected))
+	}
+
+	// The chain state in the database must match the chain state in
+	// memory.
+	err = chain.db.View(func(dbTx database.Tx) error {
+		state, err := deserializeBestChainState(
+			dbTx.Metadata().Get(chainStateKeyName))
+		if err != nil {
+			return err
+		}
+		if state.hash != *forkB[2].Hash() {
+			return fmt.Errorf("stored best chain %v, want %v",
+				state.hash, forkB[2].Hash())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// closingDB is a database that starts closing the wrapped database while the
+// first block is fetched within a write transaction once armed.
+type closingDB struct {
+	database.DB
+	armed   bool
+	closing chan error
+}
+
+// Update runs the passed function with a transaction that starts closing the
+// database when a block is fetched through it.
+func (db *closingDB) Update(fn func(tx database.Tx) error) error {
+	return db.DB.Update(func(tx database.Tx) error {
+		return fn(&closingTx{Tx: tx, db: db})
+	})
+}
+
+// closingTx is a write transaction of a closingDB.
+type closingTx struct {
+	database.Tx
+	db *closingDB
+}
+
+// FetchBlock starts closing the database when armed and gives the close time
+// to block on the open transaction before fetching the block.
+func (tx *closingTx) FetchBlock(hash *chainhash.Hash) ([]byte, error) {
+	if tx.db.armed {
+		tx.db.armed = false
+		go func() {
+			tx.db.closing <- tx.db.DB.Close()
+		}()
+		time.Sleep(100 * time.Millisecond)
+	}
+	return tx.Tx.FetchBlock(hash)
+}
+
+// TestReorganizeWhileClosing ensures a reorganize that loads utxos completes
+// while the database is waiting to close instead of deadlocking on a nested
+// transaction.
+func TestReorganizeWhileClosing(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("reorgclosing",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	processBlock := func(block *btcutil.Block) {
+		t.Helper()
+		_, _, err := chain.ProcessBlock(block, BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock %v: unexpected error: %v",
+				block.Hash(), err)
+		}
+	}
+
+	// spend returns a transaction spending the coinbase of the passed block.
+	spend := func(block *btcutil.Block) *wire.MsgTx {
+		tx := wire.NewMsgTx(1)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(
+			block.Transactions()[0].Hash(), 0), nil, nil))
+		tx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_TRUE}))
+		return tx
+	}
+
+	// Mature the coinbases of the first blocks and then build a main chain
+	// block and a longer side chain that each spend one of them.
+	params := &chaincfg.RegressionNetParams
+	var blocks []*btcutil.Block
+	parent := btcutil.NewBlock(params.GenesisBlock)
+	for height := int32(1); height <= int32(params.CoinbaseMaturity)+1; height++ {
+		block := newReorgTestBlock(t, parent, height, 0)
+		processBlock(block)
+		blocks = append(blocks, block)
+		parent = block
+	}
+	height := parent.Height() + 1
+	mainBlock := newReorgTestBlock(t, parent, height, 1, spend(blocks[0]))
+	processBlock(mainBlock)
+	sideBlock := newReorgTestBlock(t, parent, height, 2, spend(blocks[1]))
+	processBlock(sideBlock)
+	sideTip := newReorgTestBlock(t, sideBlock, height+1, 2)
+
+	// Start closing the database once the reorganize to the side chain has
+	// opened its transaction.
+	db := &closingDB{DB: chain.db, armed: true, closing: make(chan error, 1)}
+	chain.db = db
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := chain.ProcessBlock(sideTip, BFNone)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ProcessBlock %v: unexpected error: %v",
+				sideTip.Hash(), err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("reorganize deadlocked while the database was closing")
+	}
+	if err := <-db.closing; err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+	if best := chain.BestSnapshot(); best.Hash != *sideTip.Hash() {
+		t.Fatalf("best chain tip is %v, want %v", best.Hash,
+			sideTip.Hash())
+	}
+}
+
+// TestSideChainRetention ensures only the configured number of the most
+// recently accepted side chain blocks are retained and that they are no longer
+// retained once they become part of the main chain.
+func TestSideChainRetention(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("sidechainretention",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.maxSideChainBlocks = 2
+
+	// newFork returns a chain of the passed number of blocks extending the
+	// genesis block.
+	genesis := btcutil.NewBlock(chaincfg.RegressionNetParams.GenesisBlock)
+	newFork := func(fork int64, numBlocks int) []*btcutil.Block {
+		blocks := make([]*btcutil.Block, 0, numBlocks)
+		parent := genesis
+		for i := 0; i < numBlocks; i++ {
+			block := newReorgTestBlock(t, parent, int32(i+1), fork)
+			blocks = append(blocks, block)
+			parent = block
+		}
+		return blocks
+	}
+	processBlock := func(block *btcutil.Block, wantMainChain bool) {
+		t.Helper()
+
+		isMainChain, _, err := chain.ProcessBlock(block, BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock %v: unexpected error: %v",
+				block.Hash(), err)
+		}
+		if isMainChain != wantMainChain {
+			t.Fatalf("ProcessBlock %v: main chain %v, want %v",
+				block.Hash(), isMainChain, wantMainChain)
+		}
+	}
+
+	mainBlocks := newFork(0, 5)
+	for _, block := range mainBlocks {
+		processBlock(block, true)
+	}
+	stats := chain.SideChainStats()
+	if stats.Retained != 0 || stats.Accepted != 0 {
+		t.Fatalf("unexpected side chain stats with no side chain: %+v",
+			stats)
+	}
+
+	// Feed a side chain with the same amount of work as the main chain.
+	sideBlocks := newFork(1, 6)
+	for i, block := range sideBlocks[:5] {
+		processBlock(block, false)
+
+		stats := chain.SideChainStats()
+		wantRetained := i + 1
+		if wantRetained > 2 {
+			wantRetained = 2
+		}
+		want := SideChainStats{
+			Retained:    wantRetained,
+			MaxRetained: 2,
+			Accepted:    uint64(i + 1),
+			Evicted:     uint64(i + 1 - wantRetained),
+		}
+		if stats != want {
+			t.Fatalf("side chain stats after block %d: got %+v, "+
+				"want %+v", i+1, stats, want)
+		}
+	}
+	for i, block := range sideBlocks[:5] {
+		header, retained := chain.SideChainHeader(block.Hash())
+		if wantRetained := i >= 3; retained != wantRetained {
+			t.Fatalf("side chain block %d retained %v, want %v",
+				i+1, retained, wantRetained)
+		}
+		if retained && header.BlockHash() != *block.Hash() {
+			t.Fatalf("side chain block %d header hash %v, want %v",
+				i+1, header.BlockHash(), block.Hash())
+		}
+	}
+
+	// Extending the side chain causes a reorganize after which none of its
+	// blocks are side chain blocks anymore.
+	processBlock(sideBlocks[5], true)
+	if stats := chain.SideChainStats(); stats.Retained != 0 {
+		t.Fatalf("side chain blocks still retained after reorganize: "+
+			"%+v", stats)
+	}
+}
+
+// TestOrphanStats ensures orphan blocks are counted as resolved when their
+// parent becomes available and as expired when they are removed without it.
+func TestOrphanStats(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("orphanstats",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// newFork returns a chain of the passed number of blocks extending the
+	// genesis block.
+	genesis := btcutil.NewBlock(chaincfg.RegressionNetParams.GenesisBlock)
+	newFork := func(fork int64, numBlocks int) []*btcutil.Block {
+		blocks := make([]*btcutil.Block, 0, numBlocks)
+		parent := genesis
+		for i := 0; i < numBlocks; i++ {
+			block := newReorgTestBlock(t, parent, int32(i+1), fork)
+			blocks = append(blocks, block)
+			parent = block
+		}
+		return blocks
+	}
+	processBlock := func(block *btcutil.Block, wantOrphan bool) {
+		t.Helper()
+
+		_, isOrphan, err := chain.ProcessBlock(block, BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock %v: unexpected error: %v",
+				block.Hash(), err)
+		}
+		if isOrphan != wantOrphan {
+			t.Fatalf("ProcessBlock %v: orphan %v, want %v",
+				block.Hash(), isOrphan, wantOrphan)
+		}
+	}
+	if rate := chain.OrphanStats().ResolutionRate(); rate != 1 {
+		t.Fatalf("resolution rate with no orphans: got %v, want 1", rate)
+	}
+
+	// Feed blocks out of order so the orphans resolve once their parent
+	// arrives.
+	mainBlocks := newFork(0, 3)
+	processBlock(mainBlocks[2], true)
+	processBlock(mainBlocks[1], true)
+	processBlock(mainBlocks[0], false)
+	want := OrphanStats{Resolved: 2}
+	if stats := chain.OrphanStats(); stats != want {
+		t.Fatalf("orphan stats after resolving: got %+v, want %+v",
+			stats, want)
+	}
+
+	// Feed orphans whose parent never arrives and expire the first so it is
+	// removed when the next orphan is added.
+	sideBlocks := newFork(1, 3)
+	processBlock(sideBlocks[1], true)
+	chain.orphans[*sideBlocks[1].Hash()].expiration = time.Now().Add(-time.Second)
+	processBlock(sideBlocks[2], true)
+	want = OrphanStats{Orphans: 1, Resolved: 2, Expired: 1}
+	stats := chain.OrphanStats()
+	if stats != want {
+		t.Fatalf("orphan stats after expiring: got %+v, want %+v",
+			stats, want)
+	}
+	if rate := stats.ResolutionRate(); rate != 2.0/3 {
+		t.Fatalf("resolution rate: got %v, want %v", rate, 2.0/3)
+	}
+}
+
+// TestRawBlockByHash ensures the serialized form of stored blocks is returned
+// and unknown blocks are reported as not found.
+func TestRawBlockByHash(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("rawblockbyhash",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	genesis := btcutil.NewBlock(chaincfg.RegressionNetParams.GenesisBlock)
+	block := newReorgTestBlock(t, genesis, 1, 0)
+	if _, _, err := chain.ProcessBlock(block, BFNone); err != nil {
+		t.Fatalf("ProcessBlock: unexpected error: %v", err)
+	}
+
+	for _, want := range []*btcutil.Block{genesis, block} {
+		wantBytes, err := want.Bytes()
+		if err != nil {
+			t.Fatalf("unable to serialize block: %v", err)
+		}
+		got, err := chain.RawBlockByHash(want.Hash())
+		if err != nil {
+			t.Fatalf("RawBlockByHash: unexpected error: %v", err)
+		}
+		if !bytes.Equal(got, wantBytes) {
+			t.Fatalf("RawBlockByHash: got %x, want %x", got,
+				wantBytes)
+		}
+	}
+
+	_, err = chain.RawBlockByHash(&chainhash.Hash{0x01})
+	if err != ErrBlockNotFound {
+		t.Fatalf("RawBlockByHash: got %v, want %v", err,
+			ErrBlockNotFound)
+	}
+}
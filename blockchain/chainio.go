@@ -7,12 +7,14 @@ package blockchain
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/big"
 	"sync"
 	"time"
 
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/database"
 	"github.com/btcsuite/btcd/wire"
@@ -111,6 +113,13 @@ func isDbBucketNotFoundErr(err error) bool {
 	return ok && dbErr.ErrorCode == database.ErrBucketNotFound
 }
 
+// isDbBlockExistsErr returns whether or not the passed error is a
+// database.Error with an error code of database.ErrBlockExists.
+func isDbBlockExistsErr(err error) bool {
+	dbErr, ok := err.(database.Error)
+	return ok && dbErr.ErrorCode == database.ErrBlockExists
+}
+
 // dbFetchVersion fetches an individual version with the given key from the
 // metadata bucket.  It is primarily used to track versions on entities such as
 // buckets.  It returns zero if the provided key does not exist.
@@ -264,7 +273,7 @@ func (b *BlockChain) FetchSpendJournal(targetBlock *btcutil.Block) ([]SpentTxOut
 	defer b.chainLock.RUnlock()
 
 	var spendEntries []SpentTxOut
-	err := b.db.View(func(dbTx database.Tx) error {
+	err := b.DB().View(func(dbTx database.Tx) error {
 		var err error
 
 		spendEntries, err = dbFetchSpendJournalEntry(dbTx, targetBlock)
@@ -1024,7 +1033,7 @@ func (b *BlockChain) createChainState() error {
 
 	// Create the initial the database chain state including creating the
 	// necessary index buckets and inserting the genesis block.
-	err := b.db.Update(func(dbTx database.Tx) error {
+	err := b.DB().Update(func(dbTx database.Tx) error {
 		meta := dbTx.Metadata()
 
 		// Create the bucket that houses the block index data.
@@ -1092,12 +1101,34 @@ func (b *BlockChain) createChainState() error {
 			return err
 		}
 
-		// Store the genesis block into the database.
-		return dbStoreBlock(dbTx, genesisBlock)
+		// Store the genesis block into the database.  A genesis block
+		// the database reports as already stored is kept as is since it
+		// is identified by its hash.
+		err = dbStoreBlock(dbTx, genesisBlock)
+		if isDbBlockExistsErr(err) {
+			log.Debugf("Genesis block %v already stored",
+				genesisBlock.Hash())
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unable to store genesis block -- "+
+				"ensure the data directory is writable and the "+
+				"disk is not full: %w", err)
+		}
+		return nil
 	})
 	return err
 }
 
+// errWrongNetwork returns an error indicating the database contains a genesis
+// block with the passed hash that does not match the one for the provided
+// chain parameters.
+func errWrongNetwork(genesisHash *chainhash.Hash, params *chaincfg.Params) error {
+	return fmt.Errorf("database is for a different network: stored "+
+		"genesis block %v does not match the genesis block %v for %s",
+		genesisHash, params.GenesisHash, params.Name)
+}
+
 // initChainState attempts to load and initialize the chain state from the
 // database.  When the db does not yet contain any chain state, both it and the
 // chain state are initialized to the genesis block.
@@ -1105,7 +1136,7 @@ func (b *BlockChain) initChainState() error {
 	// Determine the state of the chain database. We may need to initialize
 	// everything from scratch or upgrade certain buckets.
 	var initialized, hasBlockIndex bool
-	err := b.db.View(func(dbTx database.Tx) error {
+	err := b.DB().View(func(dbTx database.Tx) error {
 		initialized = dbTx.Metadata().Get(chainStateKeyName) != nil
 		hasBlockIndex = dbTx.Metadata().Bucket(blockIndexBucketName) != nil
 		return nil
@@ -1115,20 +1146,45 @@ func (b *BlockChain) initChainState() error {
 	}
 
 	if !initialized {
+		// Leave initializing the database to the caller when automatic
+		// initialization is disabled.
+		if b.noGenesisInit {
+			return ErrChainNotInitialized
+		}
+
 		// At this point the database has not already been initialized, so
 		// initialize both it and the chain state to the genesis block.
 		return b.createChainState()
 	}
 
 	if !hasBlockIndex {
-		err := migrateBlockIndex(b.db)
+		err := migrateBlockIndex(b.DB())
 		if err != nil {
 			return nil
 		}
 	}
 
+	// Ensure the database was created for the same network as the chain
+	// parameters by comparing the stored genesis block against the
+	// expected one.  This provides a clear error when the chain is pointed
+	// at a database for a different network versus failing confusingly
+	// later on.
+	err = b.DB().View(func(dbTx database.Tx) error {
+		genesisHash, err := dbFetchHashByHeight(dbTx, 0)
+		if err != nil {
+			return err
+		}
+		if !genesisHash.IsEqual(b.chainParams.GenesisHash) {
+			return errWrongNetwork(genesisHash, b.chainParams)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
 	// Attempt to load the chain state from the database.
-	err = b.db.View(func(dbTx database.Tx) error {
+	err = b.DB().View(func(dbTx database.Tx) error {
 		// Fetch the stored chain state from the database metadata.
 		// When it doesn't exist, it means the database hasn't been
 		// initialized for use with chain yet, so break out now to allow
@@ -1165,9 +1221,7 @@ func (b *BlockChain) initChainState() error {
 			if lastNode == nil {
 				blockHash := header.BlockHash()
 				if !blockHash.IsEqual(b.chainParams.GenesisHash) {
-					return AssertError(fmt.Sprintf("initChainState: Expected "+
-						"first entry in block index to be genesis block, "+
-						"found %s", blockHash))
+					return errWrongNetwork(&blockHash, b.chainParams)
 				}
 			} else if header.PrevBlock == lastNode.hash {
 				// Since we iterate block headers in order of height, if the
@@ -1375,7 +1429,7 @@ func (b *BlockChain) BlockByHeight(blockHeight int32) (*btcutil.Block, error) {
 
 	// Load the block from the database and return it.
 	var block *btcutil.Block
-	err := b.db.View(func(dbTx database.Tx) error {
+	err := b.DB().View(func(dbTx database.Tx) error {
 		var err error
 		block, err = dbFetchBlockByNode(dbTx, node)
 		return err
@@ -1383,6 +1437,46 @@ func (b *BlockChain) BlockByHeight(blockHeight int32) (*btcutil.Block, error) {
 	return block, err
 }
 
+// ForEachBlock invokes the passed callback with each block in the main chain
+// from the start height through the end height, inclusive, along with its
+// height, in order of increasing height.  Iteration stops at the first error
+// returned by the callback, which is then returned.  The range is limited to the
+// blocks that exist, so a range extending beyond the current tip only visits
+// the blocks up to the tip.
+//
+// The blocks are loaded one at a time without holding the chain lock, so the
+// callback may call back into the chain.  Should the main chain reorganize
+// during the iteration, the remaining blocks are those of the new main chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ForEachBlock(start, end int32,
+	fn func(*btcutil.Block, int32) error) error {
+
+	if start < 0 {
+		start = 0
+	}
+	for height := start; height <= end; height++ {
+		node := b.bestChain.NodeByHeight(height)
+		if node == nil {
+			return nil
+		}
+
+		var block *btcutil.Block
+		err := b.DB().View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByNode(dbTx, node)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if err := fn(block, height); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // BlockByHash returns the block from the main chain with the given hash with
 // the appropriate chain height set.
 //
@@ -1398,10 +1492,147 @@ func (b *BlockChain) BlockByHash(hash *chainhash.Hash) (*btcutil.Block, error) {
 
 	// Load the block from the database and return it.
 	var block *btcutil.Block
-	err := b.db.View(func(dbTx database.Tx) error {
+	err := b.DB().View(func(dbTx database.Tx) error {
 		var err error
 		block, err = dbFetchBlockByNode(dbTx, node)
 		return err
 	})
 	return block, err
 }
+
+var (
+	// ErrBlockNotFound is returned by RawBlockByHash when the requested
+	// block is not known to the chain.
+	ErrBlockNotFound = errors.New("block not found")
+
+	// ErrBlockDataUnavailable is returned by RawBlockByHash when the header
+	// of the requested block is known but the block itself is not stored,
+	// such as when it was pruned or never downloaded.
+	ErrBlockDataUnavailable = errors.New("block data is not available")
+)
+
+// RawBlockByHash returns the serialized block, including witness data, with the
+// given hash as it is stored in the database.  The block is not deserialized,
+// which makes this cheaper than BlockByHash for callers that only need the raw
+// bytes.  Unlike BlockByHash, blocks that are not in the main chain are
+// returned as well.
+//
+// ErrBlockNotFound is returned when the block is not known and
+// ErrBlockDataUnavailable is returned when only its header is known.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) RawBlockByHash(hash *chainhash.Hash) ([]byte, error) {
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return nil, ErrBlockNotFound
+	}
+	if !b.index.NodeStatus(node).HaveData() {
+		return nil, ErrBlockDataUnavailable
+	}
+
+	// The returned data is only valid during the database transaction, so
+	// copy it.
+	var blockBytes []byte
+	err := b.DB().View(func(dbTx database.Tx) error {
+		serialized, err := dbTx.FetchBlock(hash)
+		if err != nil {
+			return err
+		}
+		blockBytes = make([]byte, len(serialized))
+		copy(blockBytes, serialized)
+		return nil
+	})
+	if dbErr, ok := err.(database.Error); ok &&
+		dbErr.ErrorCode == database.ErrBlockNotFound {
+
+		return nil, ErrBlockDataUnavailable
+	}
+	return blockBytes, err
+}
+
+// DB returns the database currently backing the chain instance.  It changes
+// when the database is replaced via SwapDB.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DB() database.DB {
+	b.dbLock.RLock()
+	db := b.db
+	b.dbLock.RUnlock()
+	return db
+}
+
+// SwapDB replaces the database backing the chain instance with the passed
+// database.  This is primarily intended to allow migrating between database
+// backends with minimal downtime.  The new database must already contain a
+// best chain state that matches the current best chain tip of the instance
+// or an error is returned and the chain is left untouched.
+//
+// Any pending block index updates are written to the new database.  The old
+// database is not closed, so the caller is responsible for doing so once it
+// is no longer in use.  Callers must also ensure other subsystems that access
+// the database directly are quiesced for the duration of the swap.
+//
+// An error is returned when an index manager is configured since the indexes
+// keep their own reference to the database and their state lives in it.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SwapDB(db database.DB) error {
+	if db == nil {
+		return AssertError("SwapDB database is nil")
+	}
+	if b.indexManager != nil {
+		return fmt.Errorf("unable to swap the database while indexes " +
+			"are enabled")
+	}
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	// Load the best chain state from the new database and ensure it is at
+	// the same tip as the current chain.
+	var state bestChainState
+	err := db.View(func(dbTx database.Tx) error {
+		serializedData := dbTx.Metadata().Get(chainStateKeyName)
+		if serializedData == nil {
+			return fmt.Errorf("database does not contain a chain " +
+				"state")
+		}
+
+		var err error
+		state, err = deserializeBestChainState(serializedData)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	tip := b.bestChain.Tip()
+	if state.hash != tip.hash || int32(state.height) != tip.height {
+		return fmt.Errorf("database best chain state (hash %v, height "+
+			"%d) does not match current tip (hash %v, height %d)",
+			state.hash, state.height, tip.hash, tip.height)
+	}
+
+	// Switch the block index over to the new database and write any
+	// pending updates to it so they are not lost.  Revert to the old
+	// database when that fails so the chain remains usable.
+	b.index.Lock()
+	oldDB := b.index.db
+	b.index.db = db
+	b.index.Unlock()
+	if err := b.index.flushToDB(); err != nil {
+		b.index.Lock()
+		b.index.db = oldDB
+		b.index.Unlock()
+		return err
+	}
+
+	b.dbLock.Lock()
+	b.db = db
+	b.dbLock.Unlock()
+
+	log.Infof("Switched chain database (height %d, hash %v)", tip.height,
+		tip.hash)
+
+	return nil
+}
@@ -8,9 +8,14 @@ import (
 	"bytes"
 	"errors"
 	"math/big"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/database"
 	"github.com/btcsuite/btcd/wire"
 )
@@ -719,3 +724,242 @@ func TestBestChainStateDeserializeErrors(t *testing.T) {
 		}
 	}
 }
+
+// TestWrongNetworkDatabase ensures loading a chain from a database that was
+// created for a different network fails with a clear error.
+func TestWrongNetworkDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "ffldb")
+	db, err := database.Create(testDbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Failed to create db: %v", err)
+	}
+	defer db.Close()
+
+	// Initialize the database with the regression test network genesis
+	// block.
+	regTestParams := chaincfg.RegressionNetParams
+	_, err = New(&Config{
+		DB:          db,
+		ChainParams: &regTestParams,
+		TimeSource:  NewMedianTime(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create chain instance: %v", err)
+	}
+
+	// Loading the same database with the parameters for another network
+	// must fail.
+	simNetParams := chaincfg.SimNetParams
+	_, err = New(&Config{
+		DB:          db,
+		ChainParams: &simNetParams,
+		TimeSource:  NewMedianTime(),
+	})
+	if err == nil {
+		t.Fatal("New: expected error for database of a different network")
+	}
+	if !strings.Contains(err.Error(), "different network") {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+}
+
+// genesisStoreDB wraps a database so transactions report blocks as not stored
+// and fail to store them with the configured error.
+type genesisStoreDB struct {
+	database.DB
+	storeErr error
+}
+
+// Update runs the passed function with a transaction that fails to store
+// blocks.
+func (db *genesisStoreDB) Update(fn func(tx database.Tx) error) error {
+	return db.DB.Update(func(tx database.Tx) error {
+		return fn(&genesisStoreTx{Tx: tx, storeErr: db.storeErr})
+	})
+}
+
+// genesisStoreTx wraps a database transaction so blocks are reported as not
+// stored and fail to be stored with the configured error.
+type genesisStoreTx struct {
+	database.Tx
+	storeErr error
+}
+
+// HasBlock reports that no blocks are stored.
+func (tx *genesisStoreTx) HasBlock(*chainhash.Hash) (bool, error) {
+	return false, nil
+}
+
+// StoreBlock fails with the configured error.
+func (tx *genesisStoreTx) StoreBlock(*btcutil.Block) error {
+	return tx.storeErr
+}
+
+// TestGenesisStoreErrors ensures initializing a database whose genesis block is
+// reported as already stored succeeds, while other failures to store the
+// genesis block are reported.
+func TestGenesisStoreErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		storeErr error
+		wantErr  bool
+	}{{
+		name: "already stored",
+		storeErr: database.Error{
+			ErrorCode:   database.ErrBlockExists,
+			Description: "block already exists",
+		},
+	}, {
+		name: "write failure",
+		storeErr: database.Error{
+			ErrorCode:   database.ErrDriverSpecific,
+			Description: "no space left on device",
+		},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		dbPath := filepath.Join(t.TempDir(), "ffldb")
+		db, err := database.Create(testDbType, dbPath, blockDataNet)
+		if err != nil {
+			t.Fatalf("Failed to create db: %v", err)
+		}
+
+		params := chaincfg.RegressionNetParams
+		chain, err := New(&Config{
+			DB:          &genesisStoreDB{DB: db, storeErr: test.storeErr},
+			ChainParams: &params,
+			TimeSource:  NewMedianTime(),
+		})
+		db.Close()
+		if test.wantErr {
+			if !errors.Is(err, test.storeErr) {
+				t.Fatalf("%s: unexpected error: %v", test.name, err)
+			}
+			if !strings.Contains(err.Error(), "data directory") {
+				t.Fatalf("%s: error has no remediation hint: %v",
+					test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: failed to create chain instance: %v",
+				test.name, err)
+		}
+		if chain.BestSnapshot().Hash != *params.GenesisHash {
+			t.Fatalf("%s: best chain tip is %v, want genesis",
+				test.name, chain.BestSnapshot().Hash)
+		}
+	}
+}
+
+// TestNoGenesisInit ensures a database that has not been initialized is left
+// uninitialized when automatic genesis initialization is disabled and that it
+// can then be initialized explicitly.
+func TestNoGenesisInit(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "ffldb")
+	db, err := database.Create(testDbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Failed to create db: %v", err)
+	}
+	defer db.Close()
+
+	params := chaincfg.RegressionNetParams
+	config := &Config{
+		DB:            db,
+		ChainParams:   &params,
+		TimeSource:    NewMedianTime(),
+		NoGenesisInit: true,
+	}
+	_, err = New(config)
+	if !errors.Is(err, ErrChainNotInitialized) {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	err = db.View(func(dbTx database.Tx) error {
+		if dbTx.Metadata().Get(chainStateKeyName) != nil {
+			t.Fatal("chain state stored in uninitialized database")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to view db: %v", err)
+	}
+
+	// Initialize the database explicitly, which is a no-op once it is
+	// initialized.
+	for i := 0; i < 2; i++ {
+		if err := InitChain(db, &params); err != nil {
+			t.Fatalf("InitChain: unexpected error: %v", err)
+		}
+	}
+	chain, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create chain instance: %v", err)
+	}
+	if chain.BestSnapshot().Hash != *params.GenesisHash {
+		t.Fatalf("best chain tip is %v, want genesis",
+			chain.BestSnapshot().Hash)
+	}
+}
+
+// TestForEachBlock ensures the main chain blocks in a height range are visited
+// in order, ranges beyond the tip are limited to the existing blocks, and the
+// iteration stops at the first error returned by the callback.
+func TestForEachBlock(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("foreachblock",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	genesis := btcutil.NewBlock(chaincfg.RegressionNetParams.GenesisBlock)
+	blocks := []*btcutil.Block{genesis}
+	for i := int32(1); i <= 4; i++ {
+		block := newReorgTestBlock(t, blocks[i-1], i, 0)
+		if _, _, err := chain.ProcessBlock(block, BFNone); err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	errStop := errors.New("stop")
+	tests := []struct {
+		name        string
+		start, end  int32
+		stopHeight  int32
+		wantHeights []int32
+		wantErr     error
+	}{
+		{"whole chain", 0, 4, -1, []int32{0, 1, 2, 3, 4}, nil},
+		{"beyond tip", 2, 10, -1, []int32{2, 3, 4}, nil},
+		{"past tip", 5, 10, -1, nil, nil},
+		{"empty range", 3, 2, -1, nil, nil},
+		{"callback error", 1, 4, 2, []int32{1, 2}, errStop},
+	}
+	for _, test := range tests {
+		var heights []int32
+		err := chain.ForEachBlock(test.start, test.end,
+			func(block *btcutil.Block, height int32) error {
+				heights = append(heights, height)
+				if *block.Hash() != *blocks[height].Hash() ||
+					block.Height() != height {
+
+					t.Fatalf("%s: unexpected block %v at "+
+						"height %d", test.name,
+						block.Hash(), height)
+				}
+				if height == test.stopHeight {
+					return errStop
+				}
+				return nil
+			})
+		if !errors.Is(err, test.wantErr) {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(heights, test.wantHeights) {
+			t.Fatalf("%s: visited heights %v, want %v", test.name,
+				heights, test.wantHeights)
+		}
+	}
+}
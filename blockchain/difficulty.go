@@ -5,7 +5,9 @@
 package blockchain
 
 import (
+	"fmt"
 	"math/big"
+	"strconv"
 	"time"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -153,6 +155,28 @@ func CalcWork(bits uint32) *big.Int {
 	return new(big.Int).Div(oneLsh256, denominator)
 }
 
+// DifficultyRatio returns the proof-of-work difficulty of the passed compact
+// target bits as a multiple of the minimum difficulty, which is given by the
+// passed proof-of-work limit bits, rounded to eight decimal places.  The minimum
+// difficulty is taken from the compact form of the limit rather than the limit
+// itself since block headers encode their target with the compact form, which
+// loses precision.  Zero is returned for bits that do not encode a positive
+// target.
+func DifficultyRatio(bits, powLimitBits uint32) float64 {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return 0
+	}
+	max := CompactToBig(powLimitBits)
+	difficulty := new(big.Rat).SetFrac(max, target)
+	diff, err := strconv.ParseFloat(difficulty.FloatString(8), 64)
+	if err != nil {
+		log.Errorf("Cannot get difficulty: %v", err)
+		return 0
+	}
+	return diff
+}
+
 // calcEasiestDifficulty calculates the easiest possible difficulty that a block
 // can have given starting difficulty bits and a duration.  It is mainly used to
 // verify that claimed proof of work by a block is sane as compared to a
@@ -319,3 +343,22 @@ func (b *BlockChain) CalcNextRequiredDifficulty(timestamp time.Time) (uint32, er
 	b.chainLock.Unlock()
 	return difficulty, err
 }
+
+// CalcRequiredDifficulty calculates the required difficulty for a block with
+// the passed timestamp that builds on the known block with the passed hash,
+// which need not be part of the best chain, based on the difficulty retarget
+// rules.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CalcRequiredDifficulty(prevHash *chainhash.Hash,
+	timestamp time.Time) (uint32, error) {
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	prevNode := b.index.LookupNode(prevHash)
+	if prevNode == nil {
+		return 0, fmt.Errorf("block %s is not known", prevHash)
+	}
+	return b.calcNextRequiredDifficulty(prevNode, timestamp)
+}
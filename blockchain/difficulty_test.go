@@ -7,6 +7,8 @@ package blockchain
 import (
 	"math/big"
 	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
 )
 
 // TestBigToCompact ensures BigToCompact converts big integers to the expected
@@ -73,3 +75,28 @@ func TestCalcWork(t *testing.T) {
 		}
 	}
 }
+
+// TestDifficultyRatio ensures DifficultyRatio returns the difficulty relative
+// to the minimum difficulty of the network.
+func TestDifficultyRatio(t *testing.T) {
+	// The bits of main network block 100000 and of block 32256, the first
+	// retarget, with the difficulty rounded to eight decimals as reported
+	// by the getdifficulty RPC.
+	powLimitBits := chaincfg.MainNetParams.PowLimitBits
+	tests := []struct {
+		bits uint32
+		want float64
+	}{
+		{bits: powLimitBits, want: 1},
+		{bits: 0x1b04864c, want: 14484.16236123},
+		{bits: 0x1d00d86a, want: 1.18289953},
+		{bits: 0, want: 0},
+	}
+	for _, test := range tests {
+		got := DifficultyRatio(test.bits, powLimitBits)
+		if got != test.want {
+			t.Errorf("difficulty of bits %08x is %v, want %v",
+				test.bits, got, test.want)
+		}
+	}
+}
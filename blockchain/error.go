@@ -220,6 +220,10 @@ const (
 	// current chain tip. This is not a block validation rule, but is required
 	// for block proposals submitted via getblocktemplate RPC.
 	ErrPrevBlockNotBest
+
+	// ErrRuleToggle indicates that a block violates one of the rule
+	// toggles configured for testing fork activations.
+	ErrRuleToggle
 )
 
 // Map of ErrorCode values back to their constant names for pretty printing.
@@ -267,6 +271,7 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrPreviousBlockUnknown:      "ErrPreviousBlockUnknown",
 	ErrInvalidAncestorBlock:      "ErrInvalidAncestorBlock",
 	ErrPrevBlockNotBest:          "ErrPrevBlockNotBest",
+	ErrRuleToggle:                "ErrRuleToggle",
 }
 
 // String returns the ErrorCode as a human-readable name.
@@ -296,3 +301,20 @@ func (e RuleError) Error() string {
 func ruleError(c ErrorCode, desc string) RuleError {
 	return RuleError{ErrorCode: c, Description: desc}
 }
+
+// HeaderError identifies the first invalid header of a sequence of headers
+// passed to VerifyHeaders along with the reason it is invalid.
+type HeaderError struct {
+	Index int   // Index of the invalid header in the sequence
+	Err   error // Reason the header is invalid
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e HeaderError) Error() string {
+	return fmt.Sprintf("header %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the reason the header is invalid.
+func (e HeaderError) Unwrap() error {
+	return e.Err
+}
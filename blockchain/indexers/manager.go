@@ -15,6 +15,14 @@ import (
 	"github.com/btcsuite/btcd/wire"
 )
 
+const (
+	// catchUpPrefetchDepth is the maximum number of blocks that are read
+	// from the database ahead of the block currently being indexed while
+	// catching up indexes.  Higher values use more memory in exchange for
+	// hiding more of the database latency.
+	catchUpPrefetchDepth = 16
+)
+
 var (
 	// indexTipsBucketName is the name of the db bucket used to house the
 	// current tip of each index.
@@ -402,10 +410,14 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 	// each block that needs to be indexed.
 	log.Infof("Catching up indexes from height %d to %d", lowestHeight,
 		bestHeight)
+	prefetcher := chain.NewBlockPrefetcher(lowestHeight+1, bestHeight,
+		catchUpPrefetchDepth)
+	defer prefetcher.Stop()
 	for height := lowestHeight + 1; height <= bestHeight; height++ {
 		// Load the block for the height since it is required to index
-		// it.
-		block, err := chain.BlockByHeight(height)
+		// it.  The blocks are read ahead of time by the prefetcher to
+		// avoid waiting on the database for each one.
+		block, err := prefetcher.Next()
 		if err != nil {
 			return err
 		}
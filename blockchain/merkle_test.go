@@ -8,6 +8,8 @@ import (
 	"testing"
 
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
 )
 
 // TestMerkle tests the BuildMerkleTreeStore API.
@@ -21,3 +23,73 @@ func TestMerkle(t *testing.T) {
 			"got %v, want %v", calculatedMerkleRoot, wantMerkle)
 	}
 }
+
+// TestValidateWitnessCommitment ensures a block whose coinbase commits to the
+// witness merkle root of its transactions passes validation while blocks with
+// a mismatched or missing commitment are rejected.
+func TestValidateWitnessCommitment(t *testing.T) {
+	// newBlock returns a block with a coinbase that commits to the witness
+	// data of the block as it was when the block was created and a
+	// transaction with witness data.
+	newBlock := func() *wire.MsgBlock {
+		coinbase := wire.NewMsgTx(wire.TxVersion)
+		coinbase.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+				wire.MaxPrevOutIndex),
+			SignatureScript: []byte{0x01, 0x01},
+			Witness: wire.TxWitness{
+				make([]byte, CoinbaseWitnessDataLen),
+			},
+		})
+		coinbase.AddTxOut(wire.NewTxOut(0, []byte{0x51}))
+
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{0x01}},
+			Witness:          wire.TxWitness{{0x01, 0x02}},
+		})
+		tx.AddTxOut(wire.NewTxOut(0, []byte{0x51}))
+
+		msgBlock := wire.NewMsgBlock(&wire.BlockHeader{})
+		msgBlock.AddTransaction(coinbase)
+		msgBlock.AddTransaction(tx)
+
+		block := btcutil.NewBlock(msgBlock)
+		merkles := BuildMerkleTreeStore(block.Transactions(), true)
+		var preimage [chainhash.HashSize * 2]byte
+		copy(preimage[:], merkles[len(merkles)-1][:])
+		commitment := chainhash.DoubleHashB(preimage[:])
+		pkScript := append(append([]byte(nil), WitnessMagicBytes...),
+			commitment...)
+		coinbase.AddTxOut(wire.NewTxOut(0, pkScript))
+		return msgBlock
+	}
+
+	// isRuleErr returns whether the passed error is a rule error with the
+	// passed code.
+	isRuleErr := func(err error, code ErrorCode) bool {
+		ruleErr, ok := err.(RuleError)
+		return ok && ruleErr.ErrorCode == code
+	}
+
+	if err := ValidateWitnessCommitment(btcutil.NewBlock(newBlock())); err != nil {
+		t.Fatalf("ValidateWitnessCommitment: unexpected error: %v", err)
+	}
+
+	mismatched := newBlock()
+	mismatched.Transactions[1].TxIn[0].Witness[0][0] = 0x02
+	err := ValidateWitnessCommitment(btcutil.NewBlock(mismatched))
+	if !isRuleErr(err, ErrWitnessCommitmentMismatch) {
+		t.Fatalf("ValidateWitnessCommitment: got %v, want %v", err,
+			ErrWitnessCommitmentMismatch)
+	}
+
+	missing := newBlock()
+	coinbase := missing.Transactions[0]
+	coinbase.TxOut = coinbase.TxOut[:1]
+	err = ValidateWitnessCommitment(btcutil.NewBlock(missing))
+	if !isRuleErr(err, ErrUnexpectedWitness) {
+		t.Fatalf("ValidateWitnessCommitment: got %v, want %v", err,
+			ErrUnexpectedWitness)
+	}
+}
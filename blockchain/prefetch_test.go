@@ -0,0 +1,59 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// TestBlockPrefetcher ensures the block prefetcher returns the main chain
+// blocks in the requested range in order both with and without prefetching.
+func TestBlockPrefetcher(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v", err)
+	}
+
+	chain, teardownFunc, err := chainSetup("prefetcher",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.TstSetCoinbaseMaturity(1)
+	for i := 1; i < len(blocks); i++ {
+		if _, _, err := chain.ProcessBlock(blocks[i], BFNone); err != nil {
+			t.Fatalf("ProcessBlock fail on block %v: %v", i, err)
+		}
+	}
+
+	for _, depth := range []int{0, 1, 3, 10} {
+		prefetcher := chain.NewBlockPrefetcher(1, 4, depth)
+		for height := int32(1); height <= 4; height++ {
+			block, err := prefetcher.Next()
+			if err != nil {
+				t.Fatalf("depth %d: unexpected error: %v", depth, err)
+			}
+			if !block.Hash().IsEqual(blocks[height].Hash()) {
+				t.Fatalf("depth %d: got block %v at height %d, "+
+					"want %v", depth, block.Hash(), height,
+					blocks[height].Hash())
+			}
+		}
+		block, err := prefetcher.Next()
+		if block != nil || err != nil {
+			t.Fatalf("depth %d: expected end of range, got block %v, "+
+				"err %v", depth, block, err)
+		}
+		prefetcher.Stop()
+	}
+
+	// Ensure stopping a prefetcher before consuming all blocks does not
+	// block.
+	prefetcher := chain.NewBlockPrefetcher(0, 4, 1)
+	prefetcher.Stop()
+}
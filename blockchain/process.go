@@ -29,6 +29,13 @@ const (
 	// not be performed.
 	BFNoPoWCheck
 
+	// BFNoScriptCheck may be set to indicate the scripts of the
+	// transactions in the block will not be executed since the block is
+	// already known to be valid, such as when it is an ancestor of a block
+	// the user assumes is valid.  It only applies to the block it is passed
+	// with and not to any orphans the block causes to be accepted.
+	BFNoScriptCheck
+
 	// BFNone is a convenience value to specifically indicate no flags.
 	BFNone BehaviorFlags = 0
 )
@@ -45,7 +52,7 @@ func (b *BlockChain) blockExists(hash *chainhash.Hash) (bool, error) {
 
 	// Check in the database.
 	var exists bool
-	err := b.db.View(func(dbTx database.Tx) error {
+	err := b.DB().View(func(dbTx database.Tx) error {
 		var err error
 		exists, err = dbTx.HasBlock(hash)
 		if err != nil || !exists {
@@ -111,11 +118,14 @@ func (b *BlockChain) processOrphans(hash *chainhash.Hash, flags BehaviorFlags) e
 
 			// Remove the orphan from the orphan pool.
 			orphanHash := orphan.block.Hash()
-			b.removeOrphanBlock(orphan)
+			b.removeOrphanBlock(orphan, true)
 			i--
 
 			// Potentially accept the block into the block chain.
-			_, err := b.maybeAcceptBlock(orphan.block, flags)
+			// The scripts of orphans are always checked since only
+			// the block passed to ProcessBlock is known to be valid.
+			_, err := b.maybeAcceptBlock(orphan.block,
+				flags&^BFNoScriptCheck)
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,55 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// RuleToggle is an additional consensus rule that is enforced for the blocks
+// at or after its activation height.  Rule toggles allow tests to exercise the
+// behavior of soft and hard fork activations deterministically without
+// defining a deployment, so they are only permitted on the regression and
+// simulation test networks.
+type RuleToggle struct {
+	// Name identifies the rule in the errors for blocks that violate it.
+	Name string
+
+	// ActivationHeight is the height of the first block the rule is
+	// enforced for.
+	ActivationHeight int32
+
+	// Check returns an error when the passed block violates the rule.
+	Check func(block *btcutil.Block) error
+}
+
+// allowsRuleToggles returns whether rule toggles may be used with the passed
+// network parameters.
+func allowsRuleToggles(params *chaincfg.Params) bool {
+	return params.Net == wire.TestNet || params.Net == wire.SimNet
+}
+
+// checkRuleToggles ensures the passed block, whose parent is the passed node,
+// does not violate any of the rule toggles active at its height.
+func (b *BlockChain) checkRuleToggles(block *btcutil.Block, prevNode *blockNode) error {
+	blockHeight := prevNode.height + 1
+	for i := range b.ruleToggles {
+		toggle := &b.ruleToggles[i]
+		if blockHeight < toggle.ActivationHeight {
+			continue
+		}
+		if err := toggle.Check(block); err != nil {
+			str := fmt.Sprintf("block violates rule %q active since "+
+				"height %d: %v", toggle.Name,
+				toggle.ActivationHeight, err)
+			return ruleError(ErrRuleToggle, str)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// TestRuleToggles ensures rule toggles are only enforced for the blocks at or
+// after their activation heights and are only permitted on test networks.
+func TestRuleToggles(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("ruletoggles",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Reject blocks whose coinbase signals fork 1 from height 2.
+	errForkOne := errors.New("coinbase signals fork 1")
+	chain.ruleToggles = []RuleToggle{{
+		Name:             "nofork1",
+		ActivationHeight: 2,
+		Check: func(block *btcutil.Block) error {
+			coinbase := block.MsgBlock().Transactions[0]
+			sigScript := coinbase.TxIn[0].SignatureScript
+			if bytes.HasSuffix(sigScript, []byte{txscript.OP_1}) {
+				return errForkOne
+			}
+			return nil
+		},
+	}}
+
+	genesis := btcutil.NewBlock(chaincfg.RegressionNetParams.GenesisBlock)
+	block1 := newReorgTestBlock(t, genesis, 1, 1)
+	if _, _, err := chain.ProcessBlock(block1, BFNone); err != nil {
+		t.Fatalf("ProcessBlock before activation: unexpected error: %v",
+			err)
+	}
+
+	block2 := newReorgTestBlock(t, block1, 2, 1)
+	_, _, err = chain.ProcessBlock(block2, BFNone)
+	var rerr RuleError
+	if !errors.As(err, &rerr) || rerr.ErrorCode != ErrRuleToggle {
+		t.Fatalf("ProcessBlock after activation: unexpected error: %v",
+			err)
+	}
+
+	block2 = newReorgTestBlock(t, block1, 2, 0)
+	if _, _, err := chain.ProcessBlock(block2, BFNone); err != nil {
+		t.Fatalf("ProcessBlock after activation: unexpected error: %v",
+			err)
+	}
+	if chain.BestSnapshot().Hash != *block2.Hash() {
+		t.Fatal("block satisfying the rule not connected")
+	}
+
+	// Rule toggles are not permitted on the main network.
+	dbPath := filepath.Join(t.TempDir(), "ffldb")
+	db, err := database.Create(testDbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Failed to create db: %v", err)
+	}
+	defer db.Close()
+	_, err = New(&Config{
+		DB:          db,
+		ChainParams: &chaincfg.MainNetParams,
+		TimeSource:  NewMedianTime(),
+		RuleToggles: chain.ruleToggles,
+	})
+	var aerr AssertError
+	if !errors.As(err, &aerr) {
+		t.Fatalf("New on mainnet: unexpected error: %v", err)
+	}
+}
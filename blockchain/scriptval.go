@@ -34,6 +34,18 @@ type txValidator struct {
 	flags        txscript.ScriptFlags
 	sigCache     *txscript.SigCache
 	hashCache    *txscript.HashCache
+	workers      int
+}
+
+// defaultScriptWorkers returns the default number of goroutines used to
+// validate scripts, which is based on the number of processor cores.  This
+// helps ensure the system stays reasonably responsive under heavy load.
+func defaultScriptWorkers() int {
+	workers := runtime.NumCPU() * 3
+	if workers <= 0 {
+		workers = 1
+	}
+	return workers
 }
 
 // sendResult sends the result of a script pair validation on the internal
@@ -122,13 +134,9 @@ func (v *txValidator) Validate(items []*txValidateItem) error {
 		return nil
 	}
 
-	// Limit the number of goroutines to do script validation based on the
-	// number of processor cores.  This helps ensure the system stays
-	// reasonably responsive under heavy load.
-	maxGoRoutines := runtime.NumCPU() * 3
-	if maxGoRoutines <= 0 {
-		maxGoRoutines = 1
-	}
+	// Limit the number of goroutines to do script validation to the
+	// number of workers.
+	maxGoRoutines := v.workers
 	if maxGoRoutines > len(items) {
 		maxGoRoutines = len(items)
 	}
@@ -174,9 +182,16 @@ func (v *txValidator) Validate(items []*txValidateItem) error {
 }
 
 // newTxValidator returns a new instance of txValidator to be used for
-// validating transaction scripts asynchronously.
+// validating transaction scripts asynchronously using up to the passed number
+// of goroutines.  The default number of goroutines is used when the passed
+// number is not positive.
 func newTxValidator(utxoView *UtxoViewpoint, flags txscript.ScriptFlags,
-	sigCache *txscript.SigCache, hashCache *txscript.HashCache) *txValidator {
+	sigCache *txscript.SigCache, hashCache *txscript.HashCache,
+	workers int) *txValidator {
+
+	if workers <= 0 {
+		workers = defaultScriptWorkers()
+	}
 	return &txValidator{
 		validateChan: make(chan *txValidateItem),
 		quitChan:     make(chan struct{}),
@@ -185,6 +200,7 @@ func newTxValidator(utxoView *UtxoViewpoint, flags txscript.ScriptFlags,
 		sigCache:     sigCache,
 		hashCache:    hashCache,
 		flags:        flags,
+		workers:      workers,
 	}
 }
 
@@ -236,15 +252,16 @@ func ValidateTransactionScripts(tx *btcutil.Tx, utxoView *UtxoViewpoint,
 	}
 
 	// Validate all of the inputs.
-	validator := newTxValidator(utxoView, flags, sigCache, hashCache)
+	validator := newTxValidator(utxoView, flags, sigCache, hashCache, 0)
 	return validator.Validate(txValItems)
 }
 
 // checkBlockScripts executes and validates the scripts for all transactions in
-// the passed block using multiple goroutines.
+// the passed block using up to the passed number of goroutines, or the default
+// number when it is not positive.
 func checkBlockScripts(block *btcutil.Block, utxoView *UtxoViewpoint,
 	scriptFlags txscript.ScriptFlags, sigCache *txscript.SigCache,
-	hashCache *txscript.HashCache) error {
+	hashCache *txscript.HashCache, workers int) error {
 
 	// First determine if segwit is active according to the scriptFlags. If
 	// it isn't then we don't need to interact with the HashCache.
@@ -299,7 +316,8 @@ func checkBlockScripts(block *btcutil.Block, utxoView *UtxoViewpoint,
 	}
 
 	// Validate all of the inputs.
-	validator := newTxValidator(utxoView, scriptFlags, sigCache, hashCache)
+	validator := newTxValidator(utxoView, scriptFlags, sigCache, hashCache,
+		workers)
 	start := time.Now()
 	if err := validator.Validate(txValItems); err != nil {
 		return err
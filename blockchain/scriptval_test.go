@@ -38,9 +38,39 @@ func TestCheckBlockScripts(t *testing.T) {
 	}
 
 	scriptFlags := txscript.ScriptBip16
-	err = checkBlockScripts(blocks[0], view, scriptFlags, nil, nil)
+	err = checkBlockScripts(blocks[0], view, scriptFlags, nil, nil, 0)
 	if err != nil {
 		t.Errorf("Transaction script validation failed: %v\n", err)
 		return
 	}
 }
+
+// BenchmarkCheckBlockScripts benchmarks validating all of the scripts in a
+// known-good block with many inputs using a single worker and the default
+// number of workers.
+func BenchmarkCheckBlockScripts(b *testing.B) {
+	testBlockNum := 277647
+	blockDataFile := fmt.Sprintf("%d.dat.bz2", testBlockNum)
+	blocks, err := loadBlocks(blockDataFile)
+	if err != nil {
+		b.Fatalf("Error loading file: %v", err)
+	}
+	storeDataFile := fmt.Sprintf("%d.utxostore.bz2", testBlockNum)
+	view, err := loadUtxoView(storeDataFile)
+	if err != nil {
+		b.Fatalf("Error loading txstore: %v", err)
+	}
+
+	for _, workers := range []int{1, defaultScriptWorkers()} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				err := checkBlockScripts(blocks[0], view,
+					txscript.ScriptBip16, nil, nil, workers)
+				if err != nil {
+					b.Fatalf("Transaction script validation "+
+						"failed: %v", err)
+				}
+			}
+		})
+	}
+}
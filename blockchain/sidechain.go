@@ -0,0 +1,108 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// DefaultMaxSideChainBlocks is the default number of recently accepted side
+// chain blocks that are retained.
+const DefaultMaxSideChainBlocks = 100
+
+// SideChainStats houses statistics about the side chain blocks retained by the
+// chain.
+type SideChainStats struct {
+	// Retained is the number of side chain blocks currently retained.
+	Retained int
+
+	// MaxRetained is the maximum number of side chain blocks retained.
+	MaxRetained int
+
+	// Accepted is the total number of side chain blocks accepted.
+	Accepted uint64
+
+	// Evicted is the total number of side chain blocks that were no longer
+	// retained to make room for newer ones.
+	Evicted uint64
+}
+
+// addSideChainBlock retains the header of the passed block which was accepted
+// to a side chain, evicting the oldest retained side chain block when the
+// maximum number of side chain blocks is exceeded.  The block itself is not
+// kept in memory since it is stored in the database.
+func (b *BlockChain) addSideChainBlock(block *btcutil.Block) {
+	b.sideChainLock.Lock()
+	defer b.sideChainLock.Unlock()
+
+	b.sideChainAccepted++
+	if b.maxSideChainBlocks <= 0 {
+		return
+	}
+	hash := *block.Hash()
+	if _, exists := b.sideChainHeaders[hash]; exists {
+		return
+	}
+	for len(b.sideChainOrder) >= b.maxSideChainBlocks {
+		oldest := b.sideChainOrder[0]
+		b.sideChainOrder = b.sideChainOrder[1:]
+		delete(b.sideChainHeaders, oldest)
+		b.sideChainEvicted++
+		log.Debugf("Evicted side chain block %v", oldest)
+	}
+	b.sideChainHeaders[hash] = block.MsgBlock().Header
+	b.sideChainOrder = append(b.sideChainOrder, hash)
+}
+
+// removeSideChainBlock stops retaining the side chain block with the passed
+// hash.  It is a no-op when the block is not retained.
+func (b *BlockChain) removeSideChainBlock(hash *chainhash.Hash) {
+	b.sideChainLock.Lock()
+	defer b.sideChainLock.Unlock()
+
+	if _, exists := b.sideChainHeaders[*hash]; !exists {
+		return
+	}
+	delete(b.sideChainHeaders, *hash)
+	for i := range b.sideChainOrder {
+		if b.sideChainOrder[i] == *hash {
+			b.sideChainOrder = append(b.sideChainOrder[:i],
+				b.sideChainOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+// SideChainHeader returns the header of the retained side chain block with the
+// passed hash and whether it is retained.  Only a limited number of the most
+// recently accepted side chain blocks are retained, and blocks are no longer
+// retained once they become part of the main chain.  The block itself may be
+// loaded from the database with BlockByHash.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SideChainHeader(hash *chainhash.Hash) (wire.BlockHeader, bool) {
+	b.sideChainLock.RLock()
+	header, exists := b.sideChainHeaders[*hash]
+	b.sideChainLock.RUnlock()
+	return header, exists
+}
+
+// SideChainStats returns statistics about the side chain blocks retained by
+// the chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SideChainStats() SideChainStats {
+	b.sideChainLock.RLock()
+	defer b.sideChainLock.RUnlock()
+
+	return SideChainStats{
+		Retained:    len(b.sideChainHeaders),
+		MaxRetained: b.maxSideChainBlocks,
+		Accepted:    b.sideChainAccepted,
+		Evicted:     b.sideChainEvicted,
+	}
+}
@@ -582,7 +582,7 @@ func upgradeUtxoSetToV2(db database.DB, interrupt <-chan struct{}) error {
 func (b *BlockChain) maybeUpgradeDbBuckets(interrupt <-chan struct{}) error {
 	// Load or create bucket versions as needed.
 	var utxoSetVersion uint32
-	err := b.db.Update(func(dbTx database.Tx) error {
+	err := b.DB().Update(func(dbTx database.Tx) error {
 		// Load the utxo set version from the database or create it and
 		// initialize it to version 1 if it doesn't exist.
 		var err error
@@ -596,7 +596,7 @@ func (b *BlockChain) maybeUpgradeDbBuckets(interrupt <-chan struct{}) error {
 
 	// Update the utxo set to v2 if needed.
 	if utxoSetVersion < 2 {
-		if err := upgradeUtxoSetToV2(b.db, interrupt); err != nil {
+		if err := upgradeUtxoSetToV2(b.DB(), interrupt); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,188 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// utxoAuditPrefetchDepth is the number of blocks loaded ahead while replaying
+// the main chain to rebuild the utxo set.
+const utxoAuditPrefetchDepth = 16
+
+// UtxoDiscrepancy describes a difference between the utxo set rebuilt by
+// replaying the main chain and the utxo set stored in the database.
+type UtxoDiscrepancy struct {
+	// OutPoint is the output the discrepancy is for.
+	OutPoint wire.OutPoint
+
+	// Expected is the entry produced by replaying the main chain.  It is
+	// nil when the output should not be in the utxo set.
+	Expected *UtxoEntry
+
+	// Stored is the entry in the database.  It is nil when the output is
+	// missing from the stored utxo set.
+	Stored *UtxoEntry
+}
+
+// utxoEntriesEqual returns whether the passed utxo entries describe the same
+// unspent output.
+func utxoEntriesEqual(a, b *UtxoEntry) bool {
+	return a.Amount() == b.Amount() &&
+		a.BlockHeight() == b.BlockHeight() &&
+		a.IsCoinBase() == b.IsCoinBase() &&
+		bytes.Equal(a.PkScript(), b.PkScript())
+}
+
+// RebuildUtxoSet reconstructs the unspent transaction output set from scratch
+// by replaying every block in the main chain starting from the genesis block
+// and compares the result against the utxo set stored in the database.  Any
+// differences are returned as discrepancies.  The stored utxo set is not
+// modified.
+//
+// The chain lock is not held while replaying, so blocks continue to be
+// processed meanwhile.  Blocks connected during the replay are replayed as
+// well until the best chain tip is reached, at which point the rebuilt set is
+// compared against a snapshot of the stored set at that tip.  An error is
+// returned when the main chain is reorganized away from the replayed blocks.
+//
+// This is intended for integrity audits.  The entire rebuilt utxo set is held
+// in memory, so this can be very resource intensive on large chains.  The
+// interrupt channel may be closed to stop it early, in which case an error is
+// returned.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) RebuildUtxoSet(interrupt <-chan struct{}) ([]UtxoDiscrepancy, error) {
+	// Replay the main chain up to its tip.  The outputs of the genesis
+	// block are not spendable, so it is never added to the utxo set.
+	log.Infof("Rebuilding utxo set from %d blocks", b.bestChain.Height())
+	view := NewUtxoViewpoint()
+	progressLogger := newBlockProgressLogger("Replayed", log)
+	replayed := b.bestChain.Genesis()
+	var dbTx database.Tx
+	for {
+		// Take a snapshot of the stored utxo set once the replay has
+		// caught up with the tip, which the chain lock ensures matches
+		// the stored set.
+		b.chainLock.RLock()
+		tip := b.bestChain.Tip()
+		if tip == replayed {
+			var err error
+			dbTx, err = b.DB().Begin(false)
+			b.chainLock.RUnlock()
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		b.chainLock.RUnlock()
+
+		err := b.replayUtxos(view, replayed, tip, progressLogger,
+			interrupt)
+		if err != nil {
+			return nil, err
+		}
+		replayed = tip
+	}
+	defer dbTx.Rollback()
+
+	// Compare the rebuilt utxo set against the stored one.  Matching
+	// entries are removed from the view so the entries left afterwards
+	// are those missing from the database.
+	var discrepancies []UtxoDiscrepancy
+	utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+	err := utxoBucket.ForEach(func(k, v []byte) error {
+		if interruptRequested(interrupt) {
+			return errInterruptRequested
+		}
+		if len(k) <= chainhash.HashSize {
+			return errDeserialize("unexpected utxo key length")
+		}
+		var outpoint wire.OutPoint
+		copy(outpoint.Hash[:], k[:chainhash.HashSize])
+		index, _ := deserializeVLQ(k[chainhash.HashSize:])
+		outpoint.Index = uint32(index)
+
+		stored, err := deserializeUtxoEntry(v)
+		if err != nil {
+			return err
+		}
+
+		expected := view.entries[outpoint]
+		delete(view.entries, outpoint)
+		if expected == nil || !utxoEntriesEqual(expected, stored) {
+			discrepancies = append(discrepancies, UtxoDiscrepancy{
+				OutPoint: outpoint,
+				Expected: expected,
+				Stored:   stored,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for outpoint, expected := range view.entries {
+		discrepancies = append(discrepancies, UtxoDiscrepancy{
+			OutPoint: outpoint,
+			Expected: expected,
+		})
+	}
+
+	log.Infof("Finished rebuilding utxo set at height %d with %d "+
+		"discrepancies", replayed.height, len(discrepancies))
+	return discrepancies, nil
+}
+
+// replayUtxos applies the blocks of the main chain after the passed from node
+// through the passed to node to the passed view, which holds the utxo set as
+// of the from node.  An error is returned when the loaded blocks do not link
+// from one node to the other, which happens when the main chain is
+// reorganized meanwhile.
+func (b *BlockChain) replayUtxos(view *UtxoViewpoint, from, to *blockNode,
+	progressLogger *blockProgressLogger, interrupt <-chan struct{}) error {
+
+	prefetcher := b.NewBlockPrefetcher(from.height+1, to.height,
+		utxoAuditPrefetchDepth)
+	defer prefetcher.Stop()
+	prevHash := from.hash
+	for {
+		if interruptRequested(interrupt) {
+			return errInterruptRequested
+		}
+		block, err := prefetcher.Next()
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			break
+		}
+		if block.MsgBlock().Header.PrevBlock != prevHash {
+			return fmt.Errorf("main chain reorganized at height %d "+
+				"while rebuilding utxo set", block.Height())
+		}
+		prevHash = *block.Hash()
+
+		for _, tx := range block.Transactions() {
+			if !IsCoinBase(tx) {
+				for _, txIn := range tx.MsgTx().TxIn {
+					delete(view.entries, txIn.PreviousOutPoint)
+				}
+			}
+			view.AddTxOuts(tx, block.Height())
+		}
+		progressLogger.LogBlockHeight(block)
+	}
+	if prevHash != to.hash {
+		return fmt.Errorf("main chain reorganized at height %d while "+
+			"rebuilding utxo set", to.height)
+	}
+	return nil
+}
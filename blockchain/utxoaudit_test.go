@@ -0,0 +1,97 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestRebuildUtxoSet ensures rebuilding the utxo set from the main chain
+// matches the stored utxo set, reports entries that have been corrupted and
+// stops when interrupted.
+func TestRebuildUtxoSet(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v", err)
+	}
+
+	chain, teardownFunc, err := chainSetup("rebuildutxoset",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Since we're not dealing with the real block chain, set the coinbase
+	// maturity to 1.
+	chain.TstSetCoinbaseMaturity(1)
+
+	for i := 1; i < len(blocks); i++ {
+		_, _, err := chain.ProcessBlock(blocks[i], BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock fail on block %v: %v", i, err)
+		}
+	}
+
+	discrepancies, err := chain.RebuildUtxoSet(nil)
+	if err != nil {
+		t.Fatalf("RebuildUtxoSet: unexpected error: %v", err)
+	}
+	if len(discrepancies) != 0 {
+		t.Fatalf("RebuildUtxoSet: got %d discrepancies for an intact "+
+			"utxo set, want 0", len(discrepancies))
+	}
+
+	// Corrupt the amount of the utxo for the coinbase of the tip block.
+	tip := blocks[len(blocks)-1]
+	outpoint := wire.OutPoint{Hash: *tip.Transactions()[0].Hash()}
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		entry, err := dbFetchUtxoEntry(dbTx, outpoint)
+		if err != nil {
+			return err
+		}
+		corrupt := entry.Clone()
+		corrupt.amount++
+		serialized, err := serializeUtxoEntry(corrupt)
+		if err != nil {
+			return err
+		}
+		utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+		return utxoBucket.Put(*outpointKey(outpoint), serialized)
+	})
+	if err != nil {
+		t.Fatalf("Unable to corrupt utxo entry: %v", err)
+	}
+
+	discrepancies, err = chain.RebuildUtxoSet(nil)
+	if err != nil {
+		t.Fatalf("RebuildUtxoSet: unexpected error: %v", err)
+	}
+	if len(discrepancies) != 1 {
+		t.Fatalf("RebuildUtxoSet: got %d discrepancies, want 1",
+			len(discrepancies))
+	}
+	got := discrepancies[0]
+	if got.OutPoint != outpoint {
+		t.Fatalf("RebuildUtxoSet: discrepancy for %v, want %v",
+			got.OutPoint, outpoint)
+	}
+	if got.Expected == nil || got.Stored == nil ||
+		got.Stored.Amount() != got.Expected.Amount()+1 {
+
+		t.Fatalf("RebuildUtxoSet: unexpected discrepancy %+v", got)
+	}
+
+	// Rebuilding stops early once interrupted.
+	interrupt := make(chan struct{})
+	close(interrupt)
+	if _, err := chain.RebuildUtxoSet(interrupt); err == nil {
+		t.Fatal("RebuildUtxoSet: expected error when interrupted")
+	}
+}
@@ -311,19 +311,29 @@ func (view *UtxoViewpoint) connectTransactions(block *btcutil.Block, stxos *[]Sp
 	return nil
 }
 
-// fetchEntryByHash attempts to find any available utxo for the given hash by
-// searching the entire set of possible outputs for the given hash.  It checks
-// the view first and then falls back to the database if needed.
-func (view *UtxoViewpoint) fetchEntryByHash(db database.DB, hash *chainhash.Hash) (*UtxoEntry, error) {
-	// First attempt to find a utxo with the provided hash in the view.
+// lookupEntryByHash returns any utxo in the view for the given hash by
+// searching the entire set of possible outputs for the given hash.  It returns
+// nil when there is none.
+func (view *UtxoViewpoint) lookupEntryByHash(hash *chainhash.Hash) *UtxoEntry {
 	prevOut := wire.OutPoint{Hash: *hash}
 	for idx := uint32(0); idx < MaxOutputsPerBlock; idx++ {
 		prevOut.Index = idx
 		entry := view.LookupEntry(prevOut)
 		if entry != nil {
-			return entry, nil
+			return entry
 		}
 	}
+	return nil
+}
+
+// fetchEntryByHash attempts to find any available utxo for the given hash by
+// searching the entire set of possible outputs for the given hash.  It checks
+// the view first and then falls back to the database if needed.
+func (view *UtxoViewpoint) fetchEntryByHash(db database.DB, hash *chainhash.Hash) (*UtxoEntry, error) {
+	// First attempt to find a utxo with the provided hash in the view.
+	if entry := view.lookupEntryByHash(hash); entry != nil {
+		return entry, nil
+	}
 
 	// Check the database since it doesn't exist in the view.  This will
 	// often by the case since only specifically referenced utxos are loaded
@@ -337,11 +347,43 @@ func (view *UtxoViewpoint) fetchEntryByHash(db database.DB, hash *chainhash.Hash
 	return entry, err
 }
 
+// fetchEntryByHashTx is identical to fetchEntryByHash except it falls back to
+// the passed database transaction instead of opening a new one.
+func (view *UtxoViewpoint) fetchEntryByHashTx(dbTx database.Tx, hash *chainhash.Hash) (*UtxoEntry, error) {
+	if entry := view.lookupEntryByHash(hash); entry != nil {
+		return entry, nil
+	}
+	return dbFetchUtxoEntryByHash(dbTx, hash)
+}
+
 // disconnectTransactions updates the view by removing all of the transactions
 // created by the passed block, restoring all utxos the transactions spent by
 // using the provided spent txo information, and setting the best hash for the
 // view to the block before the passed block.
 func (view *UtxoViewpoint) disconnectTransactions(db database.DB, block *btcutil.Block, stxos []SpentTxOut) error {
+	return view.disconnectTransactionsWith(block, stxos,
+		func(hash *chainhash.Hash) (*UtxoEntry, error) {
+			return view.fetchEntryByHash(db, hash)
+		})
+}
+
+// disconnectTransactionsTx is identical to disconnectTransactions except any
+// legacy spent txo details are loaded through the passed database transaction
+// instead of a new one.  It must be used when a transaction is already open.
+func (view *UtxoViewpoint) disconnectTransactionsTx(dbTx database.Tx, block *btcutil.Block, stxos []SpentTxOut) error {
+	return view.disconnectTransactionsWith(block, stxos,
+		func(hash *chainhash.Hash) (*UtxoEntry, error) {
+			return view.fetchEntryByHashTx(dbTx, hash)
+		})
+}
+
+// disconnectTransactionsWith implements disconnectTransactions using the
+// passed function to find any available utxo for a hash when resurrecting
+// legacy spent txos.
+func (view *UtxoViewpoint) disconnectTransactionsWith(block *btcutil.Block,
+	stxos []SpentTxOut,
+	fetchEntryByHash func(*chainhash.Hash) (*UtxoEntry, error)) error {
+
 	// Sanity check the correct number of stxos are provided.
 	if len(stxos) != countSpentOutputs(block) {
 		return AssertError("disconnectTransactions called with bad " +
@@ -439,7 +481,7 @@ func (view *UtxoViewpoint) disconnectTransactions(db database.DB, block *btcutil
 			// only ever run with the new v2 format, this code path
 			// will never run.
 			if stxo.Height == 0 {
-				utxo, err := view.fetchEntryByHash(db, txHash)
+				utxo, err := fetchEntryByHash(txHash)
 				if err != nil {
 					return err
 				}
@@ -517,17 +559,23 @@ func (view *UtxoViewpoint) fetchUtxosMain(db database.DB, outpoints []wire.OutPo
 	// so other code can use the presence of an entry in the store as a way
 	// to unnecessarily avoid attempting to reload it from the database.
 	return db.View(func(dbTx database.Tx) error {
-		for i := range outpoints {
-			entry, err := dbFetchUtxoEntry(dbTx, outpoints[i])
-			if err != nil {
-				return err
-			}
+		return view.fetchUtxosMainTx(dbTx, outpoints)
+	})
+}
 
-			view.entries[outpoints[i]] = entry
+// fetchUtxosMainTx is identical to fetchUtxosMain except it loads the outputs
+// through the passed database transaction instead of opening a new one.
+func (view *UtxoViewpoint) fetchUtxosMainTx(dbTx database.Tx, outpoints []wire.OutPoint) error {
+	for i := range outpoints {
+		entry, err := dbFetchUtxoEntry(dbTx, outpoints[i])
+		if err != nil {
+			return err
 		}
 
-		return nil
-	})
+		view.entries[outpoints[i]] = entry
+	}
+
+	return nil
 }
 
 // fetchUtxos loads the unspent transaction outputs for the provided set of
@@ -560,6 +608,22 @@ func (view *UtxoViewpoint) fetchUtxos(db database.DB, outpoints []wire.OutPoint)
 // the block are added to the view and entries that are already in the view are
 // not modified.
 func (view *UtxoViewpoint) fetchInputUtxos(db database.DB, block *btcutil.Block) error {
+	// Request the input utxos from the database.
+	return view.fetchUtxosMain(db, view.neededInputUtxos(block))
+}
+
+// fetchInputUtxosTx is identical to fetchInputUtxos except it loads the utxos
+// through the passed database transaction instead of opening a new one.  It
+// must be used when a transaction is already open.
+func (view *UtxoViewpoint) fetchInputUtxosTx(dbTx database.Tx, block *btcutil.Block) error {
+	return view.fetchUtxosMainTx(dbTx, view.neededInputUtxos(block))
+}
+
+// neededInputUtxos returns the outputs referenced by the inputs of the
+// transactions in the given block that must be loaded from the database.  The
+// outputs of transactions earlier in the block that are referenced are added
+// to the view and entries that are already in the view are skipped.
+func (view *UtxoViewpoint) neededInputUtxos(block *btcutil.Block) []wire.OutPoint {
 	// Build a map of in-flight transactions because some of the inputs in
 	// this block could be referencing other transactions earlier in this
 	// block which are not yet in the chain.
@@ -604,9 +668,7 @@ func (view *UtxoViewpoint) fetchInputUtxos(db database.DB, block *btcutil.Block)
 			needed = append(needed, txIn.PreviousOutPoint)
 		}
 	}
-
-	// Request the input utxos from the database.
-	return view.fetchUtxosMain(db, needed)
+	return needed
 }
 
 // NewUtxoViewpoint returns a new empty unspent transaction output view.
@@ -646,7 +708,7 @@ func (b *BlockChain) FetchUtxoView(tx *btcutil.Tx) (*UtxoViewpoint, error) {
 	// chain.
 	view := NewUtxoViewpoint()
 	b.chainLock.RLock()
-	err := view.fetchUtxosMain(b.db, needed)
+	err := view.fetchUtxosMain(b.DB(), needed)
 	b.chainLock.RUnlock()
 	return view, err
 }
@@ -666,7 +728,7 @@ func (b *BlockChain) FetchUtxoEntry(outpoint wire.OutPoint) (*UtxoEntry, error)
 	defer b.chainLock.RUnlock()
 
 	var entry *UtxoEntry
-	err := b.db.View(func(dbTx database.Tx) error {
+	err := b.DB().View(func(dbTx database.Tx) error {
 		var err error
 		entry, err = dbFetchUtxoEntry(dbTx, outpoint)
 		return err
@@ -14,6 +14,7 @@ import (
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 )
@@ -813,6 +814,12 @@ func (b *BlockChain) checkBlockContext(block *btcutil.Block, prevNode *blockNode
 				return ruleError(ErrBlockWeightTooHigh, str)
 			}
 		}
+
+		// Enforce any rule toggles configured for testing fork
+		// activations.
+		if err := b.checkRuleToggles(block, prevNode); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -840,7 +847,7 @@ func (b *BlockChain) checkBIP0030(node *blockNode, block *btcutil.Block, view *U
 			fetch = append(fetch, prevOut)
 		}
 	}
-	err := view.fetchUtxos(b.db, fetch)
+	err := view.fetchUtxos(b.DB(), fetch)
 	if err != nil {
 		return err
 	}
@@ -984,8 +991,11 @@ func CheckTransactionInputs(tx *btcutil.Tx, txHeight int32, utxoView *UtxoViewpo
 // connects to the end of the current main chain and then calls this function
 // with that node.
 //
+// The flags modify the behavior of this function as follows:
+//   - BFNoScriptCheck: The transaction scripts are not executed.
+//
 // This function MUST be called with the chain state lock held (for writes).
-func (b *BlockChain) checkConnectBlock(node *blockNode, block *btcutil.Block, view *UtxoViewpoint, stxos *[]SpentTxOut) error {
+func (b *BlockChain) checkConnectBlock(node *blockNode, block *btcutil.Block, view *UtxoViewpoint, stxos *[]SpentTxOut, flags BehaviorFlags) error {
 	// If the side chain blocks end up in the database, a call to
 	// CheckBlockSanity should be done here in case a previous version
 	// allowed a block that is no longer valid.  However, since the
@@ -1035,7 +1045,7 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *btcutil.Block, vi
 	//
 	// These utxo entries are needed for verification of things such as
 	// transaction inputs, counting pay-to-script-hashes, and scripts.
-	err := view.fetchInputUtxos(b.db, block)
+	err := view.fetchInputUtxos(b.DB(), block)
 	if err != nil {
 		return err
 	}
@@ -1152,6 +1162,12 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *btcutil.Block, vi
 		runScripts = false
 	}
 
+	// Likewise, don't run scripts when the caller already knows the block
+	// is valid.
+	if flags&BFNoScriptCheck == BFNoScriptCheck {
+		runScripts = false
+	}
+
 	// Blocks created after the BIP0016 activation time need to have the
 	// pay-to-script-hash checks enabled.
 	var scriptFlags txscript.ScriptFlags
@@ -1236,7 +1252,7 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *btcutil.Block, vi
 	// prevent CPU exhaustion attacks.
 	if runScripts {
 		err := checkBlockScripts(block, view, scriptFlags, b.sigCache,
-			b.hashCache)
+			b.hashCache, b.scriptWorkers)
 		if err != nil {
 			return err
 		}
@@ -1286,5 +1302,151 @@ func (b *BlockChain) CheckConnectBlockTemplate(block *btcutil.Block) error {
 	view := NewUtxoViewpoint()
 	view.SetBestHash(&tip.hash)
 	newNode := newBlockNode(&header, tip)
-	return b.checkConnectBlock(newNode, block, view, nil)
+	return b.checkConnectBlock(newNode, block, view, nil, BFNone)
+}
+
+// VerifyHeaders verifies that the passed sequence of headers, which is
+// typically supplied by a light client bootstrapping from a peer, forms a valid
+// chain that connects to a block already known to the chain.  The headers are
+// checked for continuity, proof of work, difficulty transitions, timestamps,
+// checkpoints and block versions against the chain parameters, but they are not
+// stored.
+//
+// A HeaderError identifying the first invalid header and the reason it is
+// invalid is returned when the sequence is not valid.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) VerifyHeaders(headers []*wire.BlockHeader) error {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	prevNode := b.index.LookupNode(&headers[0].PrevBlock)
+	if prevNode == nil {
+		str := fmt.Sprintf("previous block %v is unknown",
+			headers[0].PrevBlock)
+		return HeaderError{0, ruleError(ErrPreviousBlockUnknown, str)}
+	}
+	if b.index.NodeStatus(prevNode).KnownInvalid() {
+		str := fmt.Sprintf("previous block %v is known to be invalid",
+			headers[0].PrevBlock)
+		return HeaderError{0, ruleError(ErrInvalidAncestorBlock, str)}
+	}
+
+	for i, header := range headers {
+		if header.PrevBlock != prevNode.hash {
+			str := fmt.Sprintf("previous block %v does not match "+
+				"the hash %v of the preceding header",
+				header.PrevBlock, prevNode.hash)
+			return HeaderError{i, ruleError(ErrPreviousBlockUnknown, str)}
+		}
+
+		err := checkBlockHeaderSanity(header, b.chainParams.PowLimit,
+			b.timeSource, BFNone)
+		if err != nil {
+			return HeaderError{i, err}
+		}
+		err = b.checkBlockHeaderContext(header, prevNode, BFNone)
+		if err != nil {
+			return HeaderError{i, err}
+		}
+
+		// The node is only used to validate the headers that follow
+		// and is not added to the block index.
+		prevNode = newBlockNode(header, prevNode)
+	}
+
+	return nil
+}
+
+// QuickVerify revalidates the last numBlocks blocks of the main chain to detect
+// recent corruption of the stored blocks, spend journal or utxo set without the
+// cost of a full rescan.  The utxo set is rewound past the blocks in memory by
+// using their spend journal entries and the blocks are then checked for sanity
+// and connected to it again in order.  Neither the chain state nor the block
+// index is modified.
+//
+// The height of the deepest verified block is returned, which is one more than
+// the height of the best chain when no blocks are verified.  The number of
+// blocks is limited to the height of the best chain since the genesis block
+// can't be connected.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) QuickVerify(numBlocks int) (int32, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	tip := b.bestChain.Tip()
+	if numBlocks > int(tip.height) {
+		numBlocks = int(tip.height)
+	}
+	if numBlocks <= 0 {
+		return tip.height + 1, nil
+	}
+
+	// Rewind the utxo set to the state before the deepest block to verify
+	// while loading the blocks.
+	blocks := make([]*btcutil.Block, numBlocks)
+	view := NewUtxoViewpoint()
+	view.SetBestHash(&tip.hash)
+	node := tip
+	for i := numBlocks - 1; i >= 0; i-- {
+		var block *btcutil.Block
+		var stxos []SpentTxOut
+		err := b.DB().View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByNode(dbTx, node)
+			if err != nil {
+				return err
+			}
+			stxos, err = dbFetchSpendJournalEntry(dbTx, block)
+			return err
+		})
+		if err != nil {
+			return 0, fmt.Errorf("unable to load block %v (height "+
+				"%d): %v", node.hash, node.height, err)
+		}
+		if *block.Hash() != node.hash {
+			return 0, fmt.Errorf("block at height %d has hash %v "+
+				"instead of %v", node.height, block.Hash(),
+				node.hash)
+		}
+
+		err = view.fetchInputUtxos(b.DB(), block)
+		if err != nil {
+			return 0, err
+		}
+		err = view.disconnectTransactions(b.DB(), block, stxos)
+		if err != nil {
+			return 0, fmt.Errorf("unable to disconnect block %v "+
+				"(height %d): %v", node.hash, node.height, err)
+		}
+
+		blocks[i] = block
+		node = node.parent
+	}
+
+	// Connect the blocks again in order, which validates the transactions
+	// of each block against the rewound utxo set.
+	deepest := node.height + 1
+	for i, block := range blocks {
+		node := b.bestChain.NodeByHeight(deepest + int32(i))
+		err := checkBlockSanity(block, b.chainParams.PowLimit,
+			b.timeSource, BFNone)
+		if err == nil {
+			err = b.checkConnectBlock(node, block, view, nil, BFNone)
+		}
+		if err != nil {
+			log.Errorf("Verification of block %v (height %d) failed: "+
+				"%v", node.hash, node.height, err)
+			return 0, err
+		}
+	}
+
+	log.Infof("Verified the last %d blocks down to height %d", numBlocks,
+		deepest)
+	return deepest, nil
 }
@@ -13,6 +13,8 @@ import (
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 )
 
@@ -148,6 +150,104 @@ func TestCheckConnectBlockTemplate(t *testing.T) {
 	}
 }
 
+// TestVerifyHeaders ensures VerifyHeaders accepts a valid sequence of headers
+// and identifies the first invalid header of sequences with a broken link, bad
+// proof of work or an unexpected difficulty.
+func TestVerifyHeaders(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("verifyheaders",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	parent := btcutil.NewBlock(chaincfg.RegressionNetParams.GenesisBlock)
+	var headers []*wire.BlockHeader
+	for i := 0; i < 4; i++ {
+		block := newReorgTestBlock(t, parent, int32(i+1), 0)
+		headers = append(headers, &block.MsgBlock().Header)
+		parent = block
+	}
+	if err := chain.VerifyHeaders(headers); err != nil {
+		t.Fatalf("VerifyHeaders: unexpected error: %v", err)
+	}
+	if chain.BestSnapshot().Height != 0 {
+		t.Fatal("VerifyHeaders: headers were stored")
+	}
+
+	// solve returns the passed header after finding a nonce for which its
+	// hash meets or misses the target described by its bits.
+	solve := func(header wire.BlockHeader, meet bool) *wire.BlockHeader {
+		target := CompactToBig(header.Bits)
+		for {
+			hash := header.BlockHash()
+			if (HashToBig(&hash).Cmp(target) <= 0) == meet {
+				return &header
+			}
+			header.Nonce++
+		}
+	}
+
+	// withHeader returns a copy of the valid headers with the header at the
+	// passed index replaced.
+	withHeader := func(index int, header *wire.BlockHeader) []*wire.BlockHeader {
+		modified := append([]*wire.BlockHeader(nil), headers...)
+		modified[index] = header
+		return modified
+	}
+
+	brokenLink := *headers[2]
+	brokenLink.PrevBlock = chainhash.Hash{0x01}
+	badDifficulty := *headers[1]
+	badDifficulty.Bits = 0x207ffffe
+	unknownParent := *headers[0]
+	unknownParent.PrevBlock = chainhash.Hash{0x01}
+
+	tests := []struct {
+		name    string
+		headers []*wire.BlockHeader
+		index   int
+		code    ErrorCode
+	}{{
+		name:    "unknown parent",
+		headers: withHeader(0, solve(unknownParent, true)),
+		index:   0,
+		code:    ErrPreviousBlockUnknown,
+	}, {
+		name:    "broken link",
+		headers: withHeader(2, solve(brokenLink, true)),
+		index:   2,
+		code:    ErrPreviousBlockUnknown,
+	}, {
+		name:    "bad proof of work",
+		headers: withHeader(3, solve(*headers[3], false)),
+		index:   3,
+		code:    ErrHighHash,
+	}, {
+		name:    "unexpected difficulty",
+		headers: withHeader(1, solve(badDifficulty, true)),
+		index:   1,
+		code:    ErrUnexpectedDifficulty,
+	}}
+	for _, test := range tests {
+		err := chain.VerifyHeaders(test.headers)
+		headerErr, ok := err.(HeaderError)
+		if !ok {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if headerErr.Index != test.index {
+			t.Errorf("%s: invalid header %d, want %d", test.name,
+				headerErr.Index, test.index)
+		}
+		ruleErr, ok := headerErr.Err.(RuleError)
+		if !ok || ruleErr.ErrorCode != test.code {
+			t.Errorf("%s: unexpected reason %v, want %v", test.name,
+				headerErr.Err, test.code)
+		}
+	}
+}
+
 // TestCheckBlockSanity tests the CheckBlockSanity function to ensure it works
 // as expected.
 func TestCheckBlockSanity(t *testing.T) {
@@ -485,3 +585,95 @@ var Block100000 = wire.MsgBlock{
 		},
 	},
 }
+
+// TestQuickVerify ensures the last blocks of the main chain are verified
+// without modifying the chain, that the number of blocks is limited to the
+// height of the best chain and that a corrupt spend journal is detected.
+func TestQuickVerify(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	chain, teardownFunc, err := chainSetup("quickverify", params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Extend the chain until the first coinbase is mature.
+	parent := btcutil.NewBlock(params.GenesisBlock)
+	var first *btcutil.Block
+	tipHeight := int32(params.CoinbaseMaturity) + 1
+	for height := int32(1); height < tipHeight; height++ {
+		block := newReorgTestBlock(t, parent, height, 0)
+		if _, _, err := chain.ProcessBlock(block, BFNone); err != nil {
+			t.Fatalf("ProcessBlock: unexpected error: %v", err)
+		}
+		if first == nil {
+			first = block
+		}
+		parent = block
+	}
+
+	// Spend the first coinbase in the tip so its spend journal entry is
+	// not empty.
+	msgBlock := newReorgTestBlock(t, parent, tipHeight, 0).MsgBlock()
+	spend := wire.NewMsgTx(1)
+	prevOut := wire.NewOutPoint(first.Transactions()[0].Hash(), 0)
+	spend.AddTxIn(wire.NewTxIn(prevOut, nil, nil))
+	spend.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_TRUE}))
+	msgBlock.AddTransaction(spend)
+	merkles := BuildMerkleTreeStore(btcutil.NewBlock(msgBlock).Transactions(),
+		false)
+	msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+	for {
+		hash := msgBlock.Header.BlockHash()
+		if HashToBig(&hash).Cmp(params.PowLimit) <= 0 {
+			break
+		}
+		msgBlock.Header.Nonce++
+	}
+	tip := btcutil.NewBlock(msgBlock)
+	if _, _, err := chain.ProcessBlock(tip, BFNone); err != nil {
+		t.Fatalf("ProcessBlock: unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		numBlocks int
+		deepest   int32
+	}{
+		{numBlocks: 0, deepest: tipHeight + 1},
+		{numBlocks: 3, deepest: tipHeight - 2},
+		{numBlocks: int(tipHeight), deepest: 1},
+		{numBlocks: 1000, deepest: 1},
+	}
+	for _, test := range tests {
+		deepest, err := chain.QuickVerify(test.numBlocks)
+		if err != nil {
+			t.Fatalf("QuickVerify(%d): unexpected error: %v",
+				test.numBlocks, err)
+		}
+		if deepest != test.deepest {
+			t.Fatalf("QuickVerify(%d): deepest height %d, want %d",
+				test.numBlocks, deepest, test.deepest)
+		}
+	}
+	if best := chain.BestSnapshot(); best.Hash != *tip.Hash() {
+		t.Fatalf("best chain tip changed to %v", best.Hash)
+	}
+
+	// Corrupt the spend journal entry of the tip so the restored output
+	// can't be spent by the block.
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		stxos := []SpentTxOut{{
+			Amount:     0,
+			PkScript:   []byte{txscript.OP_RETURN},
+			Height:     1,
+			IsCoinBase: true,
+		}}
+		return dbPutSpendJournalEntry(dbTx, tip.Hash(), stxos)
+	})
+	if err != nil {
+		t.Fatalf("unable to corrupt spend journal: %v", err)
+	}
+	if _, err := chain.QuickVerify(1); err == nil {
+		t.Fatal("QuickVerify: corrupt spend journal not detected")
+	}
+}
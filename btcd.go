@@ -5,7 +5,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
@@ -14,11 +16,16 @@ import (
 	"runtime"
 	"runtime/debug"
 	"runtime/pprof"
+	"syscall"
+	"time"
 
 	"github.com/btcsuite/btcd/blockchain/indexers"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/database"
 	"github.com/btcsuite/btcd/limits"
+	"github.com/btcsuite/btcd/netsync"
 	"github.com/btcsuite/btcd/ossec"
+	"github.com/btcsuite/btcd/wire"
 )
 
 const (
@@ -26,6 +33,13 @@ const (
 	// database type is appended to this value to form the full block
 	// database name.
 	blockDbNamePrefix = "blocks"
+
+	// blockJournalName is the name of the block journal file.
+	blockJournalName = "blocks.journal"
+
+	// orphanStoreName is the name of the directory orphan blocks are
+	// stored in.
+	orphanStoreName = "orphans"
 )
 
 var (
@@ -112,7 +126,8 @@ func btcdMain(serverChan chan<- *server) error {
 	}
 
 	// Load the block database.
-	db, err := loadBlockDB()
+	dbCfg := newBlockDBConfig()
+	db, err := openBlockDB(dbCfg)
 	if err != nil {
 		btcdLog.Errorf("%v", err)
 		return err
@@ -120,7 +135,17 @@ func btcdMain(serverChan chan<- *server) error {
 	defer func() {
 		// Ensure the database is sync'd and closed on shutdown.
 		btcdLog.Infof("Gracefully shutting down the database...")
-		db.Close()
+		err := db.Close()
+
+		// The journaled blocks are persisted once the database is
+		// closed cleanly, so the journal is no longer needed.
+		if err == nil && dbCfg.blockJournalEnabled() {
+			err := os.Remove(dbCfg.blockJournalPath())
+			if err != nil && !os.IsNotExist(err) {
+				btcdLog.Errorf("Unable to remove block journal: %v",
+					err)
+			}
+		}
 	}()
 
 	// Return now if an interrupt signal was triggered.
@@ -169,7 +194,7 @@ func btcdMain(serverChan chan<- *server) error {
 
 	// Create server and start it.
 	server, err := newServer(cfg.Listeners, cfg.AgentBlacklist,
-		cfg.AgentWhitelist, db, activeNetParams.Params, interrupt)
+		cfg.AgentWhitelist, db, dbCfg, activeNetParams.Params, interrupt)
 	if err != nil {
 		// TODO: this logging could do with some beautifying.
 		btcdLog.Errorf("Unable to start server on %v: %v",
@@ -194,11 +219,61 @@ func btcdMain(serverChan chan<- *server) error {
 	return nil
 }
 
+// blockDBConfig houses the settings the block database is loaded with so it
+// can be loaded without reading the global configuration, such as when btcd is
+// embedded.  See newBlockDBConfig for the settings of the main binary.
+type blockDBConfig struct {
+	// DataDir is the directory the block database is stored in.
+	DataDir string
+
+	// DbType is the type of the block database.
+	DbType string
+
+	// Net is the bitcoin network the block database is for.
+	Net wire.BitcoinNet
+
+	// RegressionTest removes an existing database before it is loaded
+	// since the regression test needs a clean database for each run.
+	RegressionTest bool
+
+	// NoGenesisInit fails loading the database when it does not exist
+	// rather than creating it.
+	NoGenesisInit bool
+
+	// MaxFlushHold limits how long committed data is held in memory
+	// before it is written to disk.  A value of zero uses the default of
+	// the database.
+	MaxFlushHold time.Duration
+
+	// BlockJournal journals the blocks accepted to the chain in the data
+	// directory.  A journal left behind by an unclean shutdown is replayed
+	// once the database is loaded regardless.
+	BlockJournal bool
+
+	// PersistOrphans keeps orphan blocks in the data directory.
+	PersistOrphans bool
+}
+
+// newBlockDBConfig returns the settings to load the block database with based
+// on the global configuration.
+func newBlockDBConfig() *blockDBConfig {
+	return &blockDBConfig{
+		DataDir:        cfg.DataDir,
+		DbType:         cfg.DbType,
+		Net:            activeNetParams.Net,
+		RegressionTest: cfg.RegressionTest,
+		NoGenesisInit:  cfg.NoGenesisInit,
+		MaxFlushHold:   cfg.DbMaxFlushHold,
+		BlockJournal:   cfg.BlockJournal,
+		PersistOrphans: cfg.PersistOrphans,
+	}
+}
+
 // removeRegressionDB removes the existing regression test database if running
 // in regression test mode and it already exists.
-func removeRegressionDB(dbPath string) error {
+func removeRegressionDB(dbCfg *blockDBConfig, dbPath string) error {
 	// Don't do anything if not in regression test mode.
-	if !cfg.RegressionTest {
+	if !dbCfg.RegressionTest {
 		return nil
 	}
 
@@ -222,33 +297,85 @@ func removeRegressionDB(dbPath string) error {
 	return nil
 }
 
-// dbPath returns the path to the block database given a database type.
-func blockDbPath(dbType string) string {
+// isNotWritableErr returns whether the passed error indicates a path can't be
+// written to due to its permissions or a read-only file system.
+func isNotWritableErr(err error) bool {
+	return errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EROFS)
+}
+
+// checkDirWritable returns a descriptive error when files can't be created in
+// the passed directory by creating and removing a temporary file in it.
+func checkDirWritable(dir string) error {
+	file, err := os.CreateTemp(dir, ".writetest-*")
+	if err != nil {
+		if isNotWritableErr(err) {
+			return fmt.Errorf("data directory '%s' is not writable: "+
+				"%w", dir, err)
+		}
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// checkDbWritable returns a descriptive error when the existing block database
+// at the passed path can't be opened for writing because its directory or any
+// of its files are read-only.  Nothing is checked when there is no database at
+// the path.
+func checkDbWritable(dbPath string) error {
+	if _, err := os.Stat(dbPath); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err := checkDirWritable(dbPath); err != nil {
+		return err
+	}
+	return filepath.WalkDir(dbPath, func(path string, d fs.DirEntry,
+		err error) error {
+
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Mode().Perm()&0200 == 0 {
+			return fmt.Errorf("block database file '%s' is "+
+				"read-only -- ensure the data directory is "+
+				"writable", path)
+		}
+		return nil
+	})
+}
+
+// blockDbPath returns the path to the block database in the passed data
+// directory given a database type.
+func blockDbPath(dataDir, dbType string) string {
 	// The database name is based on the database type.
 	dbName := blockDbNamePrefix + "_" + dbType
 	if dbType == "sqlite" {
 		dbName = dbName + ".db"
 	}
-	dbPath := filepath.Join(cfg.DataDir, dbName)
+	dbPath := filepath.Join(dataDir, dbName)
 	return dbPath
 }
 
 // warnMultipleDBs shows a warning if multiple block database types are detected.
 // This is not a situation most users want.  It is handy for development however
 // to support multiple side-by-side databases.
-func warnMultipleDBs() {
+func warnMultipleDBs(dbCfg *blockDBConfig) {
 	// This is intentionally not using the known db types which depend
 	// on the database types compiled into the binary since we want to
 	// detect legacy db types as well.
 	dbTypes := []string{"ffldb", "leveldb", "sqlite"}
 	duplicateDbPaths := make([]string, 0, len(dbTypes)-1)
 	for _, dbType := range dbTypes {
-		if dbType == cfg.DbType {
+		if dbType == dbCfg.DbType {
 			continue
 		}
 
 		// Store db path as a duplicate db if it exists.
-		dbPath := blockDbPath(dbType)
+		dbPath := blockDbPath(dbCfg.DataDir, dbType)
 		if fileExists(dbPath) {
 			duplicateDbPaths = append(duplicateDbPaths, dbPath)
 		}
@@ -256,7 +383,7 @@ func warnMultipleDBs() {
 
 	// Warn if there are extra databases.
 	if len(duplicateDbPaths) > 0 {
-		selectedDbPath := blockDbPath(cfg.DbType)
+		selectedDbPath := blockDbPath(dbCfg.DataDir, dbCfg.DbType)
 		btcdLog.Warnf("WARNING: There are multiple block chain databases "+
 			"using different database types.\nYou probably don't "+
 			"want to waste disk space by having more than one.\n"+
@@ -266,35 +393,42 @@ func warnMultipleDBs() {
 	}
 }
 
-// loadBlockDB loads (or creates when needed) the block database taking into
-// account the selected database backend and returns a handle to it.  It also
+// openBlockDB loads (or creates when needed) the block database with the passed
+// settings and returns a handle to it.  It also
 // contains additional logic such warning the user if there are multiple
 // databases which consume space on the file system and ensuring the regression
 // test database is clean when in regression test mode.
-func loadBlockDB() (database.DB, error) {
+func openBlockDB(dbCfg *blockDBConfig) (database.DB, error) {
 	// The memdb backend does not have a file path associated with it, so
 	// handle it uniquely.  We also don't want to worry about the multiple
 	// database type warnings when running with the memory database.
-	if cfg.DbType == "memdb" {
+	if dbCfg.DbType == "memdb" {
 		btcdLog.Infof("Creating block database in memory.")
-		db, err := database.Create(cfg.DbType)
+		db, err := database.Create(dbCfg.DbType)
 		if err != nil {
 			return nil, err
 		}
 		return db, nil
 	}
 
-	warnMultipleDBs()
+	warnMultipleDBs(dbCfg)
 
 	// The database name is based on the database type.
-	dbPath := blockDbPath(cfg.DbType)
+	dbPath := blockDbPath(dbCfg.DataDir, dbCfg.DbType)
 
 	// The regression test is special in that it needs a clean database for
 	// each run, so remove it now if it already exists.
-	removeRegressionDB(dbPath)
+	removeRegressionDB(dbCfg, dbPath)
+
+	// Fail with a clear error when the existing database can't be
+	// written to rather than the confusing one opening it for writing
+	// produces.
+	if err := checkDbWritable(dbPath); err != nil {
+		return nil, err
+	}
 
 	btcdLog.Infof("Loading block database from '%s'", dbPath)
-	db, err := database.Open(cfg.DbType, dbPath, activeNetParams.Net)
+	db, err := database.Open(dbCfg.DbType, dbPath, dbCfg.Net)
 	if err != nil {
 		// Return the error if it's not because the database doesn't
 		// exist.
@@ -304,21 +438,107 @@ func loadBlockDB() (database.DB, error) {
 			return nil, err
 		}
 
+		// The database must be initialized externally when automatic
+		// genesis initialization is disabled.
+		if dbCfg.NoGenesisInit {
+			return nil, fmt.Errorf("block database '%s' does not "+
+				"exist and --nogenesisinit is set -- restore "+
+				"or initialize the database first", dbPath)
+		}
+
 		// Create the db if it does not exist.
-		err = os.MkdirAll(cfg.DataDir, 0700)
+		err = os.MkdirAll(dbCfg.DataDir, 0700)
 		if err != nil {
+			if isNotWritableErr(err) {
+				return nil, fmt.Errorf("data directory '%s' is "+
+					"not writable: %w", dbCfg.DataDir, err)
+			}
 			return nil, err
 		}
-		db, err = database.Create(cfg.DbType, dbPath, activeNetParams.Net)
+		if err := checkDirWritable(dbCfg.DataDir); err != nil {
+			return nil, err
+		}
+		db, err = database.Create(dbCfg.DbType, dbPath, dbCfg.Net)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	// Limit how long committed data is held in memory before it is
+	// written to disk and shut down when held data can't be written since
+	// it would otherwise be lost on an unclean shutdown.
+	if holder, ok := db.(database.FlushHolder); ok && dbCfg.MaxFlushHold > 0 {
+		holder.SetMaxFlushHold(dbCfg.MaxFlushHold)
+		holder.SetHeldFlushFailureHandler(func(err error) {
+			btcdLog.Errorf("Unable to write held block database "+
+				"data: %v -- shutting down", err)
+			requestShutdown()
+		})
+	}
+
+	// Detect blocks lost when btcd was not shut down cleanly.
+	if err := replayBlockJournal(db, dbCfg.blockJournalPath()); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	btcdLog.Info("Block database loaded")
 	return db, nil
 }
 
+// blockJournalPath returns the path to the block journal.
+func (c *blockDBConfig) blockJournalPath() string {
+	return filepath.Join(c.DataDir, blockJournalName)
+}
+
+// blockJournalEnabled returns whether accepted blocks are journaled.  The
+// memory database does not survive a restart, so it is never journaled.
+func (c *blockDBConfig) blockJournalEnabled() bool {
+	return c.BlockJournal && c.DbType != "memdb"
+}
+
+// orphanStorePath returns the path to the orphan store directory.
+func (c *blockDBConfig) orphanStorePath() string {
+	return filepath.Join(c.DataDir, orphanStoreName)
+}
+
+// orphanStoreEnabled returns whether orphan blocks are stored on disk.  The
+// memory database does not survive a restart, so the parents of orphans
+// stored with it would never be known either.
+func (c *blockDBConfig) orphanStoreEnabled() bool {
+	return c.PersistOrphans && c.DbType != "memdb"
+}
+
+// replayBlockJournal replays the block journal at the passed path left behind
+// when btcd was not shut down cleanly and logs the journaled blocks that the
+// database lost.
+func replayBlockJournal(db database.DB, journalPath string) error {
+	haveBlock := func(hash *chainhash.Hash) (bool, error) {
+		var exists bool
+		err := db.View(func(dbTx database.Tx) error {
+			var err error
+			exists, err = dbTx.HasBlock(hash)
+			return err
+		})
+		return exists, err
+	}
+	lost, err := netsync.ReplayBlockJournal(journalPath, haveBlock)
+	if err != nil {
+		return err
+	}
+	if len(lost) == 0 {
+		return nil
+	}
+
+	for _, entry := range lost {
+		btcdLog.Debugf("Lost block %v (height %d)", entry.Hash,
+			entry.Height)
+	}
+	btcdLog.Warnf("Recovered from an unclean shutdown -- %d accepted "+
+		"blocks were lost", len(lost))
+	return nil
+}
+
 func unveilx(path string, perms string) {
 	err := ossec.Unveil(path, perms)
 	if err != nil {
@@ -0,0 +1,152 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/netsync"
+	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+)
+
+// TestLoadBlockDBReadOnly ensures loading the block database fails with a clear
+// error when the data directory or an existing database is read-only.
+func TestLoadBlockDBReadOnly(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+
+	// Loading the database logs, which requires the log rotator.
+	oldLevel := btcdLog.Level()
+	btcdLog.SetLevel(btclog.LevelOff)
+	defer btcdLog.SetLevel(oldLevel)
+
+	// An existing database with a read-only file is detected before it is
+	// opened for writing.
+	cfg = &config{DataDir: t.TempDir(), DbType: "ffldb"}
+	dbPath := blockDbPath(cfg.DataDir, cfg.DbType)
+	db, err := database.Create(cfg.DbType, dbPath, activeNetParams.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	db.Close()
+	dbFile := filepath.Join(dbPath, "metadata", "CURRENT")
+	if err := os.Chmod(dbFile, 0400); err != nil {
+		t.Fatalf("unable to make db file read-only: %v", err)
+	}
+	_, err = openBlockDB(newBlockDBConfig())
+	if err == nil || !strings.Contains(err.Error(), "read-only") ||
+		!strings.Contains(err.Error(), dbFile) {
+
+		t.Fatalf("unexpected error for a read-only db file: %v", err)
+	}
+
+	// The permissions of a read-only data directory are not enforced for
+	// the superuser.
+	if os.Geteuid() == 0 {
+		t.Skip("skipping read-only data directory test as superuser")
+	}
+	cfg = &config{DataDir: t.TempDir(), DbType: "ffldb"}
+	if err := os.Chmod(cfg.DataDir, 0500); err != nil {
+		t.Fatalf("unable to make data directory read-only: %v", err)
+	}
+	defer os.Chmod(cfg.DataDir, 0700)
+	_, err = openBlockDB(newBlockDBConfig())
+	if err == nil || !strings.Contains(err.Error(), "not writable") ||
+		!strings.Contains(err.Error(), cfg.DataDir) {
+
+		t.Fatalf("unexpected error for a read-only data directory: %v",
+			err)
+	}
+}
+
+// nopPeerNotifier is a netsync.PeerNotifier that ignores all notifications.
+type nopPeerNotifier struct{}
+
+func (nopPeerNotifier) AnnounceNewTransactions([]*mempool.TxDesc)            {}
+func (nopPeerNotifier) NotifyNewTransactions([]*mempool.TxDesc)              {}
+func (nopPeerNotifier) UpdatePeerHeights(*chainhash.Hash, int32, *peer.Peer) {}
+func (nopPeerNotifier) RelayInventory(*wire.InvVect, interface{})            {}
+func (nopPeerNotifier) TransactionConfirmed(*btcutil.Tx)                     {}
+func (nopPeerNotifier) QueueBackpressure(*peer.Peer, bool)                   {}
+
+// TestOpenBlockDBExplicitConfig ensures the block database can be loaded and a
+// sync manager driven purely from explicit settings without the global
+// configuration.
+func TestOpenBlockDBExplicitConfig(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = nil
+
+	// Loading the database, the chain and the sync manager logs, which
+	// requires the log rotator.
+	setLogLevels("off")
+	defer setLogLevels(defaultLogLevel)
+
+	params := chaincfg.RegressionNetParams
+	dbCfg := &blockDBConfig{
+		DataDir: t.TempDir(),
+		DbType:  "ffldb",
+		Net:     params.Net,
+	}
+	db, err := openBlockDB(dbCfg)
+	if err != nil {
+		t.Fatalf("unable to open db: %v", err)
+	}
+	defer db.Close()
+	if !fileExists(blockDbPath(dbCfg.DataDir, dbCfg.DbType)) {
+		t.Fatal("block database not created in the data directory")
+	}
+
+	// The block journal and orphan store live in the data directory of the
+	// settings.
+	dbCfg.BlockJournal = true
+	dbCfg.PersistOrphans = true
+	if !dbCfg.blockJournalEnabled() || !dbCfg.orphanStoreEnabled() {
+		t.Fatal("block journal or orphan store not enabled")
+	}
+	if filepath.Dir(dbCfg.blockJournalPath()) != dbCfg.DataDir ||
+		filepath.Dir(dbCfg.orphanStorePath()) != dbCfg.DataDir {
+
+		t.Fatal("block journal or orphan store outside the data directory")
+	}
+
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  blockchain.NewMedianTime(),
+	})
+	if err != nil {
+		t.Fatalf("unable to create chain: %v", err)
+	}
+	sm, err := netsync.New(&netsync.Config{
+		PeerNotifier: nopPeerNotifier{},
+		Chain:        chain,
+		TxMemPool:    mempool.New(&mempool.Config{ChainParams: &params}),
+		ChainParams:  &params,
+		MaxPeers:     8,
+	})
+	if err != nil {
+		t.Fatalf("unable to create sync manager: %v", err)
+	}
+	sm.Start()
+	if sm.IsCurrent() {
+		t.Fatal("sync manager current with only the genesis block")
+	}
+	if err := sm.Stop(); err != nil {
+		t.Fatalf("unable to stop sync manager: %v", err)
+	}
+}
@@ -41,6 +41,25 @@ func NewStopNotifyBlocksCmd() *StopNotifyBlocksCmd {
 	return &StopNotifyBlocksCmd{}
 }
 
+// NotifyDoubleSpendsCmd defines the notifydoublespends JSON-RPC command.
+type NotifyDoubleSpendsCmd struct{}
+
+// NewNotifyDoubleSpendsCmd returns a new instance which can be used to issue a
+// notifydoublespends JSON-RPC command.
+func NewNotifyDoubleSpendsCmd() *NotifyDoubleSpendsCmd {
+	return &NotifyDoubleSpendsCmd{}
+}
+
+// StopNotifyDoubleSpendsCmd defines the stopnotifydoublespends JSON-RPC
+// command.
+type StopNotifyDoubleSpendsCmd struct{}
+
+// NewStopNotifyDoubleSpendsCmd returns a new instance which can be used to
+// issue a stopnotifydoublespends JSON-RPC command.
+func NewStopNotifyDoubleSpendsCmd() *StopNotifyDoubleSpendsCmd {
+	return &StopNotifyDoubleSpendsCmd{}
+}
+
 // NotifyNewTransactionsCmd defines the notifynewtransactions JSON-RPC command.
 type NotifyNewTransactionsCmd struct {
 	Verbose *bool `jsonrpcdefault:"false"`
@@ -228,11 +247,13 @@ func init() {
 	MustRegisterCmd("authenticate", (*AuthenticateCmd)(nil), flags)
 	MustRegisterCmd("loadtxfilter", (*LoadTxFilterCmd)(nil), flags)
 	MustRegisterCmd("notifyblocks", (*NotifyBlocksCmd)(nil), flags)
+	MustRegisterCmd("notifydoublespends", (*NotifyDoubleSpendsCmd)(nil), flags)
 	MustRegisterCmd("notifynewtransactions", (*NotifyNewTransactionsCmd)(nil), flags)
 	MustRegisterCmd("notifyreceived", (*NotifyReceivedCmd)(nil), flags)
 	MustRegisterCmd("notifyspent", (*NotifySpentCmd)(nil), flags)
 	MustRegisterCmd("session", (*SessionCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyblocks", (*StopNotifyBlocksCmd)(nil), flags)
+	MustRegisterCmd("stopnotifydoublespends", (*StopNotifyDoubleSpendsCmd)(nil), flags)
 	MustRegisterCmd("stopnotifynewtransactions", (*StopNotifyNewTransactionsCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyspent", (*StopNotifySpentCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyreceived", (*StopNotifyReceivedCmd)(nil), flags)
@@ -75,6 +75,11 @@ const (
 	// from the chain server that inform a client that a transaction that
 	// matches the loaded filter was accepted by the mempool.
 	RelevantTxAcceptedNtfnMethod = "relevanttxaccepted"
+
+	// DoubleSpendNtfnMethod is the method used for notifications from the
+	// chain server that a transaction spending outputs already spent by
+	// transactions in the mempool has been received.
+	DoubleSpendNtfnMethod = "doublespend"
 )
 
 // BlockConnectedNtfn defines the blockconnected JSON-RPC notification.
@@ -285,6 +290,28 @@ func NewRelevantTxAcceptedNtfn(txHex string) *RelevantTxAcceptedNtfn {
 	return &RelevantTxAcceptedNtfn{Transaction: txHex}
 }
 
+// DoubleSpendConflict describes an output spent by both a transaction in the
+// mempool and the transaction of a doublespend notification.
+type DoubleSpendConflict struct {
+	OutPoint     OutPoint `json:"outpoint"`
+	ConflictTxID string   `json:"conflicttxid"`
+}
+
+// DoubleSpendNtfn defines the doublespend JSON-RPC notification.
+type DoubleSpendNtfn struct {
+	TxID      string
+	Conflicts []DoubleSpendConflict
+}
+
+// NewDoubleSpendNtfn returns a new instance which can be used to issue a
+// doublespend JSON-RPC notification.
+func NewDoubleSpendNtfn(txID string, conflicts []DoubleSpendConflict) *DoubleSpendNtfn {
+	return &DoubleSpendNtfn{
+		TxID:      txID,
+		Conflicts: conflicts,
+	}
+}
+
 func init() {
 	// The commands in this file are only usable by websockets and are
 	// notifications.
@@ -301,4 +328,5 @@ func init() {
 	MustRegisterCmd(TxAcceptedNtfnMethod, (*TxAcceptedNtfn)(nil), flags)
 	MustRegisterCmd(TxAcceptedVerboseNtfnMethod, (*TxAcceptedVerboseNtfn)(nil), flags)
 	MustRegisterCmd(RelevantTxAcceptedNtfnMethod, (*RelevantTxAcceptedNtfn)(nil), flags)
+	MustRegisterCmd(DoubleSpendNtfnMethod, (*DoubleSpendNtfn)(nil), flags)
 }
@@ -225,6 +225,31 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Transaction: "001122",
 			},
 		},
+		{
+			name: "doublespend",
+			newNtfn: func() (interface{}, error) {
+				conflicts := []btcjson.DoubleSpendConflict{{
+					OutPoint:     btcjson.OutPoint{Hash: "123", Index: 0},
+					ConflictTxID: "456",
+				}}
+				return btcjson.NewCmd("doublespend", "789", conflicts)
+			},
+			staticNtfn: func() interface{} {
+				conflicts := []btcjson.DoubleSpendConflict{{
+					OutPoint:     btcjson.OutPoint{Hash: "123", Index: 0},
+					ConflictTxID: "456",
+				}}
+				return btcjson.NewDoubleSpendNtfn("789", conflicts)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"doublespend","params":["789",[{"outpoint":{"hash":"123","index":0},"conflicttxid":"456"}]],"id":null}`,
+			unmarshalled: &btcjson.DoubleSpendNtfn{
+				TxID: "789",
+				Conflicts: []btcjson.DoubleSpendConflict{{
+					OutPoint:     btcjson.OutPoint{Hash: "123", Index: 0},
+					ConflictTxID: "456",
+				}},
+			},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -5,12 +5,25 @@
 package bloom
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 )
 
+var (
+	// ErrTxNotInBlock is returned when a merkle proof is requested for a
+	// transaction that is not in the block.
+	ErrTxNotInBlock = errors.New("transaction not in block")
+
+	// ErrInvalidMerkleProof is returned when a merkle block does not prove
+	// the inclusion of its matched transactions in the block.
+	ErrInvalidMerkleProof = errors.New("invalid merkle proof")
+)
+
 // merkleBlock is used to house intermediate information needed to generate a
 // wire.MsgMerkleBlock according to a filter.
 type merkleBlock struct {
@@ -80,6 +93,29 @@ func (m *merkleBlock) traverseAndBuild(height, pos uint32) {
 // NewMerkleBlock returns a new *wire.MsgMerkleBlock and an array of the matched
 // transaction index numbers based on the passed block and filter.
 func NewMerkleBlock(block *btcutil.Block, filter *Filter) (*wire.MsgMerkleBlock, []uint32) {
+	return newMerkleBlock(block, filter.MatchTxAndUpdate)
+}
+
+// NewTxMerkleProof returns a *wire.MsgMerkleBlock that proves the inclusion of
+// the transaction with the passed hash in the passed block.  ErrTxNotInBlock is
+// returned when the block does not contain the transaction.
+func NewTxMerkleProof(block *btcutil.Block, txHash *chainhash.Hash) (*wire.MsgMerkleBlock, error) {
+	msgMerkleBlock, matchedIndices := newMerkleBlock(block,
+		func(tx *btcutil.Tx) bool {
+			return tx.Hash().IsEqual(txHash)
+		})
+	if len(matchedIndices) == 0 {
+		return nil, ErrTxNotInBlock
+	}
+	return msgMerkleBlock, nil
+}
+
+// newMerkleBlock returns a new *wire.MsgMerkleBlock and an array of the
+// matched transaction index numbers based on the passed block and match
+// function.
+func newMerkleBlock(block *btcutil.Block,
+	match func(tx *btcutil.Tx) bool) (*wire.MsgMerkleBlock, []uint32) {
+
 	numTx := uint32(len(block.Transactions()))
 	mBlock := merkleBlock{
 		numTx:       numTx,
@@ -87,10 +123,10 @@ func NewMerkleBlock(block *btcutil.Block, filter *Filter) (*wire.MsgMerkleBlock,
 		matchedBits: make([]byte, 0, numTx),
 	}
 
-	// Find and keep track of any transactions that match the filter.
+	// Find and keep track of any transactions that match.
 	var matchedIndices []uint32
 	for txIndex, tx := range block.Transactions() {
-		if filter.MatchTxAndUpdate(tx) {
+		if match(tx) {
 			mBlock.matchedBits = append(mBlock.matchedBits, 0x01)
 			matchedIndices = append(matchedIndices, uint32(txIndex))
 		} else {
@@ -123,3 +159,114 @@ func NewMerkleBlock(block *btcutil.Block, filter *Filter) (*wire.MsgMerkleBlock,
 	}
 	return &msgMerkleBlock, matchedIndices
 }
+
+// merkleProof is used to house intermediate information needed to extract the
+// matched transactions from a wire.MsgMerkleBlock.
+type merkleProof struct {
+	numTx      uint32
+	hashes     []*chainhash.Hash
+	flags      []byte
+	hashesUsed int
+	bitsUsed   uint32
+	matched    []*chainhash.Hash
+}
+
+// calcTreeWidth calculates and returns the the number of nodes (width) or a
+// merkle tree at the given depth-first height.
+func (m *merkleProof) calcTreeWidth(height uint32) uint32 {
+	return (m.numTx + (1 << height) - 1) >> height
+}
+
+// traverseAndExtract walks the partial merkle tree using a recursive
+// depth-first approach mirroring the one used to build it and returns the hash
+// of the sub-tree at the given height and position.  The hashes of the matched
+// leaf nodes are collected along the way.
+func (m *merkleProof) traverseAndExtract(height, pos uint32) (*chainhash.Hash, error) {
+	if m.bitsUsed >= uint32(len(m.flags))*8 {
+		return nil, fmt.Errorf("%w: too few flag bits", ErrInvalidMerkleProof)
+	}
+	isParent := m.flags[m.bitsUsed/8]&(1<<(m.bitsUsed%8)) != 0
+	m.bitsUsed++
+
+	// Leaf nodes and nodes that are not parents of a matched node have
+	// their hash included in the proof.
+	if height == 0 || !isParent {
+		if m.hashesUsed >= len(m.hashes) {
+			return nil, fmt.Errorf("%w: too few hashes",
+				ErrInvalidMerkleProof)
+		}
+		hash := m.hashes[m.hashesUsed]
+		m.hashesUsed++
+		if height == 0 && isParent {
+			m.matched = append(m.matched, hash)
+		}
+		return hash, nil
+	}
+
+	left, err := m.traverseAndExtract(height-1, pos*2)
+	if err != nil {
+		return nil, err
+	}
+	right := left
+	if pos*2+1 < m.calcTreeWidth(height-1) {
+		right, err = m.traverseAndExtract(height-1, pos*2+1)
+		if err != nil {
+			return nil, err
+		}
+
+		// Identical siblings allow the same merkle root to be produced
+		// for different sets of transactions (CVE-2012-2459).
+		if right.IsEqual(left) {
+			return nil, fmt.Errorf("%w: duplicate sibling hashes",
+				ErrInvalidMerkleProof)
+		}
+	}
+	return blockchain.HashMerkleBranches(left, right), nil
+}
+
+// VerifyMerkleBlock validates that the partial merkle tree in the passed merkle
+// block commits to the merkle root in its header and returns the hashes of the
+// transactions it proves are included in the block.  An error wrapping
+// ErrInvalidMerkleProof is returned when the proof is malformed or does not
+// match the merkle root.
+func VerifyMerkleBlock(msg *wire.MsgMerkleBlock) ([]*chainhash.Hash, error) {
+	if msg.Transactions == 0 {
+		return nil, fmt.Errorf("%w: no transactions", ErrInvalidMerkleProof)
+	}
+	if uint32(len(msg.Hashes)) > msg.Transactions {
+		return nil, fmt.Errorf("%w: more hashes than transactions",
+			ErrInvalidMerkleProof)
+	}
+
+	proof := merkleProof{
+		numTx:  msg.Transactions,
+		hashes: msg.Hashes,
+		flags:  msg.Flags,
+	}
+
+	// Calculate the number of merkle branches (height) in the tree.
+	height := uint32(0)
+	for proof.calcTreeWidth(height) > 1 {
+		height++
+	}
+
+	root, err := proof.traverseAndExtract(height, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every hash and every byte of flags must be consumed.
+	if proof.hashesUsed != len(msg.Hashes) {
+		return nil, fmt.Errorf("%w: unused hashes", ErrInvalidMerkleProof)
+	}
+	if (proof.bitsUsed+7)/8 != uint32(len(msg.Flags)) {
+		return nil, fmt.Errorf("%w: unused flag bytes",
+			ErrInvalidMerkleProof)
+	}
+	if !root.IsEqual(&msg.Header.MerkleRoot) {
+		return nil, fmt.Errorf("%w: calculated merkle root %v does not "+
+			"match %v", ErrInvalidMerkleProof, root,
+			msg.Header.MerkleRoot)
+	}
+	return proof.matched, nil
+}
@@ -7,8 +7,10 @@ package bloom_test
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"testing"
 
+	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/btcutil/bloom"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -72,3 +74,59 @@ func TestMerkleBlock3(t *testing.T) {
 		return
 	}
 }
+
+// TestTxMerkleProof ensures merkle proofs created for each transaction in a
+// block verify against its merkle root, that proofs are not created for
+// transactions that are not in the block, and that tampered proofs are
+// rejected.
+func TestTxMerkleProof(t *testing.T) {
+	// Create a block with an odd number of transactions so the proofs
+	// cover the duplicated final hash at each level of the tree.
+	const numTx = 5
+	var msgBlock wire.MsgBlock
+	for i := 0; i < numTx; i++ {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: uint32(i)}, nil,
+			nil))
+		tx.AddTxOut(wire.NewTxOut(int64(i), nil))
+		msgBlock.AddTransaction(tx)
+	}
+	blk := btcutil.NewBlock(&msgBlock)
+	merkles := blockchain.BuildMerkleTreeStore(blk.Transactions(), false)
+	msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+
+	for i, tx := range blk.Transactions() {
+		proof, err := bloom.NewTxMerkleProof(blk, tx.Hash())
+		if err != nil {
+			t.Fatalf("NewTxMerkleProof #%d failed: %v", i, err)
+		}
+		matched, err := bloom.VerifyMerkleBlock(proof)
+		if err != nil {
+			t.Fatalf("VerifyMerkleBlock #%d failed: %v", i, err)
+		}
+		if len(matched) != 1 || !matched[0].IsEqual(tx.Hash()) {
+			t.Fatalf("proof #%d matched %v, want %v", i, matched,
+				tx.Hash())
+		}
+	}
+
+	unknown := chainhash.Hash{0x01}
+	_, err := bloom.NewTxMerkleProof(blk, &unknown)
+	if !errors.Is(err, bloom.ErrTxNotInBlock) {
+		t.Fatalf("NewTxMerkleProof for unknown tx: got %v, want %v",
+			err, bloom.ErrTxNotInBlock)
+	}
+
+	// A proof with a tampered hash must not verify.
+	txHash := blk.Transactions()[2].Hash()
+	proof, err := bloom.NewTxMerkleProof(blk, txHash)
+	if err != nil {
+		t.Fatalf("NewTxMerkleProof failed: %v", err)
+	}
+	proof.Hashes[0] = &unknown
+	_, err = bloom.VerifyMerkleBlock(proof)
+	if !errors.Is(err, bloom.ErrInvalidMerkleProof) {
+		t.Fatalf("VerifyMerkleBlock for tampered proof: got %v, want %v",
+			err, bloom.ErrInvalidMerkleProof)
+	}
+}
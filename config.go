@@ -29,7 +29,9 @@ import (
 	"github.com/btcsuite/btcd/database"
 	_ "github.com/btcsuite/btcd/database/ffldb"
 	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/netsync"
 	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/go-socks/socks"
 	flags "github.com/jessevdk/go-flags"
@@ -100,36 +102,53 @@ type config struct {
 	AddrIndex            bool          `long:"addrindex" description:"Maintain a full address-based transaction index which makes the searchrawtransactions RPC available"`
 	AgentBlacklist       []string      `long:"agentblacklist" description:"A comma separated list of user-agent substrings which will cause btcd to reject any peers whose user-agent contains any of the blacklisted substrings."`
 	AgentWhitelist       []string      `long:"agentwhitelist" description:"A comma separated list of user-agent substrings which will cause btcd to require all peers' user-agents to contain one of the whitelisted substrings. The blacklist is applied before the blacklist, and an empty whitelist will allow all agents that do not fail the blacklist."`
+	AuditUtxoSet         bool          `long:"auditutxoset" description:"Rebuild the utxo set by replaying the main chain after start up and log any differences from the stored utxo set -- This can take many hours and a lot of memory"`
+	AssumeValid          string        `long:"assumevalid" description:"Hash of a block known to be valid -- The scripts of the block and its ancestors are not verified during the initial block download"`
 	BanDuration          time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
 	BanThreshold         uint32        `long:"banthreshold" description:"Maximum allowed ban score before disconnecting and banning misbehaving peers."`
+	BlockDownloadWindow  int           `long:"blockdownloadwindow" description:"Maximum number of blocks to request from the sync peer at once during the initial block download -- Higher values improve throughput on fast links at the cost of more memory"`
+	BlockJournal         bool          `long:"blockjournal" description:"Journal accepted blocks to detect blocks lost when btcd is not shut down cleanly"`
 	BlockMaxSize         uint32        `long:"blockmaxsize" description:"Maximum block size in bytes to be used when creating a block"`
 	BlockMinSize         uint32        `long:"blockminsize" description:"Mininum block size in bytes to be used when creating a block"`
 	BlockMaxWeight       uint32        `long:"blockmaxweight" description:"Maximum block weight to be used when creating a block"`
 	BlockMinWeight       uint32        `long:"blockminweight" description:"Mininum block weight to be used when creating a block"`
 	BlockPrioritySize    uint32        `long:"blockprioritysize" description:"Size in bytes for high-priority/low-fee transactions when creating a block"`
 	BlocksOnly           bool          `long:"blocksonly" description:"Do not accept transactions from remote peers."`
+	CheckpointQuorum     int           `long:"checkpointquorum" description:"Number of the most recent checkpoints a peer must prove it has before it is used to sync the chain -- Peers that do not match are disconnected"`
 	ConfigFile           string        `short:"C" long:"configfile" description:"Path to configuration file"`
 	ConnectPeers         []string      `long:"connect" description:"Connect only to the specified peers at startup"`
 	CPUProfile           string        `long:"cpuprofile" description:"Write CPU profile to the specified file"`
 	MemoryProfile        string        `long:"memprofile" description:"Write memory profile to the specified file"`
 	DataDir              string        `short:"b" long:"datadir" description:"Directory to store data"`
+	DbCompactInterval    time.Duration `long:"dbcompactinterval" description:"Interval at which to compact the block database to reclaim space occupied by deleted data if the database backend supports it -- Valid time units are {s, m, h}.  0 to disable"`
+	DbMaxFlushHold       time.Duration `long:"dbmaxflushhold" description:"Max time data committed to the block database is held in memory before it is written to disk if the database backend batches writes -- Valid time units are {s, m, h}.  0 to hold data until the next batch is written"`
 	DbType               string        `long:"dbtype" description:"Database backend to use for the Block Chain"`
 	DebugLevel           string        `short:"d" long:"debuglevel" description:"Logging level for all subsystems {trace, debug, info, warn, error, critical} -- You may also specify <subsystem>=<level>,<subsystem2>=<level>,... to set the log level for individual subsystems -- Use show to list available subsystems"`
+	DiverseSyncPeer      bool          `long:"diversesyncpeer" description:"Prefer a peer to sync the chain from whose network group is not shared with any other connected peer"`
 	DropAddrIndex        bool          `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits."`
 	DropCfIndex          bool          `long:"dropcfindex" description:"Deletes the index used for committed filtering (CF) support from the database on start up and then exits."`
 	DropTxIndex          bool          `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits."`
+	DustRelayFee         float64       `long:"dustrelayfee" description:"The fee rate in BTC/kB used to determine whether a transaction output is dust -- 0 to use minrelaytxfee"`
+	ExportBlocks         string        `long:"exportblocks" description:"Append the blocks connected to the main chain to the specified file in the bootstrap format read by addblock"`
 	ExternalIPs          []string      `long:"externalip" description:"Add an ip to the list of local addresses we claim to listen on to peers"`
 	Generate             bool          `long:"generate" description:"Generate (mine) bitcoins using the CPU"`
+	GetDataPipeline      int           `long:"getdatapipeline" description:"Max number of getdata messages for announced blocks outstanding to a peer at once -- Blocks are then requested in batches and processed in the order they were requested.  0 to request all announced blocks in a single message"`
 	FreeTxRelayLimit     float64       `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
 	Listeners            []string      `long:"listen" description:"Add an interface/port to listen for connections (default all interfaces port: 8333, testnet: 18333)"`
+	LogAcceptedBlocks    bool          `long:"logacceptedblocks" description:"Log the hash and height of each block connected to or disconnected from the main chain at the debug level"`
 	LogDir               string        `long:"logdir" description:"Directory to log output."`
 	MaxOrphanTxs         int           `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
+	MaxSideChainBlocks   int           `long:"maxsidechainblocks" description:"Max number of recently accepted side chain blocks to track and relay"`
 	MaxPeers             int           `long:"maxpeers" description:"Max number of inbound and outbound peers"`
+	MaxStandardTxWeight  int64         `long:"maxstandardtxweight" description:"Max weight of a transaction that is relayed and accepted into the mempool as standard -- 0 to use the default of 400000"`
+	MaxSyncCandidates    int           `long:"maxsynccandidates" description:"Max number of peers considered when choosing a peer to sync the chain from"`
+	MaxTipRelayDelay     time.Duration `long:"maxtiprelaydelay" description:"Max time the relay of a new main chain tip may be delayed by later tips when tiprelaydelay is set -- Valid time units are {s, ms}.  0 to use tiprelaydelay"`
 	MiningAddrs          []string      `long:"miningaddr" description:"Add the specified payment address to the list of addresses to use for generated blocks -- At least one address is required if the generate option is set"`
 	MinRelayTxFee        float64       `long:"minrelaytxfee" description:"The minimum transaction fee in BTC/kB to be considered a non-zero fee."`
 	DisableBanning       bool          `long:"nobanning" description:"Disable banning of misbehaving peers"`
 	NoCFilters           bool          `long:"nocfilters" description:"Disable committed filtering (CF) support"`
 	DisableCheckpoints   bool          `long:"nocheckpoints" description:"Disable built-in checkpoints.  Don't do this unless you know what you're doing."`
+	NoGenesisInit        bool          `long:"nogenesisinit" description:"Do not initialize a new block database with the genesis block -- The database must be initialized externally, such as by restoring a snapshot"`
 	DisableDNSSeed       bool          `long:"nodnsseed" description:"Disable DNS seeding for peers"`
 	DisableListen        bool          `long:"nolisten" description:"Disable listening for incoming connections -- NOTE: Listening is automatically disabled if the --connect or --proxy options are used without also specifying listen interfaces via --listen"`
 	NoOnion              bool          `long:"noonion" description:"Disable connecting to tor hidden services"`
@@ -139,17 +158,23 @@ type config struct {
 	DisableRPC           bool          `long:"norpc" description:"Disable built-in RPC server -- NOTE: The RPC server is disabled by default if no rpcuser/rpcpass or rpclimituser/rpclimitpass is specified"`
 	DisableStallHandler  bool          `long:"nostalldetect" description:"Disables the stall handler system for each peer, useful in simnet/regtest integration tests frameworks"`
 	DisableTLS           bool          `long:"notls" description:"Disable TLS for the RPC server -- NOTE: This is only allowed if the RPC server is bound to localhost"`
+	NoVerify             bool          `long:"noverify" description:"Do not verify the scripts of blocks received from peers to speed up building large test chains -- Only allowed on regtest and simnet"`
 	OnionProxy           string        `long:"onion" description:"Connect to tor hidden services via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
 	OnionProxyPass       string        `long:"onionpass" default-mask:"-" description:"Password for onion proxy server"`
 	OnionProxyUser       string        `long:"onionuser" description:"Username for onion proxy server"`
+	PersistOrphans       bool          `long:"persistorphans" description:"Keep orphan blocks on disk so they are reconsidered after a restart instead of being downloaded again"`
 	Profile              string        `long:"profile" description:"Enable HTTP profiling on given port -- NOTE port must be between 1024 and 65536"`
 	Proxy                string        `long:"proxy" description:"Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
 	ProxyPass            string        `long:"proxypass" default-mask:"-" description:"Password for proxy server"`
 	ProxyUser            string        `long:"proxyuser" description:"Username for proxy server"`
+	QuickVerify          int           `long:"quickverify" description:"Verify the last N blocks of the main chain on start up to detect recent database corruption without a full rescan -- 0 to disable"`
+	QuietRejectReasons   []string      `long:"quietrejectreasons" description:"Do not log transactions rejected from peers for the given reason -- May be specified multiple times.  Valid reasons: invalid, doublespend, nonstandard, insufficientfee, missinginputs, duplicate"`
 	RegressionTest       bool          `long:"regtest" description:"Use the regression test network"`
 	RejectNonStd         bool          `long:"rejectnonstd" description:"Reject non-standard transactions regardless of the default settings for the active network."`
+	RelayMainChainOnly   bool          `long:"relaymainchainonly" description:"Only relay blocks that advance the main chain tip rather than also relaying side chain blocks"`
 	RejectReplacement    bool          `long:"rejectreplacement" description:"Reject transactions that attempt to replace existing transactions within the mempool through the Replace-By-Fee (RBF) signaling policy."`
 	RelayNonStd          bool          `long:"relaynonstd" description:"Relay non-standard transactions regardless of the default settings for the active network."`
+	RelayWhileSyncing    bool          `long:"relaywhilesyncing" description:"Relay accepted blocks while catching up with the network rather than only once the chain is current"`
 	RPCCert              string        `long:"rpccert" description:"File containing the certificate file"`
 	RPCKey               string        `long:"rpckey" description:"File containing the certificate key"`
 	RPCLimitPass         string        `long:"rpclimitpass" default-mask:"-" description:"Password for limited RPC connections"`
@@ -161,15 +186,19 @@ type config struct {
 	RPCQuirks            bool          `long:"rpcquirks" description:"Mirror some JSON-RPC quirks of Bitcoin Core -- NOTE: Discouraged unless interoperability issues need to be worked around"`
 	RPCPass              string        `short:"P" long:"rpcpass" default-mask:"-" description:"Password for RPC connections"`
 	RPCUser              string        `short:"u" long:"rpcuser" description:"Username for RPC connections"`
+	ScriptWorkers        int           `long:"scriptworkers" description:"Max number of goroutines used to validate the scripts of a block in parallel -- 0 uses three per processor core"`
 	SigCacheMaxSize      uint          `long:"sigcachemaxsize" description:"The maximum number of entries in the signature verification cache"`
 	SimNet               bool          `long:"simnet" description:"Use the simulation test network"`
 	SigNet               bool          `long:"signet" description:"Use the signet test network"`
 	SigNetChallenge      string        `long:"signetchallenge" description:"Connect to a custom signet network defined by this challenge instead of using the global default signet test network -- Can be specified multiple times"`
 	SigNetSeedNode       []string      `long:"signetseednode" description:"Specify a seed node for the signet network instead of using the global default signet network seed nodes"`
+	StdScriptClasses     []string      `long:"standardscriptclass" description:"Only treat transaction outputs of the given script class as standard -- May be specified multiple times to allow several classes.  Valid classes: pubkey, pubkeyhash, witness_v0_keyhash, scripthash, witness_v0_scripthash, witness_v1_taproot, multisig, nulldata, witness_unknown"`
 	TestNet3             bool          `long:"testnet" description:"Use the test network"`
+	TipRelayDelay        time.Duration `long:"tiprelaydelay" description:"Time to wait before relaying a new main chain tip so that tips accepted in quick succession are coalesced and only the latest is relayed -- Valid time units are {s, ms}.  0 to relay every tip right away"`
 	TorIsolation         bool          `long:"torisolation" description:"Enable Tor stream isolation by randomizing user credentials for each connection."`
 	TrickleInterval      time.Duration `long:"trickleinterval" description:"Minimum time between attempts to send new inventory to a connected peer"`
 	TxIndex              bool          `long:"txindex" description:"Maintain a full hash-based transaction index which makes all transactions available via the getrawtransaction RPC"`
+	TxRelayDelay         time.Duration `long:"txrelaydelay" description:"Time to wait after accepting transactions before announcing them so they are not announced back to peers that advertise them in the meantime -- Valid time units are {s, ms}.  0 to announce transactions right away"`
 	UserAgentComments    []string      `long:"uacomment" description:"Comment to add to the user agent -- See BIP 14 for more information."`
 	Upnp                 bool          `long:"upnp" description:"Use UPnP to map our listening port outside of NAT"`
 	ShowVersion          bool          `short:"V" long:"version" description:"Display version information and exit"`
@@ -178,8 +207,12 @@ type config struct {
 	oniondial            func(string, string, time.Duration) (net.Conn, error)
 	dial                 func(string, string, time.Duration) (net.Conn, error)
 	addCheckpoints       []chaincfg.Checkpoint
+	assumeValid          *chainhash.Hash
 	miningAddrs          []btcutil.Address
+	quietRejectReasons   []netsync.TxRejectReason
 	minRelayTxFee        btcutil.Amount
+	dustRelayFee         btcutil.Amount
+	stdScriptClasses     []txscript.ScriptClass
 	whitelists           []*net.IPNet
 }
 
@@ -417,6 +450,7 @@ func loadConfig() (*config, []string, error) {
 		ConfigFile:           defaultConfigFile,
 		DebugLevel:           defaultLogLevel,
 		MaxPeers:             defaultMaxPeers,
+		MaxSyncCandidates:    netsync.DefaultMaxSyncCandidates,
 		BanDuration:          defaultBanDuration,
 		BanThreshold:         defaultBanThreshold,
 		RPCMaxClients:        defaultMaxRPCClients,
@@ -430,12 +464,14 @@ func loadConfig() (*config, []string, error) {
 		MinRelayTxFee:        mempool.DefaultMinRelayTxFee.ToBTC(),
 		FreeTxRelayLimit:     defaultFreeTxRelayLimit,
 		TrickleInterval:      defaultTrickleInterval,
+		BlockDownloadWindow:  netsync.DefaultBlockDownloadWindow,
 		BlockMinSize:         defaultBlockMinSize,
 		BlockMaxSize:         defaultBlockMaxSize,
 		BlockMinWeight:       defaultBlockMinWeight,
 		BlockMaxWeight:       defaultBlockMaxWeight,
 		BlockPrioritySize:    mempool.DefaultBlockPrioritySize,
 		MaxOrphanTxs:         defaultMaxOrphanTransactions,
+		MaxSideChainBlocks:   blockchain.DefaultMaxSideChainBlocks,
 		SigCacheMaxSize:      defaultSigCacheMaxSize,
 		Generate:             defaultGenerate,
 		TxIndex:              defaultTxIndex,
@@ -616,6 +652,17 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Blocks whose scripts were skipped could become the tip of a public
+	// chain, so only allow verification to be disabled on local test
+	// networks.
+	if cfg.NoVerify && !activeNetParams.allowNoVerify {
+		str := "%s: script verification cannot be disabled on %s"
+		err := fmt.Errorf(str, funcName, activeNetParams.Name)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Set the default policy for relaying non-standard transactions
 	// according to the default of the active network. The set
 	// configuration value takes precedence over the default value for the
@@ -650,6 +697,10 @@ func loadConfig() (*config, []string, error) {
 	cfg.LogDir = cleanAndExpandPath(cfg.LogDir)
 	cfg.LogDir = filepath.Join(cfg.LogDir, netName(activeNetParams))
 
+	if cfg.ExportBlocks != "" {
+		cfg.ExportBlocks = cleanAndExpandPath(cfg.ExportBlocks)
+	}
+
 	// Special show command to list supported subsystems and exit.
 	if cfg.DebugLevel == "show" {
 		fmt.Println("Supported subsystems", supportedSubsystems())
@@ -823,6 +874,32 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Validate the dustrelayfee.
+	cfg.dustRelayFee, err = btcutil.NewAmount(cfg.DustRelayFee)
+	if err == nil && cfg.dustRelayFee < 0 {
+		err = fmt.Errorf("fee rate may not be negative")
+	}
+	if err != nil {
+		str := "%s: invalid dustrelayfee: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Limit the max standard transaction weight to a sane value.
+	if cfg.MaxStandardTxWeight < 0 ||
+		cfg.MaxStandardTxWeight > blockchain.MaxBlockWeight {
+
+		str := "%s: The maxstandardtxweight option must be in between " +
+			"0 and %d -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, blockchain.MaxBlockWeight,
+			cfg.MaxStandardTxWeight)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Limit the max block size to a sane value.
 	if cfg.BlockMaxSize < blockMaxSizeMin || cfg.BlockMaxSize >
 		blockMaxSizeMax {
@@ -849,6 +926,104 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Ensure the checkpoint quorum is not negative.
+	if cfg.CheckpointQuorum < 0 {
+		str := "%s: The checkpointquorum option may not be less " +
+			"than 0 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.CheckpointQuorum)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Ensure the database max flush hold is not negative.
+	if cfg.DbMaxFlushHold < 0 {
+		str := "%s: The dbmaxflushhold option may not be less " +
+			"than 0 -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.DbMaxFlushHold)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Ensure the database compaction interval is not negative.
+	if cfg.DbCompactInterval < 0 {
+		str := "%s: The dbcompactinterval option may not be less " +
+			"than 0 -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.DbCompactInterval)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Limit the block download window to a sane value.
+	if cfg.BlockDownloadWindow < 1 {
+		str := "%s: The blockdownloadwindow option may not be less " +
+			"than 1 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.BlockDownloadWindow)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Ensure the tip relay delays are not negative.
+	if cfg.TipRelayDelay < 0 {
+		str := "%s: The tiprelaydelay option may not be less " +
+			"than 0 -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.TipRelayDelay)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.MaxTipRelayDelay < 0 {
+		str := "%s: The maxtiprelaydelay option may not be less " +
+			"than 0 -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.MaxTipRelayDelay)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Ensure the transaction relay delay is not negative.
+	if cfg.TxRelayDelay < 0 {
+		str := "%s: The txrelaydelay option may not be less " +
+			"than 0 -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.TxRelayDelay)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Ensure the number of blocks to verify on start up is not negative.
+	if cfg.QuickVerify < 0 {
+		str := "%s: The quickverify option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.QuickVerify)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Ensure the getdata pipeline depth is not negative.
+	if cfg.GetDataPipeline < 0 {
+		str := "%s: The getdatapipeline option may not be less " +
+			"than 0 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.GetDataPipeline)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Limit the max sync candidates to a sane value.
+	if cfg.MaxSyncCandidates < 1 {
+		str := "%s: The maxsynccandidates option may not be less " +
+			"than 1 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxSyncCandidates)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Limit the max orphan count to a sane vlue.
 	if cfg.MaxOrphanTxs < 0 {
 		str := "%s: The maxorphantx option may not be less than 0 " +
@@ -859,6 +1034,26 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// The number of script validation workers may not be negative.
+	if cfg.ScriptWorkers < 0 {
+		str := "%s: The scriptworkers option may not be less " +
+			"than 0 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.ScriptWorkers)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Limit the max side chain block count to a sane value.
+	if cfg.MaxSideChainBlocks < 0 {
+		str := "%s: The maxsidechainblocks option may not be less " +
+			"than 0 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxSideChainBlocks)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Limit the block priority and minimum block sizes to max block size.
 	cfg.BlockPrioritySize = minUint32(cfg.BlockPrioritySize, cfg.BlockMaxSize)
 	cfg.BlockMinSize = minUint32(cfg.BlockMinSize, cfg.BlockMaxSize)
@@ -946,6 +1141,41 @@ func loadConfig() (*config, []string, error) {
 		cfg.miningAddrs = append(cfg.miningAddrs, addr)
 	}
 
+	// Check the quiet reject reasons are valid and save parsed versions.
+	cfg.quietRejectReasons = make([]netsync.TxRejectReason, 0,
+		len(cfg.QuietRejectReasons))
+	for _, name := range cfg.QuietRejectReasons {
+		reason, err := netsync.ParseTxRejectReason(name)
+		if err != nil {
+			str := "%s: The quietrejectreasons option is invalid: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.quietRejectReasons = append(cfg.quietRejectReasons, reason)
+	}
+
+	// Check the standard script classes are valid and save parsed versions.
+	// Non-standard outputs are never standard, so the class may not be
+	// used to widen the accepted set.
+	cfg.stdScriptClasses = make([]txscript.ScriptClass, 0,
+		len(cfg.StdScriptClasses))
+	for _, name := range cfg.StdScriptClasses {
+		class, err := txscript.NewScriptClass(name)
+		if err == nil && *class == txscript.NonStandardTy {
+			err = fmt.Errorf("script class %s is not standard", name)
+		}
+		if err != nil {
+			str := "%s: The standardscriptclass option is invalid: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.stdScriptClasses = append(cfg.stdScriptClasses, *class)
+	}
+
 	// Ensure there is at least one mining address when the generate flag is
 	// set.
 	if cfg.Generate && len(cfg.MiningAddrs) == 0 {
@@ -1023,6 +1253,18 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Parse the assumed valid block hash.
+	if cfg.AssumeValid != "" {
+		cfg.assumeValid, err = chainhash.NewHashFromStr(cfg.AssumeValid)
+		if err != nil {
+			str := "%s: Error parsing assumevalid hash: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// Tor stream isolation requires either proxy or onion proxy to be set.
 	if cfg.TorIsolation && cfg.Proxy == "" && cfg.OnionProxy == "" {
 		str := "%s: Tor stream isolation requires either proxy or " +
@@ -0,0 +1,180 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// banListVersion is the version of the serialized ban list.
+const banListVersion = 1
+
+// BannedHost describes a banned host and when its ban expires.
+type BannedHost struct {
+	Host  string
+	Until time.Time
+}
+
+// serializedBan is the form in which a ban is stored in the ban list file.
+type serializedBan struct {
+	Host  string `json:"host"`
+	Until int64  `json:"until"`
+}
+
+// serializedBanList is the form in which the ban list file is stored.
+type serializedBanList struct {
+	Version int             `json:"version"`
+	Bans    []serializedBan `json:"bans"`
+}
+
+// BanList tracks banned hosts along with when their bans expire.  The bans
+// are saved to a file whenever they change so they survive restarts, which
+// keeps persistent attackers from simply reconnecting after a restart.  Bans
+// are only kept in memory when no file is given.
+//
+// A BanList is safe for concurrent access.
+type BanList struct {
+	mtx  sync.Mutex
+	path string
+	bans map[string]time.Time
+}
+
+// NewBanList returns a ban list that is saved to the file at the passed path
+// with the unexpired bans the file already contains loaded.  A missing file
+// results in an empty ban list and an error is returned when the file can't
+// be read.
+func NewBanList(path string) (*BanList, error) {
+	b := &BanList{
+		path: path,
+		bans: make(map[string]time.Time),
+	}
+	if path == "" {
+		return b, nil
+	}
+
+	serialized, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sbl serializedBanList
+	if err := json.Unmarshal(serialized, &sbl); err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	if sbl.Version > banListVersion {
+		return nil, fmt.Errorf("unknown version %v in ban list %s",
+			sbl.Version, path)
+	}
+
+	now := time.Now()
+	for _, ban := range sbl.Bans {
+		until := time.Unix(ban.Until, 0)
+		if !now.Before(until) {
+			continue
+		}
+		b.bans[ban.Host] = until
+	}
+	log.Infof("Loaded %d bans from file '%s'", len(b.bans), path)
+	return b, nil
+}
+
+// save writes the ban list to its file.
+//
+// This function MUST be called with the ban list lock held.
+func (b *BanList) save() error {
+	if b.path == "" {
+		return nil
+	}
+
+	sbl := serializedBanList{
+		Version: banListVersion,
+		Bans:    make([]serializedBan, 0, len(b.bans)),
+	}
+	for host, until := range b.bans {
+		sbl.Bans = append(sbl.Bans, serializedBan{
+			Host:  host,
+			Until: until.Unix(),
+		})
+	}
+	serialized, err := json.Marshal(&sbl)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash while saving doesn't
+	// lose the bans already saved.
+	tmpPath := b.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, serialized, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, b.path)
+}
+
+// Ban bans the passed host until the passed time and saves the ban list.
+func (b *BanList) Ban(host string, until time.Time) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.bans[host] = until
+	return b.save()
+}
+
+// IsBanned returns whether the passed host is banned along with when its ban
+// expires.  Expired bans are removed.
+func (b *BanList) IsBanned(host string) (time.Time, bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	until, ok := b.bans[host]
+	if !ok {
+		return time.Time{}, false
+	}
+	if time.Now().Before(until) {
+		return until, true
+	}
+
+	log.Infof("Peer %s is no longer banned", host)
+	delete(b.bans, host)
+	if err := b.save(); err != nil {
+		log.Errorf("Unable to save ban list %s: %v", b.path, err)
+	}
+	return time.Time{}, false
+}
+
+// ListBans returns the hosts that are currently banned sorted by host.
+func (b *BanList) ListBans() []BannedHost {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	now := time.Now()
+	bans := make([]BannedHost, 0, len(b.bans))
+	for host, until := range b.bans {
+		if !now.Before(until) {
+			continue
+		}
+		bans = append(bans, BannedHost{Host: host, Until: until})
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Host < bans[j].Host
+	})
+	return bans
+}
+
+// ClearBans removes all bans and saves the ban list.
+func (b *BanList) ClearBans() error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.bans = make(map[string]time.Time)
+	return b.save()
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestBanListPersistence ensures bans survive a restart by reloading the ban
+// list from its file, that expired bans are dropped and that cleared bans stay
+// cleared.
+func TestBanListPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "banlist.json")
+	bans, err := NewBanList(path)
+	if err != nil {
+		t.Fatalf("unable to create ban list: %v", err)
+	}
+	if len(bans.ListBans()) != 0 {
+		t.Fatalf("new ban list has bans %v", bans.ListBans())
+	}
+
+	// Ban two hosts, one of which has a ban that already expired.
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := bans.Ban("10.0.0.1", until); err != nil {
+		t.Fatalf("unable to ban host: %v", err)
+	}
+	if err := bans.Ban("10.0.0.2", time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("unable to ban host: %v", err)
+	}
+	if _, ok := bans.IsBanned("10.0.0.3"); ok {
+		t.Fatal("host that was never banned is banned")
+	}
+
+	// Simulate a restart by loading the ban list from the file again.
+	bans, err = NewBanList(path)
+	if err != nil {
+		t.Fatalf("unable to load ban list: %v", err)
+	}
+	got, ok := bans.IsBanned("10.0.0.1")
+	if !ok || !got.Equal(until) {
+		t.Fatalf("host banned until %v (%v), want %v", got, ok, until)
+	}
+	if _, ok := bans.IsBanned("10.0.0.2"); ok {
+		t.Fatal("host with expired ban is banned")
+	}
+	list := bans.ListBans()
+	if len(list) != 1 || list[0].Host != "10.0.0.1" ||
+		!list[0].Until.Equal(until) {
+
+		t.Fatalf("unexpected bans %v", list)
+	}
+
+	if err := bans.ClearBans(); err != nil {
+		t.Fatalf("unable to clear bans: %v", err)
+	}
+	bans, err = NewBanList(path)
+	if err != nil {
+		t.Fatalf("unable to load ban list: %v", err)
+	}
+	if len(bans.ListBans()) != 0 {
+		t.Fatalf("cleared ban list has bans %v", bans.ListBans())
+	}
+
+	// A malformed file is reported.
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatalf("unable to write ban list: %v", err)
+	}
+	if _, err := NewBanList(path); err == nil {
+		t.Fatal("loaded malformed ban list")
+	}
+}
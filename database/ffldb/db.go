@@ -8,11 +8,13 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -37,6 +39,17 @@ const (
 	// wire.MaxBlockHeaderPayload is quite long.
 	blockHdrSize = wire.MaxBlockHeaderPayload
 
+	// DefaultHeldFlushRetries is the default number of times a failed
+	// write of the metadata held in the cache is retried before the flush
+	// is treated as failed.  Failures to sync the block files are never
+	// retried.
+	DefaultHeldFlushRetries = 3
+
+	// DefaultHeldFlushRetryDelay is the default delay before the first
+	// retry of a failed write of the metadata held in the cache.  The
+	// delay is doubled for each subsequent retry.
+	DefaultHeldFlushRetryDelay = 500 * time.Millisecond
+
 	// blockHdrOffset defines the offsets into a block index row for the
 	// block header.
 	//
@@ -1666,7 +1679,14 @@ func (tx *transaction) writePendingAndCommit() error {
 
 	// Atomically update the database cache.  The cache automatically
 	// handles flushing to the underlying persistent storage database.
-	return tx.db.cache.commitTx(tx)
+	if err := tx.db.cache.commitTx(tx); err != nil {
+		return err
+	}
+
+	// Ensure the data held in the cache is flushed once it has been held
+	// for the maximum duration.
+	tx.db.scheduleHeldFlush()
+	return nil
 }
 
 // Commit commits all changes that have been made to the root metadata bucket
@@ -1732,10 +1752,25 @@ type db struct {
 	closed    bool         // Is the database closed?
 	store     *blockStore  // Handles read/writing blocks to flat files.
 	cache     *dbCache     // Cache layer which wraps underlying leveldb DB.
+
+	// The following fields are related to flushing data that has been held
+	// in the cache for the maximum duration.  They are protected by the
+	// hold mutex.
+	holdMtx         sync.Mutex
+	maxHold         time.Duration
+	holdTimer       *time.Timer
+	flushRetries    int
+	flushRetryDelay time.Duration
+	flushFailed     func(error)
 }
 
-// Enforce db implements the database.DB interface.
-var _ database.DB = (*db)(nil)
+// Enforce db implements the database.DB, database.Compactor, and
+// database.FlushHolder interfaces.
+var (
+	_ database.DB          = (*db)(nil)
+	_ database.Compactor   = (*db)(nil)
+	_ database.FlushHolder = (*db)(nil)
+)
 
 // Type returns the database driver type the current database instance was
 // created with.
@@ -1898,6 +1933,182 @@ func (db *db) Update(fn func(database.Tx) error) error {
 	return tx.Commit()
 }
 
+// Compact flushes the database cache and compacts the underlying leveldb
+// database to reclaim the space occupied by deleted and overwritten metadata.
+// It returns the change in the size of the metadata on disk.  Write
+// transactions block until the compaction completes.
+//
+// This function is part of the database.Compactor interface implementation.
+func (db *db) Compact() (int64, error) {
+	// Quiesce writes for the duration of the compaction.  The write lock
+	// is taken before the close lock in the same order as write
+	// transactions so a compaction can't deadlock with a writer waiting
+	// behind a pending close.
+	db.writeLock.Lock()
+	defer db.writeLock.Unlock()
+	db.closeLock.RLock()
+	defer db.closeLock.RUnlock()
+
+	if db.closed {
+		return 0, makeDbErr(database.ErrDbNotOpen, errDbNotOpenStr, nil)
+	}
+
+	// Flush the cache so all metadata is in leveldb.
+	if err := db.cache.flush(); err != nil {
+		return 0, err
+	}
+
+	metadataDbPath := filepath.Join(db.store.basePath, metadataDbName)
+	sizeBefore, err := dirSize(metadataDbPath)
+	if err != nil {
+		return 0, err
+	}
+	if err := db.cache.ldb.CompactRange(util.Range{}); err != nil {
+		str := "failed to compact underlying leveldb database"
+		return 0, convertErr(str, err)
+	}
+	sizeAfter, err := dirSize(metadataDbPath)
+	if err != nil {
+		return 0, err
+	}
+	return sizeBefore - sizeAfter, nil
+}
+
+// SetMaxFlushHold sets the maximum duration committed data is held in the
+// database cache before it is flushed to persistent storage, even when no
+// further transactions are committed to trigger a flush.  A duration of zero
+// removes the limit.
+//
+// This function is part of the database.FlushHolder interface implementation.
+func (db *db) SetMaxFlushHold(maxHold time.Duration) {
+	db.holdMtx.Lock()
+	db.maxHold = maxHold
+	db.holdMtx.Unlock()
+}
+
+// SetHeldFlushRetry sets the number of times a failed write of the metadata
+// held in the cache is retried and the delay before the first retry, which is
+// doubled for each subsequent retry.
+//
+// This function is part of the database.FlushHolder interface implementation.
+func (db *db) SetHeldFlushRetry(retries int, delay time.Duration) {
+	db.holdMtx.Lock()
+	db.flushRetries = retries
+	db.flushRetryDelay = delay
+	db.holdMtx.Unlock()
+}
+
+// SetHeldFlushFailureHandler sets the function that is called with the error
+// when the data held in the cache can't be flushed.
+//
+// This function is part of the database.FlushHolder interface implementation.
+func (db *db) SetHeldFlushFailureHandler(handler func(error)) {
+	db.holdMtx.Lock()
+	db.flushFailed = handler
+	db.holdMtx.Unlock()
+}
+
+// scheduleHeldFlush starts the timer that flushes the data held in the cache
+// once it has been held for the maximum duration unless the timer is already
+// running or there is nothing held.
+//
+// This function MUST be called with the database write lock held.
+func (db *db) scheduleHeldFlush() {
+	if !db.cache.hasPending() {
+		return
+	}
+
+	db.holdMtx.Lock()
+	defer db.holdMtx.Unlock()
+	if db.maxHold <= 0 || db.holdTimer != nil {
+		return
+	}
+	db.holdTimer = time.AfterFunc(db.maxHold, func() { db.flushHeld(0) })
+}
+
+// flushHeld flushes the data held in the cache to persistent storage.  It is
+// invoked by the hold timer with the number of previous failed attempts.
+//
+// A failure to sync the block files is not retried since the state of data
+// that failed to sync is unknown and a later sync may report success without
+// it having been written.  A failure to write the metadata is retried with an
+// exponential backoff up to the configured number of retries.  Either way, a
+// flush that ultimately fails is reported to the failure handler, which is
+// expected to shut down the database.
+func (db *db) flushHeld(attempt int) {
+	// Acquire the locks in the same order as transactions.
+	db.writeLock.Lock()
+	defer db.writeLock.Unlock()
+	db.closeLock.RLock()
+	defer db.closeLock.RUnlock()
+
+	db.holdMtx.Lock()
+	db.holdTimer = nil
+	retries, retryDelay := db.flushRetries, db.flushRetryDelay
+	db.holdMtx.Unlock()
+
+	// Closing the database flushes the cache.
+	if db.closed {
+		return
+	}
+	if attempt == 0 {
+		if err := db.store.syncBlocks(); err != nil {
+			db.heldFlushFailed(err)
+			return
+		}
+	}
+	err := db.cache.flushMetadata()
+	if err == nil {
+		if attempt > 0 {
+			log.Infof("Flushed held database cache after %d "+
+				"retries", attempt)
+		}
+		return
+	}
+	if attempt >= retries {
+		db.heldFlushFailed(err)
+		return
+	}
+
+	delay := retryDelay << uint(attempt)
+	log.Warnf("Failed to flush held database cache: %v -- retrying in %v",
+		err, delay)
+	db.holdMtx.Lock()
+	db.holdTimer = time.AfterFunc(delay, func() {
+		db.flushHeld(attempt + 1)
+	})
+	db.holdMtx.Unlock()
+}
+
+// heldFlushFailed logs the passed error that caused a flush of the data held in
+// the cache to fail and reports it to the failure handler, if any.
+func (db *db) heldFlushFailed(err error) {
+	log.Criticalf("Failed to flush held database cache: %v", err)
+
+	db.holdMtx.Lock()
+	handler := db.flushFailed
+	db.holdMtx.Unlock()
+	if handler != nil {
+		handler(err)
+	}
+}
+
+// dirSize returns the total size of the files in the passed directory.
+func dirSize(path string) (int64, error) {
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		str := fmt.Sprintf("failed to read directory %q", path)
+		return 0, makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+	var size int64
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() {
+			size += entry.Size()
+		}
+	}
+	return size, nil
+}
+
 // Close cleanly shuts down the database and syncs all data.  It will block
 // until all database transactions have been finalized (rolled back or
 // committed).
@@ -1914,6 +2125,14 @@ func (db *db) Close() error {
 	}
 	db.closed = true
 
+	// The cache is flushed below, so there is no need to flush held data.
+	db.holdMtx.Lock()
+	if db.holdTimer != nil {
+		db.holdTimer.Stop()
+		db.holdTimer = nil
+	}
+	db.holdMtx.Unlock()
+
 	// NOTE: Since the above lock waits for all transactions to finish and
 	// prevents any new ones from being started, it is safe to flush the
 	// cache and clear all state without the individual locks.
@@ -2018,7 +2237,12 @@ func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, e
 	// write caching.
 	store := newBlockStore(dbPath, network)
 	cache := newDbCache(ldb, store, defaultCacheSize, defaultFlushSecs)
-	pdb := &db{store: store, cache: cache}
+	pdb := &db{
+		store:           store,
+		cache:           cache,
+		flushRetries:    DefaultHeldFlushRetries,
+		flushRetryDelay: DefaultHeldFlushRetryDelay,
+	}
 
 	// Perform any reconciliation needed between the block and metadata as
 	// well as database initialization, if needed.
@@ -486,8 +486,6 @@ func (c *dbCache) commitTreaps(pendingKeys, pendingRemove TreapForEacher) error
 //
 // This function MUST be called with the database write lock held.
 func (c *dbCache) flush() error {
-	c.lastFlush = time.Now()
-
 	// Sync the current write file associated with the block store.  This is
 	// necessary before writing the metadata to prevent the case where the
 	// metadata contains information about a block which actually hasn't
@@ -496,6 +494,17 @@ func (c *dbCache) flush() error {
 		return err
 	}
 
+	return c.flushMetadata()
+}
+
+// flushMetadata writes all of the cached metadata to the underlying database
+// without syncing the block files first.  The caller is responsible for
+// syncing the block files before calling it.
+//
+// This function MUST be called with the database write lock held.
+func (c *dbCache) flushMetadata() error {
+	c.lastFlush = time.Now()
+
 	// Since the cached keys to be added and removed use an immutable treap,
 	// a snapshot is simply obtaining the root of the tree under the lock
 	// which is used to atomically swap the root.
@@ -523,6 +532,14 @@ func (c *dbCache) flush() error {
 	return nil
 }
 
+// hasPending returns whether the cache holds entries that have not been flushed
+// to the underlying database yet.
+func (c *dbCache) hasPending() bool {
+	c.cacheLock.RLock()
+	defer c.cacheLock.RUnlock()
+	return c.cachedKeys.Len() != 0 || c.cachedRemove.Len() != 0
+}
+
 // needsFlush returns whether or not the database cache needs to be flushed to
 // persistent storage based on its current size, whether or not adding all of
 // the entries in the passed database transaction would cause it to exceed the
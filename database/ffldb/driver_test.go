@@ -284,3 +284,86 @@ func TestInterface(t *testing.T) {
 		testInterface(t, db)
 	})
 }
+
+// TestCompact ensures the database can be compacted after data is deleted
+// without losing the remaining data and that compacting a closed database
+// fails.
+func TestCompact(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "ffldb-compacttest")
+	db, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Failed to create test database (%s) %v", dbType, err)
+	}
+	compactor, ok := db.(database.Compactor)
+	if !ok {
+		db.Close()
+		t.Fatalf("%s database does not implement database.Compactor",
+			dbType)
+	}
+
+	// Write a number of values and then delete all but one of them.
+	const numValues = 1000
+	value := make([]byte, 1024)
+	bucketKey := []byte("compact")
+	keepKey := []byte("key0")
+	err = db.Update(func(tx database.Tx) error {
+		bucket, err := tx.Metadata().CreateBucket(bucketKey)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < numValues; i++ {
+			key := []byte(fmt.Sprintf("key%d", i))
+			if err := bucket.Put(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+	err = db.Update(func(tx database.Tx) error {
+		bucket := tx.Metadata().Bucket(bucketKey)
+		for i := 1; i < numValues; i++ {
+			key := []byte(fmt.Sprintf("key%d", i))
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+
+	if _, err := compactor.Compact(); err != nil {
+		db.Close()
+		t.Fatalf("Compact: unexpected error: %v", err)
+	}
+	err = db.View(func(tx database.Tx) error {
+		bucket := tx.Metadata().Bucket(bucketKey)
+		if got := bucket.Get(keepKey); !reflect.DeepEqual(got, value) {
+			return fmt.Errorf("Get: value for %s lost by compaction",
+				keepKey)
+		}
+		if bucket.Get([]byte("key1")) != nil {
+			return fmt.Errorf("Get: deleted key restored by " +
+				"compaction")
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+	_, err = compactor.Compact()
+	checkDbError(t, "Compact", err, database.ErrDbNotOpen)
+}
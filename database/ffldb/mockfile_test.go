@@ -34,6 +34,7 @@ type mockFile struct {
 	maxSize      int64
 	data         []byte
 	forceSyncErr bool
+	syncFailures int
 	closed       bool
 }
 
@@ -148,13 +149,21 @@ func (f *mockFile) WriteAt(b []byte, off int64) (int, error) {
 }
 
 // Sync doesn't do anything for mock files.  However, it will return an error if
-// the mock file's forceSyncErr flag is set.
+// the mock file's forceSyncErr flag is set or, to simulate transient failures,
+// while its syncFailures count is nonzero, in which case the count is
+// decremented.
 //
 // This is part of the filer implementation.
 func (f *mockFile) Sync() error {
 	if f.forceSyncErr {
 		return errSyncFail
 	}
+	f.Lock()
+	defer f.Unlock()
+	if f.syncFailures > 0 {
+		f.syncFailures--
+		return errSyncFail
+	}
 
 	return nil
 }
@@ -16,6 +16,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
@@ -704,3 +705,148 @@ func TestFailureScenarios(t *testing.T) {
 	// Test various corruption scenarios.
 	testCorruption(tc)
 }
+
+// TestMaxFlushHold ensures data committed to the database cache is only
+// flushed to the underlying database without further transactions once the
+// maximum hold duration is set and has elapsed.
+func TestMaxFlushHold(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "ffldb-flushholdtest")
+	idb, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Failed to create test database (%s) %v", dbType, err)
+	}
+	defer idb.Close()
+	pdb := idb.(*db)
+
+	// put stores the passed key in the metadata bucket.
+	put := func(key string) {
+		t.Helper()
+
+		err := idb.Update(func(tx database.Tx) error {
+			return tx.Metadata().Put([]byte(key), []byte("value"))
+		})
+		if err != nil {
+			t.Fatalf("Update: unexpected error: %v", err)
+		}
+	}
+
+	// Committed data is held in the cache without a maximum hold duration.
+	put("unlimited")
+	time.Sleep(100 * time.Millisecond)
+	if !pdb.cache.hasPending() {
+		t.Fatal("cache flushed without a maximum hold duration")
+	}
+
+	// Committed data is flushed once it has been held for the maximum
+	// duration.
+	const maxHold = 50 * time.Millisecond
+	idb.(database.FlushHolder).SetMaxFlushHold(maxHold)
+	put("held")
+	deadline := time.Now().Add(5 * time.Second)
+	for pdb.cache.hasPending() {
+		if time.Now().After(deadline) {
+			t.Fatal("cache not flushed after the maximum hold duration")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, key := range []string{"unlimited", "held"} {
+		ldbKey := bucketizedKey(metadataBucketID, []byte(key))
+		if _, err := pdb.cache.ldb.Get(ldbKey, nil); err != nil {
+			t.Fatalf("key %q not flushed: %v", key, err)
+		}
+	}
+}
+
+// TestHeldFlushFailure ensures a held flush that fails to sync the block files
+// is reported without being retried and that one that fails to write the
+// metadata is retried the configured number of times before it is reported.
+func TestHeldFlushFailure(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "ffldb-flushfailuretest")
+	idb, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Failed to create test database (%s) %v", dbType, err)
+	}
+	defer idb.Close()
+	pdb := idb.(*db)
+	failures := make(chan error, 2)
+	holder := idb.(database.FlushHolder)
+	holder.SetHeldFlushRetry(2, 10*time.Millisecond)
+	holder.SetHeldFlushFailureHandler(func(err error) {
+		failures <- err
+	})
+
+	// put stores the passed key in the metadata bucket.
+	put := func(key string) {
+		t.Helper()
+
+		err := idb.Update(func(tx database.Tx) error {
+			return tx.Metadata().Put([]byte(key), []byte("value"))
+		})
+		if err != nil {
+			t.Fatalf("Update: unexpected error: %v", err)
+		}
+	}
+
+	// expectFailure ensures the failure handler is called exactly once and
+	// that no further flush is scheduled.
+	expectFailure := func() {
+		t.Helper()
+
+		select {
+		case <-failures:
+		case <-time.After(5 * time.Second):
+			t.Fatal("flush failure not reported")
+		}
+		time.Sleep(100 * time.Millisecond)
+		select {
+		case err := <-failures:
+			t.Fatalf("flush failure reported again: %v", err)
+		default:
+		}
+		pdb.holdMtx.Lock()
+		pending := pdb.holdTimer != nil
+		pdb.holdMtx.Unlock()
+		if pending {
+			t.Fatal("flush retried after the failure was reported")
+		}
+	}
+
+	// A failure to sync the block files is not retried even though the
+	// next sync would succeed.
+	put("unsynced")
+	pdb.writeLock.Lock()
+	store := pdb.store
+	store.writeCursor.Lock()
+	store.writeCursor.curFile = &lockableFile{
+		file: &mockFile{syncFailures: 1, maxSize: -1},
+	}
+	store.writeCursor.Unlock()
+	pdb.writeLock.Unlock()
+	pdb.flushHeld(0)
+	expectFailure()
+	ldbKey := bucketizedKey(metadataBucketID, []byte("unsynced"))
+	if _, err := pdb.cache.ldb.Get(ldbKey, nil); err == nil {
+		t.Fatal("metadata flushed after the block files failed to sync")
+	}
+	if !pdb.cache.hasPending() {
+		t.Fatal("held data dropped after the block files failed to sync")
+	}
+
+	// A failure to write the metadata is retried before it is reported.
+	if err := pdb.cache.ldb.Close(); err != nil {
+		t.Fatalf("Failed to close leveldb: %v", err)
+	}
+	holder.SetHeldFlushRetry(2, 50*time.Millisecond)
+	pdb.flushHeld(0)
+	pdb.holdMtx.Lock()
+	retrying := pdb.holdTimer != nil
+	pdb.holdMtx.Unlock()
+	if !retrying || len(failures) != 0 {
+		t.Fatal("failed metadata write not retried")
+	}
+	expectFailure()
+}
@@ -8,6 +8,8 @@
 package database
 
 import (
+	"time"
+
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 )
@@ -408,6 +410,40 @@ type Tx interface {
 	Rollback() error
 }
 
+// Compactor is an optional interface implemented by database backends that
+// accumulate dead space from deleted and overwritten data and are able to
+// reclaim it.
+type Compactor interface {
+	// Compact reclaims space occupied by deleted and overwritten data and
+	// returns the approximate number of bytes reclaimed.  Writes are
+	// blocked while the compaction is in progress, which may take a long
+	// time for large databases.
+	Compact() (int64, error)
+}
+
+// FlushHolder is an optional interface implemented by database backends that
+// hold committed data in memory and write it to persistent storage in batches.
+type FlushHolder interface {
+	// SetMaxFlushHold sets the maximum duration committed data is held in
+	// memory before it is written to persistent storage, even when no
+	// further transactions are committed to trigger a write.  Held data is
+	// always written when the database is closed.  A duration of zero
+	// removes the limit.
+	SetMaxFlushHold(maxHold time.Duration)
+
+	// SetHeldFlushRetry sets the number of times a failed write of held
+	// data is retried and the delay before the first retry, which is
+	// doubled for each subsequent retry.  Failures to sync data that was
+	// already written are never retried.
+	SetHeldFlushRetry(retries int, delay time.Duration)
+
+	// SetHeldFlushFailureHandler sets the function that is called with the
+	// error when held data can't be written to persistent storage.  The
+	// data is left in memory, so the handler is expected to shut down the
+	// database.
+	SetHeldFlushFailureHandler(handler func(error))
+}
+
 // DB provides a generic interface that is used to store bitcoin blocks and
 // related metadata.  This interface is intended to be agnostic to the actual
 // mechanism used for backend data storage.  The RegisterDriver function can be
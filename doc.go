@@ -29,11 +29,25 @@ Application Options:
 	    --addrindex             Maintain a full address-based transaction index
 	                            which makes the searchrawtransactions RPC
 	                            available
+	    --assumevalid=          Hash of a block known to be valid -- The scripts
+	                            of the block and its ancestors are not verified
+	                            during the initial block download
+	    --auditutxoset          Rebuild the utxo set by replaying the main chain
+	                            after start up and log any differences from the
+	                            stored utxo set -- This can take many hours and a
+	                            lot of memory
 	    --banduration=          How long to ban misbehaving peers.  Valid time
 	                            units are {s, m, h}.  Minimum 1 second (default:
 	                            24h0m0s)
 	    --banthreshold=         Maximum allowed ban score before disconnecting
 	                            and banning misbehaving peers. (default: 100)
+	    --blockdownloadwindow=  Maximum number of blocks to request from the
+	                            sync peer at once during the initial block
+	                            download -- Higher values improve throughput
+	                            on fast links at the cost of more memory
+	                            (default: 50000)
+	    --blockjournal          Journal accepted blocks to detect blocks lost
+	                            when btcd is not shut down cleanly
 	    --blockmaxsize=         Maximum block size in bytes to be used when
 	                            creating a block (default: 750000)
 	    --blockminsize=         Mininum block size in bytes to be used when
@@ -46,10 +60,23 @@ Application Options:
 	                            transactions when creating a block (default:
 	                            50000)
 	    --blocksonly            Do not accept transactions from remote peers.
+	    --checkpointquorum=     Number of the most recent checkpoints a peer
+	                            must prove it has before it is used to sync the
+	                            chain -- Peers that do not match are
+	                            disconnected
 	-C, --configfile=           Path to configuration file
 	    --connect=              Connect only to the specified peers at startup
 	    --cpuprofile=           Write CPU profile to the specified file
 	-b, --datadir=              Directory to store data
+	    --dbcompactinterval=    Interval at which to compact the block database
+	                            to reclaim space occupied by deleted data if the
+	                            database backend supports it -- Valid time units
+	                            are {s, m, h}.  0 to disable
+	    --dbmaxflushhold=       Max time data committed to the block database is
+	                            held in memory before it is written to disk if
+	                            the database backend batches writes -- Valid
+	                            time units are {s, m, h}.  0 to hold data until
+	                            the next batch is written
 	    --dbtype=               Database backend to use for the Block Chain
 	                            (default: ffldb)
 	-d, --debuglevel=           Logging level for all subsystems {trace, debug,
@@ -59,6 +86,8 @@ Application Options:
 	                            set the log level for individual subsystems --
 	                            Use show to list available subsystems (default:
 	                            info)
+	    --diversesyncpeer       Prefer a peer to sync the chain from whose network
+	                            group is not shared with any other connected peer
 	    --dropaddrindex         Deletes the address-based transaction index from
 	                            the database on start up and then exits.
 	    --dropcfindex           Deletes the index used for committed filtering
@@ -66,20 +95,45 @@ Application Options:
 	                            then exits.
 	    --droptxindex           Deletes the hash-based transaction index from the
 	                            database on start up and then exits.
+	    --dustrelayfee=         The fee rate in BTC/kB used to determine whether
+	                            a transaction output is dust -- 0 to use
+	                            minrelaytxfee
+	    --exportblocks=         Append the blocks connected to the main chain to
+	                            the specified file in the bootstrap format read
+	                            by addblock
 	    --externalip=           Add an ip to the list of local addresses we claim
 	                            to listen on to peers
 	    --generate              Generate (mine) bitcoins using the CPU
+	    --getdatapipeline=      Max number of getdata messages for announced
+	                            blocks outstanding to a peer at once -- Blocks
+	                            are then requested in batches and processed in
+	                            the order they were requested.  0 to request all
+	                            announced blocks in a single message
 	    --limitfreerelay=       Limit relay of transactions with no transaction
 	                            fee to the given amount in thousands of bytes per
 	                            minute (default: 15)
 	    --listen=               Add an interface/port to listen for connections
 	                            (default all interfaces port: 8333, testnet:
 	                            18333, signet: 38333)
+	    --logacceptedblocks     Log the hash and height of each block connected
+	                            to or disconnected from the main chain at the
+	                            debug level
 	    --logdir=               Directory to log output
 	    --maxorphantx=          Max number of orphan transactions to keep in
 	                            memory (default: 100)
+	    --maxsidechainblocks=   Max number of recently accepted side chain blocks
+	                            to track and relay (default: 100)
 	    --maxpeers=             Max number of inbound and outbound peers
 	                            (default: 125)
+	    --maxstandardtxweight=  Max weight of a transaction that is relayed and
+	                            accepted into the mempool as standard -- 0 to use
+	                            the default of 400000
+	    --maxsynccandidates=    Max number of peers considered when choosing a
+	                            peer to sync the chain from (default: 16)
+	    --maxtiprelaydelay=     Max time the relay of a new main chain tip may be
+	                            delayed by later tips when tiprelaydelay is set
+	                            -- Valid time units are {s, ms}.  0 to use
+	                            tiprelaydelay
 	    --miningaddr=           Add the specified payment address to the list of
 	                            addresses to use for generated blocks -- At least
 	                            one address is required if the generate option is
@@ -90,6 +144,10 @@ Application Options:
 	    --nocfilters            Disable committed filtering (CF) support
 	    --nocheckpoints         Disable built-in checkpoints.  Don't do this
 	                            unless you know what you're doing.
+	    --nogenesisinit         Do not initialize a new block database with the
+	                            genesis block -- The database must be
+	                            initialized externally, such as by restoring
+	                            a snapshot
 	    --nodnsseed             Disable DNS seeding for peers
 	    --nolisten              Disable listening for incoming connections --
 	                            NOTE: Listening is automatically disabled if the
@@ -106,20 +164,39 @@ Application Options:
 	    --notls                 Disable TLS for the RPC server -- NOTE: This is
 	                            only allowed if the RPC server is bound to
 	                            localhost
+	    --noverify              Do not verify the scripts of blocks received from
+	                            peers to speed up building large test chains --
+	                            Only allowed on regtest and simnet
 	    --onion=                Connect to tor hidden services via SOCKS5 proxy
 	                            (eg. 127.0.0.1:9050)
 	    --onionpass=            Password for onion proxy server
 	    --onionuser=            Username for onion proxy server
+	    --persistorphans        Keep orphan blocks on disk so they are
+	                            reconsidered after a restart instead of being
+	                            downloaded again
 	    --profile=              Enable HTTP profiling on given port -- NOTE port
 	                            must be between 1024 and 65536
 	    --proxy=                Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)
 	    --proxypass=            Password for proxy server
 	    --proxyuser=            Username for proxy server
+	    --quickverify=          Verify the last N blocks of the main chain on start
+	                            up to detect recent database corruption without a
+	                            full rescan -- 0 to disable
+	    --quietrejectreasons=   Do not log transactions rejected from peers for
+	                            the given reason -- May be specified multiple
+	                            times.  Valid reasons: invalid, doublespend,
+	                            nonstandard, insufficientfee, missinginputs,
+	                            duplicate
 	    --regtest               Use the regression test network
 	    --rejectnonstd          Reject non-standard transactions regardless of
 	                            the default settings for the active network.
+	    --relaymainchainonly    Only relay blocks that advance the main chain tip
+	                            rather than also relaying side chain blocks
 	    --relaynonstd           Relay non-standard transactions regardless of the
 	                            default settings for the active network.
+	    --relaywhilesyncing     Relay accepted blocks while catching up with the
+	                            network rather than only once the chain is
+	                            current
 	    --rpccert=              File containing the certificate file
 	    --rpckey=               File containing the certificate key
 	    --rpclimitpass=         Password for limited RPC connections
@@ -137,10 +214,25 @@ Application Options:
 	                            need to be worked around
 	-P, --rpcpass=              Password for RPC connections
 	-u, --rpcuser=              Username for RPC connections
+	    --scriptworkers=        Max number of goroutines used to validate the
+	                            scripts of a block in parallel -- 0 uses three
+	                            per processor core
 	    --sigcachemaxsize=      The maximum number of entries in the signature
 	                            verification cache (default: 100000)
 	    --simnet                Use the simulation test network
+	    --standardscriptclass=  Only treat transaction outputs of the given script
+	                            class as standard -- May be specified multiple
+	                            times to allow several classes.  Valid classes:
+	                            pubkey, pubkeyhash, witness_v0_keyhash,
+	                            scripthash, witness_v0_scripthash,
+	                            witness_v1_taproot, multisig, nulldata,
+	                            witness_unknown
 	    --testnet               Use the test network
+	    --tiprelaydelay=        Time to wait before relaying a new main chain tip
+	                            so that tips accepted in quick succession are
+	                            coalesced and only the latest is relayed -- Valid
+	                            time units are {s, ms}.  0 to relay every tip
+	                            right away
 	    --torisolation          Enable Tor stream isolation by randomizing user
 	                            credentials for each connection.
 	    --trickleinterval=      Minimum time between attempts to send new
@@ -148,6 +240,11 @@ Application Options:
 	    --txindex               Maintain a full hash-based transaction index
 	                            which makes all transactions available via the
 	                            getrawtransaction RPC
+	    --txrelaydelay=         Time to wait after accepting transactions before
+	                            announcing them so they are not announced back
+	                            to peers that advertise them in the meantime --
+	                            Valid time units are {s, ms}.  0 to announce
+	                            transactions right away
 	    --uacomment=            Comment to add to the user agent -- See BIP 14
 	                            for more information.
 	    --upnp                  Use UPnP to map our listening port outside of NAT
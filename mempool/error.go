@@ -5,6 +5,8 @@
 package mempool
 
 import (
+	"fmt"
+
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/wire"
 )
@@ -27,6 +29,41 @@ func (e RuleError) Error() string {
 	return e.Err.Error()
 }
 
+// ErrorCode identifies a kind of transaction rule violation that shares its
+// reject code with other kinds of violations.
+type ErrorCode int
+
+// These constants are used to identify a specific TxRuleError.
+const (
+	// ErrOther indicates a rule violation that is sufficiently described
+	// by its reject code.
+	ErrOther ErrorCode = iota
+
+	// ErrDoubleSpend indicates a transaction spends an output that is
+	// already spent by a transaction in the memory pool and can't replace
+	// it.
+	ErrDoubleSpend
+
+	// ErrOrphanTx indicates a transaction spends outputs of unknown or
+	// fully-spent transactions when orphans are not allowed.
+	ErrOrphanTx
+)
+
+// Map of ErrorCode values back to their constant names for pretty printing.
+var errorCodeStrings = map[ErrorCode]string{
+	ErrOther:       "ErrOther",
+	ErrDoubleSpend: "ErrDoubleSpend",
+	ErrOrphanTx:    "ErrOrphanTx",
+}
+
+// String returns the ErrorCode as a human-readable name.
+func (e ErrorCode) String() string {
+	if s := errorCodeStrings[e]; s != "" {
+		return s
+	}
+	return fmt.Sprintf("Unknown ErrorCode (%d)", int(e))
+}
+
 // TxRuleError identifies a rule violation.  It is used to indicate that
 // processing of a transaction failed due to one of the many validation
 // rules.  The caller can use type assertions to determine if a failure was
@@ -34,6 +71,7 @@ func (e RuleError) Error() string {
 // ascertain the specific reason for the rule violation.
 type TxRuleError struct {
 	RejectCode  wire.RejectCode // The code to send with reject messages
+	ErrorCode   ErrorCode       // Describes the kind of violation
 	Description string          // Human readable description of the issue
 }
 
@@ -50,6 +88,14 @@ func txRuleError(c wire.RejectCode, desc string) RuleError {
 	}
 }
 
+// txRuleErrorCode creates an underlying TxRuleError with the given reject code,
+// error code, and description and returns a RuleError that encapsulates it.
+func txRuleErrorCode(c wire.RejectCode, code ErrorCode, desc string) RuleError {
+	return RuleError{
+		Err: TxRuleError{RejectCode: c, ErrorCode: code, Description: desc},
+	}
+}
+
 // chainRuleError returns a RuleError that encapsulates the given
 // blockchain.RuleError.
 func chainRuleError(chainErr blockchain.RuleError) RuleError {
@@ -556,6 +556,20 @@ func (ef *FeeEstimator) estimates() []SatoshiPerByte {
 // EstimateFee estimates the fee per byte to have a tx confirmed a given
 // number of blocks from now.
 func (ef *FeeEstimator) EstimateFee(numBlocks uint32) (BtcPerKilobyte, error) {
+	feeRate, err := ef.EstimateFeeRate(int(numBlocks))
+	if err != nil {
+		return -1, err
+	}
+
+	return feeRate.ToBtcPerKb(), nil
+}
+
+// EstimateFeeRate estimates the fee rate, in satoshis per byte, required to
+// have a tx confirmed within confTarget blocks from now.  The estimate is
+// derived from the fee rates of the transactions observed in the mempool and
+// the number of blocks it took for them to be mined over the most recently
+// registered blocks.
+func (ef *FeeEstimator) EstimateFeeRate(confTarget int) (SatoshiPerByte, error) {
 	ef.mtx.Lock()
 	defer ef.mtx.Unlock()
 
@@ -565,11 +579,11 @@ func (ef *FeeEstimator) EstimateFee(numBlocks uint32) (BtcPerKilobyte, error) {
 		return -1, errors.New("not enough blocks have been observed")
 	}
 
-	if numBlocks == 0 {
+	if confTarget <= 0 {
 		return -1, errors.New("cannot confirm transaction in zero blocks")
 	}
 
-	if numBlocks > estimateFeeDepth {
+	if confTarget > estimateFeeDepth {
 		return -1, fmt.Errorf(
 			"can only estimate fees for up to %d blocks from now",
 			estimateFeeDepth)
@@ -580,7 +594,7 @@ func (ef *FeeEstimator) EstimateFee(numBlocks uint32) (BtcPerKilobyte, error) {
 		ef.cached = ef.estimates()
 	}
 
-	return ef.cached[int(numBlocks)-1].ToBtcPerKb(), nil
+	return ef.cached[confTarget-1], nil
 }
 
 // In case the format for the serialized version of the FeeEstimator changes,
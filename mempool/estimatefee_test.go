@@ -320,6 +320,49 @@ func (eft *estimateFeeTester) round(txHistory [][]*TxDesc,
 	return append(txHistory, newTxs), append(estimateHistory, estimates)
 }
 
+// TestEstimateFeeRate ensures fee rate estimates reflect the fee rates of the
+// transactions mined within the requested number of blocks.
+func TestEstimateFeeRate(t *testing.T) {
+	ef := newTestFeeEstimator(5, 3, 1)
+	eft := estimateFeeTester{ef: ef, t: t}
+
+	// Observe a high and a low fee rate transaction and mine the high fee
+	// rate one in the next block while the low fee rate one takes three.
+	txHigh := eft.testTx(4000000)
+	txLow := eft.testTx(500000)
+	ef.ObserveTransaction(txHigh)
+	ef.ObserveTransaction(txLow)
+	eft.newBlock([]*wire.MsgTx{txHigh.Tx.MsgTx()})
+	eft.newBlock([]*wire.MsgTx{})
+	eft.newBlock([]*wire.MsgTx{txLow.Tx.MsgTx()})
+
+	tests := []struct {
+		confTarget int
+		expected   SatoshiPerByte
+	}{
+		{1, NewSatoshiPerByte(4000000, uint32(txHigh.Tx.MsgTx().SerializeSize()))},
+		{3, NewSatoshiPerByte(500000, uint32(txLow.Tx.MsgTx().SerializeSize()))},
+	}
+	for _, test := range tests {
+		estimated, err := ef.EstimateFeeRate(test.confTarget)
+		if err != nil {
+			t.Fatalf("EstimateFeeRate(%d): unexpected error: %v",
+				test.confTarget, err)
+		}
+		if estimated != test.expected {
+			t.Errorf("EstimateFeeRate(%d): expected %v, got %v",
+				test.confTarget, test.expected, estimated)
+		}
+	}
+
+	// Targets outside of the supported range must be rejected.
+	for _, confTarget := range []int{-1, 0, estimateFeeDepth + 1} {
+		if _, err := ef.EstimateFeeRate(confTarget); err == nil {
+			t.Errorf("EstimateFeeRate(%d): expected error", confTarget)
+		}
+	}
+}
+
 // TestEstimateFeeRollback tests the rollback function, which undoes the
 // effect of a adding a new block.
 func TestEstimateFeeRollback(t *testing.T) {
@@ -148,6 +148,20 @@ type Policy struct {
 	// transactions using the Replace-By-Fee (RBF) signaling policy into
 	// the mempool.
 	RejectReplacement bool
+
+	// MaxStandardTxWeight is the maximum weight of a transaction that is
+	// considered standard.  A value of zero uses the default.
+	MaxStandardTxWeight int64
+
+	// DustRelayFee defines the fee rate in satoshi/kB used to determine
+	// whether an output is dust.  A value of zero uses MinRelayTxFee.
+	DustRelayFee btcutil.Amount
+
+	// StandardScriptClasses optionally restricts the output script classes
+	// that are considered standard.  Outputs must already be of a standard
+	// form, so this can only be used to narrow the accepted set.  When it
+	// is empty, all standard script classes are accepted.
+	StandardScriptClasses []txscript.ScriptClass
 }
 
 // TxDesc is a descriptor containing a transaction in the mempool along with
@@ -190,6 +204,10 @@ type TxPool struct {
 	// the scan will only run when an orphan is added to the pool as opposed
 	// to on an unconditional timer.
 	nextExpireScan time.Time
+
+	// These fields house the channels returned by Subscribe.
+	notificationsLock sync.RWMutex
+	notifications     []chan *Notification
 }
 
 // Ensure the TxPool type implements the mining.TxSource interface.
@@ -575,29 +593,48 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil
 // does not check for double spends against transactions already in the main
 // chain.
 //
+// A single NTDoubleSpend notification describing all of the conflicting
+// outpoints is sent when there are any.
+//
 // This function MUST be called with the mempool lock held (for reads).
 func (mp *TxPool) checkPoolDoubleSpend(tx *btcutil.Tx) (bool, error) {
-	var isReplacement bool
+	var conflicts []DoubleSpendConflict
 	for _, txIn := range tx.MsgTx().TxIn {
 		conflict, ok := mp.outpoints[txIn.PreviousOutPoint]
 		if !ok {
 			continue
 		}
+		conflicts = append(conflicts, DoubleSpendConflict{
+			OutPoint: txIn.PreviousOutPoint,
+			PoolTx:   *conflict.Hash(),
+		})
+	}
+	if len(conflicts) == 0 {
+		return false, nil
+	}
 
+	// Alert subscribers to the double spend attempt before deciding
+	// whether it is an acceptable replacement.
+	mp.sendNotification(NTDoubleSpend, &DoubleSpendAlert{
+		Tx:        *tx.Hash(),
+		Conflicts: conflicts,
+	})
+
+	for _, c := range conflicts {
 		// Reject the transaction if we don't accept replacement
 		// transactions or if it doesn't signal replacement.
+		conflict := mp.outpoints[c.OutPoint]
 		if mp.cfg.Policy.RejectReplacement ||
 			!mp.signalsReplacement(conflict, nil) {
 			str := fmt.Sprintf("output %v already spent by "+
 				"transaction %v in the memory pool",
-				txIn.PreviousOutPoint, conflict.Hash())
-			return false, txRuleError(wire.RejectDuplicate, str)
+				c.OutPoint, conflict.Hash())
+			return false, txRuleErrorCode(wire.RejectDuplicate,
+				ErrDoubleSpend, str)
 		}
-
-		isReplacement = true
 	}
 
-	return isReplacement, nil
+	return true, nil
 }
 
 // signalsReplacement determines if a transaction is signaling that it can be
@@ -989,9 +1026,8 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 	// Don't allow non-standard transactions if the network parameters
 	// forbid their acceptance.
 	if !mp.cfg.Policy.AcceptNonStd {
-		err = CheckTransactionStandard(tx, nextBlockHeight,
-			medianTimePast, mp.cfg.Policy.MinRelayTxFee,
-			mp.cfg.Policy.MaxTxVersion)
+		err = checkTransactionStandard(tx, nextBlockHeight,
+			medianTimePast, &mp.cfg.Policy)
 		if err != nil {
 			// Attempt to extract a reject code from the error so
 			// it can be retained.  When not possible, fall back to
@@ -1415,7 +1451,8 @@ func (mp *TxPool) ProcessTransaction(tx *btcutil.Tx, allowOrphan, rateLimit bool
 		str := fmt.Sprintf("orphan transaction %v references "+
 			"outputs of unknown or fully-spent "+
 			"transaction %v", tx.Hash(), missingParents[0])
-		return nil, txRuleError(wire.RejectDuplicate, str)
+		return nil, txRuleErrorCode(wire.RejectDuplicate, ErrOrphanTx,
+			str)
 	}
 
 	// Potentially add the orphan transaction to the orphan pool.
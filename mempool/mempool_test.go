@@ -557,6 +557,11 @@ func TestOrphanReject(t *testing.T) {
 			t.Fatalf("ProcessTransaction: unexpected reject code "+
 				"-- got %v, want %v", code, wire.RejectDuplicate)
 		}
+		errCode := err.(RuleError).Err.(TxRuleError).ErrorCode
+		if errCode != ErrOrphanTx {
+			t.Fatalf("ProcessTransaction: unexpected error code "+
+				"-- got %v, want %v", errCode, ErrOrphanTx)
+		}
 
 		// Ensure no transactions were reported as accepted.
 		if len(acceptedTxns) != 0 {
@@ -931,6 +936,175 @@ func TestCheckSpend(t *testing.T) {
 	}
 }
 
+// TestDoubleSpendNotification ensures subscribers are alerted when a
+// transaction spending an output already spent in the pool is received.
+func TestDoubleSpendNotification(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+
+	notifications := harness.txPool.Subscribe()
+
+	// Split the spendable output into two outputs that the transactions
+	// below spend.
+	parent, err := harness.CreateSignedTx(outputs[:1], 2, 0, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = harness.txPool.ProcessTransaction(parent, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept tx: %v", err)
+	}
+	outputs = []spendableOutput{
+		txOutToSpendableOut(parent, 0),
+		txOutToSpendableOut(parent, 1),
+	}
+
+	// Add a transaction spending the first output.  No alert should be
+	// sent since there is nothing to conflict with.
+	poolTx, err := harness.CreateSignedTx(outputs[:1], 1, 0, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = harness.txPool.ProcessTransaction(poolTx, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept tx: %v", err)
+	}
+	if len(notifications) != 0 {
+		t.Fatalf("got %d notifications before double spend, want 0",
+			len(notifications))
+	}
+
+	// Attempt to spend the same output along with another one with a
+	// different transaction and ensure it's rejected with a single alert
+	// describing the conflict.
+	conflictTx, err := harness.CreateSignedTx(outputs[:2], 2, 1000, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = harness.txPool.ProcessTransaction(conflictTx, false, false, 0)
+	if err == nil {
+		t.Fatal("ProcessTransaction: accepted double spend")
+	}
+	if len(notifications) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(notifications))
+	}
+	n := <-notifications
+	if n.Type != NTDoubleSpend {
+		t.Fatalf("got %v notification, want %v", n.Type, NTDoubleSpend)
+	}
+	want := &DoubleSpendAlert{
+		Tx: *conflictTx.Hash(),
+		Conflicts: []DoubleSpendConflict{{
+			OutPoint: outputs[0].outPoint,
+			PoolTx:   *poolTx.Hash(),
+		}},
+	}
+	if !reflect.DeepEqual(n.Data, want) {
+		t.Fatalf("unexpected alert: got %+v, want %+v", n.Data, want)
+	}
+
+	// A transaction conflicting on several inputs is reported by a single
+	// alert.
+	poolTx2, err := harness.CreateSignedTx(outputs[1:2], 1, 0, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = harness.txPool.ProcessTransaction(poolTx2, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept tx: %v", err)
+	}
+	_, err = harness.txPool.ProcessTransaction(conflictTx, false, false, 0)
+	if err == nil {
+		t.Fatal("ProcessTransaction: accepted double spend")
+	}
+	if len(notifications) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(notifications))
+	}
+	n = <-notifications
+	want.Conflicts = append(want.Conflicts, DoubleSpendConflict{
+		OutPoint: outputs[1].outPoint,
+		PoolTx:   *poolTx2.Hash(),
+	})
+	if !reflect.DeepEqual(n.Data, want) {
+		t.Fatalf("unexpected alert: got %+v, want %+v", n.Data, want)
+	}
+}
+
+// TestStandardnessPolicy ensures the configurable standardness policy is
+// applied when accepting transactions into the pool.
+func TestStandardnessPolicy(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tx, err := harness.CreateSignedTx(outputs[:1], 1, 1000, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	txOut := tx.MsgTx().TxOut[0]
+	defaultPolicy := harness.txPool.cfg.Policy
+
+	tests := []struct {
+		name   string
+		policy func(*Policy)
+		code   wire.RejectCode
+	}{
+		{
+			name: "dust output",
+			policy: func(p *Policy) {
+				p.DustRelayFee = btcutil.Amount(txOut.Value*1000/
+					GetDustThreshold(txOut) + 1)
+			},
+			code: wire.RejectDust,
+		},
+		{
+			name: "oversized transaction",
+			policy: func(p *Policy) {
+				p.MaxStandardTxWeight =
+					blockchain.GetTransactionWeight(tx) - 1
+			},
+			code: wire.RejectNonstandard,
+		},
+		{
+			name: "disallowed script class",
+			policy: func(p *Policy) {
+				p.StandardScriptClasses = []txscript.ScriptClass{
+					txscript.ScriptHashTy,
+				}
+			},
+			code: wire.RejectNonstandard,
+		},
+	}
+	for _, test := range tests {
+		policy := defaultPolicy
+		test.policy(&policy)
+		harness.txPool.cfg.Policy = policy
+
+		_, err := harness.txPool.ProcessTransaction(tx, false, false, 0)
+		if err == nil {
+			t.Fatalf("%s: transaction accepted", test.name)
+		}
+		code, _ := extractRejectCode(err)
+		if code != test.code {
+			t.Fatalf("%s: unexpected reject code %v, want %v: %v",
+				test.name, code, test.code, err)
+		}
+	}
+
+	// The transaction is standard under the default policy.
+	harness.txPool.cfg.Policy = defaultPolicy
+	_, err = harness.txPool.ProcessTransaction(tx, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept tx: %v", err)
+	}
+}
+
 // TestSignalsReplacement tests that transactions properly signal they can be
 // replaced using RBF.
 func TestSignalsReplacement(t *testing.T) {
@@ -0,0 +1,107 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// notificationBufferSize is the number of notifications buffered for each
+// subscriber.  Notifications sent while the buffer of a subscriber is full are
+// dropped for that subscriber.
+const notificationBufferSize = 100
+
+// NotificationType represents the type of a notification message.
+type NotificationType int
+
+// Constants for the type of a notification message.
+const (
+	// NTDoubleSpend indicates a transaction was received that spends
+	// outputs already spent by transactions in the memory pool.  This is
+	// sent regardless of whether the transaction ends up replacing the
+	// existing ones.
+	NTDoubleSpend NotificationType = iota
+)
+
+// notificationTypeStrings is a map of notification types back to their constant
+// names for pretty printing.
+var notificationTypeStrings = map[NotificationType]string{
+	NTDoubleSpend: "NTDoubleSpend",
+}
+
+// String returns the NotificationType in human-readable form.
+func (n NotificationType) String() string {
+	if s, ok := notificationTypeStrings[n]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown Notification Type (%d)", int(n))
+}
+
+// DoubleSpendConflict describes an output spent by both a transaction in the
+// memory pool and an incoming transaction.
+type DoubleSpendConflict struct {
+	// OutPoint is the output both transactions attempt to spend.
+	OutPoint wire.OutPoint
+
+	// PoolTx is the hash of the transaction already in the memory pool.
+	PoolTx chainhash.Hash
+}
+
+// DoubleSpendAlert describes an attempt to spend outputs that are already
+// spent by transactions in the memory pool.
+type DoubleSpendAlert struct {
+	// Tx is the hash of the incoming transaction.
+	Tx chainhash.Hash
+
+	// Conflicts holds the outputs spent by the incoming transaction that
+	// are already spent in the memory pool in the order of its inputs.
+	Conflicts []DoubleSpendConflict
+}
+
+// Notification defines notification that is sent to the caller via the
+// channels returned by Subscribe and consists of a notification type as well
+// as associated data that depends on the type as follows:
+//   - NTDoubleSpend: *DoubleSpendAlert
+type Notification struct {
+	Type NotificationType
+	Data interface{}
+}
+
+// Subscribe to mempool notifications.  Returns a channel on which the
+// notifications are delivered as various events take place.  See the
+// documentation on Notification and NotificationType for details on the types
+// and contents of notifications.
+//
+// The channel is buffered and the notifications are sent without blocking, so
+// the subscriber must receive from it promptly or notifications are dropped.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Subscribe() <-chan *Notification {
+	c := make(chan *Notification, notificationBufferSize)
+	mp.notificationsLock.Lock()
+	mp.notifications = append(mp.notifications, c)
+	mp.notificationsLock.Unlock()
+	return c
+}
+
+// sendNotification sends a notification with the passed type and data to all
+// subscribers without blocking.  It is dropped for subscribers whose buffer is
+// full.
+func (mp *TxPool) sendNotification(typ NotificationType, data interface{}) {
+	n := &Notification{Type: typ, Data: data}
+	mp.notificationsLock.RLock()
+	for _, c := range mp.notifications {
+		select {
+		case c <- n:
+		default:
+			log.Warnf("Dropping %v notification for slow subscriber",
+				typ)
+		}
+	}
+	mp.notificationsLock.RUnlock()
+}
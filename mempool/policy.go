@@ -286,6 +286,28 @@ func CheckTransactionStandard(tx *btcutil.Tx, height int32,
 	medianTimePast time.Time, minRelayTxFee btcutil.Amount,
 	maxTxVersion int32) error {
 
+	policy := Policy{
+		MinRelayTxFee: minRelayTxFee,
+		MaxTxVersion:  maxTxVersion,
+	}
+	return checkTransactionStandard(tx, height, medianTimePast, &policy)
+}
+
+// checkTransactionStandard performs the checks described by
+// CheckTransactionStandard using the limits in the passed policy.
+func checkTransactionStandard(tx *btcutil.Tx, height int32,
+	medianTimePast time.Time, policy *Policy) error {
+
+	maxTxVersion := policy.MaxTxVersion
+	maxTxWeight := policy.MaxStandardTxWeight
+	if maxTxWeight <= 0 {
+		maxTxWeight = maxStandardTxWeight
+	}
+	dustRelayFee := policy.DustRelayFee
+	if dustRelayFee <= 0 {
+		dustRelayFee = policy.MinRelayTxFee
+	}
+
 	// The transaction must be a currently supported version.
 	msgTx := tx.MsgTx()
 	if msgTx.Version > maxTxVersion || msgTx.Version < 1 {
@@ -307,9 +329,9 @@ func CheckTransactionStandard(tx *btcutil.Tx, height int32,
 	// size of a transaction.  This also helps mitigate CPU exhaustion
 	// attacks.
 	txWeight := blockchain.GetTransactionWeight(tx)
-	if txWeight > maxStandardTxWeight {
+	if txWeight > maxTxWeight {
 		str := fmt.Sprintf("weight of transaction %v is larger than max "+
-			"allowed weight of %v", txWeight, maxStandardTxWeight)
+			"allowed weight of %v", txWeight, maxTxWeight)
 		return txRuleError(wire.RejectNonstandard, str)
 	}
 
@@ -352,13 +374,19 @@ func CheckTransactionStandard(tx *btcutil.Tx, height int32,
 			str := fmt.Sprintf("transaction output %d: %v", i, err)
 			return txRuleError(rejectCode, str)
 		}
+		if !scriptClassAllowed(scriptClass, policy.StandardScriptClasses) {
+			str := fmt.Sprintf("transaction output %d: script "+
+				"class %v is not allowed by policy", i,
+				scriptClass)
+			return txRuleError(wire.RejectNonstandard, str)
+		}
 
 		// Accumulate the number of outputs which only carry data.  For
 		// all other script types, ensure the output value is not
 		// "dust".
 		if scriptClass == txscript.NullDataTy {
 			numNullDataOutputs++
-		} else if IsDust(txOut, minRelayTxFee) {
+		} else if IsDust(txOut, dustRelayFee) {
 			str := fmt.Sprintf("transaction output %d: payment "+
 				"of %d is dust", i, txOut.Value)
 			return txRuleError(wire.RejectDust, str)
@@ -375,6 +403,22 @@ func CheckTransactionStandard(tx *btcutil.Tx, height int32,
 	return nil
 }
 
+// scriptClassAllowed returns whether the passed script class is in the allowed
+// set.  An empty set allows all script classes.
+func scriptClassAllowed(class txscript.ScriptClass,
+	allowed []txscript.ScriptClass) bool {
+
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, allowedClass := range allowed {
+		if class == allowedClass {
+			return true
+		}
+	}
+	return false
+}
+
 // GetTxVirtualSize computes the virtual size of a given transaction. A
 // transaction's virtual size is based off its weight, creating a discount for
 // any witness data it contains, proportional to the current
@@ -0,0 +1,298 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	peerpkg "github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// assumeValidSegmentSize is the number of ancestors of the assumed valid block
+// between consecutive anchors.  It matches the number of headers in a full
+// message, so each segment is requested with a single getheaders message.
+const assumeValidSegmentSize = wire.MaxBlockHeadersPerMsg
+
+// requestAssumeValidHeaders requests the headers leading from the tip of the
+// best chain to the assumed valid block from the passed peer so the ancestors
+// of the assumed valid block are known before they are downloaded.  Nothing is
+// requested when there is no assumed valid block, its ancestors are already
+// known, the chain already has it, or the peer predates headers.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) requestAssumeValidHeaders(peer *peerpkg.Peer) {
+	if sm.assumeValid == nil || sm.assumeValidKnown ||
+		sm.assumeValidPeer != nil || !supportsHeaders(peer) {
+
+		return
+	}
+	if have, err := sm.chain.HaveBlock(sm.assumeValid); err != nil || have {
+		return
+	}
+
+	locator, err := sm.chain.LatestBlockLocator()
+	if err != nil {
+		log.Warnf("Failed to get block locator for the latest block: %v",
+			err)
+		return
+	}
+	sm.pushGetAssumeValidHeaders(peer, locator, sm.assumeValid)
+}
+
+// pushGetAssumeValidHeaders sends a getheaders message for the headers after
+// the passed locator up to the passed stop hash to the passed peer.
+func (sm *SyncManager) pushGetAssumeValidHeaders(peer *peerpkg.Peer,
+	locator blockchain.BlockLocator, stopHash *chainhash.Hash) {
+
+	if err := peer.PushGetHeadersMsg(locator, stopHash); err != nil {
+		log.Warnf("Failed to send getheaders message to peer %s: %v",
+			peer.Addr(), err)
+		return
+	}
+	sm.assumeValidPeer = peer
+	log.Debugf("Requesting headers up to %v leading to assumed valid "+
+		"block %v from peer %s", stopHash, sm.assumeValid, peer.Addr())
+}
+
+// resetAssumeValidHeaders forgets the headers received so far while the
+// ancestors of the assumed valid block are not yet known so they are requested
+// again from the start.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) resetAssumeValidHeaders() {
+	if sm.assumeValidKnown {
+		return
+	}
+	sm.assumeValidAnchors = nil
+	sm.assumeValidWindow = nil
+}
+
+// handleAssumeValidHeaders handles headers received in response to a request
+// for the headers leading to the assumed valid block.  The headers must link
+// together, starting from a block in the main chain.  Since the hash of each
+// header commits to its parent, a sequence ending at the assumed valid block
+// identifies its ancestors, which are then processed without running their
+// scripts.  The next headers are requested after a full message.
+//
+// Only the hash of the last header of each full message is kept as an anchor
+// along with the hashes of the first message, which are the first ancestors to
+// be processed.  The ancestors between later anchors are requested again once
+// they are needed.  See assumedValidFlags.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) handleAssumeValidHeaders(peer *peerpkg.Peer,
+	headers []*wire.BlockHeader) {
+
+	sm.assumeValidPeer = nil
+	if sm.assumeValidKnown {
+		sm.handleAssumeValidSegment(peer, headers)
+		return
+	}
+
+	// The peer does not know of the assumed valid block when it sent no
+	// headers.
+	if len(headers) == 0 {
+		log.Infof("Peer %s does not have assumed valid block %v",
+			peer, sm.assumeValid)
+		sm.resetAssumeValidHeaders()
+		return
+	}
+
+	// The first headers must connect to a block in the main chain, which
+	// is the first anchor.
+	if len(sm.assumeValidAnchors) == 0 {
+		start := headers[0].PrevBlock
+		height, err := sm.chain.BlockHeightByHash(&start)
+		if err != nil {
+			log.Warnf("Headers leading to assumed valid block %v from "+
+				"peer %s do not connect", sm.assumeValid, peer)
+			return
+		}
+		sm.assumeValidAnchors = []chainhash.Hash{start}
+		sm.assumeValidBase = height
+	}
+
+	parent := sm.assumeValidAnchors[len(sm.assumeValidAnchors)-1]
+	hashes, ok := linkHeaders(parent, headers, sm.assumeValid)
+	if !ok {
+		log.Warnf("Headers leading to assumed valid block %v from "+
+			"peer %s do not connect", sm.assumeValid, peer)
+		sm.resetAssumeValidHeaders()
+		return
+	}
+	if len(sm.assumeValidAnchors) == 1 {
+		sm.assumeValidWindow = hashes
+		sm.assumeValidWindowStart = sm.assumeValidBase + 1
+	}
+
+	if n := len(hashes); n > 0 && hashes[n-1] == *sm.assumeValid {
+		// The ancestors of the assumed valid block are known, so
+		// process those not yet processed without their scripts.
+		fullSegments := len(sm.assumeValidAnchors) - 1
+		sm.assumeValidHeight = sm.assumeValidBase +
+			int32(fullSegments*assumeValidSegmentSize+n)
+		sm.assumeValidAnchors = append(sm.assumeValidAnchors,
+			*sm.assumeValid)
+		sm.assumeValidKnown = true
+		log.Infof("Skipping script validation for %d blocks up to "+
+			"assumed valid block %v (height %d)",
+			sm.assumeValidHeight-sm.assumeValidBase, sm.assumeValid,
+			sm.assumeValidHeight)
+		return
+	}
+
+	// The peer does not know of the assumed valid block when it sent fewer
+	// headers than fit in a message without reaching it.
+	if len(headers) < wire.MaxBlockHeadersPerMsg {
+		log.Infof("Peer %s does not have assumed valid block %v",
+			peer, sm.assumeValid)
+		sm.resetAssumeValidHeaders()
+		return
+	}
+
+	last := hashes[len(hashes)-1]
+	sm.assumeValidAnchors = append(sm.assumeValidAnchors, last)
+	locator := blockchain.BlockLocator([]*chainhash.Hash{&last})
+	sm.pushGetAssumeValidHeaders(peer, locator, sm.assumeValid)
+}
+
+// linkHeaders returns the hashes of the passed headers up to and including the
+// one with the passed stop hash.  The headers must link together starting from
+// the passed parent hash.  It returns false when they don't.
+func linkHeaders(parent chainhash.Hash, headers []*wire.BlockHeader,
+	stopHash *chainhash.Hash) ([]chainhash.Hash, bool) {
+
+	prevHash := parent
+	hashes := make([]chainhash.Hash, 0, len(headers))
+	for _, header := range headers {
+		if header.PrevBlock != prevHash {
+			return nil, false
+		}
+		prevHash = header.BlockHash()
+		hashes = append(hashes, prevHash)
+		if prevHash == *stopHash {
+			break
+		}
+	}
+	return hashes, true
+}
+
+// anchorHeight returns the height of the anchor with the passed index.
+func (sm *SyncManager) anchorHeight(i int) int32 {
+	if i == len(sm.assumeValidAnchors)-1 {
+		return sm.assumeValidHeight
+	}
+	return sm.assumeValidBase + int32(i*assumeValidSegmentSize)
+}
+
+// nextAssumeValidSegment returns the index of the anchor the next segment of
+// ancestors to request follows, which is the anchor at the end of the window,
+// or -1 when the window already ends at the assumed valid block.
+func (sm *SyncManager) nextAssumeValidSegment() int {
+	end := sm.assumeValidWindowStart + int32(len(sm.assumeValidWindow)) - 1
+	if end >= sm.assumeValidHeight {
+		return -1
+	}
+	return int(end-sm.assumeValidBase) / assumeValidSegmentSize
+}
+
+// requestAssumeValidSegment requests the headers of the ancestors of the
+// assumed valid block that follow the current window from the passed peer.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) requestAssumeValidSegment(peer *peerpkg.Peer) {
+	if sm.assumeValidPeer != nil || !supportsHeaders(peer) {
+		return
+	}
+	i := sm.nextAssumeValidSegment()
+	if i < 0 {
+		return
+	}
+	locator := blockchain.BlockLocator([]*chainhash.Hash{
+		&sm.assumeValidAnchors[i],
+	})
+	sm.pushGetAssumeValidHeaders(peer, locator,
+		&sm.assumeValidAnchors[i+1])
+}
+
+// handleAssumeValidSegment handles headers received in response to a request
+// for the next segment of ancestors of the assumed valid block.  The headers
+// must link the anchors before and after the segment, which proves they are the
+// ancestors since the hash of each header commits to its parent.  They are then
+// appended to the window.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) handleAssumeValidSegment(peer *peerpkg.Peer,
+	headers []*wire.BlockHeader) {
+
+	i := sm.nextAssumeValidSegment()
+	if i < 0 {
+		return
+	}
+	end := sm.assumeValidAnchors[i+1]
+	hashes, ok := linkHeaders(sm.assumeValidAnchors[i], headers, &end)
+	want := int(sm.anchorHeight(i+1) - sm.anchorHeight(i))
+	if !ok || len(hashes) != want || hashes[want-1] != end {
+		log.Warnf("Headers of the ancestors of assumed valid block %v "+
+			"from peer %s do not match", sm.assumeValid, peer)
+		return
+	}
+	if len(sm.assumeValidWindow) == 0 {
+		sm.assumeValidWindowStart = sm.anchorHeight(i) + 1
+	}
+	sm.assumeValidWindow = append(sm.assumeValidWindow, hashes...)
+}
+
+// assumedValidFlags returns the behavior flags to process the passed block
+// received from the passed peer with based on whether it is an ancestor of the
+// assumed valid block.  The block is an ancestor when it extends the main chain
+// at a height within the window of ancestors and its hash matches the ancestor
+// at that height.  The window is advanced past the block and the next segment
+// of ancestors is requested once less than half a segment remains.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) assumedValidFlags(peer *peerpkg.Peer,
+	block *btcutil.Block) blockchain.BehaviorFlags {
+
+	if !sm.assumeValidKnown || sm.assumeValidAnchors == nil {
+		return blockchain.BFNone
+	}
+	prevHash := &block.MsgBlock().Header.PrevBlock
+	prevHeight, err := sm.chain.BlockHeightByHash(prevHash)
+	if err != nil {
+		return blockchain.BFNone
+	}
+
+	// The ancestors are no longer needed once the assumed valid block is
+	// reached.
+	height := prevHeight + 1
+	if height > sm.assumeValidHeight {
+		sm.assumeValidAnchors = nil
+		sm.assumeValidWindow = nil
+		return blockchain.BFNone
+	}
+
+	flags := blockchain.BFNone
+	idx := int(height - sm.assumeValidWindowStart)
+	if idx >= 0 && idx < len(sm.assumeValidWindow) &&
+		sm.assumeValidWindow[idx] == *block.Hash() {
+
+		flags = blockchain.BFNoScriptCheck
+		sm.assumeValidWindow = sm.assumeValidWindow[idx+1:]
+		sm.assumeValidWindowStart = height + 1
+	}
+	if height == sm.assumeValidHeight {
+		sm.assumeValidAnchors = nil
+		sm.assumeValidWindow = nil
+		return flags
+	}
+
+	if len(sm.assumeValidWindow) < assumeValidSegmentSize/2 {
+		sm.requestAssumeValidSegment(peer)
+	}
+	return flags
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// createBadScriptBlock returns a solved block that extends the current best
+// chain tip and spends the coinbase of the passed block with a signature script
+// that fails to satisfy it.
+func (ctx *testContext) createBadScriptBlock(t *testing.T,
+	spend *btcutil.Block) *btcutil.Block {
+
+	t.Helper()
+
+	sigScript, err := txscript.NewScriptBuilder().
+		AddData([]byte{txscript.OP_FALSE}).Script()
+	if err != nil {
+		t.Fatalf("unable to create signature script: %v", err)
+	}
+	coinbase := spend.Transactions()[0]
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(coinbase.Hash(), 0),
+		sigScript, nil))
+	tx.AddTxOut(wire.NewTxOut(coinbase.MsgTx().TxOut[0].Value,
+		opTrueP2SHScript(t, ctx.params)))
+	return ctx.createBlockWithTxs(t, tx)
+}
+
+// TestAssumeValid ensures the headers leading to the assumed valid block are
+// requested from the sync peer and that the scripts of the assumed valid block
+// and its ancestors are not executed while those of later blocks are.
+func TestAssumeValid(t *testing.T) {
+	// Create a chain of blocks in which the coinbases of the first two
+	// blocks are spent by transactions with failing scripts once they
+	// mature using a separate chain that doesn't execute scripts.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	addBlock := func(block *btcutil.Block) {
+		_, _, err := src.chain.ProcessBlock(block,
+			blockchain.BFNoScriptCheck)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+	for i := 0; i < 101; i++ {
+		addBlock(src.createBlock(t))
+	}
+	addBlock(src.createBadScriptBlock(t, blocks[0]))
+	addBlock(src.createBadScriptBlock(t, blocks[1]))
+
+	// Assume the first block with a failing script is valid.
+	cfg := newTestConfig(t)
+	cfg.AssumeValid = blocks[101].Hash()
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	peer.UpdateLastBlockHeight(int32(len(blocks)))
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	if ctx.sm.assumeValidPeer != peer.Peer {
+		t.Fatal("headers leading to assumed valid block not requested")
+	}
+
+	headers := wire.NewMsgHeaders()
+	for _, block := range blocks[:102] {
+		err := headers.AddBlockHeader(&block.MsgBlock().Header)
+		if err != nil {
+			t.Fatalf("unable to add header: %v", err)
+		}
+	}
+	ctx.sm.handleHeadersMsg(&headersMsg{headers: headers, peer: peer.Peer})
+	if ctx.sm.assumeValidHeight != 102 {
+		t.Fatalf("assumed valid height %d, want 102",
+			ctx.sm.assumeValidHeight)
+	}
+	if len(ctx.sm.assumeValidWindow) != 102 {
+		t.Fatalf("%d ancestors in window, want 102",
+			len(ctx.sm.assumeValidWindow))
+	}
+
+	// The block with a failing script after the assumed valid block is
+	// rejected.
+	for _, block := range blocks {
+		ctx.sm.handleBlockMsg(&blockMsg{block: block, peer: peer.Peer})
+	}
+	if best := ctx.chain.BestSnapshot(); best.Hash != *blocks[101].Hash() {
+		t.Fatalf("best chain tip is %v at height %d, want %v",
+			best.Hash, best.Height, blocks[101].Hash())
+	}
+	if ctx.sm.assumeValidAnchors != nil || ctx.sm.assumeValidWindow != nil {
+		t.Fatal("ancestors remain after processing")
+	}
+}
+
+// TestAssumeValidSegments ensures only the anchors and a window of the
+// ancestors of an assumed valid block more than a message of headers away are
+// kept and that the next segment of ancestors is requested and verified
+// against the anchors as the window is processed.
+func TestAssumeValidSegments(t *testing.T) {
+	// Create a chain of blocks in which the block before the assumed valid
+	// one, which is past the first segment, spends the coinbase of the
+	// first block with a failing script, as does the block after it.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	addBlock := func(block *btcutil.Block) {
+		_, _, err := src.chain.ProcessBlock(block,
+			blockchain.BFNoScriptCheck)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+	numBlocks := assumeValidSegmentSize + 8
+	for len(blocks) < numBlocks {
+		addBlock(src.createBlock(t))
+	}
+	addBlock(src.createBadScriptBlock(t, blocks[0]))
+	addBlock(src.createBlock(t))
+	addBlock(src.createBadScriptBlock(t, blocks[1]))
+	assumeValid := blocks[len(blocks)-2]
+
+	cfg := newTestConfig(t)
+	cfg.AssumeValid = assumeValid.Hash()
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	peer.UpdateLastBlockHeight(int32(len(blocks)))
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+
+	sendHeaders := func(blocks []*btcutil.Block) {
+		t.Helper()
+
+		if ctx.sm.assumeValidPeer != peer.Peer {
+			t.Fatal("headers leading to assumed valid block not " +
+				"requested")
+		}
+		headers := wire.NewMsgHeaders()
+		for _, block := range blocks {
+			err := headers.AddBlockHeader(&block.MsgBlock().Header)
+			if err != nil {
+				t.Fatalf("unable to add header: %v", err)
+			}
+		}
+		ctx.sm.handleHeadersMsg(&headersMsg{headers: headers,
+			peer: peer.Peer})
+	}
+	sendHeaders(blocks[:assumeValidSegmentSize])
+	sendHeaders(blocks[assumeValidSegmentSize : len(blocks)-1])
+	if ctx.sm.assumeValidHeight != assumeValid.Height() {
+		t.Fatalf("assumed valid height %d, want %d",
+			ctx.sm.assumeValidHeight, assumeValid.Height())
+	}
+	if len(ctx.sm.assumeValidAnchors) != 3 {
+		t.Fatalf("%d anchors, want 3", len(ctx.sm.assumeValidAnchors))
+	}
+	if len(ctx.sm.assumeValidWindow) != assumeValidSegmentSize {
+		t.Fatalf("%d ancestors in window, want %d",
+			len(ctx.sm.assumeValidWindow), assumeValidSegmentSize)
+	}
+
+	// The next segment is requested once less than half a segment of the
+	// window remains.  Headers that don't lead to the next anchor are
+	// ignored.
+	half := assumeValidSegmentSize / 2
+	for _, block := range blocks[:half+1] {
+		ctx.sm.handleBlockMsg(&blockMsg{block: block, peer: peer.Peer})
+	}
+	sendHeaders(blocks[assumeValidSegmentSize : len(blocks)-2])
+	if len(ctx.sm.assumeValidWindow) != half-1 {
+		t.Fatalf("%d ancestors in window, want %d",
+			len(ctx.sm.assumeValidWindow), half-1)
+	}
+	ctx.sm.handleBlockMsg(&blockMsg{block: blocks[half+1],
+		peer: peer.Peer})
+	sendHeaders(blocks[assumeValidSegmentSize : len(blocks)-1])
+
+	// The block with a failing script after the assumed valid block is
+	// rejected.
+	for _, block := range blocks[half+2:] {
+		ctx.sm.handleBlockMsg(&blockMsg{block: block, peer: peer.Peer})
+	}
+	if best := ctx.chain.BestSnapshot(); best.Hash != *assumeValid.Hash() {
+		t.Fatalf("best chain tip is %v at height %d, want %v",
+			best.Hash, best.Height, assumeValid.Hash())
+	}
+	if ctx.sm.assumeValidAnchors != nil || ctx.sm.assumeValidWindow != nil {
+		t.Fatal("ancestors remain after processing")
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	peerpkg "github.com/btcsuite/btcd/peer"
+)
+
+const (
+	// backpressureHighPercent is the percentage of the capacity of either
+	// message queue at which backpressure is asserted.
+	backpressureHighPercent = 75
+
+	// backpressureLowPercent is the percentage of the capacity of the
+	// message queues both must drop below before backpressure is released.
+	// It is lower than the high percentage so backpressure does not
+	// flap while the queues hover around the high percentage.
+	backpressureLowPercent = 50
+)
+
+// QueueDepth describes how many messages are waiting in the queues of the sync
+// manager.
+type QueueDepth struct {
+	// Msgs is the number of queued messages other than blocks.
+	Msgs int
+
+	// PriorityMsgs is the number of queued blocks, which are handled ahead
+	// of the other messages.
+	PriorityMsgs int
+
+	// Capacity is the number of messages each queue can hold.  Queueing a
+	// message to a full queue blocks until the sync manager handles
+	// another one.
+	Capacity int
+
+	// Backpressure is whether the queues are full enough that the reads
+	// from the peers filling them are paused.
+	Backpressure bool
+}
+
+// QueueDepth returns the current depth of the message queues.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) QueueDepth() QueueDepth {
+	sm.backpressureMtx.Lock()
+	backpressure := sm.backpressure
+	sm.backpressureMtx.Unlock()
+
+	return QueueDepth{
+		Msgs:         len(sm.msgChan),
+		PriorityMsgs: len(sm.priorityChan),
+		Capacity:     cap(sm.msgChan),
+		Backpressure: backpressure,
+	}
+}
+
+// queuedMsgPeer returns the peer the passed queued message came from or nil
+// when it did not come from a peer.  Only messages carrying data read from the
+// peer are attributed to it since those are the ones pausing its reads holds
+// back.
+func queuedMsgPeer(m interface{}) *peerpkg.Peer {
+	switch msg := m.(type) {
+	case *blockMsg:
+		return msg.peer
+	case *cmpctBlockMsg:
+		return msg.peer
+	case *blockTxnMsg:
+		return msg.peer
+	case *txMsg:
+		return msg.peer
+	case *invMsg:
+		return msg.peer
+	case *headersMsg:
+		return msg.peer
+	case *notFoundMsg:
+		return msg.peer
+	}
+	return nil
+}
+
+// noteMsgQueued counts the passed message, which is about to be queued, toward
+// the messages queued from the peer it came from.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) noteMsgQueued(m interface{}) {
+	peer := queuedMsgPeer(m)
+	if peer == nil {
+		return
+	}
+
+	sm.backpressureMtx.Lock()
+	sm.queuedMsgs[peer]++
+	sm.backpressureMtx.Unlock()
+}
+
+// noteMsgDequeued removes the passed message, which was just taken from a
+// queue, from the messages queued from the peer it came from.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) noteMsgDequeued(m interface{}) {
+	peer := queuedMsgPeer(m)
+	if peer == nil {
+		return
+	}
+
+	sm.backpressureMtx.Lock()
+	if sm.queuedMsgs[peer] <= 1 {
+		delete(sm.queuedMsgs, peer)
+	} else {
+		sm.queuedMsgs[peer]--
+	}
+	sm.backpressureMtx.Unlock()
+}
+
+// updateBackpressure asserts backpressure once either message queue fills up
+// to the high percentage of its capacity and releases it once both have drained
+// below the low percentage.  While it is asserted, the peer notifier is told to
+// pause reading from each peer with at least an even share of the queued
+// messages, which are the peers filling the queues, rather than having them
+// block on a full queue.  The other peers keep being read from.  All paused
+// peers are resumed once backpressure is released.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) updateBackpressure() {
+	// Unbuffered queues can't fill up.
+	if cap(sm.msgChan) == 0 {
+		return
+	}
+
+	sm.backpressureMtx.Lock()
+	defer sm.backpressureMtx.Unlock()
+
+	depth := len(sm.msgChan)
+	if n := len(sm.priorityChan); n > depth {
+		depth = n
+	}
+	percent := depth * 100 / cap(sm.msgChan)
+
+	// The notifications are sent with the lock held so notifications of
+	// concurrent changes can't be delivered out of order.
+	switch {
+	case !sm.backpressure && percent >= backpressureHighPercent:
+		log.Debugf("Asserting backpressure -- %d of %d queue slots in "+
+			"use", depth, cap(sm.msgChan))
+		sm.backpressure = true
+
+	case sm.backpressure && percent < backpressureLowPercent:
+		log.Debugf("Releasing backpressure -- %d of %d queue slots in "+
+			"use", depth, cap(sm.msgChan))
+		sm.backpressure = false
+		for peer := range sm.pausedPeers {
+			sm.peerNotifier.QueueBackpressure(peer, false)
+		}
+		sm.pausedPeers = make(map[*peerpkg.Peer]struct{})
+		return
+	}
+	if !sm.backpressure {
+		return
+	}
+
+	var total int
+	for _, queued := range sm.queuedMsgs {
+		total += queued
+	}
+	for peer, queued := range sm.queuedMsgs {
+		if _, paused := sm.pausedPeers[peer]; paused {
+			continue
+		}
+		if queued*len(sm.queuedMsgs) < total {
+			continue
+		}
+		log.Debugf("Pausing reads from peer %s -- %d of %d queued "+
+			"messages", peer, queued, total)
+		sm.pausedPeers[peer] = struct{}{}
+		sm.peerNotifier.QueueBackpressure(peer, true)
+	}
+}
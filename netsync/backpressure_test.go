@@ -0,0 +1,84 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestBackpressure ensures backpressure is asserted once either message queue
+// fills up, that only reading from the peers filling the queues is paused, that
+// it stays asserted until the queues drain below the low percentage and that
+// the paused peers are resumed then.
+func TestBackpressure(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	flooder := newTestPeer(t, ctx.params, "127.0.0.1:18555", true)
+	quiet := newTestPeer(t, ctx.params, "127.0.0.1:18556", true)
+	capacity := cap(ctx.sm.msgChan)
+	high := (capacity*backpressureHighPercent + 99) / 100
+
+	var want []backpressureNote
+	assertBackpressure := func(asserted bool) {
+		t.Helper()
+
+		ctx.notifier.mtx.Lock()
+		got := ctx.notifier.backpressure
+		ctx.notifier.mtx.Unlock()
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("backpressure notifications %v, want %v", got,
+				want)
+		}
+		if depth := ctx.sm.QueueDepth(); depth.Backpressure != asserted {
+			t.Fatalf("queue depth backpressure %v, want %v",
+				depth.Backpressure, asserted)
+		}
+	}
+
+	// Fill the queue up to just below the high percentage, mostly with
+	// messages from the flooding peer.  The sync manager is not started,
+	// so nothing is handled.
+	inv := wire.NewMsgInv()
+	ctx.sm.QueueInv(inv, quiet.Peer)
+	ctx.sm.QueueInv(inv, quiet.Peer)
+	for i := 0; i < high-3; i++ {
+		ctx.sm.QueueInv(inv, flooder.Peer)
+	}
+	assertBackpressure(false)
+
+	// Only reading from the flooding peer is paused once the queue fills
+	// up.
+	ctx.sm.QueueInv(inv, flooder.Peer)
+	want = append(want, backpressureNote{flooder.Peer, true})
+	assertBackpressure(true)
+	depth := ctx.sm.QueueDepth()
+	if depth.Msgs != high || depth.PriorityMsgs != 0 ||
+		depth.Capacity != capacity {
+
+		t.Fatalf("unexpected queue depth %+v", depth)
+	}
+	ctx.sm.QueueInv(inv, quiet.Peer)
+	assertBackpressure(true)
+
+	// Backpressure stays asserted until the queue drains below the low
+	// percentage, at which point the flooding peer is resumed.
+	for len(ctx.sm.msgChan)*100 >= capacity*backpressureLowPercent {
+		ctx.sm.updateBackpressure()
+		assertBackpressure(true)
+		ctx.sm.noteMsgDequeued(<-ctx.sm.msgChan)
+	}
+	ctx.sm.updateBackpressure()
+	want = append(want, backpressureNote{flooder.Peer, false})
+	assertBackpressure(false)
+
+	// A filling priority queue asserts backpressure as well.
+	for i := 0; i < high; i++ {
+		ctx.sm.QueueBlockTxn(&wire.MsgBlockTxn{}, flooder.Peer)
+	}
+	want = append(want, backpressureNote{flooder.Peer, true})
+	assertBackpressure(true)
+}
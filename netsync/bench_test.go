@@ -0,0 +1,136 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	peerpkg "github.com/btcsuite/btcd/peer"
+)
+
+// benchmarkBlockDownloadWindow simulates a headers-first download of a fixed
+// number of blocks using the passed block download window.  It reports the
+// number of getdata requests needed, which approximates the round trips to
+// the sync peer, along with the peak number of blocks in flight, which bounds
+// the memory used by blocks in transit.
+func benchmarkBlockDownloadWindow(b *testing.B, window int) {
+	const numBlocks = 5000
+
+	cfg := newTestConfig(b)
+	cfg.BlockDownloadWindow = window
+	ctx := newTestContextWithConfig(b, cfg)
+	sm := ctx.sm
+
+	// Use a disconnected sync peer so the requests aren't actually sent.
+	peer := newTestPeer(b, ctx.params, "127.0.0.1:18444", true)
+	peer.Disconnect()
+	state := &peerSyncState{
+		requestedBlocks: make(map[chainhash.Hash]struct{}),
+	}
+	sm.peerStates[peer.Peer] = state
+	sm.syncPeer = peer.Peer
+
+	sm.headerList = list.New()
+	for i := 0; i < numBlocks; i++ {
+		var hash chainhash.Hash
+		binary.LittleEndian.PutUint32(hash[:], uint32(i+1))
+		sm.headerList.PushBack(&headerNode{
+			height: int32(i + 1),
+			hash:   &hash,
+		})
+	}
+
+	var numGetData, peakInFlight int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sm.startHeader = sm.headerList.Front()
+		for sm.startHeader != nil || len(state.requestedBlocks) > 0 {
+			if sm.startHeader != nil &&
+				len(state.requestedBlocks) < sm.refillThreshold() {
+
+				sm.fetchHeaderBlocks()
+				numGetData++
+			}
+			if len(state.requestedBlocks) > peakInFlight {
+				peakInFlight = len(state.requestedBlocks)
+			}
+
+			// Simulate the receipt of a single block.
+			for hash := range state.requestedBlocks {
+				delete(state.requestedBlocks, hash)
+				delete(sm.requestedBlocks, hash)
+				break
+			}
+		}
+	}
+	b.ReportMetric(float64(numGetData)/float64(b.N), "getdata/op")
+	b.ReportMetric(float64(peakInFlight), "peak-inflight")
+}
+
+// BenchmarkBlockDownloadWindow sweeps the block download window to show the
+// tradeoff between the number of requests made to the sync peer and the number
+// of blocks held in flight.
+func BenchmarkBlockDownloadWindow(b *testing.B) {
+	for _, window := range []int{16, 128, 1024, DefaultBlockDownloadWindow} {
+		b.Run(fmt.Sprintf("window=%d", window), func(b *testing.B) {
+			benchmarkBlockDownloadWindow(b, window)
+		})
+	}
+}
+
+// benchmarkSyncCandidates measures the cost of choosing the sync peer when
+// the passed number of sync candidates are connected and at most
+// maxCandidates of them are tracked.
+func benchmarkSyncCandidates(b *testing.B, numPeers, maxCandidates int) {
+	cfg := newTestConfig(b)
+	cfg.MaxSyncCandidates = maxCandidates
+	ctx := newTestContextWithConfig(b, cfg)
+	sm := ctx.sm
+
+	// The peers are never connected since only their verified and
+	// advertised heights are needed to choose between them.
+	for i := 0; i < numPeers; i++ {
+		addr := fmt.Sprintf("127.0.0.1:%d", 10000+i)
+		peer, err := peerpkg.NewOutboundPeer(&peerpkg.Config{
+			ChainParams: ctx.params,
+		}, addr)
+		if err != nil {
+			b.Fatalf("unable to create peer: %v", err)
+		}
+		peer.UpdateLastBlockHeight(int32(rand.Intn(numPeers)))
+		sm.peerStates[peer] = &peerSyncState{
+			syncCandidate:  true,
+			verifiedHeight: int32(rand.Intn(numPeers)),
+		}
+		sm.trackSyncCandidate(peer)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if peer, _ := sm.pickSyncCandidate(0, false); peer == nil {
+			b.Fatal("no sync candidate selected")
+		}
+	}
+}
+
+// BenchmarkSyncCandidates compares the cost of choosing the sync peer among
+// many connected candidates when all of them are tracked against when only
+// the default maximum number are.
+func BenchmarkSyncCandidates(b *testing.B) {
+	for _, numPeers := range []int{125, 1000} {
+		for _, maxCandidates := range []int{numPeers, DefaultMaxSyncCandidates} {
+			name := fmt.Sprintf("peers=%d/tracked=%d", numPeers,
+				maxCandidates)
+			b.Run(name, func(b *testing.B) {
+				benchmarkSyncCandidates(b, numPeers, maxCandidates)
+			})
+		}
+	}
+}
@@ -19,6 +19,7 @@ type blockProgressLogger struct {
 	receivedLogBlocks int64
 	receivedLogTx     int64
 	lastBlockLogTime  time.Time
+	logInterval       time.Duration
 
 	subsystemLogger btclog.Logger
 	progressAction  string
@@ -30,9 +31,14 @@ type blockProgressLogger struct {
 //
 //	{progressAction} {numProcessed} {blocks|block} in the last {timePeriod}
 //	({numTxs}, height {lastBlockHeight}, {lastBlockTimeStamp})
-func newBlockProgressLogger(progressMessage string, logger btclog.Logger) *blockProgressLogger {
+//
+// At most one message is logged per the passed interval.
+func newBlockProgressLogger(progressMessage string, logger btclog.Logger,
+	interval time.Duration) *blockProgressLogger {
+
 	return &blockProgressLogger{
 		lastBlockLogTime: time.Now(),
+		logInterval:      interval,
 		progressAction:   progressMessage,
 		subsystemLogger:  logger,
 	}
@@ -40,7 +46,7 @@ func newBlockProgressLogger(progressMessage string, logger btclog.Logger) *block
 
 // LogBlockHeight logs a new block height as an information message to show
 // progress to the user. In order to prevent spam, it limits logging to one
-// message every 10 seconds with duration and totals included.
+// message per log interval with duration and totals included.
 func (b *blockProgressLogger) LogBlockHeight(block *btcutil.Block) {
 	b.Lock()
 	defer b.Unlock()
@@ -50,7 +56,7 @@ func (b *blockProgressLogger) LogBlockHeight(block *btcutil.Block) {
 
 	now := time.Now()
 	duration := now.Sub(b.lastBlockLogTime)
-	if duration < time.Second*10 {
+	if duration < b.logInterval {
 		return
 	}
 
@@ -0,0 +1,140 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	peerpkg "github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// findHeader returns the element of the header list for the header with the
+// passed hash or nil when it is not in the list.
+func (sm *SyncManager) findHeader(hash *chainhash.Hash) *list.Element {
+	for e := sm.headerList.Front(); e != nil; e = e.Next() {
+		if e.Value.(*headerNode).hash.IsEqual(hash) {
+			return e
+		}
+	}
+	return nil
+}
+
+// haveBodyRequest returns whether the body of the block with the passed hash
+// was fetched on demand and is either still in flight or being held.
+func (sm *SyncManager) haveBodyRequest(hash *chainhash.Hash) bool {
+	if _, ok := sm.pendingBodies[*hash]; ok {
+		return true
+	}
+	if _, ok := sm.bodyRequests[*hash]; !ok {
+		return false
+	}
+	_, inFlight := sm.requestedBlocks[*hash]
+	return inFlight
+}
+
+// fetchBlockBody returns the block with the passed hash when its body is
+// available.  When only the header of the block is known from a headers-first
+// sync, the body is requested from the sync peer ahead of its turn, unless it
+// is already in flight, and an error wrapping ErrBlockBodyNotAvailable is
+// returned.  Bodies fetched this way are held until the blocks before them
+// have been processed.  An error wrapping ErrBlockNotFound is returned when
+// neither the block nor its header is known and one wrapping ErrBlockCorrupt
+// when the stored block can't be read.
+//
+// It must be called from the blockHandler goroutine.
+func (sm *SyncManager) fetchBlockBody(hash *chainhash.Hash) (*btcutil.Block, error) {
+	if block, ok := sm.pendingBodies[*hash]; ok {
+		return block, nil
+	}
+	block, err := sm.loadBlock(hash)
+	if err == nil || errors.Is(err, ErrBlockCorrupt) {
+		return block, err
+	}
+
+	if !sm.headersFirstMode || sm.findHeader(hash) == nil {
+		return nil, fmt.Errorf("%w: %v", ErrBlockNotFound, hash)
+	}
+
+	// Nothing more to do when the body is already on its way.
+	if _, exists := sm.requestedBlocks[*hash]; exists {
+		return nil, fmt.Errorf("%w: %v", ErrBlockBodyNotAvailable, hash)
+	}
+
+	// The headers were served by the sync peer, so it has the body.
+	if sm.syncPeer == nil {
+		return nil, fmt.Errorf("%w: %v (no sync peer)",
+			ErrBlockBodyNotAvailable, hash)
+	}
+	log.Debugf("Fetching body of block %v from %s on demand", hash,
+		sm.syncPeer)
+	sm.requestedBlocks[*hash] = struct{}{}
+	sm.peerStates[sm.syncPeer].requestedBlocks[*hash] = struct{}{}
+	sm.bodyRequests[*hash] = struct{}{}
+	sm.noteBlockRequest(*hash)
+
+	iv := wire.NewInvVect(wire.InvTypeBlock, hash)
+	if sm.syncPeer.IsWitnessEnabled() {
+		iv.Type = wire.InvTypeWitnessBlock
+	}
+	gdmsg := wire.NewMsgGetData()
+	gdmsg.AddInvVect(iv)
+	sm.queueGetData(sm.syncPeer, gdmsg)
+
+	return nil, fmt.Errorf("%w: %v", ErrBlockBodyNotAvailable, hash)
+}
+
+// holdPendingBody returns whether the passed block was fetched on demand ahead
+// of its turn in headers-first mode, in which case it is held until the blocks
+// before it have been processed.
+func (sm *SyncManager) holdPendingBody(block *btcutil.Block) bool {
+	hash := block.Hash()
+	if _, ok := sm.bodyRequests[*hash]; !ok {
+		return false
+	}
+	delete(sm.bodyRequests, *hash)
+
+	// Blocks that are next in line are processed right away.
+	if !sm.headersFirstMode {
+		return false
+	}
+	front := sm.headerList.Front()
+	if front == nil || front.Value.(*headerNode).hash.IsEqual(hash) ||
+		sm.findHeader(hash) == nil {
+
+		return false
+	}
+
+	sm.pendingBodies[*hash] = block
+	return true
+}
+
+// processPendingBody processes the held body of the next block in the header
+// list, if there is one, as if it was delivered by the passed peer.  It
+// returns whether a body was processed.
+func (sm *SyncManager) processPendingBody(peer *peerpkg.Peer) bool {
+	front := sm.headerList.Front()
+	if front == nil {
+		return false
+	}
+	hash := front.Value.(*headerNode).hash
+	block, ok := sm.pendingBodies[*hash]
+	if !ok {
+		return false
+	}
+	delete(sm.pendingBodies, *hash)
+
+	state, exists := sm.peerStates[peer]
+	if !exists {
+		return false
+	}
+	state.requestedBlocks[*hash] = struct{}{}
+	sm.handleBlockMsg(&blockMsg{block: block, peer: peer})
+	return true
+}
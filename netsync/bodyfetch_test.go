@@ -0,0 +1,134 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestFetchBlockBody ensures fetching a block whose header is known but whose
+// body has not been downloaded requests the body from the sync peer once and
+// that the body is held until the blocks before it are processed.
+func TestFetchBlockBody(t *testing.T) {
+	// Create a chain of blocks using a separate chain.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 2; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18555", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	state := ctx.sm.peerStates[peer.Peer]
+
+	// Simulate a headers-first sync in which the headers of both blocks are
+	// known and none of the bodies have been requested yet.
+	ctx.sm.syncPeer = peer.Peer
+	ctx.sm.headersFirstMode = true
+	ctx.sm.nextCheckpoint = &chaincfg.Checkpoint{
+		Height: 100,
+		Hash:   &chainhash.Hash{0x01},
+	}
+	ctx.sm.headerList.Init()
+	for i, block := range blocks {
+		ctx.sm.headerList.PushBack(&headerNode{
+			height: int32(i + 1),
+			hash:   block.Hash(),
+		})
+	}
+	ctx.sm.startHeader = ctx.sm.headerList.Front()
+
+	// Unknown blocks are not fetched.
+	_, err := ctx.sm.fetchBlockBody(&chainhash.Hash{0x02})
+	if !errors.Is(err, ErrBlockNotFound) {
+		t.Fatalf("unexpected error for unknown block: %v", err)
+	}
+
+	// Fetching the second block must request its body.
+	hash := blocks[1].Hash()
+	_, err = ctx.sm.fetchBlockBody(hash)
+	if !errors.Is(err, ErrBlockBodyNotAvailable) {
+		t.Fatalf("unexpected error for header-only block: %v", err)
+	}
+	select {
+	case msg := <-peer.getData:
+		if len(msg.InvList) != 1 || msg.InvList[0].Hash != *hash ||
+			msg.InvList[0].Type != wire.InvTypeWitnessBlock {
+
+			t.Fatalf("unexpected getdata %v", msg.InvList)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for getdata")
+	}
+	if _, ok := state.requestedBlocks[*hash]; !ok {
+		t.Fatal("body fetch not tracked as requested from sync peer")
+	}
+
+	// Fetching it again while it is in flight must not request it again.
+	_, err = ctx.sm.fetchBlockBody(hash)
+	if !errors.Is(err, ErrBlockBodyNotAvailable) {
+		t.Fatalf("unexpected error for in flight block: %v", err)
+	}
+	select {
+	case msg := <-peer.getData:
+		t.Fatalf("unexpected repeated getdata %v", msg.InvList)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The regular download must skip the body already in flight.
+	ctx.sm.fetchHeaderBlocks()
+	select {
+	case msg := <-peer.getData:
+		if len(msg.InvList) != 1 ||
+			msg.InvList[0].Hash != *blocks[0].Hash() {
+
+			t.Fatalf("unexpected getdata %v", msg.InvList)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for getdata")
+	}
+
+	// The body is held until its parent is processed and is served by
+	// fetches meanwhile.
+	ctx.sm.handleBlockMsg(&blockMsg{block: blocks[1], peer: peer.Peer})
+	if ctx.chain.BestSnapshot().Height != 0 {
+		t.Fatal("block processed before its parent")
+	}
+	block, err := ctx.sm.fetchBlockBody(hash)
+	if err != nil {
+		t.Fatalf("unexpected error for held block: %v", err)
+	}
+	if !block.Hash().IsEqual(hash) {
+		t.Fatalf("fetched block %v, want %v", block.Hash(), hash)
+	}
+
+	// Delivering the parent processes both blocks.
+	ctx.sm.handleBlockMsg(&blockMsg{block: blocks[0], peer: peer.Peer})
+	best := ctx.chain.BestSnapshot()
+	if best.Height != 2 || !best.Hash.IsEqual(hash) {
+		t.Fatalf("best chain tip is %v (height %d), want %v (height 2)",
+			best.Hash, best.Height, hash)
+	}
+	if len(ctx.sm.pendingBodies) != 0 || len(state.requestedBlocks) != 0 {
+		t.Fatal("body fetch state not cleaned up")
+	}
+	if _, err := ctx.sm.fetchBlockBody(hash); err != nil {
+		t.Fatalf("unexpected error for processed block: %v", err)
+	}
+}
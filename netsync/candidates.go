@@ -0,0 +1,341 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"container/heap"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/addrmgr"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	peerpkg "github.com/btcsuite/btcd/peer"
+)
+
+// syncCandidate is a tracked sync candidate along with its index in the
+// candidate heap.
+type syncCandidate struct {
+	peer  *peerpkg.Peer
+	state *peerSyncState
+
+	// claimedHeight is the height of the latest block the peer claimed to
+	// have when it was tracked.  It only breaks ties between candidates
+	// that have proven the same progress since it can't be verified.
+	claimedHeight int32
+
+	// index is the index of the candidate in the heap.  It is maintained
+	// by the heap.Interface methods.
+	index int
+}
+
+// outranks returns whether the candidate is a better sync peer than the passed
+// one.  Candidates are ranked by the height of the latest block they have
+// proven to have, falling back to the height they claimed to have.
+func (c *syncCandidate) outranks(other *syncCandidate) bool {
+	if c.state.verifiedHeight != other.state.verifiedHeight {
+		return c.state.verifiedHeight > other.state.verifiedHeight
+	}
+	return c.claimedHeight > other.claimedHeight
+}
+
+// candidateHeap is a max-heap of sync candidates ordered by their rank.  It
+// implements heap.Interface.
+//
+// The rank of a candidate only changes when it proves more progress, at which
+// point its position is restored with heap.Fix, so the heap is always ordered.
+type candidateHeap []*syncCandidate
+
+// Ensure candidateHeap implements heap.Interface.
+var _ heap.Interface = (*candidateHeap)(nil)
+
+// Len returns the number of candidates in the heap.  It is part of the
+// heap.Interface implementation.
+func (h candidateHeap) Len() int { return len(h) }
+
+// Less returns whether the candidate at index i outranks the candidate at
+// index j.  It is part of the heap.Interface implementation.
+func (h candidateHeap) Less(i, j int) bool {
+	return h[i].outranks(h[j])
+}
+
+// Swap swaps the candidates at the passed indices.  It is part of the
+// heap.Interface implementation.
+func (h candidateHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+// Push adds the passed candidate to the end of the heap.  It is part of the
+// heap.Interface implementation.
+func (h *candidateHeap) Push(x interface{}) {
+	c := x.(*syncCandidate)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+
+// Pop removes the candidate at the end of the heap and returns it.  It is part
+// of the heap.Interface implementation.
+func (h *candidateHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	c := old[n-1]
+	old[n-1] = nil
+	c.index = -1
+	*h = old[:n-1]
+	return c
+}
+
+// firstSyncPeerSelector is the default sync peer selector, which selects the
+// first of the equally good sync candidates.
+type firstSyncPeerSelector struct{}
+
+// Ensure firstSyncPeerSelector implements the SyncPeerSelector interface.
+var _ SyncPeerSelector = firstSyncPeerSelector{}
+
+// SelectSyncPeer returns the first of the passed candidates.  It is part of
+// the SyncPeerSelector interface implementation.
+func (firstSyncPeerSelector) SelectSyncPeer(candidates []*peerpkg.Peer,
+	_ int32) *peerpkg.Peer {
+
+	return candidates[0]
+}
+
+// peerNetGroup returns the network group of the passed peer, such as the /16
+// of an IPv4 address, or an empty string when its address is unknown.
+func peerNetGroup(peer *peerpkg.Peer) string {
+	na := peer.NA()
+	if na == nil {
+		return ""
+	}
+	return addrmgr.GroupKey(na)
+}
+
+// diverseSyncCandidates returns the passed sync candidates whose network group
+// is not shared with any other connected peer when diverse sync peers are
+// preferred.  An attacker controlling many addresses within a few network
+// groups then can't easily become the sync peer by outnumbering the other
+// candidates.  All of the candidates are returned when the preference is
+// disabled or none of them are in a distinct network group.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) diverseSyncCandidates(
+	candidates []*peerpkg.Peer) []*peerpkg.Peer {
+
+	if !sm.diverseSyncPeer {
+		return candidates
+	}
+	var diverse []*peerpkg.Peer
+	for _, peer := range candidates {
+		state, exists := sm.peerStates[peer]
+		if !exists || sm.netGroups[state.netGroup] > 1 {
+			continue
+		}
+		diverse = append(diverse, peer)
+	}
+	if len(diverse) == 0 {
+		return candidates
+	}
+	return diverse
+}
+
+// candidateSummary summarizes the sync candidates and the sync peer.
+type candidateSummary struct {
+	// candidates is the number of sync candidates.
+	candidates int
+
+	// minHeight and maxHeight are the lowest and highest heights of the
+	// latest blocks the candidates are known to have.  They are zero when
+	// there are no candidates.
+	minHeight int32
+	maxHeight int32
+
+	// syncPeer is the current sync peer or nil when there is none.
+	syncPeer *peerpkg.Peer
+}
+
+// String returns the summary as a single line suitable for logging.
+func (s *candidateSummary) String() string {
+	syncPeer := "none"
+	if s.syncPeer != nil {
+		syncPeer = fmt.Sprintf("%s (height %d)", s.syncPeer,
+			s.syncPeer.LastBlock())
+	}
+	if s.candidates == 0 {
+		return fmt.Sprintf("0 sync candidates, sync peer %s", syncPeer)
+	}
+	return fmt.Sprintf("%d sync candidates (heights %d-%d), sync peer %s",
+		s.candidates, s.minHeight, s.maxHeight, syncPeer)
+}
+
+// candidateSummary returns a summary of the current sync candidates and the
+// sync peer.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) candidateSummary() *candidateSummary {
+	summary := &candidateSummary{
+		candidates: sm.syncCandidates.Len(),
+		syncPeer:   sm.syncPeer,
+	}
+	for i, c := range sm.syncCandidates {
+		height := c.peer.LastBlock()
+		if i == 0 || height < summary.minHeight {
+			summary.minHeight = height
+		}
+		if i == 0 || height > summary.maxHeight {
+			summary.maxHeight = height
+		}
+	}
+	return summary
+}
+
+// logCandidateSummary logs a summary of the sync candidates and the sync peer
+// while the chain is not current.  Once the chain is current the per-block
+// logging suffices.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) logCandidateSummary() {
+	if sm.current() {
+		return
+	}
+	log.Infof("Sync status: %v", sm.candidateSummary())
+}
+
+// noteBlockDelivery folds the time the peer with the passed state took to
+// deliver a block requested from it into its average block delivery time.
+func noteBlockDelivery(state *peerSyncState, elapsed time.Duration) {
+	if state.deliveries == 0 {
+		state.deliveryTime = elapsed
+	} else {
+		state.deliveryTime += (elapsed - state.deliveryTime) / 8
+	}
+	state.deliveries++
+}
+
+// betterSyncPeer returns whether the candidate with the passed state is
+// markedly better to sync from than the sync peer with the passed state.  That
+// is the case when it has proven to have more than syncPeerHeightMargin blocks
+// beyond those the sync peer has proven to have or, when enough deliveries
+// from both have been measured, it delivers requested blocks faster by at least
+// syncPeerDeliveryFactor.  The heights peers advertise are never trusted for
+// this since a peer could claim any height to take over the sync.
+func betterSyncPeer(candidate, syncPeer *peerSyncState) bool {
+	if candidate.verifiedHeight-syncPeer.verifiedHeight > syncPeerHeightMargin {
+		return true
+	}
+	if candidate.deliveries < minDeliverySamples ||
+		syncPeer.deliveries < minDeliverySamples {
+
+		return false
+	}
+	return candidate.deliveryTime*syncPeerDeliveryFactor <=
+		syncPeer.deliveryTime
+}
+
+// maybeSwitchSyncPeer switches the sync peer to the passed candidate when it is
+// markedly better than the current sync peer while the chain is not current and
+// returns whether it did.  Switches are at least the sync peer switch interval
+// apart so the sync does not thrash between peers.  The blocks in flight from
+// the previous sync peer are left to arrive rather than requested again, and
+// are only requested from the new sync peer should the previous one fail to
+// deliver them within the stall timeout.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) maybeSwitchSyncPeer(peer *peerpkg.Peer) bool {
+	if sm.syncPeer == nil || peer == sm.syncPeer || sm.syncCancelled ||
+		sm.current() {
+
+		return false
+	}
+	if !sm.lastSyncPeerSwitch.IsZero() &&
+		time.Since(sm.lastSyncPeerSwitch) < sm.switchInterval {
+
+		return false
+	}
+	state, exists := sm.peerStates[peer]
+	if !exists || !state.syncCandidate || len(state.pendingCheckpoints) > 0 {
+		return false
+	}
+	syncPeerState, exists := sm.peerStates[sm.syncPeer]
+	if !exists || !betterSyncPeer(state, syncPeerState) {
+		return false
+	}
+
+	// Once the segwit soft-fork package has activated only witness enabled
+	// peers are synced from.
+	segwitActive, err := sm.chain.IsDeploymentActive(chaincfg.DeploymentSegwit)
+	if err != nil {
+		log.Errorf("Unable to query for segwit soft-fork state: %v", err)
+		return false
+	}
+	if segwitActive && !peer.IsWitnessEnabled() {
+		return false
+	}
+
+	log.Infof("Switching sync peer from %s (verified height %d) to %s "+
+		"(verified height %d)", sm.syncPeer, syncPeerState.verifiedHeight,
+		peer, state.verifiedHeight)
+
+	sm.previousSyncPeer = sm.syncPeer
+	if sm.headersFirstMode {
+		best := sm.chain.BestSnapshot()
+		sm.resetHeaderState(&best.Hash, best.Height)
+	}
+	sm.lastSyncPeerSwitch = time.Now()
+	sm.syncPeer = nil
+	sm.beginSync(peer)
+
+	// Starting the sync forgets the blocks in flight, so keep expecting
+	// those from the previous sync peer and fall back to the new sync peer
+	// for them.
+	for hash := range syncPeerState.requestedBlocks {
+		sm.requestedBlocks[hash] = struct{}{}
+		sm.addBlockAlternate(hash, peer)
+	}
+	return true
+}
+
+// inFlightFromPreviousSyncPeer returns whether the block with the passed hash
+// is still in flight from the previous sync peer.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) inFlightFromPreviousSyncPeer(hash *chainhash.Hash) bool {
+	if sm.previousSyncPeer == nil {
+		return false
+	}
+	state, exists := sm.peerStates[sm.previousSyncPeer]
+	if !exists {
+		return false
+	}
+	_, inFlight := state.requestedBlocks[*hash]
+	return inFlight
+}
+
+// expirePreviousSyncPeer stops waiting for the blocks in flight from the
+// previous sync peer once it has delivered all of them or the stall timeout has
+// elapsed since the switch, in which case the overdue blocks are requested from
+// alternate peers, including the new sync peer.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) expirePreviousSyncPeer() {
+	if sm.previousSyncPeer == nil {
+		return
+	}
+	state, exists := sm.peerStates[sm.previousSyncPeer]
+	if !exists || len(state.requestedBlocks) == 0 {
+		sm.previousSyncPeer = nil
+		return
+	}
+	if time.Since(sm.lastSyncPeerSwitch) <= sm.maxStallDuration {
+		return
+	}
+
+	log.Debugf("Requesting %d blocks overdue from previous sync peer %s "+
+		"from alternate peers", len(state.requestedBlocks),
+		sm.previousSyncPeer)
+	sm.clearRequestedState(state)
+	sm.previousSyncPeer = nil
+}
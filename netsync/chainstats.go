@@ -0,0 +1,176 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// maxCachedBlockStats is the maximum number of blocks at the tip of the main
+// chain whose statistics are cached, which covers a difficulty retarget period
+// on the main network.
+const maxCachedBlockStats = 2016
+
+// ChainStats houses statistics about the blocks at the tip of the main chain.
+type ChainStats struct {
+	// Blocks is the number of blocks the statistics cover, which is less
+	// than the requested window when the main chain is shorter.
+	Blocks int
+
+	// AvgBlockInterval is the average time between the timestamps of the
+	// blocks and their parents.
+	AvgBlockInterval time.Duration
+
+	// AvgTxsPerBlock is the average number of transactions per block.
+	AvgTxsPerBlock float64
+
+	// TotalSize is the total serialized size of the blocks in bytes.
+	TotalSize int64
+}
+
+// blockStats houses the statistics of a single main chain block.
+type blockStats struct {
+	hash      chainhash.Hash
+	height    int32
+	timestamp time.Time
+	numTxs    int
+	size      int
+}
+
+// newBlockStats returns the statistics of the passed block.
+func newBlockStats(block *btcutil.Block) blockStats {
+	msgBlock := block.MsgBlock()
+	return blockStats{
+		hash:      *block.Hash(),
+		height:    block.Height(),
+		timestamp: msgBlock.Header.Timestamp,
+		numTxs:    len(msgBlock.Transactions),
+		size:      msgBlock.SerializeSize(),
+	}
+}
+
+// blockStatsCache caches the statistics of the blocks at the tip of the main
+// chain as they are connected so they don't need to be loaded from the
+// database again.  The cached blocks are always consecutive main chain blocks.
+//
+// A blockStatsCache is safe for concurrent access.
+type blockStatsCache struct {
+	mtx    sync.Mutex
+	blocks []blockStats
+}
+
+// connect adds the statistics of the passed block, which was connected to the
+// main chain, evicting the oldest entry when the cache is full.  The cache is
+// restarted when the block does not extend the cached blocks.
+func (c *blockStatsCache) connect(block *btcutil.Block) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	n := len(c.blocks)
+	if n > 0 && c.blocks[n-1].hash != block.MsgBlock().Header.PrevBlock {
+		c.blocks = nil
+	}
+	if len(c.blocks) >= maxCachedBlockStats {
+		c.blocks = c.blocks[1:]
+	}
+	c.blocks = append(c.blocks, newBlockStats(block))
+}
+
+// disconnect removes the statistics of the passed block, which was
+// disconnected from the main chain.
+func (c *blockStatsCache) disconnect(block *btcutil.Block) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	n := len(c.blocks)
+	if n > 0 && c.blocks[n-1].hash == *block.Hash() {
+		c.blocks = c.blocks[:n-1]
+		return
+	}
+	c.blocks = nil
+}
+
+// lookup returns the cached statistics of the block with the passed hash at
+// the passed height.
+func (c *blockStatsCache) lookup(height int32,
+	hash *chainhash.Hash) (blockStats, bool) {
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if len(c.blocks) == 0 {
+		return blockStats{}, false
+	}
+	i := int(height - c.blocks[0].height)
+	if i < 0 || i >= len(c.blocks) || c.blocks[i].hash != *hash {
+		return blockStats{}, false
+	}
+	return c.blocks[i], true
+}
+
+// mainChainBlockStats returns the statistics of the main chain block at the
+// passed height, loading the block from the database when it is not cached.
+func (sm *SyncManager) mainChainBlockStats(height int32) (blockStats, error) {
+	hash, err := sm.chain.BlockHashByHeight(height)
+	if err != nil {
+		return blockStats{}, err
+	}
+	if stats, ok := sm.blockStats.lookup(height, hash); ok {
+		return stats, nil
+	}
+	block, err := sm.chain.BlockByHash(hash)
+	if err != nil {
+		return blockStats{}, err
+	}
+	return newBlockStats(block), nil
+}
+
+// ChainStats returns the average block interval, the average number of
+// transactions per block and the total size of the last window blocks of the
+// main chain.  The window is limited to the height of the main chain since the
+// genesis block has no parent to measure its interval from.  The statistics of
+// recently connected blocks are cached and the other blocks are loaded from the
+// database.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) ChainStats(window int) (ChainStats, error) {
+	best := sm.chain.BestSnapshot()
+	if window > int(best.Height) {
+		window = int(best.Height)
+	}
+	if window <= 0 {
+		return ChainStats{}, nil
+	}
+
+	start := best.Height - int32(window) + 1
+	parent, err := sm.mainChainBlockStats(start - 1)
+	if err != nil {
+		return ChainStats{}, err
+	}
+	var numTxs int
+	var totalSize int64
+	last := parent
+	for height := start; height <= best.Height; height++ {
+		stats, err := sm.mainChainBlockStats(height)
+		if err != nil {
+			return ChainStats{}, err
+		}
+		numTxs += stats.numTxs
+		totalSize += int64(stats.size)
+		last = stats
+	}
+
+	elapsed := last.timestamp.Sub(parent.timestamp)
+	return ChainStats{
+		Blocks:           window,
+		AvgBlockInterval: elapsed / time.Duration(window),
+		AvgTxsPerBlock:   float64(numTxs) / float64(window),
+		TotalSize:        totalSize,
+	}, nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+)
+
+// TestChainStats ensures the statistics over a window of blocks at the tip of
+// the main chain are computed from both cached and stored blocks and that the
+// window is limited to the height of the main chain.
+func TestChainStats(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+
+	// Extend the chain with blocks that are 1, 2, 3, 4 and 5 minutes
+	// apart.
+	timestamp := ctx.params.GenesisBlock.Header.Timestamp
+	var sizes []int64
+	for i := 1; i <= 5; i++ {
+		msgBlock := ctx.createBlock(t).MsgBlock()
+		timestamp = timestamp.Add(time.Duration(i) * time.Minute)
+		msgBlock.Header.Timestamp = timestamp
+		block := solveBlock(msgBlock)
+		_, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		sizes = append(sizes, int64(msgBlock.SerializeSize()))
+	}
+	totalSize := func(from int) int64 {
+		var total int64
+		for _, size := range sizes[from:] {
+			total += size
+		}
+		return total
+	}
+
+	tests := []struct {
+		window int
+		want   ChainStats
+	}{{
+		window: 0,
+		want:   ChainStats{},
+	}, {
+		window: 3,
+		want: ChainStats{
+			Blocks:           3,
+			AvgBlockInterval: 4 * time.Minute,
+			AvgTxsPerBlock:   1,
+			TotalSize:        totalSize(2),
+		},
+	}, {
+		window: 100,
+		want: ChainStats{
+			Blocks:           5,
+			AvgBlockInterval: 3 * time.Minute,
+			AvgTxsPerBlock:   1,
+			TotalSize:        totalSize(0),
+		},
+	}}
+
+	check := func() {
+		t.Helper()
+
+		for _, test := range tests {
+			got, err := ctx.sm.ChainStats(test.window)
+			if err != nil {
+				t.Fatalf("ChainStats(%d): unexpected error: %v",
+					test.window, err)
+			}
+			if got != test.want {
+				t.Fatalf("ChainStats(%d) = %+v, want %+v",
+					test.window, got, test.want)
+			}
+		}
+	}
+
+	// The connected blocks are cached.
+	ctx.sm.blockStats.mtx.Lock()
+	cached := len(ctx.sm.blockStats.blocks)
+	ctx.sm.blockStats.mtx.Unlock()
+	if cached != 5 {
+		t.Fatalf("%d blocks cached, want 5", cached)
+	}
+	check()
+
+	// The same statistics are computed from the stored blocks.
+	ctx.sm.blockStats.mtx.Lock()
+	ctx.sm.blockStats.blocks = nil
+	ctx.sm.blockStats.mtx.Unlock()
+	check()
+}
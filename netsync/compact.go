@@ -0,0 +1,366 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/aead/siphash"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	peerpkg "github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// invalidCmpctBlockBanScore is the persistent ban score added to a peer that
+// sends a malformed cmpctblock or blocktxn message.
+const invalidCmpctBlockBanScore = 100
+
+var (
+	// errShortIDCollision is returned when a compact block contains the
+	// same short id more than once, in which case it can't be
+	// reconstructed and the full block must be requested instead.
+	errShortIDCollision = errors.New("duplicate short id in compact block")
+
+	// errReconstructMismatch is returned when the block reconstructed from a
+	// compact block does not match its header, which happens when a
+	// transaction that merely shares the short id of a block transaction
+	// was used.
+	errReconstructMismatch = errors.New("reconstructed block does not " +
+		"match its header")
+)
+
+// cmpctShortIDKey returns the SipHash key used to compute the short ids of the
+// transactions of the compact block with the passed header and nonce.  It is
+// the first 16 bytes of the SHA256 of the serialized header followed by the
+// little-endian nonce.
+func cmpctShortIDKey(header *wire.BlockHeader, nonce uint64) [siphash.KeySize]byte {
+	var buf bytes.Buffer
+	buf.Grow(wire.MaxBlockHeaderPayload + 8)
+	_ = header.Serialize(&buf)
+	var nonceBytes [8]byte
+	binary.LittleEndian.PutUint64(nonceBytes[:], nonce)
+	buf.Write(nonceBytes[:])
+
+	hash := sha256.Sum256(buf.Bytes())
+	var key [siphash.KeySize]byte
+	copy(key[:], hash[:])
+	return key
+}
+
+// cmpctShortID returns the short id of the transaction with the passed witness
+// hash using the passed SipHash key.
+func cmpctShortID(key *[siphash.KeySize]byte, hash *chainhash.Hash) uint64 {
+	return siphash.Sum64(hash[:], key) & wire.MaxCmpctShortID
+}
+
+// NewCmpctBlock returns a cmpctblock message for the passed block that uses the
+// passed nonce to derive the short ids of its transactions.  Only the coinbase
+// transaction is prefilled since peers can't have it yet.  The short ids are
+// computed from the witness transaction ids, so the message must be sent with
+// the witness encoding.
+func NewCmpctBlock(block *btcutil.Block, nonce uint64) *wire.MsgCmpctBlock {
+	msgBlock := block.MsgBlock()
+	msg := wire.NewMsgCmpctBlock(&msgBlock.Header, nonce)
+	if len(msgBlock.Transactions) == 0 {
+		return msg
+	}
+
+	msg.PrefilledTxs = []wire.PrefilledTx{{
+		Index: 0,
+		Tx:    msgBlock.Transactions[0],
+	}}
+	key := cmpctShortIDKey(&msgBlock.Header, nonce)
+	msg.ShortIDs = make([]uint64, 0, len(msgBlock.Transactions)-1)
+	for _, tx := range block.Transactions()[1:] {
+		msg.ShortIDs = append(msg.ShortIDs,
+			cmpctShortID(&key, tx.WitnessHash()))
+	}
+	return msg
+}
+
+// partialBlock is a block received as a compact block that is being
+// reconstructed from known transactions and those requested from the peer that
+// sent it.
+type partialBlock struct {
+	hash    chainhash.Hash
+	header  wire.BlockHeader
+	txs     []*wire.MsgTx
+	missing []uint32
+}
+
+// newPartialBlock returns a partial block for the passed compact block with
+// the transactions found among the passed candidates, which are typically the
+// transactions in the memory pool, filled in.  The indexes of the transactions
+// that were not found are listed in the missing field of the partial block.
+//
+// errShortIDCollision is returned when the compact block contains the same
+// short id more than once.  Any other error means the compact block is
+// malformed.
+func newPartialBlock(msg *wire.MsgCmpctBlock,
+	candidates []*btcutil.Tx) (*partialBlock, error) {
+
+	numTxs := msg.TxCount()
+	if numTxs == 0 {
+		return nil, errors.New("compact block has no transactions")
+	}
+
+	txs := make([]*wire.MsgTx, numTxs)
+	for _, prefilled := range msg.PrefilledTxs {
+		if int(prefilled.Index) >= numTxs {
+			return nil, fmt.Errorf("prefilled transaction index %d "+
+				"is beyond the %d transactions of the block",
+				prefilled.Index, numTxs)
+		}
+		txs[prefilled.Index] = prefilled.Tx
+	}
+
+	// Map the short ids to the indexes of the transactions they stand for,
+	// which are the indexes not taken by prefilled transactions in order.
+	shortIDs := make(map[uint64]uint32, len(msg.ShortIDs))
+	var index uint32
+	for _, shortID := range msg.ShortIDs {
+		for txs[index] != nil {
+			index++
+		}
+		if _, exists := shortIDs[shortID]; exists {
+			return nil, errShortIDCollision
+		}
+		shortIDs[shortID] = index
+		index++
+	}
+
+	// Fill in the candidates matching the short ids.  When several
+	// candidates match the same short id, it's unknown which one is in the
+	// block, so the transaction is treated as missing.
+	key := cmpctShortIDKey(&msg.Header, msg.Nonce)
+	collided := make(map[uint32]struct{})
+	for _, tx := range candidates {
+		index, exists := shortIDs[cmpctShortID(&key, tx.WitnessHash())]
+		if !exists {
+			continue
+		}
+		if _, exists := collided[index]; exists {
+			continue
+		}
+		if txs[index] != nil {
+			txs[index] = nil
+			collided[index] = struct{}{}
+			continue
+		}
+		txs[index] = tx.MsgTx()
+	}
+
+	pb := &partialBlock{
+		hash:   msg.Header.BlockHash(),
+		header: msg.Header,
+		txs:    txs,
+	}
+	for i, tx := range txs {
+		if tx == nil {
+			pb.missing = append(pb.missing, uint32(i))
+		}
+	}
+	return pb, nil
+}
+
+// fill fills in the missing transactions of the partial block with the passed
+// transactions, which must be in the same order as the missing indexes.
+func (pb *partialBlock) fill(txs []*wire.MsgTx) error {
+	if len(txs) != len(pb.missing) {
+		return fmt.Errorf("got %d transactions for the %d missing "+
+			"transactions of block %v", len(txs), len(pb.missing),
+			pb.hash)
+	}
+	for i, index := range pb.missing {
+		pb.txs[index] = txs[i]
+	}
+	pb.missing = nil
+	return nil
+}
+
+// reconstruct returns the block reconstructed from the partial block, which
+// must not be missing any transactions.  errReconstructMismatch is returned
+// when the transactions do not match the header.
+func (pb *partialBlock) reconstruct() (*btcutil.Block, error) {
+	msgBlock := wire.NewMsgBlock(&pb.header)
+	msgBlock.Transactions = pb.txs
+	block := btcutil.NewBlock(msgBlock)
+
+	merkles := blockchain.BuildMerkleTreeStore(block.Transactions(), false)
+	if *merkles[len(merkles)-1] != pb.header.MerkleRoot {
+		return nil, errReconstructMismatch
+	}
+	if err := blockchain.ValidateWitnessCommitment(block); err != nil {
+		return nil, errReconstructMismatch
+	}
+	return block, nil
+}
+
+// cmpctBlockMsg packages a bitcoin cmpctblock message and the peer it came from
+// together so the block handler has access to that information.
+type cmpctBlockMsg struct {
+	cmpctBlock *wire.MsgCmpctBlock
+	peer       *peerpkg.Peer
+}
+
+// blockTxnMsg packages a bitcoin blocktxn message and the peer it came from
+// together so the block handler has access to that information.
+type blockTxnMsg struct {
+	blockTxn *wire.MsgBlockTxn
+	peer     *peerpkg.Peer
+}
+
+// handleInvalidCmpctBlock penalizes the passed peer for sending a malformed
+// cmpctblock or blocktxn message.
+func (sm *SyncManager) handleInvalidCmpctBlock(peer *peerpkg.Peer,
+	reason string) {
+
+	if sm.addBanScore == nil {
+		log.Warnf("Peer %s sent an invalid compact block: %s -- "+
+			"disconnecting", peer, reason)
+		peer.Disconnect()
+		return
+	}
+
+	log.Debugf("Peer %s sent an invalid compact block: %s", peer, reason)
+	sm.addBanScore(peer, invalidCmpctBlockBanScore, 0, reason)
+}
+
+// requestFullBlock requests the block with the passed hash from the passed
+// peer in full, which is done when it could not be reconstructed from a
+// compact block.
+func (sm *SyncManager) requestFullBlock(peer *peerpkg.Peer,
+	state *peerSyncState, hash *chainhash.Hash) {
+
+	limitAdd(sm.requestedBlocks, *hash, maxRequestedBlocks)
+	limitAdd(state.requestedBlocks, *hash, maxRequestedBlocks)
+
+	iv := wire.NewInvVect(wire.InvTypeBlock, hash)
+	if peer.IsWitnessEnabled() {
+		iv.Type = wire.InvTypeWitnessBlock
+	}
+	gdmsg := wire.NewMsgGetData()
+	gdmsg.AddInvVect(iv)
+	sm.queueGetData(peer, gdmsg)
+}
+
+// processPartialBlock reconstructs the passed partial block, which is not
+// missing any transactions, and processes it as a block sent by the passed
+// peer.  The full block is requested when the reconstructed block does not
+// match its header.
+func (sm *SyncManager) processPartialBlock(peer *peerpkg.Peer,
+	state *peerSyncState, pb *partialBlock) {
+
+	block, err := pb.reconstruct()
+	if err != nil {
+		log.Debugf("Unable to reconstruct block %v from %s: %v -- "+
+			"requesting the full block", pb.hash, peer, err)
+		sm.requestFullBlock(peer, state, &pb.hash)
+		return
+	}
+
+	// The block is treated as requested since it was either requested as a
+	// compact block or extends the best chain.
+	limitAdd(sm.requestedBlocks, pb.hash, maxRequestedBlocks)
+	limitAdd(state.requestedBlocks, pb.hash, maxRequestedBlocks)
+	sm.handleBlockMsg(&blockMsg{block: block, peer: peer})
+}
+
+// handleCmpctBlockMsg handles cmpctblock messages from all peers.  The block
+// is reconstructed from the transactions in the memory pool and any missing
+// transactions are requested from the peer with a getblocktxn message.
+// Compact blocks that were not requested are only reconstructed when they
+// extend the best chain.
+func (sm *SyncManager) handleCmpctBlockMsg(cmsg *cmpctBlockMsg) {
+	peer := cmsg.peer
+	state, exists := sm.peerStates[peer]
+	if !exists {
+		log.Warnf("Received cmpctblock message from unknown peer %s",
+			peer)
+		return
+	}
+
+	msg := cmsg.cmpctBlock
+	hash := msg.Header.BlockHash()
+	haveInv, err := sm.haveInventory(wire.NewInvVect(wire.InvTypeBlock, &hash))
+	if err == nil && haveInv {
+		log.Debugf("Ignoring compact block %v from %s -- already have "+
+			"it", hash, peer)
+		delete(state.requestedBlocks, hash)
+		delete(sm.requestedBlocks, hash)
+		return
+	}
+	_, requested := state.requestedBlocks[hash]
+	if !requested && msg.Header.PrevBlock != sm.chain.BestSnapshot().Hash {
+		log.Debugf("Ignoring unrequested compact block %v from %s -- "+
+			"does not extend the best chain", hash, peer)
+		return
+	}
+
+	var candidates []*btcutil.Tx
+	if sm.txMemPool != nil {
+		for _, txDesc := range sm.txMemPool.TxDescs() {
+			candidates = append(candidates, txDesc.Tx)
+		}
+	}
+	pb, err := newPartialBlock(msg, candidates)
+	if err == errShortIDCollision {
+		log.Debugf("Unable to reconstruct block %v from %s: %v -- "+
+			"requesting the full block", hash, peer, err)
+		sm.requestFullBlock(peer, state, &hash)
+		return
+	}
+	if err != nil {
+		sm.handleInvalidCmpctBlock(peer, err.Error())
+		return
+	}
+
+	if len(pb.missing) == 0 {
+		sm.processPartialBlock(peer, state, pb)
+		return
+	}
+
+	// Request the missing transactions.  Only the latest compact block of
+	// each peer is reconstructed, so any previous one is forgotten.
+	log.Debugf("Requesting %d of the %d transactions of compact block "+
+		"%v from %s", len(pb.missing), len(pb.txs), hash, peer)
+	limitAdd(sm.requestedBlocks, hash, maxRequestedBlocks)
+	limitAdd(state.requestedBlocks, hash, maxRequestedBlocks)
+	sm.cmpctBlocks[peer] = pb
+	peer.QueueMessage(wire.NewMsgGetBlockTxn(&hash, pb.missing), nil)
+}
+
+// handleBlockTxnMsg handles blocktxn messages from all peers, which provide
+// the missing transactions of a compact block that is being reconstructed.
+func (sm *SyncManager) handleBlockTxnMsg(bmsg *blockTxnMsg) {
+	peer := bmsg.peer
+	state, exists := sm.peerStates[peer]
+	if !exists {
+		log.Warnf("Received blocktxn message from unknown peer %s",
+			peer)
+		return
+	}
+
+	msg := bmsg.blockTxn
+	pb, exists := sm.cmpctBlocks[peer]
+	if !exists || pb.hash != msg.BlockHash {
+		log.Debugf("Ignoring unrequested transactions of block %v "+
+			"from %s", msg.BlockHash, peer)
+		return
+	}
+	delete(sm.cmpctBlocks, peer)
+
+	if err := pb.fill(msg.Txs); err != nil {
+		sm.handleInvalidCmpctBlock(peer, err.Error())
+		return
+	}
+	sm.processPartialBlock(peer, state, pb)
+}
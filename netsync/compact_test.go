@@ -0,0 +1,194 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// newCmpctTestBlock returns a block with a coinbase and the passed number of
+// other distinct transactions and a merkle root committing to them.
+func newCmpctTestBlock(numTxs int) *btcutil.Block {
+	msgBlock := wire.NewMsgBlock(&wire.BlockHeader{
+		Version:   1,
+		Timestamp: time.Unix(1700000000, 0),
+		Bits:      0x207fffff,
+	})
+	for i := 0; i <= numTxs; i++ {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		prevOut := wire.OutPoint{Index: uint32(i)}
+		if i == 0 {
+			prevOut = wire.OutPoint{Index: wire.MaxPrevOutIndex}
+		}
+		tx.AddTxIn(wire.NewTxIn(&prevOut, []byte{0x51}, nil))
+		tx.AddTxOut(wire.NewTxOut(int64(i+1), []byte{0x51}))
+		msgBlock.AddTransaction(tx)
+	}
+	block := btcutil.NewBlock(msgBlock)
+	merkles := blockchain.BuildMerkleTreeStore(block.Transactions(), false)
+	msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+	return btcutil.NewBlock(msgBlock)
+}
+
+// TestPartialBlock ensures compact blocks are reconstructed from the candidate
+// transactions and the missing transactions, and that collisions and
+// mismatching transactions are detected.
+func TestPartialBlock(t *testing.T) {
+	block := newCmpctTestBlock(4)
+	txs := block.Transactions()
+	msg := NewCmpctBlock(block, 42)
+	if len(msg.PrefilledTxs) != 1 || msg.PrefilledTxs[0].Index != 0 ||
+		len(msg.ShortIDs) != 4 {
+
+		t.Fatalf("unexpected compact block: %d prefilled, %d short ids",
+			len(msg.PrefilledTxs), len(msg.ShortIDs))
+	}
+
+	// Only the transactions that are not candidates are missing.
+	pb, err := newPartialBlock(msg, []*btcutil.Tx{txs[1], txs[3]})
+	if err != nil {
+		t.Fatalf("unable to create partial block: %v", err)
+	}
+	if len(pb.missing) != 2 || pb.missing[0] != 2 || pb.missing[1] != 4 {
+		t.Fatalf("missing transactions %v, want [2 4]", pb.missing)
+	}
+	if err := pb.fill([]*wire.MsgTx{txs[2].MsgTx()}); err == nil {
+		t.Fatal("filled partial block with too few transactions")
+	}
+	err = pb.fill([]*wire.MsgTx{txs[2].MsgTx(), txs[4].MsgTx()})
+	if err != nil {
+		t.Fatalf("unable to fill partial block: %v", err)
+	}
+	reconstructed, err := pb.reconstruct()
+	if err != nil {
+		t.Fatalf("unable to reconstruct block: %v", err)
+	}
+	if *reconstructed.Hash() != *block.Hash() {
+		t.Fatalf("reconstructed block %v, want %v",
+			reconstructed.Hash(), block.Hash())
+	}
+
+	// Transactions filled in the wrong order do not match the header.
+	pb, err = newPartialBlock(msg, nil)
+	if err != nil {
+		t.Fatalf("unable to create partial block: %v", err)
+	}
+	err = pb.fill([]*wire.MsgTx{txs[2].MsgTx(), txs[1].MsgTx(),
+		txs[3].MsgTx(), txs[4].MsgTx()})
+	if err != nil {
+		t.Fatalf("unable to fill partial block: %v", err)
+	}
+	if _, err := pb.reconstruct(); err != errReconstructMismatch {
+		t.Fatalf("reconstruct error %v, want %v", err,
+			errReconstructMismatch)
+	}
+
+	// A candidate matching the short id of another candidate leaves the
+	// transaction missing.
+	pb, err = newPartialBlock(msg, []*btcutil.Tx{txs[1], txs[1]})
+	if err != nil {
+		t.Fatalf("unable to create partial block: %v", err)
+	}
+	if len(pb.missing) != 4 {
+		t.Fatalf("missing transactions %v, want 4", pb.missing)
+	}
+
+	// A compact block containing the same short id twice can't be
+	// reconstructed.
+	dup := *msg
+	dup.ShortIDs = []uint64{msg.ShortIDs[0], msg.ShortIDs[0]}
+	if _, err := newPartialBlock(&dup, nil); err != errShortIDCollision {
+		t.Fatalf("partial block error %v, want %v", err,
+			errShortIDCollision)
+	}
+
+	// A prefilled transaction beyond the transactions of the block is
+	// rejected.
+	bad := *msg
+	bad.PrefilledTxs = []wire.PrefilledTx{{Index: 5, Tx: txs[0].MsgTx()}}
+	if _, err := newPartialBlock(&bad, nil); err == nil {
+		t.Fatal("accepted compact block with out of range prefilled " +
+			"transaction")
+	}
+}
+
+// TestCmpctBlockRelay ensures compact blocks extending the best chain are
+// processed when nothing is missing and that the missing transactions are
+// requested and used to connect the block otherwise.
+func TestCmpctBlockRelay(t *testing.T) {
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 2; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+
+	// The coinbase is prefilled, so the first block is processed right
+	// away.
+	ctx.sm.handleCmpctBlockMsg(&cmpctBlockMsg{
+		cmpctBlock: NewCmpctBlock(blocks[0], 1),
+		peer:       peer.Peer,
+	})
+	if best := ctx.chain.BestSnapshot(); best.Hash != *blocks[0].Hash() {
+		t.Fatalf("best chain tip is %v, want %v", best.Hash,
+			blocks[0].Hash())
+	}
+
+	// Announce the coinbase of the second block by its short id so it must
+	// be requested.
+	msg := NewCmpctBlock(blocks[1], 2)
+	coinbase := blocks[1].Transactions()[0]
+	key := cmpctShortIDKey(&msg.Header, msg.Nonce)
+	msg.PrefilledTxs = nil
+	msg.ShortIDs = []uint64{cmpctShortID(&key, coinbase.WitnessHash())}
+	ctx.sm.handleCmpctBlockMsg(&cmpctBlockMsg{
+		cmpctBlock: msg,
+		peer:       peer.Peer,
+	})
+	pb, exists := ctx.sm.cmpctBlocks[peer.Peer]
+	if !exists || pb.hash != *blocks[1].Hash() || len(pb.missing) != 1 {
+		t.Fatal("missing transactions of compact block not requested")
+	}
+	if ctx.chain.BestSnapshot().Height != 1 {
+		t.Fatal("incomplete compact block was processed")
+	}
+
+	// Transactions of another block are ignored.
+	ctx.sm.handleBlockTxnMsg(&blockTxnMsg{
+		blockTxn: wire.NewMsgBlockTxn(&chainhash.Hash{},
+			[]*wire.MsgTx{coinbase.MsgTx()}),
+		peer: peer.Peer,
+	})
+	if _, exists := ctx.sm.cmpctBlocks[peer.Peer]; !exists {
+		t.Fatal("partial block dropped for unrelated transactions")
+	}
+
+	ctx.sm.handleBlockTxnMsg(&blockTxnMsg{
+		blockTxn: wire.NewMsgBlockTxn(blocks[1].Hash(),
+			[]*wire.MsgTx{coinbase.MsgTx()}),
+		peer: peer.Peer,
+	})
+	if best := ctx.chain.BestSnapshot(); best.Hash != *blocks[1].Hash() {
+		t.Fatalf("best chain tip is %v, want %v", best.Hash,
+			blocks[1].Hash())
+	}
+	if _, exists := ctx.sm.cmpctBlocks[peer.Peer]; exists {
+		t.Fatal("partial block not removed after reconstruction")
+	}
+}
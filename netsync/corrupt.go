@@ -0,0 +1,139 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	peerpkg "github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// maxCorruptBlocks is the maximum number of unreadable blocks that are tracked
+// for re-download at once along with the maximum number of re-downloaded
+// copies kept in memory.
+const maxCorruptBlocks = 16
+
+// loadBlock returns the main chain block with the passed hash from the
+// database.  A block the chain knows of that can't be read or deserialized,
+// which means its stored copy is corrupt, is logged and marked for re-download
+// and an error wrapping ErrBlockCorrupt is returned so the caller may carry on.
+// Once a copy has been re-downloaded it is returned instead of the stored one.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) loadBlock(hash *chainhash.Hash) (*btcutil.Block, error) {
+	if block, ok := sm.repairedBlocks[*hash]; ok {
+		return block, nil
+	}
+	block, err := sm.chain.BlockByHash(hash)
+	if err == nil || !sm.chain.MainChainHasBlock(hash) {
+		return block, err
+	}
+
+	height, _ := sm.chain.BlockHeightByHash(hash)
+	log.Errorf("Unable to load block %v (height %d) from the database: %v",
+		hash, height, err)
+	sm.requestCorruptBlock(hash)
+	return nil, fmt.Errorf("%w: %v: %v", ErrBlockCorrupt, hash, err)
+}
+
+// requestCorruptBlock marks the block with the passed hash as corrupt and
+// requests it from the sync peer, or from another sync candidate when there is
+// no sync peer, unless it is already in flight.  The block stays marked when no
+// peer can serve it so it is requested again the next time it is loaded.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) requestCorruptBlock(hash *chainhash.Hash) {
+	if _, marked := sm.corruptBlocks[*hash]; !marked {
+		if len(sm.corruptBlocks) >= maxCorruptBlocks {
+			log.Warnf("Not re-downloading block %v -- already "+
+				"re-downloading %d blocks", hash, len(sm.corruptBlocks))
+			return
+		}
+		sm.corruptBlocks[*hash] = struct{}{}
+	}
+	if _, inFlight := sm.requestedBlocks[*hash]; inFlight {
+		return
+	}
+
+	peer := sm.syncPeer
+	if peer == nil {
+		for p, state := range sm.peerStates {
+			if state.syncCandidate {
+				peer = p
+				break
+			}
+		}
+	}
+	if peer == nil {
+		log.Warnf("No peer to re-download block %v from", hash)
+		return
+	}
+	state, exists := sm.peerStates[peer]
+	if !exists {
+		return
+	}
+
+	log.Infof("Re-downloading block %v from %s", hash, peer)
+	sm.requestedBlocks[*hash] = struct{}{}
+	state.requestedBlocks[*hash] = struct{}{}
+	sm.noteBlockRequest(*hash)
+
+	iv := wire.NewInvVect(wire.InvTypeBlock, hash)
+	if peer.IsWitnessEnabled() {
+		iv.Type = wire.InvTypeWitnessBlock
+	}
+	gdmsg := wire.NewMsgGetData()
+	gdmsg.AddInvVect(iv)
+	sm.queueGetData(peer, gdmsg)
+}
+
+// repairCorruptBlock returns whether the passed block was re-downloaded to
+// replace an unreadable stored copy, in which case it is kept in memory and
+// served in place of the stored copy rather than processed, since the chain
+// already has it.  A copy that fails the context-free sanity checks, such as a
+// mutated block with duplicate transactions, or whose witness commitment does
+// not match is dropped and the block is requested again the next time it is
+// loaded.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) repairCorruptBlock(peer *peerpkg.Peer,
+	state *peerSyncState, block *btcutil.Block) bool {
+
+	hash := block.Hash()
+	if _, marked := sm.corruptBlocks[*hash]; !marked {
+		return false
+	}
+	delete(state.requestedBlocks, *hash)
+	delete(sm.requestedBlocks, *hash)
+	delete(sm.blockRequestTimes, *hash)
+
+	err := blockchain.CheckBlockSanity(block, sm.chainParams.PowLimit,
+		blockchain.NewMedianTime())
+	if err != nil {
+		log.Warnf("Discarding re-downloaded block %v from %s: %v", hash,
+			peer, err)
+		return true
+	}
+	if err := blockchain.ValidateWitnessCommitment(block); err != nil {
+		log.Warnf("Discarding re-downloaded block %v from %s: %v", hash,
+			peer, err)
+		return true
+	}
+
+	if len(sm.repairedBlocks) >= maxCorruptBlocks {
+		for h := range sm.repairedBlocks {
+			delete(sm.repairedBlocks, h)
+			break
+		}
+	}
+	delete(sm.corruptBlocks, *hash)
+	sm.repairedBlocks[*hash] = block
+	log.Infof("Re-downloaded unreadable block %v from %s", hash, peer)
+	return true
+}
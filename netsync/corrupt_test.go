@@ -0,0 +1,172 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// corruptBlockDB is a database that returns corrupt bytes for one block.
+type corruptBlockDB struct {
+	database.DB
+	corrupt *chainhash.Hash
+}
+
+// View runs the passed function with a transaction that returns corrupt bytes
+// for the corrupt block.
+func (db *corruptBlockDB) View(fn func(tx database.Tx) error) error {
+	return db.DB.View(func(tx database.Tx) error {
+		return fn(&corruptBlockTx{Tx: tx, corrupt: db.corrupt})
+	})
+}
+
+// corruptBlockTx is a database transaction that returns corrupt bytes for one
+// block.
+type corruptBlockTx struct {
+	database.Tx
+	corrupt *chainhash.Hash
+}
+
+// FetchBlock returns the truncated bytes of the corrupt block and the stored
+// bytes of any other block.
+func (tx *corruptBlockTx) FetchBlock(hash *chainhash.Hash) ([]byte, error) {
+	serialized, err := tx.Tx.FetchBlock(hash)
+	if err != nil || tx.corrupt == nil || !hash.IsEqual(tx.corrupt) {
+		return serialized, err
+	}
+	return serialized[:len(serialized)/2], nil
+}
+
+// TestCorruptBlock ensures a block whose stored copy can't be deserialized is
+// reported without affecting other blocks and is downloaded again once, that a
+// mutated copy with duplicate transactions is discarded, and that the genuine
+// downloaded copy is served in its place.
+func TestCorruptBlock(t *testing.T) {
+	db := &corruptBlockDB{}
+	cfg := newTestConfigWithDB(t, func(inner database.DB) database.DB {
+		db.DB = inner
+		return db
+	})
+	ctx := newTestContextWithConfig(t, cfg)
+	processBlock := func(block *btcutil.Block) {
+		_, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+	}
+	var coinbases []*btcutil.Tx
+	for i := 0; i <= int(ctx.params.CoinbaseMaturity); i++ {
+		block := ctx.createBlock(t)
+		processBlock(block)
+		coinbases = append(coinbases, block.Transactions()[0])
+	}
+
+	// The corrupt block has three transactions, so duplicating the last
+	// one leaves its merkle root intact.
+	sigScript, err := txscript.NewScriptBuilder().
+		AddData(opTrueScript).Script()
+	if err != nil {
+		t.Fatalf("unable to create signature script: %v", err)
+	}
+	spend := func(coinbase *btcutil.Tx) *wire.MsgTx {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(coinbase.Hash(), 0),
+			sigScript, nil))
+		msgTx.AddTxOut(wire.NewTxOut(coinbase.MsgTx().TxOut[0].Value,
+			opTrueP2SHScript(t, ctx.params)))
+		return msgTx
+	}
+	corrupt := ctx.createBlockWithTxs(t, spend(coinbases[0]),
+		spend(coinbases[1]))
+	processBlock(corrupt)
+	tip := ctx.createBlock(t)
+	processBlock(tip)
+
+	mutatedMsg := *corrupt.MsgBlock()
+	mutatedMsg.Transactions = append(mutatedMsg.Transactions[:3:3],
+		mutatedMsg.Transactions[2])
+	mutated := btcutil.NewBlock(&mutatedMsg)
+	merkles := blockchain.BuildMerkleTreeStore(mutated.Transactions(), false)
+	if *merkles[len(merkles)-1] != mutatedMsg.Header.MerkleRoot {
+		t.Fatal("mutated block merkle root differs")
+	}
+
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	db.corrupt = corrupt.Hash()
+
+	// expectGetData ensures a getdata message for the corrupt block is
+	// received by the peer.
+	expectGetData := func() {
+		t.Helper()
+		select {
+		case msg := <-peer.getData:
+			if len(msg.InvList) != 1 ||
+				msg.InvList[0].Hash != *corrupt.Hash() {
+
+				t.Fatalf("getdata for %v, want %v", msg.InvList,
+					corrupt.Hash())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for getdata")
+		}
+	}
+
+	// The corrupt block is reported while the others are still served.
+	_, err = ctx.sm.fetchBlockBody(corrupt.Hash())
+	if !errors.Is(err, ErrBlockCorrupt) {
+		t.Fatalf("fetching corrupt block returned %v, want %v", err,
+			ErrBlockCorrupt)
+	}
+	block, err := ctx.sm.fetchBlockBody(tip.Hash())
+	if err != nil || *block.Hash() != *tip.Hash() {
+		t.Fatalf("unable to fetch block after corrupt one: %v", err)
+	}
+
+	// The corrupt block is requested again only once while it is in flight.
+	expectGetData()
+	if _, err := ctx.sm.fetchBlockBody(corrupt.Hash()); err == nil {
+		t.Fatal("fetching corrupt block in flight succeeded")
+	}
+	select {
+	case msg := <-peer.getData:
+		t.Fatalf("unexpected getdata %v", msg.InvList)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// A mutated copy is discarded and the block is requested again the
+	// next time it is fetched.
+	ctx.sm.handleBlockMsg(&blockMsg{block: mutated, peer: peer.Peer})
+	if _, err := ctx.sm.fetchBlockBody(corrupt.Hash()); err == nil {
+		t.Fatal("mutated copy of corrupt block served")
+	}
+	expectGetData()
+
+	// The genuine copy is served in place of the stored one without
+	// touching the chain.
+	ctx.sm.handleBlockMsg(&blockMsg{block: corrupt, peer: peer.Peer})
+	block, err = ctx.sm.fetchBlockBody(corrupt.Hash())
+	if err != nil || *block.Hash() != *corrupt.Hash() ||
+		len(block.Transactions()) != 3 {
+
+		t.Fatalf("unable to fetch re-downloaded block: %v", err)
+	}
+	if len(ctx.sm.corruptBlocks) != 0 {
+		t.Fatalf("%d blocks still marked corrupt",
+			len(ctx.sm.corruptBlocks))
+	}
+	if best := ctx.chain.BestSnapshot(); best.Hash != *tip.Hash() {
+		t.Fatalf("best chain tip is %v, want %v", best.Hash, tip.Hash())
+	}
+}
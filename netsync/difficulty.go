@@ -0,0 +1,20 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"github.com/btcsuite/btcd/blockchain"
+)
+
+// Difficulty returns the proof-of-work difficulty of the best chain tip as a
+// multiple of the minimum difficulty of the network, as reported by the
+// getdifficulty RPC.  The difficulty of the genesis block is returned when the
+// chain has no other blocks.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) Difficulty() float64 {
+	best := sm.chain.BestSnapshot()
+	return blockchain.DifficultyRatio(best.Bits, sm.chainParams.PowLimitBits)
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+)
+
+// TestDifficulty ensures the difficulty of the best chain tip is computed
+// relative to the minimum difficulty of the network.
+func TestDifficulty(t *testing.T) {
+	// The regression test network mines at its minimum difficulty, so
+	// the chain with only the genesis block and after connecting a block
+	// both have a difficulty of one.
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	if got := ctx.sm.Difficulty(); got != 1 {
+		t.Fatalf("difficulty of genesis block is %v, want 1", got)
+	}
+	block := ctx.createBlock(t)
+	if _, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone); err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	if got := ctx.sm.Difficulty(); got != 1 {
+		t.Fatalf("difficulty of block is %v, want 1", got)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// BlockExporter appends the blocks connected to the main chain to a file as
+// they arrive.  The file uses the bootstrap format read by the addblock
+// utility, in which each block is preceded by the network magic and the length
+// of the serialized block, both as little-endian uint32s.
+//
+// Blocks already written are never truncated.  When the chain reorganizes, the
+// blocks of the new main chain are appended after the blocks written for the
+// old one, which leaves the file importable since the new blocks connect to
+// blocks written before them.
+//
+// A BlockExporter is safe for concurrent access.
+type BlockExporter struct {
+	mtx        sync.Mutex
+	file       *os.File
+	net        wire.BitcoinNet
+	lastHeight int32
+}
+
+// OpenBlockExporter opens the file at the passed path for exporting the blocks
+// of the passed network, creating it if it does not exist.  Blocks are
+// appended to any blocks the file already contains.
+func OpenBlockExporter(path string, net wire.BitcoinNet) (*BlockExporter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &BlockExporter{
+		file:       file,
+		net:        net,
+		lastHeight: -1,
+	}, nil
+}
+
+// Export appends the passed block, which was just connected to the main chain,
+// to the export file.
+func (e *BlockExporter) Export(block *btcutil.Block) error {
+	serialized, err := block.Bytes()
+	if err != nil {
+		return err
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	height := block.Height()
+	if e.lastHeight >= 0 && height <= e.lastHeight {
+		log.Infof("Chain reorganized at height %d -- exporting block %v "+
+			"after the %d exported blocks of the old chain", height,
+			block.Hash(), e.lastHeight-height+1)
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(8 + len(serialized))
+	var header [8]byte
+	binary.LittleEndian.PutUint32(header[:4], uint32(e.net))
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(serialized)))
+	buf.Write(header[:])
+	buf.Write(serialized)
+	if _, err := e.file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	e.lastHeight = height
+	return nil
+}
+
+// Close closes the export file.
+func (e *BlockExporter) Close() error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	return e.file.Close()
+}
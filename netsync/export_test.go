@@ -0,0 +1,168 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// readExportedBlocks returns the hashes of the blocks in the export file at the
+// passed path after ensuring each is preceded by the magic of the passed
+// network.
+func readExportedBlocks(t *testing.T, path string,
+	net wire.BitcoinNet) []chainhash.Hash {
+
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unable to open export file: %v", err)
+	}
+	defer file.Close()
+
+	var hashes []chainhash.Hash
+	for {
+		var header [8]byte
+		_, err := io.ReadFull(file, header[:])
+		if err == io.EOF {
+			return hashes
+		}
+		if err != nil {
+			t.Fatalf("unable to read export file: %v", err)
+		}
+		magic := wire.BitcoinNet(binary.LittleEndian.Uint32(header[:4]))
+		if magic != net {
+			t.Fatalf("block %d has magic %v, want %v", len(hashes),
+				magic, net)
+		}
+		serialized := make([]byte, binary.LittleEndian.Uint32(header[4:]))
+		if _, err := io.ReadFull(file, serialized); err != nil {
+			t.Fatalf("unable to read export file: %v", err)
+		}
+		var msgBlock wire.MsgBlock
+		err = msgBlock.Deserialize(bytes.NewReader(serialized))
+		if err != nil {
+			t.Fatalf("unable to deserialize block %d: %v",
+				len(hashes), err)
+		}
+		hashes = append(hashes, msgBlock.BlockHash())
+	}
+}
+
+// TestBlockExporter ensures the blocks connected to the main chain are
+// exported in order and that the blocks of a new main chain are appended
+// after those already exported when the chain reorganizes.
+func TestBlockExporter(t *testing.T) {
+	// Create a chain of blocks using a separate chain.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 3; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	// Create a longer fork from genesis using another chain.  The first
+	// block of the fork differs from the first block above by its
+	// timestamp.
+	forkSrc := newTestContextWithConfig(t, newTestConfig(t))
+	msgBlock := *blocks[0].MsgBlock()
+	msgBlock.Header.Timestamp = msgBlock.Header.Timestamp.Add(time.Second)
+	target := blockchain.CompactToBig(msgBlock.Header.Bits)
+	for {
+		hash := msgBlock.Header.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			break
+		}
+		msgBlock.Header.Nonce++
+	}
+	fork := []*btcutil.Block{btcutil.NewBlock(&msgBlock)}
+	_, _, err := forkSrc.chain.ProcessBlock(fork[0], blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		block := forkSrc.createBlock(t)
+		_, _, err := forkSrc.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		fork = append(fork, block)
+	}
+
+	path := filepath.Join(t.TempDir(), "bootstrap.dat")
+	cfg := newTestConfig(t)
+	exporter, err := OpenBlockExporter(path, cfg.ChainParams.Net)
+	if err != nil {
+		t.Fatalf("unable to open block exporter: %v", err)
+	}
+	defer exporter.Close()
+	cfg.BlockExporter = exporter
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18555", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	for _, block := range blocks {
+		ctx.sm.handleBlockMsg(&blockMsg{block: block, peer: peer.Peer})
+	}
+	if ctx.chain.BestSnapshot().Height != 3 {
+		t.Fatal("blocks not processed")
+	}
+
+	var want []chainhash.Hash
+	for _, block := range blocks {
+		want = append(want, *block.Hash())
+	}
+	got := readExportedBlocks(t, path, ctx.params.Net)
+	if len(got) != len(want) {
+		t.Fatalf("got %d exported blocks, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("exported block %d is %v, want %v", i, got[i],
+				want[i])
+		}
+	}
+
+	// Reorganize to the longer fork and ensure its blocks are appended
+	// after the blocks of the old main chain.  The fork is processed by the
+	// chain directly since the sync manager ignores unrequested blocks that
+	// do not extend the best chain.
+	for _, block := range fork {
+		_, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+	}
+	if ctx.chain.BestSnapshot().Hash != *fork[len(fork)-1].Hash() {
+		t.Fatal("chain did not reorganize to the fork")
+	}
+	for _, block := range fork {
+		want = append(want, *block.Hash())
+	}
+	got = readExportedBlocks(t, path, ctx.params.Net)
+	if len(got) != len(want) {
+		t.Fatalf("got %d exported blocks, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("exported block %d is %v, want %v", i, got[i],
+				want[i])
+		}
+	}
+}
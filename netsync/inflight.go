@@ -0,0 +1,68 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	peerpkg "github.com/btcsuite/btcd/peer"
+)
+
+// InFlightRequest describes a block that was requested from a peer and has not
+// been received yet.
+type InFlightRequest struct {
+	// Hash is the hash of the requested block.
+	Hash chainhash.Hash
+
+	// Peer is the peer the block was requested from.
+	Peer *peerpkg.Peer
+
+	// Requested is the time the block was requested.  It is the zero time
+	// when the time of the request is no longer known.
+	Requested time.Time
+}
+
+// noteBlockRequest records that the block with the passed hash was just
+// requested.  A random entry is evicted when the number of recorded requests
+// would exceed the number of blocks that may be in flight.
+func (sm *SyncManager) noteBlockRequest(hash chainhash.Hash) {
+	limit := maxRequestedBlocks + sm.blockDownloadWindow
+	if _, exists := sm.blockRequestTimes[hash]; !exists &&
+		len(sm.blockRequestTimes) >= limit {
+
+		for h := range sm.blockRequestTimes {
+			delete(sm.blockRequestTimes, h)
+			break
+		}
+	}
+	sm.blockRequestTimes[hash] = time.Now()
+}
+
+// inFlightRequests returns the blocks that were requested from peers and have
+// not been received yet, ordered from the oldest request to the newest.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) inFlightRequests() []InFlightRequest {
+	var requests []InFlightRequest
+	for peer, state := range sm.peerStates {
+		for hash := range state.requestedBlocks {
+			requests = append(requests, InFlightRequest{
+				Hash:      hash,
+				Peer:      peer,
+				Requested: sm.blockRequestTimes[hash],
+			})
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if !requests[i].Requested.Equal(requests[j].Requested) {
+			return requests[i].Requested.Before(requests[j].Requested)
+		}
+		return bytes.Compare(requests[i].Hash[:], requests[j].Hash[:]) < 0
+	})
+	return requests
+}
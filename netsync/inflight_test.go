@@ -0,0 +1,91 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestInFlightRequests ensures the in-flight block requests reflect the
+// outstanding getdata requests to peers.
+func TestInFlightRequests(t *testing.T) {
+	// Create a chain of blocks using a separate chain.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 2; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18555", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	if requests := ctx.sm.inFlightRequests(); len(requests) != 0 {
+		t.Fatalf("unexpected in-flight requests %v", requests)
+	}
+
+	// Announcing the blocks requests them from the peer.
+	before := time.Now()
+	inv := wire.NewMsgInv()
+	for _, block := range blocks {
+		inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, block.Hash()))
+	}
+	ctx.sm.handleInvMsg(&invMsg{inv: inv, peer: peer.Peer})
+	select {
+	case msg := <-peer.getData:
+		if len(msg.InvList) != len(blocks) {
+			t.Fatalf("unexpected getdata %v", msg.InvList)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for getdata")
+	}
+
+	requests := ctx.sm.inFlightRequests()
+	if len(requests) != len(blocks) {
+		t.Fatalf("got %d in-flight requests, want %d", len(requests),
+			len(blocks))
+	}
+	for _, request := range requests {
+		if request.Hash != *blocks[0].Hash() &&
+			request.Hash != *blocks[1].Hash() {
+
+			t.Fatalf("unexpected in-flight block %v", request.Hash)
+		}
+		if request.Peer != peer.Peer {
+			t.Fatalf("block %v requested from %v, want %v",
+				request.Hash, request.Peer, peer.Peer)
+		}
+		if request.Requested.Before(before) ||
+			request.Requested.After(time.Now()) {
+
+			t.Fatalf("unexpected request time %v for block %v",
+				request.Requested, request.Hash)
+		}
+	}
+
+	// Received blocks are no longer in flight.
+	ctx.sm.handleBlockMsg(&blockMsg{block: blocks[0], peer: peer.Peer})
+	requests = ctx.sm.inFlightRequests()
+	if len(requests) != 1 || requests[0].Hash != *blocks[1].Hash() {
+		t.Fatalf("unexpected in-flight requests %v", requests)
+	}
+
+	// The exported method queries the running sync manager.
+	ctx.sm.Start()
+	defer ctx.sm.Stop()
+	requests = ctx.sm.InFlightRequests()
+	if len(requests) != 1 || requests[0].Hash != *blocks[1].Hash() {
+		t.Fatalf("unexpected in-flight requests %v", requests)
+	}
+}
@@ -5,7 +5,10 @@
 package netsync
 
 import (
+	"time"
+
 	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/indexers"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -20,11 +23,97 @@ import (
 type PeerNotifier interface {
 	AnnounceNewTransactions(newTxs []*mempool.TxDesc)
 
+	// NotifyNewTransactions notifies clients other than peers, such as
+	// RPC clients, of the passed transactions, which were accepted to the
+	// memory pool, without relaying them to peers.  It is used when the
+	// relay of the transactions is delayed.
+	NotifyNewTransactions(newTxs []*mempool.TxDesc)
+
 	UpdatePeerHeights(latestBlkHash *chainhash.Hash, latestHeight int32, updateSource *peer.Peer)
 
 	RelayInventory(invVect *wire.InvVect, data interface{})
 
 	TransactionConfirmed(tx *btcutil.Tx)
+
+	// QueueBackpressure is invoked with true when the messages queued from
+	// the passed peer are filling up the message queues of the sync
+	// manager and reading from it should be paused and with false once
+	// the queues have drained enough for reading from it to resume.  It
+	// must not block.
+	QueueBackpressure(peer *peer.Peer, asserted bool)
+}
+
+// LoadSource reports the current load of the system, such as the utilization of
+// the CPU or disk, for throttling block processing on shared machines.
+type LoadSource interface {
+	// Load returns the current load of the system.  Its scale is up to the
+	// implementation, but it must match the scale of Config.MaxLoad.
+	Load() float64
+}
+
+// SyncPeerSelector chooses the sync peer among equally good sync candidates,
+// such as to prefer peers with the lowest latency or from a specific subnet.
+type SyncPeerSelector interface {
+	// SelectSyncPeer returns the peer to sync from among the passed
+	// candidates, which are all eligible and know of the same latest block.
+	// The best height is the height of our best chain.  The candidates are
+	// never empty.  Returning nil or a peer that is not a candidate selects
+	// the first candidate.
+	SelectSyncPeer(candidates []*peer.Peer, bestHeight int32) *peer.Peer
+}
+
+// InvHandler is invoked for each inventory vector of a registered type that is
+// advertised by a peer.
+type InvHandler func(peer *peer.Peer, iv *wire.InvVect)
+
+// Tuning houses the knobs that control the sync manager's queue sizes and
+// timing.  Networks with very different block rates and sizes benefit from
+// different values.  Any fields left at their zero value use the defaults.
+type Tuning struct {
+	// MsgQueuePerPeer is the number of message queue slots allocated for
+	// each peer the sync manager may be connected to.
+	MsgQueuePerPeer int
+
+	// MaxStallDuration is the time after which the current sync peer is
+	// disconnected if no progress has been made.
+	MaxStallDuration time.Duration
+
+	// StallSampleInterval is the interval at which the sync is checked for
+	// stalls.
+	StallSampleInterval time.Duration
+
+	// ProgressLogInterval is the minimum interval between block processing
+	// progress log messages.
+	ProgressLogInterval time.Duration
+
+	// HandlerTimeout is the time the block handler may go without making
+	// progress before it is considered stuck.
+	HandlerTimeout time.Duration
+
+	// BehindGracePeriod is the time a sync candidate may be behind our best
+	// height before it is no longer considered a candidate, so peers that
+	// are briefly behind while still downloading blocks themselves remain
+	// candidates.
+	BehindGracePeriod time.Duration
+
+	// CandidateSummaryInterval is the interval at which a one-line summary
+	// of the sync candidates and the sync peer is logged while the chain is
+	// not current.
+	CandidateSummaryInterval time.Duration
+
+	// SyncPeerSwitchInterval is the minimum time between switches of the
+	// sync peer to a candidate that proved to be markedly better while
+	// syncing, which prevents thrashing between peers.
+	SyncPeerSwitchInterval time.Duration
+
+	// MaxBlockBurst is the maximum number of queued block messages handled
+	// ahead of other messages, such as inventory announcements, before
+	// another message is given the chance to be handled.
+	MaxBlockBurst int
+
+	// LoadCheckInterval is the interval at which the system load is checked
+	// when block processing is throttled by load.
+	LoadCheckInterval time.Duration
 }
 
 // Config is a configuration struct used to initialize a new SyncManager.
@@ -37,5 +126,209 @@ type Config struct {
 	DisableCheckpoints bool
 	MaxPeers           int
 
+	// BlockDownloadWindow is the maximum number of blocks that may be
+	// requested from the sync peer at once during a headers-first sync.
+	// More blocks are requested as the outstanding ones arrive, so larger
+	// windows keep fast links saturated with fewer round trips.  However,
+	// every outstanding block may be buffered in transit, so the memory
+	// consumed can reach the window multiplied by the maximum block size.
+	// Smaller windows are better suited to constrained machines.  A value
+	// of zero uses DefaultBlockDownloadWindow.
+	BlockDownloadWindow int
+
+	// CheckpointQuorum is the number of the most recent checkpoints at or
+	// below our best height that a sync candidate must prove it has in its
+	// chain before it is trusted as the sync peer.  Peers that fail to
+	// match any of them are disconnected.  A value of zero disables the
+	// verification.
+	CheckpointQuorum int
+
+	// MaxSyncCandidates is the maximum number of sync candidate peers
+	// considered when choosing the sync peer.  Candidates beyond the limit
+	// are only considered once a tracked candidate disconnects or is
+	// dropped.  A value of zero uses DefaultMaxSyncCandidates.
+	MaxSyncCandidates int
+
+	// MaxOrphanResolveDepth is the maximum number of blocks an orphan may
+	// be ahead of the best chain for all of its missing ancestors to be
+	// requested up to the orphan root at once.  Deeper orphans are resolved
+	// incrementally a batch of blocks at a time.  A value of zero uses
+	// DefaultMaxOrphanResolveDepth.
+	MaxOrphanResolveDepth int
+
+	// MaxOrphanResolveRequests is the maximum number of orphan resolution
+	// requests outstanding at once across all peers, which bounds the
+	// traffic many peers sending orphans can induce.  Orphans received
+	// while the limit is reached are not resolved until they are announced
+	// again.  A value of zero uses DefaultMaxOrphanResolveRequests.
+	MaxOrphanResolveRequests int
+
+	// MaxPeerOrphans is the maximum number of orphan blocks accepted from
+	// a single peer within each orphan window.  Further orphans from the
+	// peer are dropped without being processed or resolved until the
+	// window ends, and the peer is penalized for each of them.  A value of
+	// zero uses DefaultMaxPeerOrphans.
+	MaxPeerOrphans int
+
+	// PeerOrphanWindow is the duration of the windows over which the
+	// orphan blocks accepted from each peer are counted.  A value of zero
+	// uses DefaultPeerOrphanWindow.
+	PeerOrphanWindow time.Duration
+
+	// GetDataPipelineDepth is the maximum number of getdata messages for
+	// announced blocks outstanding to a peer at once.  When non-zero,
+	// announced blocks are requested in batches so a fast peer can work
+	// on several requests at once, with blocks that arrive ahead of blocks
+	// requested before them held until those are processed so blocks are
+	// processed in the order they were requested.  A value of zero
+	// requests all announced blocks with a single message.
+	GetDataPipelineDepth int
+
+	// AssumeValid optionally identifies a block known to be valid.  The
+	// headers leading to it are requested from the sync peer and the
+	// scripts of its ancestors are not executed when the blocks are
+	// processed, which speeds up the initial block download considerably.
+	// All other checks are still performed and blocks after it are fully
+	// validated.
+	AssumeValid *chainhash.Hash
+
+	// DisableVerify processes the blocks received from peers without
+	// executing the scripts of their transactions, which speeds up building
+	// large chains on local test networks.  All other checks are still
+	// performed and blocks whose scripts were skipped are not relayed.  It
+	// is ignored on networks other than the regression and simulation test
+	// networks and may be changed at runtime with SetVerify.
+	DisableVerify bool
+
+	// RelayMainChainOnly limits the relay of accepted blocks to those that
+	// advance the main chain tip.  Otherwise, side chain blocks retained by
+	// the chain are relayed as well.  Orphans are never relayed.
+	RelayMainChainOnly bool
+
+	// LogAcceptedBlocks logs the hash and height of each block connected to
+	// or disconnected from the main chain at the debug level so operators
+	// can reconstruct which blocks were accepted in what order, including
+	// across reorganizations.  The periodic progress log only summarizes
+	// them.
+	LogAcceptedBlocks bool
+
+	// RelayWhileSyncing relays the blocks accepted to the chain while the
+	// sync manager is catching up with its peers.  Otherwise, blocks are
+	// only relayed once the chain is current since peers that are current
+	// already know about them.
+	RelayWhileSyncing bool
+
+	// TipRelayDelay is the time to wait before relaying a block that
+	// advanced the main chain tip.  Tip advances during the wait restart
+	// it, so only the latest tip is relayed when blocks are accepted in
+	// quick succession, such as while catching up.  A value of zero relays
+	// every tip right away.
+	TipRelayDelay time.Duration
+
+	// MaxTipRelayDelay is the maximum time the relay of a tip may be
+	// delayed by later tip advances, which ensures a tip is eventually
+	// relayed while blocks keep arriving.  A value of zero uses
+	// TipRelayDelay.
+	MaxTipRelayDelay time.Duration
+
+	// TxRelayDelay is the time to wait after transactions are accepted to
+	// the memory pool before relaying them to peers.  Peers that advertise
+	// or send a transaction during the wait are known to have it, so the
+	// transaction is not announced back to them, which avoids redundant
+	// announcements when a transaction arrives from several peers at
+	// nearly the same time.  Other clients, such as RPC clients, are
+	// notified right away, and transactions that leave the memory pool
+	// during the wait are not relayed.  A value of zero relays
+	// transactions right away.
+	TxRelayDelay time.Duration
+
+	// BlockJournal optionally records the blocks accepted to the chain so
+	// blocks lost to a crash before the database persisted them can be
+	// detected on startup.
+	BlockJournal *BlockJournal
+
+	// OrphanStore optionally keeps the orphan blocks received on disk so
+	// they can be reconsidered after a restart instead of downloading them
+	// again.
+	OrphanStore *OrphanStore
+
+	// TxIndex optionally looks up the transactions confirmed in the main
+	// chain for HaveTransaction.  The index is maintained by the chain as
+	// blocks are connected and disconnected and is optional due to its
+	// storage cost.
+	TxIndex *indexers.TxIndex
+
+	// BlockExporter optionally exports the blocks connected to the main
+	// chain as they arrive, such as for building bootstrap files.
+	BlockExporter *BlockExporter
+
+	// QuietTxRejectReasons lists the reasons for which transactions rejected
+	// by the memory pool are not logged.  Rejections for all other reasons
+	// are logged at most once per reason every ten seconds.
+	QuietTxRejectReasons []TxRejectReason
+
+	// RequestPeers is optionally invoked when the sync peer is lost during
+	// the initial block download and no other sync candidates remain, so
+	// new connections can be made instead of waiting for a candidate to
+	// connect.  It is invoked from the sync manager goroutine, so it must
+	// not block.
+	RequestPeers func()
+
+	// AddBanScore is optionally invoked to increase the persistent and
+	// decaying ban scores of a misbehaving peer by the passed values, such
+	// as a peer sending blocks that were not requested from it.  Misbehaving
+	// peers are disconnected when it is nil.  It is invoked from the sync
+	// manager goroutine, so it must not block.
+	AddBanScore func(peer *peer.Peer, persistent, transient uint32,
+		reason string)
+
+	// OnBestBlockChanged is optionally invoked with the hash and height of
+	// the new tip of the main chain each time it changes, such as to
+	// refresh the view peers have of our best block where the protocol
+	// allows.  Peers negotiating a connection are already told the height
+	// of the tip at the time, but the protocol provides no way to update
+	// it afterwards other than announcing new blocks.  It is invoked from
+	// the sync manager goroutine, so it must not block.
+	OnBestBlockChanged func(hash *chainhash.Hash, height int32)
+
+	// OnHandlerStuck is optionally invoked when the block handler has not
+	// made progress within the handler timeout, which indicates a bug such
+	// as a deadlock.  The stacks of all goroutines are logged beforehand.
+	// It is invoked at most once and is typically used to shut down the
+	// node rather than letting it silently stop syncing.
+	OnHandlerStuck func()
+
 	FeeEstimator *mempool.FeeEstimator
+
+	// InvHandlers optionally maps inventory vector types which are not
+	// natively supported by the sync manager to handlers that are invoked
+	// when a peer advertises inventory of that type.  The handlers are
+	// invoked from the sync manager goroutine, so they must not block.
+	InvHandlers map[wire.InvType]InvHandler
+
+	// LoadSource optionally reports the system load, which pauses the
+	// processing of queued blocks while it exceeds MaxLoad and resumes it
+	// once the load drops.  Other messages, such as status queries, are
+	// still handled while paused.  Peers sending blocks are held until
+	// their blocks are processed, so they also stop sending more.
+	LoadSource LoadSource
+
+	// MaxLoad is the load reported by LoadSource above which the processing
+	// of queued blocks is paused.
+	MaxLoad float64
+
+	// SyncPeerSelector optionally chooses the sync peer among the sync
+	// candidates with the most blocks.  When it is nil, the first such
+	// candidate is selected.
+	SyncPeerSelector SyncPeerSelector
+
+	// DiverseSyncPeer prefers sync candidates whose network group, such as
+	// the /16 of an IPv4 address, is not shared with any other connected
+	// peer when choosing among the candidates with the most blocks.  This
+	// makes it harder for an attacker controlling many addresses within a
+	// few network groups to eclipse the node during the sync.
+	DiverseSyncPeer bool
+
+	// Tuning optionally overrides the default queue sizes and timeouts.
+	Tuning Tuning
 }
@@ -0,0 +1,207 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+const (
+	// journalEntrySize is the size in bytes of a serialized block journal
+	// entry, which is the block hash followed by its height.
+	journalEntrySize = chainhash.HashSize + 4
+
+	// maxBlockJournalEntries is the maximum number of entries the block
+	// journal holds before it starts over.  The database persists accepted
+	// blocks well before this many are accepted, so only the most recent
+	// entries are needed to detect lost blocks.
+	maxBlockJournalEntries = 100000
+
+	// journalSyncEntries is the number of entries appended to the block
+	// journal before it is synced to disk.
+	journalSyncEntries = 100
+
+	// journalSyncInterval is the maximum time since the block journal was
+	// last synced to disk before the next appended entry syncs it.
+	journalSyncInterval = time.Second
+)
+
+// JournalEntry identifies a block recorded in the block journal.
+type JournalEntry struct {
+	// Hash is the hash of the block.
+	Hash chainhash.Hash
+
+	// Height is the height of the block.
+	Height int32
+}
+
+// BlockJournal is a write-ahead journal of the blocks accepted to the chain.
+// The database batches its writes, so blocks accepted shortly before a crash
+// may be lost even though they were reported as accepted.  Entries are written
+// as blocks are accepted and the journal is removed once the database has been
+// closed cleanly, so a journal left behind on startup identifies the blocks
+// that may have been lost.  See ReplayBlockJournal.
+//
+// Written entries survive the process crashing.  They are synced to disk in
+// batches to avoid a sync per block, so the most recent entries may be lost
+// along with the blocks themselves when the system crashes.
+//
+// A BlockJournal is safe for concurrent access.
+type BlockJournal struct {
+	mtx      sync.Mutex
+	file     *os.File
+	entries  int
+	unsynced int
+	lastSync time.Time
+}
+
+// OpenBlockJournal opens the block journal at the passed path, creating it if
+// it does not exist.  New entries are appended to any existing ones.
+func OpenBlockJournal(path string) (*BlockJournal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &BlockJournal{
+		file:     file,
+		entries:  int(info.Size() / journalEntrySize),
+		lastSync: time.Now(),
+	}, nil
+}
+
+// Append records the block with the passed hash and height.  The journal is
+// synced to disk once enough entries were appended since it was last synced or
+// it was last synced long enough ago.  The journal starts over once it holds
+// the maximum number of entries.
+func (j *BlockJournal) Append(hash *chainhash.Hash, height int32) error {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	if j.entries >= maxBlockJournalEntries {
+		if err := j.file.Truncate(0); err != nil {
+			return err
+		}
+		j.entries = 0
+	}
+
+	var buf [journalEntrySize]byte
+	copy(buf[:], hash[:])
+	binary.LittleEndian.PutUint32(buf[chainhash.HashSize:], uint32(height))
+	if _, err := j.file.Write(buf[:]); err != nil {
+		return err
+	}
+	j.entries++
+	j.unsynced++
+
+	if j.unsynced < journalSyncEntries &&
+		time.Since(j.lastSync) < journalSyncInterval {
+
+		return nil
+	}
+	return j.sync()
+}
+
+// sync syncs the journal to disk.
+//
+// This function MUST be called with the journal lock held.
+func (j *BlockJournal) sync() error {
+	if err := j.file.Sync(); err != nil {
+		return err
+	}
+	j.unsynced = 0
+	j.lastSync = time.Now()
+	return nil
+}
+
+// Close syncs and closes the journal.  The entries are left on disk until the
+// journal is removed after the database has been closed cleanly.
+func (j *BlockJournal) Close() error {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	if j.unsynced > 0 {
+		if err := j.sync(); err != nil {
+			j.file.Close()
+			return err
+		}
+	}
+	return j.file.Close()
+}
+
+// readBlockJournal returns the entries of the block journal read from the
+// passed reader.  A trailing partial entry, as left by a crash while it was
+// being written, is ignored.
+func readBlockJournal(r io.Reader) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	br := bufio.NewReader(r)
+	var buf [journalEntrySize]byte
+	for {
+		_, err := io.ReadFull(br, buf[:])
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var entry JournalEntry
+		copy(entry.Hash[:], buf[:chainhash.HashSize])
+		entry.Height = int32(binary.LittleEndian.Uint32(
+			buf[chainhash.HashSize:]))
+		entries = append(entries, entry)
+	}
+}
+
+// ReplayBlockJournal replays the block journal at the passed path, which is
+// only left behind when the database was not closed cleanly, and removes it.
+// It returns the journaled blocks that the passed function reports are no
+// longer stored since they were lost along with the partially applied writes
+// of the database.  Nothing is returned when there is no journal.
+func ReplayBlockJournal(path string,
+	haveBlock func(*chainhash.Hash) (bool, error)) ([]JournalEntry, error) {
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readBlockJournal(file)
+	file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read block journal: %w", err)
+	}
+
+	var lost []JournalEntry
+	for _, entry := range entries {
+		have, err := haveBlock(&entry.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if !have {
+			lost = append(lost, entry)
+		}
+	}
+
+	if err := os.Remove(path); err != nil {
+		return nil, err
+	}
+	return lost, nil
+}
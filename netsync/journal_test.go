@@ -0,0 +1,99 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+// TestBlockJournal ensures the blocks accepted by the sync manager, including
+// orphans accepted once their parent is, are journaled and that replaying the
+// journal after a crash reports the blocks the database lost.
+func TestBlockJournal(t *testing.T) {
+	// Create a chain of blocks using a separate chain.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 3; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	path := filepath.Join(t.TempDir(), "blocks.journal")
+	journal, err := OpenBlockJournal(path)
+	if err != nil {
+		t.Fatalf("unable to open block journal: %v", err)
+	}
+
+	cfg := newTestConfig(t)
+	cfg.BlockJournal = journal
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18555", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	// Deliver the last block before its parent so it is only accepted
+	// when the orphan is processed.
+	state := ctx.sm.peerStates[peer.Peer]
+	for _, i := range []int{0, 2, 1} {
+		hash := *blocks[i].Hash()
+		ctx.sm.requestedBlocks[hash] = struct{}{}
+		state.requestedBlocks[hash] = struct{}{}
+		bmsg := &blockMsg{block: blocks[i], peer: peer.Peer}
+		ctx.sm.handleBlockMsg(bmsg)
+	}
+	if ctx.chain.BestSnapshot().Height != 3 {
+		t.Fatal("blocks not processed")
+	}
+
+	// Simulate a crash while the next entry was being written.
+	journal.Close()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("unable to open journal file: %v", err)
+	}
+	if _, err := file.Write([]byte{0x01, 0x02, 0x03}); err != nil {
+		t.Fatalf("unable to write journal file: %v", err)
+	}
+	file.Close()
+
+	// Replay the journal against a database that only persisted the first
+	// block before the crash.
+	crashed := newTestContextWithConfig(t, newTestConfig(t))
+	_, _, err = crashed.chain.ProcessBlock(blocks[0], blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	lost, err := ReplayBlockJournal(path, crashed.chain.HaveBlock)
+	if err != nil {
+		t.Fatalf("unable to replay block journal: %v", err)
+	}
+	if len(lost) != 2 {
+		t.Fatalf("got %d lost blocks, want 2", len(lost))
+	}
+	for i, entry := range lost {
+		block := blocks[i+1]
+		if entry.Hash != *block.Hash() || entry.Height != int32(i+2) {
+			t.Fatalf("lost block %d is %v (height %d), want %v "+
+				"(height %d)", i, entry.Hash, entry.Height,
+				block.Hash(), i+2)
+		}
+	}
+
+	// The journal is removed once replayed.
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("journal not removed after replay: %v", err)
+	}
+	lost, err = ReplayBlockJournal(path, crashed.chain.HaveBlock)
+	if err != nil || lost != nil {
+		t.Fatalf("unexpected replay without journal: %v, %v", lost, err)
+	}
+}
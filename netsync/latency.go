@@ -0,0 +1,140 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// latencyBucketBounds are the inclusive upper bounds of the buckets used by
+// propagation latency histograms.  Samples larger than the final bound are
+// counted in an additional overflow bucket.
+var latencyBucketBounds = []time.Duration{
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+}
+
+// LatencyBucket is a single bucket of a latency histogram.
+type LatencyBucket struct {
+	// UpperBound is the inclusive upper bound of the bucket.  The overflow
+	// bucket has an upper bound of math.MaxInt64.
+	UpperBound time.Duration
+
+	// Count is the number of samples that fell into the bucket.
+	Count uint64
+}
+
+// LatencySnapshot is a point-in-time copy of a latency histogram along with
+// percentiles derived from it.  Percentiles are reported as the upper bound
+// of the bucket containing them, except for samples in the overflow bucket
+// which are reported as the largest observed latency.  All percentiles are
+// zero when no samples have been recorded.
+type LatencySnapshot struct {
+	Buckets []LatencyBucket
+	Count   uint64
+	Max     time.Duration
+	P50     time.Duration
+	P90     time.Duration
+	P99     time.Duration
+}
+
+// latencyHistogram tracks the distribution of latency samples in fixed
+// buckets.  It is safe for concurrent access.
+type latencyHistogram struct {
+	mtx    sync.Mutex
+	counts []uint64
+	total  uint64
+	max    time.Duration
+}
+
+// newLatencyHistogram returns an empty latency histogram.
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{
+		counts: make([]uint64, len(latencyBucketBounds)+1),
+	}
+}
+
+// observe records the passed latency sample.  Negative samples, which can
+// occur when the wall clock is adjusted, are recorded as zero.
+func (h *latencyHistogram) observe(latency time.Duration) {
+	if latency < 0 {
+		latency = 0
+	}
+
+	bucket := len(latencyBucketBounds)
+	for i, bound := range latencyBucketBounds {
+		if latency <= bound {
+			bucket = i
+			break
+		}
+	}
+
+	h.mtx.Lock()
+	h.counts[bucket]++
+	h.total++
+	if latency > h.max {
+		h.max = latency
+	}
+	h.mtx.Unlock()
+}
+
+// percentile returns the latency at or below which the passed fraction of
+// samples fall.  It must be called with the histogram lock held.
+func (h *latencyHistogram) percentile(fraction float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(fraction * float64(h.total)))
+	if rank == 0 {
+		rank = 1
+	}
+	var cumulative uint64
+	for i, count := range h.counts {
+		cumulative += count
+		if cumulative >= rank {
+			if i < len(latencyBucketBounds) {
+				return latencyBucketBounds[i]
+			}
+			break
+		}
+	}
+	return h.max
+}
+
+// snapshot returns a copy of the current histogram state.
+func (h *latencyHistogram) snapshot() LatencySnapshot {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	buckets := make([]LatencyBucket, len(h.counts))
+	for i, count := range h.counts {
+		bound := time.Duration(math.MaxInt64)
+		if i < len(latencyBucketBounds) {
+			bound = latencyBucketBounds[i]
+		}
+		buckets[i] = LatencyBucket{UpperBound: bound, Count: count}
+	}
+	return LatencySnapshot{
+		Buckets: buckets,
+		Count:   h.total,
+		Max:     h.max,
+		P50:     h.percentile(0.50),
+		P90:     h.percentile(0.90),
+		P99:     h.percentile(0.99),
+	}
+}
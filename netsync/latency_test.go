@@ -0,0 +1,148 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestLatencyHistogram ensures latency samples are counted in the expected
+// buckets and the reported percentiles are derived from them.
+func TestLatencyHistogram(t *testing.T) {
+	h := newLatencyHistogram()
+	snap := h.snapshot()
+	if snap.Count != 0 || snap.P50 != 0 || snap.P99 != 0 {
+		t.Fatalf("unexpected empty histogram snapshot %+v", snap)
+	}
+
+	// Record 50 samples of 5ms, 40 of 80ms, 9 of 700ms and a single
+	// sample beyond the largest bucket.
+	for i := 0; i < 50; i++ {
+		h.observe(5 * time.Millisecond)
+	}
+	for i := 0; i < 40; i++ {
+		h.observe(80 * time.Millisecond)
+	}
+	for i := 0; i < 9; i++ {
+		h.observe(700 * time.Millisecond)
+	}
+	h.observe(2 * time.Minute)
+
+	snap = h.snapshot()
+	if len(snap.Buckets) != len(latencyBucketBounds)+1 {
+		t.Fatalf("unexpected number of buckets %d", len(snap.Buckets))
+	}
+	wantCounts := map[time.Duration]uint64{
+		10 * time.Millisecond:        50,
+		100 * time.Millisecond:       40,
+		time.Second:                  9,
+		time.Duration(math.MaxInt64): 1,
+	}
+	for _, bucket := range snap.Buckets {
+		if bucket.Count != wantCounts[bucket.UpperBound] {
+			t.Errorf("bucket %v: got count %d, want %d",
+				bucket.UpperBound, bucket.Count,
+				wantCounts[bucket.UpperBound])
+		}
+	}
+	if snap.Count != 100 {
+		t.Errorf("got count %d, want 100", snap.Count)
+	}
+	if snap.Max != 2*time.Minute {
+		t.Errorf("got max %v, want %v", snap.Max, 2*time.Minute)
+	}
+	if snap.P50 != 10*time.Millisecond {
+		t.Errorf("got p50 %v, want %v", snap.P50, 10*time.Millisecond)
+	}
+	if snap.P90 != 100*time.Millisecond {
+		t.Errorf("got p90 %v, want %v", snap.P90, 100*time.Millisecond)
+	}
+	if snap.P99 != time.Second {
+		t.Errorf("got p99 %v, want %v", snap.P99, time.Second)
+	}
+
+	// The overflow bucket reports the largest observed latency.
+	h.observe(3 * time.Minute)
+	h.observe(3 * time.Minute)
+	if snap = h.snapshot(); snap.P99 != 3*time.Minute {
+		t.Errorf("got p99 %v, want %v", snap.P99, 3*time.Minute)
+	}
+}
+
+// TestPropagationLatency ensures the time between an inventory announcement
+// and receipt of the announced data is recorded.
+func TestPropagationLatency(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+
+	// Extend the chain with a recent block so it is considered current
+	// and the announced block is requested.
+	block := ctx.createBlock(t)
+	if _, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone); err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+
+	// Announce a block and transaction, then pretend the announcements
+	// arrived earlier to control the measured delays.
+	block = ctx.createBlock(t)
+	tx := btcutil.NewTx(wire.NewMsgTx(wire.TxVersion))
+	inv := wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, block.Hash()))
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeTx, tx.Hash()))
+	ctx.sm.handleInvMsg(&invMsg{inv: inv, peer: peer.Peer})
+	if _, ok := ctx.sm.invFirstSeen[*block.Hash()]; !ok {
+		t.Fatal("block announcement not recorded")
+	}
+	if _, ok := ctx.sm.invFirstSeen[*tx.Hash()]; !ok {
+		t.Fatal("transaction announcement not recorded")
+	}
+	ctx.sm.invFirstSeen[*block.Hash()] = time.Now().Add(-300 * time.Millisecond)
+	ctx.sm.invFirstSeen[*tx.Hash()] = time.Now().Add(-30 * time.Millisecond)
+
+	ctx.sm.handleBlockMsg(&blockMsg{block: block, peer: peer.Peer,
+		reply: make(chan struct{}, 1)})
+	ctx.sm.handleTxMsg(&txMsg{tx: tx, peer: peer.Peer,
+		reply: make(chan struct{}, 1)})
+
+	// The block latency falls in the 500ms bucket and the transaction
+	// latency in the 50ms bucket.
+	checkSnapshot := func(name string, snap LatencySnapshot, want time.Duration) {
+		t.Helper()
+		if snap.Count != 1 {
+			t.Fatalf("%s: got %d samples, want 1", name, snap.Count)
+		}
+		for _, bucket := range snap.Buckets {
+			wantCount := uint64(0)
+			if bucket.UpperBound == want {
+				wantCount = 1
+			}
+			if bucket.Count != wantCount {
+				t.Errorf("%s: bucket %v: got count %d, want %d",
+					name, bucket.UpperBound, bucket.Count,
+					wantCount)
+			}
+		}
+		if snap.P50 != want || snap.P90 != want || snap.P99 != want {
+			t.Errorf("%s: unexpected percentiles %v/%v/%v, want %v",
+				name, snap.P50, snap.P90, snap.P99, want)
+		}
+	}
+	checkSnapshot("block", ctx.sm.BlockPropagationLatency(),
+		500*time.Millisecond)
+	checkSnapshot("tx", ctx.sm.TxPropagationLatency(), 50*time.Millisecond)
+
+	if len(ctx.sm.invFirstSeen) != 0 {
+		t.Fatalf("%d announcements still tracked after receipt",
+			len(ctx.sm.invFirstSeen))
+	}
+}
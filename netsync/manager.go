@@ -5,14 +5,19 @@
 package netsync
 
 import (
+	"container/heap"
 	"container/list"
-	"math/rand"
+	"errors"
+	"fmt"
+	"io"
 	"net"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/indexers"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -28,6 +33,32 @@ const (
 	// more.
 	minInFlightBlocks = 10
 
+	// DefaultBlockDownloadWindow is the default maximum number of blocks
+	// that may be requested from the sync peer at once in headers-first
+	// mode.
+	DefaultBlockDownloadWindow = wire.MaxInvPerMsg
+
+	// DefaultMaxSyncCandidates is the default maximum number of sync
+	// candidate peers considered when choosing the sync peer.
+	DefaultMaxSyncCandidates = 16
+
+	// DefaultMaxOrphanResolveDepth is the default maximum number of blocks
+	// an orphan may be ahead of the best chain for its missing ancestors to
+	// be requested up to the orphan root in a single pass.
+	DefaultMaxOrphanResolveDepth = wire.MaxBlocksPerMsg
+
+	// DefaultMaxOrphanResolveRequests is the default maximum number of
+	// orphan resolution requests outstanding at once across all peers.
+	DefaultMaxOrphanResolveRequests = 8
+
+	// DefaultMaxPeerOrphans is the default maximum number of orphan blocks
+	// accepted from a single peer within each orphan window.
+	DefaultMaxPeerOrphans = 16
+
+	// DefaultPeerOrphanWindow is the default duration of the windows over
+	// which the orphan blocks accepted from each peer are counted.
+	DefaultPeerOrphanWindow = time.Minute
+
 	// maxRejectedTxns is the maximum number of rejected transactions
 	// hashes to store in memory.
 	maxRejectedTxns = 1000
@@ -40,18 +71,174 @@ const (
 	// hashes to store in memory.
 	maxRequestedTxns = wire.MaxInvPerMsg
 
-	// maxStallDuration is the time after which we will disconnect our
-	// current sync peer if we haven't made progress.
-	maxStallDuration = 3 * time.Minute
+	// maxRecentBlocks is the maximum number of recently processed block
+	// hashes to remember so the same block delivered by another peer is
+	// not processed again.
+	maxRecentBlocks = 16
+
+	// unrequestedBlockBanScore is the decaying ban score added to a peer
+	// for each block it sends that was not requested from it and does not
+	// extend the best chain.
+	unrequestedBlockBanScore = 20
+
+	// deepOrphanBanScore is the decaying ban score added to a peer for each
+	// orphan it sends that claims a height further beyond the height the
+	// peer advertised than the maximum orphan resolution depth.
+	deepOrphanBanScore = 10
+
+	// throttledOrphanBanScore is the decaying ban score added to a peer
+	// for each orphan it sends after exceeding the number of orphans
+	// accepted from it within the orphan window.
+	throttledOrphanBanScore = 10
+
+	// orphanLoopBanScore is the decaying ban score added to a peer for each
+	// orphan resolution request that is not sent to it because identical
+	// requests were repeated too often.  See maxOrphanResolveRepeats.
+	orphanLoopBanScore = 10
+
+	// maxOrphanResolveRepeats is the maximum number of times an identical
+	// orphan resolution request is repeated to a peer within the orphan
+	// loop window.  A peer that keeps announcing an orphan without ever
+	// providing its missing ancestors would otherwise have the same blocks
+	// requested from it indefinitely.
+	maxOrphanResolveRepeats = 3
+
+	// orphanLoopWindow is the duration over which identical orphan
+	// resolution requests to a peer are counted.
+	orphanLoopWindow = 5 * time.Minute
+
+	// lowWorkBlockBanScore is the transient ban score added to a peer for
+	// each block it sends whose proof of work does not meet the difficulty
+	// expected at its height.  The score decays, so a peer is only banned
+	// when it keeps sending such blocks.
+	lowWorkBlockBanScore = 50
+
+	// maxOrphanHeights is the maximum number of heights claimed by received
+	// orphan blocks to store in memory.
+	maxOrphanHeights = 100
+
+	// orphanResolveTimeout is the duration after which an orphan resolution
+	// request no longer counts as outstanding.  Peers that have none of the
+	// requested blocks do not respond at all, so requests can't be relied
+	// on to be answered.
+	orphanResolveTimeout = 30 * time.Second
+
+	// headersVersion is the protocol version which added the getheaders and
+	// headers messages (pver >= headersVersion).
+	headersVersion uint32 = 31800
+
+	// maxInvFirstSeen is the maximum number of first-seen times of
+	// announced inventory to store in memory for measuring propagation
+	// latency.
+	maxInvFirstSeen = maxRequestedBlocks + maxRequestedTxns
+
+	// maxBlockAlternates is the maximum number of alternate peers tracked
+	// for each requested block.
+	maxBlockAlternates = 8
+
+	// maxPendingRelays is the maximum number of inventory announcements
+	// held while no peers are connected.
+	maxPendingRelays = 16
+
+	// pendingRelayTimeout is the time after which an inventory announcement
+	// held while no peers are connected is considered stale and dropped.
+	pendingRelayTimeout = 10 * time.Minute
+
+	// defaultMsgQueuePerPeer is the default number of message queue slots
+	// allocated for each peer.
+	defaultMsgQueuePerPeer = 3
+
+	// defaultMaxStallDuration is the default time after which we will
+	// disconnect our current sync peer if we haven't made progress.
+	defaultMaxStallDuration = 3 * time.Minute
+
+	// defaultStallSampleInterval the default interval at which we will
+	// check to see if our sync has stalled.
+	defaultStallSampleInterval = 30 * time.Second
+
+	// defaultBehindGracePeriod is the default time a sync candidate may be
+	// behind our best height before it is no longer considered a candidate.
+	defaultBehindGracePeriod = 2 * time.Minute
+
+	// defaultCandidateSummaryInterval is the default interval at which a
+	// summary of the sync candidates is logged while syncing.
+	defaultCandidateSummaryInterval = time.Minute
+
+	// defaultMaxBlockBurst is the default maximum number of queued block
+	// messages handled ahead of other messages before another message is
+	// handled.
+	defaultMaxBlockBurst = 16
+
+	// defaultSyncPeerSwitchInterval is the default minimum time between
+	// switches of the sync peer to a better candidate that connected.
+	defaultSyncPeerSwitchInterval = 5 * time.Minute
+
+	// defaultLoadCheckInterval is the default interval at which the system
+	// load is checked when block processing is throttled by load.
+	defaultLoadCheckInterval = 5 * time.Second
+
+	// syncPeerHeightMargin is the number of blocks by which the height a
+	// candidate has proven to have must exceed that of the sync peer for
+	// the sync to switch to the candidate.
+	syncPeerHeightMargin = wire.MaxBlocksPerMsg
+
+	// syncPeerDeliveryFactor is the factor by which the measured average
+	// block delivery time of a candidate must be lower than that of the
+	// sync peer for the sync to switch to the candidate.
+	syncPeerDeliveryFactor = 4
+
+	// minDeliverySamples is the number of blocks a peer must have
+	// delivered before its average block delivery time is trusted.
+	minDeliverySamples = 16
+
+	// defaultProgressLogInterval is the default minimum interval between
+	// block processing progress log messages.
+	defaultProgressLogInterval = 10 * time.Second
+)
+
+// errShuttingDown is returned for requests made to the sync manager after it
+// has begun shutting down.
+var errShuttingDown = errors.New("sync manager is shutting down")
 
-	// stallSampleInterval the interval at which we will check to see if our
-	// sync has stalled.
-	stallSampleInterval = 30 * time.Second
+var (
+	// ErrBlockNotFound is returned by block lookups when the requested
+	// block is not in the main chain.
+	ErrBlockNotFound = errors.New("block not found in main chain")
+
+	// ErrOrphanBlock is returned by block lookups when the requested block
+	// is a known orphan, so its height is not yet known.
+	ErrOrphanBlock = errors.New("block is an orphan")
+
+	// ErrBlockBodyNotAvailable is returned by block fetches when only the
+	// header of the requested block is known.  The body has been requested
+	// and the fetch may be retried later.
+	ErrBlockBodyNotAvailable = errors.New("block body not yet available")
+
+	// ErrBlockCorrupt is returned by block fetches when the stored copy of
+	// the requested block can't be read.  The block has been requested
+	// again from a peer and the fetch may be retried later.
+	ErrBlockCorrupt = errors.New("stored block is corrupt")
+
+	// ErrMalformedBlock is returned by block submissions when the
+	// submitted bytes can't be decoded as a block.
+	ErrMalformedBlock = errors.New("malformed block")
 )
 
 // zeroHash is the zero value hash (all zeros).  It is defined as a convenience.
+//
+// When used as the stop hash of a getblocks or getheaders message, it asks the
+// remote peer for as many blocks or headers after the locator as fit in a
+// single response, since no block hashes to zero.
 var zeroHash chainhash.Hash
 
+// pendingRelay houses an inventory announcement that could not be relayed
+// because no peers were connected along with the time it expires.
+type pendingRelay struct {
+	iv     *wire.InvVect
+	data   interface{}
+	expiry time.Time
+}
+
 // newPeerMsg signifies a newly connected peer to the block handler.
 type newPeerMsg struct {
 	peer *peerpkg.Peer
@@ -105,6 +292,37 @@ type getSyncPeerMsg struct {
 	reply chan int32
 }
 
+// getPendingStateMsg is a message type to be sent across the message channel
+// for retrieving a snapshot of the outstanding work of the sync manager.
+type getPendingStateMsg struct {
+	reply chan *PendingState
+}
+
+// getInFlightRequestsMsg is a message type to be sent across the message
+// channel for retrieving the blocks requested from peers that have not been
+// received yet.
+type getInFlightRequestsMsg struct {
+	reply chan []InFlightRequest
+}
+
+// getOrphanResolveRequestsMsg is a message type to be sent across the message
+// channel for retrieving the number of outstanding orphan resolution requests.
+type getOrphanResolveRequestsMsg struct {
+	reply chan int
+}
+
+// getDownloadProgressMsg is a message type to be sent across the message
+// channel for retrieving the estimated percentage of the chain downloaded.
+type getDownloadProgressMsg struct {
+	reply chan float64
+}
+
+// getMessageStatsMsg is a message type to be sent across the message channel
+// for retrieving the message volume counters of the peers.
+type getMessageStatsMsg struct {
+	reply chan []PeerMessageStats
+}
+
 // processBlockResponse is a response sent to the reply channel of a
 // processBlockMsg.
 type processBlockResponse struct {
@@ -123,6 +341,12 @@ type processBlockMsg struct {
 	reply chan processBlockResponse
 }
 
+// getStateMsg is a message type to be sent across the message channel for
+// retrieving the lifecycle state of the sync manager while it is running.
+type getStateMsg struct {
+	reply chan SyncState
+}
+
 // isCurrentMsg is a message type to be sent across the message channel for
 // requesting whether or not the sync manager believes it is synced with the
 // currently connected peers.
@@ -138,6 +362,40 @@ type pauseMsg struct {
 	unpause <-chan struct{}
 }
 
+// cancelSyncMsg is a message type to be sent across the message channel for
+// cancelling the in-progress sync.
+type cancelSyncMsg struct {
+	reply chan struct{}
+}
+
+// setVerifyMsg is a message type to be sent across the message channel for
+// enabling or disabling the verification of the scripts of blocks received
+// from peers.
+type setVerifyMsg struct {
+	verify bool
+	reply  chan struct{}
+}
+
+// resumeSyncMsg is a message type to be sent across the message channel for
+// resuming syncing after it was cancelled.
+type resumeSyncMsg struct {
+	reply chan struct{}
+}
+
+// fetchBlockBodyResponse is a response sent to the reply channel of a
+// fetchBlockBodyMsg.
+type fetchBlockBodyResponse struct {
+	block *btcutil.Block
+	err   error
+}
+
+// fetchBlockBodyMsg is a message type to be sent across the message channel
+// for fetching a block whose body may not have been downloaded yet.
+type fetchBlockBodyMsg struct {
+	hash  *chainhash.Hash
+	reply chan fetchBlockBodyResponse
+}
+
 // headerNode is used as a node in a list of headers that are linked together
 // between checkpoints.
 type headerNode struct {
@@ -152,6 +410,57 @@ type peerSyncState struct {
 	requestQueue    []*wire.InvVect
 	requestedTxns   map[chainhash.Hash]struct{}
 	requestedBlocks map[chainhash.Hash]struct{}
+
+	// pendingCheckpoints houses the checkpoints the peer must still prove
+	// it has in its chain before it may be chosen as the sync peer.  The
+	// first entry is the one that has been requested.
+	pendingCheckpoints []chaincfg.Checkpoint
+
+	// behindSince is the time the peer was first found to be behind our
+	// best height while being a sync candidate or zero when it is not
+	// behind.
+	behindSince time.Time
+
+	// orphanWindowStart is the time the current orphan window of the peer
+	// started and orphanCount is the number of orphan blocks accepted from
+	// the peer within it.
+	orphanWindowStart time.Time
+	orphanCount       int
+
+	// msgStats houses the message volume counters of the peer.
+	msgStats peerMsgStats
+
+	// netGroup is the network group of the peer address.
+	netGroup string
+
+	// verifiedHeight is the height of the latest block the peer has proven
+	// to have by delivering it, announcing it once it is in our chain, or
+	// sending headers that link up to it.  Unlike the height the peer
+	// advertises, it can't be inflated to win sync peer selection.
+	verifiedHeight int32
+
+	// candidate is the entry of the peer in the tracked sync candidates or
+	// nil when it is not tracked.
+	candidate *syncCandidate
+
+	// deliveryTime is the moving average of the time the peer took to
+	// deliver the blocks requested from it and deliveries is the number of
+	// blocks it is based on.
+	deliveryTime time.Duration
+	deliveries   int
+
+	// orphanResolves houses the number of times each orphan resolution
+	// request was made to the peer within the orphan loop window that
+	// started at orphanResolveStart.
+	orphanResolves     map[orphanResolveKey]int
+	orphanResolveStart time.Time
+
+	// pipeline houses the blocks requested with the getdata messages
+	// outstanding to the peer when pipelining requests, one batch per
+	// message in the order they were sent, and reorder houses the blocks
+	// received ahead of blocks requested before them.
+	pipeline [][]chainhash.Hash
+	reorder  map[chainhash.Hash]*blockMsg
 }
 
 // limitAdd is a helper function for maps that require a maximum limit by
@@ -173,6 +482,24 @@ func limitAdd(m map[chainhash.Hash]struct{}, hash chainhash.Hash, limit int) {
 	m[hash] = struct{}{}
 }
 
+// limitAddTime adds the passed time for the hash to the map if there is not
+// already an entry for it, evicting a random entry when the map would grow
+// beyond the provided limit.
+func limitAddTime(m map[chainhash.Hash]time.Time, hash chainhash.Hash,
+	t time.Time, limit int) {
+
+	if _, exists := m[hash]; exists {
+		return
+	}
+	if len(m)+1 > limit {
+		for h := range m {
+			delete(m, h)
+			break
+		}
+	}
+	m[hash] = t
+}
+
 // SyncManager is used to communicate block related messages with peers. The
 // SyncManager is started as by executing Start() in a goroutine. Once started,
 // it selects peers to sync from and starts the initial block download. Once the
@@ -182,21 +509,209 @@ type SyncManager struct {
 	peerNotifier   PeerNotifier
 	started        int32
 	shutdown       int32
+	shutdownMtx    sync.RWMutex
+	done           chan struct{}
 	chain          *blockchain.BlockChain
 	txMemPool      *mempool.TxPool
 	chainParams    *chaincfg.Params
 	progressLogger *blockProgressLogger
+	txRejectLogger *txRejectLogger
 	msgChan        chan interface{}
+	priorityChan   chan interface{}
 	wg             sync.WaitGroup
 	quit           chan struct{}
 
+	// blockStats caches the statistics of the blocks at the tip of the
+	// main chain for ChainStats.
+	blockStats blockStatsCache
+
+	// backpressure is whether the message queues are full enough that the
+	// peer notifier was told to pause reading from the peers filling them.
+	// queuedMsgs counts the queued messages from each peer and
+	// pausedPeers holds the peers reading from is paused for.
+	backpressure    bool
+	queuedMsgs      map[*peerpkg.Peer]int
+	pausedPeers     map[*peerpkg.Peer]struct{}
+	backpressureMtx sync.Mutex
+
+	// These fields are set from the tuning knobs in the config.
+	maxStallDuration    time.Duration
+	behindGracePeriod   time.Duration
+	stallSampleInterval time.Duration
+	summaryInterval     time.Duration
+	switchInterval      time.Duration
+	maxBlockBurst       int
+	blockDownloadWindow int
+	checkpointQuorum    int
+	maxSyncCandidates   int
+	maxOrphanDepth      int32
+	maxOrphanRequests   int
+	maxPeerOrphans      int
+	peerOrphanWindow    time.Duration
+	getDataPipeline     int
+	handlerTimeout      time.Duration
+
+	// loadSource reports the system load when it is non-nil and
+	// loadThrottled is set while the load exceeds maxLoad, which pauses
+	// the processing of queued blocks.
+	loadSource        LoadSource
+	maxLoad           float64
+	loadCheckInterval time.Duration
+	loadThrottled     bool
+
+	// syncPeerSelector chooses among equally good sync candidates.
+	syncPeerSelector SyncPeerSelector
+
+	// diverseSyncPeer prefers sync candidates in a network group distinct
+	// from the other connected peers, whose number in each network group
+	// is tracked by netGroups.
+	diverseSyncPeer bool
+	netGroups       map[string]int
+
+	// assumeValid is the block whose ancestors are processed without
+	// running their scripts or nil when there is none.  The headers leading
+	// to it are requested from the sync peer to learn its ancestors.
+	// assumeValidKnown is set and assumeValidHeight houses its height once
+	// they are known.  assumeValidAnchors houses the hash of every
+	// assumeValidSegmentSize-th ancestor starting from the main chain block
+	// at assumeValidBase and ending with the assumed valid block.
+	// assumeValidWindow houses the hashes of the next ancestors to process
+	// starting at height assumeValidWindowStart.  assumeValidPeer is the
+	// peer headers are requested from.
+	assumeValid            *chainhash.Hash
+	assumeValidKnown       bool
+	assumeValidHeight      int32
+	assumeValidBase        int32
+	assumeValidAnchors     []chainhash.Hash
+	assumeValidWindow      []chainhash.Hash
+	assumeValidWindowStart int32
+	assumeValidPeer        *peerpkg.Peer
+
+	// disableVerify disables the verification of the scripts of the blocks
+	// received from peers.
+	disableVerify bool
+
+	// unverifiedBlock is the block being processed without executing its
+	// scripts, which is not relayed.
+	unverifiedBlock *chainhash.Hash
+
+	// requestPeers is invoked when the sync stalls for lack of candidates.
+	requestPeers func()
+
+	// relayMainChainOnly suppresses the relay of side chain blocks.
+	relayMainChainOnly bool
+
+	// relayWhileSyncing relays accepted blocks while not current.
+	relayWhileSyncing bool
+
+	// logAcceptedBlocks logs each block connected to the main chain.
+	logAcceptedBlocks bool
+
+	// tipRelayDelay and maxTipRelayDelay delay the relay of new tips so
+	// tips accepted in quick succession are coalesced.  See
+	// delayTipRelay.
+	tipRelayDelay    time.Duration
+	maxTipRelayDelay time.Duration
+
+	// txRelayDelay delays the relay of accepted transactions to peers.  See
+	// delayTxRelay.
+	txRelayDelay time.Duration
+
+	// blockJournal records accepted blocks when it is non-nil.
+	blockJournal *BlockJournal
+
+	// orphanStore keeps orphan blocks on disk when it is non-nil.
+	orphanStore *OrphanStore
+
+	// txIndex looks up confirmed transactions when it is non-nil.
+	txIndex *indexers.TxIndex
+
+	// blockExporter exports connected blocks when it is non-nil.
+	blockExporter *BlockExporter
+
+	// addBanScore is invoked to penalize misbehaving peers.  Misbehaving
+	// peers are disconnected instead when it is nil.
+	addBanScore func(peer *peerpkg.Peer, persistent, transient uint32,
+		reason string)
+
+	// onBestBlockChanged is invoked when the tip of the main chain
+	// changes when it is non-nil.
+	onBestBlockChanged func(hash *chainhash.Hash, height int32)
+
+	// blockHandlerBeat is updated by the block handler as it makes
+	// progress and checked by the watchdog, which closes stuck and invokes
+	// onHandlerStuck when the handler is stuck.
+	blockHandlerBeat heartbeat
+	stuck            chan struct{}
+	onHandlerStuck   func()
+
 	// These fields should only be accessed from the blockHandler thread
 	rejectedTxns     map[chainhash.Hash]struct{}
 	requestedTxns    map[chainhash.Hash]struct{}
 	requestedBlocks  map[chainhash.Hash]struct{}
+	blockAlternates  map[chainhash.Hash][]*peerpkg.Peer
+	recentBlocks     map[chainhash.Hash]*peerpkg.Peer
 	syncPeer         *peerpkg.Peer
+	syncCandidates   candidateHeap
 	peerStates       map[*peerpkg.Peer]*peerSyncState
 	lastProgressTime time.Time
+	pendingRelays    []pendingRelay
+
+	// pendingTxRelays houses the accepted transactions waiting to be
+	// announced in the order they are due when transaction announcements
+	// are delayed.  txRelayTimer fires when the first of them is due.
+	pendingTxRelays []pendingTxRelay
+	txRelayTimer    *time.Timer
+
+	// pendingTip houses the latest tip waiting to be relayed when tip
+	// relays are delayed.  tipRelayTimer fires when it is due and
+	// tipRelayDeadline is the time by which it must be relayed.
+	pendingTip       *btcutil.Block
+	tipRelayTimer    *time.Timer
+	tipRelayDeadline time.Time
+	invFirstSeen     map[chainhash.Hash]time.Time
+	orphanHeights    map[chainhash.Hash]int32
+
+	// orphanRequests houses the time of the outstanding orphan resolution
+	// request of each peer.  See resolveOrphan.
+	orphanRequests map[*peerpkg.Peer]time.Time
+
+	// cmpctBlocks houses the compact block of each peer whose missing
+	// transactions were requested from it.  See handleCmpctBlockMsg.
+	cmpctBlocks map[*peerpkg.Peer]*partialBlock
+
+	// blockRequestTimes houses the time each block in flight was
+	// requested.
+	blockRequestTimes map[chainhash.Hash]time.Time
+
+	// Propagation latency histograms.  These are safe for concurrent
+	// access.
+	blockLatency *latencyHistogram
+	txLatency    *latencyHistogram
+
+	// txFeed delivers accepted transactions to subscribers.  It is safe
+	// for concurrent access.
+	txFeed *txFeed
+
+	// syncCancelled is set while syncing is cancelled so no sync peer is
+	// chosen until it is resumed.  cancelledSyncPeer is the sync peer at
+	// the time syncing was cancelled, whose responses to outstanding
+	// requests are no longer expected.
+	syncCancelled     bool
+	cancelledSyncPeer *peerpkg.Peer
+
+	// lastSyncPeerSwitch is the last time the sync peer was switched to a
+	// better candidate.  previousSyncPeer is the sync peer switched away
+	// from, whose blocks in flight are still awaited until the stall
+	// timeout elapses.
+	lastSyncPeerSwitch time.Time
+	previousSyncPeer   *peerpkg.Peer
+
+	// getBlocksContinue is the hash of the last block of the latest full
+	// batch of blocks announced by the sync peer.  The peer has more
+	// blocks after a full batch, so they are requested once it is
+	// received.
+	getBlocksContinue *chainhash.Hash
 
 	// The following fields are used for headers-first mode.
 	headersFirstMode bool
@@ -204,8 +719,24 @@ type SyncManager struct {
 	startHeader      *list.Element
 	nextCheckpoint   *chaincfg.Checkpoint
 
+	// bodyRequests houses the blocks whose bodies were requested on demand
+	// ahead of their turn in headers-first mode and pendingBodies houses
+	// those bodies until the blocks before them have been processed.
+	bodyRequests  map[chainhash.Hash]struct{}
+	pendingBodies map[chainhash.Hash]*btcutil.Block
+
+	// corruptBlocks houses the main chain blocks whose stored copies can't
+	// be read and are being downloaded again, and repairedBlocks houses the
+	// downloaded copies, which are served in place of the stored ones.
+	corruptBlocks  map[chainhash.Hash]struct{}
+	repairedBlocks map[chainhash.Hash]*btcutil.Block
+
 	// An optional fee estimator.
 	feeEstimator *mempool.FeeEstimator
+
+	// invHandlers houses handlers for inventory types which are not
+	// natively supported.
+	invHandlers map[wire.InvType]InvHandler
 }
 
 // resetHeaderState sets the headers-first mode state to values appropriate for
@@ -214,6 +745,8 @@ func (sm *SyncManager) resetHeaderState(newestHash *chainhash.Hash, newestHeight
 	sm.headersFirstMode = false
 	sm.headerList.Init()
 	sm.startHeader = nil
+	sm.bodyRequests = make(map[chainhash.Hash]struct{})
+	sm.pendingBodies = make(map[chainhash.Hash]*btcutil.Block)
 
 	// When there is a next checkpoint, add an entry for the latest known
 	// block into the header pool.  This allows the next downloaded header
@@ -252,132 +785,238 @@ func (sm *SyncManager) findNextHeaderCheckpoint(height int32) *chaincfg.Checkpoi
 	return nextCheckpoint
 }
 
-// startSync will choose the best peer among the available candidate peers to
-// download/sync the blockchain from.  When syncing is already running, it
-// simply returns.  It also examines the candidates for any which are no longer
-// candidates and removes them as needed.
-func (sm *SyncManager) startSync() {
-	// Return now if we're already syncing.
-	if sm.syncPeer != nil {
-		return
+// pushGetBlocks sends a getblocks message for as many blocks as possible after
+// the passed locator to the passed peer.
+func (sm *SyncManager) pushGetBlocks(peer *peerpkg.Peer,
+	locator blockchain.BlockLocator) error {
+
+	if err := peer.PushGetBlocksMsg(locator, &zeroHash); err != nil {
+		return err
 	}
+	sm.getBlocksContinue = nil
+	return nil
+}
 
-	// Once the segwit soft-fork package has activated, we only
-	// want to sync from peers which are witness enabled to ensure
-	// that we fully validate all blockchain data.
-	segwitActive, err := sm.chain.IsDeploymentActive(chaincfg.DeploymentSegwit)
+// requestNextBlocks sends a getblocks message for the blocks after the tip of
+// the best chain to the passed peer.
+func (sm *SyncManager) requestNextBlocks(peer *peerpkg.Peer) {
+	locator, err := sm.chain.LatestBlockLocator()
 	if err != nil {
-		log.Errorf("Unable to query for segwit soft-fork state: %v", err)
+		log.Warnf("Failed to get block locator for the latest block: %v",
+			err)
 		return
 	}
+	sm.pushGetBlocks(peer, locator)
+}
 
-	best := sm.chain.BestSnapshot()
-	var higherPeers, equalPeers []*peerpkg.Peer
-	for peer, state := range sm.peerStates {
-		if !state.syncCandidate {
+// pickSyncCandidate returns the tracked sync candidate with the most verified
+// progress that is eligible to be the sync peer along with whether any
+// candidates were dropped because they are no longer candidates.  When several
+// eligible candidates rank equally, the sync peer selector chooses among them.
+// Candidates that are skipped but remain eligible are kept.
+func (sm *SyncManager) pickSyncCandidate(bestHeight int32,
+	segwitActive bool) (*peerpkg.Peer, bool) {
+
+	var best []*syncCandidate
+	var skipped []*syncCandidate
+	var dropped bool
+	for sm.syncCandidates.Len() > 0 {
+		// Stop once the remaining candidates rank below the eligible
+		// candidates found so far.
+		if len(best) > 0 && best[0].outranks(sm.syncCandidates[0]) {
+			break
+		}
+
+		c := heap.Pop(&sm.syncCandidates).(*syncCandidate)
+		peer, state := c.peer, c.state
+		if !state.syncCandidate || sm.peerStates[peer] != state {
+			state.candidate = nil
+			dropped = true
 			continue
 		}
 
 		if segwitActive && !peer.IsWitnessEnabled() {
 			log.Debugf("peer %v not witness enabled, skipping", peer)
+			skipped = append(skipped, c)
+			continue
+		}
+
+		// Don't trust peers that have not yet proven their chain
+		// matches the checkpoint quorum.
+		if len(state.pendingCheckpoints) > 0 {
+			log.Debugf("peer %v has not verified checkpoints, "+
+				"skipping", peer)
+			skipped = append(skipped, c)
 			continue
 		}
 
 		// Remove sync candidate peers that are no longer candidates due
-		// to passing their latest known block.  NOTE: The < is
+		// to passing their latest known block once they have been
+		// behind for the grace period, since a peer that is still
+		// downloading blocks itself may catch up.  NOTE: The < is
 		// intentional as opposed to <=.  While technically the peer
 		// doesn't have a later block when it's equal, it will likely
 		// have one soon so it is a reasonable choice.  It also allows
 		// the case where both are at 0 such as during regression test.
-		if peer.LastBlock() < best.Height {
+		if peer.LastBlock() < bestHeight {
+			if state.behindSince.IsZero() {
+				state.behindSince = time.Now()
+			}
+			if time.Since(state.behindSince) < sm.behindGracePeriod {
+				log.Debugf("peer %v is behind, skipping", peer)
+				skipped = append(skipped, c)
+				continue
+			}
 			state.syncCandidate = false
+			state.candidate = nil
+			dropped = true
 			continue
 		}
+		state.behindSince = time.Time{}
 
-		// If the peer is at the same height as us, we'll add it a set
-		// of backup peers in case we do not find one with a higher
-		// height. If we are synced up with all of our peers, all of
-		// them will be in this set.
-		if peer.LastBlock() == best.Height {
-			equalPeers = append(equalPeers, peer)
-			continue
+		best = append(best, c)
+		skipped = append(skipped, c)
+	}
+	for _, c := range skipped {
+		heap.Push(&sm.syncCandidates, c)
+	}
+	if len(best) == 0 {
+		return nil, dropped
+	}
+	peers := make([]*peerpkg.Peer, 0, len(best))
+	for _, c := range best {
+		peers = append(peers, c.peer)
+	}
+	return sm.selectSyncPeer(peers, bestHeight), dropped
+}
+
+// selectSyncPeer returns the peer chosen by the sync peer selector among the
+// passed equally good candidates, falling back to the first candidate when the
+// selector does not choose one of them.
+func (sm *SyncManager) selectSyncPeer(candidates []*peerpkg.Peer,
+	bestHeight int32) *peerpkg.Peer {
+
+	candidates = sm.diverseSyncCandidates(candidates)
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	selected := sm.syncPeerSelector.SelectSyncPeer(candidates, bestHeight)
+	for _, peer := range candidates {
+		if peer == selected {
+			return peer
 		}
+	}
+	if selected != nil {
+		log.Warnf("Sync peer selector chose peer %v which is not a "+
+			"candidate", selected)
+	}
+	return candidates[0]
+}
+
+// startSync will choose the best peer among the available candidate peers to
+// download/sync the blockchain from.  When syncing is already running, it
+// simply returns.  It also examines the candidates for any which are no longer
+// candidates and removes them as needed.
+func (sm *SyncManager) startSync() {
+	// Return now if we're already syncing or syncing is cancelled.
+	if sm.syncPeer != nil || sm.syncCancelled {
+		return
+	}
 
-		// This peer has a height greater than our own, we'll consider
-		// it in the set of better peers from which we'll randomly
-		// select.
-		higherPeers = append(higherPeers, peer)
+	// Once the segwit soft-fork package has activated, we only
+	// want to sync from peers which are witness enabled to ensure
+	// that we fully validate all blockchain data.
+	segwitActive, err := sm.chain.IsDeploymentActive(chaincfg.DeploymentSegwit)
+	if err != nil {
+		log.Errorf("Unable to query for segwit soft-fork state: %v", err)
+		return
 	}
 
-	// Pick randomly from the set of peers greater than our block height,
-	// falling back to a random peer of the same height if none are greater.
+	// Pick the tracked candidate with the most blocks, falling back to
+	// candidates of the same height as us if none have more.  Candidates
+	// that are no longer eligible are dropped along the way, so keep
+	// picking from refilled candidates until a peer is selected or none
+	// are left.
 	//
 	// TODO(conner): Use a better algorithm to ranking peers based on
 	// observed metrics and/or sync in parallel.
+	best := sm.chain.BestSnapshot()
 	var bestPeer *peerpkg.Peer
-	switch {
-	case len(higherPeers) > 0:
-		bestPeer = higherPeers[rand.Intn(len(higherPeers))]
-
-	case len(equalPeers) > 0:
-		bestPeer = equalPeers[rand.Intn(len(equalPeers))]
+	for {
+		var dropped bool
+		bestPeer, dropped = sm.pickSyncCandidate(best.Height, segwitActive)
+		if bestPeer != nil || !dropped {
+			break
+		}
+		numCandidates := sm.syncCandidates.Len()
+		sm.refillSyncCandidates()
+		if sm.syncCandidates.Len() == numCandidates {
+			break
+		}
 	}
 
 	// Start syncing from the best peer if one was selected.
 	if bestPeer != nil {
-		// Clear the requestedBlocks if the sync peer changes, otherwise
-		// we may ignore blocks we need that the last sync peer failed
-		// to send.
-		sm.requestedBlocks = make(map[chainhash.Hash]struct{})
+		sm.beginSync(bestPeer)
+	} else {
+		log.Warnf("No sync peer candidates available")
+	}
+}
 
-		locator, err := sm.chain.LatestBlockLocator()
-		if err != nil {
-			log.Errorf("Failed to get block locator for the "+
-				"latest block: %v", err)
-			return
-		}
+// beginSync makes the passed peer the sync peer and requests the blocks or
+// headers following our best chain from it.
+func (sm *SyncManager) beginSync(peer *peerpkg.Peer) {
+	// Clear the requestedBlocks if the sync peer changes, otherwise we may
+	// ignore blocks we need that the last sync peer failed to send.
+	sm.requestedBlocks = make(map[chainhash.Hash]struct{})
 
-		log.Infof("Syncing to block height %d from peer %v",
-			bestPeer.LastBlock(), bestPeer.Addr())
-
-		// When the current height is less than a known checkpoint we
-		// can use block headers to learn about which blocks comprise
-		// the chain up to the checkpoint and perform less validation
-		// for them.  This is possible since each header contains the
-		// hash of the previous header and a merkle root.  Therefore if
-		// we validate all of the received headers link together
-		// properly and the checkpoint hashes match, we can be sure the
-		// hashes for the blocks in between are accurate.  Further, once
-		// the full blocks are downloaded, the merkle root is computed
-		// and compared against the value in the header which proves the
-		// full block hasn't been tampered with.
-		//
-		// Once we have passed the final checkpoint, or checkpoints are
-		// disabled, use standard inv messages learn about the blocks
-		// and fully validate them.  Finally, regression test mode does
-		// not support the headers-first approach so do normal block
-		// downloads when in regression test mode.
-		if sm.nextCheckpoint != nil &&
-			best.Height < sm.nextCheckpoint.Height &&
-			sm.chainParams != &chaincfg.RegressionNetParams {
-
-			bestPeer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
-			sm.headersFirstMode = true
-			log.Infof("Downloading headers for blocks %d to "+
-				"%d from peer %s", best.Height+1,
-				sm.nextCheckpoint.Height, bestPeer.Addr())
-		} else {
-			bestPeer.PushGetBlocksMsg(locator, &zeroHash)
-		}
-		sm.syncPeer = bestPeer
+	best := sm.chain.BestSnapshot()
+	locator, err := sm.chain.LatestBlockLocator()
+	if err != nil {
+		log.Errorf("Failed to get block locator for the latest block: %v",
+			err)
+		return
+	}
 
-		// Reset the last progress time now that we have a non-nil
-		// syncPeer to avoid instantly detecting it as stalled in the
-		// event the progress time hasn't been updated recently.
-		sm.lastProgressTime = time.Now()
+	log.Infof("Syncing to block height %d from peer %v", peer.LastBlock(),
+		peer.Addr())
+
+	// When the current height is less than a known checkpoint we can use
+	// block headers to learn about which blocks comprise the chain up to
+	// the checkpoint and perform less validation for them.  This is
+	// possible since each header contains the hash of the previous header
+	// and a merkle root.  Therefore if we validate all of the received
+	// headers link together properly and the checkpoint hashes match, we
+	// can be sure the hashes for the blocks in between are accurate.
+	// Further, once the full blocks are downloaded, the merkle root is
+	// computed and compared against the value in the header which proves
+	// the full block hasn't been tampered with.
+	//
+	// Once we have passed the final checkpoint, or checkpoints are
+	// disabled, use standard inv messages learn about the blocks and fully
+	// validate them.  The same is done for peers that negotiated a protocol
+	// version predating headers.  Finally, regression test mode does not
+	// support the headers-first approach so do normal block downloads when
+	// in regression test mode.
+	if sm.nextCheckpoint != nil &&
+		best.Height < sm.nextCheckpoint.Height &&
+		supportsHeaders(peer) &&
+		sm.chainParams != &chaincfg.RegressionNetParams {
+
+		peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
+		sm.headersFirstMode = true
+		log.Infof("Downloading headers for blocks %d to %d from peer %s",
+			best.Height+1, sm.nextCheckpoint.Height, peer.Addr())
 	} else {
-		log.Warnf("No sync peer candidates available")
+		sm.pushGetBlocks(peer, locator)
+		sm.requestAssumeValidHeaders(peer)
 	}
+	sm.syncPeer = peer
+
+	// Reset the last progress time now that we have a non-nil syncPeer to
+	// avoid instantly detecting it as stalled in the event the progress
+	// time hasn't been updated recently.
+	sm.lastProgressTime = time.Now()
 }
 
 // isSyncCandidate returns whether or not the peer is a candidate to consider
@@ -413,10 +1052,109 @@ func (sm *SyncManager) isSyncCandidate(peer *peerpkg.Peer) bool {
 		}
 	}
 
+	// Peers that can't serve headers can't prove their chain matches the
+	// checkpoint quorum.
+	if !supportsHeaders(peer) && len(sm.checkpointsToVerify(peer)) > 0 {
+		log.Debugf("Peer %s is not a sync candidate -- protocol "+
+			"version %d does not support headers", peer,
+			peer.ProtocolVersion())
+		return false
+	}
+
 	// Candidate if all checks passed.
 	return true
 }
 
+// supportsHeaders returns whether the passed peer negotiated a protocol version
+// that supports the getheaders and headers messages, which are required for
+// headers-first sync and for proving the checkpoint quorum.
+func supportsHeaders(peer *peerpkg.Peer) bool {
+	return peer.ProtocolVersion() >= headersVersion
+}
+
+// trackSyncCandidate adds the passed peer to the set of sync candidates
+// considered when choosing the sync peer.  When the maximum number of
+// candidates is already tracked, the peer is left untracked until a slot is
+// freed since it has not proven any progress that would justify replacing a
+// tracked candidate.
+func (sm *SyncManager) trackSyncCandidate(peer *peerpkg.Peer) {
+	state, exists := sm.peerStates[peer]
+	if !exists || state.candidate != nil {
+		return
+	}
+	if sm.syncCandidates.Len() >= sm.maxSyncCandidates {
+		log.Debugf("Not tracking sync candidate %s -- already tracking "+
+			"%d candidates", peer, sm.syncCandidates.Len())
+		return
+	}
+	state.candidate = &syncCandidate{
+		peer:          peer,
+		state:         state,
+		claimedHeight: peer.LastBlock(),
+	}
+	heap.Push(&sm.syncCandidates, state.candidate)
+}
+
+// untrackSyncCandidate removes the passed peer from the set of sync candidates
+// and fills the freed slot from the untracked candidates.
+func (sm *SyncManager) untrackSyncCandidate(peer *peerpkg.Peer,
+	state *peerSyncState) {
+
+	if state.candidate == nil {
+		return
+	}
+	heap.Remove(&sm.syncCandidates, state.candidate.index)
+	state.candidate = nil
+	sm.refillSyncCandidates()
+}
+
+// refillSyncCandidates tracks the untracked sync candidates with the most
+// verified progress until either the maximum number of candidates is tracked
+// or there are no untracked candidates left.  This scans all peers, so it is
+// only used when tracked candidates are removed.
+func (sm *SyncManager) refillSyncCandidates() {
+	if sm.syncCandidates.Len() >= sm.maxSyncCandidates {
+		return
+	}
+
+	var untracked []*peerpkg.Peer
+	for peer, state := range sm.peerStates {
+		if state.syncCandidate && state.candidate == nil {
+			untracked = append(untracked, peer)
+		}
+	}
+	sort.Slice(untracked, func(i, j int) bool {
+		si := sm.peerStates[untracked[i]]
+		sj := sm.peerStates[untracked[j]]
+		if si.verifiedHeight != sj.verifiedHeight {
+			return si.verifiedHeight > sj.verifiedHeight
+		}
+		return untracked[i].LastBlock() > untracked[j].LastBlock()
+	})
+	for _, peer := range untracked {
+		if sm.syncCandidates.Len() >= sm.maxSyncCandidates {
+			break
+		}
+		sm.trackSyncCandidate(peer)
+	}
+}
+
+// noteVerifiedHeight records that the passed peer has proven to have the block
+// at the passed height and restores the position of the peer among the tracked
+// sync candidates when its rank improved.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) noteVerifiedHeight(peer *peerpkg.Peer, height int32) {
+	state, exists := sm.peerStates[peer]
+	if !exists || height <= state.verifiedHeight {
+		return
+	}
+	state.verifiedHeight = height
+	if state.candidate != nil {
+		heap.Fix(&sm.syncCandidates, state.candidate.index)
+	}
+}
+
 // handleNewPeerMsg deals with new peers that have signalled they may
 // be considered as a sync peer (they have already successfully negotiated).  It
 // also starts syncing if needed.  It is invoked from the syncHandler goroutine.
@@ -426,102 +1164,420 @@ func (sm *SyncManager) handleNewPeerMsg(peer *peerpkg.Peer) {
 		return
 	}
 
-	log.Infof("New valid peer %s (%s)", peer, peer.UserAgent())
+	log.Infof("New valid peer %s (%s, protocol version %d)", peer,
+		peer.UserAgent(), peer.ProtocolVersion())
 
 	// Initialize the peer state
 	isSyncCandidate := sm.isSyncCandidate(peer)
+	netGroup := peerNetGroup(peer)
 	sm.peerStates[peer] = &peerSyncState{
 		syncCandidate:   isSyncCandidate,
 		requestedTxns:   make(map[chainhash.Hash]struct{}),
 		requestedBlocks: make(map[chainhash.Hash]struct{}),
+		netGroup:        netGroup,
+	}
+	sm.netGroups[netGroup]++
+
+	if isSyncCandidate {
+		sm.trackSyncCandidate(peer)
+	}
+
+	// Announce any inventory that was accepted while no peers were
+	// connected.
+	sm.relayPendingInventory()
+
+	// Require sync candidates to prove their chain matches the checkpoint
+	// quorum before they may become the sync peer.
+	if isSyncCandidate {
+		state := sm.peerStates[peer]
+		state.pendingCheckpoints = sm.checkpointsToVerify(peer)
+		if len(state.pendingCheckpoints) > 0 {
+			sm.requestCheckpointHeader(peer, state.pendingCheckpoints[0])
+			return
+		}
 	}
 
-	// Start syncing by choosing the best candidate if needed.
+	// Start syncing by choosing the best candidate if needed or switch to
+	// the new candidate when it is markedly better than the sync peer.
 	if isSyncCandidate && sm.syncPeer == nil {
 		sm.startSync()
+	} else if isSyncCandidate {
+		sm.maybeSwitchSyncPeer(peer)
 	}
 }
 
-// handleStallSample will switch to a new sync peer if the current one has
-// stalled. This is detected when by comparing the last progress timestamp with
-// the current time, and disconnecting the peer if we stalled before reaching
-// their highest advertised block.
-func (sm *SyncManager) handleStallSample() {
-	if atomic.LoadInt32(&sm.shutdown) != 0 {
-		return
+// checkpointsToVerify returns the checkpoints the passed peer must prove it has
+// in its chain before it may be chosen as the sync peer.  These are the most
+// recent checkpoints, up to the configured quorum, that are at or below both
+// our best height and the height advertised by the peer.
+func (sm *SyncManager) checkpointsToVerify(peer *peerpkg.Peer) []chaincfg.Checkpoint {
+	if sm.checkpointQuorum <= 0 {
+		return nil
 	}
 
-	// If we don't have an active sync peer, exit early.
-	if sm.syncPeer == nil {
-		return
+	maxHeight := sm.chain.BestSnapshot().Height
+	if peer.LastBlock() < maxHeight {
+		maxHeight = peer.LastBlock()
+	}
+	checkpoints := sm.chain.Checkpoints()
+	var verify []chaincfg.Checkpoint
+	for i := len(checkpoints) - 1; i >= 0; i-- {
+		if len(verify) >= sm.checkpointQuorum {
+			break
+		}
+		if checkpoints[i].Height > maxHeight {
+			continue
+		}
+		verify = append(verify, checkpoints[i])
 	}
+	return verify
+}
 
-	// If the stall timeout has not elapsed, exit early.
-	if time.Since(sm.lastProgressTime) <= maxStallDuration {
+// requestCheckpointHeader requests the header at the height of the passed
+// checkpoint from the peer by locating it from our own block before the
+// checkpoint.
+func (sm *SyncManager) requestCheckpointHeader(peer *peerpkg.Peer,
+	checkpoint chaincfg.Checkpoint) {
+
+	prevHash, err := sm.chain.BlockHashByHeight(checkpoint.Height - 1)
+	if err != nil {
+		log.Errorf("Failed to fetch block before checkpoint at height "+
+			"%d: %v", checkpoint.Height, err)
 		return
 	}
+	locator := blockchain.BlockLocator{prevHash}
+	if err := peer.PushGetHeadersMsg(locator, checkpoint.Hash); err != nil {
+		log.Errorf("Failed to request checkpoint header from %s: %v",
+			peer, err)
+	}
+}
 
-	// Check to see that the peer's sync state exists.
-	state, exists := sm.peerStates[sm.syncPeer]
-	if !exists {
+// handleCheckpointHeaders handles a headers message from a peer that is
+// proving its chain matches the checkpoint quorum.  The peer is disconnected
+// when the header at the checkpoint height does not match the checkpoint.
+func (sm *SyncManager) handleCheckpointHeaders(peer *peerpkg.Peer,
+	state *peerSyncState, headers []*wire.BlockHeader) {
+
+	checkpoint := state.pendingCheckpoints[0]
+	if len(headers) == 0 || headers[0].BlockHash() != *checkpoint.Hash {
+		log.Warnf("Peer %s does not match checkpoint at height %d -- "+
+			"disconnecting", peer, checkpoint.Height)
+		peer.Disconnect()
 		return
 	}
 
-	sm.clearRequestedState(state)
+	sm.noteVerifiedHeight(peer, checkpoint.Height)
+	state.pendingCheckpoints = state.pendingCheckpoints[1:]
+	if len(state.pendingCheckpoints) > 0 {
+		sm.requestCheckpointHeader(peer, state.pendingCheckpoints[0])
+		return
+	}
 
-	disconnectSyncPeer := sm.shouldDCStalledSyncPeer()
-	sm.updateSyncPeer(disconnectSyncPeer)
+	log.Debugf("Peer %s matches all required checkpoints", peer)
+	if state.syncCandidate && sm.syncPeer == nil {
+		sm.startSync()
+	} else if state.syncCandidate {
+		sm.maybeSwitchSyncPeer(peer)
+	}
 }
 
-// shouldDCStalledSyncPeer determines whether or not we should disconnect a
-// stalled sync peer. If the peer has stalled and its reported height is greater
-// than our own best height, we will disconnect it. Otherwise, we will keep the
-// peer connected in case we are already at tip.
-func (sm *SyncManager) shouldDCStalledSyncPeer() bool {
-	lastBlock := sm.syncPeer.LastBlock()
-	startHeight := sm.syncPeer.StartingHeight()
+// queuePendingRelay holds the passed inventory announcement so it can be
+// relayed once a peer connects.  The oldest announcement is dropped when the
+// maximum number of pending announcements is reached.
+func (sm *SyncManager) queuePendingRelay(iv *wire.InvVect, data interface{}) {
+	if len(sm.pendingRelays) >= maxPendingRelays {
+		log.Debugf("Dropping pending relay of %v", sm.pendingRelays[0].iv)
+		sm.pendingRelays = sm.pendingRelays[1:]
+	}
+	sm.pendingRelays = append(sm.pendingRelays, pendingRelay{
+		iv:     iv,
+		data:   data,
+		expiry: time.Now().Add(pendingRelayTimeout),
+	})
+}
 
-	var peerHeight int32
-	if lastBlock > startHeight {
-		peerHeight = lastBlock
-	} else {
-		peerHeight = startHeight
+// relayPendingInventory relays all inventory announcements that were held
+// while no peers were connected and have not yet expired.
+func (sm *SyncManager) relayPendingInventory() {
+	now := time.Now()
+	for _, relay := range sm.pendingRelays {
+		if now.After(relay.expiry) {
+			log.Debugf("Pending relay of %v expired", relay.iv)
+			continue
+		}
+		sm.peerNotifier.RelayInventory(relay.iv, relay.data)
 	}
-
-	// If we've stalled out yet the sync peer reports having more blocks for
-	// us we will disconnect them. This allows us at tip to not disconnect
-	// peers when we are equal or they temporarily lag behind us.
-	best := sm.chain.BestSnapshot()
-	return peerHeight > best.Height
+	sm.pendingRelays = nil
 }
 
-// handleDonePeerMsg deals with peers that have signalled they are done.  It
-// removes the peer as a candidate for syncing and in the case where it was
-// the current sync peer, attempts to select a new best peer to sync from.  It
-// is invoked from the syncHandler goroutine.
-func (sm *SyncManager) handleDonePeerMsg(peer *peerpkg.Peer) {
-	state, exists := sm.peerStates[peer]
-	if !exists {
-		log.Warnf("Received done peer message for unknown peer %s", peer)
+// relayBlock relays the passed block to all connected peers.  The announcement
+// is held when there are no peers to relay it to so it can be relayed once one
+// connects.
+func (sm *SyncManager) relayBlock(block *btcutil.Block) {
+	iv := wire.NewInvVect(wire.InvTypeBlock, block.Hash())
+	if len(sm.peerStates) == 0 {
+		sm.queuePendingRelay(iv, block.MsgBlock().Header)
 		return
 	}
+	sm.peerNotifier.RelayInventory(iv, block.MsgBlock().Header)
+}
 
-	// Remove the peer from the list of candidate peers.
-	delete(sm.peerStates, peer)
-
-	log.Infof("Lost peer %s", peer)
+// delayTipRelay schedules the relay of the passed block, which advanced the
+// main chain tip, once the tip relay delay has passed.  Any tip already waiting
+// to be relayed is replaced and the wait restarts, though never past the
+// maximum delay from when the first of the coalesced tips was accepted.
+func (sm *SyncManager) delayTipRelay(block *btcutil.Block) {
+	now := time.Now()
+	if sm.pendingTip == nil {
+		sm.tipRelayDeadline = now.Add(sm.maxTipRelayDelay)
+	} else {
+		log.Tracef("Coalescing relay of tip %v into tip %v",
+			sm.pendingTip.Hash(), block.Hash())
+	}
+	sm.pendingTip = block
 
-	sm.clearRequestedState(state)
+	wait := sm.tipRelayDelay
+	if due := now.Add(wait); due.After(sm.tipRelayDeadline) {
+		wait = sm.tipRelayDeadline.Sub(now)
+	}
+	if sm.tipRelayTimer != nil {
+		sm.tipRelayTimer.Stop()
+	}
+	sm.tipRelayTimer = time.NewTimer(wait)
+}
 
-	if peer == sm.syncPeer {
-		// Update the sync peer. The server has already disconnected the
-		// peer before signaling to the sync manager.
-		sm.updateSyncPeer(false)
+// relayPendingTip relays the tip that was waiting for the tip relay delay to
+// pass.
+func (sm *SyncManager) relayPendingTip() {
+	block := sm.pendingTip
+	sm.pendingTip = nil
+	sm.tipRelayTimer = nil
+	if block != nil {
+		sm.relayBlock(block)
 	}
 }
 
-// clearRequestedState wipes all expected transactions and blocks from the sync
-// manager's requested maps that were requested under a peer's sync state, This
+// pendingTxRelay houses transactions accepted to the memory pool that are
+// waiting to be relayed to peers along with when they are due.
+type pendingTxRelay struct {
+	txns []*mempool.TxDesc
+	due  time.Time
+}
+
+// announceTxs announces the passed transactions, which were accepted to the
+// memory pool.  When the transaction relay delay is set, only the relay to
+// peers waits for it to pass while the other clients are notified right away.
+func (sm *SyncManager) announceTxs(txns []*mempool.TxDesc) {
+	if sm.txRelayDelay <= 0 {
+		sm.peerNotifier.AnnounceNewTransactions(txns)
+		return
+	}
+	if len(txns) == 0 {
+		return
+	}
+	sm.peerNotifier.NotifyNewTransactions(txns)
+	sm.delayTxRelay(txns)
+}
+
+// delayTxRelay schedules the relay of the passed transactions to peers once the
+// transaction relay delay has passed.  Since the transactions are announced to
+// each peer at most once, delaying the announcement gives the other peers that
+// received them at about the same time the chance to advertise them first so
+// they are not needlessly announced back to those peers.
+func (sm *SyncManager) delayTxRelay(txns []*mempool.TxDesc) {
+	sm.pendingTxRelays = append(sm.pendingTxRelays, pendingTxRelay{
+		txns: txns,
+		due:  time.Now().Add(sm.txRelayDelay),
+	})
+	if sm.txRelayTimer == nil {
+		sm.txRelayTimer = time.NewTimer(sm.txRelayDelay)
+	}
+}
+
+// relayPendingTxs relays the transactions that were waiting for the transaction
+// relay delay to pass to peers and schedules the relay of the transactions that
+// are not due yet.  Transactions that left the memory pool during the wait,
+// such as those evicted or mined, are not relayed.
+func (sm *SyncManager) relayPendingTxs() {
+	sm.txRelayTimer = nil
+
+	now := time.Now()
+	for len(sm.pendingTxRelays) > 0 {
+		pending := sm.pendingTxRelays[0]
+		if pending.due.After(now) {
+			sm.txRelayTimer = time.NewTimer(pending.due.Sub(now))
+			break
+		}
+		for _, txD := range pending.txns {
+			hash := txD.Tx.Hash()
+			if !sm.txMemPool.IsTransactionInPool(hash) {
+				log.Debugf("Not relaying transaction %v -- no "+
+					"longer in the memory pool", hash)
+				continue
+			}
+			iv := wire.NewInvVect(wire.InvTypeTx, hash)
+			sm.peerNotifier.RelayInventory(iv, txD)
+		}
+		sm.pendingTxRelays[0] = pendingTxRelay{}
+		sm.pendingTxRelays = sm.pendingTxRelays[1:]
+	}
+	if len(sm.pendingTxRelays) == 0 {
+		sm.pendingTxRelays = nil
+	}
+}
+
+// checkLoad pauses the processing of queued blocks when the system load exceeds
+// the maximum load and resumes it once the load drops.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) checkLoad() {
+	load := sm.loadSource.Load()
+	throttled := load > sm.maxLoad
+	if throttled == sm.loadThrottled {
+		return
+	}
+	sm.loadThrottled = throttled
+	if throttled {
+		log.Infof("Pausing block processing -- system load %.2f "+
+			"exceeds %.2f", load, sm.maxLoad)
+		return
+	}
+
+	// The sync peer is not at fault for the lack of progress while block
+	// processing was paused.
+	log.Infof("Resuming block processing -- system load %.2f", load)
+	sm.lastProgressTime = time.Now()
+}
+
+// handleStallSample will switch to a new sync peer if the current one has
+// stalled. This is detected when by comparing the last progress timestamp with
+// the current time, and disconnecting the peer if we stalled before reaching
+// their highest advertised block.
+func (sm *SyncManager) handleStallSample() {
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+
+	// The sync peer is not making progress because blocks are not being
+	// processed while throttled by load rather than because it stalled.
+	if sm.loadThrottled {
+		return
+	}
+
+	// If we don't have an active sync peer, try to choose one again since
+	// candidates that were behind may have caught up or run out of grace,
+	// and exit early.
+	if sm.syncPeer == nil {
+		if sm.syncCandidates.Len() > 0 {
+			sm.startSync()
+		}
+		return
+	}
+
+	// Stop waiting for the blocks in flight from the previous sync peer
+	// once they are overdue and switch to a markedly better candidate
+	// while syncing.
+	sm.expirePreviousSyncPeer()
+	for _, c := range sm.syncCandidates {
+		if sm.maybeSwitchSyncPeer(c.peer) {
+			return
+		}
+	}
+
+	// If the stall timeout has not elapsed, exit early.
+	if time.Since(sm.lastProgressTime) <= sm.maxStallDuration {
+		return
+	}
+
+	// Check to see that the peer's sync state exists.
+	state, exists := sm.peerStates[sm.syncPeer]
+	if !exists {
+		return
+	}
+
+	sm.clearRequestedState(state)
+
+	disconnectSyncPeer := sm.shouldDCStalledSyncPeer()
+	sm.updateSyncPeer(disconnectSyncPeer)
+}
+
+// shouldDCStalledSyncPeer determines whether or not we should disconnect a
+// stalled sync peer. If the peer has stalled and its reported height is greater
+// than our own best height, we will disconnect it. Otherwise, we will keep the
+// peer connected in case we are already at tip.
+func (sm *SyncManager) shouldDCStalledSyncPeer() bool {
+	lastBlock := sm.syncPeer.LastBlock()
+	startHeight := sm.syncPeer.StartingHeight()
+
+	var peerHeight int32
+	if lastBlock > startHeight {
+		peerHeight = lastBlock
+	} else {
+		peerHeight = startHeight
+	}
+
+	// If we've stalled out yet the sync peer reports having more blocks for
+	// us we will disconnect them. This allows us at tip to not disconnect
+	// peers when we are equal or they temporarily lag behind us.
+	best := sm.chain.BestSnapshot()
+	return peerHeight > best.Height
+}
+
+// handleDonePeerMsg deals with peers that have signalled they are done.  It
+// removes the peer as a candidate for syncing and in the case where it was
+// the current sync peer, attempts to select a new best peer to sync from.  It
+// is invoked from the syncHandler goroutine.
+func (sm *SyncManager) handleDonePeerMsg(peer *peerpkg.Peer) {
+	state, exists := sm.peerStates[peer]
+	if !exists {
+		log.Warnf("Received done peer message for unknown peer %s", peer)
+		return
+	}
+
+	// Remove the peer from the list of candidate peers.
+	delete(sm.peerStates, peer)
+	sm.untrackSyncCandidate(peer, state)
+	sm.netGroups[state.netGroup]--
+	if sm.netGroups[state.netGroup] <= 0 {
+		delete(sm.netGroups, state.netGroup)
+	}
+
+	log.Infof("Lost peer %s", peer)
+
+	if peer == sm.cancelledSyncPeer {
+		sm.cancelledSyncPeer = nil
+	}
+	if peer == sm.previousSyncPeer {
+		sm.previousSyncPeer = nil
+	}
+	sm.releaseOrphanRequest(peer)
+	delete(sm.cmpctBlocks, peer)
+	sm.clearRequestedState(state)
+	if peer == sm.assumeValidPeer {
+		sm.assumeValidPeer = nil
+		sm.resetAssumeValidHeaders()
+	}
+
+	if peer == sm.syncPeer {
+		// Update the sync peer. The server has already disconnected the
+		// peer before signaling to the sync manager.
+		sm.updateSyncPeer(false)
+
+		// The sync halts when no candidates remain to replace the sync
+		// peer.  Ask for more peers during the initial block download
+		// rather than waiting for a candidate to connect on its own.
+		if sm.syncPeer == nil && !sm.chain.IsCurrent() {
+			log.Warnf("Sync stalled at height %d -- no sync peer "+
+				"candidates available", sm.chain.BestSnapshot().Height)
+			if sm.requestPeers != nil {
+				sm.requestPeers()
+			}
+		}
+	}
+}
+
+// clearRequestedState wipes all expected transactions and blocks from the sync
+// manager's requested maps that were requested under a peer's sync state, This
 // allows them to be rerequested by a subsequent sync peer.
 func (sm *SyncManager) clearRequestedState(state *peerSyncState) {
 	// Remove requested transactions from the global map so that they will
@@ -530,13 +1586,72 @@ func (sm *SyncManager) clearRequestedState(state *peerSyncState) {
 		delete(sm.requestedTxns, txHash)
 	}
 
-	// Remove requested blocks from the global map so that they will be
-	// fetched from elsewhere next time we get an inv.
-	// TODO: we could possibly here check which peers have these blocks
-	// and request them now to speed things up a little.
+	// Request blocks from alternate peers that advertised them when
+	// possible.  Otherwise, remove them from the global map so that they
+	// will be fetched from elsewhere next time we get an inv.
 	for blockHash := range state.requestedBlocks {
-		delete(sm.requestedBlocks, blockHash)
+		sm.requestBlockFromAlternate(blockHash)
+	}
+}
+
+// addBlockAlternate records the passed peer as an alternate source for a block
+// that has already been requested from another peer so it can be requested
+// from the alternate should the original request fail.
+func (sm *SyncManager) addBlockAlternate(hash chainhash.Hash, peer *peerpkg.Peer) {
+	alternates, exists := sm.blockAlternates[hash]
+	if !exists && len(sm.blockAlternates) >= maxRequestedBlocks {
+		return
+	}
+	if len(alternates) >= maxBlockAlternates {
+		return
+	}
+	for _, alternate := range alternates {
+		if alternate == peer {
+			return
+		}
+	}
+	sm.blockAlternates[hash] = append(alternates, peer)
+}
+
+// requestBlockFromAlternate requests the passed block from the first connected
+// alternate peer that advertised it after the original request failed.  The
+// block is removed from the global requested map when there is no such peer
+// so it will be fetched from elsewhere next time we get an inv.
+func (sm *SyncManager) requestBlockFromAlternate(hash chainhash.Hash) {
+	alternates := sm.blockAlternates[hash]
+	for len(alternates) > 0 {
+		peer := alternates[0]
+		alternates = alternates[1:]
+
+		state, exists := sm.peerStates[peer]
+		if !exists {
+			continue
+		}
+
+		if len(alternates) > 0 {
+			sm.blockAlternates[hash] = alternates
+		} else {
+			delete(sm.blockAlternates, hash)
+		}
+		limitAdd(state.requestedBlocks, hash, maxRequestedBlocks)
+		sm.noteBlockRequest(hash)
+
+		iv := wire.NewInvVect(wire.InvTypeBlock, &hash)
+		if peer.IsWitnessEnabled() {
+			iv.Type = wire.InvTypeWitnessBlock
+		}
+		gdmsg := wire.NewMsgGetData()
+		gdmsg.AddInvVect(iv)
+		sm.queueGetData(peer, gdmsg)
+
+		log.Debugf("Requesting block %v from alternate peer %s", hash,
+			peer)
+		return
 	}
+
+	delete(sm.blockAlternates, hash)
+	delete(sm.requestedBlocks, hash)
+	delete(sm.blockRequestTimes, hash)
 }
 
 // updateSyncPeer choose a new sync peer to replace the current one. If
@@ -562,6 +1677,73 @@ func (sm *SyncManager) updateSyncPeer(dcSyncPeer bool) {
 	sm.startSync()
 }
 
+// cancelSync stops syncing from the current sync peer, if any, and prevents a
+// new sync peer from being chosen until resumeSync is called.  The sync
+// candidates are left intact.  Blocks already requested are still accepted
+// when they arrive, while further headers and block inventory from the
+// cancelled sync peer are no longer expected.
+func (sm *SyncManager) cancelSync() {
+	if sm.syncCancelled {
+		return
+	}
+	sm.syncCancelled = true
+
+	if sm.syncPeer == nil {
+		log.Infof("Sync cancelled")
+		return
+	}
+	log.Infof("Sync from peer %s cancelled", sm.syncPeer)
+
+	if sm.headersFirstMode {
+		best := sm.chain.BestSnapshot()
+		sm.resetHeaderState(&best.Hash, best.Height)
+	}
+	sm.cancelledSyncPeer = sm.syncPeer
+	sm.syncPeer = nil
+}
+
+// resumeSync allows a sync peer to be chosen again after syncing was cancelled
+// and starts syncing from the best sync candidate.  It is a no-op when syncing
+// is not cancelled.
+func (sm *SyncManager) resumeSync() {
+	if !sm.syncCancelled {
+		return
+	}
+	sm.syncCancelled = false
+	sm.cancelledSyncPeer = nil
+
+	log.Infof("Sync resumed")
+	sm.startSync()
+}
+
+// setVerify enables or disables the verification of the scripts of the blocks
+// received from peers.
+func (sm *SyncManager) setVerify(verify bool) {
+	if sm.disableVerify == !verify {
+		return
+	}
+	if !verify && !sm.allowNoVerify() {
+		log.Warnf("Script verification of received blocks cannot be "+
+			"disabled on %s", sm.chainParams.Name)
+		return
+	}
+	sm.disableVerify = !verify
+	if verify {
+		log.Infof("Script verification of received blocks enabled")
+	} else {
+		log.Infof("Script verification of received blocks disabled")
+	}
+}
+
+// allowNoVerify returns whether script verification of received blocks may be
+// disabled on the network of the sync manager.  It is only allowed on local
+// test networks, since blocks whose scripts were skipped could otherwise
+// become the tip of a public chain.
+func (sm *SyncManager) allowNoVerify() bool {
+	return sm.chainParams.Net == wire.TestNet ||
+		sm.chainParams.Net == wire.SimNet
+}
+
 // handleTxMsg handles transaction messages from all peers.
 func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 	peer := tmsg.peer
@@ -580,6 +1762,7 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 	// to disconnect peers for sending unsolicited transactions to provide
 	// interoperability.
 	txHash := tmsg.tx.Hash()
+	sm.observeLatency(sm.txLatency, txHash)
 
 	// Ignore transactions that we have already rejected.  Do not
 	// send a reject message here because if the transaction was already
@@ -612,8 +1795,7 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 		// so log it as such.  Otherwise, something really did go wrong,
 		// so log it as an actual error.
 		if _, ok := err.(mempool.RuleError); ok {
-			log.Debugf("Rejected transaction %v from %s: %v",
-				txHash, peer, err)
+			sm.txRejectLogger.logReject(txHash, peer, err)
 		} else {
 			log.Errorf("Failed to process transaction %v: %v",
 				txHash, err)
@@ -626,7 +1808,8 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 		return
 	}
 
-	sm.peerNotifier.AnnounceNewTransactions(acceptedTxs)
+	sm.txFeed.notify(acceptedTxs)
+	sm.announceTxs(acceptedTxs)
 }
 
 // current returns true if we believe we are synced with our peers, false if we
@@ -650,31 +1833,218 @@ func (sm *SyncManager) current() bool {
 	return true
 }
 
-// handleBlockMsg handles block messages from all peers.
+// downloadProgressEstimate returns the percentage of the chain that has been
+// downloaded.  The height of the sync peer is used as the target when there is
+// one and the height of the latest checkpoint is used otherwise, so progress
+// can be estimated before a sync peer is chosen.  One hundred is returned when
+// the best chain has reached the target or there is no target since no blocks
+// are known to be missing then.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) downloadProgressEstimate() float64 {
+	var target int32
+	if sm.syncPeer != nil {
+		target = sm.syncPeer.LastBlock()
+	}
+	if target <= 0 {
+		if checkpoint := sm.chain.LatestCheckpoint(); checkpoint != nil {
+			target = checkpoint.Height
+		}
+	}
+
+	height := sm.chain.BestSnapshot().Height
+	if target <= 0 || height >= target {
+		return 100
+	}
+	return float64(height) / float64(target) * 100
+}
+
+// observeLatency records the time elapsed since the inventory for the passed
+// hash was first announced into the provided histogram.  Nothing is recorded
+// for data that was never announced, such as unsolicited transactions.
+func (sm *SyncManager) observeLatency(h *latencyHistogram, hash *chainhash.Hash) {
+	firstSeen, exists := sm.invFirstSeen[*hash]
+	if !exists {
+		return
+	}
+	delete(sm.invFirstSeen, *hash)
+	h.observe(time.Since(firstSeen))
+}
+
+// addRecentBlock records the passed block hash as processed from the peer,
+// evicting a random entry when the maximum number of recent blocks is reached.
+func (sm *SyncManager) addRecentBlock(hash chainhash.Hash, peer *peerpkg.Peer) {
+	_, exists := sm.recentBlocks[hash]
+	if !exists && len(sm.recentBlocks) >= maxRecentBlocks {
+		for h := range sm.recentBlocks {
+			delete(sm.recentBlocks, h)
+			break
+		}
+	}
+	sm.recentBlocks[hash] = peer
+}
+
+// extendsBestChain returns whether the passed block is a new block that builds
+// directly on the current best chain tip.
+func (sm *SyncManager) extendsBestChain(block *btcutil.Block) bool {
+	best := sm.chain.BestSnapshot()
+	return block.MsgBlock().Header.PrevBlock == best.Hash
+}
+
+// handleUnrequestedBlock penalizes the passed peer for sending a block that was
+// not requested from it and that does not extend the best chain.  The block is
+// ignored.
+func (sm *SyncManager) handleUnrequestedBlock(peer *peerpkg.Peer,
+	blockHash *chainhash.Hash) {
+
+	if sm.addBanScore == nil {
+		log.Warnf("Got unrequested block %v from %s -- "+
+			"disconnecting", blockHash, peer.Addr())
+		peer.Disconnect()
+		return
+	}
+
+	log.Debugf("Ignoring unrequested block %v from %s", blockHash, peer)
+	reason := fmt.Sprintf("unrequested block %v", blockHash)
+	sm.addBanScore(peer, 0, unrequestedBlockBanScore, reason)
+}
+
+// meetsMinWork returns whether the proof of work of the passed block meets the
+// difficulty expected at its height, which is known whenever its parent is.
+// Blocks whose parent is unknown only need to meet the proof of work limit of
+// the network.  It's a cheap check that allows trivially weak blocks to be
+// rejected before they are validated.
+func (sm *SyncManager) meetsMinWork(block *btcutil.Block) bool {
+	target := sm.chainParams.PowLimit
+	header := &block.MsgBlock().Header
+	haveParent, err := sm.chain.HaveBlock(&header.PrevBlock)
+	if err == nil && haveParent && !sm.chain.IsKnownOrphan(&header.PrevBlock) {
+		bits, err := sm.chain.CalcRequiredDifficulty(&header.PrevBlock,
+			header.Timestamp)
+		if err != nil {
+			log.Errorf("Unable to calculate the difficulty of block "+
+				"%v: %v", block.Hash(), err)
+		} else {
+			target = blockchain.CompactToBig(bits)
+		}
+	}
+	return blockchain.HashToBig(block.Hash()).Cmp(target) <= 0
+}
+
+// handleLowWorkBlock penalizes the passed peer for sending a block whose proof
+// of work does not meet the difficulty expected at its height.  The block is
+// ignored.
+func (sm *SyncManager) handleLowWorkBlock(peer *peerpkg.Peer,
+	blockHash *chainhash.Hash) {
+
+	if sm.addBanScore == nil {
+		log.Warnf("Got block %v with insufficient proof of work from "+
+			"%s -- disconnecting", blockHash, peer.Addr())
+		peer.Disconnect()
+		return
+	}
+
+	log.Debugf("Ignoring block %v with insufficient proof of work from %s",
+		blockHash, peer)
+	reason := fmt.Sprintf("block %v with insufficient proof of work",
+		blockHash)
+	sm.addBanScore(peer, 0, lowWorkBlockBanScore, reason)
+}
+
+// handleBlockMsg handles block messages from all peers.  Blocks requested with
+// pipelined getdata messages are processed in the order they were requested.
 func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
+	state, exists := sm.peerStates[bmsg.peer]
+	if exists && holdPipelinedBlock(state, bmsg) {
+		log.Debugf("Holding block %v from %s until the blocks requested "+
+			"before it arrive", bmsg.block.Hash(), bmsg.peer)
+		return
+	}
+	sm.processBlockMsg(bmsg)
+	if !exists {
+		return
+	}
+	sm.advancePipeline(bmsg.peer, state)
+}
+
+// processBlockMsg processes a block received from a peer, which
+// handleBlockMsg passes on in the order the blocks were requested.
+func (sm *SyncManager) processBlockMsg(bmsg *blockMsg) {
 	peer := bmsg.peer
 	state, exists := sm.peerStates[peer]
 	if !exists {
 		log.Warnf("Received block message from unknown peer %s", peer)
 		return
 	}
+	state.msgStats.blocksDelivered++
+	sm.releaseOrphanRequest(peer)
 
-	// If we didn't ask for this block then the peer is misbehaving.
+	// If we didn't ask for this block then the peer is misbehaving unless
+	// it is relaying a new block that extends the best chain.
 	blockHash := bmsg.block.Hash()
 	if _, exists = state.requestedBlocks[*blockHash]; !exists {
 		// The regression test intentionally sends some blocks twice
-		// to test duplicate block insertion fails.  Don't disconnect
+		// to test duplicate block insertion fails.  Don't penalize
 		// the peer or ignore the block when we're in regression test
 		// mode in this case so the chain code is actually fed the
 		// duplicate blocks.
-		if sm.chainParams != &chaincfg.RegressionNetParams {
-			log.Warnf("Got unrequested block %v from %s -- "+
-				"disconnecting", blockHash, peer.Addr())
-			peer.Disconnect()
+		if sm.chainParams != &chaincfg.RegressionNetParams &&
+			!sm.extendsBestChain(bmsg.block) {
+
+			sm.handleUnrequestedBlock(peer, blockHash)
 			return
 		}
 	}
 
+	// Keep blocks downloaded again to replace unreadable stored copies
+	// aside since the chain already has them.
+	if sm.repairCorruptBlock(peer, state, bmsg.block) {
+		return
+	}
+
+	// Reject blocks whose proof of work falls short of the minimum
+	// difficulty before spending any time validating them.
+	if !sm.meetsMinWork(bmsg.block) {
+		delete(state.requestedBlocks, *blockHash)
+		delete(sm.requestedBlocks, *blockHash)
+		delete(sm.blockRequestTimes, *blockHash)
+		sm.handleLowWorkBlock(peer, blockHash)
+		return
+	}
+
+	// Drop orphans from peers that already sent as many as they may within
+	// the orphan window so a flood of orphans can't induce a flood of
+	// resolution requests.
+	if sm.isOrphanBlock(bmsg.block) && !sm.allowPeerOrphan(state) {
+		delete(state.requestedBlocks, *blockHash)
+		delete(sm.requestedBlocks, *blockHash)
+		delete(sm.blockRequestTimes, *blockHash)
+		sm.handleThrottledOrphan(peer, blockHash)
+		return
+	}
+
+	// Ignore the block when another peer delivered it moments ago since
+	// processing it again would only waste time.  Repeat deliveries from
+	// the same peer are still processed so the regression test can verify
+	// duplicate blocks are rejected.
+	if source, exists := sm.recentBlocks[*blockHash]; exists && source != peer {
+		log.Debugf("Ignoring block %v from %s -- already processed "+
+			"from %s", blockHash, peer, source)
+		delete(state.requestedBlocks, *blockHash)
+		return
+	}
+
+	// Hold bodies fetched on demand until the blocks before them have been
+	// processed.
+	if sm.holdPendingBody(bmsg.block) {
+		log.Debugf("Holding body of block %v until its parent is "+
+			"processed", blockHash)
+		delete(state.requestedBlocks, *blockHash)
+		delete(sm.requestedBlocks, *blockHash)
+		delete(sm.blockRequestTimes, *blockHash)
+		return
+	}
+
 	// When in headers-first mode, if the block matches the hash of the
 	// first header in the list of headers that are being fetched, it's
 	// eligible for less validation since the headers have already been
@@ -699,15 +2069,34 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 	}
 
+	// Skip script validation for the ancestors of the assumed valid block
+	// or for all blocks when verification is disabled.
+	behaviorFlags |= sm.assumedValidFlags(peer, bmsg.block)
+	if sm.disableVerify {
+		behaviorFlags |= blockchain.BFNoScriptCheck
+	}
+
 	// Remove block from request maps. Either chain will know about it and
 	// so we shouldn't have any more instances of trying to fetch it, or we
 	// will fail the insert and thus we'll retry next time we get an inv.
+	// The delivery time is measured for blocks requested from the peer.
+	requested, ok := sm.blockRequestTimes[*blockHash]
+	if _, asked := state.requestedBlocks[*blockHash]; asked && ok {
+		noteBlockDelivery(state, time.Since(requested))
+	}
 	delete(state.requestedBlocks, *blockHash)
 	delete(sm.requestedBlocks, *blockHash)
+	delete(sm.blockAlternates, *blockHash)
+	delete(sm.blockRequestTimes, *blockHash)
+	sm.observeLatency(sm.blockLatency, blockHash)
 
 	// Process the block to include validation, best chain selection, orphan
-	// handling, etc.
+	// handling, etc.  Blocks whose scripts are not executed are not relayed.
+	if behaviorFlags&blockchain.BFNoScriptCheck != 0 {
+		sm.unverifiedBlock = blockHash
+	}
 	_, isOrphan, err := sm.chain.ProcessBlock(bmsg.block, behaviorFlags)
+	sm.unverifiedBlock = nil
 	if err != nil {
 		// When the error is a rule error, it means the block was simply
 		// rejected as opposed to something actually going wrong, so log
@@ -732,6 +2121,11 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		return
 	}
 
+	// Only remember blocks that were processed successfully.  Otherwise a
+	// peer sending a mutated copy of a block with a valid header would get
+	// the genuine block from every other peer ignored.
+	sm.addRecentBlock(*blockHash, peer)
+
 	// Meta-data about the new block this peer is reporting. We use this
 	// below to update this peer's latest block height and the heights of
 	// other peers based on their last announced block hash. This allows us
@@ -766,14 +2160,16 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 			}
 		}
 
-		orphanRoot := sm.chain.GetOrphanRoot(blockHash)
-		locator, err := sm.chain.LatestBlockLocator()
-		if err != nil {
-			log.Warnf("Failed to get block locator for the "+
-				"latest block: %v", err)
-		} else {
-			peer.PushGetBlocksMsg(locator, orphanRoot)
+		// Keep the orphan on disk so it survives a restart.  It is
+		// removed once accepted.
+		if sm.orphanStore != nil {
+			if err := sm.orphanStore.Put(bmsg.block); err != nil {
+				log.Errorf("Unable to store orphan block %v: %v",
+					blockHash, err)
+			}
 		}
+
+		sm.resolveOrphan(peer, blockHash, heightUpdate)
 	} else {
 		if peer == sm.syncPeer {
 			sm.lastProgressTime = time.Now()
@@ -785,6 +2181,7 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 
 		// Update this peer's latest block height, for future
 		// potential sync node candidacy.
+		sm.noteVerifiedHeight(peer, bmsg.block.Height())
 		best := sm.chain.BestSnapshot()
 		heightUpdate = best.Height
 		blkHashUpdate = &best.Hash
@@ -805,6 +2202,17 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 	}
 
+	// Request the next batch of blocks from the sync peer once the last
+	// block of a full batch it announced is received rather than
+	// relying on the peer to announce its tip, which would only be
+	// processed as an orphan.
+	if !sm.headersFirstMode && sm.getBlocksContinue != nil &&
+		*blockHash == *sm.getBlocksContinue && peer == sm.syncPeer {
+
+		sm.getBlocksContinue = nil
+		sm.requestNextBlocks(peer)
+	}
+
 	// Nothing more to do if we aren't in headers-first mode.
 	if !sm.headersFirstMode {
 		return
@@ -814,8 +2222,13 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 	// request more blocks using the header list when the request queue is
 	// getting short.
 	if !isCheckpointBlock {
+		// Process the next block right away when its body was already
+		// fetched on demand.
+		if sm.processPendingBody(peer) {
+			return
+		}
 		if sm.startHeader != nil &&
-			len(state.requestedBlocks) < minInFlightBlocks {
+			len(state.requestedBlocks) < sm.refillThreshold() {
 			sm.fetchHeaderBlocks()
 		}
 		return
@@ -849,12 +2262,13 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 	sm.headerList.Init()
 	log.Infof("Reached the final checkpoint -- switching to normal mode")
 	locator := blockchain.BlockLocator([]*chainhash.Hash{blockHash})
-	err = peer.PushGetBlocksMsg(locator, &zeroHash)
+	err = sm.pushGetBlocks(peer, locator)
 	if err != nil {
 		log.Warnf("Failed to send getblocks message to peer %s: %v",
 			peer.Addr(), err)
 		return
 	}
+	sm.requestAssumeValidHeaders(peer)
 }
 
 // fetchHeaderBlocks creates and sends a request to the syncPeer for the next
@@ -871,15 +2285,32 @@ func (sm *SyncManager) fetchHeaderBlocks() {
 	// the function, so no need to double check it here.
 	gdmsg := wire.NewMsgGetDataSizeHint(uint(sm.headerList.Len()))
 	numRequested := 0
-	for e := sm.startHeader; e != nil; e = e.Next() {
+	maxRequested := sm.blockDownloadWindow -
+		len(sm.peerStates[sm.syncPeer].requestedBlocks)
+	if maxRequested > wire.MaxInvPerMsg {
+		maxRequested = wire.MaxInvPerMsg
+	}
+	for e := sm.startHeader; e != nil && numRequested < maxRequested; e = e.Next() {
 		node, ok := e.Value.(*headerNode)
 		if !ok {
 			log.Warn("Header list node type is not a headerNode")
 			continue
 		}
 
-		iv := wire.NewInvVect(wire.InvTypeBlock, node.hash)
-		haveInv, err := sm.haveInventory(iv)
+		// Skip blocks whose bodies were already fetched on demand.
+		if sm.haveBodyRequest(node.hash) {
+			sm.startHeader = e.Next()
+			continue
+		}
+
+		// Skip blocks still in flight from the previous sync peer.
+		if sm.inFlightFromPreviousSyncPeer(node.hash) {
+			sm.startHeader = e.Next()
+			continue
+		}
+
+		iv := wire.NewInvVect(wire.InvTypeBlock, node.hash)
+		haveInv, err := sm.haveInventory(iv)
 		if err != nil {
 			log.Warnf("Unexpected failure when checking for "+
 				"existing inventory during header block "+
@@ -890,6 +2321,7 @@ func (sm *SyncManager) fetchHeaderBlocks() {
 
 			sm.requestedBlocks[*node.hash] = struct{}{}
 			syncPeerState.requestedBlocks[*node.hash] = struct{}{}
+			sm.noteBlockRequest(*node.hash)
 
 			// If we're fetching from a witness enabled peer
 			// post-fork, then ensure that we receive all the
@@ -902,29 +2334,60 @@ func (sm *SyncManager) fetchHeaderBlocks() {
 			numRequested++
 		}
 		sm.startHeader = e.Next()
-		if numRequested >= wire.MaxInvPerMsg {
-			break
-		}
 	}
 	if len(gdmsg.InvList) > 0 {
-		sm.syncPeer.QueueMessage(gdmsg, nil)
+		sm.queueGetData(sm.syncPeer, gdmsg)
 	}
 }
 
+// refillThreshold returns the number of blocks in flight from the sync peer
+// below which more blocks are requested in headers-first mode.
+func (sm *SyncManager) refillThreshold() int {
+	threshold := minInFlightBlocks
+	if threshold > sm.blockDownloadWindow/2 {
+		threshold = sm.blockDownloadWindow / 2
+	}
+	if threshold < 1 {
+		threshold = 1
+	}
+	return threshold
+}
+
 // handleHeadersMsg handles block header messages from all peers.  Headers are
 // requested when performing a headers-first sync.
 func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 	peer := hmsg.peer
-	_, exists := sm.peerStates[peer]
+	state, exists := sm.peerStates[peer]
 	if !exists {
 		log.Warnf("Received headers message from unknown peer %s", peer)
 		return
 	}
+	sm.releaseOrphanRequest(peer)
+
+	// Headers from a peer proving its chain matches the checkpoint quorum
+	// are handled separately.
+	if len(state.pendingCheckpoints) > 0 {
+		sm.handleCheckpointHeaders(peer, state, hmsg.headers.Headers)
+		return
+	}
+
+	// Headers leading to the assumed valid block are handled separately.
+	if peer == sm.assumeValidPeer {
+		sm.handleAssumeValidHeaders(peer, hmsg.headers.Headers)
+		return
+	}
 
 	// The remote peer is misbehaving if we didn't request headers.
 	msg := hmsg.headers
 	numHeaders := len(msg.Headers)
 	if !sm.headersFirstMode {
+		// Headers requested before syncing was cancelled are
+		// expected.
+		if peer == sm.cancelledSyncPeer {
+			log.Debugf("Ignoring %d headers from %s -- sync "+
+				"cancelled", numHeaders, peer)
+			return
+		}
 		log.Warnf("Got %d unrequested headers from %s -- "+
 			"disconnecting", numHeaders, peer.Addr())
 		peer.Disconnect()
@@ -940,6 +2403,7 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 	// previous and that checkpoints match.
 	receivedCheckpoint := false
 	var finalHash *chainhash.Hash
+	var finalHeight int32
 	for _, blockHeader := range msg.Headers {
 		blockHash := blockHeader.BlockHash()
 		finalHash = &blockHash
@@ -959,6 +2423,7 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 		prevNode := prevNodeEl.Value.(*headerNode)
 		if prevNode.hash.IsEqual(&blockHeader.PrevBlock) {
 			node.height = prevNode.height + 1
+			finalHeight = node.height
 			e := sm.headerList.PushBack(&node)
 			if sm.startHeader == nil {
 				sm.startHeader = e
@@ -992,6 +2457,10 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 		}
 	}
 
+	// The headers link to the checkpointed chain, so the peer has proven
+	// to have the chain up to the final one.
+	sm.noteVerifiedHeight(peer, finalHeight)
+
 	// When this header is a checkpoint, switch to fetching the blocks for
 	// all of the headers since the last checkpoint.
 	if receivedCheckpoint {
@@ -1027,6 +2496,7 @@ func (sm *SyncManager) handleNotFoundMsg(nfmsg *notFoundMsg) {
 		log.Warnf("Received notfound message from unknown peer %s", peer)
 		return
 	}
+	sm.releaseOrphanRequest(peer)
 	for _, inv := range nfmsg.notFound.InvList {
 		// verify the hash was actually announced by the peer
 		// before deleting from the global requested maps.
@@ -1036,7 +2506,7 @@ func (sm *SyncManager) handleNotFoundMsg(nfmsg *notFoundMsg) {
 		case wire.InvTypeBlock:
 			if _, exists := state.requestedBlocks[inv.Hash]; exists {
 				delete(state.requestedBlocks, inv.Hash)
-				delete(sm.requestedBlocks, inv.Hash)
+				sm.requestBlockFromAlternate(inv.Hash)
 			}
 
 		case wire.InvTypeWitnessTx:
@@ -1048,6 +2518,10 @@ func (sm *SyncManager) handleNotFoundMsg(nfmsg *notFoundMsg) {
 			}
 		}
 	}
+
+	// Blocks the peer did not find no longer hold up those requested
+	// after them.
+	sm.advancePipeline(peer, state)
 }
 
 // haveInventory returns whether or not the inventory represented by the passed
@@ -1110,18 +2584,36 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 		log.Warnf("Received inv message from unknown peer %s", peer)
 		return
 	}
+	state.msgStats.invItems += uint64(len(imsg.inv.InvList))
 
 	// Attempt to find the final block in the inventory list.  There may
 	// not be one.
 	lastBlock := -1
+	numBlocks := 0
 	invVects := imsg.inv.InvList
 	for i := len(invVects) - 1; i >= 0; i-- {
 		if invVects[i].Type == wire.InvTypeBlock {
-			lastBlock = i
-			break
+			if lastBlock == -1 {
+				lastBlock = i
+			}
+			numBlocks++
 		}
 	}
 
+	// A full batch of blocks from the sync peer means it has more blocks
+	// after the batch, so remember the last one to request the next batch
+	// once it is received.
+	if numBlocks >= wire.MaxBlocksPerMsg && peer == sm.syncPeer &&
+		!sm.headersFirstMode {
+
+		hash := invVects[lastBlock].Hash
+		sm.getBlocksContinue = &hash
+	}
+
+	// Any response from the peer answers the orphan resolution request
+	// outstanding with it.
+	sm.releaseOrphanRequest(peer)
+
 	// If this inv contains a block announcement, and this isn't coming from
 	// our current sync peer or we're current, then update the last
 	// announced block for this peer. We'll use this information later to
@@ -1143,6 +2635,7 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 		blkHeight, err := sm.chain.BlockHeightByHash(&invVects[lastBlock].Hash)
 		if err == nil {
 			peer.UpdateLastBlockHeight(blkHeight)
+			sm.noteVerifiedHeight(peer, blkHeight)
 		}
 	}
 
@@ -1151,13 +2644,23 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 	// Finally, attempt to detect potential stalls due to long side chains
 	// we already have and request more blocks to prevent them.
 	for i, iv := range invVects {
-		// Ignore unsupported inventory types.
+		// Hand inventory types which are not natively supported off to
+		// a registered handler, if any, and ignore them otherwise.
 		switch iv.Type {
 		case wire.InvTypeBlock:
 		case wire.InvTypeTx:
 		case wire.InvTypeWitnessBlock:
 		case wire.InvTypeWitnessTx:
 		default:
+			handler, ok := sm.invHandlers[iv.Type]
+			if !ok {
+				log.Debugf("Ignoring unsupported inventory "+
+					"type %v from %s", iv.Type, peer)
+				continue
+			}
+
+			peer.AddKnownInventory(iv)
+			handler(peer, iv)
 			continue
 		}
 
@@ -1195,6 +2698,12 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 				continue
 			}
 
+			// Remember when the inventory was first announced so
+			// its propagation latency can be measured once it
+			// arrives.
+			limitAddTime(sm.invFirstSeen, iv.Hash, time.Now(),
+				maxInvFirstSeen)
+
 			// Add it to the request queue.
 			state.requestQueue = append(state.requestQueue, iv)
 			continue
@@ -1212,18 +2721,10 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 			// to signal there are more missing blocks that need to
 			// be requested.
 			if sm.chain.IsKnownOrphan(&iv.Hash) {
-				// Request blocks starting at the latest known
-				// up to the root of the orphan that just came
-				// in.
-				orphanRoot := sm.chain.GetOrphanRoot(&iv.Hash)
-				locator, err := sm.chain.LatestBlockLocator()
-				if err != nil {
-					log.Errorf("PEER: Failed to get block "+
-						"locator for the latest block: "+
-						"%v", err)
-					continue
-				}
-				peer.PushGetBlocksMsg(locator, orphanRoot)
+				// Request the missing ancestors of the orphan
+				// using the height it claimed when it came in.
+				sm.resolveOrphan(peer, &iv.Hash,
+					sm.orphanHeights[iv.Hash])
 				continue
 			}
 
@@ -1241,10 +2742,23 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 		}
 	}
 
+	sm.requestQueuedInv(peer, state)
+}
+
+// requestQueuedInv requests the inventory in the request queue of the passed
+// peer.  Blocks are requested with pipelined getdata messages of at most
+// getDataBatchSize blocks when pipelining requests, with blocks that don't fit
+// in the pipeline left queued until earlier messages have been answered.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) requestQueuedInv(peer *peerpkg.Peer,
+	state *peerSyncState) {
+
 	// Request as much as possible at once.  Anything that won't fit into
 	// the request will be requested on the next inv message.
 	numRequested := 0
 	gdmsg := wire.NewMsgGetData()
+	var batch, deferred []*wire.InvVect
 	requestQueue := state.requestQueue
 	for len(requestQueue) != 0 {
 		iv := requestQueue[0]
@@ -1256,17 +2770,49 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 			fallthrough
 		case wire.InvTypeBlock:
 			// Request the block if there is not already a pending
-			// request.
-			if _, exists := sm.requestedBlocks[iv.Hash]; !exists {
+			// request.  Otherwise, remember this peer as an
+			// alternate source should the pending request fail.
+			if _, exists := sm.requestedBlocks[iv.Hash]; exists {
+				if _, ours := state.requestedBlocks[iv.Hash]; !ours {
+					sm.addBlockAlternate(iv.Hash, peer)
+				}
+			} else {
+				// Blocks requested as compact blocks are not
+				// pipelined since they are not delivered as
+				// full blocks.  Leave the block queued when
+				// the pipeline is full.
+				compact := sm.current() && peer.SupportsCmpctBlocks()
+				pipelined := sm.getDataPipeline > 0 && !compact
+				if pipelined && len(state.pipeline) >= sm.getDataPipeline {
+					deferred = append(deferred, iv)
+					break
+				}
+
 				limitAdd(sm.requestedBlocks, iv.Hash, maxRequestedBlocks)
 				limitAdd(state.requestedBlocks, iv.Hash, maxRequestedBlocks)
-
-				if peer.IsWitnessEnabled() {
+				sm.noteBlockRequest(iv.Hash)
+
+				// Request new blocks as compact blocks from peers
+				// that support them once the chain is current,
+				// since their transactions are then likely in
+				// the memory pool already.
+				switch {
+				case compact:
+					iv.Type = wire.InvTypeCmpctBlock
+				case peer.IsWitnessEnabled():
 					iv.Type = wire.InvTypeWitnessBlock
 				}
 
-				gdmsg.AddInvVect(iv)
-				numRequested++
+				if !pipelined {
+					gdmsg.AddInvVect(iv)
+					numRequested++
+					break
+				}
+				batch = append(batch, iv)
+				if len(batch) == getDataBatchSize {
+					sm.pushPipelinedGetData(peer, state, batch)
+					batch = nil
+				}
 			}
 
 		case wire.InvTypeWitnessTx:
@@ -1293,9 +2839,12 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 			break
 		}
 	}
-	state.requestQueue = requestQueue
+	state.requestQueue = append(deferred, requestQueue...)
+	if len(batch) > 0 {
+		sm.pushPipelinedGetData(peer, state, batch)
+	}
 	if len(gdmsg.InvList) > 0 {
-		peer.QueueMessage(gdmsg, nil)
+		sm.queueGetData(peer, gdmsg)
 	}
 }
 
@@ -1305,14 +2854,75 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 // single thread without needing to lock memory data structures.  This is
 // important because the sync manager controls which blocks are needed and how
 // the fetching should proceed.
+//
+// Block and pause messages are queued separately and handled ahead of the
+// other messages, so a flood of inventory announcements does not delay block
+// processing.  Another message is given the chance to be handled after each
+// burst of blocks so the other messages are not starved by blocks either.
 func (sm *SyncManager) blockHandler() {
-	stallTicker := time.NewTicker(stallSampleInterval)
+	stallTicker := time.NewTicker(sm.stallSampleInterval)
 	defer stallTicker.Stop()
 
+	summaryTicker := time.NewTicker(sm.summaryInterval)
+	defer summaryTicker.Stop()
+
+	// Wake up periodically even when there is nothing to do so the
+	// watchdog does not mistake an idle handler for a stuck one.
+	beatTicker := time.NewTicker(sm.watchdogInterval())
+	defer beatTicker.Stop()
+
+	// Check the system load periodically when throttling by load.
+	var loadCheck <-chan time.Time
+	if sm.loadSource != nil {
+		sm.checkLoad()
+		loadTicker := time.NewTicker(sm.loadCheckInterval)
+		defer loadTicker.Stop()
+		loadCheck = loadTicker.C
+	}
+
+	// Reconsider the orphans stored before a restart now that the chain
+	// may have their parents.
+	sm.reconsiderStoredOrphans()
+
+	var blockBurst int
 out:
 	for {
+		sm.blockHandlerBeat.beat()
+		sm.updateBackpressure()
+
+		var tipRelay <-chan time.Time
+		if sm.tipRelayTimer != nil {
+			tipRelay = sm.tipRelayTimer.C
+		}
+		var txRelay <-chan time.Time
+		if sm.txRelayTimer != nil {
+			txRelay = sm.txRelayTimer.C
+		}
+
+		// Leave queued blocks in the queue while throttled by load.
+		priorityChan := sm.priorityChan
+		if sm.loadThrottled {
+			priorityChan = nil
+		}
+
+		if blockBurst < sm.maxBlockBurst {
+			select {
+			case m := <-priorityChan:
+				sm.handlePriorityMsg(m)
+				blockBurst++
+				continue
+			default:
+			}
+		}
+		blockBurst = 0
+
 		select {
+		case m := <-priorityChan:
+			sm.handlePriorityMsg(m)
+			blockBurst++
+
 		case m := <-sm.msgChan:
+			sm.noteMsgDequeued(m)
 			switch msg := m.(type) {
 			case *newPeerMsg:
 				sm.handleNewPeerMsg(msg.peer)
@@ -1321,10 +2931,6 @@ out:
 				sm.handleTxMsg(msg)
 				msg.reply <- struct{}{}
 
-			case *blockMsg:
-				sm.handleBlockMsg(msg)
-				msg.reply <- struct{}{}
-
 			case *invMsg:
 				sm.handleInvMsg(msg)
 
@@ -1344,6 +2950,28 @@ out:
 				}
 				msg.reply <- peerID
 
+			case getPendingStateMsg:
+				msg.reply <- sm.pendingState()
+
+			case getInFlightRequestsMsg:
+				msg.reply <- sm.inFlightRequests()
+
+			case getOrphanResolveRequestsMsg:
+				msg.reply <- sm.orphanResolveRequests()
+
+			case getDownloadProgressMsg:
+				msg.reply <- sm.downloadProgressEstimate()
+
+			case getMessageStatsMsg:
+				msg.reply <- sm.messageStats()
+
+			case getStateMsg:
+				state := SyncStateSyncing
+				if sm.current() {
+					state = SyncStateCurrent
+				}
+				msg.reply <- state
+
 			case processBlockMsg:
 				_, isOrphan, err := sm.chain.ProcessBlock(
 					msg.block, msg.flags)
@@ -1362,9 +2990,27 @@ out:
 			case isCurrentMsg:
 				msg.reply <- sm.current()
 
-			case pauseMsg:
-				// Wait until the sender unpauses the manager.
-				<-msg.unpause
+			case migrateDBMsg:
+				msg.reply <- sm.migrateDB(msg.db)
+
+			case cancelSyncMsg:
+				sm.cancelSync()
+				msg.reply <- struct{}{}
+
+			case resumeSyncMsg:
+				sm.resumeSync()
+				msg.reply <- struct{}{}
+
+			case setVerifyMsg:
+				sm.setVerify(msg.verify)
+				msg.reply <- struct{}{}
+
+			case fetchBlockBodyMsg:
+				block, err := sm.fetchBlockBody(msg.hash)
+				msg.reply <- fetchBlockBodyResponse{
+					block: block,
+					err:   err,
+				}
 
 			default:
 				log.Warnf("Invalid message type in block "+
@@ -1374,15 +3020,93 @@ out:
 		case <-stallTicker.C:
 			sm.handleStallSample()
 
+		case <-summaryTicker.C:
+			sm.logCandidateSummary()
+
+		case <-beatTicker.C:
+
+		case <-loadCheck:
+			sm.checkLoad()
+
+		case <-tipRelay:
+			sm.relayPendingTip()
+
+		case <-txRelay:
+			sm.relayPendingTxs()
+
 		case <-sm.quit:
 			break out
 		}
 	}
 
+	// Reply to any messages that were queued before shutdown so their
+	// senders are not left waiting.
+	sm.drainMsgs()
+	close(sm.done)
+
 	sm.wg.Done()
 	log.Trace("Block handler done")
 }
 
+// shouldRelayBlock returns whether the passed block that was accepted to the
+// chain should be relayed to peers.  Orphans are never relayed.  Blocks that
+// advance the main chain tip are always relayed, while side chain blocks are
+// only relayed when the chain retains them and relaying is not limited to the
+// main chain.
+func (sm *SyncManager) shouldRelayBlock(block *btcutil.Block) bool {
+	hash := block.Hash()
+	if sm.chain.IsKnownOrphan(hash) {
+		log.Warnf("Refusing to relay orphan block %v", hash)
+		return false
+	}
+	if sm.chain.BestSnapshot().Hash == *hash {
+		return true
+	}
+	if sm.relayMainChainOnly {
+		return false
+	}
+	_, retained := sm.chain.SideChainHeader(hash)
+	return retained
+}
+
+// replayDisconnectedTxs returns the transactions of the passed block, which was
+// disconnected from the main chain, to the transaction pool so they can be
+// mined again.  The transactions are subject to the usual checks, so those that
+// are no longer valid, such as spends of coinbases that are now immature, are
+// dropped along with any transactions in the pool that depend on them.
+//
+// During a reorganization the blocks of the old chain are disconnected before
+// those of the new chain are connected, so transactions returned to the pool
+// that conflict with the new chain are evicted once the block containing the
+// conflicting transaction is connected.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) replayDisconnectedTxs(block *btcutil.Block) {
+	txns := block.Transactions()[1:]
+	var replayed int
+	for _, tx := range txns {
+		missing, _, err := sm.txMemPool.MaybeAcceptTransaction(tx,
+			false, false)
+		if err != nil {
+			// Remove the transaction and all transactions that
+			// depend on it if it wasn't accepted into the
+			// transaction pool.
+			log.Debugf("Dropping transaction %v from disconnected "+
+				"block %v: %v", tx.Hash(), block.Hash(), err)
+			sm.txMemPool.RemoveTransaction(tx, true)
+			continue
+		}
+		if len(missing) == 0 {
+			replayed++
+		}
+	}
+	if len(txns) > 0 {
+		log.Debugf("Returned %d of %d transactions from disconnected "+
+			"block %v to the transaction pool", replayed, len(txns),
+			block.Hash())
+	}
+}
+
 // handleBlockchainNotification handles notifications from blockchain.  It does
 // things such as request orphan block parents and relay accepted blocks to
 // connected peers.
@@ -1391,21 +3115,59 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 	// A block has been accepted into the block chain.  Relay it to other
 	// peers.
 	case blockchain.NTBlockAccepted:
-		// Don't relay if we are not current. Other peers that are
-		// current should already know about it.
-		if !sm.current() {
-			return
-		}
-
 		block, ok := notification.Data.(*btcutil.Block)
 		if !ok {
 			log.Warnf("Chain accepted notification is not a block.")
 			break
 		}
 
-		// Generate the inventory vector and relay it.
-		iv := wire.NewInvVect(wire.InvTypeBlock, block.Hash())
-		sm.peerNotifier.RelayInventory(iv, block.MsgBlock().Header)
+		// Journal the accepted block so it can be detected as lost
+		// should the node crash before the database persists it.  This
+		// covers blocks accepted from any source, including orphans
+		// accepted once their parent is.
+		if sm.blockJournal != nil {
+			err := sm.blockJournal.Append(block.Hash(), block.Height())
+			if err != nil {
+				log.Errorf("Unable to journal block %v: %v",
+					block.Hash(), err)
+			}
+		}
+
+		// Forget the block if it was stored as an orphan since it is
+		// no longer one.
+		if sm.orphanStore != nil {
+			if err := sm.orphanStore.Remove(block.Hash()); err != nil {
+				log.Errorf("Unable to remove stored orphan %v: %v",
+					block.Hash(), err)
+			}
+		}
+
+		// Don't relay if we are not current unless configured to.
+		// Other peers that are current should already know about it.
+		if !sm.relayWhileSyncing && !sm.current() {
+			return
+		}
+
+		if !sm.shouldRelayBlock(block) {
+			break
+		}
+
+		// Don't vouch for blocks whose scripts were not verified.
+		if sm.unverifiedBlock != nil &&
+			sm.unverifiedBlock.IsEqual(block.Hash()) {
+
+			break
+		}
+
+		// Coalesce new tips accepted in quick succession when
+		// configured to.
+		if sm.tipRelayDelay > 0 &&
+			sm.chain.BestSnapshot().Hash == *block.Hash() {
+
+			sm.delayTipRelay(block)
+			break
+		}
+		sm.relayBlock(block)
 
 	// A block has been connected to the main block chain.
 	case blockchain.NTBlockConnected:
@@ -1415,6 +3177,23 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 			break
 		}
 
+		if sm.logAcceptedBlocks {
+			log.Debugf("Accepted block %v (height %d) to the main chain",
+				block.Hash(), block.Height())
+		}
+		if sm.blockExporter != nil {
+			if err := sm.blockExporter.Export(block); err != nil {
+				log.Errorf("Unable to export block %v: %v",
+					block.Hash(), err)
+			}
+		}
+		sm.blockStats.connect(block)
+
+		// The connected block is the new tip of the main chain.
+		if sm.onBestBlockChanged != nil {
+			sm.onBestBlockChanged(block.Hash(), block.Height())
+		}
+
 		// Remove all of the transactions (except the coinbase) in the
 		// connected block from the transaction pool.  Secondly, remove any
 		// transactions which are now double spends as a result of these
@@ -1428,7 +3207,7 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 			sm.txMemPool.RemoveOrphan(tx)
 			sm.peerNotifier.TransactionConfirmed(tx)
 			acceptedTxs := sm.txMemPool.ProcessOrphans(tx)
-			sm.peerNotifier.AnnounceNewTransactions(acceptedTxs)
+			sm.announceTxs(acceptedTxs)
 		}
 
 		// Register block with the fee estimator, if it exists.
@@ -1452,20 +3231,21 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 			log.Warnf("Chain disconnected notification is not a block.")
 			break
 		}
+		if sm.logAcceptedBlocks {
+			log.Debugf("Disconnected block %v (height %d) from the "+
+				"main chain", block.Hash(), block.Height())
+		}
+		sm.blockStats.disconnect(block)
 
-		// Reinsert all of the transactions (except the coinbase) into
-		// the transaction pool.
-		for _, tx := range block.Transactions()[1:] {
-			_, _, err := sm.txMemPool.MaybeAcceptTransaction(tx,
-				false, false)
-			if err != nil {
-				// Remove the transaction and all transactions
-				// that depend on it if it wasn't accepted into
-				// the transaction pool.
-				sm.txMemPool.RemoveTransaction(tx, true)
-			}
+		// The parent of the disconnected block is the new tip of the
+		// main chain.
+		if sm.onBestBlockChanged != nil {
+			sm.onBestBlockChanged(&block.MsgBlock().Header.PrevBlock,
+				block.Height()-1)
 		}
 
+		sm.replayDisconnectedTxs(block)
+
 		// Rollback previous block recorded by the fee estimator.
 		if sm.feeEstimator != nil {
 			sm.feeEstimator.Rollback(block.Hash())
@@ -1473,13 +3253,135 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 	}
 }
 
+// queueMsg adds the passed message to the block handling queue unless the sync
+// manager is shutting down, in which case false is returned.  Messages queued
+// before shutdown begins are guaranteed to be either handled or drained by the
+// block handler, so callers waiting on replies are never left blocked.
+func (sm *SyncManager) queueMsg(msg interface{}) bool {
+	sm.shutdownMtx.RLock()
+	defer sm.shutdownMtx.RUnlock()
+
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return false
+	}
+	sm.noteMsgQueued(msg)
+	sm.msgChan <- msg
+	sm.updateBackpressure()
+	return true
+}
+
+// queuePriorityMsg adds the passed message to the priority queue, which is
+// handled ahead of the other messages.  It returns false without queueing the
+// message when the sync manager is shutting down.
+func (sm *SyncManager) queuePriorityMsg(msg interface{}) bool {
+	sm.shutdownMtx.RLock()
+	defer sm.shutdownMtx.RUnlock()
+
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return false
+	}
+	sm.noteMsgQueued(msg)
+	sm.priorityChan <- msg
+	sm.updateBackpressure()
+	return true
+}
+
+// handlePriorityMsg handles a message from the priority queue.  It must be
+// called from the blockHandler goroutine.
+func (sm *SyncManager) handlePriorityMsg(m interface{}) {
+	sm.noteMsgDequeued(m)
+	switch msg := m.(type) {
+	case *blockMsg:
+		sm.handleBlockMsg(msg)
+		msg.reply <- struct{}{}
+
+	case *cmpctBlockMsg:
+		sm.handleCmpctBlockMsg(msg)
+
+	case *blockTxnMsg:
+		sm.handleBlockTxnMsg(msg)
+
+	case pauseMsg:
+		// Wait until the sender unpauses the manager.  The pause may last
+		// arbitrarily long, so the watchdog must not consider the handler
+		// stuck meanwhile.
+		sm.blockHandlerBeat.suspend()
+		<-msg.unpause
+	}
+}
+
+// drainMsgs replies to any messages left in the block handling queue once the
+// block handler has stopped so their senders are not left waiting.
+func (sm *SyncManager) drainMsgs() {
+	for {
+		select {
+		case m := <-sm.priorityChan:
+			if msg, ok := m.(*blockMsg); ok {
+				msg.reply <- struct{}{}
+			}
+
+		case m := <-sm.msgChan:
+			switch msg := m.(type) {
+			case *txMsg:
+				msg.reply <- struct{}{}
+
+			case getSyncPeerMsg:
+				msg.reply <- 0
+
+			case getPendingStateMsg:
+				msg.reply <- nil
+
+			case getInFlightRequestsMsg:
+				msg.reply <- nil
+
+			case getOrphanResolveRequestsMsg:
+				msg.reply <- 0
+
+			case getDownloadProgressMsg:
+				msg.reply <- 0
+
+			case getMessageStatsMsg:
+				msg.reply <- nil
+
+			case getStateMsg:
+				msg.reply <- SyncStateShuttingDown
+
+			case processBlockMsg:
+				msg.reply <- processBlockResponse{
+					err: errShuttingDown,
+				}
+
+			case isCurrentMsg:
+				msg.reply <- false
+
+			case migrateDBMsg:
+				msg.reply <- errShuttingDown
+
+			case cancelSyncMsg:
+				msg.reply <- struct{}{}
+
+			case resumeSyncMsg:
+				msg.reply <- struct{}{}
+
+			case setVerifyMsg:
+				msg.reply <- struct{}{}
+
+			case fetchBlockBodyMsg:
+				msg.reply <- fetchBlockBodyResponse{
+					err: errShuttingDown,
+				}
+			}
+
+		default:
+			return
+		}
+	}
+}
+
 // NewPeer informs the sync manager of a newly active peer.
 func (sm *SyncManager) NewPeer(peer *peerpkg.Peer) {
 	// Ignore if we are shutting down.
-	if atomic.LoadInt32(&sm.shutdown) != 0 {
-		return
-	}
-	sm.msgChan <- &newPeerMsg{peer: peer}
+	sm.queueMsg(&newPeerMsg{peer: peer})
 }
 
 // QueueTx adds the passed transaction message and peer to the block handling
@@ -1487,12 +3389,9 @@ func (sm *SyncManager) NewPeer(peer *peerpkg.Peer) {
 // processed.
 func (sm *SyncManager) QueueTx(tx *btcutil.Tx, peer *peerpkg.Peer, done chan struct{}) {
 	// Don't accept more transactions if we're shutting down.
-	if atomic.LoadInt32(&sm.shutdown) != 0 {
+	if !sm.queueMsg(&txMsg{tx: tx, peer: peer, reply: done}) {
 		done <- struct{}{}
-		return
 	}
-
-	sm.msgChan <- &txMsg{tx: tx, peer: peer, reply: done}
 }
 
 // QueueBlock adds the passed block message and peer to the block handling
@@ -1500,23 +3399,30 @@ func (sm *SyncManager) QueueTx(tx *btcutil.Tx, peer *peerpkg.Peer, done chan str
 // processed.
 func (sm *SyncManager) QueueBlock(block *btcutil.Block, peer *peerpkg.Peer, done chan struct{}) {
 	// Don't accept more blocks if we're shutting down.
-	if atomic.LoadInt32(&sm.shutdown) != 0 {
+	if !sm.queuePriorityMsg(&blockMsg{block: block, peer: peer, reply: done}) {
 		done <- struct{}{}
-		return
 	}
+}
+
+// QueueCmpctBlock adds the passed cmpctblock message and peer to the block
+// handling queue.
+func (sm *SyncManager) QueueCmpctBlock(cmpctBlock *wire.MsgCmpctBlock, peer *peerpkg.Peer) {
+	// No channel handling here because the missing transactions of the
+	// block are requested asynchronously anyways.
+	sm.queuePriorityMsg(&cmpctBlockMsg{cmpctBlock: cmpctBlock, peer: peer})
+}
 
-	sm.msgChan <- &blockMsg{block: block, peer: peer, reply: done}
+// QueueBlockTxn adds the passed blocktxn message and peer to the block
+// handling queue.
+func (sm *SyncManager) QueueBlockTxn(blockTxn *wire.MsgBlockTxn, peer *peerpkg.Peer) {
+	sm.queuePriorityMsg(&blockTxnMsg{blockTxn: blockTxn, peer: peer})
 }
 
 // QueueInv adds the passed inv message and peer to the block handling queue.
 func (sm *SyncManager) QueueInv(inv *wire.MsgInv, peer *peerpkg.Peer) {
 	// No channel handling here because peers do not need to block on inv
 	// messages.
-	if atomic.LoadInt32(&sm.shutdown) != 0 {
-		return
-	}
-
-	sm.msgChan <- &invMsg{inv: inv, peer: peer}
+	sm.queueMsg(&invMsg{inv: inv, peer: peer})
 }
 
 // QueueHeaders adds the passed headers message and peer to the block handling
@@ -1524,11 +3430,7 @@ func (sm *SyncManager) QueueInv(inv *wire.MsgInv, peer *peerpkg.Peer) {
 func (sm *SyncManager) QueueHeaders(headers *wire.MsgHeaders, peer *peerpkg.Peer) {
 	// No channel handling here because peers do not need to block on
 	// headers messages.
-	if atomic.LoadInt32(&sm.shutdown) != 0 {
-		return
-	}
-
-	sm.msgChan <- &headersMsg{headers: headers, peer: peer}
+	sm.queueMsg(&headersMsg{headers: headers, peer: peer})
 }
 
 // QueueNotFound adds the passed notfound message and peer to the block handling
@@ -1536,21 +3438,13 @@ func (sm *SyncManager) QueueHeaders(headers *wire.MsgHeaders, peer *peerpkg.Peer
 func (sm *SyncManager) QueueNotFound(notFound *wire.MsgNotFound, peer *peerpkg.Peer) {
 	// No channel handling here because peers do not need to block on
 	// reject messages.
-	if atomic.LoadInt32(&sm.shutdown) != 0 {
-		return
-	}
-
-	sm.msgChan <- &notFoundMsg{notFound: notFound, peer: peer}
+	sm.queueMsg(&notFoundMsg{notFound: notFound, peer: peer})
 }
 
 // DonePeer informs the blockmanager that a peer has disconnected.
 func (sm *SyncManager) DonePeer(peer *peerpkg.Peer) {
 	// Ignore if we are shutting down.
-	if atomic.LoadInt32(&sm.shutdown) != 0 {
-		return
-	}
-
-	sm.msgChan <- &donePeerMsg{peer: peer}
+	sm.queueMsg(&donePeerMsg{peer: peer})
 }
 
 // Start begins the core block handler which processes block and inv messages.
@@ -1561,29 +3455,258 @@ func (sm *SyncManager) Start() {
 	}
 
 	log.Trace("Starting sync manager")
-	sm.wg.Add(1)
+	sm.blockHandlerBeat.beat()
+	sm.wg.Add(2)
 	go sm.blockHandler()
+	go sm.watchdog()
 }
 
 // Stop gracefully shuts down the sync manager by stopping all asynchronous
-// handlers and waiting for them to finish.
+// handlers and waiting for them to finish.  Once shutdown begins, no new
+// messages are accepted and any that were already queued are drained so the
+// peers waiting on them can unwind.
 func (sm *SyncManager) Stop() error {
+	sm.shutdownMtx.Lock()
 	if atomic.AddInt32(&sm.shutdown, 1) != 1 {
+		sm.shutdownMtx.Unlock()
 		log.Warnf("Sync manager is already in the process of " +
 			"shutting down")
 		return nil
 	}
+	sm.shutdownMtx.Unlock()
 
 	log.Infof("Sync manager shutting down")
 	close(sm.quit)
-	sm.wg.Wait()
+	sm.txFeed.close()
+
+	// A stuck block handler will never exit, so stop waiting for it once
+	// the watchdog finds it stuck, which may happen while it is draining
+	// the queued messages.
+	exited := make(chan struct{})
+	go func() {
+		sm.wg.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-sm.stuck:
+		log.Warnf("Not waiting for stuck block handler to exit")
+		return nil
+	}
+
+	// The block handler drains the queue and signals completion when it
+	// exits, so do so here if it was never started.
+	if atomic.LoadInt32(&sm.started) == 0 {
+		sm.drainMsgs()
+		close(sm.done)
+	}
 	return nil
 }
 
+// WaitForShutdown blocks until the sync manager has been stopped and all
+// queued messages have been drained.  It returns immediately when the block
+// handler is stuck.
+func (sm *SyncManager) WaitForShutdown() {
+	select {
+	case <-sm.done:
+	case <-sm.stuck:
+	}
+}
+
+// SubscribeAcceptedTxs returns a subscription to a live feed of the
+// transactions received from peers that are accepted to the memory pool,
+// including any orphans they cause to be accepted.  Up to bufferSize events
+// are buffered for the subscriber, beyond which events are dropped and a
+// warning is logged so a slow subscriber cannot stall the sync manager.  A
+// bufferSize of zero or less uses a default size.  The subscription is
+// cancelled when the sync manager is stopped.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) SubscribeAcceptedTxs(bufferSize int) *AcceptedTxSubscription {
+	if bufferSize <= 0 {
+		bufferSize = defaultAcceptedTxBufferSize
+	}
+	return sm.txFeed.subscribe(bufferSize)
+}
+
 // SyncPeerID returns the ID of the current sync peer, or 0 if there is none.
 func (sm *SyncManager) SyncPeerID() int32 {
 	reply := make(chan int32)
-	sm.msgChan <- getSyncPeerMsg{reply: reply}
+	if !sm.queueMsg(getSyncPeerMsg{reply: reply}) {
+		return 0
+	}
+	return <-reply
+}
+
+// BlockHeightByHash returns the height of the main chain block with the passed
+// hash using the block index, so the block itself is not loaded.  The returned
+// error wraps ErrOrphanBlock when the block is a known orphan and
+// ErrBlockNotFound when it is otherwise not in the main chain.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) BlockHeightByHash(hash *chainhash.Hash) (int32, error) {
+	height, err := sm.chain.BlockHeightByHash(hash)
+	if err != nil {
+		if sm.chain.IsKnownOrphan(hash) {
+			return 0, fmt.Errorf("%w: %v", ErrOrphanBlock, hash)
+		}
+		return 0, fmt.Errorf("%w: %v", ErrBlockNotFound, hash)
+	}
+	return height, nil
+}
+
+// BlockHashByHeight returns the hash of the main chain block at the passed height
+// using the block index, so the block itself is not loaded.  The returned
+// error wraps ErrBlockNotFound when there is no main chain block at the
+// height.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) BlockHashByHeight(height int32) (*chainhash.Hash, error) {
+	hash, err := sm.chain.BlockHashByHeight(height)
+	if err != nil {
+		return nil, fmt.Errorf("%w: height %d", ErrBlockNotFound, height)
+	}
+	return hash, nil
+}
+
+// FetchBlock returns the block with the passed hash.  When only the header of
+// the block is known because it is still being downloaded in headers-first
+// mode, the body is requested from the sync peer, unless it is already in
+// flight, and the returned error wraps ErrBlockBodyNotAvailable so the caller
+// may retry later.  The returned error wraps ErrBlockNotFound when neither the
+// block nor its header is known and ErrBlockCorrupt when the stored block can't
+// be read, in which case it is downloaded again.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) FetchBlock(hash *chainhash.Hash) (*btcutil.Block, error) {
+	reply := make(chan fetchBlockBodyResponse, 1)
+	if !sm.queueMsg(fetchBlockBodyMsg{hash: hash, reply: reply}) {
+		return nil, errShuttingDown
+	}
+	response := <-reply
+	return response.block, response.err
+}
+
+// GetMempoolTx returns the transaction with the passed hash from the main
+// transaction pool and true, or nil and false when the pool does not contain
+// it.  Orphan transactions are not returned.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) GetMempoolTx(hash *chainhash.Hash) (*btcutil.Tx, bool) {
+	tx, err := sm.txMemPool.FetchTransaction(hash)
+	if err != nil {
+		return nil, false
+	}
+	return tx, true
+}
+
+// MedianTimePast returns the median timestamp of the last 11 blocks ending at
+// the current tip of the main chain.  The chain calculates it once each time
+// the tip changes, so calling this does not load any blocks.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) MedianTimePast() time.Time {
+	return sm.chain.BestSnapshot().MedianTime
+}
+
+// CancelSync stops syncing the chain without shutting down the sync manager.
+// The sync peer is cleared and no new one is chosen until ResumeSync is called,
+// while the sync candidates are kept so syncing can resume later.  Blocks that
+// were already requested are still accepted when they arrive.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) CancelSync() {
+	reply := make(chan struct{})
+	if !sm.queueMsg(cancelSyncMsg{reply: reply}) {
+		return
+	}
+	<-reply
+}
+
+// ResumeSync restarts syncing from the best sync candidate after it was
+// cancelled with CancelSync.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) ResumeSync() {
+	reply := make(chan struct{})
+	if !sm.queueMsg(resumeSyncMsg{reply: reply}) {
+		return
+	}
+	<-reply
+}
+
+// SetVerify enables or disables the verification of the scripts of the blocks
+// received from peers.  Verification can only be disabled on the regression
+// and simulation test networks.  Queued messages are handled before the
+// setting changes, so blocks processed after it returns honor the new setting.
+// This allows the verification to be disabled for a fast bootstrap and enabled
+// again without restarting.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) SetVerify(verify bool) {
+	reply := make(chan struct{})
+	if !sm.queueMsg(setVerifyMsg{verify: verify, reply: reply}) {
+		return
+	}
+	<-reply
+}
+
+// DumpPendingState returns a snapshot of the blocks the sync manager is waiting
+// on, the peers they were requested from, and the outstanding work for each
+// peer.  This is intended for diagnosing a stalled sync.  Nil is returned when
+// the sync manager is shutting down.
+func (sm *SyncManager) DumpPendingState() *PendingState {
+	reply := make(chan *PendingState)
+	if !sm.queueMsg(getPendingStateMsg{reply: reply}) {
+		return nil
+	}
+	return <-reply
+}
+
+// InFlightRequests returns the blocks that were requested from peers and have
+// not been received yet along with the peer and time of each request, ordered
+// from the oldest request to the newest.  This is intended for spotting stuck
+// downloads.  Nil is returned when the sync manager is shutting down.
+func (sm *SyncManager) InFlightRequests() []InFlightRequest {
+	reply := make(chan []InFlightRequest)
+	if !sm.queueMsg(getInFlightRequestsMsg{reply: reply}) {
+		return nil
+	}
+	return <-reply
+}
+
+// OrphanResolveRequests returns the number of orphan resolution requests that
+// are outstanding across all peers.  Zero is returned when the sync manager is
+// shutting down.
+func (sm *SyncManager) OrphanResolveRequests() int {
+	reply := make(chan int)
+	if !sm.queueMsg(getOrphanResolveRequestsMsg{reply: reply}) {
+		return 0
+	}
+	return <-reply
+}
+
+// MessageStats returns the number of inventory vectors announced by, items
+// requested from and blocks delivered by each connected peer ordered by peer
+// id.  Nil is returned when the sync manager is shutting down.
+func (sm *SyncManager) MessageStats() []PeerMessageStats {
+	reply := make(chan []PeerMessageStats)
+	if !sm.queueMsg(getMessageStatsMsg{reply: reply}) {
+		return nil
+	}
+	return <-reply
+}
+
+// DownloadProgressEstimate returns the estimated percentage of the chain that
+// has been downloaded, from 0 to 100.  The height of the sync peer is used as
+// the target when it is known and the height of the latest checkpoint is used
+// otherwise, so a reasonable estimate is available before a sync peer is
+// chosen.  Zero is returned when the sync manager is shutting down.
+func (sm *SyncManager) DownloadProgressEstimate() float64 {
+	reply := make(chan float64)
+	if !sm.queueMsg(getDownloadProgressMsg{reply: reply}) {
+		return 0
+	}
 	return <-reply
 }
 
@@ -1591,46 +3714,253 @@ func (sm *SyncManager) SyncPeerID() int32 {
 // chain.
 func (sm *SyncManager) ProcessBlock(block *btcutil.Block, flags blockchain.BehaviorFlags) (bool, error) {
 	reply := make(chan processBlockResponse, 1)
-	sm.msgChan <- processBlockMsg{block: block, flags: flags, reply: reply}
+	if !sm.queueMsg(processBlockMsg{block: block, flags: flags, reply: reply}) {
+		return false, errShuttingDown
+	}
 	response := <-reply
 	return response.isOrphan, response.err
 }
 
+// ChainParams returns the parameters of the network the sync manager is
+// running with.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) ChainParams() *chaincfg.Params {
+	return sm.chainParams
+}
+
+// NetworkName returns the human-readable name of the network the sync manager
+// is running with such as "mainnet" or "testnet3".
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) NetworkName() string {
+	return sm.chainParams.Name
+}
+
+// SubmitBlockBytes decodes a serialized block from the passed reader and
+// processes it like ProcessBlock.  The decoded block is returned along with
+// whether it is an orphan.  An error wrapping ErrMalformedBlock is returned
+// when the block can't be decoded, while errors processing it, such as
+// blockchain.RuleError, are returned as is.
+func (sm *SyncManager) SubmitBlockBytes(r io.Reader) (*btcutil.Block, bool, error) {
+	var msgBlock wire.MsgBlock
+	if err := msgBlock.Deserialize(r); err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrMalformedBlock, err)
+	}
+	block := btcutil.NewBlock(&msgBlock)
+
+	isOrphan, err := sm.ProcessBlock(block, blockchain.BFNone)
+	if err != nil {
+		return block, false, err
+	}
+	return block, isOrphan, nil
+}
+
 // IsCurrent returns whether or not the sync manager believes it is synced with
 // the connected peers.
 func (sm *SyncManager) IsCurrent() bool {
 	reply := make(chan bool)
-	sm.msgChan <- isCurrentMsg{reply: reply}
+	if !sm.queueMsg(isCurrentMsg{reply: reply}) {
+		return false
+	}
+	return <-reply
+}
+
+// State returns the lifecycle state of the sync manager, which is useful for
+// health checks and readiness probes.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) State() SyncState {
+	if atomic.LoadInt32(&sm.started) == 0 {
+		if atomic.LoadInt32(&sm.shutdown) != 0 {
+			return SyncStateShuttingDown
+		}
+		return SyncStateNotStarted
+	}
+
+	reply := make(chan SyncState)
+	if !sm.queueMsg(getStateMsg{reply: reply}) {
+		return SyncStateShuttingDown
+	}
 	return <-reply
 }
 
-// Pause pauses the sync manager until the returned channel is closed.
+// BlockPropagationLatency returns a snapshot of the distribution of the time
+// between a block first being announced by a peer and the full block being
+// received.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) BlockPropagationLatency() LatencySnapshot {
+	return sm.blockLatency.snapshot()
+}
+
+// TxPropagationLatency returns a snapshot of the distribution of the time
+// between a transaction first being announced by a peer and the full
+// transaction being received.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) TxPropagationLatency() LatencySnapshot {
+	return sm.txLatency.snapshot()
+}
+
+// Pause pauses the sync manager until the returned channel is closed.  The
+// pause takes effect ahead of queued messages other than blocks.
 //
 // Note that while paused, all peer and block processing is halted.  The
 // message sender should avoid pausing the sync manager for long durations.
 func (sm *SyncManager) Pause() chan<- struct{} {
 	c := make(chan struct{})
-	sm.msgChan <- pauseMsg{c}
+	sm.queuePriorityMsg(pauseMsg{c})
 	return c
 }
 
 // New constructs a new SyncManager. Use Start to begin processing asynchronous
 // block, tx, and inv updates.
 func New(config *Config) (*SyncManager, error) {
+	tuning := config.Tuning
+	if tuning.MsgQueuePerPeer <= 0 {
+		tuning.MsgQueuePerPeer = defaultMsgQueuePerPeer
+	}
+	if tuning.MaxStallDuration <= 0 {
+		tuning.MaxStallDuration = defaultMaxStallDuration
+	}
+	if tuning.StallSampleInterval <= 0 {
+		tuning.StallSampleInterval = defaultStallSampleInterval
+	}
+	if tuning.ProgressLogInterval <= 0 {
+		tuning.ProgressLogInterval = defaultProgressLogInterval
+	}
+	if tuning.HandlerTimeout <= 0 {
+		tuning.HandlerTimeout = defaultHandlerTimeout
+	}
+	if tuning.BehindGracePeriod <= 0 {
+		tuning.BehindGracePeriod = defaultBehindGracePeriod
+	}
+	if tuning.CandidateSummaryInterval <= 0 {
+		tuning.CandidateSummaryInterval = defaultCandidateSummaryInterval
+	}
+	if tuning.SyncPeerSwitchInterval <= 0 {
+		tuning.SyncPeerSwitchInterval = defaultSyncPeerSwitchInterval
+	}
+	if tuning.MaxBlockBurst <= 0 {
+		tuning.MaxBlockBurst = defaultMaxBlockBurst
+	}
+	if tuning.LoadCheckInterval <= 0 {
+		tuning.LoadCheckInterval = defaultLoadCheckInterval
+	}
+	msgQueueSize := config.MaxPeers * tuning.MsgQueuePerPeer
+	blockDownloadWindow := config.BlockDownloadWindow
+	if blockDownloadWindow <= 0 {
+		blockDownloadWindow = DefaultBlockDownloadWindow
+	}
+
+	maxSyncCandidates := config.MaxSyncCandidates
+	if maxSyncCandidates <= 0 {
+		maxSyncCandidates = DefaultMaxSyncCandidates
+	}
+
+	maxOrphanDepth := config.MaxOrphanResolveDepth
+	if maxOrphanDepth <= 0 {
+		maxOrphanDepth = DefaultMaxOrphanResolveDepth
+	}
+
+	maxOrphanRequests := config.MaxOrphanResolveRequests
+	if maxOrphanRequests <= 0 {
+		maxOrphanRequests = DefaultMaxOrphanResolveRequests
+	}
+
+	maxPeerOrphans := config.MaxPeerOrphans
+	if maxPeerOrphans <= 0 {
+		maxPeerOrphans = DefaultMaxPeerOrphans
+	}
+
+	peerOrphanWindow := config.PeerOrphanWindow
+	if peerOrphanWindow <= 0 {
+		peerOrphanWindow = DefaultPeerOrphanWindow
+	}
+
+	maxTipRelayDelay := config.MaxTipRelayDelay
+	if maxTipRelayDelay <= 0 {
+		maxTipRelayDelay = config.TipRelayDelay
+	}
+
+	syncPeerSelector := config.SyncPeerSelector
+	if syncPeerSelector == nil {
+		syncPeerSelector = firstSyncPeerSelector{}
+	}
+
 	sm := SyncManager{
-		peerNotifier:    config.PeerNotifier,
-		chain:           config.Chain,
-		txMemPool:       config.TxMemPool,
-		chainParams:     config.ChainParams,
-		rejectedTxns:    make(map[chainhash.Hash]struct{}),
-		requestedTxns:   make(map[chainhash.Hash]struct{}),
-		requestedBlocks: make(map[chainhash.Hash]struct{}),
-		peerStates:      make(map[*peerpkg.Peer]*peerSyncState),
-		progressLogger:  newBlockProgressLogger("Processed", log),
-		msgChan:         make(chan interface{}, config.MaxPeers*3),
-		headerList:      list.New(),
-		quit:            make(chan struct{}),
-		feeEstimator:    config.FeeEstimator,
+		peerNotifier:        config.PeerNotifier,
+		chain:               config.Chain,
+		txMemPool:           config.TxMemPool,
+		chainParams:         config.ChainParams,
+		rejectedTxns:        make(map[chainhash.Hash]struct{}),
+		requestedTxns:       make(map[chainhash.Hash]struct{}),
+		requestedBlocks:     make(map[chainhash.Hash]struct{}),
+		blockAlternates:     make(map[chainhash.Hash][]*peerpkg.Peer),
+		recentBlocks:        make(map[chainhash.Hash]*peerpkg.Peer),
+		bodyRequests:        make(map[chainhash.Hash]struct{}),
+		pendingBodies:       make(map[chainhash.Hash]*btcutil.Block),
+		corruptBlocks:       make(map[chainhash.Hash]struct{}),
+		repairedBlocks:      make(map[chainhash.Hash]*btcutil.Block),
+		invFirstSeen:        make(map[chainhash.Hash]time.Time),
+		blockRequestTimes:   make(map[chainhash.Hash]time.Time),
+		orphanHeights:       make(map[chainhash.Hash]int32),
+		orphanRequests:      make(map[*peerpkg.Peer]time.Time),
+		cmpctBlocks:         make(map[*peerpkg.Peer]*partialBlock),
+		maxOrphanRequests:   maxOrphanRequests,
+		maxPeerOrphans:      maxPeerOrphans,
+		peerOrphanWindow:    peerOrphanWindow,
+		blockLatency:        newLatencyHistogram(),
+		txLatency:           newLatencyHistogram(),
+		txFeed:              newTxFeed(),
+		peerStates:          make(map[*peerpkg.Peer]*peerSyncState),
+		queuedMsgs:          make(map[*peerpkg.Peer]int),
+		pausedPeers:         make(map[*peerpkg.Peer]struct{}),
+		progressLogger:      newBlockProgressLogger("Processed", log, tuning.ProgressLogInterval),
+		txRejectLogger:      newTxRejectLogger(defaultTxRejectLogInterval, config.QuietTxRejectReasons),
+		msgChan:             make(chan interface{}, msgQueueSize),
+		priorityChan:        make(chan interface{}, msgQueueSize),
+		maxStallDuration:    tuning.MaxStallDuration,
+		behindGracePeriod:   tuning.BehindGracePeriod,
+		stallSampleInterval: tuning.StallSampleInterval,
+		summaryInterval:     tuning.CandidateSummaryInterval,
+		switchInterval:      tuning.SyncPeerSwitchInterval,
+		maxBlockBurst:       tuning.MaxBlockBurst,
+		loadSource:          config.LoadSource,
+		maxLoad:             config.MaxLoad,
+		loadCheckInterval:   tuning.LoadCheckInterval,
+		syncPeerSelector:    syncPeerSelector,
+		diverseSyncPeer:     config.DiverseSyncPeer,
+		netGroups:           make(map[string]int),
+		assumeValid:         config.AssumeValid,
+		disableVerify:       config.DisableVerify,
+		blockDownloadWindow: blockDownloadWindow,
+		checkpointQuorum:    config.CheckpointQuorum,
+		maxSyncCandidates:   maxSyncCandidates,
+		maxOrphanDepth:      int32(maxOrphanDepth),
+		getDataPipeline:     config.GetDataPipelineDepth,
+		handlerTimeout:      tuning.HandlerTimeout,
+		requestPeers:        config.RequestPeers,
+		addBanScore:         config.AddBanScore,
+		relayMainChainOnly:  config.RelayMainChainOnly,
+		relayWhileSyncing:   config.RelayWhileSyncing,
+		logAcceptedBlocks:   config.LogAcceptedBlocks,
+		tipRelayDelay:       config.TipRelayDelay,
+		txRelayDelay:        config.TxRelayDelay,
+		maxTipRelayDelay:    maxTipRelayDelay,
+		blockJournal:        config.BlockJournal,
+		orphanStore:         config.OrphanStore,
+		txIndex:             config.TxIndex,
+		blockExporter:       config.BlockExporter,
+		onBestBlockChanged:  config.OnBestBlockChanged,
+		onHandlerStuck:      config.OnHandlerStuck,
+		headerList:          list.New(),
+		quit:                make(chan struct{}),
+		done:                make(chan struct{}),
+		stuck:               make(chan struct{}),
+		feeEstimator:        config.FeeEstimator,
+		invHandlers:         config.InvHandlers,
 	}
 
 	best := sm.chain.BestSnapshot()
@@ -1642,6 +3972,12 @@ func New(config *Config) (*SyncManager, error) {
 		}
 	} else {
 		log.Info("Checkpoints are disabled")
+		sm.checkpointQuorum = 0
+	}
+	if sm.disableVerify && !sm.allowNoVerify() {
+		log.Warnf("Script verification of received blocks cannot be "+
+			"disabled on %s", sm.chainParams.Name)
+		sm.disableVerify = false
 	}
 
 	sm.chain.Subscribe(sm.handleBlockchainNotification)
@@ -0,0 +1,2785 @@
+// Copyright (c) 2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/indexers"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/mempool"
+	peerpkg "github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+)
+
+// connPair returns a pair of tcp connections over the loopback interface that
+// are connected to each other.
+func connPair(t testing.TB) (net.Conn, net.Conn) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+
+	type acceptResult struct {
+		conn net.Conn
+		err  error
+	}
+	accepted := make(chan acceptResult, 1)
+	go func() {
+		conn, err := listener.Accept()
+		accepted <- acceptResult{conn, err}
+	}()
+
+	outConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	result := <-accepted
+	if result.err != nil {
+		t.Fatalf("unable to accept: %v", result.err)
+	}
+	return outConn, result.conn
+}
+
+// mockPeerNotifier is a PeerNotifier that records the notifications sent to
+// it by the sync manager.
+type mockPeerNotifier struct {
+	mtx          sync.Mutex
+	relayed      []*wire.InvVect
+	announced    []*mempool.TxDesc
+	notified     []*mempool.TxDesc
+	confirmed    []*btcutil.Tx
+	heightsSent  int
+	backpressure []backpressureNote
+}
+
+// backpressureNote is a backpressure notification recorded by the mock peer
+// notifier.
+type backpressureNote struct {
+	peer     *peerpkg.Peer
+	asserted bool
+}
+
+// AnnounceNewTransactions records the passed transactions as announced.
+func (m *mockPeerNotifier) AnnounceNewTransactions(newTxs []*mempool.TxDesc) {
+	m.mtx.Lock()
+	m.announced = append(m.announced, newTxs...)
+	m.mtx.Unlock()
+}
+
+// NotifyNewTransactions records the passed transactions as notified.
+func (m *mockPeerNotifier) NotifyNewTransactions(newTxs []*mempool.TxDesc) {
+	m.mtx.Lock()
+	m.notified = append(m.notified, newTxs...)
+	m.mtx.Unlock()
+}
+
+// UpdatePeerHeights records that a peer height update was requested.
+func (m *mockPeerNotifier) UpdatePeerHeights(latestBlkHash *chainhash.Hash,
+	latestHeight int32, updateSource *peerpkg.Peer) {
+
+	m.mtx.Lock()
+	m.heightsSent++
+	m.mtx.Unlock()
+}
+
+// RelayInventory records the passed inventory vector as relayed.
+func (m *mockPeerNotifier) RelayInventory(invVect *wire.InvVect,
+	data interface{}) {
+
+	m.mtx.Lock()
+	m.relayed = append(m.relayed, invVect)
+	m.mtx.Unlock()
+}
+
+// TransactionConfirmed records the passed transaction as confirmed.
+func (m *mockPeerNotifier) TransactionConfirmed(tx *btcutil.Tx) {
+	m.mtx.Lock()
+	m.confirmed = append(m.confirmed, tx)
+	m.mtx.Unlock()
+}
+
+// QueueBackpressure records whether backpressure is asserted for the passed
+// peer.
+func (m *mockPeerNotifier) QueueBackpressure(peer *peerpkg.Peer,
+	asserted bool) {
+
+	m.mtx.Lock()
+	m.backpressure = append(m.backpressure,
+		backpressureNote{peer, asserted})
+	m.mtx.Unlock()
+}
+
+// testContext houses a sync manager along with the chain and mempool it is
+// driving for use in tests.
+type testContext struct {
+	sm       *SyncManager
+	chain    *blockchain.BlockChain
+	notifier *mockPeerNotifier
+	params   *chaincfg.Params
+}
+
+// newTestConfig returns a sync manager config backed by a fresh regression
+// test chain stored in a temporary directory.
+func newTestConfig(t testing.TB) *Config {
+	t.Helper()
+	return newTestConfigWithCheckpoints(t, nil)
+}
+
+// newTestConfigWithCheckpoints returns a sync manager config backed by a fresh
+// regression test chain stored in a temporary directory that uses the passed
+// checkpoints.
+func newTestConfigWithCheckpoints(t testing.TB,
+	checkpoints []chaincfg.Checkpoint) *Config {
+
+	t.Helper()
+	return newTestChainConfig(t, checkpoints, false, nil)
+}
+
+// newTestConfigWithTxIndex returns a sync manager config backed by a fresh
+// regression test chain stored in a temporary directory that maintains a
+// transaction index.
+func newTestConfigWithTxIndex(t testing.TB) *Config {
+	t.Helper()
+	return newTestChainConfig(t, nil, true, nil)
+}
+
+// newTestConfigWithDB returns a sync manager config backed by a fresh
+// regression test chain stored in a temporary directory that accesses the
+// database through the one returned by the passed function.
+func newTestConfigWithDB(t testing.TB,
+	wrapDB func(database.DB) database.DB) *Config {
+
+	t.Helper()
+	return newTestChainConfig(t, nil, false, wrapDB)
+}
+
+// newTestChainConfig returns a sync manager config backed by a fresh regression
+// test chain stored in a temporary directory that uses the passed checkpoints
+// and maintains a transaction index when requested.  The database is accessed
+// through the one returned by wrapDB when it is not nil.
+func newTestChainConfig(t testing.TB, checkpoints []chaincfg.Checkpoint,
+	withTxIndex bool, wrapDB func(database.DB) database.DB) *Config {
+
+	t.Helper()
+
+	params := chaincfg.RegressionNetParams
+	dbPath := filepath.Join(t.TempDir(), "ffldb")
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if wrapDB != nil {
+		db = wrapDB(db)
+	}
+
+	chainCfg := &blockchain.Config{
+		DB:                 db,
+		ChainParams:        &params,
+		TimeSource:         blockchain.NewMedianTime(),
+		SigCache:           txscript.NewSigCache(1000),
+		Checkpoints:        checkpoints,
+		MaxSideChainBlocks: blockchain.DefaultMaxSideChainBlocks,
+	}
+	var txIndex *indexers.TxIndex
+	if withTxIndex {
+		txIndex = indexers.NewTxIndex(db)
+		chainCfg.IndexManager = indexers.NewManager(db,
+			[]indexers.Indexer{txIndex})
+	}
+	chain, err := blockchain.New(chainCfg)
+	if err != nil {
+		t.Fatalf("unable to create chain: %v", err)
+	}
+
+	txPool := mempool.New(&mempool.Config{
+		Policy: mempool.Policy{
+			MaxOrphanTxs:      100,
+			MaxOrphanTxSize:   100000,
+			MaxSigOpCostPerTx: blockchain.MaxBlockSigOpsCost / 4,
+			MinRelayTxFee:     mempool.DefaultMinRelayTxFee,
+			MaxTxVersion:      2,
+		},
+		ChainParams:   &params,
+		FetchUtxoView: chain.FetchUtxoView,
+		BestHeight: func() int32 {
+			return chain.BestSnapshot().Height
+		},
+		MedianTimePast: func() time.Time {
+			return chain.BestSnapshot().MedianTime
+		},
+		CalcSequenceLock: func(tx *btcutil.Tx,
+			view *blockchain.UtxoViewpoint) (*blockchain.SequenceLock, error) {
+
+			return chain.CalcSequenceLock(tx, view, true)
+		},
+		IsDeploymentActive: chain.IsDeploymentActive,
+	})
+
+	return &Config{
+		PeerNotifier: &mockPeerNotifier{},
+		Chain:        chain,
+		TxMemPool:    txPool,
+		ChainParams:  &params,
+		MaxPeers:     8,
+		TxIndex:      txIndex,
+	}
+}
+
+// newTestContextWithConfig returns a test context using a sync manager
+// created from the passed config.  The sync manager is not started so tests
+// may drive the handlers directly.
+func newTestContextWithConfig(t testing.TB, cfg *Config) *testContext {
+	t.Helper()
+
+	sm, err := New(cfg)
+	if err != nil {
+		t.Fatalf("unable to create sync manager: %v", err)
+	}
+	return &testContext{
+		sm:       sm,
+		chain:    cfg.Chain,
+		notifier: cfg.PeerNotifier.(*mockPeerNotifier),
+		params:   cfg.ChainParams,
+	}
+}
+
+// testPeer houses a local peer connected to a remote peer along with the
+// reject, ping, getdata, getblocks and inv messages received by the remote
+// peer.
+type testPeer struct {
+	*peerpkg.Peer
+	remote    *peerpkg.Peer
+	rejects   chan *wire.MsgReject
+	pings     chan struct{}
+	getData   chan *wire.MsgGetData
+	getBlocks chan *wire.MsgGetBlocks
+	invs      chan *wire.MsgInv
+}
+
+// newTestPeer returns a local peer that has fully negotiated a connection
+// with a remote peer at the passed address.  The remote peer advertises
+// witness support when requested.
+func newTestPeer(t testing.TB, params *chaincfg.Params, remoteAddr string,
+	witness bool) *testPeer {
+
+	t.Helper()
+	return newTestPeerWithVersion(t, params, remoteAddr, witness, 0)
+}
+
+// newTestPeerWithVersion returns a local peer that has fully negotiated a
+// connection with a remote peer at the passed address that advertises the
+// passed protocol version, or the latest version when it is zero.  The remote
+// peer advertises witness support when requested.
+func newTestPeerWithVersion(t testing.TB, params *chaincfg.Params,
+	remoteAddr string, witness bool, pver uint32) *testPeer {
+
+	t.Helper()
+
+	verack := make(chan struct{}, 2)
+	onVerAck := func(p *peerpkg.Peer, msg *wire.MsgVerAck) {
+		verack <- struct{}{}
+	}
+
+	rejects := make(chan *wire.MsgReject, 10)
+	pings := make(chan struct{}, 10)
+	getData := make(chan *wire.MsgGetData, 10)
+	getBlocks := make(chan *wire.MsgGetBlocks, 10)
+	invs := make(chan *wire.MsgInv, 10)
+	services := wire.SFNodeNetwork
+	if witness {
+		services |= wire.SFNodeWitness
+	}
+	remoteCfg := &peerpkg.Config{
+		Listeners: peerpkg.MessageListeners{
+			OnVerAck: onVerAck,
+			OnReject: func(p *peerpkg.Peer, msg *wire.MsgReject) {
+				rejects <- msg
+			},
+			OnPing: func(p *peerpkg.Peer, msg *wire.MsgPing) {
+				pings <- struct{}{}
+			},
+			OnGetData: func(p *peerpkg.Peer, msg *wire.MsgGetData) {
+				select {
+				case getData <- msg:
+				default:
+				}
+			},
+			OnGetBlocks: func(p *peerpkg.Peer, msg *wire.MsgGetBlocks) {
+				select {
+				case getBlocks <- msg:
+				default:
+				}
+			},
+			OnInv: func(p *peerpkg.Peer, msg *wire.MsgInv) {
+				select {
+				case invs <- msg:
+				default:
+				}
+			},
+		},
+		ChainParams:     params,
+		Services:        services,
+		ProtocolVersion: pver,
+		AllowSelfConns:  true,
+	}
+	localCfg := &peerpkg.Config{
+		Listeners: peerpkg.MessageListeners{
+			OnVerAck: onVerAck,
+		},
+		ChainParams:     params,
+		Services:        wire.SFNodeNetwork | wire.SFNodeWitness,
+		TrickleInterval: 10 * time.Millisecond,
+		AllowSelfConns:  true,
+	}
+
+	local, err := peerpkg.NewOutboundPeer(localCfg, remoteAddr)
+	if err != nil {
+		t.Fatalf("unable to create peer: %v", err)
+	}
+	remote := peerpkg.NewInboundPeer(remoteCfg)
+
+	localConn, remoteConn := connPair(t)
+	local.AssociateConnection(localConn)
+	remote.AssociateConnection(remoteConn)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-verack:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for peer negotiation")
+		}
+	}
+	t.Cleanup(func() {
+		local.Disconnect()
+		remote.Disconnect()
+	})
+
+	return &testPeer{
+		Peer:      local,
+		remote:    remote,
+		rejects:   rejects,
+		pings:     pings,
+		getData:   getData,
+		getBlocks: getBlocks,
+		invs:      invs,
+	}
+}
+
+// opTrueScript is a redeem script that can be satisfied by anyone.
+var opTrueScript = []byte{txscript.OP_TRUE}
+
+// opTrueP2SHScript returns a standard pay-to-script-hash script for
+// opTrueScript, which allows its outputs to be spent by standard transactions.
+func opTrueP2SHScript(t *testing.T, params *chaincfg.Params) []byte {
+	t.Helper()
+
+	addr, err := btcutil.NewAddressScriptHash(opTrueScript, params)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("unable to create script: %v", err)
+	}
+	return pkScript
+}
+
+// createBlock returns a solved block that extends the current best chain tip
+// and only contains a coinbase transaction paying to opTrueP2SHScript.
+func (ctx *testContext) createBlock(t *testing.T) *btcutil.Block {
+	t.Helper()
+
+	best := ctx.chain.BestSnapshot()
+	height := best.Height + 1
+	coinbaseScript, err := txscript.NewScriptBuilder().
+		AddInt64(int64(height)).AddInt64(0).Script()
+	if err != nil {
+		t.Fatalf("unable to create coinbase script: %v", err)
+	}
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex),
+		SignatureScript: coinbaseScript,
+		Sequence:        wire.MaxTxInSequenceNum,
+	})
+	coinbase.AddTxOut(&wire.TxOut{
+		Value:    blockchain.CalcBlockSubsidy(height, ctx.params),
+		PkScript: opTrueP2SHScript(t, ctx.params),
+	})
+
+	// Use a timestamp after the median time of the tip that is also
+	// recent enough for the chain to be considered current.
+	timestamp := time.Unix(time.Now().Unix(), 0)
+	if !timestamp.After(best.MedianTime) {
+		timestamp = best.MedianTime.Add(time.Second)
+	}
+
+	txns := []*btcutil.Tx{btcutil.NewTx(coinbase)}
+	merkles := blockchain.BuildMerkleTreeStore(txns, false)
+	merkleRoot := merkles[len(merkles)-1]
+	msgBlock := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:    4,
+			PrevBlock:  best.Hash,
+			MerkleRoot: *merkleRoot,
+			Timestamp:  timestamp,
+			Bits:       ctx.params.PowLimitBits,
+		},
+		Transactions: []*wire.MsgTx{coinbase},
+	}
+
+	return solveBlock(msgBlock)
+}
+
+// createBlockWithTxs returns a solved block that extends the current best chain
+// tip and contains the passed transactions after a coinbase transaction paying
+// to opTrueP2SHScript.
+func (ctx *testContext) createBlockWithTxs(t *testing.T,
+	txns ...*wire.MsgTx) *btcutil.Block {
+
+	t.Helper()
+
+	msgBlock := ctx.createBlock(t).MsgBlock()
+	for _, tx := range txns {
+		msgBlock.AddTransaction(tx)
+	}
+	merkles := blockchain.BuildMerkleTreeStore(
+		btcutil.NewBlock(msgBlock).Transactions(), false)
+	msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+	return solveBlock(msgBlock)
+}
+
+// solveBlock returns the passed block after finding a nonce that solves it.
+// Regression test network blocks have a trivial difficulty so a solution is
+// found within a few attempts.
+func solveBlock(msgBlock *wire.MsgBlock) *btcutil.Block {
+	target := blockchain.CompactToBig(msgBlock.Header.Bits)
+	for {
+		hash := msgBlock.Header.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			break
+		}
+		msgBlock.Header.Nonce++
+	}
+	return btcutil.NewBlock(msgBlock)
+}
+
+// TestInvHandlers ensures inventory types that aren't natively supported are
+// handed off to registered handlers instead of being silently dropped.
+func TestInvHandlers(t *testing.T) {
+	const customInvType = wire.InvType(0x7f)
+
+	var mtx sync.Mutex
+	var handled []*wire.InvVect
+	cfg := newTestConfig(t)
+	cfg.InvHandlers = map[wire.InvType]InvHandler{
+		customInvType: func(peer *peerpkg.Peer, iv *wire.InvVect) {
+			mtx.Lock()
+			handled = append(handled, iv)
+			mtx.Unlock()
+		},
+	}
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+
+	customHash := chainhash.Hash{0x01}
+	unknownHash := chainhash.Hash{0x02}
+	inv := wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(customInvType, &customHash))
+	inv.AddInvVect(wire.NewInvVect(wire.InvType(0x7e), &unknownHash))
+	ctx.sm.handleInvMsg(&invMsg{inv: inv, peer: peer.Peer})
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if len(handled) != 1 {
+		t.Fatalf("handler invoked %d times, want 1", len(handled))
+	}
+	if handled[0].Hash != customHash {
+		t.Fatalf("handler invoked with hash %v, want %v",
+			handled[0].Hash, customHash)
+	}
+}
+
+// TestTuning ensures the sync manager uses the queue sizes and timeouts
+// provided in the config and falls back to the defaults otherwise.
+func TestTuning(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	if got, want := cap(ctx.sm.msgChan), 8*defaultMsgQueuePerPeer; got != want {
+		t.Fatalf("default message queue size %d, want %d", got, want)
+	}
+	if ctx.sm.maxStallDuration != defaultMaxStallDuration {
+		t.Fatalf("default max stall duration %v, want %v",
+			ctx.sm.maxStallDuration, defaultMaxStallDuration)
+	}
+	if ctx.sm.stallSampleInterval != defaultStallSampleInterval {
+		t.Fatalf("default stall sample interval %v, want %v",
+			ctx.sm.stallSampleInterval, defaultStallSampleInterval)
+	}
+	if ctx.sm.progressLogger.logInterval != defaultProgressLogInterval {
+		t.Fatalf("default progress log interval %v, want %v",
+			ctx.sm.progressLogger.logInterval,
+			defaultProgressLogInterval)
+	}
+
+	cfg := newTestConfig(t)
+	cfg.Tuning = Tuning{
+		MsgQueuePerPeer:     10,
+		MaxStallDuration:    time.Minute,
+		StallSampleInterval: time.Second,
+		ProgressLogInterval: 2 * time.Second,
+	}
+	ctx = newTestContextWithConfig(t, cfg)
+	if got, want := cap(ctx.sm.msgChan), 8*10; got != want {
+		t.Fatalf("message queue size %d, want %d", got, want)
+	}
+	if ctx.sm.maxStallDuration != time.Minute {
+		t.Fatalf("max stall duration %v, want %v",
+			ctx.sm.maxStallDuration, time.Minute)
+	}
+	if ctx.sm.stallSampleInterval != time.Second {
+		t.Fatalf("stall sample interval %v, want %v",
+			ctx.sm.stallSampleInterval, time.Second)
+	}
+	if ctx.sm.progressLogger.logInterval != 2*time.Second {
+		t.Fatalf("progress log interval %v, want %v",
+			ctx.sm.progressLogger.logInterval, 2*time.Second)
+	}
+}
+
+// TestPendingRelay ensures blocks accepted while no peers are connected are
+// announced once a peer connects.
+func TestPendingRelay(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+
+	block := ctx.createBlock(t)
+	_, isOrphan, err := ctx.chain.ProcessBlock(block, blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	if isOrphan {
+		t.Fatal("block unexpectedly an orphan")
+	}
+
+	ctx.notifier.mtx.Lock()
+	numRelayed := len(ctx.notifier.relayed)
+	ctx.notifier.mtx.Unlock()
+	if numRelayed != 0 {
+		t.Fatalf("relayed %d inventory vectors with no peers, want 0",
+			numRelayed)
+	}
+
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+
+	ctx.notifier.mtx.Lock()
+	defer ctx.notifier.mtx.Unlock()
+	if len(ctx.notifier.relayed) != 1 {
+		t.Fatalf("relayed %d inventory vectors, want 1",
+			len(ctx.notifier.relayed))
+	}
+	want := wire.NewInvVect(wire.InvTypeBlock, block.Hash())
+	if *ctx.notifier.relayed[0] != *want {
+		t.Fatalf("relayed %v, want %v", ctx.notifier.relayed[0], want)
+	}
+	if len(ctx.sm.pendingRelays) != 0 {
+		t.Fatalf("%d pending relays remain", len(ctx.sm.pendingRelays))
+	}
+}
+
+// TestShutdownDrainsQueue ensures peers waiting on messages that were queued
+// when the sync manager is stopped mid-sync are released and that the
+// goroutines of the sync manager and the peers exit.
+func TestShutdownDrainsQueue(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	block := btcutil.NewBlock(ctx.params.GenesisBlock)
+
+	// Pause the sync manager so the queued blocks are still pending when
+	// shutdown begins.
+	ctx.sm.Start()
+	unpause := ctx.sm.Pause()
+
+	const numQueued = 10
+	var wg sync.WaitGroup
+	wg.Add(numQueued)
+	for i := 0; i < numQueued; i++ {
+		go func() {
+			defer wg.Done()
+			done := make(chan struct{}, 1)
+			ctx.sm.QueueBlock(block, peer.Peer, done)
+			<-done
+		}()
+	}
+	for len(ctx.sm.priorityChan) < numQueued {
+		time.Sleep(time.Millisecond)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		ctx.sm.Stop()
+		close(stopped)
+	}()
+	for atomic.LoadInt32(&ctx.sm.shutdown) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(unpause)
+
+	released := make(chan struct{})
+	go func() {
+		wg.Wait()
+		ctx.sm.WaitForShutdown()
+		<-stopped
+		close(released)
+	}()
+	select {
+	case <-released:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for queued blocks to be released")
+	}
+
+	// Blocks queued after shutdown must be released immediately.
+	done := make(chan struct{}, 1)
+	ctx.sm.QueueBlock(block, peer.Peer, done)
+	select {
+	case <-done:
+	default:
+		t.Fatal("block queued after shutdown was not released")
+	}
+
+	// The goroutines started by the test have all exited once released
+	// is closed.  Stop waits for the goroutines of the sync manager to
+	// exit unless it gave up on a stuck block handler.
+	select {
+	case <-ctx.sm.stuck:
+		t.Fatal("sync manager goroutines did not exit")
+	default:
+	}
+}
+
+// TestBlockPriority ensures queued blocks are processed ahead of a flood of
+// queued inventory announcements.
+func TestBlockPriority(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Tuning.MsgQueuePerPeer = 100
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	block := ctx.createBlock(t)
+	blockHash := block.Hash()
+
+	// Pause the sync manager while the inventory announcements and then the
+	// block are queued.
+	ctx.sm.Start()
+	defer ctx.sm.Stop()
+	unpause := ctx.sm.Pause()
+	for len(ctx.sm.priorityChan) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	const numInvs = 500
+	for i := 0; i < numInvs; i++ {
+		ctx.sm.QueueInv(wire.NewMsgInv(), peer.Peer)
+	}
+	done := make(chan struct{})
+	var acknowledged bool
+	defer func() {
+		if !acknowledged {
+			go func() { <-done }()
+		}
+	}()
+	go ctx.sm.QueueBlock(block, peer.Peer, done)
+	for len(ctx.sm.priorityChan) < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(unpause)
+
+	// The block is processed before any of the announcements.  The handler
+	// waits for the block to be acknowledged, so the announcements remain
+	// queued until then.
+	deadline := time.Now().Add(5 * time.Second)
+	for ctx.chain.BestSnapshot().Hash != *blockHash {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for block to be processed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := len(ctx.sm.msgChan); got != numInvs {
+		t.Fatalf("%d announcements handled before the block",
+			numInvs-got)
+	}
+	<-done
+	acknowledged = true
+}
+
+// TestBlockAlternates ensures a block advertised by a second peer while a
+// request for it is still outstanding is not requested again, but is
+// requested from the second peer once the original request fails.
+func TestBlockAlternates(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+
+	// Extend the chain with a recent block so it is considered current
+	// and invs from peers other than the sync peer are processed.
+	block := ctx.createBlock(t)
+	if _, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone); err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+
+	peerA := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	peerB := newTestPeer(t, ctx.params, "127.0.0.2:18444", true)
+	ctx.sm.handleNewPeerMsg(peerA.Peer)
+	ctx.sm.handleNewPeerMsg(peerB.Peer)
+
+	hash := chainhash.Hash{0x01}
+	inv := wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, &hash))
+	ctx.sm.handleInvMsg(&invMsg{inv: inv, peer: peerA.Peer})
+	ctx.sm.handleInvMsg(&invMsg{inv: inv, peer: peerB.Peer})
+
+	stateA := ctx.sm.peerStates[peerA.Peer]
+	stateB := ctx.sm.peerStates[peerB.Peer]
+	if _, ok := stateA.requestedBlocks[hash]; !ok {
+		t.Fatal("block not requested from first peer")
+	}
+	if _, ok := stateB.requestedBlocks[hash]; ok {
+		t.Fatal("block requested again from second peer")
+	}
+	alternates := ctx.sm.blockAlternates[hash]
+	if len(alternates) != 1 || alternates[0] != peerB.Peer {
+		t.Fatalf("unexpected alternates %v", alternates)
+	}
+
+	// Losing the first peer must request the block from the alternate.
+	ctx.sm.handleDonePeerMsg(peerA.Peer)
+	if _, ok := stateB.requestedBlocks[hash]; !ok {
+		t.Fatal("block not requested from alternate peer")
+	}
+	if _, ok := ctx.sm.requestedBlocks[hash]; !ok {
+		t.Fatal("block no longer tracked as requested")
+	}
+	if _, ok := ctx.sm.blockAlternates[hash]; ok {
+		t.Fatal("alternate peer still tracked after being used")
+	}
+
+	// Losing the alternate leaves no sources, so the block is forgotten.
+	ctx.sm.handleDonePeerMsg(peerB.Peer)
+	if _, ok := ctx.sm.requestedBlocks[hash]; ok {
+		t.Fatal("block still tracked as requested with no sources")
+	}
+}
+
+// TestGetDataSkipsInFlight ensures the getdata message built from the request
+// queue of a peer excludes items that are already in flight from another peer
+// and requests items queued more than once only once.
+func TestGetDataSkipsInFlight(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+
+	// Extend the chain with a recent block so it is considered current
+	// and invs from peers other than the sync peer are processed.
+	block := ctx.createBlock(t)
+	if _, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone); err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+
+	peerA := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	peerB := newTestPeer(t, ctx.params, "127.0.0.2:18444", true)
+	ctx.sm.handleNewPeerMsg(peerA.Peer)
+	ctx.sm.handleNewPeerMsg(peerB.Peer)
+
+	inFlightBlock := chainhash.Hash{0x01}
+	inFlightTx := chainhash.Hash{0x02}
+	inv := wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, &inFlightBlock))
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeTx, &inFlightTx))
+	ctx.sm.handleInvMsg(&invMsg{inv: inv, peer: peerA.Peer})
+	select {
+	case <-peerA.getData:
+	case <-time.After(time.Second):
+		t.Fatal("getdata not sent to first peer")
+	}
+
+	newBlock := chainhash.Hash{0x03}
+	newTx := chainhash.Hash{0x04}
+	inv = wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, &inFlightBlock))
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeTx, &inFlightTx))
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeTx, &newTx))
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, &newBlock))
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, &newBlock))
+	ctx.sm.handleInvMsg(&invMsg{inv: inv, peer: peerB.Peer})
+
+	var got []chainhash.Hash
+	select {
+	case msg := <-peerB.getData:
+		for _, iv := range msg.InvList {
+			got = append(got, iv.Hash)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("getdata not sent to second peer")
+	}
+	want := []chainhash.Hash{newTx, newBlock}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("getdata requested %v, want %v", got, want)
+	}
+}
+
+// TestCheckpointQuorum ensures sync candidates must serve headers matching the
+// checkpoint quorum before they are chosen as the sync peer and that peers
+// serving a different chain are disconnected.
+func TestCheckpointQuorum(t *testing.T) {
+	// Create a chain of blocks to checkpoint using a separate chain.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 3; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	checkpoints := []chaincfg.Checkpoint{{Height: 2, Hash: blocks[1].Hash()}}
+	cfg := newTestConfigWithCheckpoints(t, checkpoints)
+	cfg.CheckpointQuorum = 1
+	ctx := newTestContextWithConfig(t, cfg)
+	for _, block := range blocks {
+		_, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+	}
+
+	badPeer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	goodPeer := newTestPeer(t, ctx.params, "127.0.0.1:18445", true)
+	badPeer.UpdateLastBlockHeight(3)
+	goodPeer.UpdateLastBlockHeight(3)
+	ctx.sm.handleNewPeerMsg(badPeer.Peer)
+	ctx.sm.handleNewPeerMsg(goodPeer.Peer)
+	if ctx.sm.syncPeer != nil {
+		t.Fatalf("sync peer %v chosen before verifying checkpoints",
+			ctx.sm.syncPeer)
+	}
+
+	// A peer serving a different block at the checkpoint height must be
+	// disconnected.
+	headers := wire.NewMsgHeaders()
+	headers.AddBlockHeader(&blocks[0].MsgBlock().Header)
+	ctx.sm.handleHeadersMsg(&headersMsg{headers: headers, peer: badPeer.Peer})
+	if badPeer.Connected() {
+		t.Fatal("peer failing checkpoint was not disconnected")
+	}
+	if ctx.sm.syncPeer != nil {
+		t.Fatalf("sync peer %v chosen after failed checkpoint",
+			ctx.sm.syncPeer)
+	}
+
+	// A peer serving the checkpoint block becomes the sync peer.
+	headers = wire.NewMsgHeaders()
+	headers.AddBlockHeader(&blocks[1].MsgBlock().Header)
+	ctx.sm.handleHeadersMsg(&headersMsg{headers: headers, peer: goodPeer.Peer})
+	if !goodPeer.Connected() {
+		t.Fatal("peer matching checkpoint was disconnected")
+	}
+	if ctx.sm.syncPeer != goodPeer.Peer {
+		t.Fatalf("sync peer is %v, want %v", ctx.sm.syncPeer,
+			goodPeer.Peer)
+	}
+}
+
+// TestProtocolVersionGating ensures peers that negotiated a protocol version
+// predating headers are synced from without headers-first mode and are not sync
+// candidates when they would have to prove the checkpoint quorum.
+func TestProtocolVersionGating(t *testing.T) {
+	// Create a chain of blocks to checkpoint using a separate chain.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 3; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+	checkpoints := []chaincfg.Checkpoint{{Height: 2, Hash: blocks[1].Hash()}}
+	const oldVersion = wire.NetAddressTimeVersion
+
+	// Only peers supporting headers are synced from in headers-first mode.
+	for _, pver := range []uint32{oldVersion, 0} {
+		ctx := newTestContextWithConfig(t,
+			newTestConfigWithCheckpoints(t, checkpoints))
+		peer := newTestPeerWithVersion(t, ctx.params, "127.0.0.1:18444",
+			true, pver)
+		peer.UpdateLastBlockHeight(3)
+		ctx.sm.handleNewPeerMsg(peer.Peer)
+		if ctx.sm.syncPeer != peer.Peer {
+			t.Fatalf("version %d: sync peer is %v, want %v", pver,
+				ctx.sm.syncPeer, peer.Peer)
+		}
+		wantHeadersFirst := pver == 0
+		if ctx.sm.headersFirstMode != wantHeadersFirst {
+			t.Fatalf("version %d: headers-first mode %v, want %v",
+				pver, ctx.sm.headersFirstMode, wantHeadersFirst)
+		}
+	}
+
+	// Only peers supporting headers may prove the checkpoint quorum.
+	cfg := newTestConfigWithCheckpoints(t, checkpoints)
+	cfg.CheckpointQuorum = 1
+	ctx := newTestContextWithConfig(t, cfg)
+	for _, block := range blocks {
+		_, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+	}
+	oldPeer := newTestPeerWithVersion(t, ctx.params, "127.0.0.1:18444",
+		true, oldVersion)
+	newPeer := newTestPeer(t, ctx.params, "127.0.0.1:18445", true)
+	oldPeer.UpdateLastBlockHeight(3)
+	newPeer.UpdateLastBlockHeight(3)
+	if oldPeer.ProtocolVersion() != oldVersion {
+		t.Fatalf("negotiated protocol version %d, want %d",
+			oldPeer.ProtocolVersion(), oldVersion)
+	}
+	ctx.sm.handleNewPeerMsg(oldPeer.Peer)
+	ctx.sm.handleNewPeerMsg(newPeer.Peer)
+	if ctx.sm.peerStates[oldPeer.Peer].syncCandidate {
+		t.Fatal("peer without headers support is a sync candidate")
+	}
+	state := ctx.sm.peerStates[newPeer.Peer]
+	if !state.syncCandidate || len(state.pendingCheckpoints) == 0 {
+		t.Fatal("peer with headers support not asked to prove " +
+			"checkpoints")
+	}
+}
+
+// TestGetBlocksContinuation ensures the blocks after a full batch of blocks
+// announced by the sync peer are requested once the last block of the batch is
+// received and that no more blocks are requested after a partial batch.
+func TestGetBlocksContinuation(t *testing.T) {
+	// Create more blocks than fit in a single batch using a separate
+	// chain.
+	const numBlocks = wire.MaxBlocksPerMsg + 10
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < numBlocks; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	peer := newTestPeerWithVersion(t, ctx.params, "127.0.0.1:18444", true,
+		wire.NetAddressTimeVersion)
+	peer.UpdateLastBlockHeight(numBlocks)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	if ctx.sm.syncPeer != peer.Peer || ctx.sm.headersFirstMode {
+		t.Fatal("peer not synced from using getblocks")
+	}
+	select {
+	case <-peer.getBlocks:
+	case <-time.After(time.Second):
+		t.Fatal("initial getblocks not sent")
+	}
+
+	// sendBatch announces the passed blocks and delivers them as the sync
+	// peer would in response to a getblocks request.
+	sendBatch := func(batch []*btcutil.Block) {
+		inv := wire.NewMsgInvSizeHint(uint(len(batch)))
+		for _, block := range batch {
+			iv := wire.NewInvVect(wire.InvTypeBlock, block.Hash())
+			if err := inv.AddInvVect(iv); err != nil {
+				t.Fatalf("unable to add inventory: %v", err)
+			}
+		}
+		ctx.sm.handleInvMsg(&invMsg{inv: inv, peer: peer.Peer})
+		for _, block := range batch {
+			ctx.sm.handleBlockMsg(&blockMsg{
+				block: block,
+				peer:  peer.Peer,
+			})
+		}
+	}
+
+	// The next batch is requested from the tip once the full batch is
+	// received.
+	sendBatch(blocks[:wire.MaxBlocksPerMsg])
+	last := blocks[wire.MaxBlocksPerMsg-1]
+	select {
+	case msg := <-peer.getBlocks:
+		if len(msg.BlockLocatorHashes) == 0 ||
+			*msg.BlockLocatorHashes[0] != *last.Hash() {
+
+			t.Fatalf("getblocks locator does not start at %v",
+				last.Hash())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("getblocks not sent after a full batch")
+	}
+
+	// A partial batch means the peer has no more blocks.
+	sendBatch(blocks[wire.MaxBlocksPerMsg:])
+	if best := ctx.chain.BestSnapshot(); best.Height != numBlocks {
+		t.Fatalf("best chain height is %d, want %d", best.Height,
+			numBlocks)
+	}
+	select {
+	case <-peer.getBlocks:
+		t.Fatal("getblocks sent after a partial batch")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestDownloadProgressEstimate ensures the download progress is estimated using
+// the latest checkpoint before a sync peer is chosen and using the height of
+// the sync peer afterwards.
+func TestDownloadProgressEstimate(t *testing.T) {
+	// Create a chain of blocks to checkpoint using a separate chain.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 4; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+	checkpoints := []chaincfg.Checkpoint{{Height: 4, Hash: blocks[3].Hash()}}
+
+	// Without checkpoints or a sync peer, no blocks are known to be
+	// missing.
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	if got := ctx.sm.downloadProgressEstimate(); got != 100 {
+		t.Fatalf("progress without a target is %v, want 100", got)
+	}
+
+	ctx = newTestContextWithConfig(t,
+		newTestConfigWithCheckpoints(t, checkpoints))
+	if got := ctx.sm.downloadProgressEstimate(); got != 0 {
+		t.Fatalf("progress at genesis is %v, want 0", got)
+	}
+	_, _, err := ctx.chain.ProcessBlock(blocks[0], blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	if got := ctx.sm.downloadProgressEstimate(); got != 25 {
+		t.Fatalf("progress without a sync peer is %v, want 25", got)
+	}
+
+	// The height of the sync peer is preferred over the checkpoint.
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	peer.UpdateLastBlockHeight(8)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	if ctx.sm.syncPeer != peer.Peer {
+		t.Fatal("peer not chosen as the sync peer")
+	}
+	if got := ctx.sm.downloadProgressEstimate(); got != 12.5 {
+		t.Fatalf("progress with a sync peer is %v, want 12.5", got)
+	}
+	for _, block := range blocks[1:] {
+		_, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+	}
+	if got := ctx.sm.downloadProgressEstimate(); got != 50 {
+		t.Fatalf("progress with a sync peer is %v, want 50", got)
+	}
+}
+
+// TestMaxSyncCandidates ensures only the configured number of sync candidates
+// are tracked, the sync peer is chosen from them, untracked candidates are
+// considered once tracked candidates disconnect, and candidates are ranked by
+// the progress they have proven rather than the height they advertise.
+func TestMaxSyncCandidates(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.MaxSyncCandidates = 2
+	ctx := newTestContextWithConfig(t, cfg)
+
+	high := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	low := newTestPeer(t, ctx.params, "127.0.0.1:18445", true)
+	mid := newTestPeer(t, ctx.params, "127.0.0.1:18446", true)
+	high.UpdateLastBlockHeight(5)
+	low.UpdateLastBlockHeight(1)
+	mid.UpdateLastBlockHeight(3)
+
+	ctx.sm.handleNewPeerMsg(high.Peer)
+	if ctx.sm.syncPeer != high.Peer {
+		t.Fatalf("sync peer is %v, want %v", ctx.sm.syncPeer, high.Peer)
+	}
+
+	// Once the limit is reached, a candidate that advertises more blocks
+	// doesn't replace a tracked candidate since it has proven nothing.
+	ctx.sm.handleNewPeerMsg(low.Peer)
+	ctx.sm.handleNewPeerMsg(mid.Peer)
+	if ctx.sm.syncCandidates.Len() != 2 {
+		t.Fatalf("tracking %d candidates, want 2",
+			ctx.sm.syncCandidates.Len())
+	}
+	if ctx.sm.peerStates[low.Peer].candidate == nil {
+		t.Fatal("tracked candidate replaced by an unproven one")
+	}
+	if ctx.sm.peerStates[mid.Peer].candidate != nil {
+		t.Fatal("candidate tracked beyond the limit")
+	}
+
+	// Losing the sync peer starts tracking the previously untracked
+	// candidate and, since neither has proven any progress, chooses the
+	// one advertising the most blocks.
+	ctx.sm.handleDonePeerMsg(high.Peer)
+	if ctx.sm.syncPeer != mid.Peer {
+		t.Fatalf("sync peer is %v, want %v", ctx.sm.syncPeer, mid.Peer)
+	}
+	if ctx.sm.peerStates[mid.Peer].candidate == nil {
+		t.Fatal("untracked candidate not tracked after a slot was freed")
+	}
+
+	// A candidate that proved more progress outranks one that only
+	// advertises more blocks.
+	ctx.sm.noteVerifiedHeight(low.Peer, 1)
+	peer, _ := ctx.sm.pickSyncCandidate(0, false)
+	if peer != low.Peer {
+		t.Fatalf("picked sync candidate %v, want %v", peer, low.Peer)
+	}
+}
+
+// addrSyncPeerSelector is a SyncPeerSelector that selects the candidate with
+// a given address and records the candidates it was passed.
+type addrSyncPeerSelector struct {
+	addr       string
+	candidates []*peerpkg.Peer
+}
+
+// SelectSyncPeer returns the candidate with the selector's address.  It is
+// part of the SyncPeerSelector interface implementation.
+func (s *addrSyncPeerSelector) SelectSyncPeer(candidates []*peerpkg.Peer,
+	_ int32) *peerpkg.Peer {
+
+	s.candidates = candidates
+	for _, peer := range candidates {
+		if peer.Addr() == s.addr {
+			return peer
+		}
+	}
+	return nil
+}
+
+// TestSyncPeerSelector ensures a custom sync peer selector chooses the sync
+// peer among the eligible candidates with the most blocks.
+func TestSyncPeerSelector(t *testing.T) {
+	selector := &addrSyncPeerSelector{addr: "127.0.0.1:18447"}
+	cfg := newTestConfig(t)
+	cfg.SyncPeerSelector = selector
+	ctx := newTestContextWithConfig(t, cfg)
+
+	first := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	low := newTestPeer(t, ctx.params, "127.0.0.1:18445", true)
+	other := newTestPeer(t, ctx.params, "127.0.0.1:18446", true)
+	wanted := newTestPeer(t, ctx.params, "127.0.0.1:18447", true)
+	first.UpdateLastBlockHeight(5)
+	low.UpdateLastBlockHeight(1)
+	other.UpdateLastBlockHeight(3)
+	wanted.UpdateLastBlockHeight(3)
+
+	ctx.sm.handleNewPeerMsg(first.Peer)
+	if ctx.sm.syncPeer != first.Peer {
+		t.Fatalf("sync peer is %v, want %v", ctx.sm.syncPeer, first.Peer)
+	}
+	ctx.sm.handleNewPeerMsg(low.Peer)
+	ctx.sm.handleNewPeerMsg(other.Peer)
+	ctx.sm.handleNewPeerMsg(wanted.Peer)
+
+	// Losing the sync peer leaves two candidates with the most blocks, of
+	// which the selector picks the one with its address.
+	ctx.sm.handleDonePeerMsg(first.Peer)
+	if ctx.sm.syncPeer != wanted.Peer {
+		t.Fatalf("sync peer is %v, want %v", ctx.sm.syncPeer, wanted.Peer)
+	}
+	if len(selector.candidates) != 2 {
+		t.Fatalf("selector passed %d candidates, want 2",
+			len(selector.candidates))
+	}
+	for _, peer := range selector.candidates {
+		if peer != other.Peer && peer != wanted.Peer {
+			t.Fatalf("selector passed unexpected candidate %v", peer)
+		}
+	}
+}
+
+// TestDiverseSyncPeer ensures sync candidates in a network group not shared
+// with other connected peers are preferred when choosing the sync peer and
+// that all candidates are considered when none are in a distinct group.
+func TestDiverseSyncPeer(t *testing.T) {
+	selector := &addrSyncPeerSelector{addr: "1.2.3.4:18444"}
+	cfg := newTestConfig(t)
+	cfg.SyncPeerSelector = selector
+	cfg.DiverseSyncPeer = true
+	ctx := newTestContextWithConfig(t, cfg)
+
+	first := newTestPeer(t, ctx.params, "5.6.7.8:18444", true)
+	shared := newTestPeer(t, ctx.params, "1.2.3.4:18444", true)
+	sameGroup := newTestPeer(t, ctx.params, "1.2.5.6:18444", true)
+	distinct := newTestPeer(t, ctx.params, "9.9.9.9:18444", true)
+	first.UpdateLastBlockHeight(5)
+	shared.UpdateLastBlockHeight(3)
+	sameGroup.UpdateLastBlockHeight(3)
+	distinct.UpdateLastBlockHeight(3)
+
+	ctx.sm.handleNewPeerMsg(first.Peer)
+	ctx.sm.handleNewPeerMsg(shared.Peer)
+	ctx.sm.handleNewPeerMsg(sameGroup.Peer)
+	ctx.sm.handleNewPeerMsg(distinct.Peer)
+	if ctx.sm.netGroups["1.2.0.0"] != 2 {
+		t.Fatalf("network group has %d peers, want 2",
+			ctx.sm.netGroups["1.2.0.0"])
+	}
+
+	// Losing the sync peer leaves three candidates with the most blocks,
+	// of which only one is in a distinct network group.
+	ctx.sm.handleDonePeerMsg(first.Peer)
+	if ctx.sm.syncPeer != distinct.Peer {
+		t.Fatalf("sync peer is %v, want %v", ctx.sm.syncPeer,
+			distinct.Peer)
+	}
+	if _, exists := ctx.sm.netGroups["5.6.0.0"]; exists {
+		t.Fatal("network group of lost peer still tracked")
+	}
+
+	// The remaining candidates share a network group, so the selector
+	// chooses among all of them.
+	ctx.sm.handleDonePeerMsg(distinct.Peer)
+	if ctx.sm.syncPeer != shared.Peer {
+		t.Fatalf("sync peer is %v, want %v", ctx.sm.syncPeer,
+			shared.Peer)
+	}
+	if len(selector.candidates) != 2 {
+		t.Fatalf("selector passed %d candidates, want 2",
+			len(selector.candidates))
+	}
+}
+
+// TestCandidateSummary ensures the logged summary of the sync candidates
+// reflects the current candidate set and sync peer.
+func TestCandidateSummary(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	if ctx.sm.summaryInterval != defaultCandidateSummaryInterval {
+		t.Fatalf("default candidate summary interval %v, want %v",
+			ctx.sm.summaryInterval, defaultCandidateSummaryInterval)
+	}
+
+	summary := ctx.sm.candidateSummary()
+	if summary.candidates != 0 || summary.syncPeer != nil {
+		t.Fatalf("unexpected summary without peers: %v", summary)
+	}
+	if got, want := summary.String(), "0 sync candidates, sync peer none"; got != want {
+		t.Fatalf("summary is %q, want %q", got, want)
+	}
+
+	high := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	low := newTestPeer(t, ctx.params, "127.0.0.1:18445", true)
+	mid := newTestPeer(t, ctx.params, "127.0.0.1:18446", true)
+	high.UpdateLastBlockHeight(5)
+	low.UpdateLastBlockHeight(1)
+	mid.UpdateLastBlockHeight(3)
+	ctx.sm.handleNewPeerMsg(high.Peer)
+	ctx.sm.handleNewPeerMsg(low.Peer)
+	ctx.sm.handleNewPeerMsg(mid.Peer)
+
+	summary = ctx.sm.candidateSummary()
+	if summary.candidates != 3 || summary.minHeight != 1 ||
+		summary.maxHeight != 5 || summary.syncPeer != high.Peer {
+
+		t.Fatalf("unexpected summary: %v", summary)
+	}
+	want := fmt.Sprintf("3 sync candidates (heights 1-5), sync peer %s "+
+		"(height 5)", high.Peer)
+	if got := summary.String(); got != want {
+		t.Fatalf("summary is %q, want %q", got, want)
+	}
+
+	// The summary follows the candidates as they disconnect.
+	ctx.sm.handleDonePeerMsg(high.Peer)
+	ctx.sm.handleDonePeerMsg(low.Peer)
+	summary = ctx.sm.candidateSummary()
+	if summary.candidates != 1 || summary.minHeight != 3 ||
+		summary.maxHeight != 3 || summary.syncPeer != mid.Peer {
+
+		t.Fatalf("unexpected summary: %v", summary)
+	}
+}
+
+// TestSyncPeerSwitch ensures a candidate that proves it is markedly better
+// than the sync peer becomes the new sync peer while one that merely claims to
+// be is ignored, that the blocks in flight from the previous sync peer are left
+// to arrive, and that switches are rate limited.
+func TestSyncPeerSwitch(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+
+	slow := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	slow.UpdateLastBlockHeight(10)
+	ctx.sm.handleNewPeerMsg(slow.Peer)
+	if ctx.sm.syncPeer != slow.Peer {
+		t.Fatalf("sync peer is %v, want %v", ctx.sm.syncPeer, slow.Peer)
+	}
+
+	// Simulate a block in flight from the sync peer.
+	inFlight := chainhash.Hash{0x01}
+	ctx.sm.requestedBlocks[inFlight] = struct{}{}
+	ctx.sm.peerStates[slow.Peer].requestedBlocks[inFlight] = struct{}{}
+
+	// A candidate that only advertises a far greater height does not
+	// replace the sync peer.
+	liar := newTestPeer(t, ctx.params, "127.0.0.1:18445", true)
+	liar.UpdateLastBlockHeight(10 + 100*syncPeerHeightMargin)
+	ctx.sm.handleNewPeerMsg(liar.Peer)
+	ctx.sm.handleStallSample()
+	if ctx.sm.syncPeer != slow.Peer {
+		t.Fatalf("sync peer is %v, want %v", ctx.sm.syncPeer, slow.Peer)
+	}
+
+	// A candidate that has not proven to be sufficiently better does not
+	// replace the sync peer.
+	near := newTestPeer(t, ctx.params, "127.0.0.1:18446", true)
+	ctx.sm.handleNewPeerMsg(near.Peer)
+	ctx.sm.noteVerifiedHeight(near.Peer, syncPeerHeightMargin)
+	ctx.sm.handleStallSample()
+	if ctx.sm.syncPeer != slow.Peer {
+		t.Fatalf("sync peer is %v, want %v", ctx.sm.syncPeer, slow.Peer)
+	}
+
+	// A candidate that proved to be markedly better becomes the sync peer
+	// and the download continues from it.
+	fast := newTestPeer(t, ctx.params, "127.0.0.1:18447", true)
+	ctx.sm.handleNewPeerMsg(fast.Peer)
+	ctx.sm.noteVerifiedHeight(fast.Peer, syncPeerHeightMargin+1)
+	ctx.sm.handleStallSample()
+	if ctx.sm.syncPeer != fast.Peer {
+		t.Fatalf("sync peer is %v, want %v", ctx.sm.syncPeer, fast.Peer)
+	}
+	select {
+	case msg := <-fast.getBlocks:
+		if msg.HashStop != zeroHash {
+			t.Fatalf("getblocks stop hash is %v, want %v",
+				msg.HashStop, zeroHash)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for getblocks")
+	}
+
+	// The block in flight from the previous sync peer is left to arrive
+	// with the new sync peer as a fallback.
+	if _, ok := ctx.sm.requestedBlocks[inFlight]; !ok {
+		t.Fatal("block in flight from previous sync peer no longer " +
+			"requested")
+	}
+	if _, ok := ctx.sm.peerStates[slow.Peer].requestedBlocks[inFlight]; !ok {
+		t.Fatal("block in flight from previous sync peer not accepted")
+	}
+	alternates := ctx.sm.blockAlternates[inFlight]
+	if len(alternates) != 1 || alternates[0] != fast.Peer {
+		t.Fatalf("alternates of block in flight are %v, want %v",
+			alternates, fast.Peer)
+	}
+
+	// A candidate measured to deliver blocks markedly faster is not
+	// switched to within the switch interval, but is once it elapses.
+	faster := newTestPeer(t, ctx.params, "127.0.0.1:18448", true)
+	ctx.sm.handleNewPeerMsg(faster.Peer)
+	fastState := ctx.sm.peerStates[fast.Peer]
+	fasterState := ctx.sm.peerStates[faster.Peer]
+	for i := 0; i < minDeliverySamples; i++ {
+		noteBlockDelivery(fastState, 400*time.Millisecond)
+		noteBlockDelivery(fasterState, 100*time.Millisecond)
+	}
+	fasterState.verifiedHeight = fastState.verifiedHeight
+	ctx.sm.handleStallSample()
+	if ctx.sm.syncPeer != fast.Peer {
+		t.Fatalf("sync peer is %v, want %v", ctx.sm.syncPeer, fast.Peer)
+	}
+	ctx.sm.lastSyncPeerSwitch = time.Now().Add(-ctx.sm.switchInterval)
+	ctx.sm.handleStallSample()
+	if ctx.sm.syncPeer != faster.Peer {
+		t.Fatalf("sync peer is %v, want %v", ctx.sm.syncPeer, faster.Peer)
+	}
+}
+
+// TestRequestPeersWhenStalled ensures more peers are requested when the sync
+// peer is lost during the initial block download and no other candidates
+// remain.
+func TestRequestPeersWhenStalled(t *testing.T) {
+	var requests int
+	cfg := newTestConfig(t)
+	cfg.RequestPeers = func() { requests++ }
+	ctx := newTestContextWithConfig(t, cfg)
+
+	peerA := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	peerB := newTestPeer(t, ctx.params, "127.0.0.1:18445", true)
+	ctx.sm.handleNewPeerMsg(peerA.Peer)
+	ctx.sm.handleNewPeerMsg(peerB.Peer)
+	if ctx.sm.syncPeer != peerA.Peer {
+		t.Fatalf("sync peer is %v, want %v", ctx.sm.syncPeer, peerA.Peer)
+	}
+
+	// Losing the sync peer while another candidate remains switches to it
+	// without requesting more peers.
+	ctx.sm.handleDonePeerMsg(peerA.Peer)
+	if ctx.sm.syncPeer != peerB.Peer {
+		t.Fatalf("sync peer is %v, want %v", ctx.sm.syncPeer, peerB.Peer)
+	}
+	if requests != 0 {
+		t.Fatalf("got %d peer requests, want 0", requests)
+	}
+
+	// Losing the final candidate requests more peers.
+	ctx.sm.handleDonePeerMsg(peerB.Peer)
+	if ctx.sm.syncPeer != nil {
+		t.Fatalf("unexpected sync peer %v", ctx.sm.syncPeer)
+	}
+	if requests != 1 {
+		t.Fatalf("got %d peer requests, want 1", requests)
+	}
+}
+
+// TestBlockLookups ensures block heights and hashes are looked up from the main
+// chain and that orphan and unknown blocks are reported distinctly.
+func TestBlockLookups(t *testing.T) {
+	// Create a chain of blocks using a separate chain so the last one can
+	// be made an orphan.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 4; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	for _, block := range blocks[:2] {
+		_, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+	}
+	_, isOrphan, err := ctx.chain.ProcessBlock(blocks[3], blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	if !isOrphan {
+		t.Fatal("block not processed as an orphan")
+	}
+
+	for i, block := range blocks[:2] {
+		height, err := ctx.sm.BlockHeightByHash(block.Hash())
+		if err != nil {
+			t.Fatalf("unable to look up height of %v: %v",
+				block.Hash(), err)
+		}
+		if height != int32(i+1) {
+			t.Fatalf("got height %d, want %d", height, i+1)
+		}
+
+		hash, err := ctx.sm.BlockHashByHeight(height)
+		if err != nil {
+			t.Fatalf("unable to look up hash at height %d: %v",
+				height, err)
+		}
+		if *hash != *block.Hash() {
+			t.Fatalf("got hash %v, want %v", hash, block.Hash())
+		}
+	}
+
+	_, err = ctx.sm.BlockHeightByHash(blocks[3].Hash())
+	if !errors.Is(err, ErrOrphanBlock) {
+		t.Fatalf("got error %v for orphan, want %v", err, ErrOrphanBlock)
+	}
+	_, err = ctx.sm.BlockHeightByHash(blocks[2].Hash())
+	if !errors.Is(err, ErrBlockNotFound) {
+		t.Fatalf("got error %v for unknown block, want %v", err,
+			ErrBlockNotFound)
+	}
+	_, err = ctx.sm.BlockHashByHeight(3)
+	if !errors.Is(err, ErrBlockNotFound) {
+		t.Fatalf("got error %v for unknown height, want %v", err,
+			ErrBlockNotFound)
+	}
+}
+
+// waitForRejects sends a ping from the local peer and waits for the remote
+// peer to receive it.  Messages from a peer are delivered in order, so all
+// reject messages sent before the ping have been received once it arrives.
+// It returns the number of reject messages received.
+func (p *testPeer) waitForRejects(t *testing.T) int {
+	t.Helper()
+
+	p.QueueMessage(wire.NewMsgPing(0), nil)
+	select {
+	case <-p.pings:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for ping")
+	}
+	return len(p.rejects)
+}
+
+// TestGetMempoolTx ensures transactions in the transaction pool can be looked
+// up by hash and that transactions not in the pool are reported as not found.
+func TestGetMempoolTx(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+
+	// Mine enough blocks for the coinbase of the first one to mature.
+	var blocks []*btcutil.Block
+	for i := int32(0); i <= int32(ctx.params.CoinbaseMaturity); i++ {
+		block := ctx.createBlock(t)
+		_, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	// Spend the matured coinbase with a standard transaction.
+	coinbase := blocks[0].Transactions()[0]
+	sigScript, err := txscript.NewScriptBuilder().
+		AddData(opTrueScript).Script()
+	if err != nil {
+		t.Fatalf("unable to create signature script: %v", err)
+	}
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(coinbase.Hash(), 0),
+		SignatureScript:  sigScript,
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	msgTx.AddTxOut(&wire.TxOut{
+		Value:    coinbase.MsgTx().TxOut[0].Value - 10000,
+		PkScript: opTrueP2SHScript(t, ctx.params),
+	})
+	tx := btcutil.NewTx(msgTx)
+
+	if _, ok := ctx.sm.GetMempoolTx(tx.Hash()); ok {
+		t.Fatal("transaction found before it was added to the pool")
+	}
+	_, _, err = ctx.sm.txMemPool.MaybeAcceptTransaction(tx, true, false)
+	if err != nil {
+		t.Fatalf("unable to add transaction to the pool: %v", err)
+	}
+	got, ok := ctx.sm.GetMempoolTx(tx.Hash())
+	if !ok {
+		t.Fatal("transaction not found in the pool")
+	}
+	if *got.Hash() != *tx.Hash() {
+		t.Fatalf("got transaction %v, want %v", got.Hash(), tx.Hash())
+	}
+}
+
+// TestMedianTimePast ensures the median time past of the chain tip is the
+// median timestamp of the last 11 blocks and is updated as the tip changes.
+func TestMedianTimePast(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+
+	// Extend the chain with blocks whose timestamps are not in order.
+	base := time.Unix(time.Now().Add(-2*time.Hour).Unix(), 0)
+	offsets := []int{10, 20, 15, 40, 30, 50, 45, 70, 60, 90, 80, 100, 95}
+	var timestamps []time.Time
+	for _, offset := range offsets {
+		msgBlock := ctx.createBlock(t).MsgBlock()
+		msgBlock.Header.Timestamp = base.Add(
+			time.Duration(offset) * time.Minute)
+		block := solveBlock(msgBlock)
+		_, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		timestamps = append(timestamps, msgBlock.Header.Timestamp)
+
+		if len(timestamps) < 11 {
+			continue
+		}
+		recent := append([]time.Time(nil),
+			timestamps[len(timestamps)-11:]...)
+		sort.Slice(recent, func(i, j int) bool {
+			return recent[i].Before(recent[j])
+		})
+		if got := ctx.sm.MedianTimePast(); !got.Equal(recent[5]) {
+			t.Fatalf("median time past at height %d is %v, want %v",
+				len(timestamps), got, recent[5])
+		}
+	}
+}
+
+// TestDuplicateBlockFromPeers ensures a block delivered by a second peer right
+// after it was processed from another peer is not processed again, while
+// repeat deliveries from the same peer still are.
+func TestDuplicateBlockFromPeers(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+
+	peerA := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	peerB := newTestPeer(t, ctx.params, "127.0.0.1:18445", true)
+	ctx.sm.handleNewPeerMsg(peerA.Peer)
+	ctx.sm.handleNewPeerMsg(peerB.Peer)
+
+	// Deliver the same block from both peers as if both were asked for it.
+	block := ctx.createBlock(t)
+	deliver := func(peer *testPeer) {
+		ctx.sm.peerStates[peer.Peer].requestedBlocks[*block.Hash()] = struct{}{}
+		ctx.sm.handleBlockMsg(&blockMsg{block: block, peer: peer.Peer})
+	}
+	deliver(peerA)
+	if ctx.chain.BestSnapshot().Hash != *block.Hash() {
+		t.Fatal("block from first peer not processed")
+	}
+
+	// Processing the block again would reject it as a duplicate, so the
+	// absence of a reject message shows it was not processed.
+	deliver(peerB)
+	if n := peerB.waitForRejects(t); n != 0 {
+		t.Fatalf("duplicate block from second peer processed %d times", n)
+	}
+	if _, ok := ctx.sm.peerStates[peerB.Peer].requestedBlocks[*block.Hash()]; ok {
+		t.Fatal("duplicate block still requested from second peer")
+	}
+
+	deliver(peerA)
+	if n := peerA.waitForRejects(t); n != 1 {
+		t.Fatalf("got %d rejects for repeated block from same peer, "+
+			"want 1", n)
+	}
+}
+
+// TestMutatedBlockFromPeer ensures a mutated copy of a block with a valid
+// header that is rejected does not get the genuine block from another peer
+// ignored.
+func TestMutatedBlockFromPeer(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+
+	peerA := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	peerB := newTestPeer(t, ctx.params, "127.0.0.1:18445", true)
+	ctx.sm.handleNewPeerMsg(peerA.Peer)
+	ctx.sm.handleNewPeerMsg(peerB.Peer)
+
+	// Changing the coinbase leaves the header, and thus the hash, intact
+	// while the merkle root no longer matches.
+	block := ctx.createBlock(t)
+	mutatedMsg := *block.MsgBlock()
+	coinbase := mutatedMsg.Transactions[0].Copy()
+	coinbase.TxIn[0].SignatureScript = append(
+		coinbase.TxIn[0].SignatureScript, 0x00)
+	mutatedMsg.Transactions = append([]*wire.MsgTx{coinbase},
+		mutatedMsg.Transactions[1:]...)
+	mutated := btcutil.NewBlock(&mutatedMsg)
+	if *mutated.Hash() != *block.Hash() {
+		t.Fatal("mutated block hash differs")
+	}
+
+	deliver := func(peer *testPeer, b *btcutil.Block) {
+		ctx.sm.peerStates[peer.Peer].requestedBlocks[*b.Hash()] = struct{}{}
+		ctx.sm.handleBlockMsg(&blockMsg{block: b, peer: peer.Peer})
+	}
+	deliver(peerA, mutated)
+	if n := peerA.waitForRejects(t); n != 1 {
+		t.Fatalf("got %d rejects for mutated block, want 1", n)
+	}
+	deliver(peerB, block)
+	if best := ctx.chain.BestSnapshot(); best.Hash != *block.Hash() {
+		t.Fatalf("best chain tip is %v, want %v", best.Hash, block.Hash())
+	}
+}
+
+// TestCancelSync ensures cancelling the sync clears the sync peer without
+// forgetting the sync candidates, that blocks already requested are still
+// accepted, that responses to outstanding requests from the cancelled sync
+// peer don't get it disconnected, and that syncing can be resumed.
+func TestCancelSync(t *testing.T) {
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	block := src.createBlock(t)
+
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	peer.UpdateLastBlockHeight(5)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	if ctx.sm.syncPeer != peer.Peer {
+		t.Fatalf("sync peer is %v, want %v", ctx.sm.syncPeer, peer.Peer)
+	}
+
+	// Simulate a block that is in flight when the sync is cancelled.
+	state := ctx.sm.peerStates[peer.Peer]
+	state.requestedBlocks[*block.Hash()] = struct{}{}
+	ctx.sm.requestedBlocks[*block.Hash()] = struct{}{}
+
+	ctx.sm.cancelSync()
+	if ctx.sm.syncPeer != nil {
+		t.Fatalf("sync peer is %v after cancelling", ctx.sm.syncPeer)
+	}
+	if ctx.sm.peerStates[peer.Peer].candidate == nil {
+		t.Fatal("sync candidate forgotten after cancelling")
+	}
+
+	// No sync peer is chosen while the sync is cancelled.
+	other := newTestPeer(t, ctx.params, "127.0.0.1:18445", true)
+	other.UpdateLastBlockHeight(5)
+	ctx.sm.handleNewPeerMsg(other.Peer)
+	if ctx.sm.syncPeer != nil {
+		t.Fatalf("sync peer %v chosen while cancelled", ctx.sm.syncPeer)
+	}
+
+	// The block requested before cancelling is accepted and headers
+	// requested before cancelling are ignored.
+	ctx.sm.handleBlockMsg(&blockMsg{block: block, peer: peer.Peer})
+	if best := ctx.chain.BestSnapshot(); best.Hash != *block.Hash() {
+		t.Fatalf("best chain tip is %v, want %v", best.Hash, block.Hash())
+	}
+	ctx.sm.handleHeadersMsg(&headersMsg{
+		headers: wire.NewMsgHeaders(),
+		peer:    peer.Peer,
+	})
+	if !peer.Connected() {
+		t.Fatal("cancelled sync peer disconnected")
+	}
+
+	ctx.sm.resumeSync()
+	if ctx.sm.syncPeer == nil {
+		t.Fatal("no sync peer chosen after resuming")
+	}
+}
+
+// TestSetVerify ensures script verification of received blocks can be disabled
+// and enabled again at runtime, that blocks processed afterwards honor the new
+// setting, that blocks whose scripts were skipped are neither marked valid nor
+// relayed, and that verification can't be disabled on public networks.
+func TestSetVerify(t *testing.T) {
+	// Create a chain in which the coinbases of the first two blocks are
+	// spent by transactions with failing scripts once they mature using a
+	// separate chain that doesn't execute scripts.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	addBlock := func(block *btcutil.Block) {
+		_, _, err := src.chain.ProcessBlock(block,
+			blockchain.BFNoScriptCheck)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+	for i := 0; i <= int(src.params.CoinbaseMaturity); i++ {
+		addBlock(src.createBlock(t))
+	}
+	addBlock(src.createBadScriptBlock(t, blocks[0]))
+	addBlock(src.createBadScriptBlock(t, blocks[1]))
+
+	cfg := newTestConfig(t)
+	cfg.RelayWhileSyncing = true
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.Start()
+	defer ctx.sm.Stop()
+	ctx.sm.NewPeer(peer.Peer)
+	queueBlock := func(block *btcutil.Block) {
+		done := make(chan struct{}, 1)
+		ctx.sm.QueueBlock(block, peer.Peer, done)
+		<-done
+	}
+
+	// The first block with a failing script is accepted while verification
+	// is disabled, but it is neither marked valid nor relayed.
+	ctx.sm.SetVerify(false)
+	for _, block := range blocks[:len(blocks)-1] {
+		queueBlock(block)
+	}
+	wantTip := blocks[len(blocks)-2].Hash()
+	if best := ctx.chain.BestSnapshot(); best.Hash != *wantTip {
+		t.Fatalf("best chain tip is %v at height %d, want %v",
+			best.Hash, best.Height, wantTip)
+	}
+	_, err := ctx.chain.HeightToHashRange(0, wantTip, len(blocks))
+	if err == nil {
+		t.Fatal("block with skipped scripts marked valid")
+	}
+	ctx.notifier.mtx.Lock()
+	relayed := len(ctx.notifier.relayed)
+	ctx.notifier.mtx.Unlock()
+	if relayed != 0 {
+		t.Fatalf("relayed %d blocks with skipped scripts", relayed)
+	}
+
+	// The second one is rejected once verification is enabled again.
+	ctx.sm.SetVerify(true)
+	queueBlock(blocks[len(blocks)-1])
+	if best := ctx.chain.BestSnapshot(); best.Hash != *wantTip {
+		t.Fatalf("best chain tip is %v at height %d, want %v",
+			best.Hash, best.Height, wantTip)
+	}
+
+	// Verification can't be disabled on the main network.
+	mainCfg := newTestConfig(t)
+	mainCfg.ChainParams = &chaincfg.MainNetParams
+	mainCfg.DisableVerify = true
+	main := newTestContextWithConfig(t, mainCfg)
+	if main.sm.disableVerify {
+		t.Fatal("verification disabled on the main network")
+	}
+	main.sm.setVerify(false)
+	if main.sm.disableVerify {
+		t.Fatal("verification disabled at runtime on the main network")
+	}
+}
+
+// TestUnrequestedBlock ensures peers sending blocks that were not requested
+// from them are penalized unless the blocks extend the best chain, and that
+// they are disconnected when no ban score handler is configured.
+func TestUnrequestedBlock(t *testing.T) {
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 3; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	type banScore struct {
+		peer      *peerpkg.Peer
+		transient uint32
+	}
+	var scores []banScore
+	cfg := newTestConfig(t)
+	cfg.AddBanScore = func(peer *peerpkg.Peer, persistent,
+		transient uint32, reason string) {
+
+		scores = append(scores, banScore{peer, transient})
+	}
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+
+	// A block that does not extend the best chain is ignored and the peer
+	// is penalized.
+	ctx.sm.handleBlockMsg(&blockMsg{block: blocks[1], peer: peer.Peer})
+	if ctx.chain.BestSnapshot().Height != 0 || ctx.chain.IsKnownOrphan(
+		blocks[1].Hash()) {
+
+		t.Fatal("unrequested block was processed")
+	}
+	if len(scores) != 1 || scores[0].peer != peer.Peer ||
+		scores[0].transient != unrequestedBlockBanScore {
+
+		t.Fatalf("unexpected ban scores %v", scores)
+	}
+
+	// A new block relayed on top of the best chain is processed without
+	// penalizing the peer.
+	ctx.sm.handleBlockMsg(&blockMsg{block: blocks[0], peer: peer.Peer})
+	if best := ctx.chain.BestSnapshot(); best.Hash != *blocks[0].Hash() {
+		t.Fatalf("best chain tip is %v, want %v", best.Hash,
+			blocks[0].Hash())
+	}
+	if len(scores) != 1 {
+		t.Fatalf("unexpected ban scores %v", scores)
+	}
+	if !peer.Connected() {
+		t.Fatal("peer disconnected")
+	}
+
+	// Without a ban score handler the peer is disconnected instead.
+	ctx.sm.addBanScore = nil
+	ctx.sm.handleBlockMsg(&blockMsg{block: blocks[2], peer: peer.Peer})
+	if peer.Connected() {
+		t.Fatal("peer sending unrequested block not disconnected")
+	}
+}
+
+// TestSubstitutedBlock ensures a block sent in response to a request for a
+// different block is discarded and the peer penalized, while the requested
+// block remains in flight.
+func TestSubstitutedBlock(t *testing.T) {
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 3; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	var scores []uint32
+	cfg := newTestConfig(t)
+	cfg.AddBanScore = func(peer *peerpkg.Peer, persistent,
+		transient uint32, reason string) {
+
+		scores = append(scores, transient)
+	}
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+
+	// Request the first block and have the peer respond with another one.
+	requested := *blocks[0].Hash()
+	state := ctx.sm.peerStates[peer.Peer]
+	state.requestedBlocks[requested] = struct{}{}
+	ctx.sm.requestedBlocks[requested] = struct{}{}
+	ctx.sm.handleBlockMsg(&blockMsg{block: blocks[2], peer: peer.Peer})
+
+	if ctx.chain.BestSnapshot().Height != 0 || ctx.chain.IsKnownOrphan(
+		blocks[2].Hash()) {
+
+		t.Fatal("substituted block was processed")
+	}
+	if len(scores) != 1 || scores[0] != unrequestedBlockBanScore {
+		t.Fatalf("unexpected ban scores %v", scores)
+	}
+	if _, exists := state.requestedBlocks[requested]; !exists {
+		t.Fatal("requested block no longer in flight")
+	}
+	if _, exists := ctx.sm.requestedBlocks[requested]; !exists {
+		t.Fatal("requested block no longer in flight")
+	}
+}
+
+// TestLowWorkBlock ensures blocks whose proof of work falls short of the
+// difficulty expected at their height are ignored and the peer penalized with
+// a decaying score, while blocks whose parent is unknown only need to meet the
+// proof of work limit.
+func TestLowWorkBlock(t *testing.T) {
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 3; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	var persistent, transient []uint32
+	cfg := newTestConfig(t)
+	cfg.AddBanScore = func(peer *peerpkg.Peer, p, tr uint32,
+		reason string) {
+
+		persistent = append(persistent, p)
+		transient = append(transient, tr)
+	}
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+
+	// Find a nonce for the first block whose hash misses the target.
+	msgBlock := *blocks[0].MsgBlock()
+	target := blockchain.CompactToBig(msgBlock.Header.Bits)
+	for {
+		msgBlock.Header.Nonce++
+		hash := msgBlock.Header.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) > 0 {
+			break
+		}
+	}
+	weak := btcutil.NewBlock(&msgBlock)
+	ctx.sm.handleBlockMsg(&blockMsg{block: weak, peer: peer.Peer})
+	if ctx.chain.BestSnapshot().Height != 0 {
+		t.Fatal("block with insufficient proof of work was processed")
+	}
+	if len(transient) != 1 || transient[0] != lowWorkBlockBanScore ||
+		persistent[0] != 0 {
+
+		t.Fatalf("unexpected ban scores %v/%v", persistent, transient)
+	}
+
+	// Blocks meeting the expected difficulty are processed.
+	ctx.sm.handleBlockMsg(&blockMsg{block: blocks[0], peer: peer.Peer})
+	if best := ctx.chain.BestSnapshot(); best.Hash != *blocks[0].Hash() {
+		t.Fatalf("best chain tip is %v, want %v", best.Hash,
+			blocks[0].Hash())
+	}
+	if len(transient) != 1 {
+		t.Fatalf("unexpected ban scores %v/%v", persistent, transient)
+	}
+
+	// requestBlock marks the passed block as requested from the peer.
+	requestBlock := func(block *btcutil.Block) {
+		hash := *block.Hash()
+		ctx.sm.peerStates[peer.Peer].requestedBlocks[hash] = struct{}{}
+		ctx.sm.requestedBlocks[hash] = struct{}{}
+	}
+
+	// Blocks that don't extend the best chain must meet the difficulty
+	// expected after their parent as well.
+	requestBlock(weak)
+	ctx.sm.handleBlockMsg(&blockMsg{block: weak, peer: peer.Peer})
+	if len(transient) != 2 || transient[1] != lowWorkBlockBanScore {
+		t.Fatalf("unexpected ban scores %v/%v", persistent, transient)
+	}
+	if _, exists := ctx.sm.requestedBlocks[*weak.Hash()]; exists {
+		t.Fatal("block with insufficient proof of work still in flight")
+	}
+
+	// Blocks whose parent is unknown, such as historic blocks served out
+	// of order, are processed without penalty.
+	requestBlock(blocks[2])
+	ctx.sm.handleBlockMsg(&blockMsg{block: blocks[2], peer: peer.Peer})
+	if !ctx.chain.IsKnownOrphan(blocks[2].Hash()) {
+		t.Fatal("block with unknown parent was not processed")
+	}
+	if len(transient) != 2 {
+		t.Fatalf("unexpected ban scores %v/%v", persistent, transient)
+	}
+}
+
+// TestBehindGracePeriod ensures a sync candidate that is behind our best height
+// remains a candidate during the grace period so it can be chosen once it
+// catches up, and that it is dropped once the grace period has passed.
+func TestBehindGracePeriod(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Tuning.BehindGracePeriod = time.Hour
+	ctx := newTestContextWithConfig(t, cfg)
+	block := ctx.createBlock(t)
+	_, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+
+	// The peer is behind, so it is not chosen but remains a candidate.
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	state := ctx.sm.peerStates[peer.Peer]
+	if ctx.sm.syncPeer != nil {
+		t.Fatalf("sync peer %v chosen while behind", ctx.sm.syncPeer)
+	}
+	if !state.syncCandidate || state.behindSince.IsZero() {
+		t.Fatal("behind peer not kept as a candidate")
+	}
+
+	// The peer is chosen once it advertises a higher height within the
+	// grace period.
+	peer.UpdateLastBlockHeight(5)
+	ctx.sm.handleStallSample()
+	if ctx.sm.syncPeer != peer.Peer {
+		t.Fatalf("sync peer is %v, want %v", ctx.sm.syncPeer, peer.Peer)
+	}
+	if !state.behindSince.IsZero() {
+		t.Fatal("peer still tracked as behind after catching up")
+	}
+
+	// A peer that stays behind past the grace period is dropped.
+	other := newTestPeer(t, ctx.params, "127.0.0.1:18445", true)
+	ctx.sm.handleNewPeerMsg(other.Peer)
+	otherState := ctx.sm.peerStates[other.Peer]
+	ctx.sm.cancelSync()
+	ctx.sm.handleDonePeerMsg(peer.Peer)
+	otherState.behindSince = time.Now().Add(-2 * time.Hour)
+	ctx.sm.resumeSync()
+	if ctx.sm.syncPeer != nil {
+		t.Fatalf("sync peer %v chosen after grace period", ctx.sm.syncPeer)
+	}
+	if otherState.syncCandidate {
+		t.Fatal("behind peer still a candidate after grace period")
+	}
+}
+
+// TestChainParams ensures the chain parameters and network name reported by the
+// sync manager match the configured network.
+func TestChainParams(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+
+	if params := ctx.sm.ChainParams(); params != ctx.params {
+		t.Fatalf("chain params are %p, want %p", params, ctx.params)
+	}
+	if genesis := ctx.sm.ChainParams().GenesisHash; !genesis.IsEqual(
+		chaincfg.RegressionNetParams.GenesisHash) {
+
+		t.Fatalf("genesis hash is %v, want %v", genesis,
+			chaincfg.RegressionNetParams.GenesisHash)
+	}
+	if name := ctx.sm.NetworkName(); name != "regtest" {
+		t.Fatalf("network name is %q, want %q", name, "regtest")
+	}
+}
+
+// TestSubmitBlockBytes ensures serialized blocks are decoded and processed and
+// that malformed blocks are reported distinctly from blocks failing validation.
+func TestSubmitBlockBytes(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	ctx.sm.Start()
+	defer ctx.sm.Stop()
+
+	block := ctx.createBlock(t)
+	serialized, err := block.Bytes()
+	if err != nil {
+		t.Fatalf("unable to serialize block: %v", err)
+	}
+
+	submitted, isOrphan, err := ctx.sm.SubmitBlockBytes(
+		bytes.NewReader(serialized))
+	if err != nil {
+		t.Fatalf("unexpected error submitting block: %v", err)
+	}
+	if isOrphan || *submitted.Hash() != *block.Hash() {
+		t.Fatalf("submitted block %v (orphan %v), want %v",
+			submitted.Hash(), isOrphan, block.Hash())
+	}
+	if best := ctx.chain.BestSnapshot(); best.Hash != *block.Hash() {
+		t.Fatalf("best chain tip is %v, want %v", best.Hash, block.Hash())
+	}
+
+	// Truncated blocks are malformed.
+	_, _, err = ctx.sm.SubmitBlockBytes(
+		bytes.NewReader(serialized[:len(serialized)-1]))
+	if !errors.Is(err, ErrMalformedBlock) {
+		t.Fatalf("unexpected error submitting truncated block: %v", err)
+	}
+
+	// Submitting the block again decodes fine but fails validation.
+	_, _, err = ctx.sm.SubmitBlockBytes(bytes.NewReader(serialized))
+	var ruleErr blockchain.RuleError
+	if !errors.As(err, &ruleErr) || errors.Is(err, ErrMalformedBlock) {
+		t.Fatalf("unexpected error submitting duplicate block: %v", err)
+	}
+}
+
+// TestRelayMainChainOnly ensures blocks advancing the main chain tip are
+// relayed, side chain blocks are only relayed when relaying is not limited to
+// the main chain, and orphans are never relayed.
+func TestRelayMainChainOnly(t *testing.T) {
+	// resolve solves the passed block after its header was modified.
+	resolve := func(msgBlock *wire.MsgBlock) *btcutil.Block {
+		target := blockchain.CompactToBig(msgBlock.Header.Bits)
+		for {
+			hash := msgBlock.Header.BlockHash()
+			if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+				break
+			}
+			msgBlock.Header.Nonce++
+		}
+		return btcutil.NewBlock(msgBlock)
+	}
+
+	for _, mainChainOnly := range []bool{false, true} {
+		cfg := newTestConfig(t)
+		cfg.RelayMainChainOnly = mainChainOnly
+		ctx := newTestContextWithConfig(t, cfg)
+		peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+		ctx.sm.handleNewPeerMsg(peer.Peer)
+
+		// Create a block, a competing side chain block, and an orphan.
+		block := ctx.createBlock(t)
+		sideMsg := *block.MsgBlock()
+		sideMsg.Header.Timestamp = sideMsg.Header.Timestamp.Add(
+			time.Second)
+		side := resolve(&sideMsg)
+		orphanMsg := *block.MsgBlock()
+		orphanMsg.Header.PrevBlock = chainhash.Hash{0x01}
+		orphan := resolve(&orphanMsg)
+
+		for _, b := range []*btcutil.Block{block, side, orphan} {
+			_, _, err := ctx.chain.ProcessBlock(b, blockchain.BFNone)
+			if err != nil {
+				t.Fatalf("unable to process block: %v", err)
+			}
+		}
+		if !ctx.chain.IsKnownOrphan(orphan.Hash()) {
+			t.Fatal("orphan block not an orphan")
+		}
+
+		// Orphans must not be relayed even when a notification about
+		// them is received.
+		ctx.sm.handleBlockchainNotification(&blockchain.Notification{
+			Type: blockchain.NTBlockAccepted,
+			Data: orphan,
+		})
+
+		want := []*wire.InvVect{
+			wire.NewInvVect(wire.InvTypeBlock, block.Hash()),
+		}
+		if !mainChainOnly {
+			want = append(want, wire.NewInvVect(wire.InvTypeBlock,
+				side.Hash()))
+		}
+		ctx.notifier.mtx.Lock()
+		relayed := ctx.notifier.relayed
+		ctx.notifier.mtx.Unlock()
+		if !reflect.DeepEqual(relayed, want) {
+			t.Fatalf("main chain only %v: relayed %v, want %v",
+				mainChainOnly, relayed, want)
+		}
+	}
+}
+
+// TestLogAcceptedBlocks ensures each block connected to or disconnected from
+// the main chain is logged in order at the debug level when enabled and not
+// logged otherwise.
+func TestLogAcceptedBlocks(t *testing.T) {
+	var buf bytes.Buffer
+	logger := btclog.NewBackend(&buf).Logger("SYNC")
+	logger.SetLevel(btclog.LevelDebug)
+	UseLogger(logger)
+	defer DisableLog()
+
+	// Create a chain of blocks using a separate chain.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 3; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	// Create a longer fork from the second block using another chain.
+	// The first block of the fork differs from the last block above by
+	// its timestamp.
+	forkSrc := newTestContextWithConfig(t, newTestConfig(t))
+	for _, block := range blocks[:2] {
+		_, _, err := forkSrc.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+	}
+	msgBlock := *blocks[2].MsgBlock()
+	msgBlock.Header.Timestamp = msgBlock.Header.Timestamp.Add(time.Second)
+	fork := []*btcutil.Block{solveBlock(&msgBlock)}
+	_, _, err := forkSrc.chain.ProcessBlock(fork[0], blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	block := forkSrc.createBlock(t)
+	_, _, err = forkSrc.chain.ProcessBlock(block, blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	fork = append(fork, block)
+
+	accepted := func(block *btcutil.Block) string {
+		return fmt.Sprintf("Accepted block %v (height %d) to the main "+
+			"chain", block.Hash(), block.Height())
+	}
+	want := []string{
+		accepted(blocks[0]),
+		accepted(blocks[1]),
+		accepted(blocks[2]),
+		fmt.Sprintf("Disconnected block %v (height %d) from the main "+
+			"chain", blocks[2].Hash(), blocks[2].Height()),
+		accepted(fork[0]),
+		accepted(fork[1]),
+	}
+	for _, enabled := range []bool{false, true} {
+		cfg := newTestConfig(t)
+		cfg.LogAcceptedBlocks = enabled
+		ctx := newTestContextWithConfig(t, cfg)
+		buf.Reset()
+
+		for _, block := range append(blocks[:3:3], fork...) {
+			_, _, err := ctx.chain.ProcessBlock(block,
+				blockchain.BFNone)
+			if err != nil {
+				t.Fatalf("unable to process block: %v", err)
+			}
+		}
+
+		var got []string
+		for _, line := range strings.Split(buf.String(), "\n") {
+			for _, prefix := range []string{"Accepted block ",
+				"Disconnected block "} {
+
+				if i := strings.Index(line, prefix); i >= 0 {
+					got = append(got, line[i:])
+				}
+			}
+		}
+		wantLogged := want
+		if !enabled {
+			wantLogged = nil
+		}
+		if !reflect.DeepEqual(got, wantLogged) {
+			t.Fatalf("enabled %v: logged %q, want %q", enabled, got,
+				wantLogged)
+		}
+	}
+}
+
+// TestTipRelayDelay ensures tips accepted in quick succession are coalesced so
+// only the latest one is relayed and that the relay is never delayed past the
+// maximum delay.
+func TestTipRelayDelay(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.RelayWhileSyncing = true
+	cfg.TipRelayDelay = time.Hour
+	cfg.MaxTipRelayDelay = 50 * time.Millisecond
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+
+	var blocks []*btcutil.Block
+	for i := 0; i < 3; i++ {
+		block := ctx.createBlock(t)
+		_, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+	ctx.notifier.mtx.Lock()
+	relayed := len(ctx.notifier.relayed)
+	ctx.notifier.mtx.Unlock()
+	if relayed != 0 {
+		t.Fatalf("relayed %d blocks before the delay passed", relayed)
+	}
+
+	// The timer must fire by the maximum delay even though the delay
+	// itself is much longer.
+	select {
+	case <-ctx.sm.tipRelayTimer.C:
+	case <-time.After(5 * time.Second):
+		t.Fatal("tip relay delayed past the maximum delay")
+	}
+	ctx.sm.relayPendingTip()
+
+	want := []*wire.InvVect{
+		wire.NewInvVect(wire.InvTypeBlock, blocks[2].Hash()),
+	}
+	ctx.notifier.mtx.Lock()
+	defer ctx.notifier.mtx.Unlock()
+	if !reflect.DeepEqual(ctx.notifier.relayed, want) {
+		t.Fatalf("relayed %v, want %v", ctx.notifier.relayed, want)
+	}
+	if ctx.sm.pendingTip != nil || ctx.sm.tipRelayTimer != nil {
+		t.Fatal("tip still pending after it was relayed")
+	}
+}
+
+// TestTxRelayDelay ensures transactions are relayed once after the relay delay
+// even when they arrive from several peers, that they are only announced to the
+// peers that did not advertise them to us, that other clients are notified
+// right away and that transactions evicted during the delay are not relayed.
+func TestTxRelayDelay(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.TxRelayDelay = 50 * time.Millisecond
+	ctx := newTestContextWithConfig(t, cfg)
+	var peers []*testPeer
+	for i := 0; i < 3; i++ {
+		addr := fmt.Sprintf("127.0.0.1:%d", 18444+i)
+		peer := newTestPeer(t, ctx.params, addr, true)
+		ctx.sm.handleNewPeerMsg(peer.Peer)
+		peers = append(peers, peer)
+	}
+
+	// Mine enough blocks for the coinbase of the first one to mature.
+	var coinbase *btcutil.Tx
+	for i := 0; i <= int(ctx.params.CoinbaseMaturity); i++ {
+		block := ctx.createBlock(t)
+		_, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		if coinbase == nil {
+			coinbase = block.Transactions()[0]
+		}
+	}
+	sigScript, err := txscript.NewScriptBuilder().
+		AddData(opTrueScript).Script()
+	if err != nil {
+		t.Fatalf("unable to create signature script: %v", err)
+	}
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(coinbase.Hash(), 0),
+		sigScript, nil))
+	msgTx.AddTxOut(wire.NewTxOut(coinbase.MsgTx().TxOut[0].Value-10000,
+		opTrueP2SHScript(t, ctx.params)))
+	tx := btcutil.NewTx(msgTx)
+	iv := wire.NewInvVect(wire.InvTypeTx, tx.Hash())
+
+	// The child spends the transaction and is evicted before the delay
+	// passes.
+	childMsgTx := wire.NewMsgTx(wire.TxVersion)
+	childMsgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(tx.Hash(), 0),
+		sigScript, nil))
+	childMsgTx.AddTxOut(wire.NewTxOut(msgTx.TxOut[0].Value-10000,
+		opTrueP2SHScript(t, ctx.params)))
+	child := btcutil.NewTx(childMsgTx)
+
+	// relayedTxs returns the transactions relayed to peers.
+	relayedTxs := func() []chainhash.Hash {
+		ctx.notifier.mtx.Lock()
+		defer ctx.notifier.mtx.Unlock()
+		var relayed []chainhash.Hash
+		for _, iv := range ctx.notifier.relayed {
+			if iv.Type == wire.InvTypeTx {
+				relayed = append(relayed, iv.Hash)
+			}
+		}
+		return relayed
+	}
+
+	// The first two peers send the transaction at nearly the same time.
+	// The server adds it to their known inventory as it is read.  Other
+	// clients are notified of it right away while the relay to peers
+	// waits.
+	for _, peer := range peers[:2] {
+		peer.AddKnownInventory(iv)
+		ctx.sm.handleTxMsg(&txMsg{tx: tx, peer: peer.Peer,
+			reply: make(chan struct{}, 1)})
+	}
+	ctx.sm.handleTxMsg(&txMsg{tx: child, peer: peers[0].Peer,
+		reply: make(chan struct{}, 1)})
+	ctx.notifier.mtx.Lock()
+	announced := len(ctx.notifier.announced)
+	notified := len(ctx.notifier.notified)
+	ctx.notifier.mtx.Unlock()
+	if announced != 0 || len(relayedTxs()) != 0 {
+		t.Fatal("relayed transactions before the delay passed")
+	}
+	if notified != 2 {
+		t.Fatalf("notified %d transactions, want 2", notified)
+	}
+	ctx.sm.txMemPool.RemoveTransaction(child, false)
+
+	// The transactions were accepted at slightly different times, so
+	// their delays may pass separately.
+	for ctx.sm.txRelayTimer != nil {
+		select {
+		case <-ctx.sm.txRelayTimer.C:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for the transaction relay delay")
+		}
+		ctx.sm.relayPendingTxs()
+	}
+	if ctx.sm.pendingTxRelays != nil {
+		t.Fatal("transactions still pending after they were relayed")
+	}
+	relayed := relayedTxs()
+	if len(relayed) != 1 || relayed[0] != *tx.Hash() {
+		t.Fatalf("relayed transactions %v, want only %v", relayed,
+			tx.Hash())
+	}
+
+	// Relay the announcement to all peers the way the server does, twice.
+	// Only the peer that did not send the transaction is told about it
+	// and only once.
+	for i := 0; i < 2; i++ {
+		for _, peer := range peers {
+			peer.QueueInventory(iv)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	for i, peer := range peers {
+		var got int
+	drain:
+		for {
+			select {
+			case msg := <-peer.invs:
+				got += len(msg.InvList)
+			case <-time.After(50 * time.Millisecond):
+				break drain
+			}
+		}
+		want := 0
+		if i == 2 {
+			want = 1
+		}
+		if got != want {
+			t.Fatalf("peer %d got %d announcements, want %d", i, got,
+				want)
+		}
+	}
+}
+
+// TestReorgReplaysTxs ensures the transactions of blocks disconnected by a
+// reorganization are returned to the transaction pool unless they conflict with
+// a transaction of the new chain.
+func TestReorgReplaysTxs(t *testing.T) {
+	// Create two chains that share enough blocks for the coinbases of the
+	// first two blocks to mature and the chain under test.
+	oldChain := newTestContextWithConfig(t, newTestConfig(t))
+	newChain := newTestContextWithConfig(t, newTestConfig(t))
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	processBlock := func(block *btcutil.Block, ctxs ...*testContext) {
+		t.Helper()
+
+		for _, ctx := range ctxs {
+			_, _, err := ctx.chain.ProcessBlock(block,
+				blockchain.BFNone)
+			if err != nil {
+				t.Fatalf("unable to process block: %v", err)
+			}
+		}
+	}
+	var coinbases []*btcutil.Tx
+	for i := 0; i <= int(ctx.params.CoinbaseMaturity); i++ {
+		block := oldChain.createBlock(t)
+		processBlock(block, oldChain, newChain, ctx)
+		coinbases = append(coinbases, block.Transactions()[0])
+	}
+
+	sigScript, err := txscript.NewScriptBuilder().
+		AddData(opTrueScript).Script()
+	if err != nil {
+		t.Fatalf("unable to create signature script: %v", err)
+	}
+	spend := func(coinbase *btcutil.Tx, fee int64) *wire.MsgTx {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(coinbase.Hash(), 0),
+			sigScript, nil))
+		msgTx.AddTxOut(wire.NewTxOut(
+			coinbase.MsgTx().TxOut[0].Value-fee,
+			opTrueP2SHScript(t, ctx.params)))
+		return msgTx
+	}
+	replayed := spend(coinbases[1], 10000)
+	conflicted := spend(coinbases[0], 10000)
+	conflicting := spend(coinbases[0], 20000)
+
+	// Confirm two transactions on the old chain, one of which is double
+	// spent by the new chain.
+	processBlock(oldChain.createBlockWithTxs(t, conflicted, replayed), ctx)
+	if ctx.sm.txMemPool.Count() != 0 {
+		t.Fatalf("transaction pool has %d transactions, want 0",
+			ctx.sm.txMemPool.Count())
+	}
+
+	// Reorganize to the longer new chain.
+	newTip := newChain.createBlockWithTxs(t, conflicting)
+	processBlock(newTip, newChain, ctx)
+	newTip = newChain.createBlock(t)
+	processBlock(newTip, newChain, ctx)
+	if best := ctx.chain.BestSnapshot(); best.Hash != *newTip.Hash() {
+		t.Fatalf("best chain tip is %v, want %v", best.Hash,
+			newTip.Hash())
+	}
+
+	replayedHash := replayed.TxHash()
+	if !ctx.sm.txMemPool.HaveTransaction(&replayedHash) {
+		t.Fatal("transaction of disconnected block not replayed")
+	}
+	conflictedHash := conflicted.TxHash()
+	if ctx.sm.txMemPool.HaveTransaction(&conflictedHash) {
+		t.Fatal("transaction conflicting with new chain replayed")
+	}
+	if ctx.sm.txMemPool.Count() != 1 {
+		t.Fatalf("transaction pool has %d transactions, want 1",
+			ctx.sm.txMemPool.Count())
+	}
+}
+
+// stubLoadSource is a LoadSource that reports a load set by the test.
+type stubLoadSource struct {
+	mtx  sync.Mutex
+	load float64
+}
+
+// Load returns the load set by the test.
+func (s *stubLoadSource) Load() float64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.load
+}
+
+// setLoad sets the load reported by the load source.
+func (s *stubLoadSource) setLoad(load float64) {
+	s.mtx.Lock()
+	s.load = load
+	s.mtx.Unlock()
+}
+
+// TestLoadThrottle ensures queued blocks are not processed while the system
+// load exceeds the maximum load, other messages are still handled meanwhile,
+// and block processing resumes once the load drops.
+func TestLoadThrottle(t *testing.T) {
+	loadSource := &stubLoadSource{load: 2}
+	cfg := newTestConfig(t)
+	cfg.LoadSource = loadSource
+	cfg.MaxLoad = 1
+	cfg.Tuning.LoadCheckInterval = 10 * time.Millisecond
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	block := ctx.createBlock(t)
+
+	ctx.sm.Start()
+	defer ctx.sm.Stop()
+	done := make(chan struct{}, 1)
+	ctx.sm.QueueBlock(block, peer.Peer, done)
+	select {
+	case <-done:
+		t.Fatal("block processed while the load is high")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if ctx.sm.State() != SyncStateSyncing {
+		t.Fatal("status query not handled while the load is high")
+	}
+
+	loadSource.setLoad(0.5)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("block not processed once the load dropped")
+	}
+	if ctx.chain.BestSnapshot().Hash != *block.Hash() {
+		t.Fatal("block not connected once the load dropped")
+	}
+}
+
+// TestBestBlockChanged ensures the best block hook is invoked with the new tip
+// of the main chain each time it advances, including while the chain
+// reorganizes.
+func TestBestBlockChanged(t *testing.T) {
+	// Create a chain of blocks using a separate chain.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 2; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	// Create a longer fork from the first block using another chain.  The
+	// first block of the fork differs from the second block above by its
+	// timestamp.
+	forkSrc := newTestContextWithConfig(t, newTestConfig(t))
+	_, _, err := forkSrc.chain.ProcessBlock(blocks[0], blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	msgBlock := *blocks[1].MsgBlock()
+	msgBlock.Header.Timestamp = msgBlock.Header.Timestamp.Add(time.Second)
+	fork := []*btcutil.Block{solveBlock(&msgBlock)}
+	_, _, err = forkSrc.chain.ProcessBlock(fork[0], blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	block := forkSrc.createBlock(t)
+	_, _, err = forkSrc.chain.ProcessBlock(block, blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	fork = append(fork, block)
+
+	type tip struct {
+		hash   chainhash.Hash
+		height int32
+	}
+	var got []tip
+	cfg := newTestConfig(t)
+	cfg.OnBestBlockChanged = func(hash *chainhash.Hash, height int32) {
+		got = append(got, tip{*hash, height})
+	}
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	for _, block := range blocks {
+		ctx.sm.handleBlockMsg(&blockMsg{block: block, peer: peer.Peer})
+	}
+
+	// The fork is processed by the chain directly since the sync manager
+	// ignores unrequested blocks that do not extend the best chain.
+	for _, block := range fork {
+		_, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+	}
+
+	want := []tip{
+		{*blocks[0].Hash(), 1},
+		{*blocks[1].Hash(), 2},
+		{*blocks[0].Hash(), 1},
+		{*fork[0].Hash(), 2},
+		{*fork[1].Hash(), 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("best block changes are %v, want %v", got, want)
+	}
+}
+
+// TestRelayWhileSyncing ensures blocks accepted while catching up with the
+// sync peer are only relayed when configured to and that relaying resumes once
+// the chain is current.
+func TestRelayWhileSyncing(t *testing.T) {
+	// Create a chain of blocks using a separate chain.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 3; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	for _, relayWhileSyncing := range []bool{false, true} {
+		cfg := newTestConfig(t)
+		cfg.RelayWhileSyncing = relayWhileSyncing
+		ctx := newTestContextWithConfig(t, cfg)
+
+		// Sync from a peer that has all of the blocks so the chain is
+		// not current until the last one is processed.
+		peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+		peer.UpdateLastBlockHeight(int32(len(blocks)))
+		ctx.sm.handleNewPeerMsg(peer.Peer)
+		if ctx.sm.syncPeer != peer.Peer {
+			t.Fatal("peer did not become the sync peer")
+		}
+
+		var want []*wire.InvVect
+		for i, block := range blocks {
+			_, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone)
+			if err != nil {
+				t.Fatalf("unable to process block: %v", err)
+			}
+			if relayWhileSyncing || i == len(blocks)-1 {
+				want = append(want, wire.NewInvVect(
+					wire.InvTypeBlock, block.Hash()))
+			}
+		}
+		if !ctx.sm.current() {
+			t.Fatal("chain not current after processing all blocks")
+		}
+
+		ctx.notifier.mtx.Lock()
+		relayed := ctx.notifier.relayed
+		ctx.notifier.mtx.Unlock()
+		if !reflect.DeepEqual(relayed, want) {
+			t.Fatalf("relay while syncing %v: relayed %v, want %v",
+				relayWhileSyncing, relayed, want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"time"
+
+	"github.com/btcsuite/btcd/database"
+)
+
+// migrateDrainTimeout is the maximum time the blocks in flight are waited for
+// before the chain is switched over to a new database regardless.
+const migrateDrainTimeout = time.Minute
+
+// migrateDBMsg is a message type to be sent across the message channel for
+// replacing the database backing the chain.  Handling it from the block
+// handler ensures no blocks are being processed while the switch happens.
+type migrateDBMsg struct {
+	db    database.DB
+	reply chan error
+}
+
+// migrateDB switches the chain over to the passed database once block
+// processing has quiesced.  Syncing is cancelled so no further blocks are
+// requested from the sync peer, then the queued blocks are processed and the
+// blocks in flight are waited for, up to migrateDrainTimeout, before the
+// database is swapped.  Syncing resumes afterwards unless it was already
+// cancelled.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) migrateDB(db database.DB) error {
+	if !sm.syncCancelled {
+		sm.cancelSync()
+		defer sm.resumeSync()
+	}
+
+	beatTicker := time.NewTicker(sm.watchdogInterval())
+	defer beatTicker.Stop()
+	deadline := time.NewTimer(migrateDrainTimeout)
+	defer deadline.Stop()
+drain:
+	for len(sm.requestedBlocks) > 0 || len(sm.priorityChan) > 0 {
+		sm.blockHandlerBeat.beat()
+		select {
+		case m := <-sm.priorityChan:
+			sm.handlePriorityMsg(m)
+
+		case <-beatTicker.C:
+
+		case <-deadline.C:
+			log.Warnf("Switching the chain database with %d blocks "+
+				"still in flight", len(sm.requestedBlocks))
+			break drain
+
+		case <-sm.quit:
+			return errShuttingDown
+		}
+	}
+
+	return sm.chain.SwapDB(db)
+}
+
+// MigrateTo switches the chain over to the passed database once block
+// processing has quiesced.  Syncing is paused while the blocks already queued
+// or in flight are processed, and resumed once the switch is done.  The new
+// database must already be at the same best chain tip as the current one.
+// See blockchain.SwapDB for more details.
+func (sm *SyncManager) MigrateTo(db database.DB) error {
+	reply := make(chan error)
+	if !sm.queueMsg(migrateDBMsg{db: db, reply: reply}) {
+		return errShuttingDown
+	}
+	return <-reply
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+)
+
+// TestMigrateTo ensures the chain is only switched over to a new database once
+// the blocks in flight have been processed.
+func TestMigrateTo(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+
+	// Create a block on a separate chain whose database becomes the
+	// migration target once it is at the same tip.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	block := src.createBlock(t)
+	_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	newDB := src.chain.DB()
+	oldDB := ctx.chain.DB()
+
+	// Mark the block as requested from a peer.
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	ctx.sm.requestedBlocks[*block.Hash()] = struct{}{}
+	ctx.sm.peerStates[peer.Peer].requestedBlocks[*block.Hash()] = struct{}{}
+
+	ctx.sm.Start()
+	defer ctx.sm.Stop()
+
+	migrated := make(chan error, 1)
+	go func() {
+		migrated <- ctx.sm.MigrateTo(newDB)
+	}()
+	select {
+	case err := <-migrated:
+		t.Fatalf("migrated with a block in flight: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if ctx.chain.DB() != oldDB {
+		t.Fatal("database switched with a block in flight")
+	}
+
+	// The migration completes once the block in flight is processed.
+	done := make(chan struct{}, 1)
+	ctx.sm.QueueBlock(block, peer.Peer, done)
+	select {
+	case err := <-migrated:
+		if err != nil {
+			t.Fatalf("unable to migrate: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for migration")
+	}
+	if ctx.chain.DB() != newDB {
+		t.Fatal("database not switched")
+	}
+	if best := ctx.chain.BestSnapshot(); best.Hash != *block.Hash() {
+		t.Fatalf("best chain tip is %v, want %v", best.Hash,
+			block.Hash())
+	}
+}
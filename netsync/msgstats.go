@@ -0,0 +1,68 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"sort"
+
+	peerpkg "github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// PeerMessageStats describes the volume of inventory exchanged with a peer
+// since it connected.  It is intended for spotting abusive peers and tuning
+// alongside ban scoring.
+type PeerMessageStats struct {
+	// Peer is the peer the counts are for.
+	Peer *peerpkg.Peer
+
+	// InvItems is the number of inventory vectors announced by the peer.
+	InvItems uint64
+
+	// GetDataItems is the number of inventory vectors requested from the
+	// peer with getdata messages.
+	GetDataItems uint64
+
+	// BlocksDelivered is the number of blocks received from the peer.
+	BlocksDelivered uint64
+}
+
+// peerMsgStats houses the message volume counters of a peer.
+type peerMsgStats struct {
+	invItems        uint64
+	getDataItems    uint64
+	blocksDelivered uint64
+}
+
+// queueGetData queues the passed getdata message to the passed peer and counts
+// the items requested from it.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) queueGetData(peer *peerpkg.Peer, msg *wire.MsgGetData) {
+	if state, exists := sm.peerStates[peer]; exists {
+		state.msgStats.getDataItems += uint64(len(msg.InvList))
+	}
+	peer.QueueMessage(msg, nil)
+}
+
+// messageStats returns the message volume counters of all peers ordered by
+// peer id.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) messageStats() []PeerMessageStats {
+	stats := make([]PeerMessageStats, 0, len(sm.peerStates))
+	for peer, state := range sm.peerStates {
+		stats = append(stats, PeerMessageStats{
+			Peer:            peer,
+			InvItems:        state.msgStats.invItems,
+			GetDataItems:    state.msgStats.getDataItems,
+			BlocksDelivered: state.msgStats.blocksDelivered,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Peer.ID() < stats[j].Peer.ID()
+	})
+	return stats
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestMessageStats ensures the inventory announced by a peer, the items
+// requested from it and the blocks it delivers are counted per peer.
+func TestMessageStats(t *testing.T) {
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 2; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	other := newTestPeer(t, ctx.params, "127.0.0.1:18445", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	ctx.sm.handleNewPeerMsg(other.Peer)
+
+	// The peer announces both blocks, which are requested from it, and
+	// then delivers them.
+	inv := wire.NewMsgInv()
+	for _, block := range blocks {
+		iv := wire.NewInvVect(wire.InvTypeBlock, block.Hash())
+		if err := inv.AddInvVect(iv); err != nil {
+			t.Fatalf("unable to add inventory: %v", err)
+		}
+	}
+	ctx.sm.handleInvMsg(&invMsg{inv: inv, peer: peer.Peer})
+	for _, block := range blocks {
+		ctx.sm.handleBlockMsg(&blockMsg{block: block, peer: peer.Peer})
+	}
+
+	stats := ctx.sm.messageStats()
+	if len(stats) != 2 || stats[0].Peer != peer.Peer ||
+		stats[1].Peer != other.Peer {
+
+		t.Fatalf("unexpected peers in message stats %v", stats)
+	}
+	want := PeerMessageStats{
+		Peer:            peer.Peer,
+		InvItems:        2,
+		GetDataItems:    2,
+		BlocksDelivered: 2,
+	}
+	if stats[0] != want {
+		t.Fatalf("message stats %+v, want %+v", stats[0], want)
+	}
+	if want := (PeerMessageStats{Peer: other.Peer}); stats[1] != want {
+		t.Fatalf("message stats %+v, want %+v", stats[1], want)
+	}
+
+	// The counters are gone once the peer disconnects.
+	ctx.sm.handleDonePeerMsg(peer.Peer)
+	if stats := ctx.sm.messageStats(); len(stats) != 1 {
+		t.Fatalf("%d peers in message stats, want 1", len(stats))
+	}
+}
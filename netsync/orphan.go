@@ -0,0 +1,270 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	peerpkg "github.com/btcsuite/btcd/peer"
+)
+
+// resolveOrphan requests the missing ancestors of the orphan block with the
+// passed hash from the peer.  The passed height is the height claimed by the
+// coinbase of the orphan or zero when it is unknown.
+//
+// Orphans that are no further ahead of the best chain than the maximum orphan
+// resolution depth have all blocks up to the orphan root requested at once.
+// Deeper orphans are resolved incrementally by requesting the next batch of
+// blocks after the best chain tip, with the following batches requested as the
+// peer announces more blocks, so a single orphan can't induce a request for an
+// enormous range of blocks.  Peers that send orphans claiming a height further
+// beyond the height they advertised than the maximum depth are penalized.
+//
+// The orphan is not resolved when the maximum number of orphan resolution
+// requests are already outstanding with other peers.  Each peer has at most one
+// outstanding request, which is answered by the next inventory, block, headers,
+// or notfound message the peer sends.  The sync peer is exempt from the limit.
+// Peers that keep announcing orphans without providing their missing ancestors
+// are penalized instead of being sent the same request over and over.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) resolveOrphan(peer *peerpkg.Peer, hash *chainhash.Hash,
+	height int32) {
+
+	root := sm.chain.GetOrphanRoot(hash)
+	if sm.isOrphanLoop(peer, root) {
+		sm.penalizeOrphanLoop(peer, hash)
+		return
+	}
+
+	if !sm.acquireOrphanRequest(peer) {
+		log.Debugf("Not resolving orphan %v from %s -- %d orphan "+
+			"resolution requests outstanding", hash, peer,
+			len(sm.orphanRequests))
+		return
+	}
+
+	locator, err := sm.chain.LatestBlockLocator()
+	if err != nil {
+		log.Warnf("Failed to get block locator for the latest block: %v",
+			err)
+		sm.releaseOrphanRequest(peer)
+		return
+	}
+
+	stopHash := root
+	if height > 0 {
+		sm.addOrphanHeight(hash, height)
+		depth := height - sm.chain.BestSnapshot().Height
+		if depth > sm.maxOrphanDepth {
+			log.Debugf("Resolving orphan %v from %s incrementally "+
+				"(depth %d)", hash, peer, depth)
+			stopHash = &zeroHash
+
+			if height-peer.LastBlock() > sm.maxOrphanDepth {
+				sm.penalizeDeepOrphan(peer, hash, height)
+			}
+		}
+	}
+	peer.PushGetBlocksMsg(locator, stopHash)
+	sm.recordOrphanResolve(peer, root)
+}
+
+// penalizeDeepOrphan increases the ban score of the peer that sent the orphan
+// block with the passed hash and claimed height.
+func (sm *SyncManager) penalizeDeepOrphan(peer *peerpkg.Peer,
+	hash *chainhash.Hash, height int32) {
+
+	log.Debugf("Orphan %v from %s claims height %d beyond advertised "+
+		"height %d", hash, peer, height, peer.LastBlock())
+	if sm.addBanScore == nil {
+		return
+	}
+	reason := fmt.Sprintf("orphan %v claims height %d beyond advertised "+
+		"height %d", hash, height, peer.LastBlock())
+	sm.addBanScore(peer, 0, deepOrphanBanScore, reason)
+}
+
+// orphanResolveKey identifies an orphan resolution request by the root of the
+// orphan and the best chain tip.  Repeating a request while both are unchanged
+// can't make any progress.
+type orphanResolveKey struct {
+	root chainhash.Hash
+	tip  chainhash.Hash
+}
+
+// isOrphanLoop returns whether a request to resolve the orphan with the passed
+// root from the peer was already repeated the maximum number of times within
+// the orphan loop window.  Only requests that were actually sent are counted,
+// and they are counted per orphan root so peers alternating between several
+// orphans are detected as well.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) isOrphanLoop(peer *peerpkg.Peer,
+	root *chainhash.Hash) bool {
+
+	state, exists := sm.peerStates[peer]
+	if !exists || state.orphanResolves == nil ||
+		time.Since(state.orphanResolveStart) >= orphanLoopWindow {
+
+		return false
+	}
+	key := orphanResolveKey{root: *root, tip: sm.chain.BestSnapshot().Hash}
+	return state.orphanResolves[key] > maxOrphanResolveRepeats
+}
+
+// recordOrphanResolve records a request sent to the peer to resolve the orphan
+// with the passed root, starting a new orphan loop window when the previous one
+// has ended.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) recordOrphanResolve(peer *peerpkg.Peer,
+	root *chainhash.Hash) {
+
+	state, exists := sm.peerStates[peer]
+	if !exists {
+		return
+	}
+	now := time.Now()
+	if state.orphanResolves == nil ||
+		now.Sub(state.orphanResolveStart) >= orphanLoopWindow {
+
+		state.orphanResolves = make(map[orphanResolveKey]int)
+		state.orphanResolveStart = now
+	}
+	key := orphanResolveKey{root: *root, tip: sm.chain.BestSnapshot().Hash}
+	state.orphanResolves[key]++
+}
+
+// penalizeOrphanLoop increases the ban score of the peer that keeps announcing
+// the orphan block with the passed hash without providing its missing
+// ancestors.
+func (sm *SyncManager) penalizeOrphanLoop(peer *peerpkg.Peer,
+	hash *chainhash.Hash) {
+
+	log.Debugf("Not resolving orphan %v from %s again -- identical "+
+		"requests repeated more than %d times within %v", hash, peer,
+		maxOrphanResolveRepeats, orphanLoopWindow)
+	if sm.addBanScore == nil {
+		return
+	}
+	reason := fmt.Sprintf("orphan %v announced repeatedly without its "+
+		"ancestors", hash)
+	sm.addBanScore(peer, 0, orphanLoopBanScore, reason)
+}
+
+// isOrphanBlock returns whether the passed block would be an orphan, which is
+// the case when its parent is unknown or is itself an orphan.
+func (sm *SyncManager) isOrphanBlock(block *btcutil.Block) bool {
+	prevHash := &block.MsgBlock().Header.PrevBlock
+	if sm.chain.IsKnownOrphan(prevHash) {
+		return true
+	}
+	haveParent, err := sm.chain.HaveBlock(prevHash)
+	if err != nil {
+		log.Errorf("Unable to look up parent %v of block %v: %v",
+			prevHash, block.Hash(), err)
+		return false
+	}
+	return !haveParent
+}
+
+// allowPeerOrphan counts an orphan block received from the peer with the
+// passed state against the current orphan window of the peer, starting a new
+// window when the previous one has ended, and returns whether the peer is
+// still within the maximum number of orphans per window.
+func (sm *SyncManager) allowPeerOrphan(state *peerSyncState) bool {
+	now := time.Now()
+	if now.Sub(state.orphanWindowStart) >= sm.peerOrphanWindow {
+		state.orphanWindowStart = now
+		state.orphanCount = 0
+	}
+	state.orphanCount++
+	return state.orphanCount <= sm.maxPeerOrphans
+}
+
+// handleThrottledOrphan penalizes the passed peer for sending an orphan block
+// after exceeding the number of orphans accepted from it within the orphan
+// window.  The block is ignored.
+func (sm *SyncManager) handleThrottledOrphan(peer *peerpkg.Peer,
+	hash *chainhash.Hash) {
+
+	log.Debugf("Ignoring orphan %v from %s -- more than %d orphans within "+
+		"%v", hash, peer, sm.maxPeerOrphans, sm.peerOrphanWindow)
+	if sm.addBanScore == nil {
+		return
+	}
+	reason := fmt.Sprintf("orphan %v exceeds %d orphans within %v", hash,
+		sm.maxPeerOrphans, sm.peerOrphanWindow)
+	sm.addBanScore(peer, 0, throttledOrphanBanScore, reason)
+}
+
+// addOrphanHeight remembers the height claimed by the orphan block with the
+// passed hash so later announcements of the orphan are resolved the same way,
+// evicting a random entry when the maximum number of heights is exceeded.
+func (sm *SyncManager) addOrphanHeight(hash *chainhash.Hash, height int32) {
+	if _, exists := sm.orphanHeights[*hash]; !exists &&
+		len(sm.orphanHeights) >= maxOrphanHeights {
+
+		for h := range sm.orphanHeights {
+			delete(sm.orphanHeights, h)
+			break
+		}
+	}
+	sm.orphanHeights[*hash] = height
+}
+
+// acquireOrphanRequest records an outstanding orphan resolution request with
+// the passed peer and returns true unless the maximum number of requests are
+// already outstanding with other peers.  Requests older than the orphan
+// resolution timeout are expired first.  Requests to the sync peer are always
+// allowed and not counted since it is expected to provide the blocks anyway.
+func (sm *SyncManager) acquireOrphanRequest(peer *peerpkg.Peer) bool {
+	if peer == sm.syncPeer {
+		return true
+	}
+
+	now := time.Now()
+	for p, requested := range sm.orphanRequests {
+		if now.Sub(requested) >= orphanResolveTimeout {
+			delete(sm.orphanRequests, p)
+		}
+	}
+
+	if _, exists := sm.orphanRequests[peer]; !exists &&
+		len(sm.orphanRequests) >= sm.maxOrphanRequests {
+
+		return false
+	}
+	sm.orphanRequests[peer] = now
+	return true
+}
+
+// releaseOrphanRequest frees the orphan resolution request outstanding with
+// the passed peer, if any.  It is called for any response from the peer and
+// when the peer disconnects, so a request only holds its slot until the peer
+// answers or is gone.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) releaseOrphanRequest(peer *peerpkg.Peer) {
+	delete(sm.orphanRequests, peer)
+}
+
+// orphanResolveRequests returns the number of outstanding orphan resolution
+// requests.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) orphanResolveRequests() int {
+	var outstanding int
+	for _, requested := range sm.orphanRequests {
+		if time.Since(requested) < orphanResolveTimeout {
+			outstanding++
+		}
+	}
+	return outstanding
+}
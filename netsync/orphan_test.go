@@ -0,0 +1,474 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	peerpkg "github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestResolveOrphanDepth ensures the missing ancestors of shallow orphans are
+// requested up to the orphan root while deep orphans are resolved
+// incrementally, and that only peers sending orphans far beyond their
+// advertised height are penalized.
+func TestResolveOrphanDepth(t *testing.T) {
+	// Create a chain of blocks using a separate chain.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 8; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	var scores []uint32
+	cfg := newTestConfig(t)
+	cfg.MaxOrphanResolveDepth = 3
+	cfg.AddBanScore = func(peer *peerpkg.Peer, persistent,
+		transient uint32, reason string) {
+
+		scores = append(scores, transient)
+	}
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18555", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	state := ctx.sm.peerStates[peer.Peer]
+
+	assertGetBlocks := func(tp *testPeer, stopHash *chainhash.Hash) {
+		t.Helper()
+
+		select {
+		case msg := <-tp.getBlocks:
+			if msg.HashStop != *stopHash {
+				t.Fatalf("getblocks stop hash is %v, want %v",
+					msg.HashStop, stopHash)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for getblocks")
+		}
+	}
+
+	// The peer is chosen as the sync peer.  Extend the best chain so later
+	// requests are not filtered as duplicates of the initial one.
+	assertGetBlocks(peer, &zeroHash)
+	_, _, err := ctx.chain.ProcessBlock(blocks[0], blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+
+	// A shallow orphan has its ancestors requested up to the orphan root.
+	state.requestedBlocks[*blocks[2].Hash()] = struct{}{}
+	ctx.sm.handleBlockMsg(&blockMsg{block: blocks[2], peer: peer.Peer})
+	assertGetBlocks(peer, blocks[2].Hash())
+	if len(scores) != 0 {
+		t.Fatalf("unexpected ban scores %v", scores)
+	}
+
+	// A deep orphan is resolved incrementally and the peer is penalized
+	// since it claims a height far beyond the one it advertised.
+	state.requestedBlocks[*blocks[7].Hash()] = struct{}{}
+	ctx.sm.handleBlockMsg(&blockMsg{block: blocks[7], peer: peer.Peer})
+	assertGetBlocks(peer, &zeroHash)
+	if len(scores) != 1 || scores[0] != deepOrphanBanScore {
+		t.Fatalf("unexpected ban scores %v", scores)
+	}
+
+	// Announcements of the deep orphan by a peer that advertised a height
+	// at least as high resolve it incrementally as well without penalizing
+	// the peer.
+	peer2 := newTestPeer(t, ctx.params, "127.0.0.1:18556", true)
+	ctx.sm.handleNewPeerMsg(peer2.Peer)
+	peer2.UpdateLastBlockHeight(8)
+	ctx.sm.syncPeer = peer2.Peer
+	inv := wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, blocks[7].Hash()))
+	ctx.sm.handleInvMsg(&invMsg{inv: inv, peer: peer2.Peer})
+	assertGetBlocks(peer2, &zeroHash)
+	if len(scores) != 1 {
+		t.Fatalf("unexpected ban scores %v", scores)
+	}
+}
+
+// TestInvForHeldOrphan ensures inventory for a block that is already held as
+// an orphan does not request the block again and instead requests its missing
+// ancestors.
+func TestInvForHeldOrphan(t *testing.T) {
+	// Create a chain of blocks using a separate chain.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 2; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	_, _, err := ctx.chain.ProcessBlock(blocks[1], blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	orphanHash := blocks[1].Hash()
+	if !ctx.chain.IsKnownOrphan(orphanHash) {
+		t.Fatal("block not held as an orphan")
+	}
+
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18555", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	if ctx.sm.syncPeer != peer.Peer {
+		t.Fatalf("sync peer is %v, want %v", ctx.sm.syncPeer, peer.Peer)
+	}
+	select {
+	case <-peer.getBlocks:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for getblocks")
+	}
+
+	inv := wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, orphanHash))
+	ctx.sm.handleInvMsg(&invMsg{inv: inv, peer: peer.Peer})
+
+	// The missing ancestors are requested up to the orphan instead.
+	select {
+	case msg := <-peer.getBlocks:
+		if msg.HashStop != *orphanHash {
+			t.Fatalf("getblocks stop hash is %v, want %v",
+				msg.HashStop, orphanHash)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for getblocks")
+	}
+	select {
+	case msg := <-peer.getData:
+		t.Fatalf("unexpected getdata %v", msg.InvList)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if len(ctx.sm.inFlightRequests()) != 0 {
+		t.Fatal("held orphan requested again")
+	}
+}
+
+// TestOrphanResolveLimit ensures the number of outstanding orphan resolution
+// requests across all peers other than the sync peer is capped and that
+// requests stop counting once the peer responds, disconnects, or they time
+// out.
+func TestOrphanResolveLimit(t *testing.T) {
+	// Create a chain of blocks using a separate chain.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 7; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	cfg := newTestConfig(t)
+	cfg.MaxOrphanResolveRequests = 2
+	ctx := newTestContextWithConfig(t, cfg)
+	var peers []*testPeer
+	for i := 0; i < 4; i++ {
+		addr := fmt.Sprintf("127.0.0.1:%d", 18555+i)
+		peer := newTestPeer(t, ctx.params, addr, true)
+		ctx.sm.handleNewPeerMsg(peer.Peer)
+		peers = append(peers, peer)
+	}
+
+	// The first peer is chosen as the sync peer.
+	select {
+	case <-peers[0].getBlocks:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for getblocks")
+	}
+
+	// sendOrphan delivers the passed orphan from the passed peer and
+	// returns whether its missing ancestors were requested.
+	sendOrphan := func(tp *testPeer, orphan *btcutil.Block) bool {
+		t.Helper()
+
+		state := ctx.sm.peerStates[tp.Peer]
+		state.requestedBlocks[*orphan.Hash()] = struct{}{}
+		ctx.sm.handleBlockMsg(&blockMsg{block: orphan, peer: tp.Peer})
+		select {
+		case <-tp.getBlocks:
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}
+
+	// The orphans from the sync peer and the next two peers are resolved
+	// while the sync peer doesn't count against the limit.
+	for i, peer := range peers {
+		resolved := sendOrphan(peer, blocks[i+1])
+		if resolved != (i < 3) {
+			t.Fatalf("peer %d orphan resolved %v, want %v", i,
+				resolved, i < 3)
+		}
+	}
+	if n := ctx.sm.orphanResolveRequests(); n != 2 {
+		t.Fatalf("%d outstanding orphan resolution requests, want 2", n)
+	}
+
+	// Block inventory from the second peer answers its request, which
+	// allows the orphan from the last peer to be resolved.
+	inv := wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, blocks[0].Hash()))
+	ctx.sm.handleInvMsg(&invMsg{inv: inv, peer: peers[1].Peer})
+	if n := ctx.sm.orphanResolveRequests(); n != 1 {
+		t.Fatalf("%d outstanding orphan resolution requests, want 1", n)
+	}
+	if !sendOrphan(peers[3], blocks[5]) {
+		t.Fatal("orphan not resolved after a request was answered")
+	}
+
+	// Any other response answers the request as well.
+	notFound := wire.NewMsgNotFound()
+	notFound.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, blocks[6].Hash()))
+	ctx.sm.handleNotFoundMsg(&notFoundMsg{notFound: notFound,
+		peer: peers[2].Peer})
+	if n := ctx.sm.orphanResolveRequests(); n != 1 {
+		t.Fatalf("%d outstanding orphan resolution requests, want 1", n)
+	}
+
+	// Requests stop counting when they time out or the peer disconnects.
+	ctx.sm.orphanRequests[peers[3].Peer] = time.Now().Add(
+		-orphanResolveTimeout)
+	if n := ctx.sm.orphanResolveRequests(); n != 0 {
+		t.Fatalf("%d outstanding orphan resolution requests, want 0", n)
+	}
+	ctx.sm.orphanRequests[peers[2].Peer] = time.Now()
+	ctx.sm.handleDonePeerMsg(peers[2].Peer)
+	if n := ctx.sm.orphanResolveRequests(); n != 0 {
+		t.Fatalf("%d outstanding orphan resolution requests, want 0", n)
+	}
+}
+
+// TestPeerOrphanThrottle ensures orphans a peer sends beyond the maximum per
+// orphan window are dropped and penalized, that other peers are unaffected,
+// and that the peer may send orphans again once the window has ended.
+func TestPeerOrphanThrottle(t *testing.T) {
+	// Create a chain of blocks using a separate chain.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 8; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	var scores []uint32
+	cfg := newTestConfig(t)
+	cfg.MaxPeerOrphans = 3
+	cfg.PeerOrphanWindow = time.Hour
+	cfg.AddBanScore = func(peer *peerpkg.Peer, persistent,
+		transient uint32, reason string) {
+
+		scores = append(scores, transient)
+	}
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18555", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	other := newTestPeer(t, ctx.params, "127.0.0.1:18556", true)
+	ctx.sm.handleNewPeerMsg(other.Peer)
+
+	// sendOrphan delivers the passed orphan from the passed peer and
+	// returns whether it was accepted.
+	sendOrphan := func(tp *testPeer, orphan *btcutil.Block) bool {
+		t.Helper()
+
+		state := ctx.sm.peerStates[tp.Peer]
+		state.requestedBlocks[*orphan.Hash()] = struct{}{}
+		ctx.sm.handleBlockMsg(&blockMsg{block: orphan, peer: tp.Peer})
+		return ctx.chain.IsKnownOrphan(orphan.Hash())
+	}
+
+	// Flood orphans from the peer.  Only the first three are accepted and
+	// the peer is penalized for each of the others.
+	for i := 1; i <= 5; i++ {
+		accepted := sendOrphan(peer, blocks[i])
+		if accepted != (i <= 3) {
+			t.Fatalf("orphan %d accepted %v, want %v", i, accepted,
+				i <= 3)
+		}
+	}
+	if len(scores) != 2 || scores[0] != throttledOrphanBanScore ||
+		scores[1] != throttledOrphanBanScore {
+
+		t.Fatalf("unexpected ban scores %v", scores)
+	}
+	if _, exists := ctx.sm.requestedBlocks[*blocks[5].Hash()]; exists {
+		t.Fatal("throttled orphan still in flight")
+	}
+
+	// Orphans from other peers are still accepted.
+	if !sendOrphan(other, blocks[6]) {
+		t.Fatal("orphan from another peer not accepted")
+	}
+
+	// The peer may send orphans again once its window has ended.
+	state := ctx.sm.peerStates[peer.Peer]
+	state.orphanWindowStart = time.Now().Add(-time.Hour)
+	if !sendOrphan(peer, blocks[4]) {
+		t.Fatal("orphan not accepted after the orphan window ended")
+	}
+	if len(scores) != 2 {
+		t.Fatalf("unexpected ban scores %v", scores)
+	}
+}
+
+// TestOrphanResolveLoop ensures a peer that keeps announcing an orphan without
+// ever providing its missing parent is only sent the same orphan resolution
+// request a limited number of times and is penalized afterwards.
+func TestOrphanResolveLoop(t *testing.T) {
+	// Create a chain of blocks using a separate chain.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 2; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	var scores []uint32
+	cfg := newTestConfig(t)
+	cfg.AddBanScore = func(peer *peerpkg.Peer, persistent,
+		transient uint32, reason string) {
+
+		scores = append(scores, transient)
+	}
+	ctx := newTestContextWithConfig(t, cfg)
+	_, _, err := ctx.chain.ProcessBlock(blocks[1], blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	orphanHash := blocks[1].Hash()
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18555", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	select {
+	case <-peer.getBlocks:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for getblocks")
+	}
+
+	// The peer keeps announcing the orphan, but never provides its parent.
+	// The first request and its allowed repeats are made, although the peer
+	// only sends the first since the rest are duplicates, while the peer is
+	// penalized for the announcements after them instead.
+	inv := wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, orphanHash))
+	for i := 0; i < maxOrphanResolveRepeats+3; i++ {
+		ctx.sm.handleInvMsg(&invMsg{inv: inv, peer: peer.Peer})
+	}
+	select {
+	case msg := <-peer.getBlocks:
+		if msg.HashStop != *orphanHash {
+			t.Fatalf("getblocks stop hash is %v, want %v",
+				msg.HashStop, orphanHash)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for getblocks")
+	}
+	if len(scores) != 2 || scores[0] != orphanLoopBanScore ||
+		scores[1] != orphanLoopBanScore {
+
+		t.Fatalf("unexpected ban scores %v", scores)
+	}
+
+	// An identical request is no longer considered a loop once the best
+	// chain tip changes since it could then make progress.
+	_, _, err = ctx.chain.ProcessBlock(blocks[0], blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	if ctx.sm.isOrphanLoop(peer.Peer, orphanHash) {
+		t.Fatal("orphan resolution still considered a loop after the " +
+			"best chain tip changed")
+	}
+}
+
+// TestOrphanResolveLoopUnsent ensures orphan resolution requests that are not
+// sent because the maximum number of requests are outstanding don't count
+// towards detecting an orphan loop.
+func TestOrphanResolveLoopUnsent(t *testing.T) {
+	// Create a chain of blocks using a separate chain.
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 2; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	var scores []uint32
+	cfg := newTestConfig(t)
+	cfg.MaxOrphanResolveRequests = 1
+	cfg.AddBanScore = func(peer *peerpkg.Peer, persistent,
+		transient uint32, reason string) {
+
+		scores = append(scores, transient)
+	}
+	ctx := newTestContextWithConfig(t, cfg)
+	_, _, err := ctx.chain.ProcessBlock(blocks[1], blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	orphanHash := blocks[1].Hash()
+	syncPeer := newTestPeer(t, ctx.params, "127.0.0.1:18555", true)
+	ctx.sm.handleNewPeerMsg(syncPeer.Peer)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18556", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	other := newTestPeer(t, ctx.params, "127.0.0.1:18557", true)
+	ctx.sm.handleNewPeerMsg(other.Peer)
+	ctx.sm.orphanRequests[other.Peer] = time.Now()
+
+	// The orphan is resolved repeatedly while the only request slot is
+	// taken, so nothing is requested and the peer is not penalized.
+	for i := 0; i < maxOrphanResolveRepeats+3; i++ {
+		ctx.sm.resolveOrphan(peer.Peer, orphanHash, 0)
+	}
+	if len(scores) != 0 {
+		t.Fatalf("unexpected ban scores %v", scores)
+	}
+
+	// Once the slot is free, the orphan is resolved.
+	ctx.sm.releaseOrphanRequest(other.Peer)
+	ctx.sm.resolveOrphan(peer.Peer, orphanHash, 0)
+	select {
+	case msg := <-peer.getBlocks:
+		if msg.HashStop != *orphanHash {
+			t.Fatalf("getblocks stop hash is %v, want %v",
+				msg.HashStop, orphanHash)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for getblocks")
+	}
+	if len(scores) != 0 {
+		t.Fatalf("unexpected ban scores %v", scores)
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+const (
+	// DefaultMaxStoredOrphans is the default maximum number of orphan
+	// blocks kept by an orphan store.
+	DefaultMaxStoredOrphans = 100
+
+	// DefaultStoredOrphanExpiry is the default time after which orphan
+	// blocks kept by an orphan store expire.
+	DefaultStoredOrphanExpiry = 24 * time.Hour
+
+	// orphanFileExt is the extension of the files orphan blocks are stored
+	// in.  The name of each file is the hash of the block it contains.
+	orphanFileExt = ".orphan"
+)
+
+// OrphanStore keeps orphan blocks on disk so those received before a restart
+// can be reconsidered afterwards, once the chain may have been extended with
+// their parents, rather than downloading them again.  Each orphan is stored in
+// its own file within the directory of the store.  The number of orphans is
+// bounded by evicting the oldest ones and orphans expire after a while.
+//
+// An OrphanStore is safe for concurrent access.
+type OrphanStore struct {
+	mtx        sync.Mutex
+	dir        string
+	maxOrphans int
+	expiry     time.Duration
+}
+
+// OpenOrphanStore opens the orphan store in the passed directory, creating it
+// if it does not exist, and removes the orphans that expired.  A maximum number
+// of orphans or an expiry of zero uses DefaultMaxStoredOrphans or
+// DefaultStoredOrphanExpiry respectively.
+func OpenOrphanStore(dir string, maxOrphans int,
+	expiry time.Duration) (*OrphanStore, error) {
+
+	if maxOrphans <= 0 {
+		maxOrphans = DefaultMaxStoredOrphans
+	}
+	if expiry <= 0 {
+		expiry = DefaultStoredOrphanExpiry
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &OrphanStore{
+		dir:        dir,
+		maxOrphans: maxOrphans,
+		expiry:     expiry,
+	}
+	if _, err := s.entries(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// path returns the path of the file the orphan with the passed hash is stored
+// in.
+func (s *OrphanStore) path(hash *chainhash.Hash) string {
+	return filepath.Join(s.dir, hash.String()+orphanFileExt)
+}
+
+// entries returns the files of the unexpired orphans ordered from the oldest to
+// the newest after removing those that expired.
+//
+// This function MUST be called with the store lock held or before the store
+// is used concurrently.
+func (s *OrphanStore) entries() ([]os.FileInfo, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []os.FileInfo
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), orphanFileExt) {
+			continue
+		}
+		if time.Since(info.ModTime()) >= s.expiry {
+			log.Debugf("Removing expired stored orphan %s",
+				info.Name())
+			os.Remove(filepath.Join(s.dir, info.Name()))
+			continue
+		}
+		entries = append(entries, info)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime().Before(entries[j].ModTime())
+	})
+	return entries, nil
+}
+
+// Put stores the passed orphan block, evicting the oldest orphans when the
+// store would exceed its maximum number of orphans.
+func (s *OrphanStore) Put(block *btcutil.Block) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	serialized, err := block.Bytes()
+	if err != nil {
+		return err
+	}
+	entries, err := s.entries()
+	if err != nil {
+		return err
+	}
+	for len(entries) >= s.maxOrphans {
+		os.Remove(filepath.Join(s.dir, entries[0].Name()))
+		entries = entries[1:]
+	}
+
+	// Write to a temporary file first so a crash while storing the orphan
+	// doesn't leave a partial block behind.
+	path := s.path(block.Hash())
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, serialized, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Remove removes the orphan block with the passed hash from the store.  It is
+// not an error when the store does not have the orphan.
+func (s *OrphanStore) Remove(hash *chainhash.Hash) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	err := os.Remove(s.path(hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Orphans returns the unexpired orphan blocks in the store ordered from the
+// oldest to the newest.  Orphans that can't be read are removed.
+func (s *OrphanStore) Orphans() ([]*btcutil.Block, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	entries, err := s.entries()
+	if err != nil {
+		return nil, err
+	}
+	blocks := make([]*btcutil.Block, 0, len(entries))
+	for _, entry := range entries {
+		path := filepath.Join(s.dir, entry.Name())
+		serialized, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		block, err := btcutil.NewBlockFromBytes(serialized)
+		if err != nil {
+			log.Warnf("Removing unreadable stored orphan %s: %v",
+				entry.Name(), err)
+			os.Remove(path)
+			continue
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// reconsiderStoredOrphans processes the orphan blocks kept by the orphan store,
+// which were typically received before a restart, so those whose parents are
+// now known are accepted to the chain without downloading them again.  Orphans
+// that are accepted, known or invalid are removed from the store while those
+// that are still orphans are kept.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) reconsiderStoredOrphans() {
+	if sm.orphanStore == nil {
+		return
+	}
+	blocks, err := sm.orphanStore.Orphans()
+	if err != nil {
+		log.Errorf("Unable to load stored orphans: %v", err)
+		return
+	}
+
+	var accepted int
+	for _, block := range blocks {
+		_, isOrphan, err := sm.chain.ProcessBlock(block,
+			blockchain.BFNone)
+		if err == nil && isOrphan {
+			continue
+		}
+		if err != nil {
+			log.Debugf("Discarding stored orphan %v: %v",
+				block.Hash(), err)
+		} else {
+			accepted++
+		}
+		if err := sm.orphanStore.Remove(block.Hash()); err != nil {
+			log.Errorf("Unable to remove stored orphan %v: %v",
+				block.Hash(), err)
+		}
+	}
+	if len(blocks) > 0 {
+		log.Infof("Reconsidered %d stored orphans, %d accepted",
+			len(blocks), accepted)
+	}
+}
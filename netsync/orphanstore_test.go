@@ -0,0 +1,135 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestOrphanStore ensures an orphan block stored before a restart is
+// reconsidered and accepted once its parent is known afterwards.
+func TestOrphanStore(t *testing.T) {
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 2; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	// The second block is an orphan to a chain without the first, so it
+	// is stored.
+	dir := filepath.Join(t.TempDir(), "orphans")
+	store, err := OpenOrphanStore(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("unable to open orphan store: %v", err)
+	}
+	cfg := newTestConfig(t)
+	cfg.OrphanStore = store
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	inv := wire.NewMsgInv()
+	iv := wire.NewInvVect(wire.InvTypeBlock, blocks[1].Hash())
+	if err := inv.AddInvVect(iv); err != nil {
+		t.Fatalf("unable to add inventory: %v", err)
+	}
+	ctx.sm.handleInvMsg(&invMsg{inv: inv, peer: peer.Peer})
+	ctx.sm.handleBlockMsg(&blockMsg{block: blocks[1], peer: peer.Peer})
+	orphans, err := store.Orphans()
+	if err != nil {
+		t.Fatalf("unable to load orphans: %v", err)
+	}
+	if len(orphans) != 1 || *orphans[0].Hash() != *blocks[1].Hash() {
+		t.Fatalf("stored orphans %v, want %v", orphans, blocks[1].Hash())
+	}
+
+	// Restart with a chain that learned of the first block in the meantime
+	// and the same store.  The stored orphan is accepted and forgotten.
+	store, err = OpenOrphanStore(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("unable to reopen orphan store: %v", err)
+	}
+	cfg = newTestConfig(t)
+	cfg.OrphanStore = store
+	ctx = newTestContextWithConfig(t, cfg)
+	_, _, err = ctx.chain.ProcessBlock(blocks[0], blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	ctx.sm.reconsiderStoredOrphans()
+	if best := ctx.chain.BestSnapshot(); best.Hash != *blocks[1].Hash() {
+		t.Fatalf("best chain tip is %v, want %v", best.Hash,
+			blocks[1].Hash())
+	}
+	if orphans, err := store.Orphans(); err != nil || len(orphans) != 0 {
+		t.Fatalf("%d stored orphans remain (err %v)", len(orphans), err)
+	}
+}
+
+// TestOrphanStoreBounds ensures the oldest orphans are evicted once the store
+// is full and that orphans expire.
+func TestOrphanStoreBounds(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 3; i++ {
+		block := ctx.createBlock(t)
+		_, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	dir := t.TempDir()
+	store, err := OpenOrphanStore(dir, 2, time.Hour)
+	if err != nil {
+		t.Fatalf("unable to open orphan store: %v", err)
+	}
+
+	// Store the blocks with distinct ages so the first is the oldest.
+	for i, block := range blocks {
+		if err := store.Put(block); err != nil {
+			t.Fatalf("unable to store orphan: %v", err)
+		}
+		age := time.Now().Add(-time.Duration(len(blocks)-i) * time.Minute)
+		if err := os.Chtimes(store.path(block.Hash()), age, age); err != nil {
+			t.Fatalf("unable to set orphan age: %v", err)
+		}
+	}
+	orphans, err := store.Orphans()
+	if err != nil {
+		t.Fatalf("unable to load orphans: %v", err)
+	}
+	if len(orphans) != 2 || *orphans[0].Hash() != *blocks[1].Hash() ||
+		*orphans[1].Hash() != *blocks[2].Hash() {
+
+		t.Fatalf("stored orphans %v, want the last two blocks", orphans)
+	}
+
+	// An orphan older than the expiry is dropped when the store is opened.
+	expired := time.Now().Add(-2 * time.Hour)
+	err = os.Chtimes(store.path(blocks[1].Hash()), expired, expired)
+	if err != nil {
+		t.Fatalf("unable to set orphan age: %v", err)
+	}
+	store, err = OpenOrphanStore(dir, 2, time.Hour)
+	if err != nil {
+		t.Fatalf("unable to reopen orphan store: %v", err)
+	}
+	if _, err := os.Stat(store.path(blocks[1].Hash())); !os.IsNotExist(err) {
+		t.Fatalf("expired orphan not removed (err %v)", err)
+	}
+}
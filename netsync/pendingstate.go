@@ -0,0 +1,64 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"sort"
+)
+
+// PeerPendingState describes the outstanding work for a single peer.
+type PeerPendingState struct {
+	Addr            string `json:"addr"`
+	RequestQueue    int    `json:"requestqueue"`
+	RequestedBlocks int    `json:"requestedblocks"`
+	RequestedTxns   int    `json:"requestedtxns"`
+	SyncCandidate   bool   `json:"synccandidate"`
+}
+
+// PendingState is a snapshot of the blocks the sync manager is waiting on and
+// the outstanding work for each peer.  It is intended to help diagnose a
+// stalled sync and can be serialized as JSON.
+type PendingState struct {
+	// SyncPeer is the address of the current sync peer or empty when
+	// there is none.
+	SyncPeer string `json:"syncpeer,omitempty"`
+
+	// BlockPeers maps the hash of each requested block that has not yet
+	// been received to the address of the peer it was requested from.
+	BlockPeers map[string]string `json:"blockpeers"`
+
+	// Peers houses the outstanding work for each peer sorted by address.
+	Peers []PeerPendingState `json:"peers"`
+}
+
+// pendingState returns a snapshot of the blocks being waited on and the
+// outstanding work for each peer.  It must be called from the blockHandler
+// goroutine.
+func (sm *SyncManager) pendingState() *PendingState {
+	state := &PendingState{
+		BlockPeers: make(map[string]string),
+		Peers:      make([]PeerPendingState, 0, len(sm.peerStates)),
+	}
+	if sm.syncPeer != nil {
+		state.SyncPeer = sm.syncPeer.Addr()
+	}
+	for peer, peerState := range sm.peerStates {
+		addr := peer.Addr()
+		for hash := range peerState.requestedBlocks {
+			state.BlockPeers[hash.String()] = addr
+		}
+		state.Peers = append(state.Peers, PeerPendingState{
+			Addr:            addr,
+			RequestQueue:    len(peerState.requestQueue),
+			RequestedBlocks: len(peerState.requestedBlocks),
+			RequestedTxns:   len(peerState.requestedTxns),
+			SyncCandidate:   peerState.syncCandidate,
+		})
+	}
+	sort.Slice(state.Peers, func(i, j int) bool {
+		return state.Peers[i].Addr < state.Peers[j].Addr
+	})
+	return state
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestDumpPendingState ensures the pending state snapshot reports the peers
+// requested blocks are mapped to along with the outstanding work per peer.
+func TestDumpPendingState(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+
+	peerA := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	peerB := newTestPeer(t, ctx.params, "127.0.0.1:18445", true)
+	ctx.sm.handleNewPeerMsg(peerA.Peer)
+	ctx.sm.handleNewPeerMsg(peerB.Peer)
+
+	// Populate the requested blocks and request queues.
+	hashA := chainhash.Hash{0x01}
+	hashB := chainhash.Hash{0x02}
+	hashC := chainhash.Hash{0x03}
+	stateA := ctx.sm.peerStates[peerA.Peer]
+	stateB := ctx.sm.peerStates[peerB.Peer]
+	stateA.requestedBlocks[hashA] = struct{}{}
+	stateA.requestedBlocks[hashB] = struct{}{}
+	stateB.requestedBlocks[hashC] = struct{}{}
+	stateB.requestedTxns[hashA] = struct{}{}
+	stateB.requestQueue = append(stateB.requestQueue,
+		wire.NewInvVect(wire.InvTypeTx, &hashB),
+		wire.NewInvVect(wire.InvTypeTx, &hashC))
+
+	ctx.sm.Start()
+	defer ctx.sm.Stop()
+
+	want := &PendingState{
+		SyncPeer: peerA.Addr(),
+		BlockPeers: map[string]string{
+			hashA.String(): peerA.Addr(),
+			hashB.String(): peerA.Addr(),
+			hashC.String(): peerB.Addr(),
+		},
+		Peers: []PeerPendingState{{
+			Addr:            peerA.Addr(),
+			RequestedBlocks: 2,
+			SyncCandidate:   true,
+		}, {
+			Addr:            peerB.Addr(),
+			RequestQueue:    2,
+			RequestedBlocks: 1,
+			RequestedTxns:   1,
+			SyncCandidate:   true,
+		}},
+	}
+	got := ctx.sm.DumpPendingState()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected pending state: got %+v, want %+v", got,
+			want)
+	}
+
+	// Ensure the snapshot survives a JSON round trip.
+	serialized, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("unable to serialize pending state: %v", err)
+	}
+	var deserialized PendingState
+	if err := json.Unmarshal(serialized, &deserialized); err != nil {
+		t.Fatalf("unable to deserialize pending state: %v", err)
+	}
+	if !reflect.DeepEqual(&deserialized, want) {
+		t.Fatalf("unexpected deserialized pending state: got %+v, "+
+			"want %+v", &deserialized, want)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	peerpkg "github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// getDataBatchSize is the maximum number of blocks requested with each
+// getdata message when pipelining requests.
+const getDataBatchSize = 16
+
+// pushPipelinedGetData requests the passed blocks from the peer with a single
+// getdata message and adds them to the pipeline of the peer as a batch.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) pushPipelinedGetData(peer *peerpkg.Peer,
+	state *peerSyncState, invs []*wire.InvVect) {
+
+	gdmsg := wire.NewMsgGetDataSizeHint(uint(len(invs)))
+	batch := make([]chainhash.Hash, 0, len(invs))
+	for _, iv := range invs {
+		gdmsg.AddInvVect(iv)
+		batch = append(batch, iv.Hash)
+	}
+	state.pipeline = append(state.pipeline, batch)
+	sm.queueGetData(peer, gdmsg)
+}
+
+// prunePipeline removes the batches of the pipeline of the peer that have been
+// fully processed along with the blocks at its front that are no longer
+// expected from the peer, such as those it did not find, so blocks requested
+// after them are not held forever.
+//
+// This function MUST be called from the sync manager goroutine.
+func prunePipeline(state *peerSyncState) {
+	for len(state.pipeline) > 0 {
+		batch := state.pipeline[0]
+		if len(batch) == 0 {
+			state.pipeline = state.pipeline[1:]
+			continue
+		}
+		if _, held := state.reorder[batch[0]]; held {
+			return
+		}
+		if _, ok := state.requestedBlocks[batch[0]]; ok {
+			return
+		}
+		state.pipeline[0] = batch[1:]
+	}
+}
+
+// holdPipelinedBlock returns whether the passed block was requested from the
+// peer with a pipelined getdata message after blocks that have not been
+// received yet, in which case the block is held in the reorder buffer of the
+// peer until they are processed.  A block at the front of the pipeline is
+// removed from it instead since it is about to be processed.
+//
+// This function MUST be called from the sync manager goroutine.
+func holdPipelinedBlock(state *peerSyncState, bmsg *blockMsg) bool {
+	prunePipeline(state)
+	hash := *bmsg.block.Hash()
+	for i, batch := range state.pipeline {
+		for j := range batch {
+			if batch[j] != hash {
+				continue
+			}
+			if i == 0 && j == 0 {
+				state.pipeline[0] = batch[1:]
+				return false
+			}
+			if state.reorder == nil {
+				state.reorder = make(map[chainhash.Hash]*blockMsg)
+			}
+			state.reorder[hash] = bmsg
+			return true
+		}
+	}
+	return false
+}
+
+// nextPipelinedBlock removes and returns the block at the front of the
+// pipeline of the peer when it is held in the reorder buffer, or nil when
+// there is no such block.
+//
+// This function MUST be called from the sync manager goroutine.
+func nextPipelinedBlock(state *peerSyncState) *blockMsg {
+	prunePipeline(state)
+	if len(state.pipeline) == 0 {
+		return nil
+	}
+	hash := state.pipeline[0][0]
+	bmsg, ok := state.reorder[hash]
+	if !ok {
+		return nil
+	}
+	delete(state.reorder, hash)
+	state.pipeline[0] = state.pipeline[0][1:]
+	return bmsg
+}
+
+// advancePipeline processes the blocks held in the reorder buffer of the peer
+// that are no longer waiting on blocks requested before them and requests more
+// of the queued blocks once earlier getdata messages have been answered.  It
+// is run whenever a block arrives or the peer reports blocks as not found.
+//
+// This function MUST be called from the sync manager goroutine.
+func (sm *SyncManager) advancePipeline(peer *peerpkg.Peer, state *peerSyncState) {
+	for {
+		next := nextPipelinedBlock(state)
+		if next == nil {
+			break
+		}
+		sm.processBlockMsg(next)
+	}
+	if len(state.pipeline) < sm.getDataPipeline &&
+		len(state.requestQueue) > 0 {
+
+		sm.requestQueuedInv(peer, state)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestGetDataPipeline ensures announced blocks are requested from a peer with
+// up to the configured number of getdata messages outstanding at once, that
+// blocks arriving ahead of blocks requested before them are held until those
+// are processed, and that the queued blocks are requested once earlier
+// messages have been answered.
+func TestGetDataPipeline(t *testing.T) {
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < 2*getDataBatchSize+8; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	cfg := newTestConfig(t)
+	cfg.GetDataPipelineDepth = 2
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	state := ctx.sm.peerStates[peer.Peer]
+
+	inv := wire.NewMsgInv()
+	for _, block := range blocks {
+		iv := wire.NewInvVect(wire.InvTypeBlock, block.Hash())
+		if err := inv.AddInvVect(iv); err != nil {
+			t.Fatalf("unable to add inventory: %v", err)
+		}
+	}
+	ctx.sm.handleInvMsg(&invMsg{inv: inv, peer: peer.Peer})
+
+	// expectGetData ensures a getdata message for the passed blocks is
+	// received by the peer.
+	expectGetData := func(want []*btcutil.Block) {
+		t.Helper()
+		select {
+		case msg := <-peer.getData:
+			if len(msg.InvList) != len(want) {
+				t.Fatalf("getdata for %d blocks, want %d",
+					len(msg.InvList), len(want))
+			}
+			for i, iv := range msg.InvList {
+				if iv.Hash != *want[i].Hash() {
+					t.Fatalf("getdata item %d is %v, want %v",
+						i, iv.Hash, want[i].Hash())
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for getdata")
+		}
+	}
+
+	// Two getdata messages are outstanding while the remaining blocks are
+	// left queued.
+	expectGetData(blocks[:getDataBatchSize])
+	expectGetData(blocks[getDataBatchSize : 2*getDataBatchSize])
+	select {
+	case msg := <-peer.getData:
+		t.Fatalf("unexpected getdata beyond the pipeline %v", msg.InvList)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if len(state.requestQueue) != 8 {
+		t.Fatalf("%d queued blocks, want 8", len(state.requestQueue))
+	}
+
+	// A block that arrives ahead of the first one is held rather than
+	// processed as an orphan, and both are processed once the first one
+	// arrives.
+	ctx.sm.handleBlockMsg(&blockMsg{block: blocks[1], peer: peer.Peer})
+	if _, ok := state.reorder[*blocks[1].Hash()]; !ok {
+		t.Fatal("block arriving ahead of its turn not held")
+	}
+	if ctx.chain.IsKnownOrphan(blocks[1].Hash()) {
+		t.Fatal("block arriving ahead of its turn processed as orphan")
+	}
+	ctx.sm.handleBlockMsg(&blockMsg{block: blocks[0], peer: peer.Peer})
+	if best := ctx.chain.BestSnapshot(); best.Hash != *blocks[1].Hash() {
+		t.Fatalf("best chain tip is %v, want %v", best.Hash,
+			blocks[1].Hash())
+	}
+
+	// The queued blocks are requested once the first message has been
+	// answered, even when its blocks arrive in reverse order.
+	for i := getDataBatchSize - 1; i >= 2; i-- {
+		ctx.sm.handleBlockMsg(&blockMsg{block: blocks[i], peer: peer.Peer})
+	}
+	expectGetData(blocks[2*getDataBatchSize:])
+	for _, block := range blocks[getDataBatchSize:] {
+		ctx.sm.handleBlockMsg(&blockMsg{block: block, peer: peer.Peer})
+	}
+	best := ctx.chain.BestSnapshot()
+	if best.Hash != *blocks[len(blocks)-1].Hash() {
+		t.Fatalf("best chain tip is %v, want %v", best.Hash,
+			blocks[len(blocks)-1].Hash())
+	}
+	if len(state.pipeline) != 0 || len(state.reorder) != 0 {
+		t.Fatalf("%d pipelined batches and %d held blocks remain",
+			len(state.pipeline), len(state.reorder))
+	}
+}
+
+// TestGetDataPipelineNotFound ensures blocks held until the blocks requested
+// before them arrive are processed, and the queued blocks requested, once the
+// peer reports the block at the front of the pipeline as not found.
+func TestGetDataPipelineNotFound(t *testing.T) {
+	src := newTestContextWithConfig(t, newTestConfig(t))
+	var blocks []*btcutil.Block
+	for i := 0; i < getDataBatchSize+2; i++ {
+		block := src.createBlock(t)
+		_, _, err := src.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	cfg := newTestConfig(t)
+	cfg.GetDataPipelineDepth = 1
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+	state := ctx.sm.peerStates[peer.Peer]
+
+	inv := wire.NewMsgInv()
+	for _, block := range blocks {
+		iv := wire.NewInvVect(wire.InvTypeBlock, block.Hash())
+		if err := inv.AddInvVect(iv); err != nil {
+			t.Fatalf("unable to add inventory: %v", err)
+		}
+	}
+	ctx.sm.handleInvMsg(&invMsg{inv: inv, peer: peer.Peer})
+	select {
+	case <-peer.getData:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for getdata")
+	}
+
+	// Every block of the batch but the first arrives and is held.
+	for _, block := range blocks[1:getDataBatchSize] {
+		ctx.sm.handleBlockMsg(&blockMsg{block: block, peer: peer.Peer})
+	}
+	if len(state.reorder) != getDataBatchSize-1 {
+		t.Fatalf("%d held blocks, want %d", len(state.reorder),
+			getDataBatchSize-1)
+	}
+
+	// The peer doesn't have the first block after all.
+	notFound := wire.NewMsgNotFound()
+	iv := wire.NewInvVect(wire.InvTypeBlock, blocks[0].Hash())
+	if err := notFound.AddInvVect(iv); err != nil {
+		t.Fatalf("unable to add inventory: %v", err)
+	}
+	ctx.sm.handleNotFoundMsg(&notFoundMsg{notFound: notFound, peer: peer.Peer})
+	if len(state.reorder) != 0 {
+		t.Fatalf("%d blocks still held", len(state.reorder))
+	}
+	select {
+	case msg := <-peer.getData:
+		if len(msg.InvList) != 2 {
+			t.Fatalf("getdata for %d blocks, want 2", len(msg.InvList))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for getdata of queued blocks")
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import "fmt"
+
+// SyncState describes the lifecycle state of the sync manager.
+type SyncState uint8
+
+// These constants define the lifecycle states of the sync manager.
+const (
+	// SyncStateNotStarted indicates the sync manager has not been started.
+	SyncStateNotStarted SyncState = iota
+
+	// SyncStateSyncing indicates the sync manager is running and the chain
+	// is not yet synced with the connected peers, including while there is
+	// no peer to sync from.
+	SyncStateSyncing
+
+	// SyncStateCurrent indicates the sync manager is running and believes
+	// the chain is synced with the connected peers.
+	SyncStateCurrent
+
+	// SyncStateShuttingDown indicates the sync manager has been stopped or
+	// is in the process of stopping.
+	SyncStateShuttingDown
+)
+
+// Map of SyncState values back to their constant names for pretty printing.
+var syncStateStrings = map[SyncState]string{
+	SyncStateNotStarted:   "not started",
+	SyncStateSyncing:      "syncing",
+	SyncStateCurrent:      "current",
+	SyncStateShuttingDown: "shutting down",
+}
+
+// String returns the SyncState in human-readable form.
+func (s SyncState) String() string {
+	if str, ok := syncStateStrings[s]; ok {
+		return str
+	}
+	return fmt.Sprintf("Unknown SyncState (%d)", uint8(s))
+}
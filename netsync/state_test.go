@@ -0,0 +1,58 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+)
+
+// TestSyncState ensures the lifecycle state reported by the sync manager
+// reflects whether it was started, whether the chain is current, and whether
+// it is shutting down.
+func TestSyncState(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	if got := ctx.sm.State(); got != SyncStateNotStarted {
+		t.Fatalf("state before start is %v, want %v", got,
+			SyncStateNotStarted)
+	}
+
+	// The genesis block of the regression test network is too old for
+	// the chain to be current.
+	ctx.sm.Start()
+	if got := ctx.sm.State(); got != SyncStateSyncing {
+		t.Fatalf("state at genesis is %v, want %v", got,
+			SyncStateSyncing)
+	}
+
+	// Extending the chain with a recent block makes it current.
+	block := ctx.createBlock(t)
+	if _, err := ctx.sm.ProcessBlock(block, blockchain.BFNone); err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	if got := ctx.sm.State(); got != SyncStateCurrent {
+		t.Fatalf("state with a recent block is %v, want %v", got,
+			SyncStateCurrent)
+	}
+
+	if err := ctx.sm.Stop(); err != nil {
+		t.Fatalf("unable to stop sync manager: %v", err)
+	}
+	if got := ctx.sm.State(); got != SyncStateShuttingDown {
+		t.Fatalf("state after stop is %v, want %v", got,
+			SyncStateShuttingDown)
+	}
+
+	// A sync manager stopped without being started is shutting down too.
+	ctx = newTestContextWithConfig(t, newTestConfig(t))
+	if err := ctx.sm.Stop(); err != nil {
+		t.Fatalf("unable to stop sync manager: %v", err)
+	}
+	if got := ctx.sm.State(); got != SyncStateShuttingDown {
+		t.Fatalf("state after stop is %v, want %v", got,
+			SyncStateShuttingDown)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mempool"
+)
+
+// defaultAcceptedTxBufferSize is the default number of accepted transaction
+// events buffered for each subscriber.
+const defaultAcceptedTxBufferSize = 1000
+
+// AcceptedTx describes a transaction received from a peer that was accepted to
+// the memory pool.
+type AcceptedTx struct {
+	// Hash is the hash of the transaction.
+	Hash chainhash.Hash
+
+	// Size is the serialized size of the transaction in bytes.
+	Size int
+
+	// Fee is the total fee the transaction pays in satoshi.
+	Fee int64
+}
+
+// AcceptedTxSubscription is a live feed of the transactions accepted to the
+// memory pool.  Events are delivered over a bounded channel in the order the
+// transactions were accepted.  Events are dropped rather than blocking the
+// sync manager when the subscriber does not keep up.
+type AcceptedTxSubscription struct {
+	feed *txFeed
+	c    chan AcceptedTx
+
+	// dropping is set while events are being dropped for the subscription
+	// so a warning is only logged once each time it falls behind.  It is
+	// protected by the feed mutex.
+	dropping bool
+}
+
+// Events returns the channel over which accepted transactions are delivered.
+// The channel is closed when the subscription is cancelled or the sync manager
+// is stopped.
+func (s *AcceptedTxSubscription) Events() <-chan AcceptedTx {
+	return s.c
+}
+
+// Unsubscribe cancels the subscription and closes its channel.  It is safe to
+// call multiple times.
+func (s *AcceptedTxSubscription) Unsubscribe() {
+	s.feed.remove(s)
+}
+
+// txFeed houses the subscriptions to accepted transactions.  It is safe for
+// concurrent access.
+type txFeed struct {
+	mtx    sync.Mutex
+	subs   map[*AcceptedTxSubscription]struct{}
+	closed bool
+}
+
+// newTxFeed returns a new accepted transaction feed with no subscribers.
+func newTxFeed() *txFeed {
+	return &txFeed{subs: make(map[*AcceptedTxSubscription]struct{})}
+}
+
+// subscribe returns a new subscription whose channel buffers up to the passed
+// number of events.  The channel of a subscription made after the feed is
+// closed is closed immediately.
+func (f *txFeed) subscribe(bufferSize int) *AcceptedTxSubscription {
+	sub := &AcceptedTxSubscription{
+		feed: f,
+		c:    make(chan AcceptedTx, bufferSize),
+	}
+
+	f.mtx.Lock()
+	if f.closed {
+		close(sub.c)
+	} else {
+		f.subs[sub] = struct{}{}
+	}
+	f.mtx.Unlock()
+	return sub
+}
+
+// remove cancels the passed subscription and closes its channel.
+func (f *txFeed) remove(sub *AcceptedTxSubscription) {
+	f.mtx.Lock()
+	if _, ok := f.subs[sub]; ok {
+		delete(f.subs, sub)
+		close(sub.c)
+	}
+	f.mtx.Unlock()
+}
+
+// close cancels all subscriptions and prevents new ones from receiving events.
+func (f *txFeed) close() {
+	f.mtx.Lock()
+	for sub := range f.subs {
+		close(sub.c)
+	}
+	f.subs = nil
+	f.closed = true
+	f.mtx.Unlock()
+}
+
+// notify sends an event for each of the passed accepted transactions to all
+// subscribers without blocking.  Events that do not fit in the buffer of a
+// subscriber are dropped.
+func (f *txFeed) notify(txDescs []*mempool.TxDesc) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if len(f.subs) == 0 {
+		return
+	}
+	for _, txD := range txDescs {
+		event := AcceptedTx{
+			Hash: *txD.Tx.Hash(),
+			Size: txD.Tx.MsgTx().SerializeSize(),
+			Fee:  txD.Fee,
+		}
+		for sub := range f.subs {
+			select {
+			case sub.c <- event:
+				sub.dropping = false
+			default:
+				if !sub.dropping {
+					log.Warnf("Dropping accepted transaction "+
+						"events for slow subscriber (buffer "+
+						"size %d)", cap(sub.c))
+					sub.dropping = true
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestSubscribeAcceptedTxs ensures transactions accepted to the memory pool
+// produce events in the order they are accepted, that events are dropped for
+// subscribers that fall behind, and that subscriptions are cancelled when the
+// sync manager is stopped.
+func TestSubscribeAcceptedTxs(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.handleNewPeerMsg(peer.Peer)
+
+	// Mine enough blocks for the coinbase of the first one to mature.
+	var coinbases []*btcutil.Tx
+	for i := 0; i <= int(ctx.params.CoinbaseMaturity); i++ {
+		block := ctx.createBlock(t)
+		_, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		coinbases = append(coinbases, block.Transactions()[0])
+	}
+
+	// spend returns a transaction that spends the first output of the
+	// passed transaction and pays the passed fee.
+	const fee = 10000
+	sigScript, err := txscript.NewScriptBuilder().
+		AddData(opTrueScript).Script()
+	if err != nil {
+		t.Fatalf("unable to create signature script: %v", err)
+	}
+	pkScript := opTrueP2SHScript(t, ctx.params)
+	spend := func(tx *btcutil.Tx) *btcutil.Tx {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(tx.Hash(), 0),
+			sigScript, nil))
+		msgTx.AddTxOut(wire.NewTxOut(tx.MsgTx().TxOut[0].Value-fee,
+			pkScript))
+		return btcutil.NewTx(msgTx)
+	}
+	parent := spend(coinbases[0])
+	child := spend(parent)
+
+	full := ctx.sm.SubscribeAcceptedTxs(10)
+	slow := ctx.sm.SubscribeAcceptedTxs(1)
+	unsubscribed := ctx.sm.SubscribeAcceptedTxs(10)
+	unsubscribed.Unsubscribe()
+	unsubscribed.Unsubscribe()
+
+	// Process the child before its parent so it is held as an orphan and
+	// then accepted along with the parent.
+	for _, tx := range []*btcutil.Tx{child, parent} {
+		done := make(chan struct{}, 1)
+		ctx.sm.handleTxMsg(&txMsg{tx: tx, peer: peer.Peer,
+			reply: done})
+	}
+
+	want := []*btcutil.Tx{parent, child}
+	for i, tx := range want {
+		event := <-full.Events()
+		if event.Hash != *tx.Hash() {
+			t.Fatalf("event #%d for tx %v, want %v", i, event.Hash,
+				tx.Hash())
+		}
+		if event.Fee != fee {
+			t.Fatalf("event #%d fee %d, want %d", i, event.Fee, fee)
+		}
+		if event.Size != tx.MsgTx().SerializeSize() {
+			t.Fatalf("event #%d size %d, want %d", i, event.Size,
+				tx.MsgTx().SerializeSize())
+		}
+	}
+	if event := <-slow.Events(); event.Hash != *parent.Hash() {
+		t.Fatalf("slow subscriber got tx %v, want %v", event.Hash,
+			parent.Hash())
+	}
+	select {
+	case event := <-slow.Events():
+		t.Fatalf("slow subscriber got dropped event for tx %v",
+			event.Hash)
+	default:
+	}
+	if _, ok := <-unsubscribed.Events(); ok {
+		t.Fatal("unsubscribed subscriber got event")
+	}
+
+	// Stopping the sync manager cancels all subscriptions.
+	ctx.sm.Stop()
+	if _, ok := <-full.Events(); ok {
+		t.Fatal("subscription not cancelled on stop")
+	}
+	if _, ok := <-ctx.sm.SubscribeAcceptedTxs(1).Events(); ok {
+		t.Fatal("subscription after stop not cancelled")
+	}
+}
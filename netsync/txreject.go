@@ -0,0 +1,179 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mempool"
+	peerpkg "github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// defaultTxRejectLogInterval is the minimum interval between log messages for
+// rejected transactions with the same reason.  Rejections in between are
+// counted and reported with the next message.
+const defaultTxRejectLogInterval = 10 * time.Second
+
+// TxRejectReason classifies why a transaction received from a peer was
+// rejected.
+type TxRejectReason uint8
+
+// These constants define the classes of transaction rejections.
+const (
+	// TxRejectInvalid indicates the transaction violates a consensus or
+	// policy rule not covered by a more specific reason.
+	TxRejectInvalid TxRejectReason = iota
+
+	// TxRejectDoubleSpend indicates the transaction spends an output that
+	// is already spent by a transaction in the memory pool.
+	TxRejectDoubleSpend
+
+	// TxRejectNonStandard indicates the transaction is not standard.
+	TxRejectNonStandard
+
+	// TxRejectInsufficientFee indicates the transaction does not pay
+	// enough fees to be relayed or accepted.
+	TxRejectInsufficientFee
+
+	// TxRejectMissingInputs indicates the transaction spends outputs that
+	// are unknown or already spent in the main chain.
+	TxRejectMissingInputs
+
+	// TxRejectDuplicate indicates the transaction is already known.
+	TxRejectDuplicate
+
+	// numTxRejectReasons is the number of transaction rejection reasons.
+	// It must be the final entry.
+	numTxRejectReasons
+)
+
+// Map of TxRejectReason values back to their constant names for pretty
+// printing.
+var txRejectReasonStrings = map[TxRejectReason]string{
+	TxRejectInvalid:         "invalid",
+	TxRejectDoubleSpend:     "doublespend",
+	TxRejectNonStandard:     "nonstandard",
+	TxRejectInsufficientFee: "insufficientfee",
+	TxRejectMissingInputs:   "missinginputs",
+	TxRejectDuplicate:       "duplicate",
+}
+
+// String returns the TxRejectReason in human-readable form.
+func (r TxRejectReason) String() string {
+	if s, ok := txRejectReasonStrings[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown TxRejectReason (%d)", uint8(r))
+}
+
+// ParseTxRejectReason returns the TxRejectReason with the passed
+// human-readable name.
+func ParseTxRejectReason(name string) (TxRejectReason, error) {
+	for reason, s := range txRejectReasonStrings {
+		if strings.EqualFold(name, s) {
+			return reason, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown transaction reject reason %q", name)
+}
+
+// classifyTxReject returns the reason a transaction was rejected given the
+// rule error returned by the memory pool.
+func classifyTxReject(err error) TxRejectReason {
+	if rerr, ok := err.(mempool.RuleError); ok {
+		err = rerr.Err
+	}
+
+	switch err := err.(type) {
+	case blockchain.RuleError:
+		if err.ErrorCode == blockchain.ErrMissingTxOut {
+			return TxRejectMissingInputs
+		}
+
+	case mempool.TxRuleError:
+		switch err.RejectCode {
+		case wire.RejectNonstandard:
+			return TxRejectNonStandard
+
+		case wire.RejectInsufficientFee:
+			return TxRejectInsufficientFee
+
+		// The memory pool uses the duplicate code for double spends
+		// and missing inputs as well, so they are told apart by the
+		// error code.
+		case wire.RejectDuplicate:
+			switch err.ErrorCode {
+			case mempool.ErrDoubleSpend:
+				return TxRejectDoubleSpend
+			case mempool.ErrOrphanTx:
+				return TxRejectMissingInputs
+			}
+			return TxRejectDuplicate
+		}
+	}
+
+	return TxRejectInvalid
+}
+
+// txRejectLogger logs transactions rejected by the memory pool along with the
+// reason.  At most one message is logged per reason per interval and logging
+// can be disabled for individual reasons to reduce noise.
+//
+// It must only be used from the blockHandler goroutine.
+type txRejectLogger struct {
+	interval   time.Duration
+	disabled   [numTxRejectReasons]bool
+	lastLog    [numTxRejectReasons]time.Time
+	suppressed [numTxRejectReasons]int
+}
+
+// newTxRejectLogger returns a rejected transaction logger that does not log
+// rejections for any of the passed reasons.
+func newTxRejectLogger(interval time.Duration,
+	disabled []TxRejectReason) *txRejectLogger {
+
+	l := &txRejectLogger{interval: interval}
+	for _, reason := range disabled {
+		if reason < numTxRejectReasons {
+			l.disabled[reason] = true
+		}
+	}
+	return l
+}
+
+// logReject classifies the passed memory pool rule error and logs the
+// rejection of the transaction received from the peer unless logging is
+// disabled for the reason or a message for the same reason was logged too
+// recently.  It returns the classified reason.
+func (l *txRejectLogger) logReject(txHash *chainhash.Hash, peer *peerpkg.Peer,
+	err error) TxRejectReason {
+
+	reason := classifyTxReject(err)
+	if l.disabled[reason] {
+		return reason
+	}
+
+	now := time.Now()
+	if now.Sub(l.lastLog[reason]) < l.interval {
+		l.suppressed[reason]++
+		return reason
+	}
+
+	var suppressed string
+	if n := l.suppressed[reason]; n > 0 {
+		suppressed = fmt.Sprintf(" (%d more %s rejections since last "+
+			"report)", n, reason)
+	}
+	log.Debugf("Rejected %s transaction %v from %s: %v%s", reason, txHash,
+		peer, err, suppressed)
+	l.lastLog[reason] = now
+	l.suppressed[reason] = 0
+	return reason
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+)
+
+// txRejectTests houses memory pool rule errors along with the reason they are
+// expected to be classified as.
+var txRejectTests = []struct {
+	name   string
+	err    error
+	reason TxRejectReason
+}{{
+	name: "double spend",
+	err: mempool.RuleError{Err: mempool.TxRuleError{
+		RejectCode: wire.RejectDuplicate,
+		ErrorCode:  mempool.ErrDoubleSpend,
+		Description: "output 0000:0 already spent by transaction " +
+			"0001 in the memory pool",
+	}},
+	reason: TxRejectDoubleSpend,
+}, {
+	name: "non-standard",
+	err: mempool.RuleError{Err: mempool.TxRuleError{
+		RejectCode:  wire.RejectNonstandard,
+		Description: "transaction 0000 is not standard: dust",
+	}},
+	reason: TxRejectNonStandard,
+}, {
+	name: "insufficient fee",
+	err: mempool.RuleError{Err: mempool.TxRuleError{
+		RejectCode: wire.RejectInsufficientFee,
+		Description: "transaction 0000 has 0 fees which is under " +
+			"the required amount of 1000",
+	}},
+	reason: TxRejectInsufficientFee,
+}, {
+	name: "orphan with missing inputs",
+	err: mempool.RuleError{Err: mempool.TxRuleError{
+		RejectCode: wire.RejectDuplicate,
+		ErrorCode:  mempool.ErrOrphanTx,
+		Description: "orphan transaction 0000 references outputs " +
+			"of unknown or fully-spent transaction 0001",
+	}},
+	reason: TxRejectMissingInputs,
+}, {
+	name: "chain missing inputs",
+	err: mempool.RuleError{Err: blockchain.RuleError{
+		ErrorCode: blockchain.ErrMissingTxOut,
+		Description: "output 0000:0 referenced from transaction " +
+			"0001:0 either does not exist or has already been spent",
+	}},
+	reason: TxRejectMissingInputs,
+}, {
+	name: "duplicate",
+	err: mempool.RuleError{Err: mempool.TxRuleError{
+		RejectCode:  wire.RejectDuplicate,
+		Description: "already have transaction 0000",
+	}},
+	reason: TxRejectDuplicate,
+}, {
+	name: "invalid",
+	err: mempool.RuleError{Err: blockchain.RuleError{
+		ErrorCode:   blockchain.ErrBadTxOutValue,
+		Description: "transaction output has negative value",
+	}},
+	reason: TxRejectInvalid,
+}}
+
+// TestClassifyTxReject ensures memory pool rule errors are classified with
+// the expected rejection reason.
+func TestClassifyTxReject(t *testing.T) {
+	for _, test := range txRejectTests {
+		if reason := classifyTxReject(test.err); reason != test.reason {
+			t.Errorf("%s: got reason %v, want %v", test.name,
+				reason, test.reason)
+		}
+	}
+}
+
+// TestParseTxRejectReason ensures every rejection reason can be parsed back
+// from its name.
+func TestParseTxRejectReason(t *testing.T) {
+	for reason := TxRejectReason(0); reason < numTxRejectReasons; reason++ {
+		parsed, err := ParseTxRejectReason(strings.ToUpper(reason.String()))
+		if err != nil {
+			t.Fatalf("unable to parse %v: %v", reason, err)
+		}
+		if parsed != reason {
+			t.Fatalf("got reason %v, want %v", parsed, reason)
+		}
+	}
+	if _, err := ParseTxRejectReason("bogus"); err == nil {
+		t.Fatal("parsed unknown reason")
+	}
+}
+
+// TestTxRejectLogger ensures each rejection is logged with its reason, that
+// repeated rejections for the same reason are rate limited, and that
+// rejections for disabled reasons are not logged.
+func TestTxRejectLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := btclog.NewBackend(&buf).Logger("SYNC")
+	logger.SetLevel(btclog.LevelDebug)
+	UseLogger(logger)
+	defer DisableLog()
+
+	ctx := newTestContextWithConfig(t, newTestConfig(t))
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	txHash := chainhash.Hash{0x01}
+
+	l := newTxRejectLogger(time.Hour, []TxRejectReason{TxRejectDuplicate})
+	for _, test := range txRejectTests {
+		buf.Reset()
+		l.logReject(&txHash, peer.Peer, test.err)
+		want := "Rejected " + test.reason.String() + " transaction"
+		if test.reason == TxRejectDuplicate {
+			if buf.Len() != 0 {
+				t.Errorf("%s: logged disabled reason: %s",
+					test.name, buf.String())
+			}
+			continue
+		}
+		if test.name == "chain missing inputs" {
+			// The previous test already logged a missing inputs
+			// rejection, so this one is suppressed.
+			if buf.Len() != 0 {
+				t.Errorf("%s: rejection not rate limited: %s",
+					test.name, buf.String())
+			}
+			continue
+		}
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("%s: log %q does not contain %q", test.name,
+				buf.String(), want)
+		}
+	}
+
+	// Once the interval passes, the next rejection is logged along with
+	// the number suppressed in the meantime.
+	buf.Reset()
+	l.lastLog[TxRejectMissingInputs] = time.Time{}
+	l.logReject(&txHash, peer.Peer, txRejectTests[3].err)
+	if !strings.Contains(buf.String(), "1 more missinginputs rejections") {
+		t.Errorf("suppressed rejections not reported: %s", buf.String())
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// TxStatus describes where a transaction is known from.
+type TxStatus uint8
+
+// These constants define where a transaction is known from.
+const (
+	// TxStatusUnknown indicates the transaction is neither in the memory
+	// pool nor known to be confirmed.
+	TxStatusUnknown TxStatus = iota
+
+	// TxStatusMempool indicates the transaction is in the memory pool.
+	TxStatusMempool
+
+	// TxStatusConfirmed indicates the transaction is confirmed in a block
+	// of the main chain according to the transaction index.
+	TxStatusConfirmed
+)
+
+// Map of TxStatus values back to their constant names for pretty printing.
+var txStatusStrings = map[TxStatus]string{
+	TxStatusUnknown:   "unknown",
+	TxStatusMempool:   "mempool",
+	TxStatusConfirmed: "confirmed",
+}
+
+// String returns the TxStatus in human-readable form.
+func (s TxStatus) String() string {
+	if str, ok := txStatusStrings[s]; ok {
+		return str
+	}
+	return fmt.Sprintf("Unknown TxStatus (%d)", uint8(s))
+}
+
+// HaveTransaction returns whether the transaction with the passed hash is in
+// the memory pool, confirmed in a block of the main chain, or unknown.  Orphan
+// transactions are not considered to be in the memory pool.  Confirmed
+// transactions are looked up in the transaction index, so they are reported as
+// unknown when the sync manager was not configured with one.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) HaveTransaction(hash *chainhash.Hash) (TxStatus, error) {
+	if sm.txMemPool.IsTransactionInPool(hash) {
+		return TxStatusMempool, nil
+	}
+	if sm.txIndex == nil {
+		return TxStatusUnknown, nil
+	}
+	region, err := sm.txIndex.TxBlockRegion(hash)
+	if err != nil {
+		return TxStatusUnknown, err
+	}
+	if region == nil {
+		return TxStatusUnknown, nil
+	}
+	return TxStatusConfirmed, nil
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestHaveTransaction ensures transactions are reported as unknown, in the
+// memory pool, or confirmed according to where they are known from.
+func TestHaveTransaction(t *testing.T) {
+	ctx := newTestContextWithConfig(t, newTestConfigWithTxIndex(t))
+	noIndex := newTestContextWithConfig(t, newTestConfig(t))
+
+	// Mine enough blocks for the coinbase of the first one to mature.
+	var blocks []*btcutil.Block
+	for i := int32(0); i <= int32(ctx.params.CoinbaseMaturity); i++ {
+		block := ctx.createBlock(t)
+		_, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		_, _, err = noIndex.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("unable to process block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	assertStatus := func(ctx *testContext, tx *btcutil.Tx, want TxStatus) {
+		t.Helper()
+
+		got, err := ctx.sm.HaveTransaction(tx.Hash())
+		if err != nil {
+			t.Fatalf("unable to look up transaction: %v", err)
+		}
+		if got != want {
+			t.Fatalf("transaction %v is %v, want %v", tx.Hash(), got,
+				want)
+		}
+	}
+
+	// Confirmed transactions are only known with the transaction index.
+	coinbase := blocks[0].Transactions()[0]
+	assertStatus(ctx, coinbase, TxStatusConfirmed)
+	assertStatus(noIndex, coinbase, TxStatusUnknown)
+
+	// Spend the matured coinbase with a standard transaction, which is
+	// unknown until it is added to the memory pool.
+	sigScript, err := txscript.NewScriptBuilder().
+		AddData(opTrueScript).Script()
+	if err != nil {
+		t.Fatalf("unable to create signature script: %v", err)
+	}
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(coinbase.Hash(), 0),
+		SignatureScript:  sigScript,
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	msgTx.AddTxOut(&wire.TxOut{
+		Value:    coinbase.MsgTx().TxOut[0].Value - 10000,
+		PkScript: opTrueP2SHScript(t, ctx.params),
+	})
+	tx := btcutil.NewTx(msgTx)
+	assertStatus(ctx, tx, TxStatusUnknown)
+
+	for _, ctx := range []*testContext{ctx, noIndex} {
+		_, _, err = ctx.sm.txMemPool.MaybeAcceptTransaction(tx, true,
+			false)
+		if err != nil {
+			t.Fatalf("unable to add transaction to the pool: %v", err)
+		}
+		assertStatus(ctx, tx, TxStatusMempool)
+	}
+
+	// The transaction is confirmed once a block including it connects.
+	block := ctx.createBlockWithTxs(t, msgTx)
+	if _, _, err := ctx.chain.ProcessBlock(block, blockchain.BFNone); err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+	assertStatus(ctx, tx, TxStatusConfirmed)
+}
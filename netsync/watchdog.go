@@ -0,0 +1,100 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// defaultHandlerTimeout is the default time the block handler may go without
+// completing an iteration of its loop before it is considered stuck.  It is
+// deliberately generous since processing a single block can legitimately take
+// a long time on slow machines.
+const defaultHandlerTimeout = 15 * time.Minute
+
+// minWatchdogInterval is the minimum interval between the beats of an idle
+// block handler and between the checks of the watchdog, which otherwise run
+// four times per handler timeout.
+const minWatchdogInterval = 10 * time.Millisecond
+
+// heartbeat records the last time a handler goroutine made progress.  It is
+// safe for concurrent access.
+type heartbeat struct {
+	// lastBeat is the time of the last beat in unix nanoseconds or zero
+	// when the handler is idle on purpose and must not be considered
+	// stuck.
+	lastBeat int64
+}
+
+// beat records that the handler made progress.
+func (h *heartbeat) beat() {
+	atomic.StoreInt64(&h.lastBeat, time.Now().UnixNano())
+}
+
+// suspend stops the handler from being considered stuck until the next beat.
+func (h *heartbeat) suspend() {
+	atomic.StoreInt64(&h.lastBeat, 0)
+}
+
+// since returns the time elapsed since the last beat and whether the handler
+// is being watched.
+func (h *heartbeat) since() (time.Duration, bool) {
+	last := atomic.LoadInt64(&h.lastBeat)
+	if last == 0 {
+		return 0, false
+	}
+	return time.Since(time.Unix(0, last)), true
+}
+
+// watchdogInterval returns the interval between the beats of an idle block
+// handler and between the checks of the watchdog.
+func (sm *SyncManager) watchdogInterval() time.Duration {
+	interval := sm.handlerTimeout / 4
+	if interval < minWatchdogInterval {
+		interval = minWatchdogInterval
+	}
+	return interval
+}
+
+// watchdog periodically checks the heartbeat of the block handler and, if it
+// has not made progress within the handler timeout, logs the stacks of all
+// goroutines and invokes the stuck handler callback so the node can shut down
+// instead of silently failing to make progress.  It keeps watching until the
+// block handler exits, including while it drains the queued messages during
+// shutdown, so shutting down never waits for a stuck handler.  It must be run
+// as a goroutine.
+func (sm *SyncManager) watchdog() {
+	checkTicker := time.NewTicker(sm.watchdogInterval())
+	defer checkTicker.Stop()
+
+out:
+	for {
+		select {
+		case <-checkTicker.C:
+			elapsed, ok := sm.blockHandlerBeat.since()
+			if !ok || elapsed < sm.handlerTimeout {
+				continue
+			}
+
+			buf := make([]byte, 1<<20)
+			buf = buf[:runtime.Stack(buf, true)]
+			log.Criticalf("Block handler has not made progress in %v "+
+				"-- goroutine stacks:\n%s", elapsed, buf)
+			close(sm.stuck)
+			if sm.onHandlerStuck != nil {
+				sm.onHandlerStuck()
+			}
+			break out
+
+		case <-sm.done:
+			break out
+		}
+	}
+
+	sm.wg.Done()
+	log.Trace("Watchdog done")
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	peerpkg "github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestWatchdog ensures the watchdog reports a stuck block handler and does
+// not mistake a paused one for being stuck.
+func TestWatchdog(t *testing.T) {
+	const (
+		customInvType  = wire.InvType(0x7f)
+		handlerTimeout = 100 * time.Millisecond
+	)
+
+	// Simulate a deadlock in the block handler with an inventory handler
+	// that blocks until it is released.
+	release := make(chan struct{})
+	stuck := make(chan struct{})
+	cfg := newTestConfig(t)
+	cfg.Tuning.HandlerTimeout = handlerTimeout
+	cfg.InvHandlers = map[wire.InvType]InvHandler{
+		customInvType: func(peer *peerpkg.Peer, iv *wire.InvVect) {
+			<-release
+		},
+	}
+	cfg.OnHandlerStuck = func() { close(stuck) }
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.Start()
+	ctx.sm.NewPeer(peer.Peer)
+
+	// Pausing the handler for longer than the timeout must not trigger
+	// the watchdog.
+	unpause := ctx.sm.Pause()
+	time.Sleep(3 * handlerTimeout)
+	close(unpause)
+	select {
+	case <-stuck:
+		t.Fatal("paused handler reported as stuck")
+	case <-time.After(3 * handlerTimeout):
+	}
+
+	hash := chainhash.Hash{0x01}
+	inv := wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(customInvType, &hash))
+	ctx.sm.QueueInv(inv, peer.Peer)
+	select {
+	case <-stuck:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stuck handler not reported")
+	}
+
+	// Shutdown must not wait for the stuck handler.
+	stopped := make(chan struct{})
+	go func() {
+		ctx.sm.Stop()
+		ctx.sm.WaitForShutdown()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown waited for stuck handler")
+	}
+	close(release)
+}
+
+// TestWatchdogDuringShutdown ensures the watchdog keeps watching a block
+// handler that hangs once shutdown has begun so shutting down doesn't wait for
+// it forever.
+func TestWatchdogDuringShutdown(t *testing.T) {
+	const customInvType = wire.InvType(0x7f)
+
+	release := make(chan struct{})
+	defer close(release)
+	handling := make(chan struct{})
+	stuck := make(chan struct{})
+	cfg := newTestConfig(t)
+	cfg.Tuning.HandlerTimeout = 100 * time.Millisecond
+	cfg.InvHandlers = map[wire.InvType]InvHandler{
+		customInvType: func(peer *peerpkg.Peer, iv *wire.InvVect) {
+			close(handling)
+			<-release
+		},
+	}
+	cfg.OnHandlerStuck = func() { close(stuck) }
+	ctx := newTestContextWithConfig(t, cfg)
+	peer := newTestPeer(t, ctx.params, "127.0.0.1:18444", true)
+	ctx.sm.Start()
+	ctx.sm.NewPeer(peer.Peer)
+
+	hash := chainhash.Hash{0x01}
+	inv := wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(customInvType, &hash))
+	ctx.sm.QueueInv(inv, peer.Peer)
+	select {
+	case <-handling:
+	case <-time.After(5 * time.Second):
+		t.Fatal("inventory not handled")
+	}
+
+	// Shut down before the watchdog finds the handler stuck.
+	stopped := make(chan struct{})
+	go func() {
+		ctx.sm.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown waited for stuck handler")
+	}
+	select {
+	case <-stuck:
+	default:
+		t.Fatal("stuck handler not reported")
+	}
+}
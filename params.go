@@ -5,7 +5,10 @@
 package main
 
 import (
+	"time"
+
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/netsync"
 	"github.com/btcsuite/btcd/wire"
 )
 
@@ -17,7 +20,23 @@ var activeNetParams = &mainNetParams
 // network and test networks.
 type params struct {
 	*chaincfg.Params
-	rpcPort string
+	rpcPort    string
+	syncTuning netsync.Tuning
+
+	// allowNoVerify permits disabling the script verification of received
+	// blocks.  It is only permitted on local test networks, since blocks
+	// whose scripts were skipped could otherwise become the tip of a public
+	// chain.
+	allowNoVerify bool
+}
+
+// fastSyncTuning contains sync manager tuning suitable for local test networks
+// where blocks are generated on demand, so stalls are detected quickly and
+// progress is logged often.
+var fastSyncTuning = netsync.Tuning{
+	MaxStallDuration:    30 * time.Second,
+	StallSampleInterval: 5 * time.Second,
+	ProgressLogInterval: time.Second,
 }
 
 // mainNetParams contains parameters specific to the main network
@@ -29,6 +48,12 @@ type params struct {
 var mainNetParams = params{
 	Params:  &chaincfg.MainNetParams,
 	rpcPort: "8334",
+
+	// Main network blocks are large and plentiful, so allow more messages
+	// to queue up per peer.
+	syncTuning: netsync.Tuning{
+		MsgQueuePerPeer: 5,
+	},
 }
 
 // regressionNetParams contains parameters specific to the regression test
@@ -36,8 +61,10 @@ var mainNetParams = params{
 // than the reference implementation - see the mainNetParams comment for
 // details.
 var regressionNetParams = params{
-	Params:  &chaincfg.RegressionNetParams,
-	rpcPort: "18334",
+	Params:        &chaincfg.RegressionNetParams,
+	rpcPort:       "18334",
+	syncTuning:    fastSyncTuning,
+	allowNoVerify: true,
 }
 
 // testNet3Params contains parameters specific to the test network (version 3)
@@ -51,8 +78,10 @@ var testNet3Params = params{
 // simNetParams contains parameters specific to the simulation test network
 // (wire.SimNet).
 var simNetParams = params{
-	Params:  &chaincfg.SimNetParams,
-	rpcPort: "18556",
+	Params:        &chaincfg.SimNetParams,
+	rpcPort:       "18556",
+	syncTuning:    fastSyncTuning,
+	allowNoVerify: true,
 }
 
 // sigNetParams contains parameters specific to the Signet network
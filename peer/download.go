@@ -0,0 +1,105 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// DefaultExpectedBlockSize is the default size in bytes assumed for the
+	// blocks requested from a peer before any have been received from it.
+	DefaultExpectedBlockSize = 1000000
+
+	// DefaultMinBlockDownloadRate is the default minimum rate in bytes per
+	// second assumed for the delivery of blocks requested from a peer.
+	DefaultMinBlockDownloadRate = 100000
+
+	// downloadEstimateWeight is the weight given to each new observation
+	// when updating the moving averages of the block download estimate.
+	downloadEstimateWeight = 0.2
+)
+
+// blockDownloadEstimate tracks the sizes of the blocks received from a peer and
+// the rate at which they are delivered so the time allowed for requested
+// blocks to arrive scales with the expected block size and the bandwidth of
+// the peer.  It is only accessed from the stall handler.
+type blockDownloadEstimate struct {
+	// blockSize is the moving average of the sizes of the blocks received
+	// from the peer in bytes.
+	blockSize float64
+
+	// rate is the moving average of the measured delivery rate in bytes
+	// per second or zero when it has not been measured yet.
+	rate float64
+
+	// minRate is the lowest delivery rate assumed for the peer in bytes per
+	// second.  It is also used until the rate has been measured.
+	minRate float64
+}
+
+// newBlockDownloadEstimate returns a block download estimate that assumes the
+// passed block size and minimum delivery rate until blocks are received.
+func newBlockDownloadEstimate(blockSize, minRate uint32) *blockDownloadEstimate {
+	return &blockDownloadEstimate{
+		blockSize: float64(blockSize),
+		minRate:   float64(minRate),
+	}
+}
+
+// observe updates the estimate with a block of the passed size in bytes that
+// took the passed duration to be delivered.
+func (e *blockDownloadEstimate) observe(size int, elapsed time.Duration) {
+	e.blockSize += downloadEstimateWeight * (float64(size) - e.blockSize)
+	if elapsed <= 0 {
+		return
+	}
+	rate := float64(size) / elapsed.Seconds()
+	if e.rate == 0 {
+		e.rate = rate
+		return
+	}
+	e.rate += downloadEstimateWeight * (rate - e.rate)
+}
+
+// timeout returns the time allowed for a requested block of the passed size
+// in bytes to arrive.  It is the base response timeout extended by the time it
+// takes to transfer the block at the estimated delivery rate.
+func (e *blockDownloadEstimate) timeout(size float64) time.Duration {
+	rate := e.rate
+	if rate < e.minRate {
+		rate = e.minRate
+	}
+	if rate <= 0 {
+		return stallResponseTimeout
+	}
+	transfer := time.Duration(size / rate * float64(time.Second))
+	return stallResponseTimeout + transfer
+}
+
+// requestsBlocks returns whether the passed getdata message requests any
+// blocks.
+func requestsBlocks(msg *wire.MsgGetData) bool {
+	for _, iv := range msg.InvList {
+		switch iv.Type {
+		case wire.InvTypeBlock, wire.InvTypeWitnessBlock:
+			return true
+		}
+	}
+	return false
+}
+
+// getDataTimeout returns the time allowed for the response to the passed
+// getdata message to arrive.  Requests for blocks are allowed the time it takes
+// to transfer a block of the expected size in addition to the base response
+// timeout.
+func (e *blockDownloadEstimate) getDataTimeout(msg *wire.MsgGetData) time.Duration {
+	if !requestsBlocks(msg) {
+		return stallResponseTimeout
+	}
+	return e.timeout(e.blockSize)
+}
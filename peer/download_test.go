@@ -0,0 +1,70 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestBlockDownloadTimeout ensures the time allowed for requested blocks to
+// arrive scales with the expected block size and the measured delivery rate of
+// the peer.
+func TestBlockDownloadTimeout(t *testing.T) {
+	estimate := newBlockDownloadEstimate(DefaultExpectedBlockSize,
+		DefaultMinBlockDownloadRate)
+
+	// Larger blocks are allowed proportionally more time to transfer.
+	small := estimate.timeout(1000000) - stallResponseTimeout
+	large := estimate.timeout(2000000) - stallResponseTimeout
+	if small != 10*time.Second || large != 2*small {
+		t.Fatalf("transfer times are %v and %v, want 10s and 20s", small,
+			large)
+	}
+
+	// Only requests for blocks are given extra time.
+	blockReq := wire.NewMsgGetData()
+	blockReq.AddInvVect(wire.NewInvVect(wire.InvTypeWitnessBlock,
+		&chainhash.Hash{}))
+	txReq := wire.NewMsgGetData()
+	txReq.AddInvVect(wire.NewInvVect(wire.InvTypeTx, &chainhash.Hash{}))
+	if got := estimate.getDataTimeout(blockReq); got != stallResponseTimeout+small {
+		t.Fatalf("block request timeout is %v, want %v", got,
+			stallResponseTimeout+small)
+	}
+	if got := estimate.getDataTimeout(txReq); got != stallResponseTimeout {
+		t.Fatalf("tx request timeout is %v, want %v", got,
+			stallResponseTimeout)
+	}
+
+	// Peers measured to deliver blocks faster than the minimum rate are
+	// allowed less time, while slower measurements are limited to the
+	// minimum rate.
+	fast := newBlockDownloadEstimate(DefaultExpectedBlockSize,
+		DefaultMinBlockDownloadRate)
+	fast.observe(1000000, 100*time.Millisecond)
+	if got := fast.timeout(1000000) - stallResponseTimeout; got != 100*time.Millisecond {
+		t.Fatalf("transfer time from fast peer is %v, want 100ms", got)
+	}
+	slow := newBlockDownloadEstimate(DefaultExpectedBlockSize,
+		DefaultMinBlockDownloadRate)
+	slow.observe(1000000, time.Minute)
+	if got := slow.timeout(1000000) - stallResponseTimeout; got != small {
+		t.Fatalf("transfer time from slow peer is %v, want %v", got, small)
+	}
+
+	// The expected block size tracks the blocks received from the peer.
+	tiny := newBlockDownloadEstimate(DefaultExpectedBlockSize,
+		DefaultMinBlockDownloadRate)
+	for i := 0; i < 50; i++ {
+		tiny.observe(1000, 0)
+	}
+	if got := tiny.getDataTimeout(blockReq); got >= stallResponseTimeout+time.Second {
+		t.Fatalf("block request timeout after small blocks is %v", got)
+	}
+}
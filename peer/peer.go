@@ -46,9 +46,9 @@ const (
 	// message when trickling inventory to remote peers.
 	maxInvTrickleSize = 1000
 
-	// maxKnownInventory is the maximum number of items to keep in the known
-	// inventory cache.
-	maxKnownInventory = 1000
+	// DefaultMaxKnownInventory is the default maximum number of items to
+	// keep in the known inventory cache of each peer.
+	DefaultMaxKnownInventory = 1000
 
 	// pingInterval is the interval of time to wait in between sending ping
 	// messages.
@@ -200,6 +200,22 @@ type MessageListeners struct {
 	// message.
 	OnSendHeaders func(p *Peer, msg *wire.MsgSendHeaders)
 
+	// OnSendCmpct is invoked when a peer receives a sendcmpct bitcoin
+	// message.
+	OnSendCmpct func(p *Peer, msg *wire.MsgSendCmpct)
+
+	// OnCmpctBlock is invoked when a peer receives a cmpctblock bitcoin
+	// message.
+	OnCmpctBlock func(p *Peer, msg *wire.MsgCmpctBlock)
+
+	// OnGetBlockTxn is invoked when a peer receives a getblocktxn bitcoin
+	// message.
+	OnGetBlockTxn func(p *Peer, msg *wire.MsgGetBlockTxn)
+
+	// OnBlockTxn is invoked when a peer receives a blocktxn bitcoin
+	// message.
+	OnBlockTxn func(p *Peer, msg *wire.MsgBlockTxn)
+
 	// OnSendAddrV2 is invoked when a peer receives a sendaddrv2 message.
 	OnSendAddrV2 func(p *Peer, msg *wire.MsgSendAddrV2)
 
@@ -278,6 +294,28 @@ type Config struct {
 	// inventory to a peer.
 	TrickleInterval time.Duration
 
+	// MaxKnownInventory is the maximum number of items to keep in the cache
+	// of inventory the peer is known to have.  The least recently used
+	// items are evicted once the cache is full, which bounds the memory
+	// used by long-lived peers at the cost of occasionally announcing
+	// inventory the peer already has.  A value of zero uses
+	// DefaultMaxKnownInventory.
+	MaxKnownInventory uint
+
+	// ExpectedBlockSize is the size in bytes assumed for the blocks
+	// requested from the peer before any have been received from it.  The
+	// time allowed for requested blocks to arrive is scaled by the expected
+	// block size, which tracks the sizes of the blocks received from the
+	// peer.  A value of zero uses DefaultExpectedBlockSize.
+	ExpectedBlockSize uint32
+
+	// MinBlockDownloadRate is the lowest rate in bytes per second assumed
+	// for the delivery of blocks requested from the peer.  It is used until
+	// the rate at which the peer delivers blocks has been measured, and
+	// prevents timeouts from growing unbounded on slow measurements.  A
+	// value of zero uses DefaultMinBlockDownloadRate.
+	MinBlockDownloadRate uint32
+
 	// AllowSelfConns is only used to allow the tests to bypass the self
 	// connection detecting and disconnect logic since they intentionally
 	// do so for testing purposes.
@@ -459,6 +497,8 @@ type Peer struct {
 	advertisedProtoVer   uint32 // protocol version advertised by remote
 	protocolVersion      uint32 // negotiated protocol version
 	sendHeadersPreferred bool   // peer sent a sendheaders message
+	cmpctBlocks          bool   // peer supports witness compact blocks
+	cmpctAnnounce        bool   // peer wants cmpctblock announcements
 	verAckReceived       bool
 	witnessEnabled       bool
 	sendAddrV2           bool
@@ -532,11 +572,20 @@ func (p *Peer) UpdateLastAnnouncedBlock(blkHash *chainhash.Hash) {
 }
 
 // AddKnownInventory adds the passed inventory to the cache of known inventory
-// for the peer.
+// for the peer.  The inventory is cached by value so later lookups match
+// regardless of which copy of the inventory vector is used.
 //
 // This function is safe for concurrent access.
 func (p *Peer) AddKnownInventory(invVect *wire.InvVect) {
-	p.knownInventory.Add(invVect)
+	p.knownInventory.Add(*invVect)
+}
+
+// HasKnownInventory returns whether the passed inventory is in the cache of
+// known inventory for the peer.
+//
+// This function is safe for concurrent access.
+func (p *Peer) HasKnownInventory(invVect *wire.InvVect) bool {
+	return p.knownInventory.Contains(*invVect)
 }
 
 // StatsSnapshot returns a snapshot of the current peer flags and statistics.
@@ -815,6 +864,30 @@ func (p *Peer) WantsHeaders() bool {
 	return sendHeadersPreferred
 }
 
+// SupportsCmpctBlocks returns whether the peer signalled support for the
+// witness version of compact block relay with a sendcmpct message.
+//
+// This function is safe for concurrent access.
+func (p *Peer) SupportsCmpctBlocks() bool {
+	p.flagsMtx.Lock()
+	cmpctBlocks := p.cmpctBlocks
+	p.flagsMtx.Unlock()
+
+	return cmpctBlocks
+}
+
+// WantsCmpctBlocks returns whether the peer wants new blocks announced with
+// cmpctblock messages instead of inventory vectors or headers.
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsCmpctBlocks() bool {
+	p.flagsMtx.Lock()
+	cmpctAnnounce := p.cmpctBlocks && p.cmpctAnnounce
+	p.flagsMtx.Unlock()
+
+	return cmpctAnnounce
+}
+
 // IsWitnessEnabled returns true if the peer has signalled that it supports
 // segregated witness.
 //
@@ -1191,8 +1264,12 @@ func (p *Peer) shouldHandleReadError(err error) bool {
 }
 
 // maybeAddDeadline potentially adds a deadline for the appropriate expected
-// response for the passed wire protocol command to the pending responses map.
-func (p *Peer) maybeAddDeadline(pendingResponses map[string]time.Time, msgCmd string) {
+// response for the passed wire protocol message to the pending responses map.
+// The deadline for requested blocks is scaled by the passed block download
+// estimate.
+func (p *Peer) maybeAddDeadline(pendingResponses map[string]time.Time,
+	msg wire.Message, estimate *blockDownloadEstimate) {
+
 	// Setup a deadline for each message being sent that expects a response.
 	//
 	// NOTE: Pings are intentionally ignored here since they are typically
@@ -1200,7 +1277,7 @@ func (p *Peer) maybeAddDeadline(pendingResponses map[string]time.Time, msgCmd st
 	// such as is typical in the case of initial block download, the
 	// response won't be received in time.
 	deadline := time.Now().Add(stallResponseTimeout)
-	switch msgCmd {
+	switch msg.Command() {
 	case wire.CmdVersion:
 		// Expects a verack message.
 		pendingResponses[wire.CmdVerAck] = deadline
@@ -1214,7 +1291,12 @@ func (p *Peer) maybeAddDeadline(pendingResponses map[string]time.Time, msgCmd st
 		pendingResponses[wire.CmdInv] = deadline
 
 	case wire.CmdGetData:
-		// Expects a block, merkleblock, tx, or notfound message.
+		// Expects a block, merkleblock, cmpctblock, tx, or notfound
+		// message.  Allow more time for blocks since they take longer to
+		// deliver the larger they are and the slower the peer is.
+		if getData, ok := msg.(*wire.MsgGetData); ok {
+			deadline = time.Now().Add(estimate.getDataTimeout(getData))
+		}
 		pendingResponses[wire.CmdBlock] = deadline
 		pendingResponses[wire.CmdMerkleBlock] = deadline
 		pendingResponses[wire.CmdTx] = deadline
@@ -1226,6 +1308,10 @@ func (p *Peer) maybeAddDeadline(pendingResponses map[string]time.Time, msgCmd st
 		// headers.
 		deadline = time.Now().Add(stallResponseTimeout * 3)
 		pendingResponses[wire.CmdHeaders] = deadline
+
+	case wire.CmdGetBlockTxn:
+		// Expects a blocktxn message.
+		pendingResponses[wire.CmdBlockTxn] = deadline
 	}
 }
 
@@ -1245,6 +1331,14 @@ func (p *Peer) stallHandler() {
 	// pendingResponses tracks the expected response deadline times.
 	pendingResponses := make(map[string]time.Time)
 
+	// These variables are used to measure the rate at which the peer
+	// delivers blocks.  A block is considered to be in transit since the
+	// later of when it was requested and when the previous handler
+	// completed, since the next message isn't read until then.
+	estimate := newBlockDownloadEstimate(p.cfg.ExpectedBlockSize,
+		p.cfg.MinBlockDownloadRate)
+	var lastBlockRequest, lastHandlerDone time.Time
+
 	// stallTicker is used to periodically check pending responses that have
 	// exceeded the expected deadline and disconnect the peer due to
 	// stalling.
@@ -1267,18 +1361,34 @@ out:
 				// Add a deadline for the expected response
 				// message if needed.
 				p.maybeAddDeadline(pendingResponses,
-					msg.message.Command())
+					msg.message, estimate)
+				getData, ok := msg.message.(*wire.MsgGetData)
+				if ok && requestsBlocks(getData) {
+					lastBlockRequest = time.Now()
+				}
 
 			case sccReceiveMessage:
 				// Remove received messages from the expected
 				// response map.  Since certain commands expect
 				// one of a group of responses, remove
 				// everything in the expected group accordingly.
+				if block, ok := msg.message.(*wire.MsgBlock); ok {
+					start := lastBlockRequest
+					if lastHandlerDone.After(start) {
+						start = lastHandlerDone
+					}
+					if !start.IsZero() {
+						estimate.observe(block.SerializeSize(),
+							time.Since(start))
+					}
+				}
 				switch msgCmd := msg.message.Command(); msgCmd {
 				case wire.CmdBlock:
 					fallthrough
 				case wire.CmdMerkleBlock:
 					fallthrough
+				case wire.CmdCmpctBlock:
+					fallthrough
 				case wire.CmdTx:
 					fallthrough
 				case wire.CmdNotFound:
@@ -1317,6 +1427,7 @@ out:
 				duration := time.Since(handlersStartTime)
 				deadlineOffset += duration
 				handlerActive = false
+				lastHandlerDone = time.Now()
 
 			default:
 				log.Warnf("Unsupported message command %v",
@@ -1413,11 +1524,11 @@ out:
 			}
 
 			// Since the protocol version is 70016 but we don't
-			// implement compact blocks, we have to ignore unknown
-			// messages after the version-verack handshake. This
-			// matches bitcoind's behavior and is necessary since
-			// compact blocks negotiation occurs after the
-			// handshake.
+			// implement every message introduced up to it, such as
+			// wtxidrelay, we have to ignore unknown messages after
+			// the version-verack handshake. This matches bitcoind's
+			// behavior and is necessary since such negotiation
+			// occurs after the handshake.
 			if err == wire.ErrUnknownMessage {
 				log.Debugf("Received unknown message from %s:"+
 					" %v", p, err)
@@ -1612,6 +1723,36 @@ out:
 				p.cfg.Listeners.OnSendHeaders(p, msg)
 			}
 
+		case *wire.MsgSendCmpct:
+			// Only the witness version of compact block relay is
+			// supported, so signals for other versions are
+			// ignored.
+			if msg.Version == wire.CmpctVersionWitness {
+				p.flagsMtx.Lock()
+				p.cmpctBlocks = true
+				p.cmpctAnnounce = msg.Announce
+				p.flagsMtx.Unlock()
+			}
+
+			if p.cfg.Listeners.OnSendCmpct != nil {
+				p.cfg.Listeners.OnSendCmpct(p, msg)
+			}
+
+		case *wire.MsgCmpctBlock:
+			if p.cfg.Listeners.OnCmpctBlock != nil {
+				p.cfg.Listeners.OnCmpctBlock(p, msg)
+			}
+
+		case *wire.MsgGetBlockTxn:
+			if p.cfg.Listeners.OnGetBlockTxn != nil {
+				p.cfg.Listeners.OnGetBlockTxn(p, msg)
+			}
+
+		case *wire.MsgBlockTxn:
+			if p.cfg.Listeners.OnBlockTxn != nil {
+				p.cfg.Listeners.OnBlockTxn(p, msg)
+			}
+
 		default:
 			log.Debugf("Received unhandled message of type %v "+
 				"from %v", rmsg.Command(), p)
@@ -1718,7 +1859,7 @@ out:
 
 				// Don't send inventory that became known after
 				// the initial check.
-				if p.knownInventory.Contains(iv) {
+				if p.HasKnownInventory(iv) {
 					continue
 				}
 
@@ -1924,7 +2065,7 @@ func (p *Peer) QueueMessageWithEncoding(msg wire.Message, doneChan chan<- struct
 func (p *Peer) QueueInventory(invVect *wire.InvVect) {
 	// Don't add the inventory to the send queue if the peer is already
 	// known to have it.
-	if p.knownInventory.Contains(invVect) {
+	if p.HasKnownInventory(invVect) {
 		return
 	}
 
@@ -2384,10 +2525,23 @@ func newPeerBase(origCfg *Config, inbound bool) *Peer {
 		cfg.TrickleInterval = DefaultTrickleInterval
 	}
 
+	// Set the known inventory cache size if none is specified.
+	if cfg.MaxKnownInventory == 0 {
+		cfg.MaxKnownInventory = DefaultMaxKnownInventory
+	}
+
+	// Set the block download estimate defaults if none are specified.
+	if cfg.ExpectedBlockSize == 0 {
+		cfg.ExpectedBlockSize = DefaultExpectedBlockSize
+	}
+	if cfg.MinBlockDownloadRate == 0 {
+		cfg.MinBlockDownloadRate = DefaultMinBlockDownloadRate
+	}
+
 	p := Peer{
 		inbound:         inbound,
 		wireEncoding:    wire.BaseEncoding,
-		knownInventory:  lru.NewCache(maxKnownInventory),
+		knownInventory:  lru.NewCache(cfg.MaxKnownInventory),
 		stallControl:    make(chan stallControlMsg, 1), // nonblocking sync
 		outputQueue:     make(chan outMsg, outputBufferSize),
 		sendQueue:       make(chan outMsg, 1),   // nonblocking sync
@@ -355,7 +355,7 @@ func TestPeerConnection(t *testing.T) {
 // TestPeerListeners tests that the peer listeners are called as expected.
 func TestPeerListeners(t *testing.T) {
 	verack := make(chan struct{}, 1)
-	ok := make(chan wire.Message, 22)
+	ok := make(chan wire.Message, 26)
 	peerCfg := &peer.Config{
 		Listeners: peer.MessageListeners{
 			OnGetAddr: func(p *peer.Peer, msg *wire.MsgGetAddr) {
@@ -443,6 +443,18 @@ func TestPeerListeners(t *testing.T) {
 			OnSendHeaders: func(p *peer.Peer, msg *wire.MsgSendHeaders) {
 				ok <- msg
 			},
+			OnSendCmpct: func(p *peer.Peer, msg *wire.MsgSendCmpct) {
+				ok <- msg
+			},
+			OnCmpctBlock: func(p *peer.Peer, msg *wire.MsgCmpctBlock) {
+				ok <- msg
+			},
+			OnGetBlockTxn: func(p *peer.Peer, msg *wire.MsgGetBlockTxn) {
+				ok <- msg
+			},
+			OnBlockTxn: func(p *peer.Peer, msg *wire.MsgBlockTxn) {
+				ok <- msg
+			},
 			OnSendAddrV2: func(p *peer.Peer, msg *wire.MsgSendAddrV2) {
 				ok <- msg
 			},
@@ -599,6 +611,23 @@ func TestPeerListeners(t *testing.T) {
 			"OnSendHeaders",
 			wire.NewMsgSendHeaders(),
 		},
+		{
+			"OnSendCmpct",
+			wire.NewMsgSendCmpct(true, wire.CmpctVersionWitness),
+		},
+		{
+			"OnCmpctBlock",
+			wire.NewMsgCmpctBlock(wire.NewBlockHeader(1,
+				&chainhash.Hash{}, &chainhash.Hash{}, 1, 1), 1),
+		},
+		{
+			"OnGetBlockTxn",
+			wire.NewMsgGetBlockTxn(&chainhash.Hash{}, []uint32{0}),
+		},
+		{
+			"OnBlockTxn",
+			wire.NewMsgBlockTxn(&chainhash.Hash{}, nil),
+		},
 		{
 			"OnSendAddrV2",
 			wire.NewMsgSendAddrV2(),
@@ -619,6 +648,11 @@ func TestPeerListeners(t *testing.T) {
 			return
 		}
 	}
+
+	// Ensure the sendcmpct message was recorded.
+	if !inPeer.SupportsCmpctBlocks() || !inPeer.WantsCmpctBlocks() {
+		t.Errorf("TestPeerListeners: sendcmpct not recorded")
+	}
 	inPeer.Disconnect()
 	outPeer.Disconnect()
 }
@@ -1209,3 +1243,36 @@ func TestSendAddrV2Handshake(t *testing.T) {
 		outPeer.WaitForDisconnect()
 	}
 }
+
+// TestKnownInventoryEviction ensures the known inventory cache of a peer is
+// capped at the configured size by evicting the least recently used items.
+func TestKnownInventoryEviction(t *testing.T) {
+	const maxKnownInventory = 10
+	p := peer.NewInboundPeer(&peer.Config{
+		ChainParams:       &chaincfg.MainNetParams,
+		MaxKnownInventory: maxKnownInventory,
+	})
+
+	newInvVect := func(i int) *wire.InvVect {
+		return wire.NewInvVect(wire.InvTypeTx, &chainhash.Hash{byte(i)})
+	}
+	const numItems = 2 * maxKnownInventory
+	for i := 0; i < numItems; i++ {
+		p.AddKnownInventory(newInvVect(i))
+
+		// Keep the first item recently used so it is not evicted.
+		if !p.HasKnownInventory(newInvVect(0)) {
+			t.Fatalf("recently used item evicted after adding %d "+
+				"items", i+1)
+		}
+	}
+
+	// The oldest items other than the one that was kept recently used
+	// must have been evicted while the newest ones remain.
+	for i := 1; i < numItems; i++ {
+		want := i > numItems-maxKnownInventory
+		if got := p.HasKnownInventory(newInvVect(i)); got != want {
+			t.Fatalf("item %d known: got %v, want %v", i, got, want)
+		}
+	}
+}
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"io"
 	"sync/atomic"
 
 	"github.com/btcsuite/btcd/blockchain"
@@ -260,6 +261,16 @@ func (b *rpcSyncMgr) SubmitBlock(block *btcutil.Block, flags blockchain.Behavior
 	return b.syncMgr.ProcessBlock(block, flags)
 }
 
+// SubmitBlockBytes decodes a serialized block from the provided reader and
+// submits it to the network after processing it locally.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverSyncManager interface implementation.
+func (b *rpcSyncMgr) SubmitBlockBytes(r io.Reader) (*btcutil.Block, error) {
+	block, _, err := b.syncMgr.SubmitBlockBytes(r)
+	return block, err
+}
+
 // Pause pauses the sync manager until the returned channel is closed.
 //
 // This function is safe for concurrent access and is part of the
@@ -286,3 +297,12 @@ func (b *rpcSyncMgr) SyncPeerID() int32 {
 func (b *rpcSyncMgr) LocateHeaders(locators []*chainhash.Hash, hashStop *chainhash.Hash) []wire.BlockHeader {
 	return b.server.chain.LocateHeaders(locators, hashStop)
 }
+
+// Difficulty returns the proof-of-work difficulty of the best chain tip as a
+// multiple of the minimum difficulty of the network.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverSyncManager interface implementation.
+func (b *rpcSyncMgr) Difficulty() float64 {
+	return b.syncMgr.Difficulty()
+}
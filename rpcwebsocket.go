@@ -26,6 +26,7 @@ import (
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/websocket"
@@ -66,11 +67,13 @@ var wsHandlersBeforeInit = map[string]wsCommandHandler{
 	"loadtxfilter":              handleLoadTxFilter,
 	"help":                      handleWebsocketHelp,
 	"notifyblocks":              handleNotifyBlocks,
+	"notifydoublespends":        handleNotifyDoubleSpends,
 	"notifynewtransactions":     handleNotifyNewTransactions,
 	"notifyreceived":            handleNotifyReceived,
 	"notifyspent":               handleNotifySpent,
 	"session":                   handleSession,
 	"stopnotifyblocks":          handleStopNotifyBlocks,
+	"stopnotifydoublespends":    handleStopNotifyDoubleSpends,
 	"stopnotifynewtransactions": handleStopNotifyNewTransactions,
 	"stopnotifyspent":           handleStopNotifySpent,
 	"stopnotifyreceived":        handleStopNotifyReceived,
@@ -246,6 +249,19 @@ func (m *wsNotificationManager) NotifyMempoolTx(tx *btcutil.Tx, isNew bool) {
 	}
 }
 
+// NotifyDoubleSpend passes a double spend alert from the mempool to the
+// notification manager for double spend notification processing.
+func (m *wsNotificationManager) NotifyDoubleSpend(alert *mempool.DoubleSpendAlert) {
+	// As NotifyDoubleSpend will be called by the server and the RPC server
+	// may no longer be running, use a select statement to unblock
+	// enqueuing the notification once the RPC server has begun shutting
+	// down.
+	select {
+	case m.queueNotification <- (*notificationDoubleSpend)(alert):
+	case <-m.quit:
+	}
+}
+
 // wsClientFilter tracks relevant addresses for each websocket client for
 // the `rescanblocks` extension. It is modified by the `loadtxfilter` command.
 //
@@ -451,6 +467,7 @@ type notificationTxAcceptedByMempool struct {
 	isNew bool
 	tx    *btcutil.Tx
 }
+type notificationDoubleSpend mempool.DoubleSpendAlert
 
 // Notification control requests
 type notificationRegisterClient wsClient
@@ -459,6 +476,8 @@ type notificationRegisterBlocks wsClient
 type notificationUnregisterBlocks wsClient
 type notificationRegisterNewMempoolTxs wsClient
 type notificationUnregisterNewMempoolTxs wsClient
+type notificationRegisterDoubleSpends wsClient
+type notificationUnregisterDoubleSpends wsClient
 type notificationRegisterSpent struct {
 	wsc *wsClient
 	ops []*wire.OutPoint
@@ -491,6 +510,7 @@ func (m *wsNotificationManager) notificationHandler() {
 	// since it is quite a bit more efficient than using the entire struct.
 	blockNotifications := make(map[chan struct{}]*wsClient)
 	txNotifications := make(map[chan struct{}]*wsClient)
+	doubleSpendNotifications := make(map[chan struct{}]*wsClient)
 	watchedOutPoints := make(map[wire.OutPoint]map[chan struct{}]*wsClient)
 	watchedAddrs := make(map[string]map[chan struct{}]*wsClient)
 
@@ -539,6 +559,13 @@ out:
 				m.notifyForTx(watchedOutPoints, watchedAddrs, n.tx, nil)
 				m.notifyRelevantTxAccepted(n.tx, clients)
 
+			case *notificationDoubleSpend:
+				if len(doubleSpendNotifications) != 0 {
+					alert := (*mempool.DoubleSpendAlert)(n)
+					m.notifyDoubleSpend(doubleSpendNotifications,
+						alert)
+				}
+
 			case *notificationRegisterBlocks:
 				wsc := (*wsClient)(n)
 				blockNotifications[wsc.quit] = wsc
@@ -557,6 +584,7 @@ out:
 				// the client itself.
 				delete(blockNotifications, wsc.quit)
 				delete(txNotifications, wsc.quit)
+				delete(doubleSpendNotifications, wsc.quit)
 				for k := range wsc.spentRequests {
 					op := k
 					m.removeSpentRequest(watchedOutPoints, wsc, &op)
@@ -586,6 +614,14 @@ out:
 				wsc := (*wsClient)(n)
 				delete(txNotifications, wsc.quit)
 
+			case *notificationRegisterDoubleSpends:
+				wsc := (*wsClient)(n)
+				doubleSpendNotifications[wsc.quit] = wsc
+
+			case *notificationUnregisterDoubleSpends:
+				wsc := (*wsClient)(n)
+				delete(doubleSpendNotifications, wsc.quit)
+
 			default:
 				rpcsLog.Warn("Unhandled notification type")
 			}
@@ -868,6 +904,47 @@ func (m *wsNotificationManager) notifyForNewTx(clients map[chan struct{}]*wsClie
 	}
 }
 
+// RegisterDoubleSpendUpdates requests notifications to the passed websocket
+// client when a transaction spending outputs already spent in the memory pool
+// is received.
+func (m *wsNotificationManager) RegisterDoubleSpendUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationRegisterDoubleSpends)(wsc)
+}
+
+// UnregisterDoubleSpendUpdates removes double spend notifications to the
+// passed websocket client.
+func (m *wsNotificationManager) UnregisterDoubleSpendUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationUnregisterDoubleSpends)(wsc)
+}
+
+// notifyDoubleSpend notifies websocket clients that have registered for double
+// spend updates about the passed alert.
+func (m *wsNotificationManager) notifyDoubleSpend(clients map[chan struct{}]*wsClient,
+	alert *mempool.DoubleSpendAlert) {
+
+	conflicts := make([]btcjson.DoubleSpendConflict, 0, len(alert.Conflicts))
+	for _, c := range alert.Conflicts {
+		conflicts = append(conflicts, btcjson.DoubleSpendConflict{
+			OutPoint: btcjson.OutPoint{
+				Hash:  c.OutPoint.Hash.String(),
+				Index: c.OutPoint.Index,
+			},
+			ConflictTxID: c.PoolTx.String(),
+		})
+	}
+
+	ntfn := btcjson.NewDoubleSpendNtfn(alert.Tx.String(), conflicts)
+	marshalledJSON, err := btcjson.MarshalCmd(btcjson.RpcVersion1, nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal double spend notification: "+
+			"%v", err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // RegisterSpentRequests requests a notification when each of the passed
 // outpoints is confirmed spent (contained in a block connected to the main
 // chain) for the passed websocket client.  The request is automatically
@@ -2127,6 +2204,20 @@ func handleStopNotifyBlocks(wsc *wsClient, icmd interface{}) (interface{}, error
 	return nil, nil
 }
 
+// handleNotifyDoubleSpends implements the notifydoublespends command extension
+// for websocket connections.
+func handleNotifyDoubleSpends(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.RegisterDoubleSpendUpdates(wsc)
+	return nil, nil
+}
+
+// handleStopNotifyDoubleSpends implements the stopnotifydoublespends command
+// extension for websocket connections.
+func handleStopNotifyDoubleSpends(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.UnregisterDoubleSpendUpdates(wsc)
+	return nil, nil
+}
+
 // handleNotifySpent implements the notifyspent command extension for
 // websocket connections.
 func handleNotifySpent(wsc *wsClient, icmd interface{}) (interface{}, error) {
@@ -14,6 +14,7 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"path/filepath"
 	"runtime"
 	"sort"
 	"strconv"
@@ -58,6 +59,24 @@ const (
 	// retries when connecting to persistent peers.  It is adjusted by the
 	// number of retries such that there is a retry backoff.
 	connectionRetryInterval = time.Second * 5
+
+	// banListFilename is the name of the file in the data directory that
+	// stores banned peers so bans survive restarts.
+	banListFilename = "banlist.json"
+
+	// maxCmpctBlockDepth is the maximum depth below the best chain tip of
+	// blocks that are served as compact blocks.  Deeper blocks are sent in
+	// full since peers are unlikely to have their transactions.
+	maxCmpctBlockDepth = 5
+
+	// maxBlockTxnDepth is the maximum depth below the best chain tip of
+	// blocks whose transactions are served in response to getblocktxn
+	// messages.  Deeper blocks are sent in full instead.
+	maxBlockTxnDepth = 10
+
+	// maxLoggedUtxoDiscrepancies is the maximum number of discrepancies
+	// logged individually after auditing the utxo set.
+	maxLoggedUtxoDiscrepancies = 100
 )
 
 var (
@@ -152,12 +171,11 @@ type updatePeerHeightsMsg struct {
 }
 
 // peerState maintains state of inbound, persistent, outbound peers as well
-// as banned peers and outbound groups.
+// as outbound groups.
 type peerState struct {
 	inboundPeers    map[int32]*serverPeer
 	outboundPeers   map[int32]*serverPeer
 	persistentPeers map[int32]*serverPeer
-	banned          map[string]time.Time
 	outboundGroups  map[string]int
 }
 
@@ -209,13 +227,17 @@ type server struct {
 	chainParams          *chaincfg.Params
 	addrManager          *addrmgr.AddrManager
 	connManager          *connmgr.ConnManager
+	banList              *connmgr.BanList
 	sigCache             *txscript.SigCache
 	hashCache            *txscript.HashCache
 	rpcServer            *rpcServer
 	syncManager          *netsync.SyncManager
+	blockJournal         *netsync.BlockJournal
+	blockExporter        *netsync.BlockExporter
 	chain                *blockchain.BlockChain
 	txMemPool            *mempool.TxPool
 	cpuMiner             *cpuminer.CPUMiner
+	templateGenerator    *mining.BlkTmplGenerator
 	modifyRebroadcastInv chan interface{}
 	newPeers             chan *serverPeer
 	donePeers            chan *serverPeer
@@ -224,10 +246,13 @@ type server struct {
 	relayInv             chan relayMsg
 	broadcast            chan broadcastMsg
 	peerHeightsUpdate    chan updatePeerHeightsMsg
+	readResume           map[*peer.Peer]chan struct{}
+	readResumeMtx        sync.Mutex
 	wg                   sync.WaitGroup
 	quit                 chan struct{}
 	nat                  NAT
 	db                   database.DB
+	dbMtx                sync.RWMutex
 	timeSource           blockchain.MedianTimeSource
 	services             wire.ServiceFlag
 
@@ -248,6 +273,13 @@ type server struct {
 	cfCheckptCaches    map[wire.FilterType][]cfHeaderKV
 	cfCheckptCachesMtx sync.RWMutex
 
+	// bestBlockHash and bestBlockHeight are the tip of the main chain that
+	// is advertised as the start height to peers when they connect.  They
+	// are updated by the sync manager each time the tip changes.
+	bestBlockMtx    sync.RWMutex
+	bestBlockHash   chainhash.Hash
+	bestBlockHeight int32
+
 	// agentBlacklist is a list of blacklisted substrings by which to filter
 	// user agents.
 	agentBlacklist []string
@@ -261,7 +293,8 @@ type server struct {
 // the blockmanager.
 type serverPeer struct {
 	// The following variables must only be used atomically
-	feeFilter int64
+	feeFilter  int64
+	negotiated int32
 
 	*peer.Peer
 
@@ -297,11 +330,42 @@ func newServerPeer(s *server, isPersistent bool) *serverPeer {
 	}
 }
 
+// setNegotiated marks the peer as having completed the version handshake and
+// been handed to the sync manager.
+func (sp *serverPeer) setNegotiated() {
+	atomic.StoreInt32(&sp.negotiated, 1)
+}
+
+// isNegotiated returns whether the peer has completed the version handshake
+// and been handed to the sync manager.
+func (sp *serverPeer) isNegotiated() bool {
+	return atomic.LoadInt32(&sp.negotiated) != 0
+}
+
+// requireNegotiated returns whether the peer has been handed to the sync
+// manager.  Otherwise, the peer sent the passed message before it was known to
+// the sync manager, so its ban score is increased and the message must be
+// dropped.  Only a small decaying score is applied since well behaved peers
+// may occasionally race the server accepting them.
+func (sp *serverPeer) requireNegotiated(command string) bool {
+	if sp.isNegotiated() {
+		return true
+	}
+
+	peerLog.Debugf("Dropping %s from %v received before the handshake "+
+		"completed", command, sp)
+	sp.addBanScore(0, 10, fmt.Sprintf("%s before handshake", command))
+	return false
+}
+
 // newestBlock returns the current best block hash and height using the format
 // required by the configuration for the peer package.
 func (sp *serverPeer) newestBlock() (*chainhash.Hash, int32, error) {
-	best := sp.server.chain.BestSnapshot()
-	return &best.Hash, best.Height, nil
+	s := sp.server
+	s.bestBlockMtx.RLock()
+	hash, height := s.bestBlockHash, s.bestBlockHeight
+	s.bestBlockMtx.RUnlock()
+	return &hash, height, nil
 }
 
 // addKnownAddresses adds the given addresses to the set of known addresses to
@@ -443,7 +507,7 @@ func (sp *serverPeer) addBanScore(persistent, transient uint32, reason string) b
 		if score > cfg.BanThreshold {
 			peerLog.Warnf("Misbehaving peer %s -- banning and disconnecting",
 				sp)
-			sp.server.BanPeer(sp)
+			sp.server.BanServerPeer(sp)
 			sp.Disconnect()
 			return true
 		}
@@ -531,6 +595,16 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) *wire.MsgRej
 // to kick start communication with them.
 func (sp *serverPeer) OnVerAck(_ *peer.Peer, _ *wire.MsgVerAck) {
 	sp.server.AddPeer(sp)
+
+	// Signal support for compact blocks so new blocks can be requested as
+	// such once the chain is current.  Nodes that only relay blocks don't
+	// benefit since they don't keep unconfirmed transactions.
+	if !cfg.BlocksOnly && sp.IsWitnessEnabled() &&
+		sp.ProtocolVersion() >= wire.CompactBlocksVersion {
+
+		sendCmpct := wire.NewMsgSendCmpct(false, wire.CmpctVersionWitness)
+		sp.QueueMessage(sendCmpct, nil)
+	}
 }
 
 // OnMemPool is invoked when a peer receives a mempool bitcoin message.
@@ -588,6 +662,10 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *wire.MsgMemPool) {
 // handler this does not serialize all transactions through a single thread
 // transactions don't rely on the previous one in a linear fashion like blocks.
 func (sp *serverPeer) OnTx(_ *peer.Peer, msg *wire.MsgTx) {
+	if !sp.requireNegotiated(wire.CmdTx) {
+		return
+	}
+
 	if cfg.BlocksOnly {
 		peerLog.Tracef("Ignoring tx %v from %v - blocksonly enabled",
 			msg.TxHash(), sp)
@@ -606,6 +684,7 @@ func (sp *serverPeer) OnTx(_ *peer.Peer, msg *wire.MsgTx) {
 	// processed and known good or bad.  This helps prevent a malicious peer
 	// from queuing up a bunch of bad transactions before disconnecting (or
 	// being disconnected) and wasting memory.
+	sp.waitForQueueSpace()
 	sp.server.syncManager.QueueTx(tx, sp.Peer, sp.txProcessed)
 	<-sp.txProcessed
 }
@@ -613,6 +692,10 @@ func (sp *serverPeer) OnTx(_ *peer.Peer, msg *wire.MsgTx) {
 // OnBlock is invoked when a peer receives a block bitcoin message.  It
 // blocks until the bitcoin block has been fully processed.
 func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
+	if !sp.requireNegotiated(wire.CmdBlock) {
+		return
+	}
+
 	// Convert the raw MsgBlock to a btcutil.Block which provides some
 	// convenience methods and things such as hash caching.
 	block := btcutil.NewBlockFromBlockAndBytes(msg, buf)
@@ -632,15 +715,85 @@ func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
 	// reference implementation processes blocks in the same
 	// thread and therefore blocks further messages until
 	// the bitcoin block has been fully processed.
+	sp.waitForQueueSpace()
 	sp.server.syncManager.QueueBlock(block, sp.Peer, sp.blockProcessed)
 	<-sp.blockProcessed
 }
 
+// OnCmpctBlock is invoked when a peer receives a cmpctblock bitcoin message.
+// The message is passed down to the sync manager, which reconstructs the
+// block.
+func (sp *serverPeer) OnCmpctBlock(_ *peer.Peer, msg *wire.MsgCmpctBlock) {
+	if !sp.requireNegotiated(wire.CmdCmpctBlock) {
+		return
+	}
+
+	hash := msg.Header.BlockHash()
+	sp.AddKnownInventory(wire.NewInvVect(wire.InvTypeBlock, &hash))
+	sp.server.syncManager.QueueCmpctBlock(msg, sp.Peer)
+}
+
+// OnBlockTxn is invoked when a peer receives a blocktxn bitcoin message.  The
+// message is passed down to the sync manager, which requested the
+// transactions to reconstruct a compact block.
+func (sp *serverPeer) OnBlockTxn(_ *peer.Peer, msg *wire.MsgBlockTxn) {
+	if !sp.requireNegotiated(wire.CmdBlockTxn) {
+		return
+	}
+
+	sp.server.syncManager.QueueBlockTxn(msg, sp.Peer)
+}
+
+// OnGetBlockTxn is invoked when a peer receives a getblocktxn bitcoin message.
+// It responds with the requested transactions of a recent block the peer is
+// reconstructing from a compact block, or with the full block when the block
+// is not recent.
+func (sp *serverPeer) OnGetBlockTxn(_ *peer.Peer, msg *wire.MsgGetBlockTxn) {
+	if !sp.requireNegotiated(wire.CmdGetBlockTxn) {
+		return
+	}
+
+	chain := sp.server.chain
+	block, err := chain.BlockByHash(&msg.BlockHash)
+	if err != nil {
+		peerLog.Debugf("Unable to fetch block %v requested by %v: %v",
+			msg.BlockHash, sp, err)
+		return
+	}
+	if chain.BestSnapshot().Height-block.Height() > maxBlockTxnDepth {
+		sp.server.pushBlockMsg(sp, &msg.BlockHash, nil, nil,
+			wire.WitnessEncoding)
+		return
+	}
+
+	txs := block.MsgBlock().Transactions
+	reqTxs := make([]*wire.MsgTx, 0, len(msg.Indexes))
+	for _, index := range msg.Indexes {
+		if int(index) >= len(txs) {
+			sp.addBanScore(100, 0, fmt.Sprintf("getblocktxn index "+
+				"%d beyond the %d transactions of block %v",
+				index, len(txs), msg.BlockHash))
+			return
+		}
+		reqTxs = append(reqTxs, txs[index])
+	}
+	blockTxn := wire.NewMsgBlockTxn(&msg.BlockHash, reqTxs)
+	sp.QueueMessageWithEncoding(blockTxn, nil, wire.WitnessEncoding)
+}
+
 // OnInv is invoked when a peer receives an inv bitcoin message and is
 // used to examine the inventory being advertised by the remote peer and react
 // accordingly.  We pass the message down to blockmanager which will call
 // QueueMessage with any appropriate responses.
 func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
+	if !sp.requireNegotiated(wire.CmdInv) {
+		return
+	}
+
+	// Hold off on reading more from the peer while the sync manager is
+	// falling behind.
+	sp.waitForQueueSpace()
+
 	if !cfg.BlocksOnly {
 		if len(msg.InvList) > 0 {
 			sp.server.syncManager.QueueInv(msg, sp.Peer)
@@ -676,6 +829,7 @@ func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
 // OnHeaders is invoked when a peer receives a headers bitcoin
 // message.  The message is passed down to the sync manager.
 func (sp *serverPeer) OnHeaders(_ *peer.Peer, msg *wire.MsgHeaders) {
+	sp.waitForQueueSpace()
 	sp.server.syncManager.QueueHeaders(msg, sp.Peer)
 }
 
@@ -723,6 +877,8 @@ func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
 			err = sp.server.pushBlockMsg(sp, &iv.Hash, c, waitChan, wire.WitnessEncoding)
 		case wire.InvTypeBlock:
 			err = sp.server.pushBlockMsg(sp, &iv.Hash, c, waitChan, wire.BaseEncoding)
+		case wire.InvTypeCmpctBlock:
+			err = sp.server.pushCmpctBlockMsg(sp, &iv.Hash, c, waitChan)
 		case wire.InvTypeFilteredWitnessBlock:
 			err = sp.server.pushMerkleBlockMsg(sp, &iv.Hash, c, waitChan, wire.WitnessEncoding)
 		case wire.InvTypeFilteredBlock:
@@ -1407,6 +1563,28 @@ func (sp *serverPeer) OnWrite(_ *peer.Peer, bytesWritten int, msg wire.Message,
 	sp.server.AddBytesSent(uint64(bytesWritten))
 }
 
+// OnReject is invoked when a peer sends a reject message.  The reason is logged
+// to aid debugging relay issues.  Rejected transactions and blocks are added to
+// the inventory known to the peer, so they are not announced to it again, such
+// as when our own transactions are rebroadcast.
+func (sp *serverPeer) OnReject(_ *peer.Peer, msg *wire.MsgReject) {
+	var invType wire.InvType
+	switch msg.Cmd {
+	case wire.CmdTx:
+		invType = wire.InvTypeTx
+	case wire.CmdBlock:
+		invType = wire.InvTypeBlock
+	default:
+		peerLog.Debugf("Peer %s rejected %s message: %v -- %s", sp,
+			msg.Cmd, msg.Code, msg.Reason)
+		return
+	}
+
+	peerLog.Debugf("Peer %s rejected %s %v: %v -- %s", sp, msg.Cmd,
+		msg.Hash, msg.Code, msg.Reason)
+	sp.AddKnownInventory(wire.NewInvVect(invType, &msg.Hash))
+}
+
 // OnNotFound is invoked when a peer sends a notfound message.
 func (sp *serverPeer) OnNotFound(p *peer.Peer, msg *wire.MsgNotFound) {
 	if !sp.Connected() {
@@ -1498,6 +1676,10 @@ func (s *server) relayTransactions(txns []*mempool.TxDesc) {
 	}
 }
 
+// Ensure server implements the netsync.PeerNotifier interface so the sync
+// manager only interacts with it through the interface.
+var _ netsync.PeerNotifier = (*server)(nil)
+
 // AnnounceNewTransactions generates and relays inventory vectors and notifies
 // both websocket and getblocktemplate long poll clients of the passed
 // transactions.  This function should be called whenever new transactions
@@ -1509,6 +1691,12 @@ func (s *server) AnnounceNewTransactions(txns []*mempool.TxDesc) {
 
 	// Notify both websocket and getblocktemplate long poll clients of all
 	// newly accepted transactions.
+	s.NotifyNewTransactions(txns)
+}
+
+// NotifyNewTransactions notifies both websocket and getblocktemplate long poll
+// clients of the passed transactions without relaying them to peers.
+func (s *server) NotifyNewTransactions(txns []*mempool.TxDesc) {
 	if s.rpcServer != nil {
 		s.rpcServer.NotifyNewTransactions(txns)
 	}
@@ -1526,6 +1714,47 @@ func (s *server) TransactionConfirmed(tx *btcutil.Tx) {
 	s.RemoveRebroadcastInventory(iv)
 }
 
+// QueueBackpressure pauses reading messages from the passed peer while the
+// messages queued from it are filling up the message queues of the sync manager
+// and resumes reading once they have drained.  Reading from other peers is not
+// affected.  It is invoked by the sync manager.
+func (s *server) QueueBackpressure(p *peer.Peer, asserted bool) {
+	s.readResumeMtx.Lock()
+	defer s.readResumeMtx.Unlock()
+
+	resume, paused := s.readResume[p]
+	switch {
+	case asserted && !paused:
+		peerLog.Debugf("Pausing reads from %v until the sync manager "+
+			"catches up", p)
+		s.readResume[p] = make(chan struct{})
+
+	case !asserted && paused:
+		peerLog.Debugf("Resuming reads from %v", p)
+		close(resume)
+		delete(s.readResume, p)
+	}
+}
+
+// waitForQueueSpace blocks while reading from the peer is paused due to
+// backpressure from the sync manager until reading resumes or the peer or
+// server is shutting down.  Since peer messages are read one at a time, calling
+// it from a message listener pauses reading from the peer.
+func (sp *serverPeer) waitForQueueSpace() {
+	sp.server.readResumeMtx.Lock()
+	resume := sp.server.readResume[sp.Peer]
+	sp.server.readResumeMtx.Unlock()
+	if resume == nil {
+		return
+	}
+
+	select {
+	case <-resume:
+	case <-sp.quit:
+	case <-sp.server.quit:
+	}
+}
+
 // pushTxMsg sends a tx message for the provided transaction hash to the
 // connected peer.  An error is returned if the transaction hash is not known.
 func (s *server) pushTxMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<- struct{},
@@ -1555,34 +1784,46 @@ func (s *server) pushTxMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<-
 	return nil
 }
 
-// pushBlockMsg sends a block message for the provided block hash to the
-// connected peer.  An error is returned if the block hash is not known.
-func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<- struct{},
-	waitChan <-chan struct{}, encoding wire.MessageEncoding) error {
-
-	// Fetch the raw block bytes from the database.
+// fetchBlockMsg loads the block with the passed hash from the database.  When
+// the chain has the block but its stored copy can't be read or deserialized,
+// the block is fetched through the sync manager instead, which reports the
+// corruption, downloads the block again and serves the downloaded copy once it
+// arrives.  The error from the database is returned until then so the block
+// is reported to the requesting peer as not found.
+func (s *server) fetchBlockMsg(hash *chainhash.Hash) (*wire.MsgBlock, error) {
 	var blockBytes []byte
-	err := sp.server.db.View(func(dbTx database.Tx) error {
+	err := s.blockDB().View(func(dbTx database.Tx) error {
 		var err error
 		blockBytes, err = dbTx.FetchBlock(hash)
 		return err
 	})
-	if err != nil {
-		peerLog.Tracef("Unable to fetch requested block hash %v: %v",
-			hash, err)
-
-		if doneChan != nil {
-			doneChan <- struct{}{}
+	if err == nil {
+		var msgBlock wire.MsgBlock
+		err = msgBlock.Deserialize(bytes.NewReader(blockBytes))
+		if err == nil {
+			return &msgBlock, nil
 		}
-		return err
 	}
+	if !s.chain.MainChainHasBlock(hash) {
+		return nil, err
+	}
+
+	block, fetchErr := s.syncManager.FetchBlock(hash)
+	if fetchErr != nil {
+		return nil, err
+	}
+	return block.MsgBlock(), nil
+}
+
+// pushBlockMsg sends a block message for the provided block hash to the
+// connected peer.  An error is returned if the block hash is not known.
+func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<- struct{},
+	waitChan <-chan struct{}, encoding wire.MessageEncoding) error {
 
-	// Deserialize the block.
-	var msgBlock wire.MsgBlock
-	err = msgBlock.Deserialize(bytes.NewReader(blockBytes))
+	msgBlock, err := s.fetchBlockMsg(hash)
 	if err != nil {
-		peerLog.Tracef("Unable to deserialize requested block hash "+
-			"%v: %v", hash, err)
+		peerLog.Tracef("Unable to fetch requested block hash %v: %v",
+			hash, err)
 
 		if doneChan != nil {
 			doneChan <- struct{}{}
@@ -1603,7 +1844,7 @@ func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan cha
 	if !sendInv {
 		dc = doneChan
 	}
-	sp.QueueMessageWithEncoding(&msgBlock, dc, encoding)
+	sp.QueueMessageWithEncoding(msgBlock, dc, encoding)
 
 	// When the peer requests the final block that was advertised in
 	// response to a getblocks message which requested more blocks than
@@ -1621,6 +1862,54 @@ func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan cha
 	return nil
 }
 
+// pushCmpctBlockMsg sends a cmpctblock message for the provided block hash to
+// the connected peer.  Blocks deeper than maxCmpctBlockDepth, and blocks
+// requested by peers that don't support witness compact blocks, are sent in
+// full instead.  An error is returned if the block hash is not known.
+func (s *server) pushCmpctBlockMsg(sp *serverPeer, hash *chainhash.Hash,
+	doneChan chan<- struct{}, waitChan <-chan struct{}) error {
+
+	if !sp.IsWitnessEnabled() {
+		return s.pushBlockMsg(sp, hash, doneChan, waitChan,
+			wire.BaseEncoding)
+	}
+
+	block, err := s.chain.BlockByHash(hash)
+	if err != nil {
+		peerLog.Tracef("Unable to fetch requested block hash %v: %v",
+			hash, err)
+
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+	if s.chain.BestSnapshot().Height-block.Height() > maxCmpctBlockDepth {
+		return s.pushBlockMsg(sp, hash, doneChan, waitChan,
+			wire.WitnessEncoding)
+	}
+
+	nonce, err := wire.RandomUint64()
+	if err != nil {
+		peerLog.Errorf("Unable to generate compact block nonce: %v",
+			err)
+
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+
+	// Once we have fetched data wait for any previous operation to finish.
+	if waitChan != nil {
+		<-waitChan
+	}
+
+	cmpctBlock := netsync.NewCmpctBlock(block, nonce)
+	sp.QueueMessageWithEncoding(cmpctBlock, doneChan, wire.WitnessEncoding)
+	return nil
+}
+
 // pushMerkleBlockMsg sends a merkleblock message for the provided block hash to
 // the connected peer.  Since a merkle block requires the peer to have a filter
 // loaded, this call will simply be ignored if there is no filter loaded.  An
@@ -1737,16 +2026,11 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		sp.Disconnect()
 		return false
 	}
-	if banEnd, ok := state.banned[host]; ok {
-		if time.Now().Before(banEnd) {
-			srvrLog.Debugf("Peer %s is banned for another %v - disconnecting",
-				host, time.Until(banEnd))
-			sp.Disconnect()
-			return false
-		}
-
-		srvrLog.Infof("Peer %s is no longer banned", host)
-		delete(state.banned, host)
+	if banEnd, ok := s.banList.IsBanned(host); ok {
+		srvrLog.Debugf("Peer %s is banned for another %v - disconnecting",
+			host, time.Until(banEnd))
+		sp.Disconnect()
+		return false
 	}
 
 	// TODO: Check for max peers from a single IP.
@@ -1780,8 +2064,11 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		s.addrManager.Connected(sp.NA())
 	}
 
-	// Signal the sync manager this peer is a new sync candidate.
+	// Signal the sync manager this peer is a new sync candidate.  The peer
+	// is only marked negotiated afterwards so any data it sends is queued
+	// to the sync manager behind the new peer.
 	s.syncManager.NewPeer(sp.Peer)
+	sp.setNegotiated()
 
 	// Update the address manager and request known addresses from the
 	// remote peer for outbound connections. This is skipped when running on
@@ -1862,7 +2149,10 @@ func (s *server) handleBanPeerMsg(state *peerState, sp *serverPeer) {
 	direction := directionString(sp.Inbound())
 	srvrLog.Infof("Banned peer %s (%s) for %v", host, direction,
 		cfg.BanDuration)
-	state.banned[host] = time.Now().Add(cfg.BanDuration)
+	err = s.banList.Ban(host, time.Now().Add(cfg.BanDuration))
+	if err != nil {
+		srvrLog.Errorf("Unable to save ban of peer %s: %v", host, err)
+	}
 }
 
 // handleRelayInvMsg deals with relaying inventory to peers that are not already
@@ -1982,6 +2272,12 @@ type removeNodeMsg struct {
 	reply chan error
 }
 
+type disconnectAddrMsg struct {
+	addr  string
+	ban   time.Duration
+	reply chan error
+}
+
 // handleQuery is the central handler for all queries and commands from other
 // goroutines related to peer state.
 func (s *server) handleQuery(state *peerState, querymsg interface{}) {
@@ -2091,7 +2387,64 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		}
 
 		msg.reply <- errors.New("peer not found")
+
+	case disconnectAddrMsg:
+		msg.reply <- s.handleDisconnectAddrMsg(state, msg)
+	}
+}
+
+// normalizeHost returns the passed host with IP addresses in their canonical
+// form so differently written forms of the same address match.
+func normalizeHost(host string) string {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+// handleDisconnectAddrMsg disconnects the peers matching the address of the
+// passed message, banning its host first when a ban duration is given.  The
+// peers are left in the peer state, so they are cleaned up by
+// handleDonePeerMsg and removed from the sync manager once they are gone,
+// just like peers that disconnect on their own.  It is invoked from the
+// peerHandler goroutine.
+func (s *server) handleDisconnectAddrMsg(state *peerState,
+	msg disconnectAddrMsg) error {
+
+	host, port, err := net.SplitHostPort(msg.addr)
+	if err != nil {
+		host, port = msg.addr, ""
+	}
+	if host == "" {
+		return fmt.Errorf("invalid address %q", msg.addr)
+	}
+	host = normalizeHost(host)
+
+	if msg.ban > 0 {
+		srvrLog.Infof("Banned peer %s for %v by request", host, msg.ban)
+		err := s.banList.Ban(host, time.Now().Add(msg.ban))
+		if err != nil {
+			srvrLog.Errorf("Unable to save ban of peer %s: %v", host,
+				err)
+		}
+	}
+
+	var found bool
+	state.forAllPeers(func(sp *serverPeer) {
+		peerHost, peerPort, err := net.SplitHostPort(sp.Addr())
+		if err != nil || normalizeHost(peerHost) != host ||
+			(port != "" && peerPort != port) {
+
+			return
+		}
+		srvrLog.Infof("Disconnecting peer %s by request", sp)
+		sp.Disconnect()
+		found = true
+	})
+	if !found && msg.ban == 0 {
+		return errors.New("peer not found")
 	}
+	return nil
 }
 
 // disconnectPeer attempts to drop the connection of a targeted peer in the
@@ -2145,6 +2498,10 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			OnRead:         sp.OnRead,
 			OnWrite:        sp.OnWrite,
 			OnNotFound:     sp.OnNotFound,
+			OnReject:       sp.OnReject,
+			OnCmpctBlock:   sp.OnCmpctBlock,
+			OnGetBlockTxn:  sp.OnGetBlockTxn,
+			OnBlockTxn:     sp.OnBlockTxn,
 
 			// Note: The reference client currently bans peers that send alerts
 			// not signed with its key.  We could verify against their key, but
@@ -2172,6 +2529,18 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 // instance, associates it with the connection, and starts a goroutine to wait
 // for disconnection.
 func (s *server) inboundPeerConnected(conn net.Conn) {
+	// Drop connections from banned hosts right away rather than after the
+	// version handshake.
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err == nil {
+		if banEnd, ok := s.banList.IsBanned(host); ok {
+			srvrLog.Debugf("Rejecting connection from %s, which is "+
+				"banned for another %v", host, time.Until(banEnd))
+			conn.Close()
+			return
+		}
+	}
+
 	sp := newServerPeer(s, false)
 	sp.isWhitelisted = isWhitelisted(conn.RemoteAddr())
 	sp.Peer = peer.NewInboundPeer(newPeerConfig(sp))
@@ -2243,13 +2612,12 @@ func (s *server) peerHandler() {
 		inboundPeers:    make(map[int32]*serverPeer),
 		persistentPeers: make(map[int32]*serverPeer),
 		outboundPeers:   make(map[int32]*serverPeer),
-		banned:          make(map[string]time.Time),
 		outboundGroups:  make(map[string]int),
 	}
 
 	if !cfg.DisableDNSSeed {
 		// Add peers discovered through DNS to the address manager.
-		connmgr.SeedFromDNS(activeNetParams.Params, defaultRequiredServices,
+		connmgr.SeedFromDNS(s.chainParams, defaultRequiredServices,
 			btcdLookup, func(addrs []*wire.NetAddressV2) {
 				// Bitcoind uses a lookup of the dns seeder here. This
 				// is rather strange since the values looked up by the
@@ -2330,11 +2698,39 @@ func (s *server) AddPeer(sp *serverPeer) {
 	s.newPeers <- sp
 }
 
-// BanPeer bans a peer that has already been connected to the server by ip.
-func (s *server) BanPeer(sp *serverPeer) {
+// BanServerPeer bans a peer that has already been connected to the server by
+// ip.
+func (s *server) BanServerPeer(sp *serverPeer) {
 	s.banPeers <- sp
 }
 
+// DisconnectPeer disconnects all peers connected to the server from the passed
+// address.  The address may either include a port to only disconnect the peer
+// connected from that port or be a bare host to disconnect all peers connected
+// from the host.  An error is returned when no such peer is connected.
+//
+// This function is safe for concurrent access.
+func (s *server) DisconnectPeer(addr string) error {
+	reply := make(chan error)
+	s.query <- disconnectAddrMsg{addr: addr, reply: reply}
+	return <-reply
+}
+
+// BanPeer bans the host of the passed address for the passed duration and
+// disconnects all peers connected to the server from the address.  See
+// DisconnectPeer for the accepted forms of the address.  The host is banned
+// whether or not any peers are connected from it.
+//
+// This function is safe for concurrent access.
+func (s *server) BanPeer(addr string, duration time.Duration) error {
+	if duration <= 0 {
+		return fmt.Errorf("invalid ban duration %v", duration)
+	}
+	reply := make(chan error)
+	s.query <- disconnectAddrMsg{addr: addr, ban: duration, reply: reply}
+	return <-reply
+}
+
 // RelayInventory relays the passed inventory vector to all connected peers
 // that are not already known to have it.
 func (s *server) RelayInventory(invVect *wire.InvVect, data interface{}) {
@@ -2386,6 +2782,248 @@ func (s *server) NetTotals() (uint64, uint64) {
 		atomic.LoadUint64(&s.bytesSent)
 }
 
+// CompactDB compacts the database to reclaim the space occupied by deleted and
+// overwritten data.  Block processing is paused for the duration of the
+// compaction so the database is not written to while it is in progress.  An
+// error is returned when the database backend does not support compaction.
+func (s *server) CompactDB() error {
+	db := s.blockDB()
+	compactor, ok := db.(database.Compactor)
+	if !ok {
+		return fmt.Errorf("database type %s does not support compaction",
+			db.Type())
+	}
+
+	unpause := s.syncManager.Pause()
+	defer close(unpause)
+
+	srvrLog.Infof("Compacting database")
+	start := time.Now()
+	reclaimed, err := compactor.Compact()
+	if err != nil {
+		return err
+	}
+	srvrLog.Infof("Compacted database in %v, reclaimed %d bytes",
+		time.Since(start).Round(time.Millisecond), reclaimed)
+	return nil
+}
+
+// blockDB returns the database currently backing the server.  It changes when
+// the server is migrated to another database via MigrateDB.
+//
+// This function is safe for concurrent access.
+func (s *server) blockDB() database.DB {
+	s.dbMtx.RLock()
+	db := s.db
+	s.dbMtx.RUnlock()
+	return db
+}
+
+// MigrateDB switches the server over to the passed database, which must
+// already be at the same best chain tip as the current one.  Block processing
+// is quiesced for the duration of the switch.  Both databases are left open
+// for the caller to close.  See netsync.SyncManager.MigrateTo for more
+// details.
+func (s *server) MigrateDB(db database.DB) error {
+	if err := s.syncManager.MigrateTo(db); err != nil {
+		return err
+	}
+
+	s.dbMtx.Lock()
+	s.db = db
+	s.dbMtx.Unlock()
+	srvrLog.Infof("Migrated to %s database", db.Type())
+	return nil
+}
+
+// doubleSpendHandler forwards double spend alerts received from the mempool on
+// the passed channel to the RPC server for delivery to websocket clients.  It
+// must be run as a goroutine.
+func (s *server) doubleSpendHandler(notifications <-chan *mempool.Notification) {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case n := <-notifications:
+			if n.Type != mempool.NTDoubleSpend {
+				continue
+			}
+			alert := n.Data.(*mempool.DoubleSpendAlert)
+			s.rpcServer.ntfnMgr.NotifyDoubleSpend(alert)
+
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// auditUtxoSet rebuilds the utxo set by replaying the main chain and logs any
+// differences from the stored utxo set.  It must be run as a goroutine.
+func (s *server) auditUtxoSet() {
+	defer s.wg.Done()
+
+	discrepancies, err := s.chain.RebuildUtxoSet(s.quit)
+	if err != nil {
+		if atomic.LoadInt32(&s.shutdown) == 0 {
+			srvrLog.Errorf("Unable to audit utxo set: %v", err)
+		}
+		return
+	}
+	if len(discrepancies) == 0 {
+		srvrLog.Infof("Utxo set audit found no discrepancies")
+		return
+	}
+
+	describe := func(entry *blockchain.UtxoEntry) string {
+		if entry == nil {
+			return "none"
+		}
+		return fmt.Sprintf("%v at height %d",
+			btcutil.Amount(entry.Amount()), entry.BlockHeight())
+	}
+	for i, d := range discrepancies {
+		if i == maxLoggedUtxoDiscrepancies {
+			srvrLog.Warnf("%d more utxo set discrepancies not logged",
+				len(discrepancies)-i)
+			break
+		}
+		srvrLog.Warnf("Utxo set discrepancy for %v: expected %s, "+
+			"stored %s", d.OutPoint, describe(d.Expected),
+			describe(d.Stored))
+	}
+}
+
+// dbCompactHandler compacts the database at the passed interval until the
+// server is shut down.  It must be run as a goroutine.
+func (s *server) dbCompactHandler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.CompactDB(); err != nil {
+				srvrLog.Errorf("Unable to compact database: %v",
+					err)
+			}
+
+		case <-s.quit:
+			break out
+		}
+	}
+
+	s.wg.Done()
+}
+
+// TxMerkleProof returns a merkle block proving the inclusion of the transaction
+// with the passed hash in the main chain block with the passed hash.  Light
+// clients can validate the proof against the merkle root in the block header
+// with bloom.VerifyMerkleBlock.  bloom.ErrTxNotInBlock is returned when the
+// block does not contain the transaction.
+func (s *server) TxMerkleProof(blockHash, txHash *chainhash.Hash) (*wire.MsgMerkleBlock, error) {
+	block, err := s.chain.BlockByHash(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	return bloom.NewTxMerkleProof(block, txHash)
+}
+
+// RegtestGenerate builds n blocks that extend the current best chain tip and
+// submits them for processing, returning their hashes.  Each block is built
+// from a block template whose coinbase is spendable by anyone and is solved
+// against the trivial regression test difficulty, which allows tests and local
+// development to advance the chain deterministically.
+//
+// An error is returned when not running in regression test mode.
+func (s *server) RegtestGenerate(n int) ([]*chainhash.Hash, error) {
+	if !cfg.RegressionTest {
+		return nil, errors.New("blocks may only be generated in " +
+			"regression test mode")
+	}
+
+	hashes := make([]*chainhash.Hash, 0, n)
+	for i := 0; i < n; i++ {
+		template, err := s.templateGenerator.NewBlockTemplate(nil)
+		if err != nil {
+			return hashes, err
+		}
+		if !solveRegtestBlock(&template.Block.Header) {
+			return hashes, fmt.Errorf("unable to solve block at "+
+				"height %d", template.Height)
+		}
+
+		block := btcutil.NewBlock(template.Block)
+		isOrphan, err := s.syncManager.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			return hashes, err
+		}
+		if isOrphan {
+			return hashes, fmt.Errorf("generated block %v is an "+
+				"orphan", block.Hash())
+		}
+		hashes = append(hashes, block.Hash())
+	}
+	return hashes, nil
+}
+
+// solveRegtestBlock searches the nonce space for a value that makes the hash of
+// the passed header satisfy its target difficulty.  It returns whether a
+// solution was found.  Nearly every nonce satisfies the regression test
+// difficulty, so a solution is found almost immediately.
+func solveRegtestBlock(header *wire.BlockHeader) bool {
+	target := blockchain.CompactToBig(header.Bits)
+	for nonce := uint32(0); ; nonce++ {
+		header.Nonce = nonce
+		hash := header.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			return true
+		}
+		if nonce == math.MaxUint32 {
+			return false
+		}
+	}
+}
+
+// requestPeers requests a new outbound connection.  It is used by the sync
+// manager when it runs out of peers to sync from.  Connection requests block
+// until they are registered with the connection manager, so the request is
+// made asynchronously.
+func (s *server) requestPeers() {
+	go s.connManager.NewConnReq()
+}
+
+// addPeerBanScore increases the ban score of the server peer backing the passed
+// peer by the passed values.  The peer is looked up asynchronously so the
+// caller does not block.
+func (s *server) addPeerBanScore(p *peer.Peer, persistent, transient uint32,
+	reason string) {
+
+	go func() {
+		replyChan := make(chan []*serverPeer, 1)
+		select {
+		case s.query <- getPeersMsg{reply: replyChan}:
+		case <-s.quit:
+			return
+		}
+		for _, sp := range <-replyChan {
+			if sp.Peer == p {
+				sp.addBanScore(persistent, transient, reason)
+				return
+			}
+		}
+	}()
+}
+
+// onBestBlockChanged updates the best block advertised to peers that connect
+// once the tip of the main chain changes.  It is invoked by the sync manager.
+func (s *server) onBestBlockChanged(hash *chainhash.Hash, height int32) {
+	s.bestBlockMtx.Lock()
+	s.bestBlockHash = *hash
+	s.bestBlockHeight = height
+	s.bestBlockMtx.Unlock()
+}
+
 // UpdatePeerHeights updates the heights of all peers who have have announced
 // the latest connected main chain block, or a recognized orphan. These height
 // updates allow us to dynamically refresh peer heights, ensuring sync peer
@@ -2484,12 +3122,37 @@ func (s *server) Start() {
 		go s.rebroadcastHandler()
 
 		s.rpcServer.Start()
+
+		// Forward double spend alerts from the mempool to websocket
+		// clients.
+		s.wg.Add(1)
+		go s.doubleSpendHandler(s.txMemPool.Subscribe())
 	}
 
 	// Start the CPU miner if generation is enabled.
 	if cfg.Generate {
 		s.cpuMiner.Start()
 	}
+
+	// Audit the stored utxo set against one rebuilt from the main chain
+	// when requested.
+	if cfg.AuditUtxoSet {
+		s.wg.Add(1)
+		go s.auditUtxoSet()
+	}
+
+	// Periodically compact the database when requested and supported by
+	// the backend.
+	if cfg.DbCompactInterval > 0 {
+		db := s.blockDB()
+		if _, ok := db.(database.Compactor); ok {
+			s.wg.Add(1)
+			go s.dbCompactHandler(cfg.DbCompactInterval)
+		} else {
+			srvrLog.Warnf("Database type %s does not support "+
+				"compaction", db.Type())
+		}
+	}
 }
 
 // Stop gracefully shuts down the server by stopping and disconnecting all
@@ -2512,7 +3175,7 @@ func (s *server) Stop() error {
 	}
 
 	// Save fee estimator state in the database.
-	s.db.Update(func(tx database.Tx) error {
+	s.blockDB().Update(func(tx database.Tx) error {
 		metadata := tx.Metadata()
 		metadata.Put(mempool.EstimateFeeDatabaseKey, s.feeEstimator.Save())
 
@@ -2524,9 +3187,24 @@ func (s *server) Stop() error {
 	return nil
 }
 
-// WaitForShutdown blocks until the main listener and peer handlers are stopped.
+// WaitForShutdown blocks until the main listener and peer handlers are stopped
+// and the sync manager has drained any work queued by peers.
 func (s *server) WaitForShutdown() {
 	s.wg.Wait()
+	s.syncManager.WaitForShutdown()
+
+	// The sync manager no longer journals or exports blocks once it has
+	// shut down.
+	if s.blockJournal != nil {
+		if err := s.blockJournal.Close(); err != nil {
+			srvrLog.Errorf("Unable to close block journal: %v", err)
+		}
+	}
+	if s.blockExporter != nil {
+		if err := s.blockExporter.Close(); err != nil {
+			srvrLog.Errorf("Unable to close block export file: %v", err)
+		}
+	}
 }
 
 // ScheduleShutdown schedules a server shutdown after the specified duration.
@@ -2617,7 +3295,7 @@ func (s *server) upnpUpdateThread() {
 	// Go off immediately to prevent code duplication, thereafter we renew
 	// lease every 15 minutes.
 	timer := time.NewTimer(0 * time.Second)
-	lport, _ := strconv.ParseInt(activeNetParams.DefaultPort, 10, 16)
+	lport, _ := strconv.ParseInt(s.chainParams.DefaultPort, 10, 16)
 	first := true
 out:
 	for {
@@ -2717,10 +3395,11 @@ func setupRPCListeners() ([]net.Listener, error) {
 }
 
 // newServer returns a new btcd server configured to listen on addr for the
-// bitcoin network type specified by chainParams.  Use start to begin accepting
-// connections from peers.
+// bitcoin network type specified by chainParams.  The block journal and orphan
+// store are kept as configured by the settings the passed database was loaded
+// with.  Use start to begin accepting connections from peers.
 func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
-	db database.DB, chainParams *chaincfg.Params,
+	db database.DB, dbCfg *blockDBConfig, chainParams *chaincfg.Params,
 	interrupt <-chan struct{}) (*server, error) {
 
 	services := defaultServices
@@ -2732,11 +3411,15 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	}
 
 	amgr := addrmgr.New(cfg.DataDir, btcdLookup)
+	banList, err := connmgr.NewBanList(filepath.Join(cfg.DataDir,
+		banListFilename))
+	if err != nil {
+		return nil, err
+	}
 
 	var listeners []net.Listener
 	var nat NAT
 	if !cfg.DisableListen {
-		var err error
 		listeners, nat, err = initListeners(amgr, listenAddrs, services)
 		if err != nil {
 			return nil, err
@@ -2756,6 +3439,7 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	s := server{
 		chainParams:          chainParams,
 		addrManager:          amgr,
+		banList:              banList,
 		newPeers:             make(chan *serverPeer, cfg.MaxPeers),
 		donePeers:            make(chan *serverPeer, cfg.MaxPeers),
 		banPeers:             make(chan *serverPeer, cfg.MaxPeers),
@@ -2765,6 +3449,7 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		quit:                 make(chan struct{}),
 		modifyRebroadcastInv: make(chan interface{}),
 		peerHeightsUpdate:    make(chan updatePeerHeightsMsg),
+		readResume:           make(map[*peer.Peer]chan struct{}),
 		nat:                  nat,
 		db:                   db,
 		timeSource:           blockchain.NewMedianTime(),
@@ -2821,21 +3506,37 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	}
 
 	// Create a new block chain instance with the appropriate configuration.
-	var err error
 	s.chain, err = blockchain.New(&blockchain.Config{
-		DB:           s.db,
-		Interrupt:    interrupt,
-		ChainParams:  s.chainParams,
-		Checkpoints:  checkpoints,
-		TimeSource:   s.timeSource,
-		SigCache:     s.sigCache,
-		IndexManager: indexManager,
-		HashCache:    s.hashCache,
+		DB:                 s.db,
+		Interrupt:          interrupt,
+		ChainParams:        s.chainParams,
+		Checkpoints:        checkpoints,
+		TimeSource:         s.timeSource,
+		SigCache:           s.sigCache,
+		IndexManager:       indexManager,
+		HashCache:          s.hashCache,
+		MaxSideChainBlocks: cfg.MaxSideChainBlocks,
+		ScriptWorkers:      cfg.ScriptWorkers,
+		NoGenesisInit:      cfg.NoGenesisInit,
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	// Advertise the current tip to peers until the sync manager reports a
+	// new one.
+	best := s.chain.BestSnapshot()
+	s.onBestBlockChanged(&best.Hash, best.Height)
+
+	// Validate the most recent blocks again when requested to catch recent
+	// corruption of the database without a full rescan.
+	if cfg.QuickVerify > 0 {
+		if _, err := s.chain.QuickVerify(cfg.QuickVerify); err != nil {
+			return nil, fmt.Errorf("verification of the last %d "+
+				"blocks failed: %v", cfg.QuickVerify, err)
+		}
+	}
+
 	// Search for a FeeEstimator state in the database. If none can be found
 	// or if it cannot be loaded, create a new one.
 	db.Update(func(tx database.Tx) error {
@@ -2868,15 +3569,18 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 
 	txC := mempool.Config{
 		Policy: mempool.Policy{
-			DisableRelayPriority: cfg.NoRelayPriority,
-			AcceptNonStd:         cfg.RelayNonStd,
-			FreeTxRelayLimit:     cfg.FreeTxRelayLimit,
-			MaxOrphanTxs:         cfg.MaxOrphanTxs,
-			MaxOrphanTxSize:      defaultMaxOrphanTxSize,
-			MaxSigOpCostPerTx:    blockchain.MaxBlockSigOpsCost / 4,
-			MinRelayTxFee:        cfg.minRelayTxFee,
-			MaxTxVersion:         2,
-			RejectReplacement:    cfg.RejectReplacement,
+			DisableRelayPriority:  cfg.NoRelayPriority,
+			AcceptNonStd:          cfg.RelayNonStd,
+			FreeTxRelayLimit:      cfg.FreeTxRelayLimit,
+			MaxOrphanTxs:          cfg.MaxOrphanTxs,
+			MaxOrphanTxSize:       defaultMaxOrphanTxSize,
+			MaxSigOpCostPerTx:     blockchain.MaxBlockSigOpsCost / 4,
+			MinRelayTxFee:         cfg.minRelayTxFee,
+			MaxTxVersion:          2,
+			RejectReplacement:     cfg.RejectReplacement,
+			MaxStandardTxWeight:   cfg.MaxStandardTxWeight,
+			DustRelayFee:          cfg.dustRelayFee,
+			StandardScriptClasses: cfg.stdScriptClasses,
 		},
 		ChainParams:    chainParams,
 		FetchUtxoView:  s.chain.FetchUtxoView,
@@ -2893,14 +3597,61 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	}
 	s.txMemPool = mempool.New(&txC)
 
+	if dbCfg.blockJournalEnabled() {
+		journalPath := dbCfg.blockJournalPath()
+		s.blockJournal, err = netsync.OpenBlockJournal(journalPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var orphanStore *netsync.OrphanStore
+	if dbCfg.orphanStoreEnabled() {
+		orphanStore, err = netsync.OpenOrphanStore(dbCfg.orphanStorePath(),
+			netsync.DefaultMaxStoredOrphans,
+			netsync.DefaultStoredOrphanExpiry)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ExportBlocks != "" {
+		s.blockExporter, err = netsync.OpenBlockExporter(cfg.ExportBlocks,
+			chainParams.Net)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	s.syncManager, err = netsync.New(&netsync.Config{
-		PeerNotifier:       &s,
-		Chain:              s.chain,
-		TxMemPool:          s.txMemPool,
-		ChainParams:        s.chainParams,
-		DisableCheckpoints: cfg.DisableCheckpoints,
-		MaxPeers:           cfg.MaxPeers,
-		FeeEstimator:       s.feeEstimator,
+		PeerNotifier:         &s,
+		Chain:                s.chain,
+		TxMemPool:            s.txMemPool,
+		ChainParams:          s.chainParams,
+		DisableCheckpoints:   cfg.DisableCheckpoints,
+		AssumeValid:          cfg.assumeValid,
+		DisableVerify:        cfg.NoVerify,
+		MaxPeers:             cfg.MaxPeers,
+		BlockDownloadWindow:  cfg.BlockDownloadWindow,
+		CheckpointQuorum:     cfg.CheckpointQuorum,
+		MaxSyncCandidates:    cfg.MaxSyncCandidates,
+		DiverseSyncPeer:      cfg.DiverseSyncPeer,
+		GetDataPipelineDepth: cfg.GetDataPipeline,
+		QuietTxRejectReasons: cfg.quietRejectReasons,
+		RelayMainChainOnly:   cfg.RelayMainChainOnly,
+		RelayWhileSyncing:    cfg.RelayWhileSyncing,
+		LogAcceptedBlocks:    cfg.LogAcceptedBlocks,
+		TipRelayDelay:        cfg.TipRelayDelay,
+		MaxTipRelayDelay:     cfg.MaxTipRelayDelay,
+		TxRelayDelay:         cfg.TxRelayDelay,
+		BlockJournal:         s.blockJournal,
+		OrphanStore:          orphanStore,
+		TxIndex:              s.txIndex,
+		BlockExporter:        s.blockExporter,
+		RequestPeers:         s.requestPeers,
+		AddBanScore:          s.addPeerBanScore,
+		OnBestBlockChanged:   s.onBestBlockChanged,
+		OnHandlerStuck:       requestShutdown,
+		FeeEstimator:         s.feeEstimator,
+		Tuning:               activeNetParams.syncTuning,
 	})
 	if err != nil {
 		return nil, err
@@ -2922,6 +3673,7 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	blockTemplateGenerator := mining.NewBlkTmplGenerator(&policy,
 		s.chainParams, s.txMemPool, s.chain, s.timeSource,
 		s.sigCache, s.hashCache)
+	s.templateGenerator = blockTemplateGenerator
 	s.cpuMiner = cpuminer.New(&cpuminer.Config{
 		ChainParams:            chainParams,
 		BlockTemplateGenerator: blockTemplateGenerator,
@@ -2957,6 +3709,15 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 					continue
 				}
 
+				// Don't connect to banned hosts.
+				host, _, err := net.SplitHostPort(
+					addrmgr.NetAddressKey(addr.NetAddress()))
+				if err == nil {
+					if _, ok := s.banList.IsBanned(host); ok {
+						continue
+					}
+				}
+
 				// only allow recent nodes (10mins) after we failed 30
 				// times
 				if tries < 30 && time.Since(addr.LastAttempt()) < 10*time.Minute {
@@ -2965,7 +3726,7 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 
 				// allow nondefault ports after 50 failed tries.
 				if tries < 50 && fmt.Sprintf("%d", addr.NetAddress().Port) !=
-					activeNetParams.DefaultPort {
+					s.chainParams.DefaultPort {
 					continue
 				}
 
@@ -3035,7 +3796,6 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 			TimeSource:   s.timeSource,
 			Chain:        s.chain,
 			ChainParams:  chainParams,
-			DB:           db,
 			TxMemPool:    s.txMemPool,
 			Generator:    blockTemplateGenerator,
 			CPUMiner:     s.cpuMiner,
@@ -0,0 +1,613 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/bloom"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/connmgr"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/netsync"
+	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// nullPeerNotifier is a netsync.PeerNotifier that ignores all notifications.
+type nullPeerNotifier struct{}
+
+func (nullPeerNotifier) AnnounceNewTransactions(newTxs []*mempool.TxDesc) {}
+
+func (nullPeerNotifier) NotifyNewTransactions(newTxs []*mempool.TxDesc) {}
+
+func (nullPeerNotifier) UpdatePeerHeights(latestBlkHash *chainhash.Hash,
+	latestHeight int32, updateSource *peer.Peer) {
+}
+
+func (nullPeerNotifier) RelayInventory(invVect *wire.InvVect,
+	data interface{}) {
+}
+
+func (nullPeerNotifier) TransactionConfirmed(tx *btcutil.Tx) {}
+
+func (nullPeerNotifier) QueueBackpressure(p *peer.Peer, asserted bool) {}
+
+// newRegtestServer returns a server with just enough of its subsystems set up
+// on a fresh regression test chain to generate blocks.
+func newRegtestServer(t *testing.T) *server {
+	t.Helper()
+
+	// The log rotator is not initialized in tests, so disable logging.
+	setLogLevels("off")
+
+	params := chaincfg.RegressionNetParams
+	dbPath := filepath.Join(t.TempDir(), "ffldb")
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		t.Fatalf("unable to create db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	timeSource := blockchain.NewMedianTime()
+	sigCache := txscript.NewSigCache(1000)
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  timeSource,
+		SigCache:    sigCache,
+	})
+	if err != nil {
+		t.Fatalf("unable to create chain: %v", err)
+	}
+
+	txPool := mempool.New(&mempool.Config{
+		Policy: mempool.Policy{
+			MaxTxVersion: 2,
+		},
+		ChainParams:   &params,
+		FetchUtxoView: chain.FetchUtxoView,
+		BestHeight: func() int32 {
+			return chain.BestSnapshot().Height
+		},
+		MedianTimePast: func() time.Time {
+			return chain.BestSnapshot().MedianTime
+		},
+		CalcSequenceLock: func(tx *btcutil.Tx,
+			view *blockchain.UtxoViewpoint) (*blockchain.SequenceLock, error) {
+
+			return chain.CalcSequenceLock(tx, view, true)
+		},
+		IsDeploymentActive: chain.IsDeploymentActive,
+	})
+
+	policy := mining.Policy{
+		BlockMaxWeight: blockchain.MaxBlockWeight,
+		BlockMaxSize:   wire.MaxBlockPayload,
+	}
+	s := &server{
+		chainParams: &params,
+		chain:       chain,
+		db:          db,
+		txMemPool:   txPool,
+		templateGenerator: mining.NewBlkTmplGenerator(&policy, &params,
+			txPool, chain, timeSource, sigCache, nil),
+	}
+	best := chain.BestSnapshot()
+	s.onBestBlockChanged(&best.Hash, best.Height)
+
+	s.syncManager, err = netsync.New(&netsync.Config{
+		PeerNotifier:       nullPeerNotifier{},
+		Chain:              chain,
+		TxMemPool:          txPool,
+		ChainParams:        &params,
+		MaxPeers:           1,
+		OnBestBlockChanged: s.onBestBlockChanged,
+	})
+	if err != nil {
+		t.Fatalf("unable to create sync manager: %v", err)
+	}
+	s.syncManager.Start()
+	t.Cleanup(func() {
+		s.syncManager.Stop()
+		s.syncManager.WaitForShutdown()
+	})
+
+	return s
+}
+
+// TestRegtestGenerate ensures blocks can be generated on demand in regression
+// test mode and that doing so is refused on other networks.
+func TestRegtestGenerate(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+
+	s := newRegtestServer(t)
+
+	cfg = &config{}
+	if _, err := s.RegtestGenerate(1); err == nil {
+		t.Fatal("generated blocks outside of regression test mode")
+	}
+
+	cfg = &config{RegressionTest: true}
+	const numBlocks = 5
+	hashes, err := s.RegtestGenerate(numBlocks)
+	if err != nil {
+		t.Fatalf("unable to generate blocks: %v", err)
+	}
+	if len(hashes) != numBlocks {
+		t.Fatalf("got %d hashes, want %d", len(hashes), numBlocks)
+	}
+
+	best := s.chain.BestSnapshot()
+	if best.Height != numBlocks {
+		t.Fatalf("got height %d, want %d", best.Height, numBlocks)
+	}
+	if best.Hash != *hashes[numBlocks-1] {
+		t.Fatalf("got tip %v, want %v", best.Hash, hashes[numBlocks-1])
+	}
+	for i, hash := range hashes {
+		height, err := s.chain.BlockHeightByHash(hash)
+		if err != nil {
+			t.Fatalf("generated block %v not in main chain: %v",
+				hash, err)
+		}
+		if height != int32(i+1) {
+			t.Fatalf("block %v at height %d, want %d", hash,
+				height, i+1)
+		}
+	}
+}
+
+// TestAdvertisedStartHeight ensures the best block advertised to connecting
+// peers follows the tip of the main chain.
+func TestAdvertisedStartHeight(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{RegressionTest: true}
+
+	s := newRegtestServer(t)
+	sp := newServerPeer(s, false)
+	for height := int32(0); height <= 3; height++ {
+		if height > 0 {
+			if _, err := s.RegtestGenerate(1); err != nil {
+				t.Fatalf("unable to generate block: %v", err)
+			}
+		}
+		hash, gotHeight, err := sp.newestBlock()
+		if err != nil {
+			t.Fatalf("unable to get newest block: %v", err)
+		}
+		best := s.chain.BestSnapshot()
+		if gotHeight != height || *hash != best.Hash {
+			t.Fatalf("advertised tip %v (height %d), want %v "+
+				"(height %d)", hash, gotHeight, best.Hash, height)
+		}
+	}
+}
+
+// TestDropDataBeforeNegotiation ensures inv, tx, and block messages from a
+// peer that has not been handed to the sync manager are dropped and increase
+// its ban score.
+func TestDropDataBeforeNegotiation(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{BanThreshold: defaultBanThreshold}
+	setLogLevels("off")
+
+	// The server has no sync manager, so any message that is not dropped
+	// causes a panic.
+	sp := newServerPeer(&server{}, false)
+	sp.Peer = peer.NewInboundPeer(&peer.Config{
+		ChainParams: &chaincfg.RegressionNetParams,
+	})
+
+	hash := chainhash.Hash{0x01}
+	inv := wire.NewMsgInv()
+	inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, &hash))
+	sp.OnInv(sp.Peer, inv)
+	score := sp.banScore.Int()
+	if score == 0 {
+		t.Fatal("ban score not increased for early inv")
+	}
+
+	sp.OnTx(sp.Peer, wire.NewMsgTx(wire.TxVersion))
+	if sp.banScore.Int() <= score {
+		t.Fatal("ban score not increased for early tx")
+	}
+	score = sp.banScore.Int()
+
+	block := wire.NewMsgBlock(&chaincfg.RegressionNetParams.GenesisBlock.Header)
+	sp.OnBlock(sp.Peer, block, nil)
+	if sp.banScore.Int() <= score {
+		t.Fatal("ban score not increased for early block")
+	}
+}
+
+// TestQueueBackpressure ensures backpressure from the sync manager only pauses
+// reading from the peer it is asserted for.
+func TestQueueBackpressure(t *testing.T) {
+	setLogLevels("off")
+
+	s := &server{
+		readResume: make(map[*peer.Peer]chan struct{}),
+		quit:       make(chan struct{}),
+	}
+	newPeer := func() *serverPeer {
+		sp := newServerPeer(s, false)
+		sp.Peer = peer.NewInboundPeer(&peer.Config{
+			ChainParams: &chaincfg.RegressionNetParams,
+		})
+		return sp
+	}
+	paused, other := newPeer(), newPeer()
+
+	s.QueueBackpressure(paused.Peer, true)
+	waited := make(chan struct{})
+	go func() {
+		paused.waitForQueueSpace()
+		close(waited)
+	}()
+
+	// Reading from the other peer is not paused.
+	otherWaited := make(chan struct{})
+	go func() {
+		other.waitForQueueSpace()
+		close(otherWaited)
+	}()
+	select {
+	case <-otherWaited:
+	case <-time.After(time.Second):
+		t.Fatal("reading from a peer without backpressure paused")
+	}
+
+	select {
+	case <-waited:
+		t.Fatal("reading from a peer with backpressure not paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.QueueBackpressure(paused.Peer, false)
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("reading from a peer not resumed")
+	}
+}
+
+// TestOnReject ensures transactions and blocks rejected by a peer are not
+// announced to it again while rejects of other messages are only logged.
+func TestOnReject(t *testing.T) {
+	setLogLevels("off")
+
+	sp := newServerPeer(&server{}, false)
+	sp.Peer = peer.NewInboundPeer(&peer.Config{
+		ChainParams: &chaincfg.RegressionNetParams,
+	})
+
+	txHash := chainhash.Hash{0x01}
+	blockHash := chainhash.Hash{0x02}
+	sp.OnReject(sp.Peer, wire.NewMsgReject(wire.CmdVersion,
+		wire.RejectObsolete, "obsolete version"))
+	tests := []struct {
+		cmd     string
+		invType wire.InvType
+		hash    chainhash.Hash
+	}{
+		{wire.CmdTx, wire.InvTypeTx, txHash},
+		{wire.CmdBlock, wire.InvTypeBlock, blockHash},
+	}
+	for _, test := range tests {
+		iv := wire.NewInvVect(test.invType, &test.hash)
+		if sp.HasKnownInventory(iv) {
+			t.Fatalf("%s known before it was rejected", test.cmd)
+		}
+		msg := wire.NewMsgReject(test.cmd, wire.RejectInvalid, "invalid")
+		msg.Hash = test.hash
+		sp.OnReject(sp.Peer, msg)
+		if !sp.HasKnownInventory(iv) {
+			t.Fatalf("rejected %s would be announced again", test.cmd)
+		}
+	}
+}
+
+// connPair returns a pair of tcp connections over the loopback interface that
+// are connected to each other.
+func connPair(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			conn = nil
+		}
+		accepted <- conn
+	}()
+
+	outConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	inConn := <-accepted
+	if inConn == nil {
+		t.Fatal("unable to accept connection")
+	}
+	return outConn, inConn
+}
+
+// TestRelayBloomFilter ensures only the transactions that match the bloom
+// filter loaded by a peer are relayed to it.
+func TestRelayBloomFilter(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = &config{BanThreshold: defaultBanThreshold}
+	setLogLevels("off")
+
+	// Connect a server peer to a remote peer that records the inventory
+	// it is sent.
+	verack := make(chan struct{}, 2)
+	onVerAck := func(p *peer.Peer, msg *wire.MsgVerAck) {
+		verack <- struct{}{}
+	}
+	invs := make(chan *wire.MsgInv, 10)
+	params := &chaincfg.RegressionNetParams
+	remote := peer.NewInboundPeer(&peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVerAck: onVerAck,
+			OnInv: func(p *peer.Peer, msg *wire.MsgInv) {
+				invs <- msg
+			},
+		},
+		ChainParams:    params,
+		AllowSelfConns: true,
+	})
+	s := &server{services: wire.SFNodeNetwork | wire.SFNodeBloom}
+	sp := newServerPeer(s, false)
+	local, err := peer.NewOutboundPeer(&peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVerAck: onVerAck,
+		},
+		ChainParams:     params,
+		Services:        s.services,
+		TrickleInterval: 10 * time.Millisecond,
+		AllowSelfConns:  true,
+	}, "127.0.0.1:18444")
+	if err != nil {
+		t.Fatalf("unable to create peer: %v", err)
+	}
+	sp.Peer = local
+	localConn, remoteConn := connPair(t)
+	local.AssociateConnection(localConn)
+	remote.AssociateConnection(remoteConn)
+	defer local.Disconnect()
+	defer remote.Disconnect()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-verack:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for peer negotiation")
+		}
+	}
+
+	// Create two transactions and load a filter that only matches the
+	// first.
+	newTx := func(value int64) *btcutil.Tx {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+		msgTx.AddTxOut(wire.NewTxOut(value, nil))
+		return btcutil.NewTx(msgTx)
+	}
+	matching, other := newTx(1), newTx(2)
+	filter := bloom.NewFilter(10, 0, 0.0001, wire.BloomUpdateNone)
+	filter.AddHash(matching.Hash())
+	sp.OnFilterLoad(sp.Peer, filter.MsgFilterLoad())
+
+	state := &peerState{
+		inboundPeers:    make(map[int32]*serverPeer),
+		outboundPeers:   map[int32]*serverPeer{sp.ID(): sp},
+		persistentPeers: make(map[int32]*serverPeer),
+	}
+	for _, tx := range []*btcutil.Tx{other, matching} {
+		s.handleRelayInvMsg(state, relayMsg{
+			invVect: wire.NewInvVect(wire.InvTypeTx, tx.Hash()),
+			data:    &mempool.TxDesc{TxDesc: mining.TxDesc{Tx: tx}},
+		})
+	}
+
+	select {
+	case msg := <-invs:
+		if len(msg.InvList) != 1 || msg.InvList[0].Hash != *matching.Hash() {
+			t.Fatalf("unexpected inventory relayed: %v", msg.InvList)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for relayed inventory")
+	}
+}
+
+// stubDB is a database.DB that is unable to be compacted.
+type stubDB struct {
+	database.DB
+}
+
+func (stubDB) Type() string { return "stub" }
+
+// stubCompactDB is a database.DB that records compactions.
+type stubCompactDB struct {
+	stubDB
+	compactions int
+}
+
+func (db *stubCompactDB) Compact() (int64, error) {
+	db.compactions++
+	return 1024, nil
+}
+
+// TestCompactDB ensures the database is compacted when the backend supports
+// it and an error is returned otherwise.
+func TestCompactDB(t *testing.T) {
+	s := newRegtestServer(t)
+
+	s.db = stubDB{}
+	if err := s.CompactDB(); err == nil {
+		t.Fatal("compacted database that does not support it")
+	}
+
+	db := &stubCompactDB{}
+	s.db = db
+	if err := s.CompactDB(); err != nil {
+		t.Fatalf("unable to compact database: %v", err)
+	}
+	if db.compactions != 1 {
+		t.Fatalf("got %d compactions, want 1", db.compactions)
+	}
+
+	// Block processing must resume once the compaction is done.
+	done := make(chan struct{})
+	go func() {
+		s.syncManager.IsCurrent()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sync manager not resumed after compaction")
+	}
+}
+
+// TestMigrateDB ensures the server and its chain are switched over to a new
+// database at the same tip and that one at another tip is refused.
+func TestMigrateDB(t *testing.T) {
+	s := newRegtestServer(t)
+
+	// newChainDB returns a database initialized with the chain state for
+	// the genesis block of the passed network.
+	newChainDB := func(params chaincfg.Params) database.DB {
+		dbPath := filepath.Join(t.TempDir(), "ffldb")
+		db, err := database.Create("ffldb", dbPath, params.Net)
+		if err != nil {
+			t.Fatalf("unable to create db: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		_, err = blockchain.New(&blockchain.Config{
+			DB:          db,
+			ChainParams: &params,
+			TimeSource:  blockchain.NewMedianTime(),
+		})
+		if err != nil {
+			t.Fatalf("unable to create chain: %v", err)
+		}
+		return db
+	}
+
+	oldDB := s.blockDB()
+	if err := s.MigrateDB(newChainDB(chaincfg.SimNetParams)); err == nil {
+		t.Fatal("migrated to database at another tip")
+	}
+	if s.blockDB() != oldDB || s.chain.DB() != oldDB {
+		t.Fatal("database switched despite mismatched tip")
+	}
+
+	newDB := newChainDB(chaincfg.RegressionNetParams)
+	if err := s.MigrateDB(newDB); err != nil {
+		t.Fatalf("unable to migrate database: %v", err)
+	}
+	if s.blockDB() != newDB || s.chain.DB() != newDB {
+		t.Fatal("database not switched")
+	}
+}
+
+// TestBanPeer ensures banning a connected peer by address disconnects it and
+// records the ban, and that disconnecting by an address no peer is connected
+// from fails.
+func TestBanPeer(t *testing.T) {
+	setLogLevels("off")
+
+	banList, err := connmgr.NewBanList(filepath.Join(t.TempDir(),
+		banListFilename))
+	if err != nil {
+		t.Fatalf("unable to create ban list: %v", err)
+	}
+	s := &server{
+		banList: banList,
+		query:   make(chan interface{}),
+	}
+	sp := newServerPeer(s, false)
+	sp.Peer = peer.NewInboundPeer(&peer.Config{
+		ChainParams: &chaincfg.RegressionNetParams,
+	})
+	outConn, inConn := connPair(t)
+	defer outConn.Close()
+	sp.AssociateConnection(inConn)
+	defer sp.Disconnect()
+
+	// Handle queries like the peer handler does.
+	state := &peerState{
+		inboundPeers:    map[int32]*serverPeer{sp.ID(): sp},
+		outboundPeers:   make(map[int32]*serverPeer),
+		persistentPeers: make(map[int32]*serverPeer),
+		outboundGroups:  make(map[string]int),
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case msg := <-s.query:
+				s.handleQuery(state, msg)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	if err := s.DisconnectPeer("10.0.0.1:8333"); err == nil {
+		t.Fatal("disconnected peer that is not connected")
+	}
+	if err := s.BanPeer("127.0.0.1", 0); err == nil {
+		t.Fatal("banned peer without a ban duration")
+	}
+	if !sp.Connected() {
+		t.Fatal("peer disconnected")
+	}
+
+	if err := s.BanPeer("127.0.0.1", time.Hour); err != nil {
+		t.Fatalf("unable to ban peer: %v", err)
+	}
+	disconnected := make(chan struct{})
+	go func() {
+		sp.WaitForDisconnect()
+		close(disconnected)
+	}()
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("banned peer not disconnected")
+	}
+	if _, ok := banList.IsBanned("127.0.0.1"); !ok {
+		t.Fatal("banned peer not in ban list")
+	}
+
+	// The peer is left for the done peer handler to clean up.
+	if _, ok := state.inboundPeers[sp.ID()]; !ok {
+		t.Fatal("banned peer removed before it is done")
+	}
+}
@@ -69,3 +69,11 @@ func interruptRequested(interrupted <-chan struct{}) bool {
 
 	return false
 }
+
+// requestShutdown initiates shutdown using the same code path as when an
+// interrupt signal is received.  It does not block.
+func requestShutdown() {
+	go func() {
+		shutdownRequestChannel <- struct{}{}
+	}()
+}
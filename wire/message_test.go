@@ -76,6 +76,12 @@ func TestMessage(t *testing.T) {
 		[]byte("payload"))
 	msgCFHeaders := NewMsgCFHeaders()
 	msgCFCheckpt := NewMsgCFCheckpt(GCSFilterRegular, &chainhash.Hash{}, 0)
+	msgSendCmpct := NewMsgSendCmpct(true, 2)
+	msgCmpctBlock := NewMsgCmpctBlock(bh, 123123)
+	msgCmpctBlock.ShortIDs = []uint64{0x010203040506}
+	msgCmpctBlock.PrefilledTxs = []PrefilledTx{{Index: 0, Tx: NewMsgTx(1)}}
+	msgGetBlockTxn := NewMsgGetBlockTxn(&chainhash.Hash{}, []uint32{1, 3})
+	msgBlockTxn := NewMsgBlockTxn(&chainhash.Hash{}, []*MsgTx{NewMsgTx(1)})
 
 	tests := []struct {
 		in     Message    // Value to encode
@@ -111,6 +117,10 @@ func TestMessage(t *testing.T) {
 		{msgCFilter, msgCFilter, pver, MainNet, 65},
 		{msgCFHeaders, msgCFHeaders, pver, MainNet, 90},
 		{msgCFCheckpt, msgCFCheckpt, pver, MainNet, 58},
+		{msgSendCmpct, msgSendCmpct, pver, MainNet, 33},
+		{msgCmpctBlock, msgCmpctBlock, pver, MainNet, 131},
+		{msgGetBlockTxn, msgGetBlockTxn, pver, MainNet, 59},
+		{msgBlockTxn, msgBlockTxn, pver, MainNet, 67},
 	}
 
 	t.Logf("Running %d tests", len(tests))
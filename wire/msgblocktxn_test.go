@@ -0,0 +1,79 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestBlockTxnWire tests the MsgBlockTxn wire encode and decode including the
+// witness data of the transactions.
+func TestBlockTxnWire(t *testing.T) {
+	hash := chainhash.Hash{0x01}
+	msg := NewMsgBlockTxn(&hash, []*MsgTx{
+		blockOne.Transactions[0], multiWitnessTx,
+	})
+
+	var buf bytes.Buffer
+	err := msg.BtcEncode(&buf, ProtocolVersion, WitnessEncoding)
+	if err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if !bytes.HasSuffix(buf.Bytes(), multiWitnessTxEncoded) {
+		t.Fatal("BtcEncode did not encode the witness data")
+	}
+
+	var readMsg MsgBlockTxn
+	err = readMsg.BtcDecode(bytes.NewReader(buf.Bytes()), ProtocolVersion,
+		WitnessEncoding)
+	if err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(&readMsg),
+			spew.Sdump(msg))
+	}
+}
+
+// TestBlockTxnWireErrors performs negative tests against wire encode and
+// decode of MsgBlockTxn to confirm error paths work correctly.
+func TestBlockTxnWireErrors(t *testing.T) {
+	var hash chainhash.Hash
+	msg := NewMsgBlockTxn(&hash, nil)
+	var buf bytes.Buffer
+	err := msg.BtcEncode(&buf, CompactBlocksVersion-1, BaseEncoding)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("BtcEncode wrong error got: %v, want: *MessageError",
+			err)
+	}
+
+	decodeTests := []struct {
+		name string
+		buf  []byte
+		pver uint32
+	}{{
+		name: "protocol version prior to compact blocks",
+		buf:  append(hash[:], 0x00),
+		pver: CompactBlocksVersion - 1,
+	}, {
+		name: "too many transactions",
+		buf:  append(hash[:], 0xfe, 0xff, 0xff, 0xff, 0xff),
+		pver: ProtocolVersion,
+	}}
+	for _, test := range decodeTests {
+		var msg MsgBlockTxn
+		err := msg.BtcDecode(bytes.NewReader(test.buf), test.pver,
+			BaseEncoding)
+		if _, ok := err.(*MessageError); !ok {
+			t.Errorf("%s: BtcDecode wrong error got: %v, want: "+
+				"*MessageError", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// CmpctShortIDSize is the number of bytes of the short transaction ids used by
+// the cmpctblock message.
+const CmpctShortIDSize = 6
+
+// MaxCmpctShortID is the maximum value of a short transaction id.
+const MaxCmpctShortID = 1<<(CmpctShortIDSize*8) - 1
+
+// PrefilledTx houses a transaction sent in full as part of a cmpctblock
+// message along with its index in the block.
+type PrefilledTx struct {
+	// Index is the index of the transaction in the block.
+	Index uint32
+
+	// Tx is the transaction.
+	Tx *MsgTx
+}
+
+// MsgCmpctBlock implements the Message interface and represents a bitcoin
+// cmpctblock message.  It is used to relay a block as defined by BIP0152 by
+// sending its header along with short ids of its transactions, which the
+// receiving peer is likely to already have, and any transactions it is
+// unlikely to have in full.
+//
+// The prefilled transactions must be ordered by their index in the block.
+// The short ids are for the remaining transactions in the order they appear
+// in the block.
+//
+// This message was not added until protocol versions starting with
+// CompactBlocksVersion.
+type MsgCmpctBlock struct {
+	Header       BlockHeader
+	Nonce        uint64
+	ShortIDs     []uint64
+	PrefilledTxs []PrefilledTx
+}
+
+// TxCount returns the number of transactions in the block the message
+// represents.
+func (msg *MsgCmpctBlock) TxCount() int {
+	return len(msg.ShortIDs) + len(msg.PrefilledTxs)
+}
+
+// readDiffIndex reads a transaction index that is differentially encoded as in
+// the cmpctblock and getblocktxn messages from r.  The passed next index is
+// the index following the previously read one, or zero for the first index.
+func readDiffIndex(r io.Reader, pver uint32, next uint64, fn string) (uint32, error) {
+	diff, err := ReadVarInt(r, pver)
+	if err != nil {
+		return 0, err
+	}
+
+	// Prevent indexes beyond the maximum number of transactions that could
+	// fit into a block.  This also protects against overflow.
+	if diff >= maxTxPerBlock || next+diff >= maxTxPerBlock {
+		str := fmt.Sprintf("transaction index out of range "+
+			"[index %d, max %d]", next+diff, maxTxPerBlock-1)
+		return 0, messageError(fn, str)
+	}
+
+	return uint32(next + diff), nil
+}
+
+// writeDiffIndex writes the passed transaction index to w differentially
+// encoded as in the cmpctblock and getblocktxn messages.  The passed next index
+// is the index following the previously written one, or zero for the first
+// index.
+func writeDiffIndex(w io.Writer, pver uint32, next uint64, index uint32, fn string) error {
+	if uint64(index) < next {
+		str := fmt.Sprintf("transaction index %d is not in ascending "+
+			"order", index)
+		return messageError(fn, str)
+	}
+
+	return WriteVarInt(w, pver, uint64(index)-next)
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < CompactBlocksVersion {
+		str := fmt.Sprintf("cmpctblock message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+
+	err := readBlockHeader(r, pver, &msg.Header)
+	if err != nil {
+		return err
+	}
+	err = readElement(r, &msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	// Prevent more short ids than transactions could possibly fit into a
+	// block.
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many short ids to fit into a block "+
+			"[count %d, max %d]", count, maxTxPerBlock)
+		return messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+
+	var buf [8]byte
+	msg.ShortIDs = make([]uint64, count)
+	for i := range msg.ShortIDs {
+		_, err := io.ReadFull(r, buf[:CmpctShortIDSize])
+		if err != nil {
+			return err
+		}
+		msg.ShortIDs[i] = binary.LittleEndian.Uint64(buf[:])
+	}
+
+	// Prevent more transactions in total than could possibly fit into a
+	// block.
+	count, err = ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > maxTxPerBlock-uint64(len(msg.ShortIDs)) {
+		str := fmt.Sprintf("too many transactions to fit into a block "+
+			"[count %d, max %d]", count+uint64(len(msg.ShortIDs)),
+			maxTxPerBlock)
+		return messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+
+	msg.PrefilledTxs = make([]PrefilledTx, count)
+	var next uint64
+	for i := range msg.PrefilledTxs {
+		index, err := readDiffIndex(r, pver, next,
+			"MsgCmpctBlock.BtcDecode")
+		if err != nil {
+			return err
+		}
+		tx := MsgTx{}
+		err = tx.BtcDecode(r, pver, enc)
+		if err != nil {
+			return err
+		}
+		msg.PrefilledTxs[i] = PrefilledTx{Index: index, Tx: &tx}
+		next = uint64(index) + 1
+	}
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < CompactBlocksVersion {
+		str := fmt.Sprintf("cmpctblock message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgCmpctBlock.BtcEncode", str)
+	}
+
+	if msg.TxCount() > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions to fit into a block "+
+			"[count %d, max %d]", msg.TxCount(), maxTxPerBlock)
+		return messageError("MsgCmpctBlock.BtcEncode", str)
+	}
+
+	err := writeBlockHeader(w, pver, &msg.Header)
+	if err != nil {
+		return err
+	}
+	err = writeElement(w, msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.ShortIDs)))
+	if err != nil {
+		return err
+	}
+	var buf [8]byte
+	for _, shortID := range msg.ShortIDs {
+		if shortID > MaxCmpctShortID {
+			str := fmt.Sprintf("short id %x is larger than %d "+
+				"bytes", shortID, CmpctShortIDSize)
+			return messageError("MsgCmpctBlock.BtcEncode", str)
+		}
+		binary.LittleEndian.PutUint64(buf[:], shortID)
+		_, err := w.Write(buf[:CmpctShortIDSize])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.PrefilledTxs)))
+	if err != nil {
+		return err
+	}
+	var next uint64
+	for _, prefilled := range msg.PrefilledTxs {
+		err := writeDiffIndex(w, pver, next, prefilled.Index,
+			"MsgCmpctBlock.BtcEncode")
+		if err != nil {
+			return err
+		}
+		err = prefilled.Tx.BtcEncode(w, pver, enc)
+		if err != nil {
+			return err
+		}
+		next = uint64(prefilled.Index) + 1
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCmpctBlock) Command() string {
+	return CmdCmpctBlock
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) MaxPayloadLength(pver uint32) uint32 {
+	// A compact block is no larger than the block it represents in
+	// practice, so use the same limit as block messages.
+	return MaxBlockPayload
+}
+
+// NewMsgCmpctBlock returns a new bitcoin cmpctblock message that conforms to
+// the Message interface using the passed parameters.  See MsgCmpctBlock for
+// details.
+func NewMsgCmpctBlock(header *BlockHeader, nonce uint64) *MsgCmpctBlock {
+	return &MsgCmpctBlock{
+		Header: *header,
+		Nonce:  nonce,
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestCmpctBlockWire tests the MsgCmpctBlock wire encode and decode including
+// the differential encoding of the prefilled transaction indexes and the
+// witness data of prefilled transactions.
+func TestCmpctBlockWire(t *testing.T) {
+	msg := NewMsgCmpctBlock(&blockOne.Header, 0x0102030405060708)
+	msg.ShortIDs = []uint64{0x0a0b0c0d0e0f, MaxCmpctShortID}
+	msg.PrefilledTxs = []PrefilledTx{
+		{Index: 0, Tx: blockOne.Transactions[0]},
+		{Index: 3, Tx: multiWitnessTx},
+	}
+	if msg.TxCount() != 4 {
+		t.Fatalf("TxCount: got %d, want 4", msg.TxCount())
+	}
+
+	var buf bytes.Buffer
+	err := msg.BtcEncode(&buf, ProtocolVersion, WitnessEncoding)
+	if err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+
+	// Ensure the short ids are encoded as 6 bytes each and the second
+	// prefilled index is encoded relative to the first.
+	encoded := buf.Bytes()
+	shortIDs := encoded[blockHeaderLen+8:]
+	wantShortIDs := []byte{
+		0x02,
+		0x0f, 0x0e, 0x0d, 0x0c, 0x0b, 0x0a,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0x02, 0x00,
+	}
+	if !bytes.HasPrefix(shortIDs, wantShortIDs) {
+		t.Fatalf("BtcEncode\n got: %s want prefix: %s",
+			spew.Sdump(shortIDs[:len(wantShortIDs)]),
+			spew.Sdump(wantShortIDs))
+	}
+	var coinbase bytes.Buffer
+	err = blockOne.Transactions[0].BtcEncode(&coinbase, ProtocolVersion,
+		WitnessEncoding)
+	if err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if diff := shortIDs[len(wantShortIDs)+coinbase.Len()]; diff != 0x02 {
+		t.Fatalf("second prefilled index encoded as %d, want 2", diff)
+	}
+
+	var readMsg MsgCmpctBlock
+	err = readMsg.BtcDecode(bytes.NewReader(encoded), ProtocolVersion,
+		WitnessEncoding)
+	if err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(&readMsg),
+			spew.Sdump(msg))
+	}
+}
+
+// TestCmpctBlockWireErrors performs negative tests against wire encode and
+// decode of MsgCmpctBlock to confirm error paths work correctly.
+func TestCmpctBlockWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	header := blockOne.Header
+
+	// encodedWith returns an encoded compact block of blockOne's header with
+	// the passed short id and prefilled transaction sections appended.
+	encodedWith := func(sections ...[]byte) []byte {
+		var buf bytes.Buffer
+		writeBlockHeader(&buf, pver, &header)
+		writeElement(&buf, uint64(0))
+		for _, section := range sections {
+			buf.Write(section)
+		}
+		return buf.Bytes()
+	}
+
+	encodeTests := []struct {
+		name string
+		msg  *MsgCmpctBlock
+		pver uint32
+	}{{
+		name: "protocol version prior to compact blocks",
+		msg:  NewMsgCmpctBlock(&header, 0),
+		pver: CompactBlocksVersion - 1,
+	}, {
+		name: "short id too large",
+		msg: &MsgCmpctBlock{
+			Header:   header,
+			ShortIDs: []uint64{MaxCmpctShortID + 1},
+		},
+		pver: pver,
+	}, {
+		name: "prefilled indexes not ascending",
+		msg: &MsgCmpctBlock{
+			Header: header,
+			PrefilledTxs: []PrefilledTx{
+				{Index: 1, Tx: NewMsgTx(1)},
+				{Index: 1, Tx: NewMsgTx(1)},
+			},
+		},
+		pver: pver,
+	}}
+	for _, test := range encodeTests {
+		var buf bytes.Buffer
+		err := test.msg.BtcEncode(&buf, test.pver, BaseEncoding)
+		if _, ok := err.(*MessageError); !ok {
+			t.Errorf("%s: BtcEncode wrong error got: %v, want: "+
+				"*MessageError", test.name, err)
+		}
+	}
+
+	decodeTests := []struct {
+		name string
+		buf  []byte
+		pver uint32
+	}{{
+		name: "protocol version prior to compact blocks",
+		buf:  encodedWith([]byte{0x00, 0x00}),
+		pver: CompactBlocksVersion - 1,
+	}, {
+		name: "too many short ids",
+		buf:  encodedWith([]byte{0xfe, 0xff, 0xff, 0xff, 0xff}),
+		pver: pver,
+	}, {
+		name: "too many transactions",
+		buf: encodedWith([]byte{0x01, 0, 0, 0, 0, 0, 0},
+			[]byte{0xfe, 0x81, 0x1a, 0x06, 0x00}),
+		pver: pver,
+	}, {
+		name: "prefilled index out of range",
+		buf: encodedWith([]byte{0x00, 0x01},
+			[]byte{0xfe, 0xff, 0xff, 0xff, 0xff}),
+		pver: pver,
+	}}
+	for _, test := range decodeTests {
+		var msg MsgCmpctBlock
+		err := msg.BtcDecode(bytes.NewReader(test.buf), test.pver,
+			BaseEncoding)
+		if _, ok := err.(*MessageError); !ok {
+			t.Errorf("%s: BtcDecode wrong error got: %v, want: "+
+				"*MessageError", test.name, err)
+		}
+	}
+}
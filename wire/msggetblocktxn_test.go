@@ -0,0 +1,103 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestGetBlockTxnWire tests the MsgGetBlockTxn wire encode and decode
+// including the differential encoding of the indexes.
+func TestGetBlockTxnWire(t *testing.T) {
+	hash := chainhash.Hash{0x01}
+	msg := NewMsgGetBlockTxn(&hash, []uint32{1, 2, 5, 300})
+	want := append(hash[:], []byte{
+		0x04,             // Varint for number of indexes
+		0x01,             // Index 1
+		0x00,             // Index 2
+		0x02,             // Index 5
+		0xfd, 0x26, 0x01, // Index 300
+	}...)
+
+	var buf bytes.Buffer
+	err := msg.BtcEncode(&buf, ProtocolVersion, BaseEncoding)
+	if err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("BtcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(want))
+	}
+
+	var readMsg MsgGetBlockTxn
+	err = readMsg.BtcDecode(bytes.NewReader(want), ProtocolVersion,
+		BaseEncoding)
+	if err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(&readMsg),
+			spew.Sdump(msg))
+	}
+}
+
+// TestGetBlockTxnWireErrors performs negative tests against wire encode and
+// decode of MsgGetBlockTxn to confirm error paths work correctly.
+func TestGetBlockTxnWireErrors(t *testing.T) {
+	var hash chainhash.Hash
+	encodeTests := []struct {
+		name string
+		msg  *MsgGetBlockTxn
+		pver uint32
+	}{{
+		name: "protocol version prior to compact blocks",
+		msg:  NewMsgGetBlockTxn(&hash, []uint32{0}),
+		pver: CompactBlocksVersion - 1,
+	}, {
+		name: "indexes not ascending",
+		msg:  NewMsgGetBlockTxn(&hash, []uint32{2, 1}),
+		pver: ProtocolVersion,
+	}}
+	for _, test := range encodeTests {
+		var buf bytes.Buffer
+		err := test.msg.BtcEncode(&buf, test.pver, BaseEncoding)
+		if _, ok := err.(*MessageError); !ok {
+			t.Errorf("%s: BtcEncode wrong error got: %v, want: "+
+				"*MessageError", test.name, err)
+		}
+	}
+
+	decodeTests := []struct {
+		name string
+		buf  []byte
+		pver uint32
+	}{{
+		name: "protocol version prior to compact blocks",
+		buf:  append(hash[:], 0x01, 0x00),
+		pver: CompactBlocksVersion - 1,
+	}, {
+		name: "too many indexes",
+		buf:  append(hash[:], 0xfe, 0xff, 0xff, 0xff, 0xff),
+		pver: ProtocolVersion,
+	}, {
+		name: "index out of range",
+		buf:  append(hash[:], 0x02, 0x01, 0xfe, 0x80, 0x1a, 0x06, 0x00),
+		pver: ProtocolVersion,
+	}}
+	for _, test := range decodeTests {
+		var msg MsgGetBlockTxn
+		err := msg.BtcDecode(bytes.NewReader(test.buf), test.pver,
+			BaseEncoding)
+		if _, ok := err.(*MessageError); !ok {
+			t.Errorf("%s: BtcDecode wrong error got: %v, want: "+
+				"*MessageError", test.name, err)
+		}
+	}
+}
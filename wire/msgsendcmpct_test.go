@@ -0,0 +1,85 @@
+// Copyright (c) 2026 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestSendCmpctWire tests the MsgSendCmpct wire encode and decode for various
+// protocol versions.
+func TestSendCmpctWire(t *testing.T) {
+	tests := []struct {
+		in   MsgSendCmpct // Message to encode
+		buf  []byte       // Wire encoding
+		pver uint32       // Protocol version for wire encoding
+		err  bool         // Whether encoding and decoding fail
+	}{
+		// Latest protocol version.
+		{
+			MsgSendCmpct{Announce: true, Version: 2},
+			[]byte{0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			ProtocolVersion,
+			false,
+		},
+
+		// Protocol version CompactBlocksVersion.
+		{
+			MsgSendCmpct{Announce: false, Version: 1},
+			[]byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			CompactBlocksVersion,
+			false,
+		},
+
+		// Protocol version prior to CompactBlocksVersion.
+		{
+			MsgSendCmpct{Announce: true, Version: 2},
+			[]byte{0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			CompactBlocksVersion - 1,
+			true,
+		},
+	}
+
+	for i, test := range tests {
+		var buf bytes.Buffer
+		err := test.in.BtcEncode(&buf, test.pver, BaseEncoding)
+		if test.err {
+			if _, ok := err.(*MessageError); !ok {
+				t.Errorf("BtcEncode #%d wrong error got: %v, "+
+					"want: *MessageError", i, err)
+			}
+		} else if err != nil {
+			t.Errorf("BtcEncode #%d error %v", i, err)
+			continue
+		} else if !bytes.Equal(buf.Bytes(), test.buf) {
+			t.Errorf("BtcEncode #%d\n got: %s want: %s", i,
+				spew.Sdump(buf.Bytes()), spew.Sdump(test.buf))
+			continue
+		}
+
+		var msg MsgSendCmpct
+		err = msg.BtcDecode(bytes.NewReader(test.buf), test.pver,
+			BaseEncoding)
+		if test.err {
+			if _, ok := err.(*MessageError); !ok {
+				t.Errorf("BtcDecode #%d wrong error got: %v, "+
+					"want: *MessageError", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("BtcDecode #%d error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(msg, test.in) {
+			t.Errorf("BtcDecode #%d\n got: %s want: %s", i,
+				spew.Sdump(msg), spew.Sdump(test.in))
+		}
+	}
+}
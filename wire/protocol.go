@@ -52,6 +52,11 @@ const (
 	// feefilter message.
 	FeeFilterVersion uint32 = 70013
 
+	// CompactBlocksVersion is the protocol version which added the
+	// sendcmpct, cmpctblock, getblocktxn, and blocktxn messages used for
+	// compact block relay as defined by BIP0152.
+	CompactBlocksVersion uint32 = 70014
+
 	// AddrV2Version is the protocol version which added two new messages.
 	// sendaddrv2 is sent during the version-verack handshake and signals
 	// support for sending and receiving the addrv2 message. In the future,